@@ -0,0 +1,181 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AggregateSwapOptions configures AggregateAndSwap
+type AggregateSwapOptions struct {
+	// Database holding both source and target collections; empty uses the configured database
+	Database string
+	// Timeout for the whole rebuild; zero uses the plugin operation timeout
+	Timeout time.Duration
+	// Aggregate options applied to the pipeline (allowDiskUse, hint, ...), over the context call options
+	Aggregate *options.AggregateOptions
+}
+
+// AggregateSwapResult describes a completed rebuild
+type AggregateSwapResult struct {
+	// Temporary collection the pipeline wrote to before the rename
+	TempCollection string
+	// Estimated number of documents in the rebuilt collection
+	Documents int64
+	// Indexes of the previous target recreated on the rebuilt collection, besides _id
+	Indexes []string
+	// Total time spent building and swapping
+	Duration time.Duration
+}
+
+// AggregateAndSwap runs pipeline on source, writes the output to a temporary collection with $out and then
+// renames it over target with dropTarget, so readers only ever see the previous or the fully built data.
+// The indexes of target are recreated on the temporary collection before the rename, so unique
+// constraints and query indexes survive the swap. The temporary collection is dropped when any step
+// fails, including an index the rebuilt data violates. pipeline must not end with $out or $merge.
+func (p *PlugMongoDB) AggregateAndSwap(ctx context.Context, source, target string, pipeline mongo.Pipeline, opts *AggregateSwapOptions) (*AggregateSwapResult, error) {
+	if source == "" || target == "" {
+		return nil, fmt.Errorf("source and target collections cannot be empty")
+	}
+	if opts == nil {
+		opts = &AggregateSwapOptions{}
+	}
+	tempName, err := tempCollectionName(target)
+	if err != nil {
+		return nil, err
+	}
+	stages, err := swapStages(pipeline, tempName)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result := &AggregateSwapResult{TempCollection: tempName}
+	op := operation{name: "aggregateSwap", database: p.databaseName(opts.Database), collection: target, timeout: opts.Timeout, query: pipeline}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, opts.Database)
+		if err != nil {
+			return err
+		}
+
+		cursor, err := db.Collection(source).Aggregate(ctx, stages, callAggregateOptions(ctx), opts.Aggregate, commentAggregateOptions(ctx))
+		if err != nil {
+			p.dropTempCollection(db, tempName)
+			return fmt.Errorf("failed to build %s: %w", tempName, err)
+		}
+		_ = cursor.Close(ctx)
+
+		if n, err := db.Collection(tempName).EstimatedDocumentCount(ctx); err == nil {
+			result.Documents = n
+		}
+
+		indexes, err := copyTargetIndexes(ctx, db, target, tempName)
+		if err != nil {
+			p.dropTempCollection(db, tempName)
+			return fmt.Errorf("failed to copy the indexes of %s to %s: %w", target, tempName, err)
+		}
+		result.Indexes = indexes
+
+		rename := bson.D{
+			{Key: "renameCollection", Value: db.Name() + "." + tempName},
+			{Key: "to", Value: db.Name() + "." + target},
+			{Key: "dropTarget", Value: true},
+		}
+		if err := db.Client().Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+			p.dropTempCollection(db, tempName)
+			return fmt.Errorf("failed to swap %s into %s: %w", tempName, target, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.InvalidateStats(target)
+	result.Duration = time.Since(start)
+	log.Infof("mongodb rebuilt %s.%s from %s (%d documents) in %s", op.database, target, source, result.Documents, result.Duration)
+	return result, nil
+}
+
+// MergeStage builds a $merge stage writing into collection, matching on the given fields.
+// Empty whenMatched/whenNotMatched keep the server defaults (merge/insert).
+func MergeStage(collection string, on []string, whenMatched, whenNotMatched string) bson.D {
+	spec := bson.D{{Key: "into", Value: collection}}
+	if len(on) > 0 {
+		spec = append(spec, bson.E{Key: "on", Value: on})
+	}
+	if whenMatched != "" {
+		spec = append(spec, bson.E{Key: "whenMatched", Value: whenMatched})
+	}
+	if whenNotMatched != "" {
+		spec = append(spec, bson.E{Key: "whenNotMatched", Value: whenNotMatched})
+	}
+	return bson.D{{Key: "$merge", Value: spec}}
+}
+
+// dropTempCollection drops a temporary collection on a detached context, since the
+// operation context may already be canceled when cleanup runs
+func (p *PlugMongoDB) dropTempCollection(db *mongo.Database, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.Collection(name).Drop(ctx); err != nil {
+		log.Warnf("failed to drop temporary collection %s.%s: %v", db.Name(), name, err)
+	}
+}
+
+// swapStages returns pipeline writing its output to the temporary collection tempName. It rejects
+// pipelines already ending in $out or $merge, which would write elsewhere and leave nothing to swap.
+func swapStages(pipeline mongo.Pipeline, tempName string) (mongo.Pipeline, error) {
+	if n := len(pipeline); n > 0 && len(pipeline[n-1]) > 0 {
+		if stage := pipeline[n-1][0].Key; stage == "$out" || stage == "$merge" {
+			return nil, fmt.Errorf("pipeline cannot end with %s: AggregateAndSwap writes the output itself", stage)
+		}
+	}
+	stages := make(mongo.Pipeline, 0, len(pipeline)+1)
+	stages = append(stages, pipeline...)
+	return append(stages, bson.D{{Key: "$out", Value: tempName}}), nil
+}
+
+// copyTargetIndexes recreates the indexes of target, if it exists, on tempName and returns their
+// names; $out only builds the _id index, and the rename drops the indexes of target with it
+func copyTargetIndexes(ctx context.Context, db *mongo.Database, target, tempName string) ([]string, error) {
+	exists, err := collectionExists(ctx, db, target)
+	if err != nil || !exists {
+		return nil, err
+	}
+	definitions, err := listIndexDocuments(ctx, db.Collection(target))
+	if err != nil {
+		return nil, err
+	}
+	names := swapIndexNames(definitions)
+	if err := recreateIndexes(ctx, db, tempName, definitions, names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// swapIndexNames returns the names of the indexes to recreate on the rebuilt collection: all but
+// the _id index, which $out already built
+func swapIndexNames(definitions []bson.Raw) []string {
+	var names []string
+	for _, name := range indexNames(definitions) {
+		if name != "_id_" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func tempCollectionName(target string) (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate temporary collection name: %w", err)
+	}
+	return fmt.Sprintf("%s_tmp_%s", target, hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,154 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx-mongodb/internal/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestTempCollectionName(t *testing.T) {
+	a, err := tempCollectionName("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^orders_tmp_[0-9a-f]{12}$`).MatchString(a) {
+		t.Errorf("unexpected temporary collection name %q", a)
+	}
+	if b, _ := tempCollectionName("orders"); a == b {
+		t.Error("temporary collection names should not repeat")
+	}
+}
+
+func TestSwapStages(t *testing.T) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "status", Value: "paid"}}}}}
+	stages, err := swapStages(pipeline, "orders_tmp_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 2 || !valuesEqual(stages[1], bson.D{{Key: "$out", Value: "orders_tmp_1"}}) {
+		t.Errorf("unexpected stages %v", stages)
+	}
+	if len(pipeline) != 1 {
+		t.Error("swapStages must not modify the pipeline")
+	}
+	if stages, err := swapStages(nil, "orders_tmp_1"); err != nil || len(stages) != 1 {
+		t.Errorf("empty pipeline: %v, %v", stages, err)
+	}
+
+	for _, last := range []bson.D{
+		{{Key: "$out", Value: "orders_copy"}},
+		MergeStage("orders_copy", nil, "", ""),
+	} {
+		if _, err := swapStages(append(pipeline, last), "orders_tmp_1"); err == nil {
+			t.Errorf("expected a pipeline ending with %s to be rejected", last[0].Key)
+		}
+	}
+}
+
+func TestSwapIndexNames(t *testing.T) {
+	var definitions []bson.Raw
+	for _, idx := range []bson.D{
+		{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}},
+		{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "sku", Value: 1}}}, {Key: "name", Value: "sku_1"}, {Key: "unique", Value: true}},
+		{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "total", Value: -1}}}, {Key: "name", Value: "total_-1"}},
+	} {
+		raw, err := bson.Marshal(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		definitions = append(definitions, raw)
+	}
+	if got := swapIndexNames(definitions); len(got) != 2 || got[0] != "sku_1" || got[1] != "total_-1" {
+		t.Errorf("indexes to recreate = %v", got)
+	}
+}
+
+// TestAggregateAndSwapKeepsIndexes runs against a server. It only runs with MONGODB_INTEGRATION_TEST=1,
+// on MONGODB_INTEGRATION_URI or a docker container:
+//
+//	MONGODB_INTEGRATION_TEST=1 go test -run TestAggregateAndSwapKeepsIndexes -v .
+func TestAggregateAndSwapKeepsIndexes(t *testing.T) {
+	if os.Getenv("MONGODB_INTEGRATION_TEST") != "1" {
+		t.Skip("set MONGODB_INTEGRATION_TEST=1 to run against a server")
+	}
+	ctx := context.Background()
+	uri := os.Getenv("MONGODB_INTEGRATION_URI")
+	if uri == "" {
+		if !mongotest.Available() {
+			t.Skip("docker is not available and MONGODB_INTEGRATION_URI is not set")
+		}
+		startCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+		container, err := mongotest.Start(startCtx, "mongo:7.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = container.Stop() }()
+		uri = container.URI
+	}
+
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{
+		Uri:                    uri,
+		Database:               "lynx_swap_test",
+		ConnectTimeout:         durationpb.New(10 * time.Second),
+		ServerSelectionTimeout: durationpb.New(10 * time.Second),
+	})
+	if err := p.createClientContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = p.GetClient().Disconnect(context.Background()) }()
+	db := p.GetDatabase()
+	defer func() { _ = db.Drop(context.Background()) }()
+
+	if _, err := db.Collection("orders").InsertMany(ctx, []any{
+		bson.D{{Key: "sku", Value: "a"}, {Key: "total", Value: 10}},
+		bson.D{{Key: "sku", Value: "b"}, {Key: "total", Value: 20}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	unique := mongo.IndexModel{Keys: bson.D{{Key: "sku", Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := db.Collection("order_totals").Indexes().CreateOne(ctx, unique); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$project", Value: bson.D{{Key: "sku", Value: 1}, {Key: "total", Value: 1}}}}}
+	result, err := p.AggregateAndSwap(ctx, "orders", "order_totals", pipeline, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Indexes) != 1 || result.Indexes[0] != "sku_1" {
+		t.Errorf("recreated indexes = %v", result.Indexes)
+	}
+	indexes, err := listIndexDocuments(ctx, db.Collection("order_totals"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := false
+	for _, idx := range indexes {
+		if name, _ := idx.Lookup("name").StringValueOK(); name == "sku_1" {
+			kept, _ = idx.Lookup("unique").BooleanOK()
+		}
+	}
+	if !kept {
+		t.Errorf("expected the unique index to survive the swap, got %v", indexNames(indexes))
+	}
+
+	// Rebuilt data violating an index fails the swap and keeps the previous collection
+	dup := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "sku", Value: "same"}}}}}
+	if _, err := p.AggregateAndSwap(ctx, "orders", "order_totals", dup, nil); err == nil {
+		t.Error("expected the duplicate skus to fail the swap")
+	}
+	if n, _ := db.Collection("order_totals").CountDocuments(ctx, bson.D{{Key: "sku", Value: "a"}}); n != 1 {
+		t.Error("a failed swap must keep the previous collection")
+	}
+}
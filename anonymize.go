@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Transformer replaces the value of an anonymized field. Returning nil stores BSON null.
+type Transformer func(value any) (any, error)
+
+// HashField replaces values with the hex SHA-256 of salt and their extended JSON form, keeping
+// equal values equal (joins and distinct counts still work) without revealing them
+func HashField(salt string) Transformer {
+	return func(value any) (any, error) {
+		data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, true, false)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(append([]byte(salt), data...))
+		return hex.EncodeToString(sum[:]), nil
+	}
+}
+
+// NullField replaces values with null
+func NullField() Transformer {
+	return func(any) (any, error) {
+		return nil, nil
+	}
+}
+
+// Anonymizer maps dotted field paths to transformers. Paths descend into embedded documents and
+// apply to every element of arrays on the way ("items.email" covers each item's email).
+type Anonymizer map[string]Transformer
+
+// Apply returns a copy of doc with all configured fields transformed; missing fields are left out
+func (a Anonymizer) Apply(doc bson.Raw) (bson.Raw, error) {
+	if len(a) == 0 {
+		return doc, nil
+	}
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	for path, transform := range a {
+		if path == "" || transform == nil {
+			continue
+		}
+		out, err := transformPath(d, strings.Split(path, "."), transform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s: %w", path, err)
+		}
+		d = out.(bson.D)
+	}
+	return bson.Marshal(d)
+}
+
+// transformPath applies transform to the value at the remaining path segments of v
+func transformPath(v any, segments []string, transform Transformer) (any, error) {
+	switch val := v.(type) {
+	case bson.D:
+		for i := range val {
+			if val[i].Key != segments[0] {
+				continue
+			}
+			var (
+				next any
+				err  error
+			)
+			if len(segments) == 1 {
+				next, err = transform(val[i].Value)
+			} else {
+				next, err = transformPath(val[i].Value, segments[1:], transform)
+			}
+			if err != nil {
+				return nil, err
+			}
+			val[i].Value = next
+		}
+		return val, nil
+	case bson.A:
+		for i := range val {
+			next, err := transformPath(val[i], segments, transform)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = next
+		}
+		return val, nil
+	default:
+		return v, nil
+	}
+}
+
+// FakeKind selects the shape of values produced by FakeField
+type FakeKind int
+
+const (
+	// FakeString produces "anon-<hex>" strings
+	FakeString FakeKind = iota
+	// FakeEmail produces "user-<hex>@example.invalid" addresses
+	FakeEmail
+	// FakeName produces "Name <hex>" display names
+	FakeName
+	// FakePhone produces "+1555<7 digits>" numbers
+	FakePhone
+)
+
+// FakeField replaces values with realistic-looking fake values derived deterministically from
+// seed and the original value, so equal inputs map to equal fakes across documents and runs
+func FakeField(kind FakeKind, seed string) Transformer {
+	hash := HashField(seed)
+	return func(value any) (any, error) {
+		if value == nil {
+			return nil, nil
+		}
+		h, err := hash(value)
+		if err != nil {
+			return nil, err
+		}
+		digest := h.(string)
+		switch kind {
+		case FakeEmail:
+			return "user-" + digest[:12] + "@example.invalid", nil
+		case FakeName:
+			return "Name " + strings.ToUpper(digest[:6]), nil
+		case FakePhone:
+			var digits strings.Builder
+			for _, c := range digest {
+				if digits.Len() == 7 {
+					break
+				}
+				digits.WriteByte(byte('0' + c%10))
+			}
+			return "+1555" + digits.String(), nil
+		default:
+			return "anon-" + digest[:16], nil
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAnonymizerApply(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{
+		{Key: "email", Value: "alice@example.com"},
+		{Key: "phone", Value: "555-0100"},
+		{Key: "orders", Value: bson.A{
+			bson.D{{Key: "card", Value: "4111"}, {Key: "total", Value: 10}},
+			bson.D{{Key: "card", Value: "5500"}, {Key: "total", Value: 20}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymizer := Anonymizer{
+		"email":       HashField("salt"),
+		"phone":       NullField(),
+		"orders.card": NullField(),
+		"missing.x":   NullField(),
+	}
+	out, err := anonymizer.Apply(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := out.Lookup("email").StringValue()
+	if email == "alice@example.com" || len(email) != 64 {
+		t.Errorf("expected hashed email, got %q", email)
+	}
+	again, _ := anonymizer.Apply(doc)
+	if again.Lookup("email").StringValue() != email {
+		t.Error("hashing must be deterministic")
+	}
+	if out.Lookup("phone").Type != bson.TypeNull {
+		t.Error("expected phone to be null")
+	}
+	if out.Lookup("orders", "0", "card").Type != bson.TypeNull || out.Lookup("orders", "1", "total").Int32() != 20 {
+		t.Errorf("expected array elements to be anonymized field by field, got %s", out)
+	}
+	if _, err := out.LookupErr("missing"); err == nil {
+		t.Error("missing paths must not be created")
+	}
+}
+
+func TestFakeField(t *testing.T) {
+	email := FakeField(FakeEmail, "seed")
+	a, err := email("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := email("alice@example.com")
+	c, _ := email("bob@example.com")
+	if a != b || a == c {
+		t.Errorf("expected deterministic distinct fakes, got %v %v %v", a, b, c)
+	}
+	if s := a.(string); len(s) == 0 || s[len(s)-len("@example.invalid"):] != "@example.invalid" {
+		t.Errorf("unexpected fake email %q", s)
+	}
+	phone, _ := FakeField(FakePhone, "seed")("555-0100")
+	if s := phone.(string); len(s) != 12 {
+		t.Errorf("unexpected fake phone %q", s)
+	}
+	if v, _ := FakeField(FakeName, "seed")(nil); v != nil {
+		t.Error("expected null to stay null")
+	}
+}
+
+func TestCopyAnonymizedValidation(t *testing.T) {
+	p := NewMongoDBClient()
+	WithDatabase("app")(p)
+	if _, err := p.CopyAnonymized(context.Background(), "users", AnonymizedCopyOptions{}); err == nil {
+		t.Error("expected missing target database to be rejected")
+	}
+	if _, err := p.CopyAnonymized(context.Background(), "users", AnonymizedCopyOptions{TargetDatabase: "app"}); err == nil {
+		t.Error("expected copying onto the source collection to be rejected")
+	}
+}
@@ -0,0 +1,146 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultCopyBatchSize is the number of documents inserted per batch
+	defaultCopyBatchSize = 500
+	// defaultCopyTimeout bounds a whole copy when no timeout is given
+	defaultCopyTimeout = time.Hour
+)
+
+// AnonymizedCopyOptions configures CopyAnonymized
+type AnonymizedCopyOptions struct {
+	// SourceDatabase defaults to the configured database
+	SourceDatabase string
+	// TargetDatabase receives the copy; required
+	TargetDatabase string
+	// TargetCollection defaults to the source collection name
+	TargetCollection string
+	// TargetClient writes to another cluster (e.g. staging); defaults to the plugin client
+	TargetClient *mongo.Client
+	// Filter restricts the copied documents (nil copies all)
+	Filter any
+	// Anonymize transforms fields before they are written
+	Anonymize Anonymizer
+	// BatchSize is the number of documents inserted per batch (default 500)
+	BatchSize int
+	// DropTarget drops the target collection before copying
+	DropTarget bool
+	// Timeout bounds the whole copy (default 1h)
+	Timeout time.Duration
+}
+
+// CopyResult summarizes a CopyAnonymized run
+type CopyResult struct {
+	Copied   int64
+	Duration time.Duration
+}
+
+// CopyAnonymized streams the documents of collection through the configured field transformers into
+// a target database, in unordered batches, reporting progress through metrics and logs. It is meant
+// to refresh lower environments from production-shaped data.
+func (p *PlugMongoDB) CopyAnonymized(ctx context.Context, collection string, opts AnonymizedCopyOptions) (*CopyResult, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	if opts.TargetDatabase == "" {
+		return nil, fmt.Errorf("target database cannot be empty")
+	}
+	targetCollection := opts.TargetCollection
+	if targetCollection == "" {
+		targetCollection = collection
+	}
+	if opts.TargetClient == nil && opts.TargetDatabase == p.databaseName(opts.SourceDatabase) && targetCollection == collection {
+		return nil, fmt.Errorf("target %s.%s is the source collection", opts.TargetDatabase, targetCollection)
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCopyBatchSize
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultCopyTimeout
+	}
+	filter := opts.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	start := time.Now()
+	result := &CopyResult{}
+	// A retry would drop and copy the target again over the batches already counted
+	ctx = WithIdempotency(ctx, NonIdempotent)
+	op := operation{name: "anonymizedCopy", database: p.databaseName(opts.SourceDatabase), collection: collection, timeout: timeout, query: filter}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		src, err := p.databaseHandle(ctx, opts.SourceDatabase)
+		if err != nil {
+			return err
+		}
+		targetClient := opts.TargetClient
+		if targetClient == nil {
+			targetClient = src.Client()
+		}
+		target := targetClient.Database(opts.TargetDatabase).Collection(targetCollection)
+		if opts.DropTarget {
+			if err := target.Drop(ctx); err != nil {
+				return fmt.Errorf("failed to drop target %s.%s: %w", opts.TargetDatabase, targetCollection, err)
+			}
+		}
+
+		cursor, err := src.Collection(collection).Find(ctx, filter, options.Find().SetBatchSize(int32(batchSize)), commentFindOptions(ctx))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		batch := make([]any, 0, batchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if _, err := target.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+				return fmt.Errorf("failed to write batch to %s.%s: %w", opts.TargetDatabase, targetCollection, err)
+			}
+			result.Copied += int64(len(batch))
+			if p.prometheusMetrics != nil {
+				p.prometheusMetrics.RecordAnonymizedCopy(p.config(), collection, len(batch))
+			}
+			log.Debugf("mongodb anonymized copy of %s: %d documents copied", op.namespace(), result.Copied)
+			batch = batch[:0]
+			return nil
+		}
+		for cursor.Next(ctx) {
+			doc, err := opts.Anonymize.Apply(cursor.Current)
+			if err != nil {
+				return err
+			}
+			// Apply returns the cursor buffer itself when nothing is anonymized
+			batch = append(batch, bson.Raw(append([]byte(nil), doc...)))
+			if len(batch) == batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		return flush()
+	})
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	log.Infof("mongodb anonymized copy of %s into %s.%s completed: %d documents in %s", op.namespace(), opts.TargetDatabase, targetCollection, result.Copied, result.Duration)
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+)
+
+// AuditEvent describes an operational change executed through the plugin (restructures, DDL, ...)
+type AuditEvent struct {
+	// Action performed (renameCollection, convertToCapped, collMod, ...)
+	Action string
+	// Namespace affected, in database.collection form
+	Namespace string
+	// Action-specific details (options, index carryover results, ...)
+	Details map[string]any
+	// Error is set when the action failed
+	Err error
+	// Time the action completed
+	Timestamp time.Time
+}
+
+// AuditHook receives audit events in addition to the structured audit log
+type AuditHook func(ctx context.Context, evt AuditEvent)
+
+// audit writes evt to the structured log and forwards it to the configured hook
+func (p *PlugMongoDB) audit(ctx context.Context, evt AuditEvent) {
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = time.Now()
+	}
+	keyvals := []any{"audit", "mongodb", "action", evt.Action, "namespace", evt.Namespace}
+	keys := make([]string, 0, len(evt.Details))
+	for k := range evt.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		keyvals = append(keyvals, k, evt.Details[k])
+	}
+	if evt.Err != nil {
+		keyvals = append(keyvals, "error", evt.Err.Error())
+		log.WarnwCtx(ctx, keyvals...)
+	} else {
+		log.InfowCtx(ctx, keyvals...)
+	}
+	if p.auditHook != nil {
+		p.auditHook(ctx, evt)
+	}
+}
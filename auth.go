@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Authentication mechanisms of auth.mechanism
+const (
+	authSCRAMSHA256 = "SCRAM-SHA-256"
+	authSCRAMSHA1   = "SCRAM-SHA-1"
+	authX509        = "MONGODB-X509"
+	authAWS         = "MONGODB-AWS"
+	authPLAIN       = "PLAIN"
+	authGSSAPI      = "GSSAPI"
+)
+
+// buildCredential returns the credential of cfg: auth when set, else username and password. It
+// returns nil without credentials. Password files and environment variables are read on every
+// call, so a rebuilt client picks up rotated secrets.
+func buildCredential(cfg *conf.MongoDB) (*options.Credential, error) {
+	a := cfg.GetAuth()
+	if a == nil {
+		if cfg.GetUsername() == "" || cfg.GetPassword() == "" {
+			return nil, nil
+		}
+		return &options.Credential{
+			Username:   cfg.GetUsername(),
+			Password:   cfg.GetPassword(),
+			AuthSource: cfg.GetAuthSource(),
+		}, nil
+	}
+
+	mechanism := strings.ToUpper(a.GetMechanism())
+	password, err := readSecret("password", a.GetPassword(), a.GetPasswordFile(), a.GetPasswordEnv())
+	if err != nil {
+		return nil, err
+	}
+	cred := &options.Credential{
+		AuthMechanism: mechanism,
+		AuthSource:    a.GetSource(),
+		Username:      a.GetUsername(),
+		Password:      password,
+		PasswordSet:   password != "",
+	}
+
+	switch mechanism {
+	case "", authSCRAMSHA256, authSCRAMSHA1, authPLAIN:
+		if cred.Username == "" || password == "" {
+			return nil, fmt.Errorf("%s authentication requires username and password", mechanismName(mechanism))
+		}
+	case authX509:
+		if password != "" {
+			return nil, fmt.Errorf("%s authentication takes no password", authX509)
+		}
+		if !cfg.GetEnableTls() || cfg.GetTlsCertFile() == "" {
+			return nil, fmt.Errorf("%s authentication requires enable_tls and tls_cert_file", authX509)
+		}
+	case authAWS:
+		if (cred.Username == "") != (password == "") {
+			return nil, fmt.Errorf("%s authentication requires both username and password, or neither to use the environment", authAWS)
+		}
+		token, err := readSecret("aws_session_token", a.GetAwsSessionToken(), "", a.GetAwsSessionTokenEnv())
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			cred.AuthMechanismProperties = map[string]string{"AWS_SESSION_TOKEN": token}
+		}
+	case authGSSAPI:
+		if cred.Username == "" {
+			return nil, fmt.Errorf("%s authentication requires username", authGSSAPI)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mechanism %q", a.GetMechanism())
+	}
+	return cred, nil
+}
+
+// mechanismName names mechanism in errors; empty negotiates SCRAM
+func mechanismName(mechanism string) string {
+	if mechanism == "" {
+		return "SCRAM"
+	}
+	return mechanism
+}
+
+// readSecret returns the secret given inline, in file or in the environment variable env; at most
+// one of them may be set
+func readSecret(name, value, file, env string) (string, error) {
+	set := 0
+	for _, s := range []string{value, file, env} {
+		if s != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", fmt.Errorf("%s is set more than once (inline, file or environment)", name)
+	}
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s file: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("%s environment variable %s is not set", name, env)
+		}
+		return v, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,63 @@
+package mongodb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+func TestBuildCredential(t *testing.T) {
+	if cred, err := buildCredential(&conf.MongoDB{}); cred != nil || err != nil {
+		t.Errorf("no credentials: %v, %v", cred, err)
+	}
+	cred, err := buildCredential(&conf.MongoDB{Username: "app", Password: "secret", AuthSource: "admin"})
+	if err != nil || cred.Username != "app" || cred.Password != "secret" || cred.AuthSource != "admin" {
+		t.Errorf("legacy credentials: %+v, %v", cred, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cred, err = buildCredential(&conf.MongoDB{Username: "ignored", Password: "ignored", Auth: &conf.Auth{
+		Mechanism: "scram-sha-256", Username: "app", PasswordFile: file}})
+	if err != nil || cred.AuthMechanism != authSCRAMSHA256 || cred.Username != "app" || cred.Password != "from-file" {
+		t.Errorf("auth with password file: %+v, %v", cred, err)
+	}
+
+	t.Setenv("MONGO_TEST_PASSWORD", "from-env")
+	t.Setenv("MONGO_TEST_TOKEN", "token")
+	cred, err = buildCredential(&conf.MongoDB{Auth: &conf.Auth{Mechanism: authAWS, Username: "AKIA",
+		PasswordEnv: "MONGO_TEST_PASSWORD", AwsSessionTokenEnv: "MONGO_TEST_TOKEN"}})
+	if err != nil || cred.Password != "from-env" || cred.AuthMechanismProperties["AWS_SESSION_TOKEN"] != "token" {
+		t.Errorf("aws credentials: %+v, %v", cred, err)
+	}
+	if cred, err := buildCredential(&conf.MongoDB{Auth: &conf.Auth{Mechanism: authAWS}}); err != nil || cred.Username != "" {
+		t.Errorf("aws credentials from the environment: %+v, %v", cred, err)
+	}
+
+	certFile, keyFile := writeTestCert(t)
+	cred, err = buildCredential(&conf.MongoDB{EnableTls: true, TlsCertFile: certFile, TlsKeyFile: keyFile,
+		Auth: &conf.Auth{Mechanism: authX509}})
+	if err != nil || cred.AuthMechanism != authX509 {
+		t.Errorf("x509 credentials: %+v, %v", cred, err)
+	}
+
+	invalid := map[string]*conf.Auth{
+		"missing password":        {Username: "app"},
+		"two password sources":    {Username: "app", Password: "a", PasswordEnv: "MONGO_TEST_PASSWORD"},
+		"unset environment":       {Username: "app", PasswordEnv: "MONGO_TEST_UNSET"},
+		"missing password file":   {Username: "app", PasswordFile: filepath.Join(t.TempDir(), "missing")},
+		"x509 without tls":        {Mechanism: authX509},
+		"aws key without secret":  {Mechanism: authAWS, Username: "AKIA"},
+		"unsupported mechanism":   {Mechanism: "MONGODB-CR", Username: "app", Password: "a"},
+		"gssapi without username": {Mechanism: authGSSAPI},
+	}
+	for name, auth := range invalid {
+		if _, err := buildCredential(&conf.MongoDB{Auth: auth}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
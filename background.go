@@ -0,0 +1,106 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+)
+
+// startPeriodicTask runs fn every interval on a background goroutine tied to the plugin lifecycle,
+// like the metrics and health check loops. It is a no-op when a task with the same name is running.
+// Tasks stop when background tasks are stopped (Stop/cleanup).
+func (p *PlugMongoDB) startPeriodicTask(name string, interval time.Duration, fn func(ctx context.Context)) {
+	if interval <= 0 {
+		return
+	}
+	ctx, quit, ok := p.registerTask(name)
+	if !ok {
+		return
+	}
+	go func() {
+		defer p.statsWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn(ctx)
+			case <-ctx.Done():
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// startBackgroundTask runs fn once on a background goroutine tied to the plugin lifecycle, for
+// long-running loops such as change stream watchers. ctx is cancelled when background tasks are
+// stopped. It is a no-op when a task with the same name is running.
+func (p *PlugMongoDB) startBackgroundTask(name string, fn func(ctx context.Context)) {
+	ctx, quit, ok := p.registerTask(name)
+	if !ok {
+		return
+	}
+	go func() {
+		defer p.statsWG.Done()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// registerTask registers the background task name and adds it to the wait group; ok is false when
+// a task with the same name is running
+func (p *PlugMongoDB) registerTask(name string) (ctx context.Context, quit chan struct{}, ok bool) {
+	p.ensureStatsQuit()
+
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	if _, running := p.periodicCancels[name]; running {
+		return nil, nil, false
+	}
+	baseCtx := p.lifecycleCtx
+	if baseCtx == nil {
+		baseCtx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(baseCtx)
+	if p.periodicCancels == nil {
+		p.periodicCancels = make(map[string]context.CancelFunc)
+	}
+	p.periodicCancels[name] = cancel
+	p.statsWG.Add(1)
+	return ctx, p.statsQuit, true
+}
+
+// stopPeriodicTasks cancels all periodic tasks
+func (p *PlugMongoDB) stopPeriodicTasks() {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	for name, cancel := range p.periodicCancels {
+		cancel()
+		delete(p.periodicCancels, name)
+	}
+}
+
+// startOptionalTasks starts the configured optional background tasks
+func (p *PlugMongoDB) startOptionalTasks() {
+	p.startQualityChecks()
+	p.startDDLWindow()
+	p.trackConfiguredStats()
+	p.startPlanCacheMetrics()
+	p.startBackupMonitor()
+	p.startSLOBurnRates()
+	p.startHotDocumentDecay()
+	p.startFailover()
+	p.startSRVMonitor()
+	p.startOutboxRelay()
+	p.startDiscovery()
+}
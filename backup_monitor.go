@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultBackupField is the marker field read when backup_monitor.field is unset
+	defaultBackupField = "completed_at"
+	// defaultBackupInterval is the check interval when backup_monitor.interval is unset
+	defaultBackupInterval = 5 * time.Minute
+)
+
+// BackupStatus is the result of a backup freshness check
+type BackupStatus struct {
+	// LastBackup is the completion time read from the marker; zero when no marker was found
+	LastBackup time.Time     `json:"last_backup"`
+	Age        time.Duration `json:"age"`
+	MaxAge     time.Duration `json:"max_age"`
+	// Stale is true when the backup is older than MaxAge or no marker was found
+	Stale bool `json:"stale"`
+}
+
+// backupState remembers the last freshness result to emit EventBackupStale on transitions
+type backupState struct {
+	mu    sync.Mutex
+	stale bool
+}
+
+// validateBackupMonitor checks the backup_monitor configuration
+func validateBackupMonitor(cfg *conf.BackupMonitor) error {
+	if cfg.GetCollection() == "" {
+		return nil
+	}
+	if cfg.GetMaxAge().AsDuration() <= 0 {
+		return fmt.Errorf("max_age must be positive")
+	}
+	return nil
+}
+
+// BackupStatus reads the backup marker configured in backup_monitor and compares its age with
+// max_age. A missing marker is reported as stale rather than as an error.
+func (p *PlugMongoDB) BackupStatus(ctx context.Context) (BackupStatus, error) {
+	cfg := p.config().GetBackupMonitor()
+	if cfg.GetCollection() == "" {
+		return BackupStatus{}, fmt.Errorf("backup_monitor is not configured")
+	}
+	field := cfg.GetField()
+	if field == "" {
+		field = defaultBackupField
+	}
+	status := BackupStatus{MaxAge: cfg.GetMaxAge().AsDuration(), Stale: true}
+
+	filter := bson.D{}
+	opts := options.FindOne()
+	if cfg.GetMarkerId() != "" {
+		filter = bson.D{{Key: "_id", Value: cfg.GetMarkerId()}}
+	} else {
+		opts.SetSort(bson.D{{Key: field, Value: -1}})
+	}
+	var marker bson.Raw
+	op := operation{name: "find", database: p.databaseName(cfg.GetDatabase()), collection: cfg.GetCollection()}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, cfg.GetDatabase())
+		if err != nil {
+			return err
+		}
+		marker, err = db.Collection(cfg.GetCollection()).FindOne(ctx, filter, opts).Raw()
+		return err
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+
+	completed, err := markerTime(marker, field)
+	if err != nil {
+		return status, err
+	}
+	status.LastBackup = completed
+	status.Age = time.Since(completed)
+	status.Stale = status.Age > status.MaxAge
+	return status, nil
+}
+
+// markerTime reads the completion time at the dotted path field of the marker
+func markerTime(marker bson.Raw, field string) (time.Time, error) {
+	v, err := marker.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("backup marker has no %q field", field)
+	}
+	switch v.Type {
+	case bsontype.DateTime:
+		return v.Time(), nil
+	case bsontype.Timestamp:
+		t, _ := v.Timestamp()
+		return time.Unix(int64(t), 0).UTC(), nil
+	case bsontype.String:
+		t, err := time.Parse(time.RFC3339, v.StringValue())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("backup marker field %q: %w", field, err)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("backup marker field %q is a %s, not a date", field, v.Type)
+}
+
+// startBackupMonitor starts the periodic backup freshness check
+func (p *PlugMongoDB) startBackupMonitor() {
+	cfg := p.config().GetBackupMonitor()
+	if cfg.GetCollection() == "" {
+		return
+	}
+	interval := cfg.GetInterval().AsDuration()
+	if interval <= 0 {
+		interval = defaultBackupInterval
+	}
+	p.startPeriodicTask("backup_monitor", interval, p.checkBackup)
+}
+
+// checkBackup exports the backup age and emits EventBackupStale when the backup becomes stale
+func (p *PlugMongoDB) checkBackup(ctx context.Context) {
+	status, err := p.BackupStatus(ctx)
+	if err != nil {
+		log.Warnw("key", "mongodb", "event", "backup_check_failed", "error", err)
+		return
+	}
+	p.prometheusMetrics.RecordBackup(p.config(), status)
+
+	p.backup.mu.Lock()
+	becameStale := status.Stale && !p.backup.stale
+	p.backup.stale = status.Stale
+	p.backup.mu.Unlock()
+	if !becameStale {
+		return
+	}
+	log.Warnw("key", "mongodb", "event", "backup_stale", "last_backup", status.LastBackup, "max_age", status.MaxAge)
+	p.emitTyped(EventBackupStale, plugins.PriorityHigh, BackupStaleEvent{
+		LastBackup: status.LastBackup,
+		Age:        status.Age,
+		MaxAge:     status.MaxAge,
+	})
+}
@@ -0,0 +1,73 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestMarkerTime(t *testing.T) {
+	completed := time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC)
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "completed_at", Value: primitive.NewDateTimeFromTime(completed)},
+		{Key: "snapshot", Value: bson.D{{Key: "ts", Value: primitive.Timestamp{T: uint32(completed.Unix())}}}},
+		{Key: "finished", Value: completed.Format(time.RFC3339)},
+		{Key: "size", Value: int64(42)},
+	})
+	for _, field := range []string{"completed_at", "snapshot.ts", "finished"} {
+		got, err := markerTime(raw, field)
+		if err != nil || !got.Equal(completed) {
+			t.Errorf("markerTime(%q) = %v, %v; want %v", field, got, err, completed)
+		}
+	}
+	for _, field := range []string{"size", "missing"} {
+		if _, err := markerTime(raw, field); err == nil {
+			t.Errorf("markerTime(%q) should fail", field)
+		}
+	}
+}
+
+func TestValidateBackupMonitor(t *testing.T) {
+	if err := validateBackupMonitor(nil); err != nil {
+		t.Errorf("unset backup_monitor should be valid: %v", err)
+	}
+	if err := validateBackupMonitor(&conf.BackupMonitor{Collection: "backups"}); err == nil {
+		t.Error("expected max_age to be required")
+	}
+	if err := validateBackupMonitor(&conf.BackupMonitor{Collection: "backups", MaxAge: durationpb.New(26 * time.Hour)}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	if _, err := p.BackupStatus(t.Context()); err == nil {
+		t.Error("expected an error without backup_monitor")
+	}
+}
+
+func TestRecordBackup(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "test"}
+
+	m.RecordBackup(cfg, BackupStatus{LastBackup: time.Now().Add(-time.Hour), Age: time.Hour, MaxAge: 26 * time.Hour})
+	if got := testutil.ToFloat64(m.backupAge.WithLabelValues("test")); got != 3600 {
+		t.Errorf("backup_age_seconds = %v, want 3600", got)
+	}
+	if got := testutil.ToFloat64(m.backupStale.WithLabelValues("test")); got != 0 {
+		t.Errorf("backup_stale = %v, want 0", got)
+	}
+
+	// The marker disappeared: stale, and no age is reported
+	m.RecordBackup(cfg, BackupStatus{MaxAge: 26 * time.Hour, Stale: true})
+	if got := testutil.ToFloat64(m.backupStale.WithLabelValues("test")); got != 1 {
+		t.Errorf("backup_stale = %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(m.backupAge); n != 0 {
+		t.Errorf("expected no backup age without a marker, got %d series", n)
+	}
+}
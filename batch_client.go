@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// BatchWorkload is the workload pool name reserved for the batch client
+const BatchWorkload = "batch"
+
+// Batch client defaults, deliberately conservative so offline jobs cannot starve the serving path
+const (
+	defaultBatchMaxPoolSize      = 5
+	defaultBatchSocketTimeout    = 10 * time.Minute
+	defaultBatchOperationTimeout = 10 * time.Minute
+	defaultBatchReadPreference   = "secondaryPreferred"
+	defaultBatchOpsPerSecond     = 50
+)
+
+// BatchClient gives ETL and other offline code running in the serving process its own small pool,
+// long timeouts, secondary reads and a strict operation rate limit
+type BatchClient struct {
+	p       *PlugMongoDB
+	limiter *tokenBucket
+	timeout time.Duration
+}
+
+// BatchClient returns the batch client, or nil when batch_client is not enabled
+func (p *PlugMongoDB) BatchClient() *BatchClient {
+	if state := p.loadState(); state != nil {
+		return state.batch
+	}
+	return nil
+}
+
+// newBatchClient applies the batch defaults to the batch_client section of c and returns the batch
+// client and its workload pool
+func (p *PlugMongoDB) newBatchClient(c *conf.MongoDB) (*BatchClient, *conf.WorkloadPool) {
+	cfg := c.GetBatchClient()
+	if !cfg.GetEnabled() {
+		return nil, nil
+	}
+	pool := &conf.WorkloadPool{
+		Name:           BatchWorkload,
+		MaxPoolSize:    cfg.GetMaxPoolSize(),
+		SocketTimeout:  cfg.GetSocketTimeout(),
+		ReadPreference: cfg.GetReadPreference(),
+	}
+	if pool.MaxPoolSize == 0 {
+		pool.MaxPoolSize = defaultBatchMaxPoolSize
+	}
+	if pool.SocketTimeout == nil {
+		pool.SocketTimeout = durationpb.New(defaultBatchSocketTimeout)
+	}
+	if pool.ReadPreference == "" {
+		pool.ReadPreference = defaultBatchReadPreference
+	}
+
+	rate := cfg.GetMaxOpsPerSecond()
+	if rate <= 0 {
+		rate = defaultBatchOpsPerSecond
+	}
+	burst := float64(cfg.GetBurst())
+	if burst <= 0 {
+		burst = 1
+	}
+	timeout := cfg.GetOperationTimeout().AsDuration()
+	if timeout <= 0 {
+		timeout = defaultBatchOperationTimeout
+	}
+	return &BatchClient{p: p, limiter: newTokenBucket(rate, burst), timeout: timeout}, pool
+}
+
+// Context routes plugin helper calls made with the returned context through the batch client,
+// including its rate limit and operation timeout
+func (b *BatchClient) Context(ctx context.Context) context.Context {
+	return WithWorkload(ctx, BatchWorkload)
+}
+
+// Client returns the batch driver client
+func (b *BatchClient) Client() *mongo.Client {
+	return b.p.ClientFor(b.Context(context.Background()))
+}
+
+// Database returns the configured database on the batch client
+func (b *BatchClient) Database() *mongo.Database {
+	return b.p.DatabaseFor(b.Context(context.Background()))
+}
+
+// Collection returns a collection on the batch client
+func (b *BatchClient) Collection(name string) *mongo.Collection {
+	return b.p.CollectionFor(b.Context(context.Background()), name)
+}
+
+// Wait blocks until the rate limit admits one more operation or ctx is done. Code using the driver
+// handles directly should call it once per operation (or per batch write).
+func (b *BatchClient) Wait(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := sleepContext(ctx, b.limiter.reserve(time.Now(), 1)); err != nil {
+		b.limiter.cancel()
+		return fmt.Errorf("batch rate limit wait: %w", err)
+	}
+	return nil
+}
+
+// Run waits for the rate limit and runs fn against the batch database with the batch operation timeout
+func (b *BatchClient) Run(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if err := b.Wait(ctx); err != nil {
+		return err
+	}
+	db := b.Database()
+	if db == nil {
+		return fmt.Errorf("mongodb batch client is not initialized")
+	}
+	opCtx, cancel := b.p.createTimeoutContext(ctx, b.timeout)
+	defer cancel()
+	return fn(b.Context(opCtx), db)
+}
+
+// batchFor returns the batch client when ctx selects the batch workload
+func (p *PlugMongoDB) batchFor(ctx context.Context) *BatchClient {
+	if Workload(ctx) != BatchWorkload {
+		return nil
+	}
+	return p.BatchClient()
+}
@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// benchFindReply is a find reply with a full default first batch
+func benchFindReply(b *testing.B) bson.Raw {
+	batch := make(bson.A, 101)
+	for i := range batch {
+		batch[i] = schemaOrder{Customer: "c-42", Total: float64(i), Status: "paid"}
+	}
+	reply, err := bson.Marshal(bson.D{
+		{Key: "cursor", Value: bson.D{{Key: "firstBatch", Value: batch}, {Key: "id", Value: int64(0)}}},
+		{Key: "ok", Value: 1},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return reply
+}
+
+func benchCommand(b *testing.B) bson.Raw {
+	cmd, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "orders"},
+		{Key: "filter", Value: bson.D{{Key: "customer", Value: "c-42"}, {Key: "status", Value: "paid"}}},
+		{Key: "$db", Value: "app"},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cmd
+}
+
+func runCommandMonitor(b *testing.B, mon *event.CommandMonitor, cmd, reply bson.Raw) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := int64(i)
+		mon.Started(ctx, &event.CommandStartedEvent{Command: cmd, DatabaseName: "app", CommandName: "find", RequestID: id})
+		mon.Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", DatabaseName: "app", RequestID: id, Duration: time.Millisecond},
+			Reply:                reply,
+		})
+	}
+}
+
+func BenchmarkPrometheusCommandMonitor(b *testing.B) {
+	m := NewPrometheusMetrics(nil)
+	runCommandMonitor(b, m.CreateCommandMonitor(&conf.MongoDB{Database: "app"}), benchCommand(b), benchFindReply(b))
+}
+
+func BenchmarkPrometheusCommandMonitorNamespaceFilter(b *testing.B) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "app", MetricsNamespaces: &conf.NamespaceFilter{Include: []string{"app"}}}
+	runCommandMonitor(b, m.CreateCommandMonitor(cfg), benchCommand(b), benchFindReply(b))
+}
+
+// BenchmarkCommandMonitorChain measures the full monitor chain installed on the client
+func BenchmarkCommandMonitorChain(b *testing.B) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "app", EnableRegexGuard: true, OpLabels: []string{"checkout"}})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	WithQueryScanMode(QueryScanWarn)(p)
+	runCommandMonitor(b, p.buildCommandMonitor(p.config()), benchCommand(b), benchFindReply(b))
+}
+
+func BenchmarkExtractDocumentsFromReply(b *testing.B) {
+	reply := benchFindReply(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		extractDocumentsFromReply(reply, "find")
+	}
+}
+
+func BenchmarkEncodeDocument(b *testing.B) {
+	doc := schemaOrder{Customer: "c-42", Total: 99.5, Status: "paid"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := bson.Marshal(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDocument(b *testing.B) {
+	p := NewMongoDBClient()
+	raw, err := bson.Marshal(schemaOrder{Customer: "c-42", Total: 99.5, Status: "paid"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out schemaOrder
+		if err := p.decodeDocument(ctx, "orders", raw, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDocumentStrict(b *testing.B) {
+	p := NewMongoDBClient()
+	raw, err := bson.Marshal(schemaOrder{Customer: "c-42", Total: 99.5, Status: "paid"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := WithStrictDecoding(context.Background())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out schemaOrder
+		if err := p.decodeDocument(ctx, "orders", raw, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
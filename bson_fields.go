@@ -0,0 +1,192 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// bsonField describes an exported struct field as the driver's struct codec sees it
+type bsonField struct {
+	// BSON key (tag name or lowercased Go name)
+	name string
+	// Go field name
+	goName string
+	// JSON tag name, if any (matches protobuf JSON names)
+	jsonName string
+	// Field index path from the outer struct (longer than one for inlined fields)
+	index []int
+	// Field type
+	typ reflect.Type
+}
+
+var bsonFieldCache sync.Map // reflect.Type -> []bsonField
+
+// structBSONFields returns the BSON-visible fields of struct type t, flattening inline fields
+func structBSONFields(t reflect.Type) []bsonField {
+	if cached, ok := bsonFieldCache.Load(t); ok {
+		return cached.([]bsonField)
+	}
+	var fields []bsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup("bson")
+		if tag == "-" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if strings.Contains(","+flags+",", ",inline,") {
+			inner := ft
+			if inner.Kind() == reflect.Ptr {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				for _, f := range structBSONFields(inner) {
+					f.index = append([]int{i}, f.index...)
+					fields = append(fields, f)
+				}
+				continue
+			}
+		}
+		if !hasTag || name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		fields = append(fields, bsonField{name: name, goName: sf.Name, jsonName: jsonName, index: []int{i}, typ: ft})
+	}
+	bsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// lookupBSONField finds a field by BSON key, Go name, JSON name or snake_case Go name
+func lookupBSONField(t reflect.Type, segment string) (bsonField, bool) {
+	fields := structBSONFields(t)
+	for _, f := range fields {
+		if f.name == segment {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.goName, segment) || (f.jsonName != "" && f.jsonName != "-" && f.jsonName == segment) || toSnakeCase(f.goName) == segment {
+			return f, true
+		}
+	}
+	return bsonField{}, false
+}
+
+// toSnakeCase converts a Go identifier (CreatedAt, userID) to snake_case (created_at, user_id)
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// indirectType dereferences pointer types
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// pathStep is one resolved segment of a dotted field path
+type pathStep struct {
+	// BSON key for this segment
+	key string
+	// Struct field index path; nil for map keys
+	index []int
+}
+
+// resolveBSONPath resolves a dotted path against type t (structs and string-keyed maps),
+// accepting the names lookupBSONField accepts, and returns the BSON key of each segment
+func resolveBSONPath(t reflect.Type, path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	segments := strings.Split(path, ".")
+	steps := make([]pathStep, 0, len(segments))
+	current := t
+	for i, segment := range segments {
+		current = indirectType(current)
+		switch current.Kind() {
+		case reflect.Struct:
+			field, ok := lookupBSONField(current, segment)
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", segment)
+			}
+			steps = append(steps, pathStep{key: field.name, index: field.index})
+			current = field.typ
+		case reflect.Map:
+			if current.Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("%q is not a string-keyed map", strings.Join(segments[:i], "."))
+			}
+			steps = append(steps, pathStep{key: segment})
+			current = current.Elem()
+		default:
+			return nil, fmt.Errorf("%q is not a document field", strings.Join(segments[:i], "."))
+		}
+	}
+	return steps, nil
+}
+
+// valueAtPath follows resolved steps through v; the result is invalid when the path
+// crosses a nil pointer or a missing map key
+func valueAtPath(v reflect.Value, steps []pathStep) reflect.Value {
+	current := v
+	for _, step := range steps {
+		for current.Kind() == reflect.Ptr || current.Kind() == reflect.Interface {
+			if current.IsNil() {
+				return reflect.Value{}
+			}
+			current = current.Elem()
+		}
+		if step.index == nil {
+			current = current.MapIndex(reflect.ValueOf(step.key).Convert(current.Type().Key()))
+		} else {
+			current = fieldByIndex(current, step.index)
+		}
+		if !current.IsValid() {
+			return reflect.Value{}
+		}
+	}
+	return current
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex returning an invalid value instead of panicking on nil embedded pointers
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+// joinSteps returns the dotted BSON path of resolved steps
+func joinSteps(steps []pathStep) string {
+	keys := make([]string, len(steps))
+	for i, step := range steps {
+		keys[i] = step.key
+	}
+	return strings.Join(keys, ".")
+}
@@ -0,0 +1,245 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+)
+
+// Budget enforcement modes (op_budgets[].mode)
+const (
+	// BudgetModeLog reports budget burn through metrics and rate-limited logs
+	BudgetModeLog = "log"
+	// BudgetModeThrottle additionally delays helper operations to keep the label within its rate
+	BudgetModeThrottle = "throttle"
+)
+
+// Budget kinds reported in budget burn metrics
+const (
+	budgetOpsRate = "ops_rate"
+	budgetLatency = "latency"
+)
+
+const (
+	// budgetLatencySamples is the size of the sliding latency window used for the p99 estimate
+	budgetLatencySamples = 512
+	// budgetP99Refresh recomputes the p99 estimate every this many samples
+	budgetP99Refresh = 32
+	// budgetWarnInterval rate-limits budget burn logs per label
+	budgetWarnInterval = time.Minute
+)
+
+// opBudget tracks the ops rate and latency budget of one owner label
+type opBudget struct {
+	label    string
+	throttle bool
+	bucket   *tokenBucket
+	maxP99   time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	seen    int
+
+	p99    atomic.Int64
+	warnAt atomic.Int64
+}
+
+// newOpBudgets validates the configured budgets and indexes them by label
+func newOpBudgets(cfgs []*conf.OpBudget) (map[string]*opBudget, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	budgets := make(map[string]*opBudget, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.GetLabel() == "" {
+			return nil, fmt.Errorf("op budget label cannot be empty")
+		}
+		if _, ok := budgets[cfg.GetLabel()]; ok {
+			return nil, fmt.Errorf("duplicate op budget for label %q", cfg.GetLabel())
+		}
+		b := &opBudget{label: cfg.GetLabel(), maxP99: cfg.GetMaxP99Latency().AsDuration()}
+		switch cfg.GetMode() {
+		case "", BudgetModeLog:
+		case BudgetModeThrottle:
+			b.throttle = true
+		default:
+			return nil, fmt.Errorf("invalid op budget mode %q for label %q: must be log or throttle", cfg.GetMode(), cfg.GetLabel())
+		}
+		if rate := cfg.GetMaxOpsPerSecond(); rate > 0 {
+			burst := float64(cfg.GetBurst())
+			if burst <= 0 {
+				burst = rate
+			}
+			b.bucket = newTokenBucket(rate, burst)
+		} else if rate < 0 {
+			return nil, fmt.Errorf("op budget max_ops_per_second for label %q cannot be negative", cfg.GetLabel())
+		}
+		if b.bucket == nil && b.maxP99 <= 0 {
+			return nil, fmt.Errorf("op budget for label %q sets neither max_ops_per_second nor max_p99_latency", cfg.GetLabel())
+		}
+		// A latency breach throttles by halving the rate, so there is nothing to throttle without one
+		if b.throttle && b.bucket == nil {
+			return nil, fmt.Errorf("op budget mode throttle for label %q requires max_ops_per_second", cfg.GetLabel())
+		}
+		budgets[b.label] = b
+	}
+	return budgets, nil
+}
+
+// enforceBudget charges an operation against the budget of the context label. In throttle mode it
+// waits for rate capacity (bounded by ctx); a latency budget breach halves the allowed rate. In log
+// mode operations over the rate are only reported, and do not take tokens from later ones.
+func (p *PlugMongoDB) enforceBudget(ctx context.Context) error {
+	b := p.budgets[OpLabel(ctx)]
+	if b == nil || b.bucket == nil {
+		return nil
+	}
+	if !b.throttle {
+		if !b.bucket.take(time.Now()) {
+			p.onBudgetBurn(b, budgetOpsRate)
+		}
+		return nil
+	}
+	factor := 1.0
+	if b.throttle && b.latencyExceeded() {
+		factor = 0.5
+	}
+	wait := b.bucket.reserve(time.Now(), factor)
+	if wait <= 0 {
+		return nil
+	}
+	p.onBudgetBurn(b, budgetOpsRate)
+
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordBudgetThrottle(p.config(), b.label, wait)
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		b.bucket.cancel()
+		return fmt.Errorf("throttled by %q op budget: %w", b.label, err)
+	}
+	return nil
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observeBudgetLatency records a command duration against the label's latency budget
+func (p *PlugMongoDB) observeBudgetLatency(label string, d time.Duration) {
+	b := p.budgets[label]
+	if b == nil || b.maxP99 <= 0 {
+		return
+	}
+	b.observe(d)
+	if b.latencyExceeded() {
+		p.onBudgetBurn(b, budgetLatency)
+	}
+}
+
+// onBudgetBurn counts and logs (rate-limited per label) an operation exceeding a budget
+func (p *PlugMongoDB) onBudgetBurn(b *opBudget, budget string) {
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordBudgetBurn(p.config(), b.label, budget)
+	}
+	now := time.Now().UnixNano()
+	last := b.warnAt.Load()
+	if now-last < int64(budgetWarnInterval) || !b.warnAt.CompareAndSwap(last, now) {
+		return
+	}
+	log.Warnf("mongodb: %q operations exceed their %s budget (p99 %s, max %s)", b.label, budget, time.Duration(b.p99.Load()), b.maxP99)
+}
+
+func (b *opBudget) observe(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.samples == nil {
+		b.samples = make([]time.Duration, budgetLatencySamples)
+	}
+	b.samples[b.next] = d
+	b.next = (b.next + 1) % len(b.samples)
+	b.seen++
+	if b.seen%budgetP99Refresh != 0 {
+		return
+	}
+	n := min(b.seen, len(b.samples))
+	sorted := make([]time.Duration, n)
+	copy(sorted, b.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	b.p99.Store(int64(sorted[(n*99-1)/100]))
+}
+
+func (b *opBudget) latencyExceeded() bool {
+	return b.maxP99 > 0 && time.Duration(b.p99.Load()) > b.maxP99
+}
+
+// tokenBucket is a reservation-based rate limiter: each reservation takes one token, possibly
+// going into debt, and reports how long the caller must wait for its token
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+// reserve takes a token at the bucket rate scaled by factor and returns the wait until it is available
+func (b *tokenBucket) reserve(now time.Time, factor float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rate := b.rate * factor
+	b.refill(now, rate)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// take takes a token if one is available, without going into debt, and reports whether it did
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now, b.rate)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// cancel returns the token of a reservation whose caller gave up waiting
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// refill adds the tokens accrued at rate since the last call. The caller holds b.mu.
+func (b *tokenBucket) refill(now time.Time, rate float64) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
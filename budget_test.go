@@ -0,0 +1,122 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := time.Unix(0, 0)
+	if w := b.reserve(now, 1); w != 0 {
+		t.Fatalf("first token should be free, wait %s", w)
+	}
+	if w := b.reserve(now, 1); w != 0 {
+		t.Fatalf("burst token should be free, wait %s", w)
+	}
+	if w := b.reserve(now, 1); w != 100*time.Millisecond {
+		t.Fatalf("expected 100ms wait, got %s", w)
+	}
+	// After a second the bucket is full again
+	if w := b.reserve(now.Add(time.Second), 1); w != 0 {
+		t.Fatalf("expected refilled bucket, wait %s", w)
+	}
+}
+
+func TestTokenBucketTakeAndCancel(t *testing.T) {
+	b := newTokenBucket(10, 1)
+	now := time.Unix(0, 0)
+	if !b.take(now) || b.take(now) {
+		t.Fatal("take should only take available tokens")
+	}
+	// Failed takes do not go into debt
+	for i := 0; i < 100; i++ {
+		b.take(now)
+	}
+	if !b.take(now.Add(100 * time.Millisecond)) {
+		t.Error("expected a token after one refill interval")
+	}
+
+	if w := b.reserve(now.Add(100*time.Millisecond), 1); w != 100*time.Millisecond {
+		t.Fatalf("expected 100ms wait, got %s", w)
+	}
+	b.cancel()
+	if w := b.reserve(now.Add(100*time.Millisecond), 1); w != 100*time.Millisecond {
+		t.Errorf("a cancelled reservation should not delay the next one, wait %s", w)
+	}
+}
+
+func TestNewOpBudgets(t *testing.T) {
+	if _, err := newOpBudgets([]*conf.OpBudget{{Label: "a", MaxOpsPerSecond: 1, Mode: "drop"}}); err == nil {
+		t.Error("expected invalid mode to be rejected")
+	}
+	if _, err := newOpBudgets([]*conf.OpBudget{{Label: "a"}}); err == nil {
+		t.Error("expected budget without limits to be rejected")
+	}
+	if _, err := newOpBudgets([]*conf.OpBudget{{Label: "a", MaxP99Latency: durationpb.New(time.Millisecond), Mode: BudgetModeThrottle}}); err == nil {
+		t.Error("expected a throttling budget without rate to be rejected")
+	}
+	if _, err := newOpBudgets([]*conf.OpBudget{{Label: "a", MaxOpsPerSecond: 1}, {Label: "a", MaxOpsPerSecond: 2}}); err == nil {
+		t.Error("expected duplicate label to be rejected")
+	}
+	budgets, err := newOpBudgets([]*conf.OpBudget{{Label: "a", MaxP99Latency: durationpb.New(10 * time.Millisecond)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := budgets["a"]
+	for i := 0; i < budgetP99Refresh; i++ {
+		b.observe(20 * time.Millisecond)
+	}
+	if !b.latencyExceeded() {
+		t.Error("expected latency budget to be exceeded")
+	}
+}
+
+func TestEnforceBudgetThrottle(t *testing.T) {
+	p := NewMongoDBClient()
+	budgets, err := newOpBudgets([]*conf.OpBudget{{Label: "search", MaxOpsPerSecond: 1, Burst: 1, Mode: BudgetModeThrottle}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.budgets = budgets
+
+	ctx := WithOpLabel(context.Background(), "search")
+	if err := p.enforceBudget(ctx); err != nil {
+		t.Fatalf("first operation should pass: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := p.enforceBudget(short); err == nil {
+		t.Error("expected throttled operation to fail on the caller deadline")
+	}
+	if err := p.enforceBudget(context.Background()); err != nil {
+		t.Errorf("unlabeled operations must not be throttled: %v", err)
+	}
+	// The cancelled wait returned its token: the next caller waits for one token, not two
+	if w := budgets["search"].bucket.reserve(time.Now(), 1); w > time.Second {
+		t.Errorf("expected a wait of at most one token, got %s", w)
+	}
+}
+
+func TestEnforceBudgetLogMode(t *testing.T) {
+	p := NewMongoDBClient()
+	budgets, err := newOpBudgets([]*conf.OpBudget{{Label: "search", MaxOpsPerSecond: 1, Burst: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.budgets = budgets
+
+	ctx := WithOpLabel(context.Background(), "search")
+	for i := 0; i < 100; i++ {
+		if err := p.enforceBudget(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b := budgets["search"].bucket; b.tokens < 0 {
+		t.Errorf("log mode should not go into debt, tokens %v", b.tokens)
+	}
+}
@@ -0,0 +1,264 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultBulkBatchSize is the number of writes per bulk command when BulkOptions.BatchSize is not set
+const defaultBulkBatchSize = 1000
+
+// BulkOptions configures BulkInsert, BulkUpdate and BulkWrite
+type BulkOptions struct {
+	// BatchSize is the number of writes sent per bulk command (default 1000)
+	BatchSize int
+	// Ordered runs the writes in order and stops at the first failed one, skipping the rest;
+	// unordered writes continue past failed ones
+	Ordered bool
+}
+
+// BulkUpdateSpec is one update of BulkUpdate
+type BulkUpdateSpec struct {
+	Filter any
+	Update any
+	// Upsert inserts a document when none matches
+	Upsert bool
+	// Many updates every matching document instead of the first; the filter is checked by the
+	// write guard
+	Many bool
+}
+
+// BulkFailure is a write that failed
+type BulkFailure struct {
+	// Index is the position of the write in the input slice
+	Index int
+	// Code is the server error code, zero when the whole batch failed
+	Code int
+	Err  error
+}
+
+// BulkResult aggregates the results of the batches of a bulk helper
+type BulkResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	// UpsertedIDs maps input positions to the _id of upserted documents
+	UpsertedIDs map[int]any
+	// Batches is the number of bulk commands sent
+	Batches int
+	// Failures lists the failed writes by input position
+	Failures []BulkFailure
+	// Skipped is the number of writes not attempted after an ordered write or a batch failed
+	Skipped int
+}
+
+// BulkInsert inserts docs into collection in batches of BatchSize. Documents must hold the scope
+// values of ctx. The result reports the inserted count and the failed documents by position; the
+// error is the first failure, so duplicate keys match ErrConflict.
+func (p *PlugMongoDB) BulkInsert(ctx context.Context, collection string, docs []any, opts BulkOptions) (*BulkResult, error) {
+	models := make([]mongo.WriteModel, len(docs))
+	for i, doc := range docs {
+		models[i] = mongo.NewInsertOneModel().SetDocument(doc)
+	}
+	return p.BulkWrite(ctx, collection, models, opts)
+}
+
+// BulkUpdate applies updates to collection in batches of BatchSize, within the context scope
+func (p *PlugMongoDB) BulkUpdate(ctx context.Context, collection string, updates []BulkUpdateSpec, opts BulkOptions) (*BulkResult, error) {
+	models := make([]mongo.WriteModel, len(updates))
+	for i, u := range updates {
+		if u.Many {
+			models[i] = mongo.NewUpdateManyModel().SetFilter(u.Filter).SetUpdate(u.Update).SetUpsert(u.Upsert)
+		} else {
+			models[i] = mongo.NewUpdateOneModel().SetFilter(u.Filter).SetUpdate(u.Update).SetUpsert(u.Upsert)
+		}
+	}
+	return p.BulkWrite(ctx, collection, models, opts)
+}
+
+// BulkWrite runs models against collection in batches of BatchSize, each batch a bulk command
+// through the helper pipeline (timeout, circuit breaker, load shedding). Filters are scoped to ctx,
+// UpdateMany and DeleteMany filters pass the write guard, and inserted and replacing documents must
+// hold the scope values; an invalid model fails the call before anything is written. Unordered
+// writes continue past write errors, ordered ones stop at the first. A batch failing as a whole
+// (timeout, unavailable cluster) stops the call. The result aggregates the counts and failures of
+// all batches, and the error is the first failure.
+func (p *PlugMongoDB) BulkWrite(ctx context.Context, collection string, models []mongo.WriteModel, opts BulkOptions) (*BulkResult, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	scoped := make([]mongo.WriteModel, len(models))
+	for i, model := range models {
+		m, err := p.scopeWriteModel(ctx, collection, model)
+		if err != nil {
+			return nil, fmt.Errorf("bulk write %d: %w", i, err)
+		}
+		scoped[i] = m
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultBulkBatchSize
+	}
+	result := &BulkResult{}
+	var firstErr error
+	for start := 0; start < len(scoped); start += size {
+		end := min(start+size, len(scoped))
+		batchStart := time.Now()
+		res, err := p.bulkBatch(ctx, collection, scoped[start:end], opts.Ordered)
+		result.Batches++
+		failed, stop := result.add(start, end-start, opts.Ordered, res, err)
+		p.recordBulkBatch(collection, time.Since(batchStart), res, failed)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if stop {
+			result.Skipped += len(scoped) - end
+			break
+		}
+	}
+	if result.InsertedCount+result.UpsertedCount+result.DeletedCount > 0 {
+		p.InvalidateStats(collection)
+	}
+	return result, firstErr
+}
+
+// bulkBatch runs one bulk command
+func (p *PlugMongoDB) bulkBatch(ctx context.Context, collection string, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+	var result *mongo.BulkWriteResult
+	op := operation{name: "bulkWrite", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(ordered), commentBulkWriteOptions(ctx))
+		result = res
+		return err
+	})
+	return result, err
+}
+
+// add merges the result of the batch of n writes at offset and reports its failed writes and
+// whether to stop
+func (r *BulkResult) add(offset, n int, ordered bool, res *mongo.BulkWriteResult, err error) (failed int, stop bool) {
+	if res != nil {
+		r.InsertedCount += res.InsertedCount
+		r.MatchedCount += res.MatchedCount
+		r.ModifiedCount += res.ModifiedCount
+		r.DeletedCount += res.DeletedCount
+		r.UpsertedCount += res.UpsertedCount
+		for i, id := range res.UpsertedIDs {
+			if r.UpsertedIDs == nil {
+				r.UpsertedIDs = make(map[int]any)
+			}
+			r.UpsertedIDs[offset+int(i)] = id
+		}
+	}
+	if err == nil {
+		return 0, false
+	}
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+		// The batch failed as a whole (or only its write concern did): its writes are unknown
+		if bwe.WriteConcernError != nil {
+			return 0, false
+		}
+		for i := 0; i < n; i++ {
+			r.Failures = append(r.Failures, BulkFailure{Index: offset + i, Err: err})
+		}
+		return n, true
+	}
+	for _, we := range bwe.WriteErrors {
+		r.Failures = append(r.Failures, BulkFailure{Index: offset + we.Index, Code: we.Code, Err: we.WriteError})
+	}
+	failed = len(bwe.WriteErrors)
+	if ordered {
+		// Writes after the failed one were not attempted
+		last := bwe.WriteErrors[len(bwe.WriteErrors)-1].Index
+		r.Skipped += n - last - 1
+		return failed, true
+	}
+	return failed, false
+}
+
+// scopeWriteModel returns model with its filter scoped to ctx, UpdateMany and DeleteMany filters
+// checked by the write guard, and inserted or replacing documents checked against the scope
+func (p *PlugMongoDB) scopeWriteModel(ctx context.Context, collection string, model mongo.WriteModel) (mongo.WriteModel, error) {
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		if err := p.checkWriteDocument(ctx, collection, m.Document); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case *mongo.ReplaceOneModel:
+		if err := p.checkWriteDocument(ctx, collection, m.Replacement); err != nil {
+			return nil, err
+		}
+		filter, err := ScopeFilter(ctx, collection, m.Filter)
+		c := *m
+		c.Filter = filter
+		return &c, err
+	case *mongo.UpdateOneModel:
+		filter, err := ScopeFilter(ctx, collection, m.Filter)
+		c := *m
+		c.Filter = filter
+		return &c, err
+	case *mongo.DeleteOneModel:
+		filter, err := ScopeFilter(ctx, collection, m.Filter)
+		c := *m
+		c.Filter = filter
+		return &c, err
+	case *mongo.UpdateManyModel:
+		filter, err := p.guardedFilter(ctx, "updateMany", collection, m.Filter)
+		c := *m
+		c.Filter = filter
+		return &c, err
+	case *mongo.DeleteManyModel:
+		filter, err := p.guardedFilter(ctx, "deleteMany", collection, m.Filter)
+		c := *m
+		c.Filter = filter
+		return &c, err
+	}
+	return nil, fmt.Errorf("unsupported write model %T", model)
+}
+
+// checkWriteDocument checks a document written to a scoped collection against the scope of ctx
+func (p *PlugMongoDB) checkWriteDocument(ctx context.Context, collection string, doc any) error {
+	if doc == nil {
+		return mongo.ErrNilDocument
+	}
+	predicate, err := scopePredicate(ctx, collection)
+	if err != nil || predicate == nil {
+		return err
+	}
+	raw, err := p.marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode document for %s: %w", collection, err)
+	}
+	return checkDocumentScope(ctx, collection, raw)
+}
+
+// recordBulkBatch records the documents written and failed by a bulk batch
+func (p *PlugMongoDB) recordBulkBatch(collection string, d time.Duration, res *mongo.BulkWriteResult, failed int) {
+	m := p.prometheusMetrics
+	if m == nil {
+		return
+	}
+	name, ok := p.metricsCollection(p.databaseName(""), collection)
+	if !ok {
+		return
+	}
+	var written int64
+	if res != nil {
+		written = res.InsertedCount + res.ModifiedCount + res.DeletedCount + res.UpsertedCount
+	}
+	m.RecordBulkBatch(p.config(), name, d, written, failed)
+}
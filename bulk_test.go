@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBulkResultAdd(t *testing.T) {
+	r := &BulkResult{}
+	dup := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}},
+		{WriteError: mongo.WriteError{Index: 3, Code: 11000, Message: "duplicate key"}},
+	}}
+	failed, stop := r.add(10, 5, false, &mongo.BulkWriteResult{InsertedCount: 3}, dup)
+	if failed != 2 || stop || r.InsertedCount != 3 {
+		t.Errorf("unordered write errors: failed %d, stop %v, inserted %d", failed, stop, r.InsertedCount)
+	}
+	if len(r.Failures) != 2 || r.Failures[0].Index != 11 || r.Failures[1].Index != 13 || r.Failures[1].Code != 11000 {
+		t.Errorf("failures must carry input positions: %+v", r.Failures)
+	}
+
+	r = &BulkResult{}
+	ordered := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1, Code: 11000}}}}
+	if failed, stop := r.add(0, 5, true, &mongo.BulkWriteResult{InsertedCount: 1}, ordered); failed != 1 || !stop || r.Skipped != 3 {
+		t.Errorf("ordered write error: failed %d, stop %v, skipped %d", failed, stop, r.Skipped)
+	}
+
+	r = &BulkResult{}
+	if failed, stop := r.add(0, 4, false, nil, errors.New("server selection timeout")); failed != 4 || !stop {
+		t.Errorf("batch error: failed %d, stop %v", failed, stop)
+	}
+
+	r = &BulkResult{}
+	wc := mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}}
+	if failed, stop := r.add(0, 4, false, &mongo.BulkWriteResult{InsertedCount: 4, UpsertedIDs: map[int64]any{2: "x"}}, wc); failed != 0 || stop {
+		t.Errorf("write concern error: failed %d, stop %v", failed, stop)
+	}
+	if r.UpsertedIDs[2] != "x" {
+		t.Errorf("upserted ids: %v", r.UpsertedIDs)
+	}
+}
+
+func TestBulkWriteScopesModels(t *testing.T) {
+	registerScopedOrders(t)
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	ctx := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+
+	m, err := p.scopeWriteModel(ctx, "scope_test_orders", mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: "o1"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "_id", Value: "o1"}}, bson.D{{Key: "tenant_id", Value: "t1"}}}}}
+	if got := m.(*mongo.UpdateOneModel).Filter; !equalBSON(t, got, want) {
+		t.Errorf("scoped filter = %v", got)
+	}
+
+	if _, err := p.scopeWriteModel(ctx, "scope_test_orders", mongo.NewInsertOneModel().SetDocument(scopeTestOrder{ID: "o1", TenantID: "t2"})); err == nil {
+		t.Error("expected an error inserting a document of another scope")
+	}
+	if _, err := p.scopeWriteModel(ctx, "scope_test_orders", mongo.NewInsertOneModel().SetDocument(scopeTestOrder{ID: "o1", TenantID: "t1"})); err != nil {
+		t.Errorf("insert within scope: %v", err)
+	}
+	if _, err := p.scopeWriteModel(context.Background(), "orders", mongo.NewDeleteManyModel().SetFilter(bson.D{})); !errors.Is(err, ErrBadQuery) {
+		t.Errorf("expected the write guard to reject an empty deleteMany filter, got %v", err)
+	}
+
+	_, err = p.BulkInsert(ctx, "scope_test_orders", []any{scopeTestOrder{ID: "o1", TenantID: "t1"}, scopeTestOrder{ID: "o2", TenantID: "t2"}}, BulkOptions{})
+	if err == nil {
+		t.Error("expected an invalid document to fail the call before writing")
+	}
+}
+
+func equalBSON(t *testing.T, a, b any) bool {
+	t.Helper()
+	x, err := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(x) == string(y)
+}
@@ -0,0 +1,116 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CallOptions are per-call query options honored by the plugin read, update and aggregation
+// helpers, so callers need not drop to raw collections for them
+type CallOptions struct {
+	// Hint is an index name or key document
+	Hint any
+	// AllowDiskUse lets finds with large sorts and aggregations spill to disk
+	AllowDiskUse bool
+	// Let defines variables usable with $$ in filters, updates and pipelines
+	Let any
+	// Collation for string comparisons
+	Collation *options.Collation
+	// Idempotency classifies the call for retries and the write buffer (see WithIdempotency)
+	Idempotency Idempotency
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns a context whose helper calls apply opts. Options a helper cannot
+// express for its command (such as Let for findOne) are ignored.
+//
+//	ctx = mongodb.WithCallOptions(ctx, mongodb.CallOptions{Hint: "status_1_created_1", AllowDiskUse: true})
+func WithCallOptions(ctx context.Context, opts CallOptions) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, opts)
+}
+
+func callOptions(ctx context.Context) (CallOptions, bool) {
+	opts, ok := ctx.Value(callOptionsKey{}).(CallOptions)
+	return opts, ok
+}
+
+// callFindOptions applies the context call options to a find; nil when there are none
+func callFindOptions(ctx context.Context) *options.FindOptions {
+	c, ok := callOptions(ctx)
+	if !ok {
+		return nil
+	}
+	opts := options.Find()
+	if c.Hint != nil {
+		opts.SetHint(c.Hint)
+	}
+	if c.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if c.Let != nil {
+		opts.SetLet(c.Let)
+	}
+	if c.Collation != nil {
+		opts.SetCollation(c.Collation)
+	}
+	return opts
+}
+
+// callFindOneOptions applies the context call options to a findOne
+func callFindOneOptions(ctx context.Context) *options.FindOneOptions {
+	c, ok := callOptions(ctx)
+	if !ok {
+		return nil
+	}
+	opts := options.FindOne()
+	if c.Hint != nil {
+		opts.SetHint(c.Hint)
+	}
+	if c.Collation != nil {
+		opts.SetCollation(c.Collation)
+	}
+	return opts
+}
+
+// callUpdateOptions applies the context call options to an update
+func callUpdateOptions(ctx context.Context) *options.UpdateOptions {
+	c, ok := callOptions(ctx)
+	if !ok {
+		return nil
+	}
+	opts := options.Update()
+	if c.Hint != nil {
+		opts.SetHint(c.Hint)
+	}
+	if c.Let != nil {
+		opts.SetLet(c.Let)
+	}
+	if c.Collation != nil {
+		opts.SetCollation(c.Collation)
+	}
+	return opts
+}
+
+// callAggregateOptions applies the context call options to an aggregation
+func callAggregateOptions(ctx context.Context) *options.AggregateOptions {
+	c, ok := callOptions(ctx)
+	if !ok {
+		return nil
+	}
+	opts := options.Aggregate()
+	if c.Hint != nil {
+		opts.SetHint(c.Hint)
+	}
+	if c.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if c.Let != nil {
+		opts.SetLet(c.Let)
+	}
+	if c.Collation != nil {
+		opts.SetCollation(c.Collation)
+	}
+	return opts
+}
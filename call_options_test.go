@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCallOptions(t *testing.T) {
+	ctx := context.Background()
+	if callFindOptions(ctx) != nil || callAggregateOptions(ctx) != nil || callUpdateOptions(ctx) != nil || callFindOneOptions(ctx) != nil {
+		t.Fatal("expected no options without WithCallOptions")
+	}
+
+	let := bson.D{{Key: "minTotal", Value: 100}}
+	ctx = WithCallOptions(ctx, CallOptions{
+		Hint:         "status_1",
+		AllowDiskUse: true,
+		Let:          let,
+		Collation:    &options.Collation{Locale: "en", Strength: 2},
+	})
+
+	find := callFindOptions(ctx)
+	if find.Hint != "status_1" || find.AllowDiskUse == nil || !*find.AllowDiskUse || find.Let == nil || find.Collation.Locale != "en" {
+		t.Errorf("unexpected find options %+v", find)
+	}
+	agg := callAggregateOptions(ctx)
+	if agg.Hint != "status_1" || agg.AllowDiskUse == nil || !*agg.AllowDiskUse || agg.Let == nil {
+		t.Errorf("unexpected aggregate options %+v", agg)
+	}
+	update := callUpdateOptions(ctx)
+	if update.Hint != "status_1" || update.Let == nil || update.Collation == nil {
+		t.Errorf("unexpected update options %+v", update)
+	}
+	if one := callFindOneOptions(ctx); one.Hint != "status_1" || one.Collation == nil {
+		t.Errorf("unexpected findOne options %+v", one)
+	}
+
+	// Explicit options passed after the call options win when merged
+	merged := options.MergeAggregateOptions(agg, options.Aggregate().SetAllowDiskUse(false))
+	if *merged.AllowDiskUse {
+		t.Error("expected explicit options to override call options")
+	}
+}
@@ -0,0 +1,239 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Feature is a server capability the plugin's helpers may depend on
+type Feature string
+
+// Features checked by Supports, FeatureSupported and the compatibility suite
+const (
+	FeatureTransactions        Feature = "transactions"
+	FeatureChangeStreams       Feature = "change_streams"
+	FeatureTimeSeries          Feature = "time_series"
+	FeatureQueryableEncryption Feature = "queryable_encryption"
+	// FeatureVectorSearch is the $vectorSearch aggregation stage, served by Atlas Search
+	FeatureVectorSearch      Feature = "vector_search"
+	FeatureCausalConsistency Feature = "causal_consistency"
+)
+
+// featureRequirement is the documented minimum server version of a feature
+type featureRequirement struct {
+	major, minor int
+	// replicated features need a replica set or sharded cluster
+	replicated bool
+	// search features need a deployment running Atlas Search
+	search bool
+}
+
+var featureRequirements = map[Feature]featureRequirement{
+	FeatureTransactions:        {major: 4, minor: 0, replicated: true},
+	FeatureChangeStreams:       {major: 3, minor: 6, replicated: true},
+	FeatureTimeSeries:          {major: 5, minor: 0},
+	FeatureQueryableEncryption: {major: 7, minor: 0, replicated: true},
+	FeatureVectorSearch:        {major: 7, minor: 0, search: true},
+	FeatureCausalConsistency:   {major: 3, minor: 6, replicated: true},
+}
+
+// atlasHostSuffix identifies Atlas deployments, which run Atlas Search
+const atlasHostSuffix = ".mongodb.net"
+
+// CapabilityMatrix records which features passed the compatibility suite, by server
+// "major.minor" version. It is JSON-encodable as produced by the compatibility matrix runner.
+type CapabilityMatrix map[string]map[Feature]bool
+
+var (
+	capabilitiesMu sync.RWMutex
+	capabilities   = CapabilityMatrix{}
+)
+
+// RegisterCapabilities merges a measured capability matrix into the one FeatureSupported consults.
+// Versions missing from the matrix fall back to the documented minimum server versions.
+func RegisterCapabilities(m CapabilityMatrix) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	for version, features := range m {
+		if capabilities[version] == nil {
+			capabilities[version] = map[Feature]bool{}
+		}
+		for f, ok := range features {
+			capabilities[version][f] = ok
+		}
+	}
+}
+
+func registeredCapability(version string, f Feature) (supported, known bool) {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	supported, known = capabilities[version][f]
+	return supported, known
+}
+
+// serverInfo caches the version and deployment of the connected server per client
+type serverInfo struct {
+	mu         sync.Mutex
+	client     *mongo.Client
+	version    string
+	replicated bool
+	search     bool
+}
+
+// ServerVersion returns the version reported by buildInfo, e.g. "7.0.12"
+func (p *PlugMongoDB) ServerVersion(ctx context.Context) (string, error) {
+	info, err := p.loadServerInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	return info.version, nil
+}
+
+// FeatureSupported reports whether the connected deployment supports f, querying the server
+// if its version is not known yet. Registered capability matrices take precedence over the
+// documented minimum versions; features needing a replica set are unsupported on standalone
+// servers either way.
+func (p *PlugMongoDB) FeatureSupported(ctx context.Context, f Feature) (bool, error) {
+	if _, ok := featureRequirements[f]; !ok {
+		return false, fmt.Errorf("unknown feature %q", f)
+	}
+	info, err := p.loadServerInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+	return info.supports(f)
+}
+
+// Supports reports whether the connected deployment supports f, from the server version and
+// topology resolved at connect time. It never contacts the server and returns false for unknown
+// features or when the capabilities could not be resolved.
+func (p *PlugMongoDB) Supports(f Feature) bool {
+	client := p.GetClient()
+	s := &p.serverInfo
+	s.mu.Lock()
+	if client == nil || s.client != client {
+		s.mu.Unlock()
+		return false
+	}
+	info := serverInfoSnapshot{version: s.version, replicated: s.replicated, search: s.search}
+	s.mu.Unlock()
+	ok, err := info.supports(f)
+	return err == nil && ok
+}
+
+// serverInfoSnapshot is a copy of the cached server information
+type serverInfoSnapshot struct {
+	version    string
+	replicated bool
+	search     bool
+}
+
+func (info serverInfoSnapshot) supports(f Feature) (bool, error) {
+	req, ok := featureRequirements[f]
+	if !ok {
+		return false, fmt.Errorf("unknown feature %q", f)
+	}
+	if req.replicated && !info.replicated {
+		return false, nil
+	}
+	major, minor, err := parseServerVersion(info.version)
+	if err != nil {
+		return false, err
+	}
+	if supported, known := registeredCapability(fmt.Sprintf("%d.%d", major, minor), f); known {
+		return supported, nil
+	}
+	if req.search && !info.search {
+		return false, nil
+	}
+	return major > req.major || (major == req.major && minor >= req.minor), nil
+}
+
+func (p *PlugMongoDB) loadServerInfo(ctx context.Context) (serverInfoSnapshot, error) {
+	client := p.GetClient()
+	if client == nil {
+		return serverInfoSnapshot{}, errClientNotInitialized
+	}
+	s := &p.serverInfo
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		return serverInfoSnapshot{version: s.version, replicated: s.replicated, search: s.search}, nil
+	}
+
+	ctx, cancel := p.createTimeoutContext(ctx, healthProbeTimeout)
+	defer cancel()
+	admin := client.Database("admin")
+	var build struct {
+		Version string `bson:"version"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&build); err != nil {
+		return serverInfoSnapshot{}, fmt.Errorf("failed to read server version: %w", err)
+	}
+	var hello helloReply
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return serverInfoSnapshot{}, fmt.Errorf("failed to read server topology: %w", err)
+	}
+	s.client, s.version = client, build.Version
+	s.replicated = hello.SetName != "" || hello.Msg == "isdbgrid"
+	s.search = isAtlasHost(hello.Me)
+	if p.config() != nil {
+		for _, host := range uriHosts(p.config().Uri) {
+			s.search = s.search || isAtlasHost(host)
+		}
+	}
+	return serverInfoSnapshot{version: s.version, replicated: s.replicated, search: s.search}, nil
+}
+
+// refreshServerInfo loads the capabilities of the client just published, so Supports answers for it
+func (p *PlugMongoDB) refreshServerInfo(ctx context.Context) {
+	if _, err := p.loadServerInfo(ctx); err != nil {
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "capabilities_unavailable", "error", err)
+	}
+}
+
+// uriHosts returns the host list of a connection string without resolving SRV records
+func uriHosts(uri string) []string {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil
+	}
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return strings.Split(rest, ",")
+}
+
+func isAtlasHost(hostPort string) bool {
+	host, _, _ := strings.Cut(hostPort, ":")
+	return strings.HasSuffix(host, atlasHostSuffix)
+}
+
+// parseServerVersion returns the major and minor numbers of a version such as "8.0.0-rc1"
+func parseServerVersion(version string) (major, minor int, err error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid server version %q", version)
+	}
+	if major, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("invalid server version %q", version)
+	}
+	minorPart := parts[1]
+	if i := strings.IndexFunc(minorPart, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minorPart = minorPart[:i]
+	}
+	if minor, err = strconv.Atoi(minorPart); err != nil {
+		return 0, 0, fmt.Errorf("invalid server version %q", version)
+	}
+	return major, minor, nil
+}
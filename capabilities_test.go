@@ -0,0 +1,110 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		wantErr      bool
+	}{
+		{"7.0.12", 7, 0, false},
+		{"8.0.0-rc1", 8, 0, false},
+		{"6.3", 6, 3, false},
+		{"5.0-rc0", 5, 0, false},
+		{"7", 0, 0, true},
+		{"x.1.0", 0, 0, true},
+	}
+	for _, tt := range tests {
+		major, minor, err := parseServerVersion(tt.version)
+		if (err != nil) != tt.wantErr || major != tt.major || minor != tt.minor {
+			t.Errorf("%s: got %d.%d %v", tt.version, major, minor, err)
+		}
+	}
+}
+
+func TestFeatureSupported(t *testing.T) {
+	p := NewMongoDBClient()
+	if _, err := p.FeatureSupported(t.Context(), "sharding"); err == nil {
+		t.Error("expected an unknown feature error")
+	}
+	if _, err := p.FeatureSupported(t.Context(), FeatureTimeSeries); err == nil {
+		t.Error("expected an error without client")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	// Prime the cache as a 4.4 replica set
+	p.serverInfo.client, p.serverInfo.version, p.serverInfo.replicated = client, "4.4.29", true
+	check := func(f Feature, want bool) {
+		t.Helper()
+		got, err := p.FeatureSupported(t.Context(), f)
+		if err != nil || got != want {
+			t.Errorf("%s: got %v %v, want %v", f, got, err, want)
+		}
+	}
+	check(FeatureTransactions, true)
+	check(FeatureTimeSeries, false)
+
+	RegisterCapabilities(CapabilityMatrix{"4.4": {FeatureTimeSeries: true, FeatureTransactions: false}})
+	t.Cleanup(func() { capabilities = CapabilityMatrix{} })
+	check(FeatureTimeSeries, true)
+	check(FeatureTransactions, false)
+
+	p.serverInfo.replicated = false
+	check(FeatureChangeStreams, false)
+}
+
+func TestSupportsUsesConnectTimeCapabilities(t *testing.T) {
+	p := NewMongoDBClient()
+	if p.Supports(FeatureTransactions) {
+		t.Error("expected no support without client")
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	if p.Supports(FeatureTransactions) {
+		t.Error("expected no support before capabilities are resolved")
+	}
+
+	p.serverInfo.client, p.serverInfo.version, p.serverInfo.replicated = client, "7.0.12", true
+	for f, want := range map[Feature]bool{
+		FeatureTransactions:        true,
+		FeatureQueryableEncryption: true,
+		FeatureCausalConsistency:   true,
+		FeatureVectorSearch:        false,
+		"unknown":                  false,
+	} {
+		if got := p.Supports(f); got != want {
+			t.Errorf("%s: got %v", f, got)
+		}
+	}
+	p.serverInfo.search = true
+	if !p.Supports(FeatureVectorSearch) {
+		t.Error("expected vector search on a search deployment")
+	}
+}
+
+func TestAtlasHosts(t *testing.T) {
+	hosts := uriHosts("mongodb+srv://user:p@ss@cluster0.ab12c.mongodb.net/app?retryWrites=true")
+	if len(hosts) != 1 || !isAtlasHost(hosts[0]) {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+	hosts = uriHosts("mongodb://db-0:27017,db-1:27017/?replicaSet=rs0")
+	if len(hosts) != 2 || isAtlasHost(hosts[0]) || hosts[1] != "db-1:27017" {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+}
@@ -0,0 +1,207 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sensitivity levels of collection fields, from least to most sensitive
+const (
+	SensitivityPublic       = "public"
+	SensitivityInternal     = "internal"
+	SensitivityConfidential = "confidential"
+	SensitivityRestricted   = "restricted"
+)
+
+// catalogVersion is the schema version of the exported catalog
+const catalogVersion = 1
+
+// catalogMaxDepth bounds nested struct fields listed in the catalog (and breaks type cycles)
+const catalogMaxDepth = 8
+
+var sensitivityRank = map[string]int{
+	SensitivityPublic:       1,
+	SensitivityInternal:     2,
+	SensitivityConfidential: 3,
+	SensitivityRestricted:   4,
+}
+
+// FieldMeta annotates a field of a registered collection. Model fields can carry the same
+// annotations in a sensitivity tag, e.g. `sensitivity:"restricted,pii"`; FieldMeta entries win.
+type FieldMeta struct {
+	// Description documents the field
+	Description string
+	// Sensitivity is one of the Sensitivity* levels; nested fields inherit it
+	Sensitivity string
+	// PII marks personally identifiable information; nested fields inherit it
+	PII bool
+}
+
+// Catalog is the machine-readable inventory of registered collections, fields and sensitivity
+type Catalog struct {
+	Version     int                 `json:"version"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Database    string              `json:"database"`
+	Collections []CatalogCollection `json:"collections"`
+}
+
+// CatalogCollection describes a registered collection in the catalog
+type CatalogCollection struct {
+	Name        string   `json:"name"`
+	Model       string   `json:"model"`
+	Owner       string   `json:"owner,omitempty"`
+	Contact     string   `json:"contact,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Sensitivity is the highest sensitivity of the collection fields
+	Sensitivity string `json:"sensitivity"`
+	// PII reports whether any field holds personally identifiable information
+	PII     bool           `json:"pii"`
+	Fields  []CatalogField `json:"fields"`
+	Indexes []string       `json:"indexes,omitempty"`
+}
+
+// CatalogField describes a field in the catalog; nested fields use dotted paths
+type CatalogField struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Sensitivity string `json:"sensitivity"`
+	PII         bool   `json:"pii"`
+	Description string `json:"description,omitempty"`
+}
+
+// Catalog builds the catalog of registered collections. Fields come from the models (nested
+// structs flattened into dotted paths) plus annotated paths the models do not declare; fields
+// without annotation get the collection default sensitivity (internal unless set).
+func (p *PlugMongoDB) Catalog() Catalog {
+	catalog := Catalog{Version: catalogVersion, GeneratedAt: time.Now().UTC(), Database: p.databaseName("")}
+	for _, s := range registeredSchemas() {
+		catalog.Collections = append(catalog.Collections, s.catalogEntry())
+	}
+	return catalog
+}
+
+// ExportCatalog writes the catalog as indented JSON, for data governance tooling
+func (p *PlugMongoDB) ExportCatalog(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Catalog())
+}
+
+func (s *collectionSchema) catalogEntry() CatalogCollection {
+	entry := CatalogCollection{
+		Name:        s.collection,
+		Model:       s.model.String(),
+		Owner:       s.owner,
+		Contact:     s.contact,
+		Description: s.description,
+		Tags:        s.tags,
+		Fields:      []CatalogField{},
+	}
+	for _, spec := range s.indexes {
+		entry.Indexes = append(entry.Indexes, spec.displayName())
+	}
+	base := FieldMeta{Sensitivity: s.sensitivity}
+	if base.Sensitivity == "" {
+		base.Sensitivity = SensitivityInternal
+	}
+
+	seen := make(map[string]bool)
+	var walk func(t reflect.Type, prefix string, parent FieldMeta, depth int)
+	walk = func(t reflect.Type, prefix string, parent FieldMeta, depth int) {
+		for _, f := range structBSONFields(t) {
+			sf := t.FieldByIndex(f.index)
+			if _, flags, _ := strings.Cut(sf.Tag.Get("bson"), ","); strings.Contains(","+flags+",", ",inline,") {
+				// Inline maps hold undeclared fields, annotated through CollectionDef.Fields
+				continue
+			}
+			path := prefix + f.name
+			meta := mergeFieldMeta(parent, parseSensitivityTag(sf.Tag.Get("sensitivity")))
+			meta = mergeFieldMeta(meta, s.fields[path])
+			seen[path] = true
+			entry.Fields = append(entry.Fields, CatalogField{
+				Path:        path,
+				Type:        f.typ.String(),
+				Sensitivity: meta.Sensitivity,
+				PII:         meta.PII,
+				Description: meta.Description,
+			})
+			if nested := nestedStruct(f.typ); nested != nil && depth < catalogMaxDepth {
+				meta.Description = ""
+				walk(nested, path+".", meta, depth+1)
+			}
+		}
+	}
+	if s.model.Kind() == reflect.Struct {
+		walk(s.model, "", base, 0)
+	}
+
+	// Annotated paths the model does not declare (inline maps, dynamic fields)
+	var extra []string
+	for path := range s.fields {
+		if !seen[path] {
+			extra = append(extra, path)
+		}
+	}
+	sort.Strings(extra)
+	for _, path := range extra {
+		meta := mergeFieldMeta(base, s.fields[path])
+		entry.Fields = append(entry.Fields, CatalogField{Path: path, Sensitivity: meta.Sensitivity, PII: meta.PII, Description: meta.Description})
+	}
+
+	for _, f := range entry.Fields {
+		if sensitivityRank[f.Sensitivity] > sensitivityRank[entry.Sensitivity] {
+			entry.Sensitivity = f.Sensitivity
+		}
+		entry.PII = entry.PII || f.PII
+	}
+	if entry.Sensitivity == "" {
+		entry.Sensitivity = base.Sensitivity
+	}
+	return entry
+}
+
+// mergeFieldMeta applies the annotations set in override on top of base
+func mergeFieldMeta(base, override FieldMeta) FieldMeta {
+	if override.Sensitivity != "" {
+		base.Sensitivity = override.Sensitivity
+	}
+	if override.PII {
+		base.PII = true
+	}
+	if override.Description != "" {
+		base.Description = override.Description
+	}
+	return base
+}
+
+// parseSensitivityTag parses a sensitivity tag: a level, "pii", or both ("restricted,pii")
+func parseSensitivityTag(tag string) FieldMeta {
+	var meta FieldMeta
+	for _, part := range strings.Split(tag, ",") {
+		switch part = strings.TrimSpace(part); part {
+		case "":
+		case "pii":
+			meta.PII = true
+		default:
+			meta.Sensitivity = part
+		}
+	}
+	return meta
+}
+
+// nestedStruct returns the document struct type behind t (pointers, slices and arrays of
+// structs), or nil for scalars and types with their own BSON encoding such as time.Time
+func nestedStruct(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || strings.HasPrefix(t.PkgPath(), "go.mongodb.org/") {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,92 @@
+package mongodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type catalogTestAddress struct {
+	Street string `bson:"street"`
+	City   string `bson:"city" sensitivity:"internal"`
+}
+
+type catalogTestCustomer struct {
+	Email     string               `bson:"email" sensitivity:"restricted,pii"`
+	Name      string               `bson:"name" sensitivity:"pii"`
+	Addresses []catalogTestAddress `bson:"addresses" sensitivity:"confidential,pii"`
+	CreatedAt time.Time            `bson:"created_at"`
+	Extra     map[string]any       `bson:",inline"`
+}
+
+func TestCatalog(t *testing.T) {
+	RegisterCollection[catalogTestCustomer]("catalog_test_customers", CollectionDef{
+		Owner:   "crm",
+		Contact: "#crm-oncall",
+		Tags:    []string{"gdpr"},
+		Fields: map[string]FieldMeta{
+			"created_at": {Description: "signup time", Sensitivity: SensitivityPublic},
+			"notes":      {Description: "free-form notes", Sensitivity: SensitivityConfidential},
+		},
+	})
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, "catalog_test_customers")
+		schemasMu.Unlock()
+	}()
+
+	p := NewMongoDBClient()
+	var buf bytes.Buffer
+	if err := p.ExportCatalog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(buf.Bytes(), &catalog); err != nil {
+		t.Fatal(err)
+	}
+	var entry *CatalogCollection
+	for i := range catalog.Collections {
+		if catalog.Collections[i].Name == "catalog_test_customers" {
+			entry = &catalog.Collections[i]
+		}
+	}
+	if entry == nil {
+		t.Fatal("registered collection missing from the catalog")
+	}
+	if entry.Owner != "crm" || entry.Contact != "#crm-oncall" || entry.Sensitivity != SensitivityRestricted || !entry.PII {
+		t.Errorf("unexpected collection entry %+v", entry)
+	}
+
+	want := map[string]CatalogField{
+		"email":            {Path: "email", Type: "string", Sensitivity: SensitivityRestricted, PII: true},
+		"name":             {Path: "name", Type: "string", Sensitivity: SensitivityInternal, PII: true},
+		"addresses":        {Path: "addresses", Type: "[]mongodb.catalogTestAddress", Sensitivity: SensitivityConfidential, PII: true},
+		"addresses.street": {Path: "addresses.street", Type: "string", Sensitivity: SensitivityConfidential, PII: true},
+		"addresses.city":   {Path: "addresses.city", Type: "string", Sensitivity: SensitivityInternal, PII: true},
+		"created_at":       {Path: "created_at", Type: "time.Time", Sensitivity: SensitivityPublic, Description: "signup time"},
+		"notes":            {Path: "notes", Sensitivity: SensitivityConfidential, Description: "free-form notes"},
+	}
+	got := map[string]CatalogField{}
+	for _, f := range entry.Fields {
+		got[f.Path] = f
+	}
+	if _, ok := got["extra"]; ok {
+		t.Error("inline maps must not be listed as fields")
+	}
+	for path, w := range want {
+		if got[path] != w {
+			t.Errorf("field %s: got %+v, want %+v", path, got[path], w)
+		}
+	}
+}
+
+func TestParseSensitivityTag(t *testing.T) {
+	meta := parseSensitivityTag("restricted, pii")
+	if meta.Sensitivity != SensitivityRestricted || !meta.PII {
+		t.Errorf("unexpected annotation %+v", meta)
+	}
+	if meta := parseSensitivityTag(""); meta != (FieldMeta{}) {
+		t.Errorf("unexpected annotation %+v", meta)
+	}
+}
@@ -0,0 +1,240 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+)
+
+// Circuit breaker defaults
+const (
+	defaultCircuitMinRequests  = 20
+	defaultCircuitOpenDuration = 30 * time.Second
+	defaultCircuitProbes       = 3
+)
+
+// ErrCircuitOpen is returned by helpers while the circuit breaker is open. It matches
+// ErrUnavailable.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+
+// CircuitState is the state of the circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every operation through
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a few probe operations through after the open duration
+	CircuitHalfOpen
+	// CircuitOpen fails every operation with ErrCircuitOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// circuitOutcome is what an operation tells the breaker
+type circuitOutcome int
+
+const (
+	// circuitSkipped operations did not reach the server or were cancelled by their caller
+	circuitSkipped circuitOutcome = iota
+	circuitSucceeded
+	circuitFailed
+)
+
+// circuitOutcomeOf classifies the error of an executed operation: unavailability and timeouts are
+// failures, other errors mean the server answered
+func circuitOutcomeOf(err error) circuitOutcome {
+	if err == nil {
+		return circuitSucceeded
+	}
+	if errors.Is(err, context.Canceled) {
+		return circuitSkipped
+	}
+	if kind := classifyError(err); kind == ErrUnavailable || kind == ErrTimeout {
+		return circuitFailed
+	}
+	return circuitSucceeded
+}
+
+// circuitBreaker tracks helper operation outcomes and opens when their failure rate exceeds the
+// threshold
+type circuitBreaker struct {
+	errorRate    float64
+	minRequests  uint64
+	openDuration time.Duration
+	probes       int
+	// onChange is called with the new state, under mu
+	onChange func(CircuitState)
+
+	// Outcomes of the closed state
+	load loadTracker
+
+	mu             sync.Mutex
+	state          CircuitState
+	openedAt       time.Time
+	probesInFlight int
+	probeSuccesses int
+}
+
+// newCircuitBreaker returns the breaker of cfg, or nil when it is not configured
+func newCircuitBreaker(cfg *conf.CircuitBreaker) (*circuitBreaker, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.GetErrorRate() <= 0 || cfg.GetErrorRate() > 100 {
+		return nil, fmt.Errorf("error_rate %v must be in (0, 100]", cfg.GetErrorRate())
+	}
+	if cfg.GetMinRequests() < 0 || cfg.GetHalfOpenProbes() < 0 {
+		return nil, fmt.Errorf("min_requests and half_open_probes cannot be negative")
+	}
+	b := &circuitBreaker{
+		errorRate:    cfg.GetErrorRate(),
+		minRequests:  defaultCircuitMinRequests,
+		openDuration: defaultCircuitOpenDuration,
+		probes:       defaultCircuitProbes,
+	}
+	if n := cfg.GetMinRequests(); n > 0 {
+		b.minRequests = uint64(n)
+	}
+	if d := cfg.GetOpenDuration().AsDuration(); d > 0 {
+		b.openDuration = d
+	}
+	if n := cfg.GetHalfOpenProbes(); n > 0 {
+		b.probes = int(n)
+	}
+	return b, nil
+}
+
+// allow reports whether an operation may run: it returns ErrCircuitOpen while the breaker is open
+// or its half-open probes are taken, and whether the operation is a probe
+func (b *circuitBreaker) allow(now time.Time) (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitClosed:
+		return false, nil
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.openDuration {
+			return false, ErrCircuitOpen
+		}
+		b.probesInFlight, b.probeSuccesses = 0, 0
+		b.setState(CircuitHalfOpen)
+	}
+	if b.probesInFlight+b.probeSuccesses >= b.probes {
+		return false, ErrCircuitOpen
+	}
+	b.probesInFlight++
+	return true, nil
+}
+
+// record reports the outcome of an allowed operation
+func (b *circuitBreaker) record(now time.Time, probe bool, outcome circuitOutcome) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		// The breaker may have reopened since the probe was allowed
+		if b.state != CircuitHalfOpen {
+			return
+		}
+		b.probesInFlight--
+		switch outcome {
+		case circuitFailed:
+			b.open(now)
+		case circuitSucceeded:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.probes {
+				b.load.reset()
+				b.setState(CircuitClosed)
+			}
+		}
+		return
+	}
+	if b.state != CircuitClosed || outcome == circuitSkipped {
+		return
+	}
+	b.load.observeCommand(now, outcome == circuitFailed)
+	if outcome == circuitFailed {
+		if s := b.load.signals(now); s.Commands >= b.minRequests && s.ErrorRate >= b.errorRate {
+			b.open(now)
+		}
+	}
+}
+
+// reset closes the breaker and forgets the outcomes observed so far
+func (b *circuitBreaker) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load.reset()
+	b.setState(CircuitClosed)
+}
+
+// open opens the breaker at now; mu must be held
+func (b *circuitBreaker) open(now time.Time) {
+	b.openedAt = now
+	b.setState(CircuitOpen)
+}
+
+// setState changes the state and reports it; mu must be held
+func (b *circuitBreaker) setState(s CircuitState) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
+
+// newPluginCircuitBreaker creates the breaker of circuit_breaker, logging and exporting its state changes
+func (p *PlugMongoDB) newPluginCircuitBreaker() (*circuitBreaker, error) {
+	b, err := newCircuitBreaker(p.config().GetCircuitBreaker())
+	if b == nil || err != nil {
+		return nil, err
+	}
+	b.onChange = func(s CircuitState) {
+		if s == CircuitOpen {
+			log.Warnw("key", "mongodb", "event", "circuit_breaker_opened", "open_duration", b.openDuration)
+		} else {
+			log.Infow("key", "mongodb", "event", "circuit_breaker_"+s.String())
+		}
+		p.prometheusMetrics.RecordCircuitState(p.config(), s)
+	}
+	p.prometheusMetrics.RecordCircuitState(p.config(), CircuitClosed)
+	return b, nil
+}
+
+// CircuitState returns the state of the circuit breaker; it is always closed when circuit_breaker
+// is not configured
+func (p *PlugMongoDB) CircuitState() CircuitState {
+	b := p.breaker
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b, err := newCircuitBreaker(&conf.CircuitBreaker{ErrorRate: 50, MinRequests: 4, OpenDuration: durationpb.New(time.Second), HalfOpenProbes: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []CircuitState
+	b.onChange = func(s CircuitState) { states = append(states, s) }
+	now := time.Unix(1000, 0)
+
+	run := func(outcome circuitOutcome) error {
+		probe, err := b.allow(now)
+		if err == nil {
+			b.record(now, probe, outcome)
+		}
+		return err
+	}
+	run(circuitSucceeded)
+	run(circuitFailed)
+	run(circuitSkipped)
+	if b.state != CircuitClosed {
+		t.Fatal("expected the breaker closed below min_requests")
+	}
+	run(circuitFailed)
+	run(circuitSucceeded)
+	if b.state != CircuitClosed {
+		t.Fatal("expected the breaker closed below the error rate")
+	}
+	run(circuitFailed)
+	if b.state != CircuitOpen {
+		t.Fatalf("expected the breaker open at 60%% failures, got %s", b.state)
+	}
+	if err := run(circuitSucceeded); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// Half-open: two probes at a time, a failed probe reopens
+	now = now.Add(time.Second)
+	probe, err := b.allow(now)
+	if err != nil || !probe {
+		t.Fatalf("expected a probe, got %v", err)
+	}
+	if _, err := b.allow(now); err != nil {
+		t.Fatalf("expected a second probe, got %v", err)
+	}
+	if _, err := b.allow(now); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probes to be limited, got %v", err)
+	}
+	b.record(now, true, circuitFailed)
+	b.record(now, true, circuitSucceeded)
+	if b.state != CircuitOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", b.state)
+	}
+
+	now = now.Add(time.Second)
+	run(circuitSucceeded)
+	run(circuitSucceeded)
+	if b.state != CircuitClosed {
+		t.Fatalf("expected successful probes to close the breaker, got %s", b.state)
+	}
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(states) != len(want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("states = %v, want %v", states, want)
+			break
+		}
+	}
+
+	for _, cfg := range []*conf.CircuitBreaker{{}, {ErrorRate: 120}, {ErrorRate: 50, MinRequests: -1}} {
+		if _, err := newCircuitBreaker(cfg); err == nil {
+			t.Errorf("expected an error for %v", cfg)
+		}
+	}
+}
+
+func TestCircuitOutcomeOf(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want circuitOutcome
+	}{
+		{nil, circuitSucceeded},
+		{mongo.ErrNoDocuments, circuitSucceeded},
+		{mongo.CommandError{Code: 2}, circuitSucceeded},
+		{context.DeadlineExceeded, circuitFailed},
+		{mongo.ErrClientDisconnected, circuitFailed},
+		{context.Canceled, circuitSkipped},
+	} {
+		if got := circuitOutcomeOf(tc.err); got != tc.want {
+			t.Errorf("circuitOutcomeOf(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	p := NewMongoDBClient()
+	WithCircuitBreaker(50, time.Minute, 1)(p)
+	p.config().Database = "test"
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	breaker, err := p.newPluginCircuitBreaker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.breaker = breaker
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	op := operation{name: "find", database: "test", collection: "orders"}
+	for range defaultCircuitMinRequests {
+		_ = p.runOperation(context.Background(), op, func(context.Context) error { return mongo.ErrClientDisconnected })
+	}
+	if p.CircuitState() != CircuitOpen {
+		t.Fatalf("expected the breaker open, got %s", p.CircuitState())
+	}
+	called := false
+	err = p.runOperation(context.Background(), op, func(context.Context) error { called = true; return nil })
+	if called || !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a fast failure, got %v (called %v)", err, called)
+	}
+	if !p.isUnavailable(err) {
+		t.Error("expected an open breaker to count as unavailable for stale reads")
+	}
+}
@@ -0,0 +1,154 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Resource kinds released on Stop, in release order: buffered writes are flushed before
+// the streams, cursors and sessions they may use
+const (
+	ResourceBulkWriter   = "bulk_writer"
+	ResourceChangeStream = "change_stream"
+	ResourceCursor       = "cursor"
+	ResourceSession      = "session"
+	ResourceOther        = "resource"
+)
+
+var resourceOrder = []string{ResourceBulkWriter, ResourceChangeStream, ResourceCursor, ResourceSession, ResourceOther}
+
+// cleanupTimeoutPerResource bounds releasing one resource on Stop
+const cleanupTimeoutPerResource = 5 * time.Second
+
+// cleanupEntry is a registered resource and its release function
+type cleanupEntry struct {
+	id      uint64
+	kind    string
+	name    string
+	release func(ctx context.Context) error
+}
+
+// cleanupRegistry tracks resources to release before the client disconnects
+type cleanupRegistry struct {
+	mu      sync.Mutex
+	next    uint64
+	entries map[uint64]cleanupEntry
+}
+
+// RegisterCleanup registers a resource released on Stop before the client disconnects. kind is
+// one of the Resource* kinds (unknown kinds are released last). The returned function unregisters
+// the resource once the caller released it itself; it is safe to call more than once.
+func (p *PlugMongoDB) RegisterCleanup(kind, name string, release func(ctx context.Context) error) (unregister func()) {
+	r := &p.cleanup
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[uint64]cleanupEntry)
+	}
+	r.next++
+	id := r.next
+	r.entries[id] = cleanupEntry{id: id, kind: kind, name: name, release: release}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.entries, id)
+	}
+}
+
+// TrackSession ends sess on Stop unless the returned function is called first
+func (p *PlugMongoDB) TrackSession(sess mongo.Session) (untrack func()) {
+	return p.RegisterCleanup(ResourceSession, "", func(ctx context.Context) error {
+		sess.EndSession(ctx)
+		return nil
+	})
+}
+
+// TrackCursor kills cursor on Stop unless the returned function is called first
+func (p *PlugMongoDB) TrackCursor(cursor *mongo.Cursor) (untrack func()) {
+	return p.RegisterCleanup(ResourceCursor, fmt.Sprintf("%d", cursor.ID()), cursor.Close)
+}
+
+// TrackChangeStream closes stream on Stop unless the returned function is called first
+func (p *PlugMongoDB) TrackChangeStream(stream *mongo.ChangeStream) (untrack func()) {
+	return p.RegisterCleanup(ResourceChangeStream, fmt.Sprintf("%d", stream.ID()), stream.Close)
+}
+
+// releaseResources releases all registered resources by kind and logs a summary
+func (p *PlugMongoDB) releaseResources(parentCtx context.Context) {
+	r := &p.cleanup
+	r.mu.Lock()
+	entries := make([]cleanupEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.entries = nil
+	r.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	rank := func(kind string) int {
+		for i, k := range resourceOrder {
+			if k == kind {
+				return i
+			}
+		}
+		return len(resourceOrder)
+	}
+	// By kind, most recently registered first
+	sort.Slice(entries, func(i, j int) bool {
+		if ri, rj := rank(entries[i].kind), rank(entries[j].kind); ri != rj {
+			return ri < rj
+		}
+		return entries[i].id > entries[j].id
+	})
+
+	released := make(map[string]int)
+	failed := 0
+	for _, e := range entries {
+		ctx, cancel := p.createTimeoutContext(parentCtx, cleanupTimeoutPerResource)
+		err := e.release(ctx)
+		cancel()
+		if err != nil {
+			failed++
+			log.Warnf("failed to release mongodb %s %s: %v", e.kind, e.name, err)
+			continue
+		}
+		released[e.kind]++
+	}
+
+	kinds := append(append([]string{}, resourceOrder...), otherKinds(released)...)
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		if n := released[kind]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "none")
+	}
+	log.Infof("mongodb released resources before disconnect: %s (%d failed)", strings.Join(parts, ", "), failed)
+}
+
+// otherKinds returns the sorted kinds of released outside resourceOrder
+func otherKinds(released map[string]int) []string {
+	var out []string
+	for kind := range released {
+		known := false
+		for _, k := range resourceOrder {
+			known = known || k == kind
+		}
+		if !known {
+			out = append(out, kind)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,40 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReleaseResources(t *testing.T) {
+	p := NewMongoDBClient()
+	var order []string
+	release := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return err
+		}
+	}
+
+	p.RegisterCleanup(ResourceSession, "s1", release("s1", nil))
+	p.RegisterCleanup("exporter", "e1", release("e1", errors.New("busy")))
+	p.RegisterCleanup(ResourceCursor, "c1", release("c1", nil))
+	p.RegisterCleanup(ResourceBulkWriter, "w1", release("w1", nil))
+	p.RegisterCleanup(ResourceCursor, "c2", release("c2", nil))
+	untrack := p.RegisterCleanup(ResourceChangeStream, "cs1", release("cs1", nil))
+	untrack()
+	untrack()
+
+	p.releaseResources(context.Background())
+	want := []string{"w1", "c2", "c1", "s1", "e1"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got release order %v, want %v", order, want)
+	}
+
+	order = nil
+	p.releaseResources(context.Background())
+	if len(order) != 0 {
+		t.Errorf("resources must be released once, got %v", order)
+	}
+}
@@ -0,0 +1,173 @@
+package mongodb
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// workloadDisconnectTimeout bounds disconnecting a client during cleanup
+const workloadDisconnectTimeout = 5 * time.Second
+
+// clientState is an immutable client and database pair, with the workload pools created alongside
+// the client. It is replaced as a whole, so readers never observe a database handle belonging to a
+// different client.
+type clientState struct {
+	client   *mongo.Client
+	database *mongo.Database
+	// seeds are the unix_socket or discovered hosts the client was built with, nil for uri hosts
+	seeds []string
+	// election tracks primary elections of the replica set, from server monitoring
+	election *primaryElection
+	// Workload pools by name, and the pool selected for each owner label
+	workloads      map[string]*clientState
+	labelWorkloads map[string]string
+	// monitor is the monitoring state of the client and its workload pools (nil in tests)
+	monitor *clientMonitor
+	// batch is the batch client and its rate limit (nil unless batch_client is enabled), published
+	// with the state so a standby or a failed rebuild never replaces the limiter in use
+	batch *BatchClient
+}
+
+// clientMonitor is the monitoring state of one client. The failover standby and a client being
+// rebuilt keep their own, so they never overwrite the member health, pool gauges and events of the
+// client serving traffic; they publish once handed over (see handOverMonitor).
+type clientMonitor struct {
+	// publishing is set while the client serves traffic
+	publishing atomic.Bool
+	// Member health of the client's deployment
+	nodes nodeHealthTracker
+	// Checked-out and open connections
+	activeConns int64
+	openConns   int64
+	// resyncPool sets the pool gauges from the counts (nil without metrics)
+	resyncPool func()
+}
+
+// publishes reports whether the monitors of the client report for the plugin
+func (m *clientMonitor) publishes() bool {
+	return m.publishing.Load()
+}
+
+func newClientState(client *mongo.Client, database string) *clientState {
+	return &clientState{client: client, database: client.Database(database)}
+}
+
+// addWorkload attaches a workload pool client; only used before the state is published
+func (s *clientState) addWorkload(cfg *conf.WorkloadPool, client *mongo.Client, database string) {
+	if s.workloads == nil {
+		s.workloads = make(map[string]*clientState)
+		s.labelWorkloads = make(map[string]string)
+	}
+	s.workloads[cfg.GetName()] = newClientState(client, database)
+	for _, label := range cfg.GetOpLabels() {
+		s.labelWorkloads[label] = cfg.GetName()
+	}
+}
+
+// loadState returns the current client state, or nil before the client is created
+func (p *PlugMongoDB) loadState() *clientState {
+	return p.state.Load()
+}
+
+// config returns the plugin configuration, or nil before it is loaded. Reload publishes a new
+// configuration as a whole instead of changing it in place, so a caller reading several settings
+// for one decision should load it once.
+func (p *PlugMongoDB) config() *conf.MongoDB {
+	return p.conf.Load()
+}
+
+// handOverMonitor makes the monitors of next, just published, report in place of those of prev:
+// the member health and pool gauges switch to the deployment and pool of next
+func (p *PlugMongoDB) handOverMonitor(prev, next *clientState) {
+	if prev != nil && prev.monitor != nil {
+		prev.monitor.publishing.Store(false)
+	}
+	if next == nil || next.monitor == nil {
+		return
+	}
+	m := next.monitor
+	m.publishing.Store(true)
+	cfg := p.config()
+	for _, node := range p.nodes.snapshot() {
+		p.prometheusMetrics.DeleteNodeHealth(cfg, node.Address)
+	}
+	nodes := m.nodes.snapshot()
+	p.nodes.set(nodes)
+	for _, node := range nodes {
+		p.prometheusMetrics.RecordNodeHealth(cfg, node)
+	}
+	if m.resyncPool != nil {
+		m.resyncPool()
+	}
+}
+
+// activeConns returns the checked-out connections of the client serving traffic
+func (p *PlugMongoDB) activeConns() int64 {
+	s := p.loadState()
+	if s == nil || s.monitor == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.monitor.activeConns)
+}
+
+// swapClient publishes client (and its handle for database) and returns the previous client, or nil.
+// A nil client clears the state. The previous client stays connected; see retireClient.
+func (p *PlugMongoDB) swapClient(client *mongo.Client, database string) *mongo.Client {
+	var next *clientState
+	if client != nil {
+		next = newClientState(client, database)
+	}
+	prev := p.swapState(next)
+	if prev == nil {
+		return nil
+	}
+	return prev.client
+}
+
+// swapState publishes next (nil clears the state) and returns the previous state
+func (p *PlugMongoDB) swapState(next *clientState) *clientState {
+	return p.state.Swap(next)
+}
+
+// retireClient disconnects a replaced client once grace has passed, giving operations that
+// loaded it before the swap time to finish
+func (p *PlugMongoDB) retireClient(client *mongo.Client, grace time.Duration) {
+	if client == nil {
+		return
+	}
+	go func() {
+		if grace > 0 {
+			time.Sleep(grace)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			log.Warnf("failed to disconnect replaced mongodb client: %v", err)
+		}
+	}()
+}
+
+// retireState retires the client and workload pool clients of a replaced state (see retireClient)
+func (p *PlugMongoDB) retireState(s *clientState, grace time.Duration) {
+	if s == nil {
+		return
+	}
+	p.retireClient(s.client, grace)
+	for _, w := range s.workloads {
+		p.retireClient(w.client, grace)
+	}
+}
+
+// ClientPair returns the current client and database handle as a consistent pair
+func (p *PlugMongoDB) ClientPair() (*mongo.Client, *mongo.Database) {
+	s := p.loadState()
+	if s == nil {
+		return nil, nil
+	}
+	return s.client, s.database
+}
@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSwapClient(t *testing.T) {
+	p := NewMongoDBClient()
+	if client, db := p.ClientPair(); client != nil || db != nil {
+		t.Fatal("expected empty client state")
+	}
+
+	// Connect does not contact the server until the first operation
+	first, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = first.Disconnect(context.Background())
+		_ = second.Disconnect(context.Background())
+	}()
+
+	if prev := p.swapClient(first, "app"); prev != nil {
+		t.Errorf("expected no previous client, got %v", prev)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				client, db := p.ClientPair()
+				if db.Client() != client {
+					t.Error("client and database handle are inconsistent")
+					return
+				}
+			}
+		}()
+	}
+	if prev := p.swapClient(second, "app"); prev != first {
+		t.Error("expected the first client to be returned")
+	}
+	wg.Wait()
+
+	if p.GetDatabase().Name() != "app" || p.GetClient() != second {
+		t.Error("expected the second client to be current")
+	}
+	if prev := p.swapClient(nil, ""); prev != second || p.GetClient() != nil {
+		t.Error("expected the state to be cleared")
+	}
+}
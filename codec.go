@@ -0,0 +1,73 @@
+package mongodb
+
+import (
+	"bytes"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+// buildRegistry assembles the BSON registry used by the client.
+// It returns nil when no codec hooks are configured or registered so the driver keeps its default registry.
+func (p *PlugMongoDB) buildRegistry() (*bsoncodec.Registry, error) {
+	if p.config() == nil {
+		return nil, nil
+	}
+
+	var hooks []func(*bsoncodec.Registry) error
+	if th := p.config().GetTimeHandling(); th.GetEnabled() {
+		hooks = append(hooks, newTimeCodec(th, p.onLocalTimeWrite).register)
+	}
+	if hasDecimalCodecs() {
+		hooks = append(hooks, registerDecimalCodecs)
+	}
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+
+	registry := bson.NewRegistry()
+	for _, hook := range hooks {
+		if err := hook(registry); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// unmarshal decodes data into out using the client registry, so helper results honor the
+// same codec hooks as collection reads
+func (p *PlugMongoDB) unmarshal(data bson.Raw, out any) error {
+	dec, err := bson.NewDecoder(bsonrw.NewBSONDocumentReader(data))
+	if err != nil {
+		return err
+	}
+	if p.registry != nil {
+		if err := dec.SetRegistry(p.registry); err != nil {
+			return err
+		}
+	}
+	return dec.Decode(out)
+}
+
+// marshal encodes v using the client registry, like collection writes
+func (p *PlugMongoDB) marshal(v any) (bson.Raw, error) {
+	var buf bytes.Buffer
+	vw, err := bsonrw.NewBSONValueWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := bson.NewEncoder(vw)
+	if err != nil {
+		return nil, err
+	}
+	if p.registry != nil {
+		if err := enc.SetRegistry(p.registry); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
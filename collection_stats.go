@@ -0,0 +1,261 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// defaultStatsRefreshInterval is the background refresh interval when collection_stats.refresh_interval is unset
+	defaultStatsRefreshInterval = time.Minute
+	// statsIdleRefreshes is the number of refresh intervals after which unused collections leave the cache
+	statsIdleRefreshes = 10
+)
+
+// CollectionStats are the cached statistics of a collection. Counts come from collection metadata
+// (like estimatedDocumentCount), never from a collection scan.
+type CollectionStats struct {
+	Collection string `json:"collection"`
+	// Count is the estimated number of documents
+	Count int64 `json:"count"`
+	// Size is the uncompressed data size in bytes
+	Size int64 `json:"size"`
+	// StorageSize is the storage allocated to the data in bytes
+	StorageSize int64 `json:"storage_size"`
+	AvgObjSize  int64 `json:"avg_obj_size"`
+	// TotalIndexSize is the size of all indexes in bytes
+	TotalIndexSize int64 `json:"total_index_size"`
+	Indexes        int   `json:"indexes"`
+	Capped         bool  `json:"capped"`
+	// RefreshedAt is when the statistics were read from the server
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// statsCache holds collection statistics by collection name
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]*statsEntry
+}
+
+type statsEntry struct {
+	stats    CollectionStats
+	loaded   bool
+	lastUsed time.Time
+	// loading is closed when the running refresh ends
+	loading chan struct{}
+	// generation increases on invalidation, so a refresh started before it is not stored
+	generation uint64
+}
+
+// collStatsReply is the part of a $collStats document read into CollectionStats; sharded
+// collections return one document per shard
+type collStatsReply struct {
+	StorageStats struct {
+		Count          int64 `bson:"count"`
+		Size           int64 `bson:"size"`
+		StorageSize    int64 `bson:"storageSize"`
+		TotalIndexSize int64 `bson:"totalIndexSize"`
+		NIndexes       int   `bson:"nindexes"`
+		Capped         bool  `bson:"capped"`
+	} `bson:"storageStats"`
+}
+
+// Stats returns the statistics of collection from the in-process cache, so UI badges and admission
+// checks do not send a count command per request. Cached statistics are refreshed in the background
+// every collection_stats.refresh_interval while the collection is in use; the first call (and a call
+// after InvalidateStats) reads them from the server, concurrent callers sharing that read.
+func (p *PlugMongoDB) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	if collection == "" {
+		return CollectionStats{}, fmt.Errorf("collection name cannot be empty")
+	}
+	p.startStatsRefresh()
+	maxAge := 2 * p.statsRefreshInterval()
+	for {
+		p.stats.mu.Lock()
+		e := p.stats.entry(collection)
+		e.lastUsed = time.Now()
+		if e.loaded && time.Since(e.stats.RefreshedAt) < maxAge {
+			stats := e.stats
+			p.stats.mu.Unlock()
+			return stats, nil
+		}
+		if e.loading != nil {
+			loading := e.loading
+			p.stats.mu.Unlock()
+			select {
+			case <-loading:
+				continue
+			case <-ctx.Done():
+				return CollectionStats{}, ctx.Err()
+			}
+		}
+		p.stats.mu.Unlock()
+		return p.refreshStats(ctx, collection)
+	}
+}
+
+// InvalidateStats drops the cached statistics of the given collections (all when none is named),
+// so the next Stats call reads them from the server. Plugin helpers that rename, rebuild or
+// bulk-delete collections invalidate them.
+func (p *PlugMongoDB) InvalidateStats(collections ...string) {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	if len(collections) == 0 {
+		for _, e := range p.stats.entries {
+			e.loaded = false
+			e.generation++
+		}
+		return
+	}
+	for _, name := range collections {
+		if e, ok := p.stats.entries[name]; ok {
+			e.loaded = false
+			e.generation++
+		}
+	}
+}
+
+// entry returns the cache entry of collection, creating it; the caller holds mu
+func (c *statsCache) entry(collection string) *statsEntry {
+	if c.entries == nil {
+		c.entries = make(map[string]*statsEntry)
+	}
+	e, ok := c.entries[collection]
+	if !ok {
+		e = &statsEntry{}
+		c.entries[collection] = e
+	}
+	return e
+}
+
+// refreshStats reads the statistics of collection and stores them unless they were invalidated
+// meanwhile. A refresh already running for the collection is awaited instead.
+func (p *PlugMongoDB) refreshStats(ctx context.Context, collection string) (CollectionStats, error) {
+	p.stats.mu.Lock()
+	e := p.stats.entry(collection)
+	if e.loading != nil {
+		loading := e.loading
+		p.stats.mu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return CollectionStats{}, ctx.Err()
+		}
+		return p.Stats(ctx, collection)
+	}
+	loading := make(chan struct{})
+	e.loading = loading
+	generation := e.generation
+	p.stats.mu.Unlock()
+
+	stats, err := p.fetchStats(ctx, collection)
+
+	p.stats.mu.Lock()
+	e.loading = nil
+	if err == nil && e.generation == generation {
+		e.stats, e.loaded = stats, true
+	}
+	close(loading)
+	p.stats.mu.Unlock()
+	return stats, err
+}
+
+// fetchStats reads the statistics of collection with $collStats, summing the shards
+func (p *PlugMongoDB) fetchStats(ctx context.Context, collection string) (CollectionStats, error) {
+	stats := CollectionStats{Collection: collection}
+	op := operation{name: "collStats", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		pipeline := mongo.Pipeline{{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}}}
+		cursor, err := coll.Aggregate(ctx, pipeline, commentAggregateOptions(ctx))
+		if err != nil {
+			return err
+		}
+		var shards []collStatsReply
+		if err := cursor.All(ctx, &shards); err != nil {
+			return err
+		}
+		stats = sumCollStats(collection, shards)
+		return nil
+	})
+	return stats, err
+}
+
+func sumCollStats(collection string, shards []collStatsReply) CollectionStats {
+	stats := CollectionStats{Collection: collection, RefreshedAt: time.Now()}
+	for _, s := range shards {
+		stats.Count += s.StorageStats.Count
+		stats.Size += s.StorageStats.Size
+		stats.StorageSize += s.StorageStats.StorageSize
+		stats.TotalIndexSize += s.StorageStats.TotalIndexSize
+		stats.Indexes = max(stats.Indexes, s.StorageStats.NIndexes)
+		stats.Capped = stats.Capped || s.StorageStats.Capped
+	}
+	if stats.Count > 0 {
+		stats.AvgObjSize = stats.Size / stats.Count
+	}
+	return stats
+}
+
+// startStatsRefresh starts the background refresh of cached statistics
+func (p *PlugMongoDB) startStatsRefresh() {
+	p.startPeriodicTask("collection_stats", p.statsRefreshInterval(), p.refreshAllStats)
+}
+
+// trackConfiguredStats adds the collections of collection_stats to the cache and starts the refresh
+func (p *PlugMongoDB) trackConfiguredStats() {
+	collections := p.config().GetCollectionStats().GetCollections()
+	if len(collections) == 0 {
+		return
+	}
+	p.stats.mu.Lock()
+	for _, name := range collections {
+		p.stats.entry(name).lastUsed = time.Now()
+	}
+	p.stats.mu.Unlock()
+	p.startStatsRefresh()
+}
+
+// refreshAllStats refreshes the cached collections, dropping the ones unused for statsIdleRefreshes
+// intervals (configured collections stay)
+func (p *PlugMongoDB) refreshAllStats(ctx context.Context) {
+	idle := time.Duration(statsIdleRefreshes) * p.statsRefreshInterval()
+	configured := p.config().GetCollectionStats().GetCollections()
+
+	var names []string
+	p.stats.mu.Lock()
+	for name, e := range p.stats.entries {
+		if time.Since(e.lastUsed) > idle && !slices.Contains(configured, name) {
+			delete(p.stats.entries, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	p.stats.mu.Unlock()
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := p.refreshStats(ctx, name); err != nil && ctx.Err() == nil {
+			log.Debugf("mongodb statistics of %s not refreshed: %v", name, err)
+		}
+	}
+}
+
+func (p *PlugMongoDB) statsRefreshInterval() time.Duration {
+	if d := p.config().GetCollectionStats().GetRefreshInterval().AsDuration(); d > 0 {
+		return d
+	}
+	return defaultStatsRefreshInterval
+}
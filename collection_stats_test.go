@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestSumCollStats(t *testing.T) {
+	var shards [2]collStatsReply
+	shards[0].StorageStats.Count, shards[0].StorageStats.Size, shards[0].StorageStats.NIndexes = 100, 10000, 3
+	shards[1].StorageStats.Count, shards[1].StorageStats.Size, shards[1].StorageStats.NIndexes = 300, 50000, 3
+	shards[1].StorageStats.TotalIndexSize = 4096
+
+	stats := sumCollStats("orders", shards[:])
+	if stats.Count != 400 || stats.Size != 60000 || stats.AvgObjSize != 150 || stats.Indexes != 3 || stats.TotalIndexSize != 4096 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if empty := sumCollStats("orders", nil); empty.Count != 0 || empty.AvgObjSize != 0 {
+		t.Errorf("unexpected stats of an empty collection %+v", empty)
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{
+		Database:         "test",
+		OperationTimeout: durationpb.New(100 * time.Millisecond),
+		CollectionStats:  &conf.CollectionStats{RefreshInterval: durationpb.New(time.Hour)},
+	})
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+	defer p.stopPeriodicTasks()
+
+	if _, err := p.Stats(t.Context(), ""); err == nil {
+		t.Error("expected an error without collection")
+	}
+	if _, err := p.Stats(t.Context(), "orders"); err == nil {
+		t.Error("expected the first call to read from the (unreachable) server")
+	}
+
+	p.stats.mu.Lock()
+	p.stats.entry("orders").stats = CollectionStats{Collection: "orders", Count: 42, RefreshedAt: time.Now()}
+	p.stats.entry("orders").loaded = true
+	p.stats.mu.Unlock()
+	stats, err := p.Stats(t.Context(), "orders")
+	if err != nil || stats.Count != 42 {
+		t.Fatalf("expected the cached statistics, got %+v, %v", stats, err)
+	}
+
+	p.InvalidateStats("users")
+	if _, err := p.Stats(t.Context(), "orders"); err != nil {
+		t.Error("invalidating another collection must keep the cached statistics")
+	}
+	p.InvalidateStats("orders")
+	if _, err := p.Stats(t.Context(), "orders"); err == nil {
+		t.Error("expected an invalidated collection to be read from the server")
+	}
+
+	p.stats.mu.Lock()
+	p.stats.entry("orders").stats.RefreshedAt = time.Now().Add(-3 * time.Hour)
+	p.stats.entry("orders").loaded = true
+	p.stats.entry("idle").lastUsed = time.Now().Add(-11 * time.Hour)
+	p.stats.mu.Unlock()
+	if _, err := p.Stats(t.Context(), "orders"); err == nil {
+		t.Error("expected statistics older than two refresh intervals to be read again")
+	}
+	p.refreshAllStats(t.Context())
+	if _, ok := p.stats.entries["idle"]; ok {
+		t.Error("expected unused collections to leave the cache")
+	}
+}
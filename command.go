@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RunCommand runs an arbitrary database command through the managed client and returns the raw reply.
+// An empty db targets the configured database. The command goes through the client's monitors, so
+// metrics are recorded as for any other command, and errors only carry the command name, never its body.
+func (p *PlugMongoDB) RunCommand(ctx context.Context, db string, cmd any, opts ...*options.RunCmdOptions) (bson.Raw, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("command cannot be nil")
+	}
+	op := operation{name: commandName(cmd), database: p.databaseName(db), query: cmd}
+
+	var reply bson.Raw
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		database, err := p.databaseHandle(ctx, db)
+		if err != nil {
+			return err
+		}
+		raw, err := database.RunCommand(ctx, withCommentLabel(ctx, cmd), opts...).Raw()
+		if err != nil {
+			return err
+		}
+		reply = raw
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// RunCommandTyped runs a database command like RunCommand and decodes the reply into T
+func RunCommandTyped[T any](ctx context.Context, p *PlugMongoDB, db string, cmd any, opts ...*options.RunCmdOptions) (T, error) {
+	var result T
+	if p == nil {
+		return result, fmt.Errorf("mongodb plugin is nil")
+	}
+	reply, err := p.RunCommand(ctx, db, cmd, opts...)
+	if err != nil {
+		return result, err
+	}
+	if err := p.unmarshal(reply, &result); err != nil {
+		return result, fmt.Errorf("failed to decode %s reply: %w", commandName(cmd), err)
+	}
+	return result, nil
+}
+
+// commandName returns the command name (the first key of the command document)
+func commandName(cmd any) string {
+	switch c := cmd.(type) {
+	case bson.D:
+		if len(c) > 0 {
+			return c[0].Key
+		}
+	case bson.Raw:
+		if elems, err := c.Elements(); err == nil && len(elems) > 0 {
+			return elems[0].Key()
+		}
+	case bson.M:
+		// Commands must be ordered documents unless they have a single key
+		if len(c) == 1 {
+			for k := range c {
+				return k
+			}
+		}
+	}
+	return "runCommand"
+}
@@ -0,0 +1,284 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+)
+
+// DDL kinds run under the maintenance window
+const (
+	DDLCreateIndexes = "createIndexes"
+	DDLCollMod       = "collMod"
+	DDLMigration     = "migration"
+)
+
+const (
+	// defaultDDLWindowDuration is how long a window stays open when ddl_window.duration is unset
+	defaultDDLWindowDuration = time.Hour
+	// ddlWindowCheckInterval is how often queued DDL is checked against the window
+	ddlWindowCheckInterval = time.Minute
+)
+
+type bypassDDLWindowKey struct{}
+
+// PendingDDL describes a DDL operation queued until the maintenance window opens
+type PendingDDL struct {
+	ID          uint64    `json:"id"`
+	Kind        string    `json:"kind"`
+	Namespace   string    `json:"namespace"`
+	RequestedAt time.Time `json:"requested_at"`
+	// NextWindow is when the next maintenance window opens
+	NextWindow time.Time `json:"next_window"`
+}
+
+// DDLDeferredError is returned by DDL helpers called outside the maintenance window: the operation
+// is queued and runs when the window opens
+type DDLDeferredError struct {
+	PendingDDL
+}
+
+func (e *DDLDeferredError) Error() string {
+	return fmt.Sprintf("%s on %s deferred to the DDL window opening at %s", e.Kind, e.Namespace, e.NextWindow.Format(time.RFC3339))
+}
+
+// BypassDDLWindow returns a context whose DDL runs immediately regardless of the maintenance
+// window, for emergency fixes such as an index a failing query needs
+func BypassDDLWindow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassDDLWindowKey{}, true)
+}
+
+func bypassDDLWindow(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(bypassDDLWindowKey{}).(bool)
+	return on
+}
+
+// ddlWindow is a parsed ddl_window configuration
+type ddlWindow struct {
+	schedules []*cronSchedule
+	duration  time.Duration
+	location  *time.Location
+}
+
+// parseDDLWindow parses the window configuration; nil (no schedules) means DDL is never deferred
+func parseDDLWindow(c *conf.DDLWindow) (*ddlWindow, error) {
+	if len(c.GetSchedules()) == 0 {
+		if c.GetDuration() != nil || c.GetTimezone() != "" {
+			return nil, fmt.Errorf("schedules cannot be empty")
+		}
+		return nil, nil
+	}
+	w := &ddlWindow{duration: defaultDDLWindowDuration, location: time.UTC}
+	if d := c.GetDuration(); d != nil {
+		if w.duration = d.AsDuration(); w.duration <= 0 {
+			return nil, fmt.Errorf("duration must be positive")
+		}
+	}
+	if tz := c.GetTimezone(); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		w.location = loc
+	}
+	for _, expr := range c.GetSchedules() {
+		s, err := parseCron(expr)
+		if err != nil {
+			return nil, err
+		}
+		w.schedules = append(w.schedules, s)
+	}
+	return w, nil
+}
+
+// openAt reports whether a window is open at t: some schedule fired within the window duration
+func (w *ddlWindow) openAt(t time.Time) bool {
+	t = t.In(w.location)
+	for _, s := range w.schedules {
+		if start := s.next(t.Add(-w.duration)); !start.IsZero() && !start.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns t when a window is open, otherwise when the next one opens (zero if never)
+func (w *ddlWindow) nextOpen(t time.Time) time.Time {
+	if w.openAt(t) {
+		return t
+	}
+	var next time.Time
+	for _, s := range w.schedules {
+		if start := s.next(t.In(w.location)); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+// ddlState holds the parsed window and the DDL queued until it opens. The queue lives in memory:
+// DDL still pending on Stop is dropped (schema provisioning requests it again at the next start).
+type ddlState struct {
+	mu sync.Mutex
+	// source is the configuration window was parsed from
+	source  *conf.DDLWindow
+	window  *ddlWindow
+	pending []*queuedDDL
+	seq     uint64
+}
+
+type queuedDDL struct {
+	PendingDDL
+	// ctx keeps the values of the requesting context (labels, scope, audit actor) without its deadline
+	ctx context.Context
+	run func(ctx context.Context) error
+}
+
+// RunDDL runs fn, a DDL operation of the given kind on namespace, when the maintenance window is
+// open (or none is configured). Outside the window fn is queued, runs in request order once the
+// window opens, and RunDDL returns a *DDLDeferredError. Index, collMod and schema provisioning
+// helpers use it; applications route their migrations through it with kind DDLMigration.
+func (p *PlugMongoDB) RunDDL(ctx context.Context, kind, namespace string, fn func(ctx context.Context) error) error {
+	window, err := p.ddlWindow()
+	if err != nil {
+		return err
+	}
+	if window == nil {
+		return fn(ctx)
+	}
+	now := time.Now()
+	if bypassDDLWindow(ctx) || window.openAt(now) {
+		err := fn(ctx)
+		p.recordDDL(kind, err)
+		return err
+	}
+
+	p.ddl.mu.Lock()
+	p.ddl.seq++
+	item := &queuedDDL{
+		PendingDDL: PendingDDL{ID: p.ddl.seq, Kind: kind, Namespace: namespace, RequestedAt: now, NextWindow: window.nextOpen(now)},
+		ctx:        context.WithoutCancel(ctx),
+		run:        fn,
+	}
+	p.ddl.pending = append(p.ddl.pending, item)
+	pending := len(p.ddl.pending)
+	p.ddl.mu.Unlock()
+
+	log.InfowCtx(ctx, "key", "mongodb", "event", "ddl_deferred", "kind", kind, "namespace", namespace,
+		"next_window", item.NextWindow, "pending", pending)
+	if m := p.prometheusMetrics; m != nil {
+		m.RecordDDL(p.config(), kind, "deferred")
+		m.SetDDLPending(p.config(), pending)
+	}
+	return &DDLDeferredError{PendingDDL: item.PendingDDL}
+}
+
+// PendingDDL returns the DDL operations queued until the maintenance window opens, in run order
+func (p *PlugMongoDB) PendingDDL() []PendingDDL {
+	p.ddl.mu.Lock()
+	defer p.ddl.mu.Unlock()
+	if len(p.ddl.pending) == 0 {
+		return nil
+	}
+	var next time.Time
+	if p.ddl.window != nil {
+		next = p.ddl.window.nextOpen(time.Now())
+	}
+	out := make([]PendingDDL, 0, len(p.ddl.pending))
+	for _, item := range p.ddl.pending {
+		pending := item.PendingDDL
+		pending.NextWindow = next
+		out = append(out, pending)
+	}
+	return out
+}
+
+// ddlWindow returns the parsed window of the current configuration, nil when DDL is never deferred
+func (p *PlugMongoDB) ddlWindow() (*ddlWindow, error) {
+	c := p.config().GetDdlWindow()
+	p.ddl.mu.Lock()
+	defer p.ddl.mu.Unlock()
+	if c != p.ddl.source {
+		w, err := parseDDLWindow(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ddl_window: %w", err)
+		}
+		p.ddl.source, p.ddl.window = c, w
+	}
+	return p.ddl.window, nil
+}
+
+// startDDLWindow starts the task running queued DDL when the window opens
+func (p *PlugMongoDB) startDDLWindow() {
+	if len(p.config().GetDdlWindow().GetSchedules()) == 0 {
+		return
+	}
+	p.startPeriodicTask("ddl_window", ddlWindowCheckInterval, p.runPendingDDL)
+}
+
+// runPendingDDL runs queued DDL one operation at a time while the window is open. Operations keep
+// running once started when the window closes; the remaining ones wait for the next window.
+func (p *PlugMongoDB) runPendingDDL(ctx context.Context) {
+	window, err := p.ddlWindow()
+	if err != nil || window == nil {
+		return
+	}
+	for ctx.Err() == nil {
+		p.ddl.mu.Lock()
+		if len(p.ddl.pending) == 0 || !window.openAt(time.Now()) {
+			p.ddl.mu.Unlock()
+			return
+		}
+		item := p.ddl.pending[0]
+		p.ddl.pending = p.ddl.pending[1:]
+		pending := len(p.ddl.pending)
+		p.ddl.mu.Unlock()
+		p.prometheusMetrics.SetDDLPending(p.config(), pending)
+
+		start := time.Now()
+		err := p.runQueuedDDL(ctx, item)
+		p.recordDDL(item.Kind, err)
+		if err != nil {
+			log.WarnwCtx(item.ctx, "key", "mongodb", "event", "ddl_failed", "kind", item.Kind, "namespace", item.Namespace,
+				"requested_at", item.RequestedAt, "error", err)
+			continue
+		}
+		log.InfowCtx(item.ctx, "key", "mongodb", "event", "ddl_applied", "kind", item.Kind, "namespace", item.Namespace,
+			"requested_at", item.RequestedAt, "duration", time.Since(start))
+	}
+}
+
+// runQueuedDDL runs item with the values of its requesting context, canceled when ctx is
+func (p *PlugMongoDB) runQueuedDDL(ctx context.Context, item *queuedDDL) error {
+	runCtx, cancel := context.WithCancel(item.ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	return item.run(runCtx)
+}
+
+func (p *PlugMongoDB) recordDDL(kind string, err error) {
+	result := "applied"
+	if err != nil {
+		result = "failed"
+	}
+	p.prometheusMetrics.RecordDDL(p.config(), kind, result)
+}
+
+// ddlNamespace names the collections of a DDL operation in the default database
+func (p *PlugMongoDB) ddlNamespace(collections ...string) string {
+	db := p.databaseName("")
+	names := make([]string, len(collections))
+	for i, c := range collections {
+		names[i] = db + "." + c
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "0 2 * * *", "*/15 1-5 1,15 * 1-5", "30 1 * * 6,7", "0 0-23/6 * 1-12/2 *"} {
+		if _, err := parseCron(expr); err != nil {
+			t.Errorf("parseCron(%q): %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2026, 3, 14, 10, 7, 30, 0, time.UTC) // a Saturday
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 14, 10, 8, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 3, 15, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"30 1 * * 1-5", time.Date(2026, 3, 16, 1, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches
+		{"0 0 1 * 1", time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		s, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.next(base); !got.Equal(tc.want) {
+			t.Errorf("next(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestDDLWindowOpen(t *testing.T) {
+	w, err := parseDDLWindow(&conf.DDLWindow{Schedules: []string{"0 2 * * *"}, Duration: durationpb.New(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		at   time.Duration
+		open bool
+	}{
+		{time.Hour + 59*time.Minute, false},
+		{2 * time.Hour, true},
+		{3*time.Hour + 59*time.Minute, true},
+		{4 * time.Hour, false},
+	} {
+		if got := w.openAt(day.Add(tc.at)); got != tc.open {
+			t.Errorf("openAt(%v) = %v, want %v", tc.at, got, tc.open)
+		}
+	}
+	if next := w.nextOpen(day.Add(5 * time.Hour)); !next.Equal(day.Add(26 * time.Hour)) {
+		t.Errorf("unexpected next window %v", next)
+	}
+
+	for _, c := range []*conf.DDLWindow{
+		{Schedules: []string{"0 2 * *"}},
+		{Schedules: []string{"0 2 * * *"}, Duration: durationpb.New(0)},
+		{Schedules: []string{"0 2 * * *"}, Timezone: "Nowhere/Invalid"},
+		{Duration: durationpb.New(time.Hour)},
+	} {
+		if _, err := parseDDLWindow(c); err == nil {
+			t.Errorf("expected an error for %v", c)
+		}
+	}
+	if w, err := parseDDLWindow(nil); w != nil || err != nil {
+		t.Errorf("expected no window without configuration, got %v, %v", w, err)
+	}
+}
+
+// closedWindow returns a window opening twelve hours from now, closed for the duration of a test
+func closedWindow() *conf.DDLWindow {
+	hour := (time.Now().UTC().Hour() + 12) % 24
+	return &conf.DDLWindow{Schedules: []string{fmt.Sprintf("0 %d * * *", hour)}}
+}
+
+func TestRunDDLQueuesOutsideWindow(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", DdlWindow: closedWindow()})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+
+	type labelKey struct{}
+	var ran []string
+	var labels []any
+	run := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			ran = append(ran, name)
+			labels = append(labels, ctx.Value(labelKey{}))
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(t.Context(), labelKey{}, "backfill"))
+	err := p.RunDDL(ctx, DDLMigration, "test.orders", run("first"))
+	cancel()
+	var deferred *DDLDeferredError
+	if !errors.As(err, &deferred) || deferred.Kind != DDLMigration || deferred.NextWindow.IsZero() {
+		t.Fatalf("expected a deferred error, got %v", err)
+	}
+	if err := p.RunDDL(t.Context(), DDLCollMod, "test.orders", run("second")); !errors.As(err, &deferred) {
+		t.Fatalf("expected a deferred error, got %v", err)
+	}
+	if err := p.RunDDL(BypassDDLWindow(t.Context()), DDLCollMod, "test.orders", run("urgent")); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := p.PendingDDL()
+	if len(pending) != 2 || pending[0].Namespace != "test.orders" || pending[0].ID >= pending[1].ID {
+		t.Fatalf("unexpected pending DDL %+v", pending)
+	}
+	if stats := p.GetConnectionStats(); stats["pending_ddl"] == nil {
+		t.Error("expected pending DDL in the connection stats")
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.ddlPending.WithLabelValues("test")); got != 2 {
+		t.Errorf("ddl_pending = %v, want 2", got)
+	}
+
+	// Nothing runs while the window is closed
+	p.runPendingDDL(t.Context())
+	if len(ran) != 1 || ran[0] != "urgent" {
+		t.Fatalf("unexpected runs %v", ran)
+	}
+
+	p.config().DdlWindow = &conf.DDLWindow{Schedules: []string{"* * * * *"}}
+	p.runPendingDDL(t.Context())
+	if len(ran) != 3 || ran[1] != "first" || ran[2] != "second" {
+		t.Fatalf("expected queued DDL to run in order, got %v", ran)
+	}
+	if labels[1] != "backfill" {
+		t.Error("queued DDL must keep the values of the requesting context")
+	}
+	if len(p.PendingDDL()) != 0 {
+		t.Error("expected an empty queue")
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.ddlOperations.WithLabelValues("test", DDLMigration, "applied")); got != 1 {
+		t.Errorf("applied migrations = %v, want 1", got)
+	}
+}
+
+func TestEnsureIndexesDeferred(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", DdlWindow: closedWindow()})
+
+	_, err := p.EnsureIndexes(t.Context(),
+		IndexSpec{Collection: "orders", Keys: bson.D{{Key: "tenant_id", Value: 1}}},
+		IndexSpec{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true})
+	var deferred *DDLDeferredError
+	if !errors.As(err, &deferred) || deferred.Kind != DDLCreateIndexes || deferred.Namespace != "test.orders,test.users" {
+		t.Fatalf("expected a deferred index build, got %v", err)
+	}
+	if _, err := p.CollMod(t.Context(), "orders", bson.D{{Key: "validationLevel", Value: "moderate"}}, ""); !errors.As(err, &deferred) {
+		t.Fatalf("expected a deferred collMod, got %v", err)
+	}
+	if len(p.PendingDDL()) != 2 {
+		t.Errorf("expected two pending operations, got %+v", p.PendingDDL())
+	}
+}
@@ -0,0 +1,303 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultReplayBatchSize is the number of dead letters replayed per batch
+const defaultReplayBatchSize = 100
+
+// DeadLetter is a write that failed permanently, with its original payload
+type DeadLetter struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// Database and Collection are the write target
+	Database   string `bson:"database"`
+	Collection string `bson:"collection"`
+	// Operation is the failed write kind (upsert, replace)
+	Operation string `bson:"operation"`
+	// KeyFields are the fields the upsert matched on
+	KeyFields []string `bson:"key_fields,omitempty"`
+	// Document is the original payload
+	Document bson.Raw `bson:"document"`
+	// Error and Code describe the last failure
+	Error string `bson:"error"`
+	Code  int    `bson:"code,omitempty"`
+	// Attempts counts the writes tried, replays included
+	Attempts int       `bson:"attempts"`
+	FailedAt time.Time `bson:"failed_at"`
+}
+
+// DeadLetterSink receives writes that failed permanently. Implementations must not drop letters
+// silently: an error is logged with the number of lost letters.
+type DeadLetterSink interface {
+	WriteDeadLetters(ctx context.Context, letters []DeadLetter) error
+}
+
+// DeadLetterSinkFunc adapts a function to DeadLetterSink
+type DeadLetterSinkFunc func(ctx context.Context, letters []DeadLetter) error
+
+// WriteDeadLetters calls f
+func (f DeadLetterSinkFunc) WriteDeadLetters(ctx context.Context, letters []DeadLetter) error {
+	return f(ctx, letters)
+}
+
+// CollectionDeadLetters stores dead letters in a collection of the configured database
+type CollectionDeadLetters struct {
+	p    *PlugMongoDB
+	name string
+}
+
+// DeadLetterCollection returns the sink storing dead letters in collection
+func (p *PlugMongoDB) DeadLetterCollection(collection string) *CollectionDeadLetters {
+	return &CollectionDeadLetters{p: p, name: collection}
+}
+
+// defaultDeadLetters returns the sink of dead_letter_collection, nil when not configured
+func (p *PlugMongoDB) defaultDeadLetters() DeadLetterSink {
+	if p.config() == nil || p.config().DeadLetterCollection == "" {
+		return nil
+	}
+	return p.DeadLetterCollection(p.config().DeadLetterCollection)
+}
+
+// WriteDeadLetters inserts letters into the dead-letter collection
+func (s *CollectionDeadLetters) WriteDeadLetters(ctx context.Context, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	docs := make([]any, len(letters))
+	for i, letter := range letters {
+		docs[i] = letter
+	}
+	op := operation{name: "insert", database: s.p.databaseName(""), collection: s.name}
+	return s.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		_, err = coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		return err
+	})
+}
+
+// List returns the dead letters matching filter (nil lists all), oldest first
+func (s *CollectionDeadLetters) List(ctx context.Context, filter any, limit int64) ([]DeadLetter, error) {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	var letters []DeadLetter
+	op := operation{name: "find", database: s.p.databaseName(""), collection: s.name, query: filter}
+	err := s.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		// ObjectIDs follow insertion order
+		findOpts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+		if limit > 0 {
+			findOpts.SetLimit(limit)
+		}
+		cursor, err := coll.Find(ctx, filter, findOpts, commentFindOptions(ctx))
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &letters)
+	})
+	return letters, err
+}
+
+// ReplayOptions configures CollectionDeadLetters.Replay
+type ReplayOptions struct {
+	// Filter restricts the replayed letters (nil replays all), e.g. bson.M{"collection": "events"}
+	Filter any
+	// Limit bounds the number of replayed letters (0 replays all)
+	Limit int64
+	// BatchSize is the number of letters written per bulk write (default 100)
+	BatchSize int
+}
+
+// ReplayResult summarizes a Replay run
+type ReplayResult struct {
+	// Replayed letters were written and removed from the sink
+	Replayed int64
+	// Failed letters failed again; their error and attempt count were updated
+	Failed int64
+}
+
+// Replay writes dead letters back to their collection, oldest first, with the upsert they failed
+// with. Replayed letters are deleted; letters failing again stay with their new error.
+func (s *CollectionDeadLetters) Replay(ctx context.Context, opts ReplayOptions) (*ReplayResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReplayBatchSize
+	}
+	filter := opts.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	result := &ReplayResult{}
+	var lastID primitive.ObjectID
+	for opts.Limit <= 0 || result.Replayed+result.Failed < opts.Limit {
+		limit := int64(batchSize)
+		if opts.Limit > 0 {
+			limit = min(limit, opts.Limit-result.Replayed-result.Failed)
+		}
+		// Letters failing again stay in place, so pages resume after the last letter seen
+		page := bson.D{{Key: "$and", Value: bson.A{filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: lastID}}}}}}}
+		letters, err := s.List(ctx, page, limit)
+		if err != nil {
+			return result, err
+		}
+		if len(letters) == 0 {
+			break
+		}
+		lastID = letters[len(letters)-1].ID
+		if err := s.replayBatch(ctx, letters, result); err != nil {
+			return result, err
+		}
+	}
+	log.Infow("key", "mongodb", "event", "dead_letters_replayed", "collection", s.name,
+		"replayed", result.Replayed, "failed", result.Failed)
+	return result, nil
+}
+
+// replayBatch writes the letters of one page, grouped by target namespace
+func (s *CollectionDeadLetters) replayBatch(ctx context.Context, letters []DeadLetter, result *ReplayResult) error {
+	type target struct{ database, collection string }
+	groups := map[target][]int{}
+	var order []target
+	for i, letter := range letters {
+		t := target{letter.Database, letter.Collection}
+		if _, ok := groups[t]; !ok {
+			order = append(order, t)
+		}
+		groups[t] = append(groups[t], i)
+	}
+
+	var replayed []primitive.ObjectID
+	for _, t := range order {
+		idx := groups[t]
+		models := make([]mongo.WriteModel, len(idx))
+		for i, j := range idx {
+			letter := letters[j]
+			models[i] = upsertModel(letter.Document, letter.KeyFields, letter.Operation == deadLetterReplace)
+		}
+		failed := map[int]error{}
+		op := operation{name: "bulkWrite", database: t.database, collection: t.collection}
+		err := s.p.runOperation(ctx, op, func(ctx context.Context) error {
+			db, err := s.p.databaseHandle(ctx, t.database)
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection(t.collection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+			return err
+		})
+		var bwe mongo.BulkWriteException
+		switch {
+		case err == nil:
+		case errors.As(err, &bwe) && len(bwe.WriteErrors) > 0:
+			for _, we := range bwe.WriteErrors {
+				failed[we.Index] = we.WriteError
+			}
+		default:
+			return err
+		}
+		for i, j := range idx {
+			letter := letters[j]
+			if ferr, ok := failed[i]; ok {
+				if err := s.markFailed(ctx, letter, ferr); err != nil {
+					return err
+				}
+				result.Failed++
+				continue
+			}
+			replayed = append(replayed, letter.ID)
+		}
+	}
+	if len(replayed) == 0 {
+		return nil
+	}
+	op := operation{name: "delete", database: s.p.databaseName(""), collection: s.name}
+	err := s.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		_, err = coll.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: replayed}}}})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove replayed dead letters: %w", err)
+	}
+	result.Replayed += int64(len(replayed))
+	return nil
+}
+
+// markFailed records the error of a failed replay on its letter
+func (s *CollectionDeadLetters) markFailed(ctx context.Context, letter DeadLetter, cause error) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "error", Value: cause.Error()}, {Key: "code", Value: errorCode(cause)}, {Key: "failed_at", Value: time.Now().UTC()}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	op := operation{name: "update", database: s.p.databaseName(""), collection: s.name}
+	return s.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		_, err = coll.UpdateByID(ctx, letter.ID, update)
+		return err
+	})
+}
+
+// Dead letter operations
+const (
+	deadLetterUpsert  = "upsert"
+	deadLetterReplace = "replace"
+)
+
+// deadLetters converts ingestion failures into dead letters
+func (in *Ingester) deadLetters(failures []IngestFailure) []DeadLetter {
+	operation := deadLetterUpsert
+	if in.opts.Replace {
+		operation = deadLetterReplace
+	}
+	now := time.Now().UTC()
+	letters := make([]DeadLetter, len(failures))
+	for i, f := range failures {
+		letters[i] = DeadLetter{
+			Database:   in.p.databaseName(""),
+			Collection: in.opts.Collection,
+			Operation:  operation,
+			KeyFields:  in.opts.KeyFields,
+			Document:   f.Document,
+			Error:      f.Err.Error(),
+			Code:       errorCode(f.Err),
+			Attempts:   f.Attempts,
+			FailedAt:   now,
+		}
+	}
+	return letters
+}
+
+// errorCode returns the server error code of err, 0 when it has none
+func errorCode(err error) int {
+	var we mongo.WriteError
+	if errors.As(err, &we) {
+		return we.Code
+	}
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		return int(ce.Code)
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestIngesterDeadLetters(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond)})
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	var mu sync.Mutex
+	var letters []DeadLetter
+	in, err := p.NewIngester(IngestOptions{
+		Collection: "devices",
+		KeyFields:  []string{"device_id"},
+		Replace:    true,
+		DeadLetters: DeadLetterSinkFunc(func(_ context.Context, l []DeadLetter) error {
+			mu.Lock()
+			defer mu.Unlock()
+			letters = append(letters, l...)
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Submit(t.Context(), bson.M{"device_id": "d1", "temp": 21}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(letters))
+	}
+	l := letters[0]
+	if l.Database != "test" || l.Collection != "devices" || l.Operation != deadLetterReplace || l.Attempts != 1 || l.Error == "" {
+		t.Errorf("unexpected dead letter %+v", l)
+	}
+	if l.Document.Lookup("device_id").StringValue() != "d1" {
+		t.Error("dead letter must keep the original payload")
+	}
+	if in.Stats().DeadLettered != 1 {
+		t.Errorf("unexpected stats %+v", in.Stats())
+	}
+}
+
+func TestDefaultDeadLetters(t *testing.T) {
+	p := NewMongoDBClient()
+	if p.defaultDeadLetters() != nil {
+		t.Error("expected no default sink without dead_letter_collection")
+	}
+	WithDeadLetterCollection("dead_letters")(p)
+	sink, ok := p.defaultDeadLetters().(*CollectionDeadLetters)
+	if !ok || sink.name != "dead_letters" {
+		t.Errorf("unexpected default sink %#v", p.defaultDeadLetters())
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	we := mongo.WriteError{Code: 121, Message: "Document failed validation"}
+	if got := errorCode(we); got != 121 {
+		t.Errorf("got %d, want 121", got)
+	}
+	if got := errorCode(mongo.CommandError{Code: 11600}); got != 11600 {
+		t.Errorf("got %d, want 11600", got)
+	}
+	if got := errorCode(errors.New("network")); got != 0 {
+		t.Errorf("got %d, want 0", got)
+	}
+}
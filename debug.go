@@ -0,0 +1,320 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Driver log levels accepted by debug.driver_log_level
+const (
+	DriverLogOff   = "off"
+	DriverLogInfo  = "info"
+	DriverLogDebug = "debug"
+)
+
+// Config keys watched for runtime debug toggles
+const (
+	debugConfigKey        = "lynx.mongodb.debug"
+	slowQueryThresholdKey = "lynx.mongodb.slow_query_threshold"
+)
+
+// driverLogLevelDisabled marks that no driver log sink was installed at startup
+const driverLogLevelDisabled = -1
+
+// DebugToggles are the runtime-tunable logging switches
+type DebugToggles struct {
+	// CommandLogging logs every command (name, namespace, duration, outcome; never its body)
+	CommandLogging bool `json:"command_logging"`
+	// SlowQueryThreshold logs commands slower than the threshold (zero disables)
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold"`
+	// DriverLogLevel is off, info or debug; empty when driver logging was not enabled at startup
+	DriverLogLevel string `json:"driver_log_level,omitempty"`
+}
+
+// debugState holds the current toggles; it is read on every command
+type debugState struct {
+	commandLogging     atomic.Bool
+	slowQueryThreshold atomic.Int64
+	// driverLogLevel is the sink verbosity (0 off, 1 info, 2 debug) or driverLogLevelDisabled
+	driverLogLevel atomic.Int32
+	// mu serializes updates so change logs reflect the applied state
+	mu sync.Mutex
+}
+
+// loadDebugToggles initializes the toggles from the plugin config
+func (p *PlugMongoDB) loadDebugToggles() {
+	p.debug.commandLogging.Store(p.config().GetDebug().GetCommandLogging())
+	p.debug.slowQueryThreshold.Store(int64(p.config().GetSlowQueryThreshold().AsDuration()))
+	p.debug.driverLogLevel.Store(driverLogLevelDisabled)
+	if level := p.config().GetDebug().GetDriverLogLevel(); level != "" {
+		v, _ := parseDriverLogLevel(level)
+		p.debug.driverLogLevel.Store(v)
+	}
+}
+
+// DebugToggles returns the current runtime debug toggles
+func (p *PlugMongoDB) DebugToggles() DebugToggles {
+	t := DebugToggles{
+		CommandLogging:     p.debug.commandLogging.Load(),
+		SlowQueryThreshold: time.Duration(p.debug.slowQueryThreshold.Load()),
+	}
+	switch p.debug.driverLogLevel.Load() {
+	case 0:
+		t.DriverLogLevel = DriverLogOff
+	case 1:
+		t.DriverLogLevel = DriverLogInfo
+	case 2:
+		t.DriverLogLevel = DriverLogDebug
+	}
+	return t
+}
+
+// SetCommandLogging turns command logging on or off without a restart
+func (p *PlugMongoDB) SetCommandLogging(enabled bool) {
+	p.debug.mu.Lock()
+	defer p.debug.mu.Unlock()
+	if p.debug.commandLogging.Swap(enabled) != enabled {
+		log.Infof("mongodb command logging set to %t", enabled)
+	}
+}
+
+// SetSlowQueryThreshold changes the slow-query log threshold without a restart (zero disables)
+func (p *PlugMongoDB) SetSlowQueryThreshold(threshold time.Duration) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	p.debug.mu.Lock()
+	defer p.debug.mu.Unlock()
+	if time.Duration(p.debug.slowQueryThreshold.Swap(int64(threshold))) != threshold {
+		log.Infof("mongodb slow query threshold set to %s", threshold)
+	}
+}
+
+// SetDriverLogLevel changes the driver log verbosity (off, info or debug) without a restart.
+// The driver log sink is only installed when debug.driver_log_level is configured at startup.
+func (p *PlugMongoDB) SetDriverLogLevel(level string) error {
+	v, err := parseDriverLogLevel(level)
+	if err != nil {
+		return err
+	}
+	p.debug.mu.Lock()
+	defer p.debug.mu.Unlock()
+	current := p.debug.driverLogLevel.Load()
+	if current == driverLogLevelDisabled {
+		return fmt.Errorf("driver logging is not enabled: set debug.driver_log_level at startup")
+	}
+	if current != v {
+		p.debug.driverLogLevel.Store(v)
+		log.Infof("mongodb driver log level set to %s", level)
+	}
+	return nil
+}
+
+func parseDriverLogLevel(level string) (int32, error) {
+	switch level {
+	case DriverLogOff:
+		return 0, nil
+	case DriverLogInfo:
+		return 1, nil
+	case DriverLogDebug:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid driver log level %q: must be off, info or debug", level)
+}
+
+// driverLoggerOptions installs the driver log sink when debug.driver_log_level is configured in cfg.
+// The driver then builds log messages at debug level for every component, and the sink filters
+// them by the runtime level.
+func (p *PlugMongoDB) driverLoggerOptions(cfg *conf.MongoDB) *options.LoggerOptions {
+	if cfg.GetDebug().GetDriverLogLevel() == "" {
+		return nil
+	}
+	return options.Logger().
+		SetSink(&driverLogSink{level: &p.debug.driverLogLevel}).
+		SetComponentLevel(options.LogComponentAll, options.LogLevelDebug)
+}
+
+// driverLogSink forwards driver logs to the Lynx logger up to the runtime level
+type driverLogSink struct {
+	level *atomic.Int32
+}
+
+// Info implements options.LogSink
+func (s *driverLogSink) Info(level int, message string, keysAndValues ...any) {
+	if !s.enabled(level) {
+		return
+	}
+	log.Infow(append([]any{"mongodb_driver", message}, keysAndValues...)...)
+}
+
+// enabled reports whether a message the driver logs at level is forwarded. The driver passes its
+// log level minus one (0 for info, 1 for debug), one below the sink verbosity.
+func (s *driverLogSink) enabled(level int) bool {
+	return int32(level)+1 <= s.level.Load()
+}
+
+// Error implements options.LogSink
+func (s *driverLogSink) Error(err error, message string, keysAndValues ...any) {
+	if s.level.Load() <= 0 {
+		return
+	}
+	log.Errorw(append([]any{"mongodb_driver", message, "error", err}, keysAndValues...)...)
+}
+
+// createDebugMonitor logs commands per the runtime toggles: every command when command logging is
+// on, and commands over the slow-query threshold with their owner label
+func (p *PlugMongoDB) createDebugMonitor() *event.CommandMonitor {
+	collections := &sync.Map{} // requestID -> collection
+
+	finished := func(ctx context.Context, evt event.CommandFinishedEvent, failed bool) {
+		v, ok := collections.LoadAndDelete(evt.RequestID)
+		if !ok {
+			return
+		}
+		collection := v.(string)
+		threshold := time.Duration(p.debug.slowQueryThreshold.Load())
+		switch {
+		case threshold > 0 && evt.Duration >= threshold:
+			log.WarnwCtx(ctx, "key", "mongodb", "event", "slow_query",
+				"command", evt.CommandName,
+				"database", evt.DatabaseName,
+				"collection", collection,
+				"label", OpLabel(ctx),
+				"duration", evt.Duration,
+				"failed", failed,
+			)
+		case p.debug.commandLogging.Load():
+			log.InfowCtx(ctx, "key", "mongodb", "event", "command",
+				"command", evt.CommandName,
+				"database", evt.DatabaseName,
+				"collection", collection,
+				"label", OpLabel(ctx),
+				"request_id", evt.RequestID,
+				"duration", evt.Duration,
+				"failed", failed,
+			)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if p.debug.commandLogging.Load() || p.debug.slowQueryThreshold.Load() > 0 {
+				collections.Store(evt.RequestID, commandCollection(evt.Command))
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			finished(ctx, evt.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			finished(ctx, evt.CommandFinishedEvent, true)
+		},
+	}
+}
+
+// watchDebugConfig applies changes of the debug block and slow_query_threshold from the
+// config source without a restart
+func (p *PlugMongoDB) watchDebugConfig(cfg config.Config) {
+	if err := cfg.Watch(debugConfigKey, func(_ string, v config.Value) {
+		var debug conf.Debug
+		if err := v.Scan(&debug); err != nil {
+			log.Warnf("ignoring invalid %s update: %v", debugConfigKey, err)
+			return
+		}
+		p.SetCommandLogging(debug.GetCommandLogging())
+		if level := debug.GetDriverLogLevel(); level != "" {
+			if err := p.SetDriverLogLevel(level); err != nil {
+				log.Warnf("ignoring %s update: %v", debugConfigKey, err)
+			}
+		}
+	}); err != nil {
+		log.Debugf("not watching %s: %v", debugConfigKey, err)
+	}
+	if err := cfg.Watch(slowQueryThresholdKey, func(_ string, v config.Value) {
+		s, err := v.String()
+		if err != nil {
+			log.Warnf("ignoring invalid %s update: %v", slowQueryThresholdKey, err)
+			return
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			log.Warnf("ignoring invalid %s update: %v", slowQueryThresholdKey, err)
+			return
+		}
+		p.SetSlowQueryThreshold(d)
+	}); err != nil {
+		log.Debugf("not watching %s: %v", slowQueryThresholdKey, err)
+	}
+}
+
+// debugToggleUpdate is the body accepted by DebugHandler; absent fields are left unchanged
+type debugToggleUpdate struct {
+	CommandLogging     *bool   `json:"command_logging"`
+	SlowQueryThreshold *string `json:"slow_query_threshold"`
+	DriverLogLevel     *string `json:"driver_log_level"`
+}
+
+// DebugHandler returns an admin http.Handler for the runtime debug toggles: GET returns them and
+// PUT or POST applies a partial JSON update, e.g. {"command_logging": true, "slow_query_threshold": "50ms"}.
+// Mount it behind the application's admin authentication.
+func (p *PlugMongoDB) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if err := p.applyDebugUpdate(w, r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		toggles := p.DebugToggles()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"command_logging":      toggles.CommandLogging,
+			"slow_query_threshold": toggles.SlowQueryThreshold.String(),
+			"driver_log_level":     toggles.DriverLogLevel,
+		})
+	})
+}
+
+func (p *PlugMongoDB) applyDebugUpdate(w http.ResponseWriter, r *http.Request) error {
+	var update debugToggleUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&update); err != nil {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	// Validate everything before applying anything
+	var threshold time.Duration
+	if update.SlowQueryThreshold != nil {
+		d, err := time.ParseDuration(*update.SlowQueryThreshold)
+		if err != nil {
+			return fmt.Errorf("invalid slow_query_threshold: %w", err)
+		}
+		threshold = d
+	}
+	if update.DriverLogLevel != nil {
+		if err := p.SetDriverLogLevel(*update.DriverLogLevel); err != nil {
+			return err
+		}
+	}
+	if update.SlowQueryThreshold != nil {
+		p.SetSlowQueryThreshold(threshold)
+	}
+	if update.CommandLogging != nil {
+		p.SetCommandLogging(*update.CommandLogging)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestDebugToggles(t *testing.T) {
+	p := NewMongoDBClient()
+	WithSlowQueryThreshold(200 * time.Millisecond)(p)
+	p.loadDebugToggles()
+
+	got := p.DebugToggles()
+	if got.CommandLogging || got.SlowQueryThreshold != 200*time.Millisecond || got.DriverLogLevel != "" {
+		t.Errorf("unexpected initial toggles %+v", got)
+	}
+	if err := p.SetDriverLogLevel(DriverLogDebug); err == nil {
+		t.Error("expected an error without a driver log sink")
+	}
+
+	p.config().Debug = &conf.Debug{DriverLogLevel: DriverLogOff}
+	p.loadDebugToggles()
+	if err := p.SetDriverLogLevel(DriverLogDebug); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetDriverLogLevel("trace"); err == nil {
+		t.Error("expected an invalid level error")
+	}
+	if p.DebugToggles().DriverLogLevel != DriverLogDebug {
+		t.Error("expected the debug driver log level")
+	}
+}
+
+func TestDriverLogSinkLevels(t *testing.T) {
+	// The driver calls Info with its log level minus one
+	info, debug := int(options.LogLevelInfo)-1, int(options.LogLevelDebug)-1
+	tests := []struct {
+		level       string
+		info, debug bool
+	}{
+		{DriverLogOff, false, false},
+		{DriverLogInfo, true, false},
+		{DriverLogDebug, true, true},
+	}
+	for _, tt := range tests {
+		v, err := parseDriverLogLevel(tt.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var level atomic.Int32
+		level.Store(v)
+		s := &driverLogSink{level: &level}
+		if s.enabled(info) != tt.info || s.enabled(debug) != tt.debug {
+			t.Errorf("%s: info forwarded %v, debug forwarded %v", tt.level, s.enabled(info), s.enabled(debug))
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{SlowQueryThreshold: durationpb.New(time.Second)})
+	p.loadDebugToggles()
+	h := p.DebugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/debug/mongodb", strings.NewReader(`{"command_logging": true, "slow_query_threshold": "50ms"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["command_logging"] != true || body["slow_query_threshold"] != "50ms" {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	// Invalid updates apply nothing
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/debug/mongodb", strings.NewReader(`{"command_logging": false, "slow_query_threshold": "soon"}`)))
+	if rec.Code != http.StatusBadRequest || !p.DebugToggles().CommandLogging {
+		t.Errorf("expected a rejected update, got %d %+v", rec.Code, p.DebugToggles())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/mongodb", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status %d", rec.Code)
+	}
+}
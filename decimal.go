@@ -0,0 +1,240 @@
+package mongodb
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decimalCodec maps one Go decimal type to BSON Decimal128
+type decimalCodec struct {
+	typ    reflect.Type
+	encode func(reflect.Value) (primitive.Decimal128, error)
+	decode func(string) (reflect.Value, error)
+}
+
+var (
+	decimalCodecsMu sync.RWMutex
+	decimalCodecs   = map[reflect.Type]*decimalCodec{}
+)
+
+// RegisterDecimalType registers a Go decimal type stored as BSON Decimal128 through its exact
+// string form. It must be called before the plugin initializes. For shopspring/decimal:
+//
+//	mongodb.RegisterDecimalType(decimal.NewFromString, decimal.Decimal.String)
+func RegisterDecimalType[T any](parse func(string) (T, error), format func(T) string) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	registerDecimalCodec(&decimalCodec{
+		typ: typ,
+		encode: func(v reflect.Value) (primitive.Decimal128, error) {
+			return primitive.ParseDecimal128(format(v.Interface().(T)))
+		},
+		decode: func(s string) (reflect.Value, error) {
+			d, err := parse(s)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(d), nil
+		},
+	})
+}
+
+// RegisterBigRatDecimal registers big.Rat (and *big.Rat) as a Decimal128-backed type.
+// Encoding fails for values without an exact decimal representation, such as 1/3.
+func RegisterBigRatDecimal() {
+	registerDecimalCodec(&decimalCodec{
+		typ: reflect.TypeOf(big.Rat{}),
+		encode: func(v reflect.Value) (primitive.Decimal128, error) {
+			r := v.Interface().(big.Rat)
+			return RatToDecimal128(&r)
+		},
+		decode: func(s string) (reflect.Value, error) {
+			r, ok := new(big.Rat).SetString(s)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("invalid decimal value %q", s)
+			}
+			return reflect.ValueOf(*r), nil
+		},
+	})
+}
+
+func registerDecimalCodec(codec *decimalCodec) {
+	decimalCodecsMu.Lock()
+	defer decimalCodecsMu.Unlock()
+	decimalCodecs[codec.typ] = codec
+}
+
+// registerDecimalCodecs installs all registered decimal codecs on the registry
+func registerDecimalCodecs(registry *bsoncodec.Registry) error {
+	decimalCodecsMu.RLock()
+	defer decimalCodecsMu.RUnlock()
+	for typ, codec := range decimalCodecs {
+		registry.RegisterTypeEncoder(typ, bsoncodec.ValueEncoderFunc(codec.EncodeValue))
+		registry.RegisterTypeDecoder(typ, bsoncodec.ValueDecoderFunc(codec.DecodeValue))
+	}
+	return nil
+}
+
+func hasDecimalCodecs() bool {
+	decimalCodecsMu.RLock()
+	defer decimalCodecsMu.RUnlock()
+	return len(decimalCodecs) > 0
+}
+
+// EncodeValue writes the decimal as BSON Decimal128
+func (c *decimalCodec) EncodeValue(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != c.typ {
+		return bsoncodec.ValueEncoderError{Name: "DecimalEncodeValue", Types: []reflect.Type{c.typ}, Received: val}
+	}
+	d, err := c.encode(val)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s as decimal128: %w", c.typ, err)
+	}
+	return vw.WriteDecimal128(d)
+}
+
+// DecodeValue reads Decimal128, plus legacy string and numeric representations
+func (c *decimalCodec) DecodeValue(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != c.typ {
+		return bsoncodec.ValueDecoderError{Name: "DecimalDecodeValue", Types: []reflect.Type{c.typ}, Received: val}
+	}
+
+	var s string
+	switch vr.Type() {
+	case bsontype.Decimal128:
+		d, err := vr.ReadDecimal128()
+		if err != nil {
+			return err
+		}
+		if d.IsNaN() || d.IsInf() != 0 {
+			return fmt.Errorf("cannot decode %s into %s", d, c.typ)
+		}
+		s = d.String()
+	case bsontype.String:
+		str, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		s = str
+	case bsontype.Int32:
+		i, err := vr.ReadInt32()
+		if err != nil {
+			return err
+		}
+		s = strconv.FormatInt(int64(i), 10)
+	case bsontype.Int64:
+		i, err := vr.ReadInt64()
+		if err != nil {
+			return err
+		}
+		s = strconv.FormatInt(i, 10)
+	case bsontype.Double:
+		f, err := vr.ReadDouble()
+		if err != nil {
+			return err
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	case bsontype.Null:
+		val.Set(reflect.Zero(c.typ))
+		return vr.ReadNull()
+	default:
+		return fmt.Errorf("cannot decode %v into %s", vr.Type(), c.typ)
+	}
+
+	v, err := c.decode(s)
+	if err != nil {
+		return fmt.Errorf("failed to decode decimal %q into %s: %w", s, c.typ, err)
+	}
+	val.Set(v)
+	return nil
+}
+
+// RatToDecimal128 converts r to Decimal128 without rounding.
+// It returns an error when r has no finite decimal expansion or exceeds Decimal128 precision.
+func RatToDecimal128(r *big.Rat) (primitive.Decimal128, error) {
+	if r == nil {
+		return primitive.Decimal128{}, fmt.Errorf("nil decimal value")
+	}
+	// A fraction has a finite decimal expansion only if its denominator is 2^a * 5^b;
+	// scaling by 10^max(a, b) then yields an integer coefficient.
+	den := new(big.Int).Set(r.Denom())
+	scale := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		count := 0
+		mod := new(big.Int)
+		for {
+			q, m := new(big.Int).QuoRem(den, f, mod)
+			if m.Sign() != 0 {
+				break
+			}
+			den = q
+			count++
+		}
+		if count > scale {
+			scale = count
+		}
+	}
+	if den.Cmp(big.NewInt(1)) != 0 {
+		return primitive.Decimal128{}, fmt.Errorf("%s has no exact decimal representation", r.RatString())
+	}
+
+	coefficient := new(big.Int).Mul(r.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	coefficient.Quo(coefficient, r.Denom())
+	d, ok := primitive.ParseDecimal128FromBigInt(coefficient, -scale)
+	if !ok {
+		return primitive.Decimal128{}, fmt.Errorf("%s exceeds decimal128 precision", r.RatString())
+	}
+	return d, nil
+}
+
+// Decimal128ToRat converts a finite Decimal128 to an exact big.Rat
+func Decimal128ToRat(d primitive.Decimal128) (*big.Rat, error) {
+	bi, exp, err := d.BigInt()
+	if err != nil {
+		return nil, err
+	}
+	r := new(big.Rat).SetInt(bi)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil))
+	if exp >= 0 {
+		return r.Mul(r, scale), nil
+	}
+	return r.Quo(r, scale), nil
+}
+
+// IncDecimal builds an exact server-side increment ({$inc: {field: delta}}) for a Decimal128 field,
+// avoiding read-modify-write cycles through floating point or strings.
+func IncDecimal(field string, delta *big.Rat) (bson.D, error) {
+	return decimalUpdate("$inc", field, delta)
+}
+
+// MulDecimal builds an exact server-side multiplication ({$mul: {field: factor}}) for a Decimal128 field
+func MulDecimal(field string, factor *big.Rat) (bson.D, error) {
+	return decimalUpdate("$mul", field, factor)
+}
+
+func decimalUpdate(operator, field string, value *big.Rat) (bson.D, error) {
+	if field == "" {
+		return nil, fmt.Errorf("field name cannot be empty")
+	}
+	d, err := RatToDecimal128(value)
+	if err != nil {
+		return nil, err
+	}
+	return bson.D{{Key: operator, Value: bson.D{{Key: field, Value: d}}}}, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
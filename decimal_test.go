@@ -0,0 +1,88 @@
+package mongodb
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRatToDecimal128(t *testing.T) {
+	r, _ := new(big.Rat).SetString("1234.5678")
+	d, err := RatToDecimal128(r)
+	if err != nil {
+		t.Fatalf("RatToDecimal128: %v", err)
+	}
+	if d.String() != "1234.5678" {
+		t.Errorf("expected 1234.5678, got %s", d.String())
+	}
+	back, err := Decimal128ToRat(d)
+	if err != nil || back.Cmp(r) != 0 {
+		t.Errorf("round trip mismatch: %v, %v", back, err)
+	}
+
+	if _, err := RatToDecimal128(big.NewRat(1, 3)); err == nil {
+		t.Error("expected error for 1/3")
+	}
+}
+
+func TestDecimalCodecRoundTrip(t *testing.T) {
+	RegisterBigRatDecimal()
+	defer func() {
+		decimalCodecsMu.Lock()
+		decimalCodecs = map[reflect.Type]*decimalCodec{}
+		decimalCodecsMu.Unlock()
+	}()
+
+	p := NewMongoDBClient()
+	WithDatabase("test")(p)
+	registry, err := p.buildRegistry()
+	if err != nil || registry == nil {
+		t.Fatalf("buildRegistry: registry=%v err=%v", registry, err)
+	}
+
+	type account struct {
+		Balance *big.Rat `bson:"balance"`
+	}
+	balance, _ := new(big.Rat).SetString("10.25")
+	data, err := bson.MarshalWithRegistry(registry, account{Balance: balance})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if bson.Raw(data).Lookup("balance").Type != bson.TypeDecimal128 {
+		t.Fatalf("expected decimal128, got %v", bson.Raw(data).Lookup("balance").Type)
+	}
+
+	var out account
+	if err := bson.UnmarshalWithRegistry(registry, data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out.Balance == nil || out.Balance.Cmp(balance) != 0 {
+		t.Errorf("expected %v, got %v", balance, out.Balance)
+	}
+
+	// Legacy string representations decode into the decimal type
+	legacy, _ := bson.Marshal(bson.M{"balance": "3.50"})
+	if err := bson.UnmarshalWithRegistry(registry, legacy, &out); err != nil {
+		t.Fatalf("unmarshal legacy: %v", err)
+	}
+	if out.Balance.Cmp(big.NewRat(7, 2)) != 0 {
+		t.Errorf("expected 3.5, got %v", out.Balance)
+	}
+}
+
+func TestIncDecimal(t *testing.T) {
+	update, err := IncDecimal("balance", big.NewRat(-1, 4))
+	if err != nil {
+		t.Fatalf("IncDecimal: %v", err)
+	}
+	inc := update[0].Value.(bson.D)
+	if update[0].Key != "$inc" || inc[0].Key != "balance" {
+		t.Fatalf("unexpected update %v", update)
+	}
+	if d := inc[0].Value.(primitive.Decimal128); d.String() != "-0.25" {
+		t.Errorf("expected -0.25, got %s", d.String())
+	}
+}
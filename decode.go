@@ -0,0 +1,154 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errStrictDecoding is the cause of DecodeErrors raised by strict decoding
+var errStrictDecoding = errors.New("document does not strictly match the model")
+
+// quarantineTimeout bounds the quarantine write of an undecodable document
+const quarantineTimeout = 5 * time.Second
+
+// DecodeError reports a stored document that could not be decoded into its model
+type DecodeError struct {
+	Collection string
+	// ID is the document _id in extended JSON, empty when the document has none
+	ID string
+	// Violations are the fields found not to match the model
+	Violations []FieldViolation
+	// Quarantined reports whether the raw document was copied to the quarantine collection
+	Quarantined bool
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	fields := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		fields = append(fields, v.String())
+	}
+	msg := fmt.Sprintf("failed to decode %s document %s", e.Collection, e.ID)
+	if len(fields) > 0 {
+		msg += " [" + strings.Join(fields, ", ") + "]"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeDocument decodes a document read from collection into out, rejecting unknown fields and
+// lossy coercions when ctx requests strict decoding. Failures are counted by field, logged with the
+// document _id and, when quarantine_collection is set, the raw document is copied there for later
+// repair. The returned error is a *DecodeError.
+func (p *PlugMongoDB) decodeDocument(ctx context.Context, collection string, raw bson.Raw, out any) error {
+	var violations []FieldViolation
+	err := p.unmarshal(raw, out)
+	switch {
+	case err != nil:
+		violations = p.decodeViolations(reflect.TypeOf(out), raw)
+	case strictDecoding(ctx):
+		violations = p.strictViolations(reflect.TypeOf(out), raw)
+		if len(violations) == 0 {
+			return nil
+		}
+		err = errStrictDecoding
+	default:
+		return nil
+	}
+
+	decodeErr := &DecodeError{
+		Collection: collection,
+		Violations: violations,
+		Err:        err,
+	}
+	if id, lookupErr := raw.LookupErr("_id"); lookupErr == nil {
+		decodeErr.ID = id.String()
+	}
+
+	if p.prometheusMetrics != nil {
+		if len(decodeErr.Violations) == 0 {
+			p.prometheusMetrics.RecordDecodeError(p.config(), collection, "", ViolationTypeMismatch)
+		}
+		for _, v := range decodeErr.Violations {
+			p.prometheusMetrics.RecordDecodeError(p.config(), collection, violationMetricField(reflect.TypeOf(out), v.Field), v.Reason)
+		}
+	}
+
+	if target := p.config().GetQuarantineCollection(); target != "" {
+		if qErr := p.quarantine(ctx, target, decodeErr, raw); qErr != nil {
+			log.WarnfCtx(ctx, "failed to quarantine %s document %s: %v", collection, decodeErr.ID, qErr)
+		} else {
+			decodeErr.Quarantined = true
+		}
+	}
+
+	log.WarnwCtx(ctx, "key", "mongodb", "event", "decode_error",
+		"collection", collection,
+		"id", decodeErr.ID,
+		"violations", decodeErr.Violations,
+		"quarantined", decodeErr.Quarantined,
+		"error", err.Error(),
+	)
+	return decodeErr
+}
+
+// decodeViolations locates the fields of raw that made decoding into the type of out fail
+func (p *PlugMongoDB) decodeViolations(out reflect.Type, raw bson.Raw) []FieldViolation {
+	if out == nil {
+		return nil
+	}
+	var violations []FieldViolation
+	for _, v := range p.checkDocument(indirectType(out), raw) {
+		// Unknown fields are ignored by the decoder
+		if v.Reason != ViolationUnknownField {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// quarantine copies an undecodable document to the quarantine collection, keyed by its source
+// collection and _id so repeated reads of the same document do not pile up copies
+func (p *PlugMongoDB) quarantine(ctx context.Context, target string, decodeErr *DecodeError, raw bson.Raw) error {
+	coll, err := p.collectionHandle(ctx, target)
+	if err != nil {
+		return err
+	}
+	qCtx, cancel := p.createTimeoutContext(context.WithoutCancel(ctx), quarantineTimeout)
+	defer cancel()
+
+	doc := bson.D{
+		{Key: "source", Value: decodeErr.Collection},
+		{Key: "document", Value: raw},
+		{Key: "violations", Value: violationDocuments(decodeErr.Violations)},
+		{Key: "error", Value: decodeErr.Err.Error()},
+		{Key: "quarantined_at", Value: time.Now().UTC()},
+	}
+	id, lookupErr := raw.LookupErr("_id")
+	if lookupErr != nil {
+		_, err = coll.InsertOne(qCtx, doc)
+		return err
+	}
+	key := bson.D{{Key: "source", Value: decodeErr.Collection}, {Key: "id", Value: id}}
+	_, err = coll.ReplaceOne(qCtx, bson.D{{Key: "_id", Value: key}}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func violationDocuments(violations []FieldViolation) bson.A {
+	out := make(bson.A, 0, len(violations))
+	for _, v := range violations {
+		out = append(out, bson.D{{Key: "field", Value: v.Field}, {Key: "reason", Value: v.Reason}, {Key: "detail", Value: v.Detail}})
+	}
+	return out
+}
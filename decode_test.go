@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecodeDocumentError(t *testing.T) {
+	p := NewMongoDBClient()
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "_id", Value: "o1"},
+		{Key: "customer", Value: "c1"},
+		{Key: "total", Value: "12.50"},
+		{Key: "legacy", Value: true},
+	})
+
+	var out schemaOrder
+	err := p.decodeDocument(context.Background(), "orders", raw, &out)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a DecodeError, got %v", err)
+	}
+	if decodeErr.Collection != "orders" || decodeErr.ID != `"o1"` {
+		t.Errorf("unexpected collection or id: %s %s", decodeErr.Collection, decodeErr.ID)
+	}
+	if len(decodeErr.Violations) != 1 || decodeErr.Violations[0].Field != "total" {
+		t.Errorf("expected only the total field, got %v", decodeErr.Violations)
+	}
+	if decodeErr.Quarantined {
+		t.Error("quarantine is not configured")
+	}
+
+	ok, _ := bson.Marshal(bson.D{{Key: "customer", Value: "c1"}, {Key: "total", Value: 12.5}})
+	if err := p.decodeDocument(context.Background(), "orders", ok, &out); err != nil || out.Total != 12.5 {
+		t.Errorf("unexpected decode result %v %v", out, err)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	p := NewMongoDBClient()
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "customer", Value: primitive.NewObjectID()},
+		{Key: "total", Value: int64(12)},
+		{Key: "legacy", Value: true},
+	})
+
+	var out schemaOrder
+	if err := p.decodeDocument(context.Background(), "orders", raw, &out); err != nil {
+		t.Fatalf("permissive decoding should succeed: %v", err)
+	}
+
+	err := p.decodeDocument(WithStrictDecoding(context.Background()), "orders", raw, &out)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, errStrictDecoding) {
+		t.Fatalf("expected a strict DecodeError, got %v", err)
+	}
+	reasons := map[string]string{}
+	for _, v := range decodeErr.Violations {
+		reasons[v.Field] = v.Reason
+	}
+	want := map[string]string{"legacy": ViolationUnknownField, "customer": ViolationLossyCoercion, "total": ViolationLossyCoercion}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("got %v, want %v", reasons, want)
+	}
+}
+
+func TestWithoutField(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{{Key: "a", Value: 1}, {Key: "_textScore", Value: 1.5}, {Key: "b", Value: "x"}})
+	got := withoutField(raw, "_textScore")
+	if _, err := got.LookupErr("_textScore"); err == nil {
+		t.Error("expected the field to be removed")
+	}
+	if got.Lookup("b").StringValue() != "x" || got.Lookup("a").Int32() != 1 {
+		t.Errorf("unexpected document %s", got)
+	}
+}
@@ -0,0 +1,65 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/net/proxy"
+)
+
+// buildDialer returns the dialer of connections: the WithDialer dialer, or a net.Dialer with
+// tcp_keep_alive and dial_timeout, routed through proxy_url when set. It returns nil when nothing
+// is configured so the driver keeps its default dialer.
+func (p *PlugMongoDB) buildDialer(cfg *conf.MongoDB) (options.ContextDialer, error) {
+	var dialer options.ContextDialer
+	if p.dialer != nil {
+		dialer = p.dialer
+	} else if cfg.GetTcpKeepAlive() != nil || cfg.GetDialTimeout() != nil {
+		if cfg.GetDialTimeout().AsDuration() < 0 {
+			return nil, fmt.Errorf("dial_timeout cannot be negative")
+		}
+		dialer = &net.Dialer{
+			Timeout:   cfg.GetDialTimeout().AsDuration(),
+			KeepAlive: cfg.GetTcpKeepAlive().AsDuration(),
+		}
+	}
+	if cfg.GetProxyUrl() == "" {
+		return dialer, nil
+	}
+
+	u, err := url.Parse(cfg.GetProxyUrl())
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported proxy_url scheme %q, expected socks5", u.Scheme)
+	}
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	d, err := proxy.FromURL(u, forwardDialer{dialer})
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	// SOCKS5 dialers implement DialContext; the assertion only guards against other schemes
+	cd, ok := d.(options.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("proxy %s does not support dialing with a context", u.Scheme)
+	}
+	return cd, nil
+}
+
+// forwardDialer adapts a context dialer to the proxy dialer reaching the proxy server; the SOCKS5
+// dialer calls DialContext when available
+type forwardDialer struct {
+	options.ContextDialer
+}
+
+// Dial dials address without a deadline
+func (d forwardDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
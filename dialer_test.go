@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type recordingDialer struct {
+	addrs []string
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.addrs = append(d.addrs, address)
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+func TestBuildDialer(t *testing.T) {
+	p := &PlugMongoDB{}
+	if d, err := p.buildDialer(&conf.MongoDB{}); d != nil || err != nil {
+		t.Errorf("default dialer: %v, %v", d, err)
+	}
+	d, err := p.buildDialer(&conf.MongoDB{TcpKeepAlive: durationpb.New(-1), DialTimeout: durationpb.New(time.Second)})
+	nd, ok := d.(*net.Dialer)
+	if err != nil || !ok || nd.KeepAlive != -1 || nd.Timeout != time.Second {
+		t.Errorf("tuned dialer: %#v, %v", d, err)
+	}
+	if _, err := p.buildDialer(&conf.MongoDB{DialTimeout: durationpb.New(-time.Second)}); err == nil {
+		t.Error("negative dial_timeout accepted")
+	}
+	if _, err := p.buildDialer(&conf.MongoDB{ProxyUrl: "http://proxy:8080"}); err == nil {
+		t.Error("http proxy accepted")
+	}
+
+	// Connections to the proxy go through the custom dialer
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	custom := &recordingDialer{}
+	p = &PlugMongoDB{dialer: custom}
+	d, err = p.buildDialer(&conf.MongoDB{ProxyUrl: "socks5://user:pass@" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := d.DialContext(ctx, "tcp", "mongo:27017"); err == nil {
+		t.Error("dial through a closed proxy succeeded")
+	}
+	if len(custom.addrs) != 1 || custom.addrs[0] != ln.Addr().String() {
+		t.Errorf("custom dialer dialed %v, want the proxy", custom.addrs)
+	}
+}
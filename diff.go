@@ -0,0 +1,201 @@
+package mongodb
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ArrayStrategy controls how DiffDocuments handles changed arrays
+type ArrayStrategy int
+
+const (
+	// ArrayReplace sets the whole array when any element changed
+	ArrayReplace ArrayStrategy = iota
+	// ArrayElementwise sets changed elements by index ("items.2.qty"); arrays that shrink are replaced
+	ArrayElementwise
+)
+
+// FieldChange describes one changed path, used for audit trails
+type FieldChange struct {
+	// Dotted field path
+	Path string
+	// "set" or "unset"
+	Op string
+	// Previous value (nil for new fields)
+	Before any
+	// New value (nil for unset fields)
+	After any
+}
+
+// DocumentDiff is the minimal update turning one document into another
+type DocumentDiff struct {
+	// Fields to $set, in document order
+	Set bson.D
+	// Fields to $unset
+	Unset []string
+	// Every change with before/after values
+	Changes []FieldChange
+}
+
+// DiffOption configures DiffDocuments
+type DiffOption func(*diffOptions)
+
+type diffOptions struct {
+	arrays ArrayStrategy
+	ignore map[string]bool
+}
+
+// WithArrayStrategy selects how changed arrays are expressed
+func WithArrayStrategy(strategy ArrayStrategy) DiffOption {
+	return func(o *diffOptions) {
+		o.arrays = strategy
+	}
+}
+
+// IgnoreFields excludes dotted paths (and everything below them) from the diff
+func IgnoreFields(paths ...string) DiffOption {
+	return func(o *diffOptions) {
+		for _, path := range paths {
+			o.ignore[path] = true
+		}
+	}
+}
+
+// DiffDocuments computes the minimal $set/$unset update that turns before into after.
+// Both values may be structs, maps or BSON documents; they are compared in their BSON form,
+// so bson tags and omitempty apply. The _id field is never diffed.
+func DiffDocuments(before, after any, opts ...DiffOption) (*DocumentDiff, error) {
+	o := &diffOptions{ignore: map[string]bool{"_id": true}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	a, err := toDocument(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert previous document: %w", err)
+	}
+	b, err := toDocument(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert new document: %w", err)
+	}
+	diff := &DocumentDiff{}
+	o.diffDocs(diff, "", a, b)
+	return diff, nil
+}
+
+// IsEmpty reports whether the documents were equal
+func (d *DocumentDiff) IsEmpty() bool {
+	return d == nil || (len(d.Set) == 0 && len(d.Unset) == 0)
+}
+
+// Update returns the update document, or nil when nothing changed
+func (d *DocumentDiff) Update() bson.D {
+	if d.IsEmpty() {
+		return nil
+	}
+	update := bson.D{}
+	if len(d.Set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: d.Set})
+	}
+	if len(d.Unset) > 0 {
+		unset := make(bson.D, 0, len(d.Unset))
+		for _, path := range d.Unset {
+			unset = append(unset, bson.E{Key: path, Value: ""})
+		}
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update
+}
+
+func (o *diffOptions) diffDocs(diff *DocumentDiff, prefix string, a, b bson.D) {
+	old := make(map[string]any, len(a))
+	for _, e := range a {
+		old[e.Key] = e.Value
+	}
+	seen := make(map[string]bool, len(b))
+	for _, e := range b {
+		seen[e.Key] = true
+		path := joinPath(prefix, e.Key)
+		if o.ignore[path] {
+			continue
+		}
+		prev, ok := old[e.Key]
+		if !ok {
+			diff.set(path, nil, e.Value)
+			continue
+		}
+		o.diffValues(diff, path, prev, e.Value)
+	}
+	for _, e := range a {
+		path := joinPath(prefix, e.Key)
+		if !seen[e.Key] && !o.ignore[path] {
+			diff.Unset = append(diff.Unset, path)
+			diff.Changes = append(diff.Changes, FieldChange{Path: path, Op: "unset", Before: e.Value})
+		}
+	}
+}
+
+func (o *diffOptions) diffValues(diff *DocumentDiff, path string, prev, next any) {
+	switch nv := next.(type) {
+	case bson.D:
+		if pv, ok := prev.(bson.D); ok {
+			o.diffDocs(diff, path, pv, nv)
+			return
+		}
+	case bson.A:
+		if pv, ok := prev.(bson.A); ok && o.arrays == ArrayElementwise && len(nv) >= len(pv) {
+			for i, elem := range nv {
+				elemPath := path + "." + strconv.Itoa(i)
+				if i >= len(pv) {
+					diff.set(elemPath, nil, elem)
+					continue
+				}
+				o.diffValues(diff, elemPath, pv[i], elem)
+			}
+			return
+		}
+	}
+	if !valuesEqual(prev, next) {
+		diff.set(path, prev, next)
+	}
+}
+
+func (d *DocumentDiff) set(path string, before, after any) {
+	d.Set = append(d.Set, bson.E{Key: path, Value: after})
+	d.Changes = append(d.Changes, FieldChange{Path: path, Op: "set", Before: before, After: after})
+}
+
+// toDocument converts v to a bson.D with nested documents as bson.D and arrays as bson.A
+func toDocument(v any) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// valuesEqual compares two values by their BSON encoding, so type changes (int32 vs int64) count as changes
+func valuesEqual(a, b any) bool {
+	ta, da, errA := bson.MarshalValue(a)
+	tb, db, errB := bson.MarshalValue(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return ta == tb && bytes.Equal(da, db)
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
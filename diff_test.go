@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type diffAddress struct {
+	City string `bson:"city"`
+	Zip  string `bson:"zip,omitempty"`
+}
+
+type diffUser struct {
+	ID      string      `bson:"_id"`
+	Name    string      `bson:"name"`
+	Address diffAddress `bson:"address"`
+	Tags    []string    `bson:"tags"`
+	Note    string      `bson:"note,omitempty"`
+}
+
+func TestDiffDocuments(t *testing.T) {
+	before := diffUser{ID: "1", Name: "a", Address: diffAddress{City: "x", Zip: "100"}, Tags: []string{"a", "b"}, Note: "n"}
+	after := diffUser{ID: "2", Name: "a", Address: diffAddress{City: "y"}, Tags: []string{"a", "c", "d"}}
+
+	diff, err := DiffDocuments(before, after)
+	if err != nil {
+		t.Fatalf("DiffDocuments: %v", err)
+	}
+	set := map[string]bool{}
+	for _, e := range diff.Set {
+		set[e.Key] = true
+	}
+	if len(diff.Set) != 2 || !set["address.city"] || !set["tags"] {
+		t.Errorf("unexpected $set %v", diff.Set)
+	}
+	if len(diff.Unset) != 2 || diff.Unset[0] != "address.zip" || diff.Unset[1] != "note" {
+		t.Errorf("unexpected $unset %v", diff.Unset)
+	}
+	if len(diff.Changes) != 4 {
+		t.Errorf("expected 4 changes, got %d", len(diff.Changes))
+	}
+
+	diff, err = DiffDocuments(before, after, WithArrayStrategy(ArrayElementwise), IgnoreFields("address"))
+	if err != nil {
+		t.Fatalf("DiffDocuments: %v", err)
+	}
+	set = map[string]bool{}
+	for _, e := range diff.Set {
+		set[e.Key] = true
+	}
+	if len(diff.Set) != 2 || !set["tags.1"] || !set["tags.2"] {
+		t.Errorf("unexpected elementwise $set %v", diff.Set)
+	}
+	update := diff.Update()
+	if len(update) != 2 || update[0].Key != "$set" || update[1].Key != "$unset" {
+		t.Errorf("unexpected update %v", update)
+	}
+}
+
+func TestDiffDocumentsEqual(t *testing.T) {
+	doc := bson.M{"a": 1, "b": bson.M{"c": []int{1, 2}}}
+	diff, err := DiffDocuments(doc, doc)
+	if err != nil {
+		t.Fatalf("DiffDocuments: %v", err)
+	}
+	if !diff.IsEmpty() || diff.Update() != nil {
+		t.Errorf("expected empty diff, got %v", diff.Update())
+	}
+}
@@ -0,0 +1,193 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+)
+
+const (
+	// defaultDiscoveryInterval is the resolution interval when discovery.refresh_interval is unset
+	defaultDiscoveryInterval = 30 * time.Second
+	// defaultDiscoveryPortName is the service port name when discovery.port_name is unset
+	defaultDiscoveryPortName = "mongodb"
+	// discoveryTimeout bounds a resolution
+	discoveryTimeout = 10 * time.Second
+)
+
+// HostResolver resolves the seed list of the deployment, for instance from service discovery
+type HostResolver interface {
+	// ResolveHosts returns host:port addresses
+	ResolveHosts(ctx context.Context) ([]string, error)
+}
+
+// HostResolverFunc adapts a function to HostResolver
+type HostResolverFunc func(ctx context.Context) ([]string, error)
+
+// ResolveHosts calls f
+func (f HostResolverFunc) ResolveHosts(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// kubernetesResolver resolves the pods of a headless service from cluster DNS
+type kubernetesResolver struct {
+	service  string
+	portName string
+	// resolver overrides net.DefaultResolver in tests
+	resolver srvResolver
+}
+
+// KubernetesServiceResolver returns a resolver of the ready pods of a headless Kubernetes service:
+// cluster DNS publishes one SRV record per pod for each named port of the service. service is
+// "<name>.<namespace>", completed by the pod's DNS search domains, or a fully qualified name;
+// portName defaults to "mongodb".
+func KubernetesServiceResolver(service, portName string) HostResolver {
+	if portName == "" {
+		portName = defaultDiscoveryPortName
+	}
+	return &kubernetesResolver{service: service, portName: portName}
+}
+
+func (k *kubernetesResolver) ResolveHosts(ctx context.Context) ([]string, error) {
+	var resolver srvResolver = net.DefaultResolver
+	if k.resolver != nil {
+		resolver = k.resolver
+	}
+	return resolveSeeds(ctx, resolver, k.portName, k.service)
+}
+
+// hostResolverFor returns the resolver of the seed list of cfg: the WithHostResolver resolver, or
+// the discovery.kubernetes_service resolver; nil for the failover standby, which connects to
+// failover.uri
+func (p *PlugMongoDB) hostResolverFor(cfg *conf.MongoDB) HostResolver {
+	if cfg.GetFailover() != nil && cfg.GetUri() == cfg.GetFailover().GetUri() {
+		return nil
+	}
+	if p.hostResolver != nil {
+		return p.hostResolver
+	}
+	if service := cfg.GetDiscovery().GetKubernetesService(); service != "" {
+		return KubernetesServiceResolver(service, cfg.GetDiscovery().GetPortName())
+	}
+	return nil
+}
+
+// validateSeeds checks that unix_socket and discovery can replace the hosts of the uri
+func validateSeeds(c *conf.MongoDB) error {
+	srv := strings.HasPrefix(c.GetUri(), "mongodb+srv://")
+	if path := c.GetUnixSocket(); path != "" {
+		switch {
+		case !strings.HasSuffix(path, ".sock"):
+			return fmt.Errorf("unix_socket %q must end in .sock", path)
+		case srv:
+			return fmt.Errorf("unix_socket cannot be combined with a mongodb+srv uri")
+		case c.GetProxyUrl() != "":
+			return fmt.Errorf("unix_socket cannot be combined with proxy_url")
+		case c.GetDiscovery() != nil:
+			return fmt.Errorf("unix_socket cannot be combined with discovery")
+		}
+	}
+	if c.GetDiscovery() != nil && srv {
+		return fmt.Errorf("discovery cannot be combined with a mongodb+srv uri")
+	}
+	return nil
+}
+
+// seedHosts returns the hosts replacing those of the uri of cfg: the unix_socket path or the
+// resolved hosts, nil to keep the uri hosts
+func (p *PlugMongoDB) seedHosts(ctx context.Context, cfg *conf.MongoDB) ([]string, error) {
+	if path := cfg.GetUnixSocket(); path != "" {
+		return []string{path}, nil
+	}
+	resolver := p.hostResolverFor(cfg)
+	if resolver == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	hosts, err := resolver.ResolveHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts resolved")
+	}
+	hosts = slices.Clone(hosts)
+	slices.Sort(hosts)
+	return slices.Compact(hosts), nil
+}
+
+// startDiscovery periodically resolves the seed list and rebuilds the client when it changes
+func (p *PlugMongoDB) startDiscovery() {
+	if p.hostResolverFor(p.config()) == nil {
+		return
+	}
+	interval := defaultDiscoveryInterval
+	if d := p.config().GetDiscovery().GetRefreshInterval(); d != nil {
+		if d.AsDuration() < 0 {
+			return
+		}
+		if d.AsDuration() > 0 {
+			interval = d.AsDuration()
+		}
+	}
+	p.startPeriodicTask("discovery", interval, p.refreshDiscovery)
+}
+
+// refreshDiscovery resolves the seed list and rebuilds the client when it differs from the hosts
+// the client was built with: the driver discovers replica set members itself, but not new mongos
+// routers. Failed resolutions keep the client, and nothing is refreshed while switched over to the
+// failover standby.
+func (p *PlugMongoDB) refreshDiscovery(ctx context.Context) {
+	if p.ActiveCluster() != ClusterPrimary {
+		return
+	}
+	hosts, err := p.seedHosts(ctx, p.config())
+	if err != nil {
+		log.Warnw("key", "mongodb", "event", "discovery_failed", "error", err)
+		p.prometheusMetrics.RecordDiscovery(p.config(), "failed", 0)
+		return
+	}
+	state := p.loadState()
+	if state == nil {
+		return
+	}
+	added, removed := diffSeeds(state.seeds, hosts)
+	if len(added) == 0 && len(removed) == 0 {
+		p.prometheusMetrics.RecordDiscovery(p.config(), "unchanged", len(hosts))
+		return
+	}
+	p.prometheusMetrics.RecordDiscovery(p.config(), "changed", len(hosts))
+	log.Warnw("key", "mongodb", "event", "seed_list_changed", "host", p.config().GetDiscovery().GetKubernetesService(),
+		"added", strings.Join(added, ","), "removed", strings.Join(removed, ","))
+	p.emitTyped(EventSeedListChanged, plugins.PriorityNormal, SeedListChangedEvent{
+		Host: p.config().GetDiscovery().GetKubernetesService(), Added: added, Removed: removed, Seeds: hosts,
+	})
+	if err := p.rebuildForDiscovery(ctx); err != nil {
+		log.Warnw("key", "mongodb", "event", "discovery_rebuild_failed", "error", err)
+	}
+}
+
+// rebuildForDiscovery rebuilds the client on the current seed list
+func (p *PlugMongoDB) rebuildForDiscovery(ctx context.Context) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	if p.loadState() == nil {
+		return errClientNotInitialized
+	}
+	if p.ActiveCluster() != ClusterPrimary {
+		return fmt.Errorf("cannot rebuild the client while switched over to the failover standby")
+	}
+	if err := p.rebuildClient(ctx, p.config()); err != nil {
+		return err
+	}
+	log.Infow("key", "mongodb", "event", "discovery_rebuilt")
+	return nil
+}
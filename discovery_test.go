@@ -0,0 +1,131 @@
+package mongodb
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type headlessServiceResolver struct {
+	lookups []string
+}
+
+func (r *headlessServiceResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups = append(r.lookups, "_"+service+"._"+proto+"."+name)
+	return "", []*net.SRV{
+		{Target: "mongo-1.mongo.db.svc.cluster.local.", Port: 27017},
+		{Target: "mongo-0.mongo.db.svc.cluster.local.", Port: 27017},
+	}, nil
+}
+
+func (r *headlessServiceResolver) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func TestKubernetesServiceResolver(t *testing.T) {
+	dns := &headlessServiceResolver{}
+	r := KubernetesServiceResolver("mongo.db", "").(*kubernetesResolver)
+	r.resolver = dns
+	hosts, err := r.ResolveHosts(t.Context())
+	want := []string{"mongo-0.mongo.db.svc.cluster.local:27017", "mongo-1.mongo.db.svc.cluster.local:27017"}
+	if err != nil || !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %v, %v", hosts, err)
+	}
+	if !reflect.DeepEqual(dns.lookups, []string{"_mongodb._tcp.mongo.db"}) {
+		t.Errorf("lookups = %v", dns.lookups)
+	}
+}
+
+func TestValidateSeeds(t *testing.T) {
+	cases := []struct {
+		cfg *conf.MongoDB
+		err string
+	}{
+		{&conf.MongoDB{Uri: "mongodb://localhost", UnixSocket: "/tmp/mongodb-27017.sock"}, ""},
+		{&conf.MongoDB{Uri: "mongodb://localhost", UnixSocket: "/tmp/mongodb"}, "must end in .sock"},
+		{&conf.MongoDB{Uri: "mongodb+srv://cluster0.example.net", UnixSocket: "/tmp/m.sock"}, "mongodb+srv"},
+		{&conf.MongoDB{Uri: "mongodb://localhost", UnixSocket: "/tmp/m.sock", ProxyUrl: "socks5://bastion:1080"}, "proxy_url"},
+		{&conf.MongoDB{Uri: "mongodb+srv://cluster0.example.net", Discovery: &conf.Discovery{KubernetesService: "mongo.db"}}, "mongodb+srv"},
+		{&conf.MongoDB{Uri: "mongodb://localhost", Discovery: &conf.Discovery{KubernetesService: "mongo.db"}}, ""},
+	}
+	for _, c := range cases {
+		err := validateSeeds(c.cfg)
+		if (err == nil) != (c.err == "") || err != nil && !strings.Contains(err.Error(), c.err) {
+			t.Errorf("validateSeeds(%v) = %v, want %q", c.cfg, err, c.err)
+		}
+	}
+}
+
+func TestSeedHosts(t *testing.T) {
+	p := NewMongoDBClient()
+	hosts, err := p.seedHosts(t.Context(), &conf.MongoDB{UnixSocket: "/var/run/mongodb/mongodb-27017.sock"})
+	if err != nil || !reflect.DeepEqual(hosts, []string{"/var/run/mongodb/mongodb-27017.sock"}) {
+		t.Errorf("unix socket hosts = %v, %v", hosts, err)
+	}
+	if hosts, err := p.seedHosts(t.Context(), &conf.MongoDB{}); hosts != nil || err != nil {
+		t.Errorf("uri hosts = %v, %v", hosts, err)
+	}
+
+	WithHostResolver(HostResolverFunc(func(context.Context) ([]string, error) {
+		return []string{"mongos-1:27017", "mongos-0:27017", "mongos-1:27017"}, nil
+	}))(p)
+	cfg := &conf.MongoDB{Uri: "mongodb://seed:27017", Failover: &conf.Failover{Uri: "mongodb://dr:27017"}}
+	hosts, err = p.seedHosts(t.Context(), cfg)
+	if err != nil || !reflect.DeepEqual(hosts, []string{"mongos-0:27017", "mongos-1:27017"}) {
+		t.Errorf("resolved hosts = %v, %v", hosts, err)
+	}
+	if hosts, err := p.seedHosts(t.Context(), standbyConf(cfg)); hosts != nil || err != nil {
+		t.Errorf("standby hosts = %v, %v, want the failover uri hosts", hosts, err)
+	}
+}
+
+func TestRefreshDiscoveryRebuildsOnChange(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{
+		Uri:                    "mongodb://localhost:1",
+		Database:               "app",
+		ConnectTimeout:         durationpb.New(100 * time.Millisecond),
+		ServerSelectionTimeout: durationpb.New(50 * time.Millisecond),
+	})
+	if err := normalizeConf(p.config()); err != nil {
+		t.Fatal(err)
+	}
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	hosts := []string{"localhost:1"}
+	WithHostResolver(HostResolverFunc(func(context.Context) ([]string, error) { return hosts, nil }))(p)
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	state := newClientState(client, "app")
+	state.seeds = []string{"localhost:1"}
+	p.swapState(state)
+
+	p.refreshDiscovery(t.Context())
+	if got := testutil.ToFloat64(p.prometheusMetrics.discoveryRefreshes.WithLabelValues("app", "unchanged")); got != 1 {
+		t.Errorf("unchanged refreshes = %v", got)
+	}
+
+	// The rebuilt client cannot reach the new host, so the current one stays
+	hosts = []string{"localhost:1", "localhost:2"}
+	p.refreshDiscovery(t.Context())
+	if got := testutil.ToFloat64(p.prometheusMetrics.discoveryRefreshes.WithLabelValues("app", "changed")); got != 1 {
+		t.Errorf("changed refreshes = %v", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.discoveryHosts.WithLabelValues("app")); got != 2 {
+		t.Errorf("discovered hosts = %v", got)
+	}
+	if p.loadState() != state {
+		t.Error("an unreachable client replaced the current one")
+	}
+}
@@ -0,0 +1,130 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Error kinds returned by the helpers. A classified helper error matches one of them with
+// errors.Is while still wrapping the original driver error, so status mapping layers switch on
+// the kind and errors.As(err, &mongo.CommandError{}) keeps working.
+var (
+	// ErrNotFound means no document matched (mongo.ErrNoDocuments)
+	ErrNotFound = errors.New("mongodb: not found")
+	// ErrConflict means the write conflicted with existing data or a concurrent write:
+	// duplicate keys, write conflicts or a resource claimed by another instance
+	ErrConflict = errors.New("mongodb: conflict")
+	// ErrTimeout means the operation deadline passed before MongoDB answered
+	ErrTimeout = errors.New("mongodb: timeout")
+	// ErrUnavailable means MongoDB could not serve the operation: no client, no selectable
+	// server, a network error, a shed operation, maintenance mode or secondaries too stale for the read
+	ErrUnavailable = errors.New("mongodb: unavailable")
+	// ErrBadQuery means the operation itself is invalid and retrying it cannot succeed: malformed
+	// filters or updates, scanner or write guard rejections and missing scope values
+	ErrBadQuery = errors.New("mongodb: bad query")
+)
+
+// errorKinds lists the error kinds in classification order
+var errorKinds = []error{ErrNotFound, ErrConflict, ErrTimeout, ErrUnavailable, ErrBadQuery}
+
+// Server error codes of invalid operations
+var badQueryCodes = []int{
+	2,  // BadValue
+	9,  // FailedToParse
+	14, // TypeMismatch
+	72, // InvalidOptions
+}
+
+// writeConflictCode is reported when a concurrent write touched the same document
+const writeConflictCode = 112
+
+// errClientNotInitialized is returned by helpers called before the client is created or after it closed
+var errClientNotInitialized = errors.New("mongodb client is not initialized")
+
+// OperationError is returned by helpers for a failed operation. It matches its Kind with
+// errors.Is and unwraps to the driver error.
+type OperationError struct {
+	Operation string
+	Namespace string
+	// Kind is one of the Err error kinds, nil when the error could not be classified
+	Kind error
+	Err  error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("mongodb %s on %s failed: %v", e.Operation, e.Namespace, e.Err)
+}
+
+func (e *OperationError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// fail wraps err with the operation and its classified kind
+func (op operation) fail(err error) error {
+	return &OperationError{Operation: op.name, Namespace: op.namespace(), Kind: classifyError(err), Err: err}
+}
+
+// classifyError returns the error kind of err, nil when it has none
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) || hasServerErrorCode(err, writeConflictCode) {
+		return ErrConflict
+	}
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		return ErrTimeout
+	}
+	var selection topology.ServerSelectionError
+	if errors.Is(err, errClientNotInitialized) || errors.Is(err, mongo.ErrClientDisconnected) || errors.As(err, &selection) || mongo.IsNetworkError(err) {
+		return ErrUnavailable
+	}
+	if hasServerErrorCode(err, badQueryCodes...) || errors.Is(err, mongo.ErrNilDocument) {
+		return ErrBadQuery
+	}
+	return nil
+}
+
+// hasServerErrorCode reports whether err is a server error with one of codes
+func hasServerErrorCode(err error, codes ...int) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range codes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is classifies scope errors as bad queries
+func (e *ScopeError) Is(target error) bool { return target == ErrBadQuery }
+
+// Is classifies write guard rejections as bad queries
+func (e *WriteGuardError) Is(target error) bool { return target == ErrBadQuery }
+
+// Is classifies shed operations as unavailable
+func (e *LoadShedError) Is(target error) bool { return target == ErrUnavailable }
+
+// Is classifies reads rejected for stale secondaries as unavailable
+func (e *StaleReadError) Is(target error) bool { return target == ErrUnavailable }
+
+// Is classifies builds claimed by another instance as conflicts
+func (e *RollingBuildClaimedError) Is(target error) bool { return target == ErrConflict }
@@ -0,0 +1,56 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind error
+	}{
+		{mongo.ErrNoDocuments, ErrNotFound},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, ErrConflict},
+		{mongo.CommandError{Code: 112, Name: "WriteConflict"}, ErrConflict},
+		{fmt.Errorf("waiting: %w", context.DeadlineExceeded), ErrTimeout},
+		{mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}, ErrTimeout},
+		{mongo.ErrClientDisconnected, ErrUnavailable},
+		{&LoadShedError{Operation: "find"}, ErrUnavailable},
+		{mongo.CommandError{Code: 2, Name: "BadValue"}, ErrBadQuery},
+		{&ScopeError{Collection: "orders", Missing: []string{"tenant_id"}}, ErrBadQuery},
+		{&WriteGuardError{Operation: "deleteMany", Collection: "orders", Empty: true}, ErrBadQuery},
+		{context.Canceled, nil},
+		{mongo.CommandError{Code: 13, Name: "Unauthorized"}, nil},
+	} {
+		if got := classifyError(tc.err); got != tc.kind {
+			t.Errorf("classifyError(%v) = %v, want %v", tc.err, got, tc.kind)
+		}
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	op := operation{name: "insert", database: "test", collection: "users"}
+	cause := mongo.CommandError{Code: 112, Name: "WriteConflict", Message: "conflict"}
+	err := op.fail(cause)
+	if err.Error() != "mongodb insert on test.users failed: (WriteConflict) conflict" {
+		t.Errorf("unexpected message %q", err)
+	}
+	var cmdErr mongo.CommandError
+	if !errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) || !errors.As(err, &cmdErr) || cmdErr.Code != 112 {
+		t.Errorf("unexpected classification of %v", err)
+	}
+
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	err = p.runOperation(context.Background(), op, func(context.Context) error { return nil })
+	var opErr *OperationError
+	if !errors.Is(err, ErrUnavailable) || !errors.As(err, &opErr) || opErr.Operation != "insert" {
+		t.Errorf("expected an unavailable operation error without a client, got %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package mongodb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/plugins"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// Typed plugin events emitted on the Lynx event bus. The payload struct of each event is stored in
+// PluginEvent.Metadata under EventPayloadKey; use EventPayload to read it in listeners.
+const (
+	// EventConnected is emitted once the client passed its connection test (ConnectedEvent)
+	EventConnected plugins.EventType = "mongodb.connected"
+	// EventDisconnected is emitted after the client is disconnected (DisconnectedEvent)
+	EventDisconnected plugins.EventType = "mongodb.disconnected"
+	// EventReconnected is emitted when a health check succeeds after failures (ReconnectedEvent)
+	EventReconnected plugins.EventType = "mongodb.reconnected"
+	// EventHealthChanged is emitted when the health check result changes (HealthChangedEvent)
+	EventHealthChanged plugins.EventType = "mongodb.health_changed"
+	// EventPoolCleared is emitted when the driver clears a server connection pool (PoolClearedEvent)
+	EventPoolCleared plugins.EventType = "mongodb.pool_cleared"
+	// EventFailover is emitted when the replica set primary changes (FailoverEvent)
+	EventFailover plugins.EventType = "mongodb.failover"
+	// EventSwitchover is emitted when failover switches between the primary and standby clusters (SwitchoverEvent)
+	EventSwitchover plugins.EventType = "mongodb.switchover"
+	// EventSeedListChanged is emitted when the SRV records of a mongodb+srv uri, or service discovery, resolve to other hosts (SeedListChangedEvent)
+	EventSeedListChanged plugins.EventType = "mongodb.seed_list_changed"
+	// EventTopologyChanged is emitted when replica set members are added or removed (TopologyChangedEvent)
+	EventTopologyChanged plugins.EventType = "mongodb.topology_changed"
+	// EventMigrationApplied is emitted when a schema migration is applied (MigrationAppliedEvent)
+	EventMigrationApplied plugins.EventType = "mongodb.migration_applied"
+	// EventMigrationReverted is emitted when a schema migration is reverted by MigrateDown (MigrationRevertedEvent)
+	EventMigrationReverted plugins.EventType = "mongodb.migration_reverted"
+	// EventIndexBuildCompleted is emitted when an index build started by EnsureIndexes finishes (IndexBuildCompletedEvent)
+	EventIndexBuildCompleted plugins.EventType = "mongodb.index_build_completed"
+	// EventBackupStale is emitted when the backup marker becomes older than backup_monitor.max_age (BackupStaleEvent)
+	EventBackupStale plugins.EventType = "mongodb.backup_stale"
+	// EventMaintenance is emitted when the plugin enters or leaves maintenance mode (MaintenanceEvent)
+	EventMaintenance plugins.EventType = "mongodb.maintenance"
+)
+
+// EventPayloadKey is the PluginEvent.Metadata key holding the typed payload
+const EventPayloadKey = "payload"
+
+// ConnectedEvent is the payload of EventConnected
+type ConnectedEvent struct {
+	Database string
+}
+
+// DisconnectedEvent is the payload of EventDisconnected
+type DisconnectedEvent struct {
+	Database string
+	Err      error
+}
+
+// ReconnectedEvent is the payload of EventReconnected
+type ReconnectedEvent struct {
+	Database string
+	// Downtime is the time since the first failed health check
+	Downtime time.Duration
+}
+
+// HealthChangedEvent is the payload of EventHealthChanged
+type HealthChangedEvent struct {
+	Database string
+	// Healthy is the new health state
+	Healthy bool
+	Err     error
+}
+
+// PoolClearedEvent is the payload of EventPoolCleared
+type PoolClearedEvent struct {
+	Address string
+	// Interrupted reports whether in-use connections were closed as well
+	Interrupted bool
+}
+
+// FailoverEvent is the payload of EventFailover
+type FailoverEvent struct {
+	SetName string
+	// PreviousPrimary is empty when the set had no known primary
+	PreviousPrimary string
+	// NewPrimary is empty when the set lost its primary
+	NewPrimary string
+}
+
+// SwitchoverEvent is the payload of EventSwitchover
+type SwitchoverEvent struct {
+	// From and To are "primary" (uri) or "standby" (failover.uri)
+	From string
+	To   string
+	// Err is the last health check error of the cluster switched away from, nil for a manual switchover
+	Err error
+}
+
+// SeedListChangedEvent is the payload of EventSeedListChanged
+type SeedListChangedEvent struct {
+	// Host is the SRV host of the uri, or the discovered Kubernetes service (empty for WithHostResolver)
+	Host    string
+	Added   []string
+	Removed []string
+	// Seeds are the resolved host:port addresses after the change
+	Seeds []string
+}
+
+// TopologyChangedEvent is the payload of EventTopologyChanged
+type TopologyChangedEvent struct {
+	SetName string
+	Added   []string
+	Removed []string
+	// Members are the member addresses after the change
+	Members []string
+}
+
+// MigrationAppliedEvent is the payload of EventMigrationApplied
+type MigrationAppliedEvent struct {
+	Version  string
+	Name     string
+	Duration time.Duration
+}
+
+// MigrationRevertedEvent is the payload of EventMigrationReverted
+type MigrationRevertedEvent struct {
+	Version  string
+	Name     string
+	Duration time.Duration
+}
+
+// IndexBuildCompletedEvent is the payload of EventIndexBuildCompleted
+type IndexBuildCompletedEvent struct {
+	Namespace string
+	// Indexes are the names of the built indexes (the requested ones when the build failed)
+	Indexes  []string
+	Duration time.Duration
+	Err      error
+}
+
+// BackupStaleEvent is the payload of EventBackupStale
+type BackupStaleEvent struct {
+	// LastBackup is zero when no backup marker was found
+	LastBackup time.Time
+	Age        time.Duration
+	MaxAge     time.Duration
+}
+
+// MaintenanceEvent is the payload of EventMaintenance
+type MaintenanceEvent struct {
+	// Active is true when maintenance mode was entered, false when it was left
+	Active bool
+	// Duration is how long maintenance mode lasted, set when it was left
+	Duration time.Duration
+}
+
+// EventPayload returns the typed payload of a plugin event
+func EventPayload[T any](evt plugins.PluginEvent) (T, bool) {
+	payload, ok := evt.Metadata[EventPayloadKey].(T)
+	return payload, ok
+}
+
+// emitTyped emits a typed runtime event
+func (p *PlugMongoDB) emitTyped(typ plugins.EventType, priority int, payload any) {
+	if p.BasePlugin == nil {
+		return
+	}
+	p.EmitEvent(plugins.PluginEvent{
+		Type:     typ,
+		Priority: priority,
+		Source:   "mongodb",
+		Category: "runtime",
+		Metadata: map[string]any{EventPayloadKey: payload},
+	})
+}
+
+// healthTracker remembers the last health check result to emit transitions
+type healthTracker struct {
+	mu sync.Mutex
+	// known is false until the first check
+	known     bool
+	healthy   bool
+	downSince time.Time
+	// failures counts consecutive failed checks, lastErr is the latest failure (for liveness)
+	failures int
+	lastErr  error
+}
+
+// observeHealth records a health check result and emits EventHealthChanged on transitions,
+// plus EventReconnected when the server is reachable again
+func (p *PlugMongoDB) observeHealth(err error) {
+	t := &p.health
+	t.mu.Lock()
+	healthy := err == nil
+	changed := !t.known || t.healthy != healthy
+	recovered := t.known && !t.healthy && healthy
+	downtime := time.Since(t.downSince)
+	if !healthy && (!t.known || t.healthy) {
+		t.downSince = time.Now()
+	}
+	t.known, t.healthy = true, healthy
+	if healthy {
+		t.failures, t.lastErr = 0, nil
+	} else {
+		t.failures++
+		t.lastErr = err
+	}
+	t.mu.Unlock()
+
+	db := p.databaseName("")
+	if changed {
+		priority := plugins.PriorityNormal
+		if !healthy {
+			priority = plugins.PriorityHigh
+		}
+		p.emitTyped(EventHealthChanged, priority, HealthChangedEvent{Database: db, Healthy: healthy, Err: err})
+	}
+	if recovered {
+		p.emitTyped(EventReconnected, plugins.PriorityNormal, ReconnectedEvent{Database: db, Downtime: downtime})
+	}
+}
+
+// createEventPoolMonitor emits EventPoolCleared
+func (p *PlugMongoDB) createEventPoolMonitor(m *clientMonitor) *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			if evt.Type == event.PoolCleared && m.publishes() {
+				p.emitTyped(EventPoolCleared, plugins.PriorityHigh, PoolClearedEvent{Address: evt.Address, Interrupted: evt.Interruption})
+			}
+		},
+	}
+}
+
+// createEventServerMonitor tracks per-member health, emits EventTopologyChanged when a replica set
+// reconfiguration adds or removes members and EventFailover when the primary changes or is lost,
+// and records primary elections in election. The member view of m is always kept; the plugin view,
+// metrics (labelled from cfg, the configuration the client was built from) and events only while m publishes.
+func (p *PlugMongoDB) createEventServerMonitor(cfg *conf.MongoDB, election *primaryElection, m *clientMonitor) *event.ServerMonitor {
+	var primarySeen atomic.Bool
+	return &event.ServerMonitor{
+		TopologyDescriptionChanged: func(evt *event.TopologyDescriptionChangedEvent) {
+			nodes := m.nodes.update(evt.NewDescription)
+			previous, current := topologyPrimary(evt.PreviousDescription), topologyPrimary(evt.NewDescription)
+			election.observe(current, time.Now())
+			// The initial discovery of a primary is not a failover
+			failover := previous != current && primarySeen.Swap(true)
+			if !m.publishes() {
+				return
+			}
+			p.nodes.set(nodes)
+			for _, node := range nodes {
+				p.prometheusMetrics.RecordNodeHealth(cfg, node)
+			}
+			p.observeMembers(evt.PreviousDescription, evt.NewDescription)
+			if !failover {
+				return
+			}
+			p.emitTyped(EventFailover, plugins.PriorityHigh, FailoverEvent{
+				SetName:         evt.NewDescription.SetName,
+				PreviousPrimary: previous,
+				NewPrimary:      current,
+			})
+		},
+	}
+}
+
+// topologyPrimary returns the address of the primary of t, or empty
+func topologyPrimary(t description.Topology) string {
+	for _, s := range t.Servers {
+		if s.Kind == description.RSPrimary {
+			return s.Addr.String()
+		}
+	}
+	return ""
+}
+
+// composePoolMonitors returns a PoolMonitor calling every non-nil monitor
+func composePoolMonitors(monitors ...*event.PoolMonitor) *event.PoolMonitor {
+	var active []*event.PoolMonitor
+	for _, m := range monitors {
+		if m != nil && m.Event != nil {
+			active = append(active, m)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			for _, m := range active {
+				m.Event(evt)
+			}
+		},
+	}
+}
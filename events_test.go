@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/plugins"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+func TestEventPayload(t *testing.T) {
+	evt := plugins.PluginEvent{Type: EventFailover, Metadata: map[string]any{
+		EventPayloadKey: FailoverEvent{SetName: "rs0", PreviousPrimary: "a:27017", NewPrimary: "b:27017"},
+	}}
+	payload, ok := EventPayload[FailoverEvent](evt)
+	if !ok || payload.NewPrimary != "b:27017" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if _, ok := EventPayload[PoolClearedEvent](evt); ok {
+		t.Error("expected no payload of another type")
+	}
+}
+
+func TestObserveHealthTransitions(t *testing.T) {
+	p := NewMongoDBClient()
+	p.observeHealth(nil)
+	if !p.health.known || !p.health.healthy {
+		t.Fatal("expected a healthy state")
+	}
+	p.observeHealth(errors.New("no reachable servers"))
+	if p.health.healthy || p.health.downSince.IsZero() {
+		t.Fatal("expected an unhealthy state with its start time")
+	}
+	since := p.health.downSince
+	p.observeHealth(errors.New("no reachable servers"))
+	if p.health.downSince != since {
+		t.Error("repeated failures must keep the first failure time")
+	}
+	p.observeHealth(nil)
+	if !p.health.healthy {
+		t.Error("expected recovery")
+	}
+}
+
+func TestTopologyPrimary(t *testing.T) {
+	topo := description.Topology{Servers: []description.Server{
+		{Addr: address.Address("a:27017"), Kind: description.RSSecondary},
+		{Addr: address.Address("b:27017"), Kind: description.RSPrimary},
+	}}
+	if got := topologyPrimary(topo); got != "b:27017" {
+		t.Errorf("got %q", got)
+	}
+
+	// The monitor must not fail without a plugin runtime
+	mon := NewMongoDBClient().createEventServerMonitor(nil, nil, publishingMonitor())
+	mon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{NewDescription: topo})
+	mon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{PreviousDescription: topo})
+}
+
+func TestStandbyMonitorHandOver(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "test"}
+	p.conf.Store(cfg)
+	active := &clientState{monitor: &clientMonitor{}}
+	active.monitor.publishing.Store(true)
+	p.nodes.set([]NodeHealth{{Address: "primary:27017", Role: RolePrimary, Healthy: true}})
+	p.swapState(active)
+
+	// The standby keeps its own member view and pool counts without reporting them
+	standby := &clientState{monitor: &clientMonitor{}}
+	m := standby.monitor
+	serverMon := p.createEventServerMonitor(nil, &primaryElection{}, m)
+	serverMon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{NewDescription: description.Topology{
+		Servers: []description.Server{{Addr: address.Address("standby:27017"), Kind: description.Standalone}},
+	}})
+	poolMon, resync := p.prometheusMetrics.createPoolMonitor(cfg, &m.activeConns, &m.openConns, m.publishes)
+	m.resyncPool = resync
+	poolMon.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	poolMon.Event(&event.PoolEvent{Type: event.GetSucceeded})
+
+	labels := prometheus.Labels{"database": "test"}
+	if nodes := p.NodeHealth(); len(nodes) != 1 || nodes[0].Address != "primary:27017" {
+		t.Errorf("the standby must not replace the member view: %v", nodes)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.connectionPoolActive.With(labels)); got != 0 {
+		t.Errorf("the standby must not report pool gauges, got %v", got)
+	}
+	if m.activeConns != 1 || p.activeConns() != 0 {
+		t.Errorf("standby counts = %d, active counts = %d", m.activeConns, p.activeConns())
+	}
+
+	p.swapState(standby)
+	p.handOverMonitor(active, standby)
+	if active.monitor.publishes() || !m.publishes() {
+		t.Error("expected the monitors to swap")
+	}
+	if nodes := p.NodeHealth(); len(nodes) != 1 || nodes[0].Address != "standby:27017" {
+		t.Errorf("expected the standby member view, got %v", nodes)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.connectionPoolActive.With(labels)); got != 1 || p.activeConns() != 1 {
+		t.Errorf("expected the standby pool gauges, got %v", got)
+	}
+}
@@ -0,0 +1,247 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+	"google.golang.org/protobuf/proto"
+)
+
+// Failover defaults
+const (
+	defaultFailoverWarmConnections = 2
+	defaultFailoverInterval        = 5 * time.Second
+	defaultFailoverThreshold       = 3
+)
+
+// Clusters of the failover configuration
+const (
+	// ClusterPrimary is the cluster of uri
+	ClusterPrimary = "primary"
+	// ClusterStandby is the cluster of failover.uri
+	ClusterStandby = "standby"
+)
+
+// failover holds the standby client and the consecutive failed checks of the active one
+type failover struct {
+	interval  time.Duration
+	threshold int
+
+	mu sync.Mutex
+	// standby is the client not serving traffic; after a switchover it is the primary cluster's
+	standby *clientState
+	// active is the cluster serving traffic
+	active   string
+	failures int
+}
+
+// newFailover returns the failover of cfg, or nil when it is not configured
+func newFailover(cfg *conf.Failover) (*failover, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.GetUri() == "" {
+		return nil, fmt.Errorf("uri is required")
+	}
+	if cfg.GetFailureThreshold() < 0 {
+		return nil, fmt.Errorf("failure_threshold cannot be negative")
+	}
+	f := &failover{interval: defaultFailoverInterval, threshold: defaultFailoverThreshold, active: ClusterPrimary}
+	if d := cfg.GetCheckInterval().AsDuration(); d > 0 {
+		f.interval = d
+	}
+	if n := cfg.GetFailureThreshold(); n > 0 {
+		f.threshold = int(n)
+	}
+	return f, nil
+}
+
+// observe records a check of both clients and reports whether to switch to the standby
+func (f *failover) observe(activeErr, standbyErr error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if activeErr == nil {
+		f.failures = 0
+		return false
+	}
+	f.failures++
+	return f.failures >= f.threshold && standbyErr == nil && f.standby != nil
+}
+
+// standbyState returns the standby client state
+func (f *failover) standbyState() *clientState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.standby
+}
+
+// otherCluster returns the cluster not named by cluster
+func otherCluster(cluster string) string {
+	if cluster == ClusterPrimary {
+		return ClusterStandby
+	}
+	return ClusterPrimary
+}
+
+// standbyConf returns the connection settings of the standby cluster: those of cfg with the hosts
+// of failover.uri and a pool kept warm with warm_connections
+func standbyConf(cfg *conf.MongoDB) *conf.MongoDB {
+	c := proto.Clone(cfg).(*conf.MongoDB)
+	c.Uri = cfg.GetFailover().GetUri()
+	c.UnixSocket = ""
+	c.Discovery = nil
+	c.MinPoolSize = defaultFailoverWarmConnections
+	if n := cfg.GetFailover().GetWarmConnections(); n > 0 {
+		c.MinPoolSize = n
+	}
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		c.MinPoolSize = c.MaxPoolSize
+	}
+	return c
+}
+
+// connectStandby connects the standby client of failover, if configured
+func (p *PlugMongoDB) connectStandby(ctx context.Context) error {
+	f := p.failover
+	if f == nil {
+		return nil
+	}
+	state, err := p.connectClient(ctx, standbyConf(p.config()))
+	if err != nil {
+		return fmt.Errorf("failed to connect failover standby: %w", err)
+	}
+	f.mu.Lock()
+	f.standby = state
+	f.mu.Unlock()
+	p.prometheusMetrics.RecordActiveCluster(p.config(), ClusterPrimary)
+	return nil
+}
+
+// startFailover starts health checking the active and standby clients
+func (p *PlugMongoDB) startFailover() {
+	if f := p.failover; f != nil {
+		p.startPeriodicTask("failover", f.interval, p.checkFailover)
+	}
+}
+
+// checkFailover pings the active and standby clients and switches to the standby once the active
+// client failed failure_threshold consecutive checks while the standby answers
+func (p *PlugMongoDB) checkFailover(ctx context.Context) {
+	f := p.failover
+	active, standby := p.loadState(), f.standbyState()
+	if active == nil || standby == nil {
+		return
+	}
+	activeErr := p.pingFailoverState(ctx, active)
+	standbyErr := p.pingFailoverState(ctx, standby)
+
+	f.mu.Lock()
+	cluster := f.active
+	f.mu.Unlock()
+	p.prometheusMetrics.RecordClusterUp(p.config(), cluster, activeErr == nil)
+	p.prometheusMetrics.RecordClusterUp(p.config(), otherCluster(cluster), standbyErr == nil)
+	if standbyErr != nil {
+		log.Debugw("key", "mongodb", "event", "failover_standby_unreachable", "cluster", otherCluster(cluster), "error", standbyErr)
+	}
+
+	if f.observe(activeErr, standbyErr) {
+		p.switchover(ctx, active, activeErr)
+	}
+}
+
+// pingFailoverState pings the client of s within the check interval
+func (p *PlugMongoDB) pingFailoverState(ctx context.Context, s *clientState) error {
+	ctx, cancel := context.WithTimeout(ctx, p.failover.interval)
+	defer cancel()
+	return s.client.Ping(ctx, nil)
+}
+
+// switchover publishes the standby client in place of from, which becomes the standby. It does
+// nothing when from is no longer the active client.
+func (p *PlugMongoDB) switchover(ctx context.Context, from *clientState, cause error) bool {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	f := p.failover
+	f.mu.Lock()
+	if f.standby == nil || p.loadState() != from {
+		f.mu.Unlock()
+		return false
+	}
+	p.swapState(f.standby)
+	p.handOverMonitor(from, f.standby)
+	f.standby = from
+	prev := f.active
+	f.active = otherCluster(prev)
+	f.failures = 0
+	next := f.active
+	f.mu.Unlock()
+
+	// Failures and capabilities of the previous cluster say nothing about the new one
+	p.breaker.reset()
+	p.refreshServerInfo(ctx)
+	log.Warnw("key", "mongodb", "event", "failover_switchover", "from", prev, "to", next, "error", cause)
+	p.prometheusMetrics.RecordActiveCluster(p.config(), next)
+	p.prometheusMetrics.RecordSwitchover(p.config(), next)
+	p.emitTyped(EventSwitchover, plugins.PriorityHigh, SwitchoverEvent{From: prev, To: next, Err: cause})
+	return true
+}
+
+// Switchover switches helpers and GetClient to the standby cluster of failover, for instance to
+// return to the primary cluster once it recovered; the previous client becomes the standby. It
+// fails when failover is not configured or the standby does not answer a ping.
+func (p *PlugMongoDB) Switchover(ctx context.Context) error {
+	f := p.failover
+	if f == nil {
+		return fmt.Errorf("mongodb failover is not configured")
+	}
+	active, standby := p.loadState(), f.standbyState()
+	if active == nil || standby == nil {
+		return errClientNotInitialized
+	}
+	if err := p.pingFailoverState(ctx, standby); err != nil {
+		return fmt.Errorf("mongodb failover standby is unreachable: %w", err)
+	}
+	if !p.switchover(ctx, active, nil) {
+		return fmt.Errorf("mongodb client changed during switchover")
+	}
+	return nil
+}
+
+// ActiveCluster returns the cluster serving traffic, ClusterPrimary or ClusterStandby; it is always
+// ClusterPrimary when failover is not configured
+func (p *PlugMongoDB) ActiveCluster() string {
+	f := p.failover
+	if f == nil {
+		return ClusterPrimary
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// disconnectStandby disconnects the standby client and its workload pools
+func (p *PlugMongoDB) disconnectStandby(parentCtx context.Context) {
+	f := p.failover
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	standby := f.standby
+	f.standby = nil
+	f.mu.Unlock()
+	if standby == nil {
+		return
+	}
+	ctx, cancel := p.createTimeoutContext(parentCtx, workloadDisconnectTimeout)
+	defer cancel()
+	if err := standby.client.Disconnect(ctx); err != nil {
+		log.Warnf("failed to disconnect mongodb failover standby: %v", err)
+	}
+	disconnectWorkloads(standby)
+}
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestFailoverConfig(t *testing.T) {
+	if f, err := newFailover(nil); f != nil || err != nil {
+		t.Errorf("unconfigured failover: %v, %v", f, err)
+	}
+	if _, err := newFailover(&conf.Failover{}); err == nil {
+		t.Error("expected an error without uri")
+	}
+	f, err := newFailover(&conf.Failover{Uri: "mongodb://standby:27017"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.interval != defaultFailoverInterval || f.threshold != defaultFailoverThreshold || f.active != ClusterPrimary {
+		t.Errorf("unexpected defaults: %+v", f)
+	}
+
+	cfg := &conf.MongoDB{Uri: "mongodb://primary:27017", MaxPoolSize: 100, MinPoolSize: 10,
+		Failover: &conf.Failover{Uri: "mongodb://standby:27017"}}
+	standby := standbyConf(cfg)
+	if standby.Uri != "mongodb://standby:27017" || standby.MinPoolSize != defaultFailoverWarmConnections || standby.MaxPoolSize != 100 {
+		t.Errorf("unexpected standby settings: %v", standby)
+	}
+	if cfg.Uri != "mongodb://primary:27017" {
+		t.Error("standbyConf must not modify the plugin configuration")
+	}
+}
+
+func TestFailoverObserve(t *testing.T) {
+	f, _ := newFailover(&conf.Failover{Uri: "mongodb://standby:27017", FailureThreshold: 2})
+	f.standby = &clientState{}
+	down := errors.New("server selection timeout")
+
+	if f.observe(down, nil) {
+		t.Error("one failure must not switch")
+	}
+	if f.observe(nil, nil) || f.observe(down, nil) {
+		t.Error("a successful check resets the failures")
+	}
+	if f.observe(down, down) {
+		t.Error("an unreachable standby must not be switched to")
+	}
+	if !f.observe(down, nil) {
+		t.Error("expected a switch after consecutive failures with a healthy standby")
+	}
+}
+
+func TestSwitchoverSwapsClients(t *testing.T) {
+	p, primary := reloadTestPlugin(t)
+	standby, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = standby.Disconnect(context.Background()) })
+	p.failover, _ = newFailover(&conf.Failover{Uri: "mongodb://localhost:2", CheckInterval: durationpb.New(50 * time.Millisecond)})
+	p.failover.standby = newClientState(standby, "app")
+	active := p.loadState()
+
+	if !p.switchover(context.Background(), active, errors.New("primary down")) {
+		t.Fatal("expected a switchover")
+	}
+	if p.GetClient() != standby || p.ActiveCluster() != ClusterStandby || p.failover.standbyState().client != primary {
+		t.Errorf("expected the standby active and the primary kept as standby")
+	}
+	if p.switchover(context.Background(), active, nil) {
+		t.Error("a stale switchover must not swap clients back")
+	}
+
+	next := proto.Clone(p.config()).(*conf.MongoDB)
+	next.MaxPoolSize = 50
+	if result, err := p.reload(context.Background(), next); err == nil || result != reloadFailed {
+		t.Errorf("rebuild while switched over: %s, %v", result, err)
+	}
+
+	if err := p.Switchover(context.Background()); err == nil {
+		t.Error("expected switching to an unreachable standby to fail")
+	}
+	if p.GetClient() != standby {
+		t.Error("a failed switchover must keep the active client")
+	}
+}
@@ -0,0 +1,128 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// FieldMaskPaths returns the paths of a protobuf FieldMask
+func FieldMaskPaths(mask *fieldmaskpb.FieldMask) []string {
+	if mask == nil {
+		return nil
+	}
+	return mask.GetPaths()
+}
+
+// BuildFieldMaskUpdate builds an update touching only the masked paths of model.
+// Path segments may use BSON keys, Go field names, JSON names or snake_case proto names and are
+// resolved to dotted BSON paths. Masked fields holding nil (pointers, maps, slices) are $unset,
+// following FieldMask "clear" semantics; everything else is $set from model.
+func BuildFieldMaskUpdate(model any, paths []string) (bson.D, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("field mask cannot be empty")
+	}
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("model cannot be nil")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model must be a struct, got %s", v.Kind())
+	}
+
+	var set, unset bson.D
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		steps, err := resolveBSONPath(v.Type(), path)
+		if err != nil {
+			return nil, fmt.Errorf("field mask path %q: %w", path, err)
+		}
+		bsonPath := joinSteps(steps)
+		value := valueAtPath(v, steps)
+		if bsonPath == "_id" {
+			return nil, fmt.Errorf("field mask cannot update _id")
+		}
+		if seen[bsonPath] {
+			continue
+		}
+		seen[bsonPath] = true
+		if !value.IsValid() || isNilValue(value) {
+			unset = append(unset, bson.E{Key: bsonPath, Value: ""})
+			continue
+		}
+		set = append(set, bson.E{Key: bsonPath, Value: value.Interface()})
+	}
+	if err := checkPathConflicts(seen); err != nil {
+		return nil, err
+	}
+
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update, nil
+}
+
+// UpdateFields updates only the masked paths of the document with the given _id (within the context scope)
+func (p *PlugMongoDB) UpdateFields(ctx context.Context, collection string, id any, model any, paths []string) (*mongo.UpdateResult, error) {
+	update, err := BuildFieldMaskUpdate(model, paths)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := ScopeFilter(ctx, collection, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+	var result *mongo.UpdateResult
+	op := operation{name: "update", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.UpdateOne(ctx, filter, update, callUpdateOptions(ctx), commentUpdateOptions(ctx))
+		if err != nil {
+			return err
+		}
+		result = res
+		return nil
+	})
+	return result, err
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// checkPathConflicts rejects masks containing both a path and one of its parents,
+// which MongoDB refuses as conflicting update paths
+func checkPathConflicts(paths map[string]bool) error {
+	for path := range paths {
+		for i := strings.IndexByte(path, '.'); i >= 0; {
+			if paths[path[:i]] {
+				return fmt.Errorf("field mask paths %q and %q conflict", path[:i], path)
+			}
+			next := strings.IndexByte(path[i+1:], '.')
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+type maskProfile struct {
+	DisplayName string            `bson:"display_name" json:"displayName"`
+	Avatar      *string           `bson:"avatar,omitempty"`
+	Labels      map[string]string `bson:"labels"`
+}
+
+type maskUser struct {
+	ID      string       `bson:"_id"`
+	Email   string       `bson:"email_address"`
+	Profile *maskProfile `bson:"profile"`
+}
+
+func TestBuildFieldMaskUpdate(t *testing.T) {
+	user := &maskUser{
+		ID:      "u1",
+		Email:   "a@example.com",
+		Profile: &maskProfile{DisplayName: "A", Labels: map[string]string{"tier": "gold"}},
+	}
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"email", "profile.displayName", "profile.avatar", "profile.labels.tier"}}
+
+	update, err := BuildFieldMaskUpdate(user, FieldMaskPaths(mask))
+	if err != nil {
+		t.Fatalf("BuildFieldMaskUpdate: %v", err)
+	}
+	want := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "email_address", Value: "a@example.com"},
+			{Key: "profile.display_name", Value: "A"},
+			{Key: "profile.labels.tier", Value: "gold"},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "profile.avatar", Value: ""}}},
+	}
+	got, _ := bson.MarshalExtJSON(update, false, false)
+	exp, _ := bson.MarshalExtJSON(want, false, false)
+	if string(got) != string(exp) {
+		t.Errorf("got %s, want %s", got, exp)
+	}
+}
+
+func TestBuildFieldMaskUpdateErrors(t *testing.T) {
+	user := &maskUser{}
+	for _, paths := range [][]string{
+		nil,
+		{"unknown"},
+		{"id"},
+		{"email.domain"},
+		{"profile", "profile.display_name"},
+	} {
+		if _, err := BuildFieldMaskUpdate(user, paths); err == nil {
+			t.Errorf("expected error for paths %v", paths)
+		}
+	}
+
+	// Paths below a nil pointer resolve to $unset
+	update, err := BuildFieldMaskUpdate(user, []string{"profile.display_name"})
+	if err != nil {
+		t.Fatalf("BuildFieldMaskUpdate: %v", err)
+	}
+	if len(update) != 1 || update[0].Key != "$unset" {
+		t.Errorf("expected $unset, got %v", update)
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{"CreatedAt": "created_at", "UserID": "user_id", "HTTPServer": "http_server", "name": "name"} {
+		if got := toSnakeCase(in); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
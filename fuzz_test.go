@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The command monitors run on every request path, so they must tolerate any reply or command bytes
+
+func FuzzExtractDocumentsFromReply(f *testing.F) {
+	for _, doc := range []bson.D{
+		{{Key: "n", Value: int32(3)}, {Key: "ok", Value: 1}},
+		{{Key: "nModified", Value: int64(2)}},
+		{{Key: "cursor", Value: bson.D{{Key: "firstBatch", Value: bson.A{1, "a", bson.D{}}}}}},
+		{{Key: "cursor", Value: bson.D{{Key: "nextBatch", Value: bson.A{}}}}},
+		{{Key: "cursor", Value: "not a document"}},
+	} {
+		raw, _ := bson.Marshal(doc)
+		f.Add([]byte(raw))
+	}
+	f.Add([]byte{5, 0, 0, 0, 0})
+	f.Add([]byte{0xff, 0xff, 0xff, 0x7f, 3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_ = extractDocumentsFromReply(bson.Raw(data), "find")
+		_ = countArrayValues(bson.RawValue{Type: bson.TypeArray, Value: data})
+	})
+}
+
+func FuzzCommandInspection(f *testing.F) {
+	for _, doc := range []bson.D{
+		{{Key: "find", Value: "orders"}, {Key: "filter", Value: bson.D{{Key: "name", Value: primitive.Regex{Pattern: "abc"}}}}},
+		{{Key: "aggregate", Value: "orders"}, {Key: "pipeline", Value: bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: "$where", Value: "1"}}}}}}},
+		{{Key: "ping", Value: 1}},
+		{},
+	} {
+		raw, _ := bson.Marshal(doc)
+		f.Add([]byte(raw))
+	}
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cmd := bson.Raw(data)
+		_ = commandName(cmd)
+		_ = commandCollection(cmd)
+		_ = countUnanchoredRegex(cmd, 0)
+		var violations []QueryViolation
+		scanQueryDocument(cmd, "", scanDocument, false, 0, &violations)
+	})
+}
+
+func FuzzNormalizeConfig(f *testing.F) {
+	f.Add("mongodb://localhost:27017", "primary", "warn", "info", "myapp.*", 0.5)
+	f.Add("mongodb://user:pass@a:1,b:2/db?replicaSet=rs0&w=majority", "all", "block", "", "tenant_[", 1.0)
+	f.Add("mongodb+srv://cluster.example.com", "secondaries", "", "debug", "", 0.0)
+	f.Add("http://nope", "everyone", "loud", "trace", "[", math.NaN())
+	f.Fuzz(func(t *testing.T, uri, members, scanMode, driverLevel, pattern string, rate float64) {
+		p := NewMongoDBClient()
+		p.conf.Store(&conf.MongoDB{
+			Uri:                 uri,
+			HealthCheckMembers:  members,
+			QueryScanMode:       scanMode,
+			Debug:               &conf.Debug{DriverLogLevel: driverLevel},
+			HistogramSampleRate: rate,
+			MetricsNamespaces:   &conf.NamespaceFilter{Include: []string{pattern}},
+			MetricAliases:       []*conf.MetricAlias{{Metric: pattern, LegacyName: members}},
+		})
+		if err := p.normalizeConfig(); err != nil {
+			return
+		}
+		// An accepted config must be usable by the code paths reading it
+		if r := p.config().HistogramSampleRate; math.IsNaN(r) || r < 0 || r > 1 {
+			t.Errorf("accepted sample rate %v", r)
+		}
+		_ = p.metricsFilter().allowed("db", "coll")
+		_ = p.healthReadPref()
+	})
+}
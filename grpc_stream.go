@@ -0,0 +1,77 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ServerStream is the part of a gRPC server-streaming RPC stream used by SendCursor and SendFind.
+// Generated streams (grpc.ServerStreamingServer[Res]) implement it with M = *Res.
+type ServerStream[M any] interface {
+	Context() context.Context
+	Send(M) error
+}
+
+// SendCursor decodes every document of cursor into T (with the strict decoding and decode error
+// handling of the helpers), maps it to a message with mapFn and sends it on stream, one document at
+// a time. It stops when the stream context ends and returns the number of messages sent. The cursor
+// is not closed. Context errors are returned as is, for the RPC handler to map to a status.
+func SendCursor[T, M any](p *PlugMongoDB, collection string, cursor *mongo.Cursor, stream ServerStream[M], mapFn func(T) (M, error)) (int, error) {
+	n, _, err := sendCursor(p, collection, cursor, stream, mapFn)
+	return n, err
+}
+
+func sendCursor[T, M any](p *PlugMongoDB, collection string, cursor *mongo.Cursor, stream ServerStream[M], mapFn func(T) (M, error)) (int, resultSize, error) {
+	var size resultSize
+	if p == nil {
+		return 0, size, fmt.Errorf("mongodb plugin is nil")
+	}
+	ctx := stream.Context()
+	for cursor.Next(ctx) {
+		// Batches already fetched do not observe ctx
+		if err := ctx.Err(); err != nil {
+			return size.documents, size, err
+		}
+		var doc T
+		if err := p.decodeDocument(ctx, collection, cursor.Current, &doc); err != nil {
+			return size.documents, size, err
+		}
+		msg, err := mapFn(doc)
+		if err != nil {
+			return size.documents, size, err
+		}
+		if err := stream.Send(msg); err != nil {
+			return size.documents, size, err
+		}
+		size.add(cursor.Current)
+	}
+	if err := cursor.Err(); err != nil {
+		return size.documents, size, err
+	}
+	return size.documents, size, ctx.Err()
+}
+
+// SendFind runs a find on collection within the stream context and sends the results on stream
+// with SendCursor. Opening the cursor is bounded by operation_timeout; sending lasts as long as
+// the stream context.
+func SendFind[T, M any](p *PlugMongoDB, stream ServerStream[M], collection string, filter any, mapFn func(T) (M, error), findOpts ...*options.FindOptions) (int, error) {
+	if p == nil {
+		return 0, fmt.Errorf("mongodb plugin is nil")
+	}
+	ctx := stream.Context()
+	cursor, err := p.openFind(ctx, collection, filter, findOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = cursor.Close(context.WithoutCancel(ctx)) }()
+
+	n, size, err := sendCursor(p, collection, cursor, stream, mapFn)
+	if err != nil {
+		return n, fmt.Errorf("mongodb stream of %s.%s failed after %d messages: %w", p.databaseName(""), collection, n, err)
+	}
+	p.recordResultSize(collection, size)
+	return n, nil
+}
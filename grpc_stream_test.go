@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+type testStream struct {
+	ctx  context.Context
+	sent []*string
+	err  error
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func (s *testStream) Send(msg *string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+type streamDoc struct {
+	ID   int    `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func TestSendCursor(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	toMessage := func(d streamDoc) (*string, error) {
+		msg := fmt.Sprintf("%d:%s", d.ID, d.Name)
+		return &msg, nil
+	}
+
+	stream := &testStream{ctx: context.Background()}
+	n, err := SendCursor(p, "docs", testCursor(t, 3), stream, toMessage)
+	if err != nil || n != 3 || len(stream.sent) != 3 || *stream.sent[2] != "2:doc" {
+		t.Fatalf("SendCursor = %d, %v, sent %d", n, err, len(stream.sent))
+	}
+
+	sendErr := errors.New("client gone")
+	stream = &testStream{ctx: context.Background(), err: sendErr}
+	if _, err := SendCursor(p, "docs", testCursor(t, 1), stream, toMessage); !errors.Is(err, sendErr) {
+		t.Errorf("expected the send error, got %v", err)
+	}
+
+	mapErr := errors.New("unmappable")
+	stream = &testStream{ctx: context.Background()}
+	if _, err := SendCursor(p, "docs", testCursor(t, 1), stream, func(streamDoc) (*string, error) { return nil, mapErr }); !errors.Is(err, mapErr) {
+		t.Errorf("expected the map error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream = &testStream{ctx: ctx}
+	if n, err := SendCursor(p, "docs", testCursor(t, 3), stream, toMessage); !errors.Is(err, context.Canceled) || n != 0 {
+		t.Errorf("cancelled stream = %d, %v", n, err)
+	}
+
+	type strictDoc struct {
+		ID int `bson:"_id"`
+	}
+	stream = &testStream{ctx: WithStrictDecoding(context.Background())}
+	_, err = SendCursor(p, "docs", testCursor(t, 1), stream, func(strictDoc) (*string, error) { return new(string), nil })
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Collection != "docs" {
+		t.Errorf("expected a strict decode error, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Health states reported by HealthStatus
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+	// HealthDegraded is a reachable deployment breaching health_thresholds
+	HealthDegraded = "degraded"
+)
+
+// healthProbeTimeout bounds the hello command of a health probe
+const healthProbeTimeout = 5 * time.Second
+
+// HealthReport is the JSON body served by HealthHandler
+type HealthReport struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	// LatencyMs is the hello round trip in milliseconds
+	LatencyMs float64         `json:"latency_ms"`
+	Error     string          `json:"error,omitempty"`
+	Topology  *TopologyReport `json:"topology,omitempty"`
+	// ActiveConnections is the checked-out connection count (requires enable_metrics)
+	ActiveConnections *int64 `json:"active_connections,omitempty"`
+	// PoolUtilization is ActiveConnections as a percentage of max_pool_size (requires enable_metrics)
+	PoolUtilization *float64 `json:"pool_utilization,omitempty"`
+	// PrimaryReachable is true when a member accepting writes answers heartbeats or the probe
+	PrimaryReachable bool `json:"primary_reachable"`
+	// Degraded lists the breached health_thresholds
+	Degraded []string `json:"degraded,omitempty"`
+	// Ready is true when the status is up; Live is the Liveness result
+	Ready bool `json:"ready"`
+	Live  bool `json:"live"`
+	// Nodes is the per-member health from server monitoring
+	Nodes []NodeHealth `json:"nodes,omitempty"`
+}
+
+// TopologyReport summarizes the deployment as seen by the server answering hello
+type TopologyReport struct {
+	// Kind is standalone, replica_set or sharded
+	Kind            string   `json:"kind"`
+	SetName         string   `json:"set_name,omitempty"`
+	Primary         string   `json:"primary,omitempty"`
+	Me              string   `json:"me,omitempty"`
+	Hosts           []string `json:"hosts,omitempty"`
+	WritablePrimary bool     `json:"writable_primary"`
+}
+
+type helloReply struct {
+	SetName           string   `bson:"setName"`
+	Hosts             []string `bson:"hosts"`
+	Primary           string   `bson:"primary"`
+	Me                string   `bson:"me"`
+	IsWritablePrimary bool     `bson:"isWritablePrimary"`
+	Msg               string   `bson:"msg"`
+}
+
+// HealthStatus probes the server with a hello command and reports connection state,
+// latency, pool utilization, primary reachability and a topology summary. A reachable deployment
+// breaching health_thresholds is degraded. Probes are recorded in the health check metrics.
+func (p *PlugMongoDB) HealthStatus(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthDown, Database: p.databaseName("")}
+	report.Live = p.Liveness() == nil
+	client := p.GetClient()
+	if client == nil {
+		report.Error = "mongodb client is not initialized"
+		return report
+	}
+	if p.prometheusMetrics != nil {
+		active := p.activeConns()
+		report.ActiveConnections = &active
+	}
+	if util, ok := p.poolUtilization(); ok {
+		report.PoolUtilization = &util
+	}
+
+	ctx, cancel := p.createTimeoutContext(ctx, healthProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	var hello helloReply
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	latency := time.Since(start)
+	report.LatencyMs = float64(latency.Microseconds()) / 1000
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordHealthCheck(err == nil, p.config())
+	}
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	report.Nodes = p.NodeHealth()
+	report.PrimaryReachable = hello.IsWritablePrimary || hello.Msg == "isdbgrid" || primaryReachable(report.Nodes)
+	if err := p.checkTargetMembers(report.Nodes); err != nil {
+		report.Error = err.Error()
+	} else if report.Degraded = p.degradation(latency, report.PrimaryReachable); len(report.Degraded) > 0 {
+		report.Status = HealthDegraded
+	} else {
+		report.Status = HealthUp
+		report.Ready = true
+	}
+	report.Topology = &TopologyReport{
+		Kind:            "standalone",
+		SetName:         hello.SetName,
+		Primary:         hello.Primary,
+		Me:              hello.Me,
+		Hosts:           hello.Hosts,
+		WritablePrimary: hello.IsWritablePrimary,
+	}
+	switch {
+	case hello.Msg == "isdbgrid":
+		report.Topology.Kind = "sharded"
+	case hello.SetName != "":
+		report.Topology.Kind = "replica_set"
+	}
+	return report
+}
+
+// HealthHandler returns an http.Handler serving HealthStatus as JSON, with status 200 when
+// MongoDB is reachable within health_thresholds and 503 otherwise (down or degraded), for
+// platforms probing plain HTTP endpoints:
+//
+//	mux.Handle("/healthz/mongodb", plugin.HealthHandler())
+func (p *PlugMongoDB) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := p.HealthStatus(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != HealthUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if r.Method != http.MethodHead {
+			_ = json.NewEncoder(w).Encode(report)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandlerWithoutClient(t *testing.T) {
+	p := NewMongoDBClient()
+	rec := httptest.NewRecorder()
+	p.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz/mongodb", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+	var report HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != HealthDown || report.Error == "" || report.Topology != nil {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,147 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx/plugins"
+)
+
+// Lynx plugin health statuses returned by GetHealth
+const (
+	pluginHealthy   = "healthy"
+	pluginDegraded  = "degraded"
+	pluginUnhealthy = "unhealthy"
+)
+
+// poolUtilization returns the checked-out percentage of max_pool_size; ok is false when the
+// checked-out count is not tracked (enable_metrics off)
+func (p *PlugMongoDB) poolUtilization() (float64, bool) {
+	if p.prometheusMetrics == nil || p.config().GetMaxPoolSize() == 0 {
+		return 0, false
+	}
+	active := p.activeConns()
+	return float64(active) / float64(p.config().GetMaxPoolSize()) * 100, true
+}
+
+// primaryReachable reports whether server monitoring reaches a member accepting writes
+func primaryReachable(nodes []NodeHealth) bool {
+	for _, n := range nodes {
+		if n.Healthy && (n.Role == RolePrimary || n.Role == RoleStandalone || n.Role == RoleMongos) {
+			return true
+		}
+	}
+	return false
+}
+
+// degradation returns why a reachable deployment breaches health_thresholds, or nil
+func (p *PlugMongoDB) degradation(latency time.Duration, primary bool) []string {
+	cfg := p.config().GetHealthThresholds()
+	var reasons []string
+	if maxLatency := cfg.GetMaxPingLatency().AsDuration(); maxLatency > 0 && latency > maxLatency {
+		reasons = append(reasons, fmt.Sprintf("ping latency %v above %v", latency.Round(time.Microsecond), maxLatency))
+	}
+	if maxUtil := cfg.GetMaxPoolUtilization(); maxUtil > 0 {
+		if util, ok := p.poolUtilization(); ok && util > maxUtil {
+			reasons = append(reasons, fmt.Sprintf("pool utilization %.0f%% above %.0f%%", util, maxUtil))
+		}
+	}
+	if cfg.GetRequirePrimary() && !primary {
+		reasons = append(reasons, "no reachable primary")
+	}
+	return reasons
+}
+
+// Readiness probes the server like CheckHealth: it fails when MongoDB is unreachable, a member
+// targeted by health_check_members is unhealthy, or a health_thresholds bound is breached, so
+// load balancers can drain the instance
+func (p *PlugMongoDB) Readiness(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.checkHealthContext(ctx)
+}
+
+// Liveness reports whether the plugin is functional without contacting the server: it fails when
+// the client is not initialized, or after health_thresholds.liveness_failures consecutive failed
+// health checks (from the background health check or Readiness calls)
+func (p *PlugMongoDB) Liveness() error {
+	if p.GetClient() == nil {
+		return errClientNotInitialized
+	}
+	limit := int(p.config().GetHealthThresholds().GetLivenessFailures())
+	if limit <= 0 {
+		return nil
+	}
+	p.health.mu.Lock()
+	failures, lastErr := p.health.failures, p.health.lastErr
+	p.health.mu.Unlock()
+	if failures >= limit {
+		return fmt.Errorf("mongodb health check failed %d times in a row: %w", failures, lastErr)
+	}
+	return nil
+}
+
+// GetHealth implements the Lynx plugin health interface with HealthStatus: healthy, degraded
+// (reachable but breaching health_thresholds) or unhealthy
+func (p *PlugMongoDB) GetHealth() plugins.HealthReport {
+	report := p.HealthStatus(context.Background())
+	out := plugins.HealthReport{
+		Status:    pluginUnhealthy,
+		Message:   report.Error,
+		Timestamp: time.Now().Unix(),
+		Details: map[string]any{
+			"database":          report.Database,
+			"latency_ms":        report.LatencyMs,
+			"primary_reachable": report.PrimaryReachable,
+			"ready":             report.Ready,
+			"live":              report.Live,
+		},
+	}
+	switch report.Status {
+	case HealthUp:
+		out.Status = pluginHealthy
+	case HealthDegraded:
+		out.Status = pluginDegraded
+		out.Message = strings.Join(report.Degraded, "; ")
+	}
+	if report.PoolUtilization != nil {
+		out.Details["pool_utilization"] = *report.PoolUtilization
+	}
+	if report.Topology != nil {
+		out.Details["topology"] = report.Topology.Kind
+	}
+	return out
+}
+
+// ReadinessHandler returns an http.Handler for readiness probes: 200 when Readiness passes, 503
+// with the reason otherwise
+func (p *PlugMongoDB) ReadinessHandler() http.Handler {
+	return probeHandler(func(r *http.Request) error { return p.Readiness(r.Context()) })
+}
+
+// LivenessHandler returns an http.Handler for liveness probes: 200 when Liveness passes, 503 with
+// the reason otherwise. It never contacts the server.
+func (p *PlugMongoDB) LivenessHandler() http.Handler {
+	return probeHandler(func(*http.Request) error { return p.Liveness() })
+}
+
+// probeHandler serves {"status":"up"} or {"status":"down","error":...} with status 200 or 503
+func probeHandler(check func(r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{"status": HealthUp}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := check(r); err != nil {
+			body = map[string]string{"status": HealthDown, "error": err.Error()}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if r.Method != http.MethodHead {
+			_ = json.NewEncoder(w).Encode(body)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestHealthDegradation(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", MaxPoolSize: 10})
+	if reasons := p.degradation(time.Second, false); reasons != nil {
+		t.Errorf("expected no degradation without thresholds, got %v", reasons)
+	}
+
+	WithHealthThresholds(100*time.Millisecond, 80, true)(p)
+	if reasons := p.degradation(10*time.Millisecond, true); reasons != nil {
+		t.Errorf("expected no degradation within thresholds, got %v", reasons)
+	}
+	reasons := p.degradation(200*time.Millisecond, false)
+	if len(reasons) != 2 || !strings.Contains(reasons[0], "ping latency") || reasons[1] != "no reachable primary" {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+
+	// Pool utilization is only known with metrics
+	p.swapState(&clientState{monitor: &clientMonitor{activeConns: 9}})
+	if reasons := p.degradation(0, true); reasons != nil {
+		t.Errorf("expected pool utilization to be ignored without metrics, got %v", reasons)
+	}
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	if reasons := p.degradation(0, true); len(reasons) != 1 || reasons[0] != "pool utilization 90% above 80%" {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+}
+
+func TestPrimaryReachable(t *testing.T) {
+	if primaryReachable([]NodeHealth{{Role: RoleSecondary, Healthy: true}, {Role: RolePrimary}}) {
+		t.Error("an unreachable primary is not reachable")
+	}
+	if !primaryReachable([]NodeHealth{{Role: RoleSecondary, Healthy: true}, {Role: RolePrimary, Healthy: true}}) {
+		t.Error("expected the primary to be reachable")
+	}
+	if !primaryReachable([]NodeHealth{{Role: RoleMongos, Healthy: true}}) {
+		t.Error("expected a mongos to accept writes")
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	if err := p.Liveness(); err == nil {
+		t.Error("expected liveness to fail without client")
+	}
+	if got := p.GetHealth(); got.Status != pluginUnhealthy || got.Message == "" {
+		t.Errorf("unexpected plugin health %+v", got)
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	for range 3 {
+		p.observeHealth(errors.New("connection refused"))
+	}
+	if err := p.Liveness(); err != nil {
+		t.Errorf("expected liveness to ignore server failures by default, got %v", err)
+	}
+	WithLivenessFailures(3)(p)
+	if err := p.Liveness(); err == nil || !strings.Contains(err.Error(), "3 times in a row") {
+		t.Errorf("expected liveness to fail after 3 failures, got %v", err)
+	}
+	p.observeHealth(nil)
+	if err := p.Liveness(); err != nil {
+		t.Errorf("expected a successful check to reset liveness, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	p.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("liveness: expected 200, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	p.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"down"`) {
+		t.Errorf("readiness: expected 503 without server, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,374 @@
+package mongodb
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"hash/maphash"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	// hotSketchDepth and hotSketchWidth size the count-min sketches (4 x 4096 counters each)
+	hotSketchDepth = 4
+	hotSketchWidth = 4096
+	// defaultHotTopK is the report size when hot_documents.top_k is unset
+	defaultHotTopK = 20
+	// hotCandidateFactor is the number of tracked candidates per reported document
+	hotCandidateFactor = 4
+	// defaultHotDecayInterval is the count halving interval when hot_documents.decay_interval is unset
+	defaultHotDecayInterval = 5 * time.Minute
+)
+
+// HotDocument is a frequently accessed document; counts are count-min estimates (never lower than
+// the real count) of the recent, decayed traffic
+type HotDocument struct {
+	Collection string `json:"collection"`
+	// Key holds the key field values, e.g. `_id: ObjectId("...")` or `tenant: "t1", user: 42`
+	Key    string `json:"key"`
+	Count  uint64 `json:"count"`
+	Writes uint64 `json:"writes"`
+}
+
+// countMinSketch estimates key frequencies in fixed memory
+type countMinSketch struct {
+	seeds [hotSketchDepth]maphash.Seed
+	rows  [hotSketchDepth][hotSketchWidth]uint32
+}
+
+func newCountMinSketch() *countMinSketch {
+	s := &countMinSketch{}
+	for i := range s.seeds {
+		s.seeds[i] = maphash.MakeSeed()
+	}
+	return s
+}
+
+func (s *countMinSketch) slots(key string) [hotSketchDepth]int {
+	var slots [hotSketchDepth]int
+	for i, seed := range s.seeds {
+		slots[i] = int(maphash.String(seed, key) % hotSketchWidth)
+	}
+	return slots
+}
+
+// add counts key with a conservative update (only the minimal counters grow) and returns its estimate
+func (s *countMinSketch) add(key string) uint32 {
+	slots := s.slots(key)
+	estimate := s.min(slots)
+	if estimate == ^uint32(0) {
+		return estimate
+	}
+	for i, slot := range slots {
+		if s.rows[i][slot] == estimate {
+			s.rows[i][slot]++
+		}
+	}
+	return estimate + 1
+}
+
+func (s *countMinSketch) estimate(key string) uint32 {
+	return s.min(s.slots(key))
+}
+
+func (s *countMinSketch) min(slots [hotSketchDepth]int) uint32 {
+	estimate := ^uint32(0)
+	for i, slot := range slots {
+		estimate = min(estimate, s.rows[i][slot])
+	}
+	return estimate
+}
+
+func (s *countMinSketch) halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+// hotDocuments tracks the most frequent document keys: sketches count every key, and a bounded
+// candidate set keeps the keys with the highest estimates for the report
+type hotDocuments struct {
+	keyFields   []string
+	collections map[string]bool
+	topK        int
+	decay       time.Duration
+
+	mu     sync.Mutex
+	total  *countMinSketch
+	writes *countMinSketch
+	// candidates by collection + "\x00" + key; at most topK*hotCandidateFactor entries
+	candidates map[string]*HotDocument
+	// minCount is a lower bound of the candidate counts, to skip scans for cold keys
+	minCount uint64
+}
+
+// newHotDocuments returns the hot document tracker, or nil when hot_documents is disabled
+func newHotDocuments(cfg *conf.HotDocuments) *hotDocuments {
+	if !cfg.GetEnabled() {
+		return nil
+	}
+	h := &hotDocuments{
+		keyFields:  cfg.GetKeyFields(),
+		topK:       int(cfg.GetTopK()),
+		decay:      cfg.GetDecayInterval().AsDuration(),
+		total:      newCountMinSketch(),
+		writes:     newCountMinSketch(),
+		candidates: make(map[string]*HotDocument),
+	}
+	if len(h.keyFields) == 0 {
+		h.keyFields = []string{"_id"}
+	}
+	if h.topK <= 0 {
+		h.topK = defaultHotTopK
+	}
+	if h.decay <= 0 {
+		h.decay = defaultHotDecayInterval
+	}
+	if len(cfg.GetCollections()) > 0 {
+		h.collections = make(map[string]bool, len(cfg.GetCollections()))
+		for _, c := range cfg.GetCollections() {
+			h.collections[c] = true
+		}
+	}
+	return h
+}
+
+// observe counts an access to the document key of collection
+func (h *hotDocuments) observe(collection, key string, write bool) {
+	id := collection + "\x00" + key
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	count := uint64(h.total.add(id))
+	var writes uint64
+	if write {
+		writes = uint64(h.writes.add(id))
+	} else {
+		writes = uint64(h.writes.estimate(id))
+	}
+	if c, ok := h.candidates[id]; ok {
+		c.Count, c.Writes = count, writes
+		return
+	}
+	if len(h.candidates) >= h.topK*hotCandidateFactor {
+		if count <= h.minCount {
+			return
+		}
+		coldest, coldestCount := "", uint64(0)
+		for cid, c := range h.candidates {
+			if coldest == "" || c.Count < coldestCount {
+				coldest, coldestCount = cid, c.Count
+			}
+		}
+		h.minCount = coldestCount
+		if count <= coldestCount {
+			return
+		}
+		delete(h.candidates, coldest)
+	}
+	h.candidates[id] = &HotDocument{Collection: collection, Key: key, Count: count, Writes: writes}
+}
+
+// decayCounts halves every count and forgets candidates that went cold
+func (h *hotDocuments) decayCounts() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.total.halve()
+	h.writes.halve()
+	for id, c := range h.candidates {
+		c.Count >>= 1
+		c.Writes >>= 1
+		if c.Count == 0 {
+			delete(h.candidates, id)
+		}
+	}
+	h.minCount >>= 1
+}
+
+// report returns up to limit candidates, hottest first
+func (h *hotDocuments) report(limit int) []HotDocument {
+	if limit <= 0 || limit > h.topK {
+		limit = h.topK
+	}
+	h.mu.Lock()
+	docs := make([]HotDocument, 0, len(h.candidates))
+	for _, c := range h.candidates {
+		docs = append(docs, *c)
+	}
+	h.mu.Unlock()
+	slices.SortFunc(docs, func(a, b HotDocument) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Or(strings.Compare(a.Collection, b.Collection), strings.Compare(a.Key, b.Key))
+	})
+	return docs[:min(limit, len(docs))]
+}
+
+// documentKey returns the key field values a filter matches by equality, or "" when a key field
+// is missing or matched with an operator other than $eq
+func documentKey(filter bson.Raw, keyFields []string) string {
+	var b strings.Builder
+	for i, field := range keyFields {
+		v, err := filter.LookupErr(field)
+		if err != nil {
+			return ""
+		}
+		if v.Type == bsontype.EmbeddedDocument {
+			doc := v.Document()
+			first, err := doc.IndexErr(0)
+			if err == nil && strings.HasPrefix(first.Key(), "$") {
+				elems, _ := doc.Elements()
+				if len(elems) != 1 || first.Key() != "$eq" {
+					return ""
+				}
+				v = first.Value()
+			}
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(field)
+		b.WriteString(": ")
+		b.WriteString(documentKeyValue(v))
+	}
+	return b.String()
+}
+
+// documentKeyValue formats a key value so equal keys sent with different numeric types share a counter
+func documentKeyValue(v bson.RawValue) string {
+	switch v.Type {
+	case bsontype.String:
+		return strconv.Quote(v.StringValue())
+	case bsontype.Int32:
+		return strconv.FormatInt(int64(v.Int32()), 10)
+	case bsontype.Int64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case bsontype.Double:
+		return strconv.FormatFloat(v.Double(), 'g', -1, 64)
+	case bsontype.ObjectID:
+		return `ObjectId("` + v.ObjectID().Hex() + `")`
+	}
+	return v.String()
+}
+
+// commandFilters returns the filters of a find, update, delete or findAndModify command and
+// whether the command writes
+func commandFilters(name string, cmd bson.Raw) ([]bson.Raw, bool) {
+	switch name {
+	case "find":
+		filter, ok := cmd.Lookup("filter").DocumentOK()
+		if !ok {
+			return nil, false
+		}
+		return []bson.Raw{filter}, false
+	case "findAndModify":
+		query, ok := cmd.Lookup("query").DocumentOK()
+		if !ok {
+			return nil, true
+		}
+		return []bson.Raw{query}, true
+	case "update", "delete":
+		statements, ok := cmd.Lookup(name + "s").ArrayOK()
+		if !ok {
+			return nil, true
+		}
+		values, _ := statements.Values()
+		filters := make([]bson.Raw, 0, len(values))
+		for _, v := range values {
+			if stmt, ok := v.DocumentOK(); ok {
+				if q, ok := stmt.Lookup("q").DocumentOK(); ok {
+					filters = append(filters, q)
+				}
+			}
+		}
+		return filters, true
+	}
+	return nil, false
+}
+
+// createHotDocumentMonitor returns a CommandMonitor counting the document keys of find, update,
+// delete and findAndModify filters; it returns nil when hot_documents is disabled
+func (p *PlugMongoDB) createHotDocumentMonitor() *event.CommandMonitor {
+	h := p.hotDocs
+	if h == nil {
+		return nil
+	}
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			filters, write := commandFilters(evt.CommandName, evt.Command)
+			if len(filters) == 0 {
+				return
+			}
+			collection := commandCollection(evt.Command)
+			if h.collections != nil && !h.collections[collection] {
+				return
+			}
+			for _, filter := range filters {
+				if key := documentKey(filter, h.keyFields); key != "" {
+					h.observe(collection, key, write)
+				}
+			}
+		},
+	}
+}
+
+// startHotDocumentDecay starts halving the hot document counts
+func (p *PlugMongoDB) startHotDocumentDecay() {
+	if h := p.hotDocs; h != nil {
+		p.startPeriodicTask("hot_documents_decay", h.decay, func(context.Context) {
+			h.decayCounts()
+		})
+	}
+}
+
+// HotDocuments returns up to limit of the most frequently accessed documents, hottest first
+// (limit <= 0 returns hot_documents.top_k); it returns nil when hot_documents is disabled
+func (p *PlugMongoDB) HotDocuments(limit int) []HotDocument {
+	if p.hotDocs == nil {
+		return nil
+	}
+	return p.hotDocs.report(limit)
+}
+
+// HotDocumentsHandler returns an admin http.Handler serving the hot document report as JSON; the
+// optional limit query parameter bounds its length. Mount it behind the application's admin
+// authentication: keys contain document values.
+func (p *PlugMongoDB) HotDocumentsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if p.hotDocs == nil {
+			http.Error(w, "hot_documents is not enabled", http.StatusNotFound)
+			return
+		}
+		limit := 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid limit: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"decay_interval": p.hotDocs.decay.String(),
+			"documents":      p.HotDocuments(limit),
+		})
+	})
+}
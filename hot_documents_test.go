@@ -0,0 +1,135 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch()
+	for i := range 1000 {
+		s.add(fmt.Sprint("cold-", i))
+	}
+	for range 50 {
+		s.add("hot")
+	}
+	if got := s.estimate("hot"); got < 50 || got > 55 {
+		t.Errorf("estimate(hot) = %d, want about 50", got)
+	}
+	s.halve()
+	if got := s.estimate("hot"); got < 25 || got > 28 {
+		t.Errorf("estimate(hot) after halving = %d, want about 25", got)
+	}
+}
+
+func TestDocumentKey(t *testing.T) {
+	raw := func(d bson.D) bson.Raw {
+		b, err := bson.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	for _, tc := range []struct {
+		filter bson.D
+		fields []string
+		want   string
+	}{
+		{bson.D{{Key: "_id", Value: 7}, {Key: "status", Value: "open"}}, []string{"_id"}, `_id: 7`},
+		{bson.D{{Key: "_id", Value: bson.D{{Key: "$eq", Value: "a"}}}}, []string{"_id"}, `_id: "a"`},
+		{bson.D{{Key: "tenant", Value: "t1"}, {Key: "order.id", Value: 3}}, []string{"tenant", "order.id"}, `tenant: "t1", order.id: 3`},
+		{bson.D{{Key: "_id", Value: int64(7)}}, []string{"_id"}, `_id: 7`},
+		{bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A{1, 2}}}}}, []string{"_id"}, ""},
+		{bson.D{{Key: "_id", Value: bson.D{{Key: "$eq", Value: 1}, {Key: "$ne", Value: 2}}}}, []string{"_id"}, ""},
+		{bson.D{{Key: "tenant", Value: "t1"}}, []string{"tenant", "user"}, ""},
+	} {
+		if got := documentKey(raw(tc.filter), tc.fields); got != tc.want {
+			t.Errorf("documentKey(%v, %v) = %q, want %q", tc.filter, tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestHotDocumentsTopK(t *testing.T) {
+	h := newHotDocuments(&conf.HotDocuments{Enabled: true, TopK: 2})
+	for i := range 200 {
+		h.observe("orders", fmt.Sprint("_id: ", i), false)
+	}
+	for range 30 {
+		h.observe("orders", "_id: 1", true)
+		h.observe("carts", "_id: 9", false)
+	}
+	report := h.report(0)
+	if len(report) != 2 || report[0].Key != "_id: 1" || report[1].Collection != "carts" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report[0].Count < 31 || report[0].Writes < 30 || report[1].Writes != 0 {
+		t.Errorf("unexpected counts: %+v", report)
+	}
+	if len(h.candidates) > 2*hotCandidateFactor {
+		t.Errorf("tracked %d candidates, want at most %d", len(h.candidates), 2*hotCandidateFactor)
+	}
+	if got := h.report(1); len(got) != 1 {
+		t.Errorf("report(1) returned %d documents", len(got))
+	}
+
+	for range 6 {
+		h.decayCounts()
+	}
+	if got := h.report(0); len(got) != 0 {
+		t.Errorf("expected decayed documents to be forgotten, got %+v", got)
+	}
+}
+
+func TestHotDocumentMonitor(t *testing.T) {
+	p := NewMongoDBClient()
+	if p.createHotDocumentMonitor() != nil || p.HotDocuments(0) != nil {
+		t.Error("expected no monitor when hot_documents is disabled")
+	}
+	p.hotDocs = newHotDocuments(&conf.HotDocuments{Enabled: true, Collections: []string{"orders"}})
+	m := p.createHotDocumentMonitor()
+	started := func(name string, cmd bson.D) {
+		b, err := bson.Marshal(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Started(context.Background(), &event.CommandStartedEvent{CommandName: name, Command: b})
+	}
+	started("find", bson.D{{Key: "find", Value: "orders"}, {Key: "filter", Value: bson.D{{Key: "_id", Value: 1}}}})
+	started("update", bson.D{{Key: "update", Value: "orders"}, {Key: "updates", Value: bson.A{
+		bson.D{{Key: "q", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "u", Value: bson.D{{Key: "$inc", Value: bson.D{{Key: "n", Value: 1}}}}}},
+		bson.D{{Key: "q", Value: bson.D{{Key: "_id", Value: 2}}}, {Key: "u", Value: bson.D{}}},
+	}}})
+	started("findAndModify", bson.D{{Key: "findAndModify", Value: "orders"}, {Key: "query", Value: bson.D{{Key: "_id", Value: 1}}}})
+	started("find", bson.D{{Key: "find", Value: "carts"}, {Key: "filter", Value: bson.D{{Key: "_id", Value: 1}}}})
+	started("insert", bson.D{{Key: "insert", Value: "orders"}})
+
+	report := p.HotDocuments(0)
+	if len(report) != 2 || report[0].Key != "_id: 1" || report[0].Count != 3 || report[0].Writes != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	rec := httptest.NewRecorder()
+	p.HotDocumentsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/mongodb/hot?limit=1", nil))
+	var body struct {
+		Documents []HotDocument `json:"documents"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %v", rec.Code, err)
+	}
+	if len(body.Documents) != 1 || body.Documents[0].Collection != "orders" {
+		t.Errorf("unexpected documents: %+v", body.Documents)
+	}
+	rec = httptest.NewRecorder()
+	p.HotDocumentsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/mongodb/hot?limit=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit: status %d, want 400", rec.Code)
+	}
+}
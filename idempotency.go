@@ -0,0 +1,63 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+)
+
+// Idempotency classifies an operation for the subsystems replaying failed or held operations: the
+// transient error retries, throttle retries and the write buffer of primary elections
+type Idempotency int
+
+// Idempotency classes; the zero value is IdempotencyUnknown
+const (
+	// IdempotencyUnknown operations are replayed only after failures proving the server did not
+	// apply them
+	IdempotencyUnknown Idempotency = iota
+	// Idempotent operations apply the same result when run twice, such as upserts by a natural key
+	// or $set updates; they are also replayed after failures that may have applied them
+	Idempotent
+	// NonIdempotent operations, such as $inc updates or inserts with a server-generated _id, fail
+	// fast: the plugin never retries, holds or replays them
+	NonIdempotent
+)
+
+func (i Idempotency) String() string {
+	switch i {
+	case IdempotencyUnknown:
+		return "unknown"
+	case Idempotent:
+		return "idempotent"
+	case NonIdempotent:
+		return "non_idempotent"
+	}
+	return fmt.Sprintf("idempotency(%d)", int(i))
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotency classifies the operations issued with the returned context. It takes precedence
+// over CallOptions.Idempotency.
+//
+//	ctx = mongodb.WithIdempotency(ctx, mongodb.Idempotent)
+func WithIdempotency(ctx context.Context, class Idempotency) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, idempotencyKey{}, class)
+}
+
+// IdempotencyFrom returns the class set with WithIdempotency or the call options, or
+// IdempotencyUnknown
+func IdempotencyFrom(ctx context.Context) Idempotency {
+	if ctx == nil {
+		return IdempotencyUnknown
+	}
+	if class, ok := ctx.Value(idempotencyKey{}).(Idempotency); ok {
+		return class
+	}
+	if opts, ok := callOptions(ctx); ok {
+		return opts.Idempotency
+	}
+	return IdempotencyUnknown
+}
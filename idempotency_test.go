@@ -0,0 +1,24 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIdempotencyFrom(t *testing.T) {
+	ctx := context.Background()
+	if got := IdempotencyFrom(ctx); got != IdempotencyUnknown {
+		t.Errorf("default = %s", got)
+	}
+	ctx = WithCallOptions(ctx, CallOptions{Idempotency: Idempotent})
+	if got := IdempotencyFrom(ctx); got != Idempotent {
+		t.Errorf("call options = %s", got)
+	}
+	ctx = WithIdempotency(ctx, NonIdempotent)
+	if got := IdempotencyFrom(ctx); got != NonIdempotent {
+		t.Errorf("the context value should win over call options, got %s", got)
+	}
+	if NonIdempotent.String() != "non_idempotent" || Idempotency(7).String() != "idempotency(7)" {
+		t.Error("unexpected class names")
+	}
+}
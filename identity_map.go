@@ -0,0 +1,196 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Identity map events, as reported in the identity map metric
+const (
+	identityHit     = "hit"
+	identityMiss    = "miss"
+	identityFlushed = "flushed"
+	identityClean   = "clean"
+)
+
+// trackedDocument is a document loaded through the identity map of a unit of work
+type trackedDocument struct {
+	collection string
+	id         any
+	// doc is the instance returned to the callers, a pointer to the decoded document
+	doc any
+	// snapshot is the encoding of doc when it was loaded, compared with doc on commit
+	snapshot bson.Raw
+}
+
+// identityKey returns the identity map key of the document of collection with _id id. Ids are
+// compared by their BSON encoding, so an ObjectID and its hex string are different documents.
+func (u *UnitOfWork) identityKey(collection string, id any) (string, error) {
+	raw, err := u.p.marshal(bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode _id: %w", err)
+	}
+	return collection + "\x00" + string(raw), nil
+}
+
+// lookup returns the tracked instance of key
+func (u *UnitOfWork) lookup(key string) (any, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	t, ok := u.tracked[key]
+	if !ok {
+		return nil, false
+	}
+	return t.doc, true
+}
+
+// track starts tracking doc, just loaded, under key and returns the instance to hand out: doc, or
+// the instance tracked meanwhile by a concurrent load. A closed unit of work does not track.
+func (u *UnitOfWork) track(key, collection string, id, doc any) (any, error) {
+	snapshot, err := u.p.marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot tracked document: %w", err)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return doc, nil
+	}
+	if t, ok := u.tracked[key]; ok {
+		return t.doc, nil
+	}
+	if u.tracked == nil {
+		u.tracked = make(map[string]*trackedDocument)
+	}
+	t := &trackedDocument{collection: collection, id: id, doc: doc, snapshot: snapshot}
+	u.tracked[key] = t
+	u.trackOrder = append(u.trackOrder, t)
+	return doc, nil
+}
+
+// Detach stops tracking doc, an instance returned by Repository.FindByID: its changes are no longer
+// written on Commit. It reports whether doc was tracked.
+func (u *UnitOfWork) Detach(doc any) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for key, t := range u.tracked {
+		if t.doc == doc {
+			delete(u.tracked, key)
+			u.untrack(t)
+			return true
+		}
+	}
+	return false
+}
+
+// detachID stops tracking the document of collection with _id id
+func (u *UnitOfWork) detachID(collection string, id any) {
+	key, err := u.identityKey(collection, id)
+	if err != nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if t, ok := u.tracked[key]; ok {
+		delete(u.tracked, key)
+		u.untrack(t)
+	}
+}
+
+// untrack removes t from the flush order. The caller holds u.mu.
+func (u *UnitOfWork) untrack(t *trackedDocument) {
+	for i, tracked := range u.trackOrder {
+		if tracked == t {
+			u.trackOrder = append(u.trackOrder[:i], u.trackOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// Tracked returns the number of documents tracked by the identity map
+func (u *UnitOfWork) Tracked() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.trackOrder)
+}
+
+// dirtyWrites compares the tracked documents with their snapshots and returns one update per changed
+// document, setting and unsetting only the changed fields, in loading order, and the collection of
+// each unchanged document. The caller holds u.mu.
+func (u *UnitOfWork) dirtyWrites() ([]stagedWrite, []string, error) {
+	var writes []stagedWrite
+	var clean []string
+	for _, t := range u.trackOrder {
+		current, err := u.p.marshal(t.doc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode tracked document of %s: %w", t.collection, err)
+		}
+		diff, err := DiffDocuments(t.snapshot, current)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to diff tracked document of %s: %w", t.collection, err)
+		}
+		if diff.IsEmpty() {
+			clean = append(clean, t.collection)
+			continue
+		}
+		model := mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: t.id}}).SetUpdate(diff.Update())
+		writes = append(writes, stagedWrite{collection: t.collection, model: model})
+	}
+	return writes, clean, nil
+}
+
+// recordCommitted counts the tracked documents of a committed unit of work as flushed or clean;
+// a failed commit flushed nothing
+func (u *UnitOfWork) recordCommitted(dirty []stagedWrite, clean []string) {
+	for _, w := range dirty {
+		u.recordIdentity(w.collection, identityFlushed)
+	}
+	for _, collection := range clean {
+		u.recordIdentity(collection, identityClean)
+	}
+}
+
+func (u *UnitOfWork) recordIdentity(collection, result string) {
+	if name, ok := u.p.metricsCollection(u.p.databaseName(""), collection); ok {
+		u.p.prometheusMetrics.RecordIdentityMap(u.p.config(), name, result, 1)
+	}
+}
+
+// findTracked reads the document of collection with _id id through the identity map of the unit of
+// work of ctx: the first read loads and tracks it, and the next ones return the same instance
+// without a round trip. Without a unit of work, it is a plain read. Instances tracked as another
+// type than T are not shared: the read then returns an untracked copy.
+func findTracked[T any](ctx context.Context, r *Repository[T], id any) (*T, error) {
+	filter := bson.D{{Key: "_id", Value: id}}
+	u, ok := UnitOfWorkFrom(ctx)
+	if !ok {
+		return r.FindOne(ctx, filter)
+	}
+	key, err := u.identityKey(r.collection, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc, ok := u.lookup(key); ok {
+		if tracked, ok := doc.(*T); ok {
+			u.recordIdentity(r.collection, identityHit)
+			return tracked, nil
+		}
+		return r.FindOne(ctx, filter)
+	}
+	u.recordIdentity(r.collection, identityMiss)
+	doc, err := r.FindOne(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := u.track(key, r.collection, id, doc)
+	if err != nil {
+		return nil, err
+	}
+	if tracked, ok := shared.(*T); ok {
+		return tracked, nil
+	}
+	return doc, nil
+}
@@ -0,0 +1,111 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type trackedOrder struct {
+	ID     int    `bson:"_id"`
+	Status string `bson:"status"`
+	Note   string `bson:"note,omitempty"`
+}
+
+func TestIdentityMapFindByID(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	orders := NewRepository[trackedOrder](p, "orders")
+	u := p.NewUnitOfWork()
+	ctx := WithUnitOfWork(t.Context(), u)
+
+	if _, err := orders.FindByID(ctx, 1); !errors.Is(err, errClientNotInitialized) {
+		t.Fatalf("FindByID without client = %v", err)
+	}
+	if u.Tracked() != 0 {
+		t.Error("a failed read should not be tracked")
+	}
+
+	key, err := u.identityKey("orders", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &trackedOrder{ID: 1, Status: "new"}
+	if _, err := u.track(key, "orders", 1, loaded); err != nil {
+		t.Fatal(err)
+	}
+	got, err := orders.FindByID(ctx, 1)
+	if err != nil || got != loaded {
+		t.Fatalf("FindByID = %p, %v, want the tracked instance %p", got, err, loaded)
+	}
+	if shared, _ := u.track(key, "orders", 1, &trackedOrder{ID: 1}); shared != loaded {
+		t.Error("a concurrent load should return the instance tracked first")
+	}
+	if _, err := NewRepository[bson.M](p, "orders").FindByID(ctx, 1); !errors.Is(err, errClientNotInitialized) {
+		t.Errorf("an instance of another type should not be shared: %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.identityMap.WithLabelValues("test", "orders", identityHit)); got != 1 {
+		t.Errorf("identity map hits = %v", got)
+	}
+
+	if !u.Detach(loaded) || u.Detach(loaded) || u.Tracked() != 0 {
+		t.Error("Detach should stop tracking the instance once")
+	}
+}
+
+func TestIdentityMapDirtyWrites(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	u := p.NewUnitOfWork()
+	changed := &trackedOrder{ID: 1, Status: "new", Note: "gift"}
+	unchanged := &trackedOrder{ID: 2, Status: "new"}
+	for _, doc := range []*trackedOrder{changed, unchanged} {
+		key, _ := u.identityKey("orders", doc.ID)
+		if _, err := u.track(key, "orders", doc.ID, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed.Status, changed.Note = "paid", ""
+
+	writes, clean, err := u.dirtyWrites()
+	if err != nil || len(writes) != 1 || len(clean) != 1 {
+		t.Fatalf("dirty writes = %v, clean %v, %v", writes, clean, err)
+	}
+	model := writes[0].model.(*mongo.UpdateOneModel)
+	want := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: "paid"}}},
+		{Key: "$unset", Value: bson.D{{Key: "note", Value: ""}}},
+	}
+	if !valuesEqual(model.Filter, bson.D{{Key: "_id", Value: 1}}) || !valuesEqual(model.Update, want) {
+		t.Errorf("update = %v %v", model.Filter, model.Update)
+	}
+
+	// The changes are written on Commit, which fails without a client: nothing is counted as flushed
+	if _, err := u.Commit(t.Context()); !errors.Is(err, errClientNotInitialized) {
+		t.Errorf("Commit of a changed document = %v", err)
+	}
+	if u.Tracked() != 0 {
+		t.Error("Commit should clear the identity map")
+	}
+	for _, result := range []string{identityFlushed, identityClean} {
+		if got := testutil.ToFloat64(p.prometheusMetrics.identityMap.WithLabelValues("test", "orders", result)); got != 0 {
+			t.Errorf("%s documents of a failed commit = %v", result, got)
+		}
+	}
+
+	// Unchanged documents commit without writes
+	u = p.NewUnitOfWork()
+	key, _ := u.identityKey("orders", unchanged.ID)
+	if _, err := u.track(key, "orders", unchanged.ID, unchanged); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Commit(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.identityMap.WithLabelValues("test", "orders", identityClean)); got != 1 {
+		t.Errorf("clean documents = %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index on a collection
+type IndexSpec struct {
+	// Collection the index belongs to
+	Collection string
+	// Index name; empty lets the server derive it from the keys
+	Name string
+	// Ordered key pattern, e.g. {{"email", 1}} or {{"title", "text"}}
+	Keys bson.D
+	// Unique enforces key uniqueness
+	Unique bool
+	// Sparse skips documents without the indexed fields
+	Sparse bool
+	// TTL expires documents this long after the indexed date field (zero disables)
+	TTL time.Duration
+	// PartialFilter restricts the index to matching documents
+	PartialFilter bson.D
+	// Weights of text index fields
+	Weights bson.D
+	// DefaultLanguage of a text index (server default "english")
+	DefaultLanguage string
+	// LanguageOverride names the per-document language field of a text index
+	LanguageOverride string
+}
+
+// TextIndex declares a text index over the given fields and weights (weight <= 0 uses the default of 1).
+// Fields are indexed in name order so the declaration is deterministic.
+func TextIndex(collection string, weights map[string]int32, defaultLanguage string) IndexSpec {
+	fields := make([]string, 0, len(weights))
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	spec := IndexSpec{Collection: collection, DefaultLanguage: defaultLanguage}
+	for _, field := range fields {
+		spec.Keys = append(spec.Keys, bson.E{Key: field, Value: "text"})
+		if w := weights[field]; w > 0 {
+			spec.Weights = append(spec.Weights, bson.E{Key: field, Value: w})
+		}
+	}
+	return spec
+}
+
+// Model converts the spec into a driver IndexModel
+func (s IndexSpec) Model() mongo.IndexModel {
+	opts := options.Index()
+	if s.Name != "" {
+		opts.SetName(s.Name)
+	}
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+	if s.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(s.TTL / time.Second))
+	}
+	if len(s.PartialFilter) > 0 {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+	if len(s.Weights) > 0 {
+		opts.SetWeights(s.Weights)
+	}
+	if s.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(s.DefaultLanguage)
+	}
+	if s.LanguageOverride != "" {
+		opts.SetLanguageOverride(s.LanguageOverride)
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// EnsureIndexes creates the given indexes (createIndexes is a no-op for identical existing indexes)
+// and returns the names of the ensured indexes. Outside the DDL window the build is queued and a
+// *DDLDeferredError is returned. While a build runs its progress is polled from $currentOp into the
+// index build progress gauge, and EventIndexBuildCompleted is emitted when it finishes.
+func (p *PlugMongoDB) EnsureIndexes(ctx context.Context, specs ...IndexSpec) ([]string, error) {
+	byCollection := make(map[string][]mongo.IndexModel)
+	requested := make(map[string][]string)
+	var order []string
+	for _, spec := range specs {
+		if spec.Collection == "" {
+			return nil, fmt.Errorf("index spec collection cannot be empty")
+		}
+		if len(spec.Keys) == 0 {
+			return nil, fmt.Errorf("index spec on %s has no keys", spec.Collection)
+		}
+		if _, ok := byCollection[spec.Collection]; !ok {
+			order = append(order, spec.Collection)
+		}
+		byCollection[spec.Collection] = append(byCollection[spec.Collection], spec.Model())
+		requested[spec.Collection] = append(requested[spec.Collection], spec.displayName())
+	}
+
+	var names []string
+	err := p.RunDDL(ctx, DDLCreateIndexes, p.ddlNamespace(order...), func(ctx context.Context) error {
+		for _, collection := range order {
+			op := operation{name: "createIndexes", database: p.databaseName(""), collection: collection}
+			err := p.runOperation(ctx, op, func(ctx context.Context) error {
+				coll, err := p.collectionHandle(ctx, collection)
+				if err != nil {
+					return err
+				}
+				start := time.Now()
+				stop := p.watchIndexBuilds(ctx, collection)
+				created, err := coll.Indexes().CreateMany(ctx, byCollection[collection])
+				stop()
+				if err != nil {
+					p.indexBuildCompleted(collection, requested[collection], time.Since(start), err)
+					return err
+				}
+				p.indexBuildCompleted(collection, created, time.Since(start), nil)
+				names = append(names, created...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,268 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultIndexBuildPollInterval is how often $currentOp is polled when index_build_poll_interval is unset
+const defaultIndexBuildPollInterval = 5 * time.Second
+
+// codeNamespaceNotFound is returned by listIndexes on a collection that does not exist yet
+const codeNamespaceNotFound = 26
+
+// IndexBuild is an index build in progress, as reported by $currentOp
+type IndexBuild struct {
+	Namespace string
+	Indexes   []string
+	// Phase is the current build phase, e.g. "scanning collection"
+	Phase string
+	Done  int64
+	Total int64
+	// Progress is Done/Total (0-1) of the current phase; a build goes through several phases
+	Progress float64
+	Running  time.Duration
+}
+
+// currentOpIndexBuild is the part of a $currentOp document describing an index build
+type currentOpIndexBuild struct {
+	NS      string `bson:"ns"`
+	Command struct {
+		CreateIndexes string `bson:"createIndexes"`
+		Indexes       []struct {
+			Name string `bson:"name"`
+		} `bson:"indexes"`
+	} `bson:"command"`
+	Msg      string `bson:"msg"`
+	Progress struct {
+		Done  float64 `bson:"done"`
+		Total float64 `bson:"total"`
+	} `bson:"progress"`
+	MicrosRunning int64 `bson:"microsecs_running"`
+}
+
+// IndexBuilds returns the index builds running on the deployment, restricted to the given collections
+// of the configured database when any are named. It runs $currentOp and requires the inprog privilege.
+func (p *PlugMongoDB) IndexBuilds(ctx context.Context, collections ...string) ([]IndexBuild, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$currentOp", Value: bson.D{{Key: "allUsers", Value: true}, {Key: "idleConnections", Value: false}}}},
+		{{Key: "$match", Value: bson.D{{Key: "command.createIndexes", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+	}
+	var ops []bson.Raw
+	op := operation{name: "currentOp", database: "admin"}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "admin")
+		if err != nil {
+			return err
+		}
+		cursor, err := db.Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		ops = ops[:0]
+		for cursor.Next(ctx) {
+			ops = append(ops, append(bson.Raw(nil), cursor.Current...))
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, c := range collections {
+		namespaces = append(namespaces, p.databaseName("")+"."+c)
+	}
+	return mergeIndexBuilds(ops, namespaces), nil
+}
+
+// mergeIndexBuilds converts $currentOp documents into index builds on namespaces (all when empty).
+// A build shows up both as the createIndexes command and as its builder thread; the entry with
+// progress wins.
+func mergeIndexBuilds(ops []bson.Raw, namespaces []string) []IndexBuild {
+	var builds []IndexBuild
+	byKey := make(map[string]int)
+	for _, raw := range ops {
+		var op currentOpIndexBuild
+		if err := bson.Unmarshal(raw, &op); err != nil || op.Command.CreateIndexes == "" {
+			continue
+		}
+		db, _, _ := strings.Cut(op.NS, ".")
+		build := IndexBuild{
+			Namespace: db + "." + op.Command.CreateIndexes,
+			Phase:     indexBuildPhase(op.Msg),
+			Done:      int64(op.Progress.Done),
+			Total:     int64(op.Progress.Total),
+			Running:   time.Duration(op.MicrosRunning) * time.Microsecond,
+		}
+		if len(namespaces) > 0 && !slices.Contains(namespaces, build.Namespace) {
+			continue
+		}
+		for _, idx := range op.Command.Indexes {
+			build.Indexes = append(build.Indexes, idx.Name)
+		}
+		if build.Total > 0 {
+			build.Progress = min(float64(build.Done)/float64(build.Total), 1)
+		}
+
+		key := build.Namespace + "/" + strings.Join(build.Indexes, ",")
+		if i, ok := byKey[key]; ok {
+			if builds[i].Total == 0 && build.Total > 0 {
+				builds[i] = build
+			}
+			continue
+		}
+		byKey[key] = len(builds)
+		builds = append(builds, build)
+	}
+	return builds
+}
+
+// indexBuildPhase extracts the phase from a build message such as
+// "Index Build: scanning collection Index Build: scanning collection: 4000/10000 40%"
+func indexBuildPhase(msg string) string {
+	msg = strings.TrimPrefix(msg, "Index Build: ")
+	if i := strings.Index(msg, " Index Build: "); i >= 0 {
+		msg = msg[:i]
+	}
+	phase, _, _ := strings.Cut(msg, ":")
+	return strings.TrimSpace(phase)
+}
+
+// WaitForIndexes blocks until the named indexes of collection exist and are no longer being built,
+// checking every index_build_poll_interval, so deploy tooling can wait on index readiness. Without
+// the inprog privilege readiness is judged from listIndexes alone.
+func (p *PlugMongoDB) WaitForIndexes(ctx context.Context, collection string, names ...string) error {
+	if collection == "" {
+		return fmt.Errorf("collection name cannot be empty")
+	}
+	ticker := time.NewTicker(p.indexBuildPollInterval())
+	defer ticker.Stop()
+	for {
+		ready, err := p.indexesReady(ctx, collection, names)
+		if err != nil || ready {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *PlugMongoDB) indexesReady(ctx context.Context, collection string, names []string) (bool, error) {
+	var existing []bson.Raw
+	op := operation{name: "listIndexes", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		existing, err = listIndexDocuments(ctx, coll)
+		return err
+	})
+	if errorCode(err) == codeNamespaceNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	have := indexNames(existing)
+	for _, name := range names {
+		if !slices.Contains(have, name) {
+			return false, nil
+		}
+	}
+
+	builds, err := p.IndexBuilds(ctx, collection)
+	if err != nil {
+		return true, nil
+	}
+	for _, b := range builds {
+		for _, idx := range b.Indexes {
+			if slices.Contains(names, idx) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// watchIndexBuilds exposes the progress of the builds on collection in the progress gauge until
+// the returned stop is called, which removes the series again
+func (p *PlugMongoDB) watchIndexBuilds(ctx context.Context, collection string) (stop func()) {
+	m := p.prometheusMetrics
+	name, ok := p.metricsCollection(p.databaseName(""), collection)
+	if m == nil || !ok {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	seen := make(map[string]bool)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(p.indexBuildPollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			builds, err := p.IndexBuilds(ctx, collection)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Debugf("not reporting index build progress on %s: %v", collection, err)
+				}
+				return
+			}
+			for _, b := range builds {
+				for _, idx := range b.Indexes {
+					seen[idx] = true
+					m.RecordIndexBuildProgress(p.config(), name, idx, b.Progress)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		for idx := range seen {
+			m.DeleteIndexBuildProgress(p.config(), name, idx)
+		}
+	}
+}
+
+// indexBuildCompleted records a finished createIndexes and emits EventIndexBuildCompleted
+func (p *PlugMongoDB) indexBuildCompleted(collection string, indexes []string, d time.Duration, err error) {
+	result := "ready"
+	if err != nil {
+		result = "failed"
+	}
+	if name, ok := p.metricsCollection(p.databaseName(""), collection); ok {
+		p.prometheusMetrics.RecordIndexBuild(p.config(), name, result)
+	}
+	p.emitTyped(EventIndexBuildCompleted, plugins.PriorityNormal, IndexBuildCompletedEvent{
+		Namespace: p.databaseName("") + "." + collection,
+		Indexes:   indexes,
+		Duration:  d,
+		Err:       err,
+	})
+}
+
+func (p *PlugMongoDB) indexBuildPollInterval() time.Duration {
+	if d := p.config().GetIndexBuildPollInterval().AsDuration(); d > 0 {
+		return d
+	}
+	return defaultIndexBuildPollInterval
+}
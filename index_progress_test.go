@@ -0,0 +1,105 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestMergeIndexBuilds(t *testing.T) {
+	command := bson.D{{Key: "createIndexes", Value: "orders"}, {Key: "indexes", Value: bson.A{bson.D{{Key: "name", Value: "sku_1"}}}}}
+	ops := []bson.D{
+		// The client connection waiting on the build
+		{{Key: "ns", Value: "shop.$cmd"}, {Key: "command", Value: command}, {Key: "microsecs_running", Value: int64(4_000_000)}},
+		// The builder thread reporting progress
+		{
+			{Key: "ns", Value: "shop.orders"},
+			{Key: "command", Value: command},
+			{Key: "msg", Value: "Index Build: scanning collection Index Build: scanning collection: 2500/10000 25%"},
+			{Key: "progress", Value: bson.D{{Key: "done", Value: int32(2500)}, {Key: "total", Value: int64(10000)}}},
+			{Key: "microsecs_running", Value: int64(3_000_000)},
+		},
+		{{Key: "ns", Value: "shop.users"}, {Key: "command", Value: bson.D{{Key: "createIndexes", Value: "users"}, {Key: "indexes", Value: bson.A{bson.D{{Key: "name", Value: "email_1"}}}}}}},
+	}
+	var raws []bson.Raw
+	for _, op := range ops {
+		raw, _ := bson.Marshal(op)
+		raws = append(raws, raw)
+	}
+
+	builds := mergeIndexBuilds(raws, []string{"shop.orders"})
+	if len(builds) != 1 {
+		t.Fatalf("expected one build on shop.orders, got %+v", builds)
+	}
+	b := builds[0]
+	if b.Namespace != "shop.orders" || len(b.Indexes) != 1 || b.Indexes[0] != "sku_1" {
+		t.Errorf("unexpected build %+v", b)
+	}
+	if b.Phase != "scanning collection" || b.Done != 2500 || b.Total != 10000 || b.Progress != 0.25 || b.Running != 3*time.Second {
+		t.Errorf("unexpected progress %+v", b)
+	}
+	if all := mergeIndexBuilds(raws, nil); len(all) != 2 {
+		t.Errorf("expected two builds without namespace filter, got %d", len(all))
+	}
+}
+
+func TestIndexBuildPhase(t *testing.T) {
+	for msg, want := range map[string]string{
+		"": "",
+		"Index Build: inserting keys from external sorter into index Index Build: inserting keys from external sorter into index: 10/20 50%": "inserting keys from external sorter into index",
+		"Index Build: draining writes": "draining writes",
+	} {
+		if got := indexBuildPhase(msg); got != want {
+			t.Errorf("indexBuildPhase(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestIndexBuildCompleted(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+
+	p.indexBuildCompleted("orders", []string{"sku_1"}, time.Second, nil)
+	p.indexBuildCompleted("orders", []string{"sku_1"}, time.Second, errors.New("duplicate key"))
+	for _, result := range []string{"ready", "failed"} {
+		if got := testutil.ToFloat64(p.prometheusMetrics.indexBuildsTotal.WithLabelValues("test", "orders", result)); got != 1 {
+			t.Errorf("index_builds_total{result=%q} = %v, want 1", result, got)
+		}
+	}
+
+	p.prometheusMetrics.RecordIndexBuildProgress(p.config(), "orders", "sku_1", 0.5)
+	p.prometheusMetrics.DeleteIndexBuildProgress(p.config(), "orders", "sku_1")
+	if n := testutil.CollectAndCount(p.prometheusMetrics.indexBuildProgress); n != 0 {
+		t.Errorf("expected finished builds to drop their progress series, got %d", n)
+	}
+}
+
+func TestWaitForIndexes(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond), IndexBuildPollInterval: durationpb.New(10 * time.Millisecond)})
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	if err := p.WaitForIndexes(t.Context(), "", "sku_1"); err == nil {
+		t.Error("expected an error without collection")
+	}
+	if err := p.WaitForIndexes(t.Context(), "orders", "sku_1"); err == nil {
+		t.Error("expected an error from an unreachable server")
+	}
+	if p.indexBuildPollInterval() != 10*time.Millisecond {
+		t.Errorf("unexpected poll interval %v", p.indexBuildPollInterval())
+	}
+}
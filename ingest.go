@@ -0,0 +1,399 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultIngestBatchSize is the number of upserts sent per bulk write
+	defaultIngestBatchSize = 500
+	// defaultIngestFlushInterval bounds how long a partial batch waits for more documents
+	defaultIngestFlushInterval = time.Second
+	// defaultIngestMaxRetries bounds the retries of upserts that lost a duplicate key race
+	defaultIngestMaxRetries = 3
+)
+
+// IngestOptions configures an Ingester
+type IngestOptions struct {
+	// Collection receives the documents; required
+	Collection string
+	// KeyFields identify a document: upserts match on their values (default _id).
+	// They should be covered by a unique index.
+	KeyFields []string
+	// ShardKey fields route documents to partitions, so each batch targets few shards (default KeyFields)
+	ShardKey []string
+	// Partitions is the number of batches filled and written concurrently (default 1)
+	Partitions int
+	// BatchSize is the number of upserts per bulk write (default 500)
+	BatchSize int
+	// FlushInterval writes partial batches after this delay (default 1s)
+	FlushInterval time.Duration
+	// QueueSize bounds the documents buffered per partition; Submit blocks when it is full (default 4 * BatchSize)
+	QueueSize int
+	// MaxRetries bounds the retries of upserts rejected with a duplicate key error (default 3)
+	MaxRetries int
+	// Replace replaces matched documents instead of merging their fields with $set
+	Replace bool
+	// OnFailure receives the documents that could not be written, after retries
+	OnFailure func(ctx context.Context, failures []IngestFailure)
+	// DeadLetters records the documents that could not be written, with their error, for replay
+	// (defaults to the dead_letter_collection sink when configured)
+	DeadLetters DeadLetterSink
+}
+
+// IngestFailure is a document an Ingester could not write
+type IngestFailure struct {
+	Document bson.Raw
+	Err      error
+	// Attempts counts the writes tried, retries included
+	Attempts int
+}
+
+// IngestStats counts the documents handled by an Ingester
+type IngestStats struct {
+	Submitted int64
+	Written   int64
+	Failed    int64
+	Retried   int64
+	Batches   int64
+	// DeadLettered counts failed documents recorded in the dead-letter sink
+	DeadLettered int64
+}
+
+// Ingester buffers documents and writes them as unordered bulk upserts. Documents are routed to
+// partitions by shard key, each partition flushing on size or interval; Submit blocks once a
+// partition queue is full, so producers slow down to the write rate instead of growing memory.
+type Ingester struct {
+	p          *PlugMongoDB
+	opts       IngestOptions
+	partitions []chan bson.Raw
+	wg         sync.WaitGroup
+	unregister func()
+
+	mu     sync.RWMutex
+	closed bool
+
+	statsMu sync.Mutex
+	stats   IngestStats
+}
+
+// NewIngester starts an ingestion pipeline into opts.Collection. Close flushes buffered documents;
+// pipelines still open on Stop are flushed before the client disconnects.
+func (p *PlugMongoDB) NewIngester(opts IngestOptions) (*Ingester, error) {
+	if opts.Collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	if len(opts.KeyFields) == 0 {
+		opts.KeyFields = []string{"_id"}
+	}
+	if len(opts.ShardKey) == 0 {
+		opts.ShardKey = opts.KeyFields
+	}
+	if opts.Partitions <= 0 {
+		opts.Partitions = 1
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultIngestBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultIngestFlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4 * opts.BatchSize
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultIngestMaxRetries
+	}
+	if opts.DeadLetters == nil {
+		opts.DeadLetters = p.defaultDeadLetters()
+	}
+
+	in := &Ingester{p: p, opts: opts, partitions: make([]chan bson.Raw, opts.Partitions)}
+	for i := range in.partitions {
+		ch := make(chan bson.Raw, opts.QueueSize)
+		in.partitions[i] = ch
+		in.wg.Add(1)
+		go in.run(ch)
+	}
+	in.unregister = p.RegisterCleanup(ResourceBulkWriter, "ingest:"+opts.Collection, in.shutdown)
+	return in, nil
+}
+
+// Submit queues doc for upsert. It blocks while the target partition is full and returns the
+// context error if ctx ends first. doc must contain every key field.
+func (in *Ingester) Submit(ctx context.Context, doc any) error {
+	raw, err := in.marshal(doc)
+	if err != nil {
+		return err
+	}
+	for _, field := range in.opts.KeyFields {
+		if _, err := raw.LookupErr(field); err != nil {
+			return fmt.Errorf("document has no key field %q", field)
+		}
+	}
+	ch := in.partitions[in.partition(raw)]
+
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.closed {
+		return fmt.Errorf("ingester for %s is closed", in.opts.Collection)
+	}
+	select {
+	case ch <- raw:
+		in.statsMu.Lock()
+		in.stats.Submitted++
+		in.statsMu.Unlock()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting documents and waits until buffered ones are written or ctx ends
+func (in *Ingester) Close(ctx context.Context) error {
+	in.unregister()
+	return in.shutdown(ctx)
+}
+
+// Stats returns the document counters of the pipeline
+func (in *Ingester) Stats() IngestStats {
+	in.statsMu.Lock()
+	defer in.statsMu.Unlock()
+	return in.stats
+}
+
+func (in *Ingester) shutdown(ctx context.Context) error {
+	in.mu.Lock()
+	if !in.closed {
+		in.closed = true
+		for _, ch := range in.partitions {
+			close(ch)
+		}
+	}
+	in.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		in.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ingester for %s did not flush: %w", in.opts.Collection, ctx.Err())
+	}
+}
+
+func (in *Ingester) marshal(doc any) (bson.Raw, error) {
+	switch d := doc.(type) {
+	case nil:
+		return nil, fmt.Errorf("document cannot be nil")
+	case bson.Raw:
+		return append(bson.Raw(nil), d...), nil
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if in.p.registry != nil {
+		data, err = bson.MarshalWithRegistry(in.p.registry, doc)
+	} else {
+		data, err = bson.Marshal(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return data, nil
+}
+
+// partition hashes the shard key values of doc, so documents of one shard key range share batches
+func (in *Ingester) partition(doc bson.Raw) int {
+	if len(in.partitions) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	for _, field := range in.opts.ShardKey {
+		if v, err := doc.LookupErr(field); err == nil {
+			h.Write(v.Value)
+		}
+	}
+	return int(h.Sum32() % uint32(len(in.partitions)))
+}
+
+// run fills and flushes the batches of one partition until its queue is closed
+func (in *Ingester) run(ch <-chan bson.Raw) {
+	defer in.wg.Done()
+	ticker := time.NewTicker(in.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]bson.Raw, 0, in.opts.BatchSize)
+	for {
+		select {
+		case doc, ok := <-ch:
+			if !ok {
+				in.flush(batch)
+				return
+			}
+			batch = append(batch, doc)
+			if len(batch) >= in.opts.BatchSize {
+				in.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			in.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes batch as an unordered bulk upsert, retrying the upserts that lost a duplicate
+// key race against a concurrent insert of the same key: the retry then matches the winner.
+func (in *Ingester) flush(batch []bson.Raw) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx := context.Background()
+	start := time.Now()
+	pending := batch
+	var written, retried int
+	var failures []IngestFailure
+	for attempt := 0; len(pending) > 0; attempt++ {
+		models := make([]mongo.WriteModel, len(pending))
+		for i, doc := range pending {
+			models[i] = upsertModel(doc, in.opts.KeyFields, in.opts.Replace)
+		}
+		res, err := in.bulkWrite(ctx, models)
+		if res != nil {
+			written += int(res.MatchedCount + res.UpsertedCount)
+		}
+		if err == nil {
+			break
+		}
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+			for _, doc := range pending {
+				failures = append(failures, IngestFailure{Document: doc, Err: err, Attempts: attempt + 1})
+			}
+			break
+		}
+		var retry []bson.Raw
+		for _, we := range bwe.WriteErrors {
+			doc := pending[we.Index]
+			if isDuplicateKeyCode(we.Code) && attempt < in.opts.MaxRetries {
+				retry = append(retry, doc)
+				continue
+			}
+			failures = append(failures, IngestFailure{Document: doc, Err: we.WriteError, Attempts: attempt + 1})
+		}
+		retried += len(retry)
+		pending = retry
+	}
+	in.record(start, written, retried, failures)
+}
+
+// upsertModel builds the upsert of doc, matching on its key fields
+func upsertModel(doc bson.Raw, keyFields []string, replace bool) mongo.WriteModel {
+	if len(keyFields) == 0 {
+		keyFields = []string{"_id"}
+	}
+	filter := make(bson.D, 0, len(keyFields))
+	for _, field := range keyFields {
+		filter = append(filter, bson.E{Key: field, Value: doc.Lookup(field)})
+	}
+	if replace {
+		return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).SetUpsert(true)
+	}
+	// _id is immutable, so it is only set when the upsert inserts
+	set := bson.D{}
+	var id any
+	elems, _ := doc.Elements()
+	for _, e := range elems {
+		if e.Key() == "_id" {
+			id = e.Value()
+			continue
+		}
+		set = append(set, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+	update := bson.D{{Key: "$set", Value: set}}
+	if id != nil {
+		update = append(update, bson.E{Key: "$setOnInsert", Value: bson.D{{Key: "_id", Value: id}}})
+	}
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true)
+}
+
+func (in *Ingester) bulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	var result *mongo.BulkWriteResult
+	op := operation{name: "bulkWrite", database: in.p.databaseName(""), collection: in.opts.Collection}
+	err := in.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := in.p.collectionHandle(ctx, in.opts.Collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		result = res
+		return err
+	})
+	return result, err
+}
+
+func (in *Ingester) record(start time.Time, written, retried int, failures []IngestFailure) {
+	in.statsMu.Lock()
+	in.stats.Batches++
+	in.stats.Written += int64(written)
+	in.stats.Retried += int64(retried)
+	in.stats.Failed += int64(len(failures))
+	in.statsMu.Unlock()
+
+	if m := in.p.prometheusMetrics; m != nil {
+		if name, ok := in.p.metricsCollection(in.p.databaseName(""), in.opts.Collection); ok {
+			m.RecordIngestBatch(in.p.config(), name, time.Since(start), written, retried, len(failures))
+		}
+	}
+	if len(failures) == 0 {
+		return
+	}
+	log.Warnw("key", "mongodb", "event", "ingest_failures", "collection", in.opts.Collection,
+		"failed", len(failures), "error", failures[0].Err)
+	if in.opts.OnFailure != nil {
+		in.opts.OnFailure(context.Background(), failures)
+	}
+	if in.opts.DeadLetters != nil {
+		in.deadLetter(failures)
+	}
+}
+
+// deadLetter records failures in the dead-letter sink; documents the sink rejects are lost,
+// so they are logged as errors with their count
+func (in *Ingester) deadLetter(failures []IngestFailure) {
+	ctx, cancel := context.WithTimeout(context.Background(), in.p.operationTimeout())
+	defer cancel()
+	if err := in.opts.DeadLetters.WriteDeadLetters(ctx, in.deadLetters(failures)); err != nil {
+		log.Errorw("key", "mongodb", "event", "dead_letters_lost", "collection", in.opts.Collection,
+			"lost", len(failures), "error", err)
+		return
+	}
+	in.statsMu.Lock()
+	in.stats.DeadLettered += int64(len(failures))
+	in.statsMu.Unlock()
+	if m := in.p.prometheusMetrics; m != nil {
+		if name, ok := in.p.metricsCollection(in.p.databaseName(""), in.opts.Collection); ok {
+			m.RecordDeadLetters(in.p.config(), name, len(failures))
+		}
+	}
+}
+
+// isDuplicateKeyCode reports whether code is a duplicate key error
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
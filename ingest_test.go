@@ -0,0 +1,128 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestIngesterModel(t *testing.T) {
+	keys := []string{"tenant", "key"}
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: 7}, {Key: "tenant", Value: "a"}, {Key: "key", Value: "k"}, {Key: "n", Value: 1}})
+
+	model, ok := upsertModel(doc, keys, false).(*mongo.UpdateOneModel)
+	if !ok || model.Upsert == nil || !*model.Upsert {
+		t.Fatalf("expected an upsert update, got %#v", model)
+	}
+	filter := model.Filter.(bson.D)
+	if len(filter) != 2 || filter[0].Key != "tenant" || filter[1].Key != "key" {
+		t.Errorf("unexpected filter %v", filter)
+	}
+	update := model.Update.(bson.D)
+	if len(update) != 2 || update[0].Key != "$set" || update[1].Key != "$setOnInsert" {
+		t.Fatalf("unexpected update %v", update)
+	}
+	for _, e := range update[0].Value.(bson.D) {
+		if e.Key == "_id" {
+			t.Error("_id must not be set on matched documents")
+		}
+	}
+
+	if _, ok := upsertModel(doc, keys, true).(*mongo.ReplaceOneModel); !ok {
+		t.Error("expected a replace upsert")
+	}
+}
+
+func TestIngesterPartition(t *testing.T) {
+	in := &Ingester{opts: IngestOptions{ShardKey: []string{"tenant"}}, partitions: make([]chan bson.Raw, 8)}
+	a1, _ := bson.Marshal(bson.M{"tenant": "a", "n": 1})
+	a2, _ := bson.Marshal(bson.M{"tenant": "a", "n": 2})
+	if in.partition(a1) != in.partition(a2) {
+		t.Error("documents with the same shard key must share a partition")
+	}
+	seen := map[int]bool{}
+	for _, tenant := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		doc, _ := bson.Marshal(bson.M{"tenant": tenant})
+		seen[in.partition(doc)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expected shard keys to spread over partitions")
+	}
+}
+
+func TestIngesterFailures(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond)})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	if _, err := p.NewIngester(IngestOptions{}); err == nil {
+		t.Error("expected an error without collection")
+	}
+	var mu sync.Mutex
+	var failed []IngestFailure
+	in, err := p.NewIngester(IngestOptions{
+		Collection: "events",
+		Partitions: 2,
+		BatchSize:  2,
+		OnFailure: func(_ context.Context, failures []IngestFailure) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, failures...)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Submit(t.Context(), bson.M{"n": 1}); err == nil {
+		t.Error("expected an error for a document without key field")
+	}
+	for i := range 3 {
+		if err := in.Submit(t.Context(), bson.M{"_id": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stop flushes pipelines that were not closed
+	p.releaseResources(context.Background())
+	if err := in.Submit(t.Context(), bson.M{"_id": 9}); err == nil {
+		t.Error("expected an error after close")
+	}
+	if len(failed) != 3 {
+		t.Errorf("got %d failures, want 3", len(failed))
+	}
+	stats := in.Stats()
+	if stats.Submitted != 3 || stats.Failed != 3 || stats.Written != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIngesterBackpressure(t *testing.T) {
+	in := &Ingester{p: NewMongoDBClient(), opts: IngestOptions{KeyFields: []string{"_id"}}, partitions: []chan bson.Raw{make(chan bson.Raw, 1)}}
+	if err := in.Submit(t.Context(), bson.M{"_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if err := in.Submit(ctx, bson.M{"_id": 2}); err != context.DeadlineExceeded {
+		t.Errorf("expected Submit to block on a full queue, got %v", err)
+	}
+}
+
+func TestIsDuplicateKeyCode(t *testing.T) {
+	if !isDuplicateKeyCode(11000) || isDuplicateKeyCode(121) {
+		t.Error("unexpected duplicate key classification")
+	}
+}
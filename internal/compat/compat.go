@@ -0,0 +1,222 @@
+// Package compat runs the plugin's compatibility suite against MongoDB server containers and
+// reports a capability matrix that mongodb.RegisterCapabilities (and so FeatureSupported) consumes.
+package compat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	mongodb "github.com/go-lynx/lynx-mongodb"
+	"github.com/go-lynx/lynx-mongodb/internal/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultImages are the server versions the plugin supports
+var DefaultImages = []string{"mongo:5.0", "mongo:6.0", "mongo:7.0", "mongo:8.0"}
+
+// suiteDatabase is the scratch database of the compatibility checks
+const suiteDatabase = "lynx_compat"
+
+// Check exercises one feature against a connected server
+type Check struct {
+	Feature mongodb.Feature
+	Run     func(ctx context.Context, db *mongo.Database) error
+}
+
+// Suite returns the checks for transactions, change streams and time-series collections
+func Suite() []Check {
+	return []Check{
+		{Feature: mongodb.FeatureTransactions, Run: checkTransactions},
+		{Feature: mongodb.FeatureChangeStreams, Run: checkChangeStreams},
+		{Feature: mongodb.FeatureTimeSeries, Run: checkTimeSeries},
+	}
+}
+
+// VersionReport is the outcome of the suite against one image
+type VersionReport struct {
+	Image   string
+	Version string
+	// Failures maps the failed features to their error
+	Failures map[mongodb.Feature]string
+	// Err is set when the container could not be started or connected
+	Err error
+}
+
+// Report is the outcome of a matrix run
+type Report struct {
+	Matrix   mongodb.CapabilityMatrix
+	Versions []VersionReport
+}
+
+// RunMatrix starts a container per image, runs checks against it and collects the capability matrix.
+// Images that fail to start are reported in Versions and left out of the matrix.
+func RunMatrix(ctx context.Context, images []string, checks []Check) Report {
+	report := Report{Matrix: mongodb.CapabilityMatrix{}}
+	for _, image := range images {
+		vr := runImage(ctx, image, checks)
+		report.Versions = append(report.Versions, vr)
+		if vr.Err != nil {
+			continue
+		}
+		key := majorMinor(vr.Version)
+		report.Matrix[key] = map[mongodb.Feature]bool{}
+		for _, c := range checks {
+			_, failed := vr.Failures[c.Feature]
+			report.Matrix[key][c.Feature] = !failed
+		}
+	}
+	return report
+}
+
+func runImage(ctx context.Context, image string, checks []Check) VersionReport {
+	vr := VersionReport{Image: image, Failures: map[mongodb.Feature]string{}}
+	startCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+	container, err := mongotest.Start(startCtx, image)
+	if err != nil {
+		vr.Err = err
+		return vr
+	}
+	defer func() { _ = container.Stop() }()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(container.URI))
+	if err != nil {
+		vr.Err = err
+		return vr
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	var build struct {
+		Version string `bson:"version"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&build); err != nil {
+		vr.Err = err
+		return vr
+	}
+	vr.Version = build.Version
+
+	db := client.Database(suiteDatabase)
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		if err := c.Run(checkCtx, db); err != nil {
+			vr.Failures[c.Feature] = err.Error()
+		}
+		cancel()
+	}
+	return vr
+}
+
+// String renders the report as a text table, one row per image
+func (r Report) String() string {
+	var features []string
+	seen := map[mongodb.Feature]bool{}
+	for _, fs := range r.Matrix {
+		for f := range fs {
+			if !seen[f] {
+				seen[f] = true
+				features = append(features, string(f))
+			}
+		}
+	}
+	sort.Strings(features)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-12s %-10s %s\n", "image", "version", strings.Join(features, " "))
+	for _, vr := range r.Versions {
+		if vr.Err != nil {
+			fmt.Fprintf(&b, "%-12s %-10s error: %v\n", vr.Image, "-", vr.Err)
+			continue
+		}
+		cells := make([]string, len(features))
+		for i, f := range features {
+			cell := "yes"
+			if _, failed := vr.Failures[mongodb.Feature(f)]; failed {
+				cell = "no"
+			}
+			cells[i] = fmt.Sprintf("%-*s", len(f), cell)
+		}
+		fmt.Fprintf(&b, "%-12s %-10s %s\n", vr.Image, vr.Version, strings.Join(cells, " "))
+	}
+	return b.String()
+}
+
+// majorMinor returns the "major.minor" prefix of a server version
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func checkTransactions(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection("compat_transactions")
+	if err := db.CreateCollection(ctx, coll.Name()); err != nil && !isNamespaceExists(err) {
+		return err
+	}
+	sess, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return coll.InsertOne(sc, bson.D{{Key: "ok", Value: true}})
+	})
+	if err != nil {
+		return err
+	}
+	n, err := coll.CountDocuments(ctx, bson.D{})
+	if err == nil && n == 0 {
+		err = fmt.Errorf("committed document not found")
+	}
+	return err
+}
+
+func checkChangeStreams(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection("compat_change_streams")
+	stream, err := coll.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close(context.Background()) }()
+	if _, err := coll.InsertOne(ctx, bson.D{{Key: "ok", Value: true}}); err != nil {
+		return err
+	}
+	if !stream.Next(ctx) {
+		if err := stream.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("no change event received")
+	}
+	return nil
+}
+
+func checkTimeSeries(ctx context.Context, db *mongo.Database) error {
+	name := "compat_time_series"
+	_ = db.Collection(name).Drop(ctx)
+	opts := options.CreateCollection().SetTimeSeriesOptions(options.TimeSeries().SetTimeField("ts").SetMetaField("source"))
+	if err := db.CreateCollection(ctx, name, opts); err != nil {
+		return err
+	}
+	coll := db.Collection(name)
+	if _, err := coll.InsertOne(ctx, bson.D{{Key: "ts", Value: time.Now()}, {Key: "source", Value: "compat"}, {Key: "v", Value: 1}}); err != nil {
+		return err
+	}
+	n, err := coll.CountDocuments(ctx, bson.D{{Key: "source", Value: "compat"}})
+	if err == nil && n != 1 {
+		err = fmt.Errorf("expected 1 measurement, found %d", n)
+	}
+	return err
+}
+
+func isNamespaceExists(err error) bool {
+	var cmdErr mongo.CommandError
+	// 48: NamespaceExists
+	return errors.As(err, &cmdErr) && cmdErr.Code == 48
+}
@@ -0,0 +1,69 @@
+package compat
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	mongodb "github.com/go-lynx/lynx-mongodb"
+	"github.com/go-lynx/lynx-mongodb/internal/mongotest"
+)
+
+func TestReportString(t *testing.T) {
+	r := Report{
+		Matrix: mongodb.CapabilityMatrix{"7.0": {mongodb.FeatureTransactions: true, mongodb.FeatureTimeSeries: false}},
+		Versions: []VersionReport{
+			{Image: "mongo:7.0", Version: "7.0.12", Failures: map[mongodb.Feature]string{mongodb.FeatureTimeSeries: "boom"}},
+			{Image: "mongo:9.9", Err: errors.New("pull failed")},
+		},
+	}
+	out := r.String()
+	for _, want := range []string{"time_series transactions", "7.0.12", "no", "yes", "error: pull failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+	if got := majorMinor("8.0.0-rc1"); got != "8.0" {
+		t.Errorf("majorMinor = %q", got)
+	}
+}
+
+// TestMatrix runs the compatibility suite against every supported server version. It only runs with
+// MONGODB_COMPAT_TEST=1 and docker; MONGODB_COMPAT_IMAGES overrides the comma-separated image list and
+// MONGODB_COMPAT_OUTPUT receives the capability matrix as JSON for mongodb.RegisterCapabilities:
+//
+//	MONGODB_COMPAT_TEST=1 MONGODB_COMPAT_OUTPUT=capabilities.json go test -run TestMatrix -v ./internal/compat
+func TestMatrix(t *testing.T) {
+	if os.Getenv("MONGODB_COMPAT_TEST") != "1" {
+		t.Skip("set MONGODB_COMPAT_TEST=1 to run the compatibility matrix")
+	}
+	if !mongotest.Available() {
+		t.Skip("docker is not available")
+	}
+	images := DefaultImages
+	if v := os.Getenv("MONGODB_COMPAT_IMAGES"); v != "" {
+		images = strings.Split(v, ",")
+	}
+
+	report := RunMatrix(t.Context(), images, Suite())
+	t.Logf("capability matrix:\n%s", report)
+	for _, vr := range report.Versions {
+		if vr.Err != nil {
+			t.Errorf("%s: %v", vr.Image, vr.Err)
+		}
+		for f, msg := range vr.Failures {
+			t.Logf("%s: %s unsupported: %s", vr.Image, f, msg)
+		}
+	}
+	if path := os.Getenv("MONGODB_COMPAT_OUTPUT"); path != "" {
+		data, err := json.MarshalIndent(report.Matrix, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package loadgen drives concurrent operations for a fixed duration and reports throughput and
+// latency percentiles, to compare plugin changes under load before a release.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation is one unit of load; worker identifies the calling goroutine
+type Operation func(ctx context.Context, worker int) error
+
+// Config configures a load run
+type Config struct {
+	// Workers is the number of concurrent goroutines (defaults to 1)
+	Workers int
+	// Duration bounds the run; ctx cancellation also stops it
+	Duration time.Duration
+	// Operation is called in a loop by every worker
+	Operation Operation
+}
+
+// Result summarizes a load run
+type Result struct {
+	Operations int64
+	Errors     int64
+	// FirstError is the first operation error, for diagnosis
+	FirstError error
+	Elapsed    time.Duration
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// Throughput returns operations per second
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Operations) / r.Elapsed.Seconds()
+}
+
+// String formats the result for benchmark logs
+func (r Result) String() string {
+	return fmt.Sprintf("%d ops (%d errors) in %s: %.0f ops/s, p50=%s p95=%s p99=%s max=%s",
+		r.Operations, r.Errors, r.Elapsed.Round(time.Millisecond), r.Throughput(), r.P50, r.P95, r.P99, r.Max)
+}
+
+// Run calls cfg.Operation from cfg.Workers goroutines until cfg.Duration elapses or ctx is done
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	if cfg.Operation == nil {
+		return Result{}, fmt.Errorf("load operation cannot be nil")
+	}
+	if cfg.Duration <= 0 {
+		return Result{}, fmt.Errorf("load duration must be positive")
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var (
+		errCount  atomic.Int64
+		firstErr  error
+		errOnce   sync.Once
+		wg        sync.WaitGroup
+		latencies = make([][]time.Duration, workers)
+	)
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				opStart := time.Now()
+				err := cfg.Operation(ctx, w)
+				// An operation interrupted by the end of the run is not an error
+				if ctx.Err() != nil {
+					return
+				}
+				latencies[w] = append(latencies[w], time.Since(opStart))
+				if err != nil {
+					errCount.Add(1)
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	result := Result{
+		Operations: int64(len(all)),
+		Errors:     errCount.Load(),
+		FirstError: firstErr,
+		Elapsed:    time.Since(start),
+		P50:        percentile(all, 0.50),
+		P95:        percentile(all, 0.95),
+		P99:        percentile(all, 0.99),
+		Max:        percentile(all, 1),
+	}
+	return result, nil
+}
+
+// percentile returns the q-quantile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,57 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	result, err := Run(context.Background(), Config{
+		Workers:  4,
+		Duration: 50 * time.Millisecond,
+		Operation: func(_ context.Context, worker int) error {
+			time.Sleep(time.Millisecond)
+			if worker == 0 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Operations == 0 || result.Errors == 0 || result.Errors >= result.Operations {
+		t.Errorf("unexpected counts %s", result)
+	}
+	if result.FirstError == nil || result.P50 < time.Millisecond || result.P99 < result.P50 || result.Max < result.P99 {
+		t.Errorf("unexpected latencies %s", result)
+	}
+	if result.Throughput() <= 0 {
+		t.Error("expected a positive throughput")
+	}
+}
+
+func TestRunValidatesConfig(t *testing.T) {
+	if _, err := Run(context.Background(), Config{Duration: time.Second}); err == nil {
+		t.Error("expected an error without operation")
+	}
+	op := func(context.Context, int) error { return nil }
+	if _, err := Run(context.Background(), Config{Operation: op}); err == nil {
+		t.Error("expected an error without duration")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if got := percentile(sorted, 0.5); got != 5 {
+		t.Errorf("p50 = %d", got)
+	}
+	if got := percentile(sorted, 0.99); got != 10 {
+		t.Errorf("p99 = %d", got)
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("empty p50 = %d", got)
+	}
+}
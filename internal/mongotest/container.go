@@ -0,0 +1,113 @@
+// Package mongotest starts disposable MongoDB containers through the docker CLI for load and
+// compatibility tests. Each container runs a single-member replica set so transactions and
+// change streams are available.
+package mongotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// replSetName is the replica set name of started containers
+const replSetName = "rs0"
+
+// Container is a running MongoDB container
+type Container struct {
+	ID    string
+	Image string
+	// URI connects directly to the container's mapped port
+	URI string
+}
+
+// Available reports whether the docker CLI is installed
+func Available() bool {
+	_, err := exec.LookPath("docker")
+	return err == nil
+}
+
+// Start runs image (e.g. "mongo:7.0"), initiates its replica set and waits until it accepts writes
+func Start(ctx context.Context, image string) (*Container, error) {
+	id, err := docker(ctx, "run", "-d", "--rm", "-p", "127.0.0.1::27017", image,
+		"--replSet", replSetName, "--bind_ip_all")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", image, err)
+	}
+	c := &Container{ID: id, Image: image}
+
+	hostPort, err := docker(ctx, "port", id, "27017/tcp")
+	if err != nil {
+		_ = c.Stop()
+		return nil, fmt.Errorf("failed to resolve mapped port: %w", err)
+	}
+	// docker port may print one line per address family
+	hostPort = strings.SplitN(hostPort, "\n", 2)[0]
+	c.URI = "mongodb://" + hostPort + "/?directConnection=true"
+
+	if err := c.initiate(ctx); err != nil {
+		_ = c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Stop removes the container
+func (c *Container) Stop() error {
+	_, err := docker(context.Background(), "rm", "-f", c.ID)
+	return err
+}
+
+// initiate initiates the single-member replica set and waits for it to elect itself primary
+func (c *Container) initiate(ctx context.Context) error {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(c.URI))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	admin := client.Database("admin")
+
+	initiated := false
+	for {
+		if !initiated {
+			cmd := bson.D{{Key: "replSetInitiate", Value: bson.D{
+				{Key: "_id", Value: replSetName},
+				{Key: "members", Value: bson.A{bson.D{{Key: "_id", Value: 0}, {Key: "host", Value: "localhost:27017"}}}},
+			}}}
+			err := admin.RunCommand(ctx, cmd).Err()
+			var cmdErr mongo.CommandError
+			// 23: AlreadyInitialized
+			initiated = err == nil || (errors.As(err, &cmdErr) && cmdErr.Code == 23)
+		}
+		if initiated {
+			var hello struct {
+				IsWritablePrimary bool `bson:"isWritablePrimary"`
+			}
+			if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err == nil && hello.IsWritablePrimary {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replica set of %s not ready: %w", c.Image, ctx.Err())
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kratos error reasons of the plugin errors
+const (
+	ReasonNotFound     = "MONGODB_NOT_FOUND"
+	ReasonDuplicateKey = "MONGODB_DUPLICATE_KEY"
+	ReasonConflict     = "MONGODB_CONFLICT"
+	ReasonTimeout      = "MONGODB_TIMEOUT"
+	ReasonUnavailable  = "MONGODB_UNAVAILABLE"
+	ReasonBadQuery     = "MONGODB_BAD_QUERY"
+	ReasonCanceled     = "MONGODB_CANCELED"
+	ReasonInternal     = "MONGODB_INTERNAL"
+)
+
+// KratosError converts a helper error to a Kratos error with the status code and reason of its
+// error kind: 404 not found, 409 conflict (reason MONGODB_DUPLICATE_KEY for duplicate keys),
+// 504 timeout, 503 unavailable, 400 bad query, 499 for a cancelled context and 500 otherwise.
+// The message is generic so driver details never reach clients; err is kept as the cause for
+// logging. Kratos errors are returned unchanged and nil stays nil.
+func KratosError(err error) *kerrors.Error {
+	if err == nil {
+		return nil
+	}
+	if se := new(kerrors.Error); errors.As(err, &se) {
+		return se
+	}
+	var ke *kerrors.Error
+	switch {
+	case errors.Is(err, ErrNotFound):
+		ke = kerrors.NotFound(ReasonNotFound, "document not found")
+	case errors.Is(err, ErrConflict) && mongo.IsDuplicateKeyError(err):
+		ke = kerrors.Conflict(ReasonDuplicateKey, "document already exists")
+	case errors.Is(err, ErrConflict):
+		ke = kerrors.Conflict(ReasonConflict, "conflicting write")
+	case errors.Is(err, ErrTimeout):
+		ke = kerrors.GatewayTimeout(ReasonTimeout, "database operation timed out")
+	case errors.Is(err, ErrUnavailable):
+		ke = kerrors.ServiceUnavailable(ReasonUnavailable, "database unavailable")
+	case errors.Is(err, ErrBadQuery):
+		ke = kerrors.BadRequest(ReasonBadQuery, "invalid query")
+	case errors.Is(err, context.Canceled):
+		ke = kerrors.ClientClosed(ReasonCanceled, "request cancelled")
+	default:
+		ke = kerrors.InternalServer(ReasonInternal, "database error")
+	}
+	return ke.WithCause(err)
+}
+
+// KratosErrors is a Kratos middleware converting handler errors of a plugin error kind with
+// KratosError. Other errors pass through unchanged, so application errors keep their own codes.
+func KratosErrors() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			reply, err := next(ctx, req)
+			if err != nil && classifyError(err) != nil {
+				return reply, KratosError(err)
+			}
+			return reply, err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestKratosError(t *testing.T) {
+	op := operation{name: "insert", database: "test", collection: "users"}
+	for _, tc := range []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{op.fail(mongo.ErrNoDocuments), 404, ReasonNotFound},
+		{op.fail(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}), 409, ReasonDuplicateKey},
+		{op.fail(mongo.CommandError{Code: 112}), 409, ReasonConflict},
+		{op.fail(context.DeadlineExceeded), 504, ReasonTimeout},
+		{&LoadShedError{Operation: "find"}, 503, ReasonUnavailable},
+		{&ScopeError{Collection: "users"}, 400, ReasonBadQuery},
+		{op.fail(context.Canceled), 499, ReasonCanceled},
+		{errors.New("boom"), 500, ReasonInternal},
+		{kerrors.Forbidden("NOPE", "nope"), 403, "NOPE"},
+	} {
+		ke := KratosError(tc.err)
+		if int(ke.Code) != tc.code || ke.Reason != tc.reason {
+			t.Errorf("KratosError(%v) = %d %s, want %d %s", tc.err, ke.Code, ke.Reason, tc.code, tc.reason)
+		}
+	}
+	if KratosError(nil) != nil {
+		t.Error("expected nil for a nil error")
+	}
+	cause := op.fail(mongo.ErrNoDocuments)
+	if ke := KratosError(cause); !errors.Is(ke, ErrNotFound) || ke.Message != "document not found" {
+		t.Errorf("expected the cause to be kept and a generic message, got %v", ke)
+	}
+}
+
+func TestKratosErrorsMiddleware(t *testing.T) {
+	appErr := errors.New("validation failed")
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{(operation{name: "find"}).fail(mongo.ErrNoDocuments), 404},
+		{appErr, 0},
+	} {
+		handler := KratosErrors()(func(context.Context, any) (any, error) { return nil, tc.err })
+		_, err := handler(context.Background(), nil)
+		if tc.code == 0 {
+			if err != appErr {
+				t.Errorf("expected application errors to pass through, got %v", err)
+			}
+			continue
+		}
+		if kerrors.Code(err) != tc.code {
+			t.Errorf("middleware code = %d, want %d", kerrors.Code(err), tc.code)
+		}
+	}
+}
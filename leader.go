@@ -0,0 +1,281 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultLeaseCollection    = "_lynx_leases"
+	defaultLeaseDuration      = 15 * time.Second
+	defaultLeaseRenewDeadline = 10 * time.Second
+	defaultLeaseRetryPeriod   = 2 * time.Second
+	// leaseReleaseTimeout bounds giving up the lease when Run returns
+	leaseReleaseTimeout = 5 * time.Second
+)
+
+// Leadership transitions, as reported in the leader transitions metric
+const (
+	LeaderGained   = "gained"
+	LeaderLost     = "lost"
+	LeaderResigned = "resigned"
+)
+
+// LeaderElectionOptions configures a LeaderElector
+type LeaderElectionOptions struct {
+	// Collection holds one lease document per election (default "_lynx_leases")
+	Collection string
+	// Identity names this instance in the lease (default hostname:pid)
+	Identity string
+	// LeaseDuration is how long a lease stays reserved to its holder without renewal; other
+	// instances take over after it expired (default 15s)
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps leading while renewals fail, for instance during a
+	// reconnect, before it steps down; it must be shorter than LeaseDuration (default 10s)
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between renewals and acquisition attempts (default 2s)
+	RetryPeriod time.Duration
+	// OnStartedLeading is called on a new goroutine when this instance becomes the leader; ctx is
+	// cancelled when leadership is lost
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when this instance stops being the leader
+	OnStoppedLeading func()
+}
+
+// LeaderElector elects one instance among the replicas of a service with a lease document renewed
+// by the leader. Leases expire on the server clock ($$NOW, MongoDB 4.2+), so instance clocks do
+// not need to agree.
+type LeaderElector struct {
+	p    *PlugMongoDB
+	name string
+	opts LeaderElectionOptions
+
+	leader atomic.Bool
+	// running is set while Run campaigns
+	running atomic.Bool
+	// cancel stops the OnStartedLeading context, nil while not leading
+	cancel context.CancelFunc
+	// callbacks waits for OnStartedLeading calls
+	callbacks sync.WaitGroup
+	// acquire overrides the lease update in tests
+	acquire func(ctx context.Context) (bool, error)
+}
+
+// NewLeaderElector returns an elector of the election name, started with Run
+func (p *PlugMongoDB) NewLeaderElector(name string, opts LeaderElectionOptions) (*LeaderElector, error) {
+	if name == "" {
+		return nil, fmt.Errorf("election name cannot be empty")
+	}
+	if opts.Collection == "" {
+		opts.Collection = defaultLeaseCollection
+	}
+	if opts.Identity == "" {
+		opts.Identity = rollingOwner()
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = defaultLeaseDuration
+	}
+	if opts.RenewDeadline <= 0 {
+		opts.RenewDeadline = min(defaultLeaseRenewDeadline, opts.LeaseDuration*2/3)
+	}
+	if opts.RetryPeriod <= 0 {
+		opts.RetryPeriod = min(defaultLeaseRetryPeriod, opts.RenewDeadline/2)
+	}
+	if opts.RenewDeadline >= opts.LeaseDuration {
+		return nil, fmt.Errorf("renew deadline %v must be shorter than the lease duration %v", opts.RenewDeadline, opts.LeaseDuration)
+	}
+	if opts.RetryPeriod >= opts.RenewDeadline {
+		return nil, fmt.Errorf("retry period %v must be shorter than the renew deadline %v", opts.RetryPeriod, opts.RenewDeadline)
+	}
+	e := &LeaderElector{p: p, name: name, opts: opts}
+	e.acquire = e.acquireLease
+	return e, nil
+}
+
+// IsLeader reports whether this instance holds the lease
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Identity returns the name of this instance in the lease
+func (e *LeaderElector) Identity() string {
+	return e.opts.Identity
+}
+
+// Run campaigns for leadership until ctx is done, then gives up the lease so another instance takes
+// over without waiting for it to expire. The leader renews its lease every RetryPeriod. Failed
+// renewals, such as during a reconnect, a failover switchover or a hot reload rebuilding the
+// client, are retried and only step the leader down once RenewDeadline passed since the last
+// renewal, before the lease can expire on the server. Lease updates run at PriorityCritical, so
+// load shedding and maintenance mode never cost the leadership. Run returns ctx.Err().
+func (e *LeaderElector) Run(ctx context.Context) error {
+	if !e.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("leader election %s is already running", e.name)
+	}
+	defer e.running.Store(false)
+	ctx = WithPriority(ctx, PriorityCritical)
+
+	var renewed time.Time
+	for {
+		start := time.Now()
+		timeout := e.opts.RenewDeadline
+		if e.IsLeader() {
+			timeout = e.opts.RenewDeadline - start.Sub(renewed)
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		held, err := e.acquire(attemptCtx)
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+		switch {
+		case held:
+			renewed = start
+			if !e.IsLeader() {
+				e.becomeLeader(ctx)
+			}
+		case err == nil:
+			if e.IsLeader() {
+				log.Warnw("key", "mongodb", "event", "leader_lost", "election", e.name, "identity", e.opts.Identity,
+					"reason", "lease taken over")
+				e.stopLeading(LeaderLost)
+			}
+		default:
+			if !e.IsLeader() {
+				log.Debugf("mongodb leader election %s: acquiring the lease failed: %v", e.name, err)
+				break
+			}
+			if time.Since(renewed) < e.opts.RenewDeadline {
+				log.Warnw("key", "mongodb", "event", "leader_renewal_failed", "election", e.name, "error", err)
+				break
+			}
+			log.Warnw("key", "mongodb", "event", "leader_lost", "election", e.name, "identity", e.opts.Identity,
+				"reason", "renew deadline exceeded", "error", err)
+			e.stopLeading(LeaderLost)
+		}
+		if sleepContext(ctx, e.opts.RetryPeriod) != nil {
+			break
+		}
+	}
+
+	if e.IsLeader() {
+		e.stopLeading(LeaderResigned)
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaseReleaseTimeout)
+		defer cancel()
+		if err := e.releaseLease(releaseCtx); err != nil {
+			log.Warnw("key", "mongodb", "event", "leader_release_failed", "election", e.name, "error", err)
+		}
+	}
+	e.callbacks.Wait()
+	return ctx.Err()
+}
+
+// becomeLeader records the gained leadership and starts OnStartedLeading
+func (e *LeaderElector) becomeLeader(ctx context.Context) {
+	e.leader.Store(true)
+	e.p.prometheusMetrics.RecordLeaderTransition(e.p.config(), e.name, LeaderGained)
+	log.Infow("key", "mongodb", "event", "leader_elected", "election", e.name, "identity", e.opts.Identity)
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.cancel = cancel
+	if e.opts.OnStartedLeading != nil {
+		e.callbacks.Add(1)
+		go func() {
+			defer e.callbacks.Done()
+			e.opts.OnStartedLeading(leaderCtx)
+		}()
+	}
+}
+
+// stopLeading records the lost leadership, cancels the OnStartedLeading context and calls
+// OnStoppedLeading
+func (e *LeaderElector) stopLeading(transition string) {
+	e.leader.Store(false)
+	e.cancel()
+	e.cancel = nil
+	e.p.prometheusMetrics.RecordLeaderTransition(e.p.config(), e.name, transition)
+	if e.opts.OnStoppedLeading != nil {
+		e.opts.OnStoppedLeading()
+	}
+}
+
+// acquireLease takes or renews the lease of the election; held is false without error when another
+// instance holds it
+func (e *LeaderElector) acquireLease(ctx context.Context) (bool, error) {
+	return e.p.takeLease(ctx, e.opts.Collection, e.name, e.opts.Identity, e.opts.LeaseDuration)
+}
+
+// releaseLease expires the lease held by this instance
+func (e *LeaderElector) releaseLease(ctx context.Context) error {
+	return e.p.dropLease(ctx, e.opts.Collection, e.name, e.opts.Identity)
+}
+
+// leaseUpdate is the update pipeline taking or renewing a lease for identity, counting holder changes
+func leaseUpdate(identity string, duration time.Duration) bson.A {
+	sameHolder := bson.D{{Key: "$eq", Value: bson.A{"$holder", identity}}}
+	return bson.A{bson.D{{Key: "$set", Value: bson.D{
+		{Key: "holder", Value: identity},
+		{Key: "lease_until", Value: bson.D{{Key: "$add", Value: bson.A{"$$NOW", duration.Milliseconds()}}}},
+		{Key: "renewed_at", Value: "$$NOW"},
+		{Key: "acquired_at", Value: bson.D{{Key: "$cond", Value: bson.A{sameHolder, "$acquired_at", "$$NOW"}}}},
+		{Key: "transitions", Value: bson.D{{Key: "$cond", Value: bson.A{sameHolder, "$transitions",
+			bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$transitions", 0}}}, 1}}}}}}},
+	}}}}
+}
+
+// takeLease takes the lease name of collection for identity when it is free or expired and renews
+// it when identity holds it; held is false without error when another identity holds it
+func (p *PlugMongoDB) takeLease(ctx context.Context, collection, name, identity string, duration time.Duration) (held bool, err error) {
+	op := operation{name: "findAndModify", database: p.databaseName(""), collection: collection}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		filter := bson.D{
+			{Key: "_id", Value: name},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "holder", Value: identity}},
+				bson.D{{Key: "$expr", Value: bson.D{{Key: "$lt", Value: bson.A{"$lease_until", "$$NOW"}}}}},
+			}},
+		}
+		err = coll.FindOneAndUpdate(ctx, filter, leaseUpdate(identity, duration), options.FindOneAndUpdate().SetUpsert(true)).Err()
+		switch {
+		case err == nil, errors.Is(err, mongo.ErrNoDocuments):
+			// The upsert created the lease
+			held = true
+			return nil
+		case mongo.IsDuplicateKeyError(err):
+			// The lease exists and another identity holds it
+			return nil
+		}
+		return err
+	})
+	return held, err
+}
+
+// dropLease expires the lease name of collection held by identity
+func (p *PlugMongoDB) dropLease(ctx context.Context, collection, name, identity string) error {
+	op := operation{name: "update", database: p.databaseName(""), collection: collection}
+	return p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		_, err = coll.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: name}, {Key: "holder", Value: identity}},
+			bson.A{bson.D{{Key: "$set", Value: bson.D{
+				{Key: "holder", Value: ""},
+				{Key: "lease_until", Value: "$$NOW"},
+			}}}})
+		return err
+	})
+}
@@ -0,0 +1,171 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewLeaderElector(t *testing.T) {
+	p := NewMongoDBClient()
+	e, err := p.NewLeaderElector("jobs", LeaderElectionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.opts.Collection != defaultLeaseCollection || e.opts.Identity == "" ||
+		e.opts.LeaseDuration != defaultLeaseDuration || e.opts.RenewDeadline != defaultLeaseRenewDeadline ||
+		e.opts.RetryPeriod != defaultLeaseRetryPeriod {
+		t.Errorf("defaults = %+v", e.opts)
+	}
+	e, err = p.NewLeaderElector("jobs", LeaderElectionOptions{LeaseDuration: 3 * time.Second})
+	if err != nil || e.opts.RenewDeadline != 2*time.Second || e.opts.RetryPeriod != time.Second {
+		t.Errorf("short lease defaults = %+v, %v", e.opts, err)
+	}
+	for _, opts := range []LeaderElectionOptions{
+		{LeaseDuration: time.Second, RenewDeadline: time.Second},
+		{RenewDeadline: time.Second, RetryPeriod: time.Second},
+	} {
+		if _, err := p.NewLeaderElector("jobs", opts); err == nil {
+			t.Errorf("NewLeaderElector(%+v) should fail", opts)
+		}
+	}
+	if _, err := p.NewLeaderElector("", LeaderElectionOptions{}); err == nil {
+		t.Error("an empty election name should fail")
+	}
+}
+
+// leaseScript plays acquisition results to an elector, one per attempt
+type leaseScript struct {
+	mu      sync.Mutex
+	results []func() (bool, error)
+	done    chan struct{}
+}
+
+func (s *leaseScript) acquire(context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.results) == 0 {
+		if s.done != nil {
+			close(s.done)
+			s.done = nil
+		}
+		return false, nil
+	}
+	next := s.results[0]
+	s.results = s.results[1:]
+	return next()
+}
+
+func TestLeaderElectorTransitions(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	e, err := p.NewLeaderElector("jobs", LeaderElectionOptions{
+		LeaseDuration: 300 * time.Millisecond,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   10 * time.Millisecond,
+		OnStartedLeading: func(ctx context.Context) {
+			record("started")
+			<-ctx.Done()
+			record("cancelled")
+		},
+		OnStoppedLeading: func() { record("stopped") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held := func() (bool, error) { return true, nil }
+	taken := func() (bool, error) { return false, nil }
+	failed := func() (bool, error) { return false, errors.New("connection reset") }
+	slowFailure := func() (bool, error) {
+		time.Sleep(120 * time.Millisecond)
+		return false, errors.New("server selection timeout")
+	}
+	leading := make(chan bool, 8)
+	check := func() (bool, error) {
+		leading <- e.IsLeader()
+		return false, errors.New("check")
+	}
+	script := &leaseScript{done: make(chan struct{}), results: []func() (bool, error){
+		// Gained, then kept through a failed renewal within the renew deadline
+		held, failed, check,
+		// Lost to another instance
+		taken, check,
+		// Gained again, then lost once renewals fail past the renew deadline
+		held, slowFailure, check,
+	}}
+	e.acquire = script.acquire
+	done := script.done
+
+	ctx, cancel := context.WithCancel(t.Context())
+	result := make(chan error)
+	go func() { result <- e.Run(ctx) }()
+	<-done
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v", err)
+	}
+
+	for i, want := range []bool{true, false, false} {
+		if got := <-leading; got != want {
+			t.Errorf("check %d: leader = %v, want %v", i, got, want)
+		}
+	}
+	if e.IsLeader() {
+		t.Error("the elector should not lead after Run returned")
+	}
+	gained := testutil.ToFloat64(p.prometheusMetrics.leaderTransitions.WithLabelValues("test", "jobs", LeaderGained))
+	lost := testutil.ToFloat64(p.prometheusMetrics.leaderTransitions.WithLabelValues("test", "jobs", LeaderLost))
+	if gained != 2 || lost != 2 {
+		t.Errorf("transitions: gained %v, lost %v", gained, lost)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 6 {
+		t.Errorf("callbacks = %v", calls)
+	}
+}
+
+func TestLeaderElectorResignsOnStop(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	e, err := p.NewLeaderElector("jobs", LeaderElectionOptions{RetryPeriod: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elected := make(chan struct{})
+	var once sync.Once
+	e.acquire = func(context.Context) (bool, error) {
+		once.Do(func() { close(elected) })
+		return true, nil
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	result := make(chan error)
+	go func() { result <- e.Run(ctx) }()
+	<-elected
+	if err := e.Run(ctx); err == nil {
+		t.Error("a second Run should fail while the first campaigns")
+	}
+	cancel()
+	<-result
+	if e.IsLeader() {
+		t.Error("the elector should resign when Run returns")
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.leader.WithLabelValues("test", "jobs")); got != 0 {
+		t.Errorf("leader gauge = %v", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.leaderTransitions.WithLabelValues("test", "jobs", LeaderResigned)); got != 1 {
+		t.Errorf("resignations = %v", got)
+	}
+}
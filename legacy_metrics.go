@@ -0,0 +1,162 @@
+package mongodb
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// descPattern extracts the name and variable labels of a metric description (prometheus.Desc.String)
+	descPattern = regexp.MustCompile(`^Desc\{fqName: "([^"]*)", .*variableLabels: \{([^}]*)\}\}$`)
+)
+
+// pluginMetricLabels returns the variable label names of every plugin metric, by metric name
+var pluginMetricLabels = sync.OnceValue(func() map[string][]string {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		for _, c := range NewPrometheusMetrics(nil).collectors() {
+			c.Describe(descs)
+		}
+		close(descs)
+	}()
+	labels := make(map[string][]string)
+	for d := range descs {
+		match := descPattern.FindStringSubmatch(d.String())
+		if match == nil {
+			continue
+		}
+		var names []string
+		for _, name := range strings.Split(match[2], ",") {
+			if name = strings.TrimSuffix(strings.TrimPrefix(name, "c("), ")"); name != "" {
+				names = append(names, name)
+			}
+		}
+		labels[match[1]] = names
+	}
+	return labels
+})
+
+// validateMetricAliases checks the legacy metric mapping table
+func validateMetricAliases(aliases []*conf.MetricAlias) error {
+	legacy := make(map[string]bool, len(aliases))
+	for _, a := range aliases {
+		if !metricNamePattern.MatchString(a.GetMetric()) {
+			return fmt.Errorf("invalid metric name %q", a.GetMetric())
+		}
+		if !metricNamePattern.MatchString(a.GetLegacyName()) {
+			return fmt.Errorf("invalid legacy name %q for metric %s", a.GetLegacyName(), a.GetMetric())
+		}
+		if legacy[a.GetLegacyName()] {
+			return fmt.Errorf("duplicate legacy name %q", a.GetLegacyName())
+		}
+		legacy[a.GetLegacyName()] = true
+		for from, to := range a.GetLabels() {
+			if !labelNamePattern.MatchString(from) || !labelNamePattern.MatchString(to) {
+				return fmt.Errorf("invalid label mapping %q -> %q for metric %s", from, to, a.GetMetric())
+			}
+		}
+		if err := checkRenamedLabels(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRenamedLabels rejects label mappings of a that would give two labels of the legacy metric the
+// same name: two labels renamed alike, or a label renamed to one the metric keeps
+func checkRenamedLabels(a *conf.MetricAlias) error {
+	if len(a.GetLabels()) == 0 {
+		return nil
+	}
+	names := pluginMetricLabels()[a.GetMetric()]
+	for from := range a.GetLabels() {
+		if !slices.Contains(names, from) {
+			names = append(names, from)
+		}
+	}
+	renamed := make(map[string]string, len(names))
+	for _, name := range names {
+		to := name
+		if mapped, ok := a.GetLabels()[name]; ok {
+			to = mapped
+		}
+		if other, ok := renamed[to]; ok {
+			return fmt.Errorf("label mapping of metric %s gives %s and %s the same legacy name %q", a.GetMetric(), min(name, other), max(name, other), to)
+		}
+		renamed[to] = name
+	}
+	return nil
+}
+
+// legacyGatherer exposes the families of base under their own names and, additionally,
+// under the configured legacy names with renamed labels
+type legacyGatherer struct {
+	base    prometheus.Gatherer
+	aliases map[string][]*conf.MetricAlias
+}
+
+// withMetricAliases wraps base with the legacy name mapping table; it returns base unchanged
+// when there are no aliases
+func withMetricAliases(base prometheus.Gatherer, aliases []*conf.MetricAlias) prometheus.Gatherer {
+	if base == nil || len(aliases) == 0 {
+		return base
+	}
+	g := &legacyGatherer{base: base, aliases: make(map[string][]*conf.MetricAlias)}
+	for _, a := range aliases {
+		g.aliases[a.GetMetric()] = append(g.aliases[a.GetMetric()], a)
+	}
+	return g
+}
+
+// Gather implements prometheus.Gatherer
+func (g *legacyGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.base.Gather()
+	names := make(map[string]bool, len(families))
+	for _, mf := range families {
+		names[mf.GetName()] = true
+	}
+
+	out := families
+	for _, mf := range families {
+		for _, a := range g.aliases[mf.GetName()] {
+			// Never shadow a current metric
+			if names[a.GetLegacyName()] {
+				continue
+			}
+			out = append(out, renameFamily(mf, a))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out, err
+}
+
+// renameFamily copies mf under the legacy name of a, renaming labels per its mapping
+func renameFamily(mf *dto.MetricFamily, a *conf.MetricAlias) *dto.MetricFamily {
+	renamed := proto.Clone(mf).(*dto.MetricFamily)
+	renamed.Name = proto.String(a.GetLegacyName())
+	help := renamed.GetHelp() + " (deprecated alias of " + mf.GetName() + ")"
+	renamed.Help = &help
+	if len(a.GetLabels()) == 0 {
+		return renamed
+	}
+	for _, m := range renamed.Metric {
+		for _, lp := range m.Label {
+			if to, ok := a.GetLabels()[lp.GetName()]; ok {
+				lp.Name = proto.String(to)
+			}
+		}
+		sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+	}
+	return renamed
+}
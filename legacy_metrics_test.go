@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+func TestMetricAliases(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	m.operationsTotal.WithLabelValues("app", "find").Inc()
+
+	aliases := []*conf.MetricAlias{
+		{Metric: "lynx_mongodb_operations_total", LegacyName: "mongodb_op_counters_total", Labels: map[string]string{"operation": "type"}},
+		// Aliases never shadow current metrics
+		{Metric: "lynx_mongodb_operations_total", LegacyName: "lynx_mongodb_errors_total"},
+	}
+	if err := validateMetricAliases(aliases); err != nil {
+		t.Fatal(err)
+	}
+	m.errorsTotal.WithLabelValues("app").Inc()
+
+	families, err := withMetricAliases(m.GetGatherer(), aliases).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, mf := range families {
+		counts[mf.GetName()]++
+		if mf.GetName() != "mongodb_op_counters_total" {
+			continue
+		}
+		labels := map[string]string{}
+		for _, lp := range mf.Metric[0].Label {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["type"] != "find" || labels["database"] != "app" {
+			t.Errorf("unexpected legacy labels %v", labels)
+		}
+	}
+	if counts["mongodb_op_counters_total"] != 1 || counts["lynx_mongodb_operations_total"] != 1 || counts["lynx_mongodb_errors_total"] != 1 {
+		t.Errorf("unexpected families %v", counts)
+	}
+
+	if err := validateMetricAliases([]*conf.MetricAlias{{Metric: "lynx_mongodb_operations_total", LegacyName: "bad-name"}}); err == nil {
+		t.Error("expected an invalid legacy name error")
+	}
+}
+
+func TestMetricAliasLabelCollisions(t *testing.T) {
+	if got := pluginMetricLabels()["lynx_mongodb_operations_total"]; !slices.Equal(got, []string{"database", "operation"}) {
+		t.Fatalf("described labels = %v", got)
+	}
+	tests := []struct {
+		labels map[string]string
+		ok     bool
+	}{
+		{map[string]string{"operation": "type"}, true},
+		{map[string]string{"operation": "database", "database": "operation"}, true},
+		{map[string]string{"operation": "database"}, false},
+		{map[string]string{"operation": "type", "database": "type"}, false},
+	}
+	for _, tt := range tests {
+		aliases := []*conf.MetricAlias{{Metric: "lynx_mongodb_operations_total", LegacyName: "mongodb_op_counters_total", Labels: tt.labels}}
+		if err := validateMetricAliases(aliases); (err == nil) != tt.ok {
+			t.Errorf("labels %v: %v", tt.labels, err)
+		}
+	}
+}
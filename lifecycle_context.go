@@ -48,12 +48,15 @@ func (p *PlugMongoDB) initializeWithContext(ctx context.Context, plugin plugins.
 	if err := p.parseConfig(cfg); err != nil {
 		return fmt.Errorf("failed to parse mongodb config: %w", err)
 	}
+	p.watchDebugConfig(cfg)
+	p.watchReloadConfig(cfg)
 	p.rt = rt.WithPluginContext(pluginName)
 
-	if p.conf.EnableMetrics && p.prometheusMetrics == nil {
+	if p.config().EnableMetrics && p.prometheusMetrics == nil {
 		p.prometheusMetrics = NewPrometheusMetrics(&PrometheusConfig{
-			Namespace: "lynx",
-			Subsystem: "mongodb",
+			Namespace:           "lynx",
+			Subsystem:           "mongodb",
+			HistogramSampleRate: p.config().GetHistogramSampleRate(),
 		})
 	}
 
@@ -65,12 +68,13 @@ func (p *PlugMongoDB) initializeWithContext(ctx context.Context, plugin plugins.
 	}
 	p.publishResourceContract()
 
-	if p.conf.EnableMetrics {
+	if p.config().EnableMetrics {
 		p.startMetricsCollection()
 	}
-	if p.conf.EnableHealthCheck {
+	if p.config().EnableHealthCheck {
 		p.startHealthCheck()
 	}
+	p.startOptionalTasks()
 
 	log.Info("mongodb plugin initialized successfully")
 	return nil
@@ -92,23 +96,46 @@ func (p *PlugMongoDB) startWithContext(ctx context.Context, plugin plugins.Plugi
 		Category: "lifecycle",
 	})
 
-	if p.client == nil {
+	if p.GetClient() == nil {
 		p.SetStatus(plugins.StatusFailed)
-		return fmt.Errorf("mongodb client is not initialized")
+		return errClientNotInitialized
 	}
 
 	if err := p.testConnectionContext(ctx); err != nil {
 		p.SetStatus(plugins.StatusFailed)
 		return fmt.Errorf("failed to test mongodb connection: %w", err)
 	}
+	if err := p.warmUp(ctx); err != nil {
+		p.SetStatus(plugins.StatusFailed)
+		return err
+	}
+	// Capabilities are resolved once at connect time so Supports never blocks
+	p.refreshServerInfo(ctx)
+	if err := p.migrateAtStartup(ctx); err != nil {
+		p.SetStatus(plugins.StatusFailed)
+		return err
+	}
+	p.provisionSchemas(ctx)
+	if err := p.ensureManagedIndexes(ctx); err != nil {
+		p.SetStatus(plugins.StatusFailed)
+		return err
+	}
+	if err := p.seedAtStartup(ctx); err != nil {
+		p.SetStatus(plugins.StatusFailed)
+		return err
+	}
+	p.emitTyped(EventConnected, plugins.PriorityNormal, ConnectedEvent{Database: p.databaseName("")})
 	p.publishResourceContract()
 
-	if p.conf != nil && p.conf.EnableMetrics && p.metricsCancel == nil {
+	if p.config().GetEnableMetrics() && p.metricsCancel == nil {
 		p.startMetricsCollection()
 	}
-	if p.conf != nil && p.conf.EnableHealthCheck && p.healthCancel == nil {
+	if p.config().GetEnableHealthCheck() && p.healthCancel == nil {
 		p.startHealthCheck()
 	}
+	if p.config() != nil {
+		p.startOptionalTasks()
+	}
 
 	p.SetStatus(plugins.StatusActive)
 	p.EmitEvent(plugins.PluginEvent{
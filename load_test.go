@@ -0,0 +1,96 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx-mongodb/internal/loadgen"
+	"github.com/go-lynx/lynx-mongodb/internal/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// TestLoad runs a mixed insert/find load through the plugin helpers and logs throughput and
+// latency percentiles. It only runs with MONGODB_LOAD_TEST=1, against MONGODB_LOAD_URI or a
+// container of MONGODB_LOAD_IMAGE (default mongo:7.0) started with docker:
+//
+//	MONGODB_LOAD_TEST=1 go test -run TestLoad -v .
+func TestLoad(t *testing.T) {
+	if os.Getenv("MONGODB_LOAD_TEST") != "1" {
+		t.Skip("set MONGODB_LOAD_TEST=1 to run the load harness")
+	}
+	ctx := context.Background()
+	uri := os.Getenv("MONGODB_LOAD_URI")
+	if uri == "" {
+		if !mongotest.Available() {
+			t.Skip("docker is not available and MONGODB_LOAD_URI is not set")
+		}
+		image := os.Getenv("MONGODB_LOAD_IMAGE")
+		if image == "" {
+			image = "mongo:7.0"
+		}
+		startCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+		container, err := mongotest.Start(startCtx, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = container.Stop() }()
+		uri = container.URI
+	}
+
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{
+		Uri:                    uri,
+		Database:               "lynx_load",
+		MaxPoolSize:            100,
+		EnableMetrics:          true,
+		ConnectTimeout:         durationpb.New(10 * time.Second),
+		ServerSelectionTimeout: durationpb.New(10 * time.Second),
+	})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	if err := p.createClientContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = p.GetClient().Disconnect(context.Background()) }()
+	coll, err := p.collectionHandle(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = coll.Drop(ctx)
+
+	workers, duration := 16, 10*time.Second
+	if v, err := strconv.Atoi(os.Getenv("MONGODB_LOAD_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("MONGODB_LOAD_DURATION")); err == nil && v > 0 {
+		duration = v
+	}
+
+	result, err := loadgen.Run(ctx, loadgen.Config{
+		Workers:  workers,
+		Duration: duration,
+		Operation: func(ctx context.Context, worker int) error {
+			customer := "c-" + strconv.Itoa(worker)
+			if _, err := coll.InsertOne(ctx, schemaOrder{Customer: customer, Total: 10, Status: "paid"}); err != nil {
+				return err
+			}
+			cur, err := coll.Find(ctx, bson.D{{Key: "customer", Value: customer}})
+			if err != nil {
+				return err
+			}
+			return cur.Close(ctx)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("load against %s: %s", uri, result)
+	if result.Errors > 0 {
+		t.Errorf("%d operations failed, first: %v", result.Errors, result.FirstError)
+	}
+}
@@ -0,0 +1,212 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+)
+
+// MaintenanceError is returned for an operation rejected because the plugin is in maintenance mode
+type MaintenanceError struct {
+	Operation string
+	Priority  Priority
+	// Since is when maintenance mode was entered
+	Since time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("%s rejected in maintenance mode since %s (priority %s)",
+		e.Operation, e.Since.Format(time.RFC3339), e.Priority)
+}
+
+// Is classifies operations rejected in maintenance mode as unavailable
+func (e *MaintenanceError) Is(target error) bool { return target == ErrUnavailable }
+
+// maintenanceRejection is the parsed maintenance.reject_priority: operations up to priority are
+// rejected unless none is set
+type maintenanceRejection struct {
+	priority Priority
+	none     bool
+}
+
+// parseMaintenance parses the maintenance configuration; "" rejects every non-critical operation
+func parseMaintenance(c *conf.Maintenance) (maintenanceRejection, error) {
+	switch strings.ToLower(c.GetRejectPriority()) {
+	case "", "high":
+		return maintenanceRejection{priority: PriorityHigh}, nil
+	case "normal":
+		return maintenanceRejection{priority: PriorityNormal}, nil
+	case "low":
+		return maintenanceRejection{priority: PriorityLow}, nil
+	case "none":
+		return maintenanceRejection{none: true}, nil
+	}
+	return maintenanceRejection{}, fmt.Errorf("invalid reject_priority %q: must be low, normal, high or none", c.GetRejectPriority())
+}
+
+// maintenanceGate tracks the helper operations in flight and rejects new ones in maintenance mode
+type maintenanceGate struct {
+	// transition serializes entering and leaving maintenance mode with the background task changes
+	transition sync.Mutex
+
+	mu       sync.Mutex
+	active   bool
+	since    time.Time
+	reject   maintenanceRejection
+	inFlight int
+	// idle is closed when inFlight drops to zero, nil while nobody waits for it
+	idle chan struct{}
+}
+
+// admit counts an operation of priority in flight until release is called; it returns a
+// *MaintenanceError when maintenance mode rejects the operation
+func (g *maintenanceGate) admit(name string, priority Priority) (release func(), err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active && !g.reject.none && priority < PriorityCritical && priority <= g.reject.priority {
+		return nil, &MaintenanceError{Operation: name, Priority: priority, Since: g.since}
+	}
+	g.inFlight++
+	return g.release, nil
+}
+
+func (g *maintenanceGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if g.inFlight == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// enter switches maintenance mode on; it reports false when it already was
+func (g *maintenanceGate) enter(reject maintenanceRejection, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active {
+		return false
+	}
+	g.active, g.since, g.reject = true, now, reject
+	return true
+}
+
+// exit switches maintenance mode off and returns when it was entered; ok is false when it was not on
+func (g *maintenanceGate) exit() (since time.Time, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.active {
+		return time.Time{}, false
+	}
+	g.active = false
+	return g.since, true
+}
+
+// status reports whether maintenance mode is on, since when, and the operations in flight
+func (g *maintenanceGate) status() (active bool, since time.Time, inFlight int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active, g.since, g.inFlight
+}
+
+// wait returns once no operation is in flight or with the context error
+func (g *maintenanceGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.inFlight == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EnterMaintenance quiesces the plugin for a controlled cluster upgrade: it stops the background
+// collectors, health checks and change stream watchers, rejects new helper operations up to
+// maintenance.reject_priority (every non-critical operation by default) with a *MaintenanceError,
+// and waits until the helper operations in flight complete. The plugin stays in maintenance mode
+// until ExitMaintenance, also when waiting fails with the context error. Calls while in
+// maintenance mode wait for the operations in flight again. Operations issued on the raw driver
+// handles are neither rejected nor waited for.
+func (p *PlugMongoDB) EnterMaintenance(ctx context.Context) error {
+	if p.loadState() == nil {
+		return errClientNotInitialized
+	}
+	reject, err := parseMaintenance(p.config().GetMaintenance())
+	if err != nil {
+		return err
+	}
+	p.maintenance.transition.Lock()
+	if p.maintenance.enter(reject, time.Now()) {
+		if err := p.stopBackgroundTasksContext(ctx); err != nil {
+			p.maintenance.transition.Unlock()
+			return fmt.Errorf("failed to stop background tasks: %w", err)
+		}
+		p.prometheusMetrics.RecordMaintenance(p.config(), true)
+		log.Warnw("key", "mongodb", "event", "maintenance_entered")
+		p.emitTyped(EventMaintenance, plugins.PriorityHigh, MaintenanceEvent{Active: true})
+	}
+	p.maintenance.transition.Unlock()
+
+	start := time.Now()
+	if err := p.maintenance.wait(ctx); err != nil {
+		_, _, inFlight := p.maintenance.status()
+		return fmt.Errorf("%d operations still in flight: %w", inFlight, err)
+	}
+	log.Infow("key", "mongodb", "event", "maintenance_drained", "wait", time.Since(start))
+	return nil
+}
+
+// ExitMaintenance leaves maintenance mode: operations are accepted again and the background tasks
+// restart. It is a no-op when the plugin is not in maintenance mode.
+func (p *PlugMongoDB) ExitMaintenance() {
+	p.maintenance.transition.Lock()
+	defer p.maintenance.transition.Unlock()
+	since, ok := p.maintenance.exit()
+	if !ok {
+		return
+	}
+	if p.loadState() != nil {
+		p.restartBackgroundTasks()
+	}
+	p.prometheusMetrics.RecordMaintenance(p.config(), false)
+	log.Infow("key", "mongodb", "event", "maintenance_exited", "duration", time.Since(since))
+	p.emitTyped(EventMaintenance, plugins.PriorityHigh, MaintenanceEvent{Duration: time.Since(since)})
+}
+
+// InMaintenance reports whether the plugin is in maintenance mode
+func (p *PlugMongoDB) InMaintenance() bool {
+	active, _, _ := p.maintenance.status()
+	return active
+}
+
+// restartBackgroundTasks starts the background tasks stopped by stopBackgroundTasksContext
+func (p *PlugMongoDB) restartBackgroundTasks() {
+	if p.config().EnableMetrics && p.metricsCancel == nil {
+		p.startMetricsCollection()
+	}
+	if p.config().EnableHealthCheck && p.healthCancel == nil {
+		p.startHealthCheck()
+	}
+	p.startOptionalTasks()
+	p.stats.mu.Lock()
+	tracked := len(p.stats.entries) > 0
+	p.stats.mu.Unlock()
+	if tracked {
+		p.startStatsRefresh()
+	}
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestParseMaintenance(t *testing.T) {
+	for _, tt := range []struct {
+		priority string
+		want     maintenanceRejection
+		wantErr  bool
+	}{
+		{"", maintenanceRejection{priority: PriorityHigh}, false},
+		{"normal", maintenanceRejection{priority: PriorityNormal}, false},
+		{"LOW", maintenanceRejection{priority: PriorityLow}, false},
+		{"none", maintenanceRejection{none: true}, false},
+		{"critical", maintenanceRejection{}, true},
+	} {
+		got, err := parseMaintenance(&conf.Maintenance{RejectPriority: tt.priority})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMaintenance(%q) = %+v, %v", tt.priority, got, err)
+		}
+	}
+}
+
+func TestMaintenanceGate(t *testing.T) {
+	var g maintenanceGate
+	release, err := g.admit("find", PriorityLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.enter(maintenanceRejection{priority: PriorityNormal}, time.Now()) || g.enter(maintenanceRejection{}, time.Now()) {
+		t.Fatal("enter should only switch maintenance mode on once")
+	}
+	for priority, rejected := range map[Priority]bool{PriorityLow: true, PriorityNormal: true, PriorityHigh: false, PriorityCritical: false} {
+		done, err := g.admit("find", priority)
+		if rejected != (err != nil) {
+			t.Errorf("priority %s: rejected = %v", priority, err != nil)
+		}
+		if err == nil {
+			done()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait with an operation in flight = %v", err)
+	}
+	waited := make(chan error)
+	go func() { waited <- g.wait(t.Context()) }()
+	release()
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := g.exit(); !ok {
+		t.Fatal("exit should report maintenance mode was on")
+	}
+	if _, err := g.admit("find", PriorityLow); err != nil {
+		t.Errorf("admit after exit = %v", err)
+	}
+}
+
+func TestEnterMaintenance(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{
+		Uri:                    "mongodb://localhost:1",
+		Database:               "app",
+		ConnectTimeout:         durationpb.New(100 * time.Millisecond),
+		ServerSelectionTimeout: durationpb.New(50 * time.Millisecond),
+	})
+	if err := normalizeConf(p.config()); err != nil {
+		t.Fatal(err)
+	}
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	p.startPeriodicTask("collector", time.Hour, func(context.Context) {})
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = p.runOperation(context.Background(), operation{name: "find", database: "app"}, func(context.Context) error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.EnterMaintenance(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("EnterMaintenance with an operation in flight = %v", err)
+	}
+	if !p.InMaintenance() || len(p.periodicCancels) != 0 {
+		t.Fatal("maintenance mode should stay on with the background tasks stopped")
+	}
+
+	err = p.runOperation(context.Background(), operation{name: "find", database: "app"}, func(context.Context) error { return nil })
+	var me *MaintenanceError
+	if !errors.As(err, &me) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("operation in maintenance mode = %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.maintenanceRejections.WithLabelValues("app", "normal")); got != 1 {
+		t.Errorf("rejections = %v", got)
+	}
+	critical := WithPriority(context.Background(), PriorityCritical)
+	if err := p.runOperation(critical, operation{name: "find", database: "app"}, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("critical operation in maintenance mode = %v", err)
+	}
+
+	close(finish)
+	if err := p.EnterMaintenance(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.maintenance.WithLabelValues("app")); got != 1 {
+		t.Errorf("maintenance gauge = %v", got)
+	}
+
+	p.ExitMaintenance()
+	if p.InMaintenance() {
+		t.Fatal("maintenance mode should be off")
+	}
+	if err := p.runOperation(context.Background(), operation{name: "find", database: "app"}, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("operation after maintenance = %v", err)
+	}
+	_ = p.stopBackgroundTasksContext(context.Background())
+}
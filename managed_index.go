@@ -0,0 +1,383 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Managed index conflict modes (index_conflict)
+const (
+	// IndexConflictSkip logs conflicting indexes and leaves them in place
+	IndexConflictSkip = "skip"
+	// IndexConflictRecreate drops conflicting indexes and builds the managed ones
+	IndexConflictRecreate = "recreate"
+	// IndexConflictFail fails startup on a conflicting or failed index
+	IndexConflictFail = "fail"
+)
+
+// Managed index results
+const (
+	IndexCreated   = "created"
+	IndexExists    = "exists"
+	IndexRecreated = "recreated"
+	IndexSkipped   = "skipped"
+	IndexFailed    = "failed"
+	// IndexDeferred is an index build queued for the DDL window
+	IndexDeferred = "deferred"
+)
+
+const (
+	// codeIndexOptionsConflict is returned when an index with the same keys has other options or name
+	codeIndexOptionsConflict = 85
+	// codeIndexKeySpecsConflict is returned when an index with the same name has other keys
+	codeIndexKeySpecsConflict = 86
+)
+
+var (
+	managedIndexesMu sync.RWMutex
+	managedIndexes   []IndexSpec
+)
+
+// IndexResult is the outcome of ensuring a managed index
+type IndexResult struct {
+	Collection string `json:"collection"`
+	Index      string `json:"index"`
+	// Result is one of the Index* results
+	Result string `json:"result"`
+	// Detail describes the conflict or the error
+	Detail string `json:"detail,omitempty"`
+}
+
+// RegisterIndexes registers indexes ensured at startup (and by EnsureManagedIndexes) together
+// with the indexes of the config. Application packages register them from init functions;
+// registering an index of the same collection and name again replaces it.
+func RegisterIndexes(specs ...IndexSpec) {
+	managedIndexesMu.Lock()
+	defer managedIndexesMu.Unlock()
+	for _, spec := range specs {
+		i := slices.IndexFunc(managedIndexes, func(s IndexSpec) bool {
+			return s.Collection == spec.Collection && s.indexName() == spec.indexName()
+		})
+		if i >= 0 {
+			managedIndexes[i] = spec
+		} else {
+			managedIndexes = append(managedIndexes, spec)
+		}
+	}
+}
+
+func registeredIndexes() []IndexSpec {
+	managedIndexesMu.RLock()
+	defer managedIndexesMu.RUnlock()
+	return slices.Clone(managedIndexes)
+}
+
+// indexSpecFromConf converts a configured index
+func indexSpecFromConf(cfg *conf.ManagedIndex) (IndexSpec, error) {
+	spec := IndexSpec{
+		Collection: cfg.GetCollection(),
+		Name:       cfg.GetName(),
+		Unique:     cfg.GetUnique(),
+		Sparse:     cfg.GetSparse(),
+		TTL:        cfg.GetTtl().AsDuration(),
+	}
+	if spec.Collection == "" {
+		return spec, fmt.Errorf("index collection cannot be empty")
+	}
+	if len(cfg.GetKeys()) == 0 {
+		return spec, fmt.Errorf("index on %s has no keys", spec.Collection)
+	}
+	for _, key := range cfg.GetKeys() {
+		field, kind, typed := strings.Cut(key, ":")
+		switch {
+		case typed && kind != "text" && kind != "2dsphere" && kind != "hashed":
+			return spec, fmt.Errorf("index key %q on %s: type must be text, 2dsphere or hashed", key, spec.Collection)
+		case typed:
+			spec.Keys = append(spec.Keys, bson.E{Key: field, Value: kind})
+		case strings.HasPrefix(field, "-"):
+			spec.Keys = append(spec.Keys, bson.E{Key: field[1:], Value: -1})
+		default:
+			spec.Keys = append(spec.Keys, bson.E{Key: field, Value: 1})
+		}
+		if strings.TrimPrefix(field, "-") == "" {
+			return spec, fmt.Errorf("index key %q on %s has no field", key, spec.Collection)
+		}
+	}
+	if filter := cfg.GetPartialFilter(); filter != "" {
+		if err := bson.UnmarshalExtJSON([]byte(filter), false, &spec.PartialFilter); err != nil {
+			return spec, fmt.Errorf("invalid partial_filter of index on %s: %w", spec.Collection, err)
+		}
+	}
+	return spec, nil
+}
+
+// configuredIndexes validates index_conflict and converts the configured indexes
+func configuredIndexes(cfg *conf.MongoDB) ([]IndexSpec, error) {
+	switch cfg.GetIndexConflict() {
+	case "", IndexConflictSkip, IndexConflictRecreate, IndexConflictFail:
+	default:
+		return nil, fmt.Errorf("invalid index_conflict %q: must be skip, recreate or fail", cfg.GetIndexConflict())
+	}
+	specs := make([]IndexSpec, 0, len(cfg.GetIndexes()))
+	for _, c := range cfg.GetIndexes() {
+		spec, err := indexSpecFromConf(c)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// indexName returns the index name, or the name the driver derives from the keys
+func (s IndexSpec) indexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	raw, err := bson.Marshal(s.Keys)
+	if err != nil {
+		return fmt.Sprint(s.Keys)
+	}
+	return keyPattern(raw)
+}
+
+// indexConflicts returns the existing indexes spec conflicts with: the index with its key pattern
+// under another name or with other unique, sparse, TTL or partial filter options, and another
+// index with its name. exists reports an identical index.
+func indexConflicts(spec IndexSpec, existing []bson.Raw) (conflicts []string, detail string, exists bool) {
+	name, pattern := spec.indexName(), spec.keyPattern()
+	var details []string
+	for _, idx := range existing {
+		idxName, _ := idx.Lookup("name").StringValueOK()
+		samePattern := keyPattern(idx.Lookup("key").Document()) == pattern
+		switch {
+		case samePattern && idxName == name:
+			diff := indexOptionsDiff(spec, idx)
+			if !partialFilterMatches(spec.PartialFilter, idx) {
+				diff = strings.TrimPrefix(diff+", partial filter differs", ", ")
+			}
+			if diff == "" {
+				return nil, "", true
+			}
+			conflicts = append(conflicts, idxName)
+			details = append(details, diff)
+		case samePattern:
+			conflicts = append(conflicts, idxName)
+			details = append(details, fmt.Sprintf("same keys as index %s", idxName))
+		case idxName == name:
+			conflicts = append(conflicts, idxName)
+			details = append(details, fmt.Sprintf("index %s has keys %s", idxName, keyPattern(idx.Lookup("key").Document())))
+		}
+	}
+	return conflicts, strings.Join(details, "; "), false
+}
+
+// partialFilterMatches reports whether idx has the partial filter expression filter, ignoring
+// numeric types
+func partialFilterMatches(filter bson.D, idx bson.Raw) bool {
+	stored, err := idx.LookupErr("partialFilterExpression")
+	if err != nil {
+		return len(filter) == 0
+	}
+	var have, want bson.M
+	if err := stored.Unmarshal(&have); err != nil {
+		return false
+	}
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return false
+	}
+	if err := bson.Unmarshal(raw, &want); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeNumbers(want), normalizeNumbers(have))
+}
+
+// isIndexConflict reports a createIndexes rejection caused by an existing index
+func isIndexConflict(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && (se.HasErrorCode(codeIndexOptionsConflict) || se.HasErrorCode(codeIndexKeySpecsConflict))
+}
+
+// EnsureManagedIndexes ensures the indexes of the config and of RegisterIndexes, one at a time,
+// handling conflicts with existing indexes according to index_conflict. It returns the outcome of
+// every index; the error reports the first failure in fail mode or a failure to list indexes.
+func (p *PlugMongoDB) EnsureManagedIndexes(ctx context.Context) ([]IndexResult, error) {
+	specs, err := configuredIndexes(p.config())
+	if err != nil {
+		return nil, err
+	}
+	specs = append(specs, registeredIndexes()...)
+	specs = append(specs, outboxIndexes(p.config())...)
+	mode := p.config().GetIndexConflict()
+	if mode == "" {
+		mode = IndexConflictSkip
+	}
+
+	existing := make(map[string][]bson.Raw)
+	results := make([]IndexResult, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Collection == "" || len(spec.Keys) == 0 {
+			res := IndexResult{Collection: spec.Collection, Index: spec.Name, Result: IndexFailed, Detail: "index spec needs a collection and keys"}
+			p.reportManagedIndex(ctx, res)
+			results = append(results, res)
+			if mode == IndexConflictFail {
+				return results, fmt.Errorf("index %s on %s failed: %s", res.Index, res.Collection, res.Detail)
+			}
+			continue
+		}
+		indexes, ok := existing[spec.Collection]
+		if !ok {
+			if indexes, err = p.listIndexes(ctx, spec.Collection); err != nil {
+				return results, err
+			}
+			existing[spec.Collection] = indexes
+		}
+		res := p.ensureManagedIndex(ctx, spec, indexes, mode)
+		p.reportManagedIndex(ctx, res)
+		results = append(results, res)
+		if res.Result == IndexFailed && mode == IndexConflictFail {
+			return results, fmt.Errorf("index %s on %s failed: %s", res.Index, res.Collection, res.Detail)
+		}
+	}
+	return results, nil
+}
+
+func (p *PlugMongoDB) listIndexes(ctx context.Context, collection string) ([]bson.Raw, error) {
+	var indexes []bson.Raw
+	op := operation{name: "listIndexes", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		indexes, err = listIndexDocuments(ctx, db.Collection(collection))
+		var ce mongo.CommandError
+		if errors.As(err, &ce) && ce.Name == "NamespaceNotFound" {
+			// createIndexes creates the collection
+			indexes, err = nil, nil
+		}
+		return err
+	})
+	return indexes, err
+}
+
+func (p *PlugMongoDB) ensureManagedIndex(ctx context.Context, spec IndexSpec, existing []bson.Raw, mode string) IndexResult {
+	res := IndexResult{Collection: spec.Collection, Index: spec.indexName()}
+	conflicts, detail, exists := indexConflicts(spec, existing)
+	if exists {
+		res.Result = IndexExists
+		return res
+	}
+	if len(conflicts) == 0 {
+		_, err := p.EnsureIndexes(ctx, spec)
+		if !isIndexConflict(err) {
+			return indexOutcome(res, IndexCreated, err)
+		}
+		// An option indexConflicts does not compare, such as the collation, differs
+		conflicts, detail = []string{res.Index}, err.Error()
+	}
+
+	res.Detail = detail
+	switch mode {
+	case IndexConflictFail:
+		res.Result = IndexFailed
+		return res
+	case IndexConflictRecreate:
+		if slices.Contains(conflicts, "_id_") {
+			res.Result, res.Detail = IndexFailed, "the _id index cannot be recreated: "+detail
+			return res
+		}
+		return indexOutcome(res, IndexRecreated, p.recreateIndex(ctx, spec, conflicts))
+	}
+	res.Result = IndexSkipped
+	return res
+}
+
+// recreateIndex drops the conflicting indexes and builds spec in one DDL operation
+func (p *PlugMongoDB) recreateIndex(ctx context.Context, spec IndexSpec, conflicts []string) error {
+	return p.RunDDL(ctx, DDLCreateIndexes, p.ddlNamespace(spec.Collection), func(ctx context.Context) error {
+		for _, name := range conflicts {
+			op := operation{name: "dropIndexes", database: p.databaseName(""), collection: spec.Collection}
+			err := p.runOperation(ctx, op, func(ctx context.Context) error {
+				coll, err := p.collectionHandle(ctx, spec.Collection)
+				if err != nil {
+					return err
+				}
+				_, err = coll.Indexes().DropOne(ctx, name)
+				return err
+			})
+			p.audit(ctx, AuditEvent{Action: "dropIndex", Namespace: op.namespace(), Details: map[string]any{"index": name, "source": "managed_indexes"}, Err: err})
+			if err != nil {
+				return err
+			}
+		}
+		// The window is open: build now rather than queueing the build after the drop
+		_, err := p.EnsureIndexes(BypassDDLWindow(ctx), spec)
+		return err
+	})
+}
+
+// indexOutcome sets the result of an index build: ok on success, deferred when queued for the
+// DDL window, failed otherwise
+func indexOutcome(res IndexResult, ok string, err error) IndexResult {
+	var deferred *DDLDeferredError
+	switch {
+	case err == nil:
+		res.Result = ok
+	case errors.As(err, &deferred):
+		res.Result = IndexDeferred
+	default:
+		res.Result, res.Detail = IndexFailed, err.Error()
+	}
+	return res
+}
+
+func (p *PlugMongoDB) reportManagedIndex(ctx context.Context, res IndexResult) {
+	if name, ok := p.metricsCollection(p.databaseName(""), res.Collection); ok {
+		p.prometheusMetrics.RecordManagedIndex(p.config(), name, res.Result)
+	}
+	switch res.Result {
+	case IndexSkipped, IndexFailed:
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "managed_index_"+res.Result, "collection", res.Collection,
+			"index", res.Index, "detail", res.Detail)
+	case IndexCreated, IndexRecreated, IndexDeferred:
+		log.InfowCtx(ctx, "key", "mongodb", "event", "managed_index_"+res.Result, "collection", res.Collection,
+			"index", res.Index, "detail", res.Detail)
+	}
+}
+
+// ensureManagedIndexes ensures the managed indexes at startup. Failures are logged and do not
+// prevent the plugin from starting unless index_conflict is fail.
+func (p *PlugMongoDB) ensureManagedIndexes(ctx context.Context) error {
+	if len(p.config().GetIndexes()) == 0 && len(registeredIndexes()) == 0 && len(outboxIndexes(p.config())) == 0 {
+		return nil
+	}
+	start := time.Now()
+	results, err := p.EnsureManagedIndexes(ctx)
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[res.Result]++
+	}
+	if err != nil {
+		if p.config().GetIndexConflict() == IndexConflictFail {
+			return fmt.Errorf("failed to ensure managed indexes: %w", err)
+		}
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "managed_indexes_failed", "error", err)
+	}
+	log.InfowCtx(ctx, "key", "mongodb", "event", "managed_indexes_ensured", "created", counts[IndexCreated],
+		"exists", counts[IndexExists], "recreated", counts[IndexRecreated], "skipped", counts[IndexSkipped],
+		"failed", counts[IndexFailed], "deferred", counts[IndexDeferred], "duration", time.Since(start))
+	return nil
+}
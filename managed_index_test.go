@@ -0,0 +1,112 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestIndexSpecFromConf(t *testing.T) {
+	spec, err := indexSpecFromConf(&conf.ManagedIndex{
+		Collection:    "orders",
+		Keys:          []string{"tenant", "-created_at", "title:text"},
+		Unique:        true,
+		Ttl:           durationpb.New(time.Hour),
+		PartialFilter: `{"status": "active", "total": {"$gt": 10}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "tenant", Value: 1}, {Key: "created_at", Value: -1}, {Key: "title", Value: "text"}}
+	if len(spec.Keys) != 3 || spec.Keys[1] != want[1] || spec.Keys[2] != want[2] {
+		t.Errorf("keys = %v, want %v", spec.Keys, want)
+	}
+	if !spec.Unique || spec.TTL != time.Hour || len(spec.PartialFilter) != 2 {
+		t.Errorf("unexpected spec: %+v", spec)
+	}
+	if got := spec.indexName(); got != "tenant_1_created_at_-1_title_text" {
+		t.Errorf("indexName() = %q", got)
+	}
+
+	for _, cfg := range []*conf.ManagedIndex{
+		{Keys: []string{"a"}},
+		{Collection: "orders"},
+		{Collection: "orders", Keys: []string{"a:btree"}},
+		{Collection: "orders", Keys: []string{"-"}},
+		{Collection: "orders", Keys: []string{"a"}, PartialFilter: "{"},
+	} {
+		if _, err := indexSpecFromConf(cfg); err == nil {
+			t.Errorf("expected an error for %v", cfg)
+		}
+	}
+	if _, err := configuredIndexes(&conf.MongoDB{IndexConflict: "drop"}); err == nil {
+		t.Error("expected an error for an invalid index_conflict")
+	}
+}
+
+func TestIndexConflicts(t *testing.T) {
+	index := func(d bson.D) bson.Raw {
+		raw, err := bson.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	existing := []bson.Raw{
+		index(bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}}),
+		index(bson.D{{Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email_1"}, {Key: "unique", Value: true}}),
+		index(bson.D{{Key: "key", Value: bson.D{{Key: "sku", Value: int64(1)}}}, {Key: "name", Value: "by_sku"},
+			{Key: "partialFilterExpression", Value: bson.D{{Key: "active", Value: true}}}}),
+		index(bson.D{{Key: "key", Value: bson.D{{Key: "a", Value: 1}}}, {Key: "name", Value: "custom"}}),
+	}
+	for _, tc := range []struct {
+		spec      IndexSpec
+		conflicts []string
+		exists    bool
+	}{
+		{IndexSpec{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true}, nil, true},
+		{IndexSpec{Keys: bson.D{{Key: "email", Value: 1}}}, []string{"email_1"}, false},
+		{IndexSpec{Name: "by_sku", Keys: bson.D{{Key: "sku", Value: 1}}, PartialFilter: bson.D{{Key: "active", Value: true}}}, nil, true},
+		{IndexSpec{Name: "by_sku", Keys: bson.D{{Key: "sku", Value: 1}}}, []string{"by_sku"}, false},
+		{IndexSpec{Keys: bson.D{{Key: "a", Value: 1}}}, []string{"custom"}, false},
+		{IndexSpec{Name: "custom", Keys: bson.D{{Key: "b", Value: 1}}}, []string{"custom"}, false},
+		{IndexSpec{Keys: bson.D{{Key: "b", Value: 1}}}, nil, false},
+	} {
+		conflicts, detail, exists := indexConflicts(tc.spec, existing)
+		if exists != tc.exists || len(conflicts) != len(tc.conflicts) || (len(conflicts) > 0 && conflicts[0] != tc.conflicts[0]) {
+			t.Errorf("indexConflicts(%s) = %v, %q, %v; want %v, %v", tc.spec.indexName(), conflicts, detail, exists, tc.conflicts, tc.exists)
+		}
+		if len(conflicts) > 0 && detail == "" {
+			t.Errorf("indexConflicts(%s): expected a conflict detail", tc.spec.indexName())
+		}
+	}
+
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	conflicting := IndexSpec{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}}
+	if res := p.ensureManagedIndex(context.Background(), conflicting, existing, IndexConflictSkip); res.Result != IndexSkipped {
+		t.Errorf("skip mode result = %+v", res)
+	}
+	if res := p.ensureManagedIndex(context.Background(), conflicting, existing, IndexConflictFail); res.Result != IndexFailed {
+		t.Errorf("fail mode result = %+v", res)
+	}
+	idIndex := IndexSpec{Collection: "users", Name: "_id_", Keys: bson.D{{Key: "_id", Value: -1}}}
+	if res := p.ensureManagedIndex(context.Background(), idIndex, existing, IndexConflictRecreate); res.Result != IndexFailed {
+		t.Errorf("recreating _id_: result = %+v", res)
+	}
+}
+
+func TestRegisterIndexes(t *testing.T) {
+	defer func() { managedIndexes = nil }()
+	RegisterIndexes(IndexSpec{Collection: "orders", Keys: bson.D{{Key: "tenant", Value: 1}}})
+	RegisterIndexes(IndexSpec{Collection: "orders", Keys: bson.D{{Key: "tenant", Value: 1}}, Unique: true},
+		IndexSpec{Collection: "carts", Keys: bson.D{{Key: "tenant", Value: 1}}})
+	specs := registeredIndexes()
+	if len(specs) != 2 || !specs[0].Unique || specs[1].Collection != "carts" {
+		t.Errorf("unexpected registered indexes: %+v", specs)
+	}
+}
@@ -0,0 +1,614 @@
+package mongodb
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultMigrationCollection  = "schema_migrations"
+	defaultMigrationLockTimeout = 5 * time.Minute
+	// migrationLease is how long the migration lock stays reserved without renewal; the runner
+	// renews it every third of it
+	migrationLease = time.Minute
+	// migrationLockRetry is the interval between attempts to take the migration lock
+	migrationLockRetry = 2 * time.Second
+)
+
+// Migration directions, as reported in the migrations metric
+const (
+	MigrationUp   = "up"
+	MigrationDown = "down"
+)
+
+// errMigrationLockLost cancels running migrations once another instance may have taken the lock
+var errMigrationLockLost = errors.New("migration lock lost")
+
+var (
+	registeredMigrationsMu sync.RWMutex
+	registeredMigrationSet []Migration
+)
+
+// Migration is a versioned schema change. Migrations are not transactional: one failing halfway is
+// run again in full by the next run, so Up and Down should tolerate running twice.
+type Migration struct {
+	// Version orders migrations: a decimal number such as 3 or 20240611120000
+	Version string
+	// Name describes the migration
+	Name string
+	// Up applies the migration to the database of the plugin
+	Up func(ctx context.Context, db *mongo.Database) error
+	// Down reverts the migration, nil when it cannot be reverted
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationStatus is the state of a migration
+type MigrationStatus struct {
+	Version string `json:"version"`
+	Name    string `json:"name"`
+	// AppliedAt is zero for pending migrations
+	AppliedAt time.Time `json:"applied_at,omitzero"`
+	// AppliedBy is the instance (hostname:pid) that applied the migration
+	AppliedBy string `json:"applied_by,omitempty"`
+	// Reversible reports a Down migration
+	Reversible bool `json:"reversible"`
+	// Unknown marks applied migrations this binary does not define, such as ones of a newer release
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// migrationRecord is the document of an applied migration in the migrations collection
+type migrationRecord struct {
+	Version    string    `bson:"_id"`
+	Name       string    `bson:"name"`
+	AppliedAt  time.Time `bson:"applied_at"`
+	AppliedBy  string    `bson:"applied_by"`
+	DurationMs int64     `bson:"duration_ms"`
+}
+
+// RegisterMigrations registers migrations applied by MigrateUp together with the scripts of
+// migrations.dir. Application packages register them from init functions; registering a migration
+// of the same version again replaces it.
+func RegisterMigrations(migrations ...Migration) {
+	registeredMigrationsMu.Lock()
+	defer registeredMigrationsMu.Unlock()
+	for _, m := range migrations {
+		i := slices.IndexFunc(registeredMigrationSet, func(r Migration) bool { return r.Version == m.Version })
+		if i >= 0 {
+			registeredMigrationSet[i] = m
+		} else {
+			registeredMigrationSet = append(registeredMigrationSet, m)
+		}
+	}
+}
+
+func registeredMigrations() []Migration {
+	registeredMigrationsMu.RLock()
+	defer registeredMigrationsMu.RUnlock()
+	return slices.Clone(registeredMigrationSet)
+}
+
+// MigrationScript returns a migration running JSON command scripts: arrays of database commands in
+// MongoDB Extended JSON, run in order. down is optional.
+//
+//	[
+//	  {"createIndexes": "orders", "indexes": [{"key": {"customer": 1}, "name": "customer_1"}]},
+//	  {"update": "orders", "updates": [{"q": {"status": {"$exists": false}}, "u": {"$set": {"status": "open"}}, "multi": true}]}
+//	]
+func MigrationScript(version, name string, up, down []byte) (Migration, error) {
+	m := Migration{Version: version, Name: name}
+	commands, err := parseCommandScript(up)
+	if err != nil {
+		return m, fmt.Errorf("migration %s up script: %w", version, err)
+	}
+	m.Up = runCommandScript(commands)
+	if len(down) > 0 {
+		commands, err := parseCommandScript(down)
+		if err != nil {
+			return m, fmt.Errorf("migration %s down script: %w", version, err)
+		}
+		m.Down = runCommandScript(commands)
+	}
+	return m, nil
+}
+
+// parseCommandScript parses an array of commands in Extended JSON
+func parseCommandScript(data []byte) ([]bson.D, error) {
+	var script struct {
+		Commands []bson.D `bson:"commands"`
+	}
+	wrapped := append(append([]byte(`{"commands":`), data...), '}')
+	if err := bson.UnmarshalExtJSON(wrapped, false, &script); err != nil {
+		return nil, fmt.Errorf("invalid command script: %w", err)
+	}
+	if len(script.Commands) == 0 {
+		return nil, fmt.Errorf("command script has no commands")
+	}
+	for i, cmd := range script.Commands {
+		if len(cmd) == 0 {
+			return nil, fmt.Errorf("command %d is empty", i+1)
+		}
+	}
+	return script.Commands, nil
+}
+
+func runCommandScript(commands []bson.D) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for i, cmd := range commands {
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return fmt.Errorf("command %d (%s): %w", i+1, cmd[0].Key, err)
+			}
+		}
+		return nil
+	}
+}
+
+// loadMigrationScripts loads the scripts of dir, named <version>_<name>.up.json with an optional
+// <version>_<name>.down.json
+func loadMigrationScripts(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations dir: %w", err)
+	}
+	var out []Migration
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".up.json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		version, name, ok := strings.Cut(base, "_")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("migration script %s must be named <version>_<name>.up.json", entry.Name())
+		}
+		up, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		down, err := os.ReadFile(filepath.Join(dir, base+".down.json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		m, err := MigrationScript(version, name, up, down)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// validMigrationVersion reports whether v is a decimal number
+func validMigrationVersion(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareMigrationVersions compares decimal versions numerically
+func compareMigrationVersions(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// orderMigrations validates migrations and sorts them by version
+func orderMigrations(migrations []Migration) ([]Migration, error) {
+	for _, m := range migrations {
+		if !validMigrationVersion(m.Version) {
+			return nil, fmt.Errorf("migration %q: version %q must be a decimal number", m.Name, m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %s has no Up function", m.Version)
+		}
+	}
+	slices.SortStableFunc(migrations, func(a, b Migration) int { return compareMigrationVersions(a.Version, b.Version) })
+	for i := 1; i < len(migrations); i++ {
+		if compareMigrationVersions(migrations[i-1].Version, migrations[i].Version) == 0 {
+			return nil, fmt.Errorf("migration version %s is defined twice (%s, %s)", migrations[i].Version,
+				migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// collectMigrations returns the registered and scripted migrations ordered by version
+func (p *PlugMongoDB) collectMigrations() ([]Migration, error) {
+	migrations := registeredMigrations()
+	if dir := p.config().GetMigrations().GetDir(); dir != "" {
+		scripts, err := loadMigrationScripts(dir)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, scripts...)
+	}
+	return orderMigrations(migrations)
+}
+
+type migrationSettings struct {
+	collection  string
+	lockTimeout time.Duration
+	lease       time.Duration
+	retry       time.Duration
+}
+
+func migrationSettingsOf(cfg *conf.Migrations) migrationSettings {
+	s := migrationSettings{
+		collection:  cfg.GetCollection(),
+		lockTimeout: cfg.GetLockTimeout().AsDuration(),
+		lease:       migrationLease,
+		retry:       migrationLockRetry,
+	}
+	if s.collection == "" {
+		s.collection = defaultMigrationCollection
+	}
+	if s.lockTimeout <= 0 {
+		s.lockTimeout = defaultMigrationLockTimeout
+	}
+	return s
+}
+
+// migrationStore keeps the migration lock and the applied migrations
+type migrationStore interface {
+	// lock takes or renews the migration lock; held is false without error when another instance
+	// holds it
+	lock(ctx context.Context) (held bool, err error)
+	unlock(ctx context.Context) error
+	applied(ctx context.Context) (map[string]migrationRecord, error)
+	record(ctx context.Context, r migrationRecord) error
+	forget(ctx context.Context, version string) error
+}
+
+// mongoMigrationStore records migrations in the migrations collection and locks them with a lease
+// of the leader election collection
+type mongoMigrationStore struct {
+	p          *PlugMongoDB
+	collection string
+	lease      time.Duration
+	// owner identifies the run holding the lock, so concurrent runs of one process exclude each other
+	owner string
+}
+
+// newMongoMigrationStore returns the store of one migration run
+func newMongoMigrationStore(p *PlugMongoDB, s migrationSettings) mongoMigrationStore {
+	return mongoMigrationStore{p: p, collection: s.collection, lease: s.lease, owner: rollingOwner() + ":" + rand.Text()[:8]}
+}
+
+func (s mongoMigrationStore) lockName() string { return "migrations:" + s.collection }
+
+func (s mongoMigrationStore) lock(ctx context.Context) (bool, error) {
+	return s.p.takeLease(ctx, defaultLeaseCollection, s.lockName(), s.owner, s.lease)
+}
+
+func (s mongoMigrationStore) unlock(ctx context.Context) error {
+	return s.p.dropLease(ctx, defaultLeaseCollection, s.lockName(), s.owner)
+}
+
+func (s mongoMigrationStore) applied(ctx context.Context) (map[string]migrationRecord, error) {
+	out := make(map[string]migrationRecord)
+	op := operation{name: "find", database: s.p.databaseName(""), collection: s.collection}
+	err := s.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Find(ctx, bson.D{})
+		if err != nil {
+			return err
+		}
+		var records []migrationRecord
+		if err := cursor.All(ctx, &records); err != nil {
+			return err
+		}
+		for _, r := range records {
+			out[r.Version] = r
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s mongoMigrationStore) record(ctx context.Context, r migrationRecord) error {
+	op := operation{name: "replace", database: s.p.databaseName(""), collection: s.collection}
+	return s.p.runOperation(WithIdempotency(ctx, Idempotent), op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		_, err = coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: r.Version}}, r, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+func (s mongoMigrationStore) forget(ctx context.Context, version string) error {
+	op := operation{name: "delete", database: s.p.databaseName(""), collection: s.collection}
+	return s.p.runOperation(WithIdempotency(ctx, Idempotent), op, func(ctx context.Context) error {
+		coll, err := s.p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		_, err = coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: version}})
+		return err
+	})
+}
+
+// MigrateUp applies the pending migrations, registered with RegisterMigrations or scripted in
+// migrations.dir, in version order. Runs of all instances are serialized by a lock renewed while
+// migrations run, so replicas starting together apply each migration once; waiting for the lock is
+// bounded by migrations.lock_timeout. A failed migration stops the run and is retried by the next
+// one. The run is a DDL operation: outside the DDL window it is queued and MigrateUp returns a
+// *DDLDeferredError.
+func (p *PlugMongoDB) MigrateUp(ctx context.Context) error {
+	migrations, err := p.collectMigrations()
+	if err != nil {
+		return err
+	}
+	s := migrationSettingsOf(p.config().GetMigrations())
+	return p.RunDDL(ctx, DDLMigration, p.ddlNamespace(s.collection), func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		return p.migrateUp(ctx, newMongoMigrationStore(p, s), s, db, migrations)
+	})
+}
+
+// MigrateDown reverts the applied migrations newer than version, newest first, under the migration
+// lock; version "0" reverts all of them. It fails before reverting anything when one of them has no
+// Down function or is not defined by this binary. Like MigrateUp, it waits for the DDL window.
+func (p *PlugMongoDB) MigrateDown(ctx context.Context, version string) error {
+	if !validMigrationVersion(version) {
+		return fmt.Errorf("target version %q must be a decimal number", version)
+	}
+	migrations, err := p.collectMigrations()
+	if err != nil {
+		return err
+	}
+	s := migrationSettingsOf(p.config().GetMigrations())
+	return p.RunDDL(ctx, DDLMigration, p.ddlNamespace(s.collection), func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		return p.migrateDown(ctx, newMongoMigrationStore(p, s), s, db, migrations, version)
+	})
+}
+
+// Migrations returns the state of the defined and applied migrations in version order
+func (p *PlugMongoDB) Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := p.collectMigrations()
+	if err != nil {
+		return nil, err
+	}
+	s := migrationSettingsOf(p.config().GetMigrations())
+	applied, err := mongoMigrationStore{p: p, collection: s.collection}.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatuses(migrations, applied), nil
+}
+
+func migrationStatuses(migrations []Migration, applied map[string]migrationRecord) []MigrationStatus {
+	out := make([]MigrationStatus, 0, len(migrations))
+	defined := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		defined[m.Version] = true
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Reversible: m.Down != nil}
+		if r, ok := applied[m.Version]; ok {
+			status.AppliedAt, status.AppliedBy = r.AppliedAt, r.AppliedBy
+		}
+		out = append(out, status)
+	}
+	for version, r := range applied {
+		if !defined[version] {
+			out = append(out, MigrationStatus{Version: version, Name: r.Name, AppliedAt: r.AppliedAt, AppliedBy: r.AppliedBy, Unknown: true})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b MigrationStatus) int { return compareMigrationVersions(a.Version, b.Version) })
+	return out
+}
+
+func (p *PlugMongoDB) migrateUp(ctx context.Context, store migrationStore, s migrationSettings, db *mongo.Database, migrations []Migration) error {
+	return p.withMigrationLock(ctx, store, s, func(ctx context.Context) error {
+		applied, err := store.applied(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		var pending []Migration
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; !ok {
+				pending = append(pending, m)
+			}
+		}
+		for _, status := range migrationStatuses(migrations, applied) {
+			if status.Unknown {
+				log.WarnwCtx(ctx, "key", "mongodb", "event", "migration_unknown", "version", status.Version, "name", status.Name)
+			}
+		}
+		p.prometheusMetrics.SetMigrationsPending(p.config(), len(pending))
+		for i, m := range pending {
+			if err := p.runMigration(ctx, store, db, m, MigrationUp); err != nil {
+				return err
+			}
+			p.prometheusMetrics.SetMigrationsPending(p.config(), len(pending)-i-1)
+		}
+		if len(pending) == 0 {
+			log.InfowCtx(ctx, "key", "mongodb", "event", "migrations_up_to_date", "migrations", len(migrations))
+		}
+		return nil
+	})
+}
+
+func (p *PlugMongoDB) migrateDown(ctx context.Context, store migrationStore, s migrationSettings, db *mongo.Database, migrations []Migration, target string) error {
+	return p.withMigrationLock(ctx, store, s, func(ctx context.Context) error {
+		applied, err := store.applied(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		byVersion := make(map[string]Migration, len(migrations))
+		for _, m := range migrations {
+			byVersion[m.Version] = m
+		}
+		var revert []Migration
+		for version := range applied {
+			if compareMigrationVersions(version, target) <= 0 {
+				continue
+			}
+			m, ok := byVersion[version]
+			switch {
+			case !ok:
+				return fmt.Errorf("applied migration %s is not defined by this binary", version)
+			case m.Down == nil:
+				return fmt.Errorf("migration %s (%s) cannot be reverted: it has no Down function", m.Version, m.Name)
+			}
+			revert = append(revert, m)
+		}
+		slices.SortFunc(revert, func(a, b Migration) int { return compareMigrationVersions(b.Version, a.Version) })
+		for _, m := range revert {
+			if err := p.runMigration(ctx, store, db, m, MigrationDown); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runMigration applies or reverts m and updates its record
+func (p *PlugMongoDB) runMigration(ctx context.Context, store migrationStore, db *mongo.Database, m Migration, direction string) error {
+	start := time.Now()
+	var err error
+	if direction == MigrationUp {
+		err = m.Up(ctx, db)
+		if err == nil {
+			err = store.record(ctx, migrationRecord{Version: m.Version, Name: m.Name, AppliedAt: start.UTC(),
+				AppliedBy: rollingOwner(), DurationMs: time.Since(start).Milliseconds()})
+		}
+	} else {
+		err = m.Down(ctx, db)
+		if err == nil {
+			err = store.forget(ctx, m.Version)
+		}
+	}
+	duration := time.Since(start)
+	result := "succeeded"
+	if err != nil {
+		result = "failed"
+		if cause := context.Cause(ctx); errors.Is(cause, errMigrationLockLost) {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
+	}
+	p.prometheusMetrics.RecordMigration(p.config(), direction, result)
+	p.audit(ctx, AuditEvent{Action: "migrate", Namespace: p.databaseName(""), Details: map[string]any{
+		"version": m.Version, "name": m.Name, "direction": direction}, Err: err})
+	if err != nil {
+		log.ErrorwCtx(ctx, "key", "mongodb", "event", "migration_failed", "version", m.Version, "name", m.Name,
+			"direction", direction, "error", err)
+		return fmt.Errorf("migration %s (%s) %s failed: %w", m.Version, m.Name, direction, err)
+	}
+	if direction == MigrationUp {
+		log.InfowCtx(ctx, "key", "mongodb", "event", "migration_applied", "version", m.Version, "name", m.Name, "duration", duration)
+		p.emitTyped(EventMigrationApplied, plugins.PriorityNormal, MigrationAppliedEvent{Version: m.Version, Name: m.Name, Duration: duration})
+	} else {
+		log.InfowCtx(ctx, "key", "mongodb", "event", "migration_reverted", "version", m.Version, "name", m.Name, "duration", duration)
+		p.emitTyped(EventMigrationReverted, plugins.PriorityNormal, MigrationRevertedEvent{Version: m.Version, Name: m.Name, Duration: duration})
+	}
+	return nil
+}
+
+// withMigrationLock runs fn holding the migration lock. It waits up to lockTimeout for another
+// instance to release the lock, renews the lock while fn runs and cancels fn's context once the
+// lock could not be renewed within two thirds of the lease.
+func (p *PlugMongoDB) withMigrationLock(ctx context.Context, store migrationStore, s migrationSettings, fn func(ctx context.Context) error) error {
+	deadline := time.Now().Add(s.lockTimeout)
+	for waited := false; ; waited = true {
+		held, err := store.lock(ctx)
+		if held {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("failed to take the migration lock: %w", err)
+			}
+			return fmt.Errorf("migration lock still held by another instance after %v", s.lockTimeout)
+		}
+		if !waited {
+			log.InfowCtx(ctx, "key", "mongodb", "event", "migration_lock_wait", "error", err)
+		}
+		if err := sleepContext(ctx, s.retry); err != nil {
+			return err
+		}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		last := time.Now()
+		for sleepContext(runCtx, s.lease/3) == nil {
+			held, err := store.lock(runCtx)
+			switch {
+			case held:
+				last = time.Now()
+			case err == nil:
+				cancel(errMigrationLockLost)
+				return
+			default:
+				log.WarnwCtx(ctx, "key", "mongodb", "event", "migration_lock_renewal_failed", "error", err)
+				if time.Since(last) >= s.lease*2/3 {
+					cancel(errMigrationLockLost)
+					return
+				}
+			}
+		}
+	}()
+	err := fn(runCtx)
+	cancel(nil)
+	<-renewed
+
+	unlockCtx, done := context.WithTimeout(context.WithoutCancel(ctx), leaseReleaseTimeout)
+	defer done()
+	if uerr := store.unlock(unlockCtx); uerr != nil {
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "migration_unlock_failed", "error", uerr)
+	}
+	return err
+}
+
+// migrateAtStartup applies the pending migrations when migrations.enabled is set. A run deferred
+// to the DDL window does not fail startup.
+func (p *PlugMongoDB) migrateAtStartup(ctx context.Context) error {
+	if !p.config().GetMigrations().GetEnabled() {
+		return nil
+	}
+	err := p.MigrateUp(ctx)
+	var deferred *DDLDeferredError
+	if errors.As(err, &deferred) {
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "migrations_deferred", "next_window", deferred.NextWindow)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
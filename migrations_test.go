@@ -0,0 +1,242 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryMigrationStore keeps the migration records in memory; locks is played one result per lock
+// attempt, and the lock is held once it is exhausted
+type memoryMigrationStore struct {
+	mu       sync.Mutex
+	records  map[string]migrationRecord
+	locks    []bool
+	unlocked int
+}
+
+func (s *memoryMigrationStore) lock(context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.locks) == 0 {
+		return true, nil
+	}
+	held := s.locks[0]
+	s.locks = s.locks[1:]
+	return held, nil
+}
+
+func (s *memoryMigrationStore) unlock(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unlocked++
+	return nil
+}
+
+func (s *memoryMigrationStore) applied(context.Context) (map[string]migrationRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]migrationRecord, len(s.records))
+	for k, v := range s.records {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *memoryMigrationStore) record(_ context.Context, r migrationRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records == nil {
+		s.records = make(map[string]migrationRecord)
+	}
+	s.records[r.Version] = r
+	return nil
+}
+
+func (s *memoryMigrationStore) forget(_ context.Context, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, version)
+	return nil
+}
+
+func TestOrderMigrations(t *testing.T) {
+	up := func(context.Context, *mongo.Database) error { return nil }
+	ordered, err := orderMigrations([]Migration{{Version: "10", Up: up}, {Version: "9", Up: up}, {Version: "020", Up: up}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, m := range ordered {
+		versions = append(versions, m.Version)
+	}
+	if !slices.Equal(versions, []string{"9", "10", "020"}) {
+		t.Errorf("order = %v", versions)
+	}
+	for name, migrations := range map[string][]Migration{
+		"duplicate": {{Version: "1", Up: up}, {Version: "01", Up: up}},
+		"version":   {{Version: "v1", Up: up}},
+		"no up":     {{Version: "1"}},
+	} {
+		if _, err := orderMigrations(migrations); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadMigrationScripts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2_add_status.up.json", `[{"update": "orders", "updates": [{"q": {}, "u": {"$set": {"status": "open"}}, "multi": true}]}]`)
+	write("2_add_status.down.json", `[{"update": "orders", "updates": [{"q": {}, "u": {"$unset": {"status": ""}}, "multi": true}]}]`)
+	write("10_customer_index.up.json", `[{"createIndexes": "orders", "indexes": [{"key": {"customer": {"$numberInt": "1"}}, "name": "customer_1"}]}]`)
+	write("README.md", "ignored")
+
+	migrations, err := loadMigrationScripts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err = orderMigrations(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "add_status" || migrations[0].Down == nil ||
+		migrations[1].Version != "10" || migrations[1].Down != nil {
+		t.Errorf("migrations = %+v", migrations)
+	}
+
+	write("3.up.json", `[{"ping": 1}]`)
+	if _, err := loadMigrationScripts(dir); err == nil {
+		t.Error("a script without name should fail")
+	}
+	for _, script := range []string{`[]`, `[{}]`, `{"ping": 1}`, `[{"ping": 1}`} {
+		if _, err := MigrationScript("1", "bad", []byte(script), nil); err == nil {
+			t.Errorf("script %s should fail", script)
+		}
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	var mu sync.Mutex
+	var ran []string
+	step := func(name string) func(context.Context, *mongo.Database) error {
+		return func(context.Context, *mongo.Database) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	migrations, err := orderMigrations([]Migration{
+		{Version: "3", Name: "backfill", Up: step("up 3")},
+		{Version: "1", Name: "create", Up: step("up 1"), Down: step("down 1")},
+		{Version: "2", Name: "index", Up: step("up 2"), Down: step("down 2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryMigrationStore{}
+	s := migrationSettings{lockTimeout: time.Second, lease: time.Minute, retry: time.Millisecond}
+
+	if err := p.migrateUp(t.Context(), store, s, nil, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.migrateUp(t.Context(), store, s, nil, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []string{"up 1", "up 2", "up 3"}) {
+		t.Errorf("ran %v", ran)
+	}
+	if len(store.records) != 3 || store.records["2"].Name != "index" || store.records["2"].AppliedBy == "" || store.unlocked != 2 {
+		t.Errorf("records = %+v, unlocked %d", store.records, store.unlocked)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.migrations.WithLabelValues("test", MigrationUp, "succeeded")); got != 3 {
+		t.Errorf("applied migrations = %v", got)
+	}
+
+	ran = nil
+	if err := p.migrateDown(t.Context(), store, s, nil, migrations, "0"); err == nil {
+		t.Error("reverting an irreversible migration should fail")
+	}
+	if err := p.migrateDown(t.Context(), store, s, nil, migrations, "1"); err == nil {
+		t.Error("reverting past an irreversible migration should fail")
+	}
+	if len(ran) != 0 {
+		t.Fatalf("nothing should be reverted when one migration cannot be, ran %v", ran)
+	}
+	delete(store.records, "3")
+	if err := p.migrateDown(t.Context(), store, s, nil, migrations, "0"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []string{"down 2", "down 1"}) || len(store.records) != 0 {
+		t.Errorf("ran %v, records %+v", ran, store.records)
+	}
+
+	boom := errors.New("boom")
+	failing := []Migration{migrations[0], {Version: "2", Name: "index", Up: func(context.Context, *mongo.Database) error { return boom }}, migrations[2]}
+	ran = nil
+	if err := p.migrateUp(t.Context(), store, s, nil, failing); !errors.Is(err, boom) {
+		t.Fatalf("migrateUp = %v", err)
+	}
+	if !slices.Equal(ran, []string{"up 1"}) || len(store.records) != 1 {
+		t.Errorf("a failed migration should stop the run: ran %v, records %+v", ran, store.records)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.migrationsPending.WithLabelValues("test")); got != 2 {
+		t.Errorf("pending migrations = %v", got)
+	}
+}
+
+func TestWithMigrationLock(t *testing.T) {
+	p := NewMongoDBClient()
+	s := migrationSettings{lockTimeout: time.Second, lease: time.Minute, retry: time.Millisecond}
+
+	store := &memoryMigrationStore{locks: []bool{false, false}}
+	ran := false
+	if err := p.withMigrationLock(t.Context(), store, s, func(context.Context) error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("lock released by another instance = %v, ran %v", err, ran)
+	}
+
+	s.lockTimeout = 5 * time.Millisecond
+	store = &memoryMigrationStore{locks: slices.Repeat([]bool{false}, 1000)}
+	if err := p.withMigrationLock(t.Context(), store, s, func(context.Context) error { return nil }); err == nil || store.unlocked != 0 {
+		t.Errorf("lock held past lock_timeout = %v", err)
+	}
+
+	// The lock is taken over while migrations run
+	s.lease = 30 * time.Millisecond
+	store = &memoryMigrationStore{locks: []bool{true, false}}
+	err := p.withMigrationLock(t.Context(), store, s, func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	})
+	if !errors.Is(err, errMigrationLockLost) {
+		t.Errorf("lost lock = %v", err)
+	}
+}
+
+func TestMigrationStoreOwnerPerRun(t *testing.T) {
+	p := NewMongoDBClient()
+	s := migrationSettingsOf(nil)
+	a, b := newMongoMigrationStore(p, s), newMongoMigrationStore(p, s)
+	if a.owner == b.owner {
+		t.Error("two runs of one process must not share the lock owner")
+	}
+	if !strings.HasPrefix(a.owner, rollingOwner()+":") {
+		t.Errorf("owner %q should name the process", a.owner)
+	}
+}
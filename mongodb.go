@@ -3,6 +3,7 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-kratos/kratos/v2/config"
@@ -15,6 +16,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
@@ -46,15 +48,22 @@ func (p *PlugMongoDB) CleanupTasksContext(parentCtx context.Context) error {
 		return err
 	}
 
-	if p.client != nil {
-		ctx, cancel := p.createTimeoutContext(parentCtx, 5*time.Second)
+	p.releaseResources(parentCtx)
+	p.disconnectStandby(parentCtx)
+
+	if state := p.loadState(); state != nil {
+		ctx, cancel := p.createTimeoutContext(parentCtx, workloadDisconnectTimeout)
 		defer cancel()
-		if err := p.client.Disconnect(ctx); err != nil {
+		err := state.client.Disconnect(ctx)
+		// The workload pools and the state are released even when the main client fails to disconnect
+		disconnectWorkloads(state)
+		p.swapState(nil)
+		if err != nil {
 			log.Errorf("failed to disconnect mongodb client: %v", err)
+			p.emitTyped(EventDisconnected, plugins.PriorityHigh, DisconnectedEvent{Database: state.database.Name(), Err: err})
 			return err
 		}
-		p.client = nil
-		p.database = nil
+		p.emitTyped(EventDisconnected, plugins.PriorityNormal, DisconnectedEvent{Database: state.database.Name()})
 	}
 	p.rt = nil
 
@@ -82,44 +91,121 @@ func (p *PlugMongoDB) parseConfig(cfg config.Config) error {
 	if err := cfg.Scan(&mongodbConf); err != nil {
 		return err
 	}
-	p.conf = &mongodbConf
+	p.conf.Store(&mongodbConf)
+	return p.normalizeConfig()
+}
+
+// normalizeConfig fills defaults into the loaded configuration and validates it
+func (p *PlugMongoDB) normalizeConfig() error {
+	return normalizeConf(p.config())
+}
 
+// normalizeConf fills defaults into c and validates it
+func normalizeConf(c *conf.MongoDB) error {
 	// Set default values
-	if p.conf.Uri == "" {
-		p.conf.Uri = "mongodb://localhost:27017"
+	if c.Uri == "" {
+		c.Uri = "mongodb://localhost:27017"
+	}
+	if c.Database == "" {
+		c.Database = "test"
+	}
+	if c.MaxPoolSize == 0 {
+		c.MaxPoolSize = 100
+	}
+	if c.MinPoolSize == 0 {
+		c.MinPoolSize = 5
+	}
+	if c.ConnectTimeout == nil {
+		c.ConnectTimeout = durationpb.New(30 * time.Second)
+	}
+	if c.ServerSelectionTimeout == nil {
+		c.ServerSelectionTimeout = durationpb.New(30 * time.Second)
+	}
+	if c.SocketTimeout == nil {
+		c.SocketTimeout = durationpb.New(30 * time.Second)
+	}
+	if c.HeartbeatInterval == nil {
+		c.HeartbeatInterval = durationpb.New(10 * time.Second)
 	}
-	if p.conf.Database == "" {
-		p.conf.Database = "test"
+	if c.HealthCheckInterval == nil {
+		c.HealthCheckInterval = durationpb.New(30 * time.Second)
+	}
+	if c.ReadConcernLevel == "" {
+		c.ReadConcernLevel = "local"
+	}
+	if c.WriteConcernW == 0 {
+		c.WriteConcernW = 1
+	}
+	if c.WriteConcernTimeout == nil {
+		c.WriteConcernTimeout = durationpb.New(5 * time.Second)
+	}
+	if c.OperationTimeout == nil {
+		c.OperationTimeout = durationpb.New(30 * time.Second)
+	}
+	if err := validateSeeds(c); err != nil {
+		return err
+	}
+	// SRV URIs need DNS lookups; the driver validates them when connecting
+	if !strings.HasPrefix(c.Uri, connstring.SchemeMongoDBSRV+"://") {
+		if _, err := connstring.ParseAndValidate(c.Uri); err != nil {
+			return fmt.Errorf("invalid uri: %w", err)
+		}
+	}
+	switch c.QueryScanMode {
+	case "":
+		c.QueryScanMode = QueryScanOff
+	case QueryScanOff, QueryScanWarn, QueryScanBlock:
+	default:
+		return fmt.Errorf("invalid query_scan_mode %q: must be off, warn or block", c.QueryScanMode)
+	}
+	if level := c.GetDebug().GetDriverLogLevel(); level != "" {
+		if _, err := parseDriverLogLevel(level); err != nil {
+			return fmt.Errorf("invalid debug.driver_log_level: %w", err)
+		}
 	}
-	if p.conf.MaxPoolSize == 0 {
-		p.conf.MaxPoolSize = 100
+	switch c.HealthCheckMembers {
+	case "":
+		c.HealthCheckMembers = HealthMembersPrimary
+	case HealthMembersPrimary, HealthMembersSecondaries, HealthMembersAll:
+	default:
+		return fmt.Errorf("invalid health_check_members %q: must be primary, secondaries or all", c.HealthCheckMembers)
 	}
-	if p.conf.MinPoolSize == 0 {
-		p.conf.MinPoolSize = 5
+	switch c.SchemaProvisioning {
+	case "":
+		c.SchemaProvisioning = SchemaProvisionOff
+	case SchemaProvisionOff, SchemaProvisionCheck, SchemaProvisionApply:
+	default:
+		return fmt.Errorf("invalid schema_provisioning %q: must be off, check or apply", c.SchemaProvisioning)
 	}
-	if p.conf.ConnectTimeout == nil {
-		p.conf.ConnectTimeout = durationpb.New(30 * time.Second)
+	if rate := c.HistogramSampleRate; !(rate >= 0 && rate <= 1) {
+		return fmt.Errorf("invalid histogram_sample_rate %v: must be between 0 and 1", rate)
 	}
-	if p.conf.ServerSelectionTimeout == nil {
-		p.conf.ServerSelectionTimeout = durationpb.New(30 * time.Second)
+	if err := validateNamespaceFilter(c.GetMetricsNamespaces()); err != nil {
+		return fmt.Errorf("invalid metrics_namespaces: %w", err)
 	}
-	if p.conf.SocketTimeout == nil {
-		p.conf.SocketTimeout = durationpb.New(30 * time.Second)
+	if err := validateWriteGuards(c.GetWriteGuards()); err != nil {
+		return fmt.Errorf("invalid write_guards: %w", err)
 	}
-	if p.conf.HeartbeatInterval == nil {
-		p.conf.HeartbeatInterval = durationpb.New(10 * time.Second)
+	if _, err := parseDDLWindow(c.GetDdlWindow()); err != nil {
+		return fmt.Errorf("invalid ddl_window: %w", err)
 	}
-	if p.conf.HealthCheckInterval == nil {
-		p.conf.HealthCheckInterval = durationpb.New(30 * time.Second)
+	if err := validateBackupMonitor(c.GetBackupMonitor()); err != nil {
+		return fmt.Errorf("invalid backup_monitor: %w", err)
 	}
-	if p.conf.ReadConcernLevel == "" {
-		p.conf.ReadConcernLevel = "local"
+	if err := validateMetricAliases(c.GetMetricAliases()); err != nil {
+		return fmt.Errorf("invalid metric_aliases: %w", err)
 	}
-	if p.conf.WriteConcernW == 0 {
-		p.conf.WriteConcernW = 1
+	if _, err := parseMaintenance(c.GetMaintenance()); err != nil {
+		return fmt.Errorf("invalid maintenance: %w", err)
 	}
-	if p.conf.WriteConcernTimeout == nil {
-		p.conf.WriteConcernTimeout = durationpb.New(5 * time.Second)
+	if c.GetMigrations().GetLockTimeout().AsDuration() < 0 {
+		return fmt.Errorf("invalid migrations: lock_timeout cannot be negative")
+	}
+	if c.GetSeed().GetEnabled() && c.GetSeed().GetDir() == "" {
+		return fmt.Errorf("invalid seed: dir is required")
+	}
+	if _, err := parseReadSplit(c.GetReadSplit()); err != nil {
+		return fmt.Errorf("invalid read_split: %w", err)
 	}
 
 	return nil
@@ -131,28 +217,113 @@ func (p *PlugMongoDB) createClient() error {
 }
 
 func (p *PlugMongoDB) createClientContext(parentCtx context.Context) error {
+	p.loadDebugToggles()
+
+	budgets, err := newOpBudgets(p.config().GetOpBudgets())
+	if err != nil {
+		return fmt.Errorf("invalid op budgets: %w", err)
+	}
+	p.budgets = budgets
+
+	slos, err := newSLOTrackers(p.config().GetLatencySlos())
+	if err != nil {
+		return fmt.Errorf("invalid latency_slos: %w", err)
+	}
+	p.slos = slos
+	p.hotDocs = newHotDocuments(p.config().GetHotDocuments())
+	shed, err := newLoadShedder(p.config().GetLoadShedding(), p.shedPolicy)
+	if err != nil {
+		return fmt.Errorf("invalid load_shedding: %w", err)
+	}
+	p.shed = shed
+	priorities, err := newPriorityLimiter(p.config().GetPriorityConcurrency())
+	if err != nil {
+		return fmt.Errorf("invalid priority_concurrency: %w", err)
+	}
+	p.priorities = priorities
+	breaker, err := p.newPluginCircuitBreaker()
+	if err != nil {
+		return fmt.Errorf("invalid circuit_breaker: %w", err)
+	}
+	p.breaker = breaker
+	failover, err := newFailover(p.config().GetFailover())
+	if err != nil {
+		return fmt.Errorf("invalid failover: %w", err)
+	}
+	p.failover = failover
+	writeBuffer, err := newWriteBuffer(p.config().GetWriteBuffer())
+	if err != nil {
+		return fmt.Errorf("invalid write_buffer: %w", err)
+	}
+	p.writeBuffer = writeBuffer
+	if _, err := configuredIndexes(p.config()); err != nil {
+		return fmt.Errorf("invalid indexes: %w", err)
+	}
+
+	// Set custom BSON codecs (time handling, etc.)
+	registry, err := p.buildRegistry()
+	if err != nil {
+		return fmt.Errorf("failed to build bson registry: %w", err)
+	}
+	p.registry = registry
+
+	state, err := p.connectClient(parentCtx, p.config())
+	if err != nil {
+		return err
+	}
+	p.handOverMonitor(p.swapState(state), state)
+
+	return p.connectStandby(parentCtx)
+}
+
+// connectClient creates a client (and its workload pools) from the connection settings of cfg, with
+// the plugin monitors and registry, without publishing it. Its monitors report once handed over
+// (see handOverMonitor).
+func (p *PlugMongoDB) connectClient(parentCtx context.Context, cfg *conf.MongoDB) (*clientState, error) {
 	// Parse timeout values
-	connectTimeout := p.conf.ConnectTimeout.AsDuration()
-	serverSelectionTimeout := p.conf.ServerSelectionTimeout.AsDuration()
-	socketTimeout := p.conf.SocketTimeout.AsDuration()
-	heartbeatInterval := p.conf.HeartbeatInterval.AsDuration()
+	connectTimeout := cfg.ConnectTimeout.AsDuration()
+	serverSelectionTimeout := cfg.ServerSelectionTimeout.AsDuration()
+	socketTimeout := cfg.SocketTimeout.AsDuration()
+	heartbeatInterval := cfg.HeartbeatInterval.AsDuration()
 
 	// Build client options
-	clientOptions := options.Client().ApplyURI(p.conf.Uri)
+	clientOptions := options.Client().ApplyURI(cfg.Uri)
+	seeds, err := p.seedHosts(parentCtx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hosts: %w", err)
+	}
+	if seeds != nil {
+		clientOptions.SetHosts(seeds)
+	}
 
-	// Set CommandMonitor and PoolMonitor for Prometheus metrics
-	if p.prometheusMetrics != nil {
-		if cmdMon := p.prometheusMetrics.CreateCommandMonitor(p.conf); cmdMon != nil {
-			clientOptions.SetMonitor(cmdMon)
-		}
-		if poolMon := p.prometheusMetrics.CreatePoolMonitor(p.conf, &p.poolActiveConns); poolMon != nil {
-			clientOptions.SetPoolMonitor(poolMon)
-		}
+	if logger := p.driverLoggerOptions(cfg); logger != nil {
+		clientOptions.SetLoggerOptions(logger)
+	}
+
+	// Set CommandMonitor (metrics and command inspection hooks) and PoolMonitor
+	if cmdMon := p.buildCommandMonitor(cfg); cmdMon != nil {
+		clientOptions.SetMonitor(cmdMon)
+	}
+	monitor := &clientMonitor{}
+	metricsMon, resyncPool := p.prometheusMetrics.createPoolMonitor(cfg, &monitor.activeConns, &monitor.openConns, monitor.publishes)
+	monitor.resyncPool = resyncPool
+	if poolMon := composePoolMonitors(
+		metricsMon,
+		p.createEventPoolMonitor(monitor),
+		p.createLoadPoolMonitor(monitor),
+	); poolMon != nil {
+		clientOptions.SetPoolMonitor(poolMon)
+	}
+	election := &primaryElection{}
+	clientOptions.SetServerMonitor(p.createEventServerMonitor(cfg, election, monitor))
+
+	if p.registry != nil {
+		clientOptions.SetRegistry(p.registry)
 	}
 
 	// Set connection pool configuration
-	clientOptions.SetMaxPoolSize(p.conf.MaxPoolSize)
-	clientOptions.SetMinPoolSize(p.conf.MinPoolSize)
+	clientOptions.SetMaxPoolSize(cfg.MaxPoolSize)
+	clientOptions.SetMinPoolSize(cfg.MinPoolSize)
 
 	// Set timeout configuration
 	clientOptions.SetConnectTimeout(connectTimeout)
@@ -161,49 +332,49 @@ func (p *PlugMongoDB) createClientContext(parentCtx context.Context) error {
 	clientOptions.SetHeartbeatInterval(heartbeatInterval)
 
 	// Set authentication information
-	if p.conf.Username != "" && p.conf.Password != "" {
-		clientOptions.SetAuth(options.Credential{
-			Username:   p.conf.Username,
-			Password:   p.conf.Password,
-			AuthSource: p.conf.AuthSource,
-		})
+	credential, err := buildCredential(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth: %w", err)
+	}
+	if credential != nil {
+		clientOptions.SetAuth(*credential)
+	}
+
+	// Set dialer configuration
+	dialer, err := p.buildDialer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dialer: %w", err)
+	}
+	if dialer != nil {
+		clientOptions.SetDialer(dialer)
 	}
 
 	// Set TLS configuration
-	if p.conf.EnableTls {
-		tlsOpts := make(map[string]interface{})
-		if p.conf.TlsCertFile != "" {
-			tlsOpts["certFile"] = p.conf.TlsCertFile
-		}
-		if p.conf.TlsKeyFile != "" {
-			tlsOpts["keyFile"] = p.conf.TlsKeyFile
-		}
-		if p.conf.TlsCaFile != "" {
-			tlsOpts["caFile"] = p.conf.TlsCaFile
-		}
-		if len(tlsOpts) > 0 {
-			tlsConfig, err := options.BuildTLSConfig(tlsOpts)
-			if err != nil {
-				return fmt.Errorf("failed to build TLS config: %w", err)
-			}
-			clientOptions.SetTLSConfig(tlsConfig)
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+	if tlsConfig != nil {
+		if tlsConfig.InsecureSkipVerify {
+			log.Warnw("key", "mongodb", "event", "tls_insecure_skip_verify")
 		}
+		clientOptions.SetTLSConfig(tlsConfig)
 	}
 
 	// Set compression configuration
-	if p.conf.EnableCompression {
+	if cfg.EnableCompression {
 		clientOptions.SetCompressors([]string{"zlib", "snappy"})
 	}
 
 	// Set retry writes
-	if p.conf.EnableRetryWrites {
+	if cfg.EnableRetryWrites {
 		clientOptions.SetRetryWrites(true)
 	}
 
 	// Set read concern
-	if p.conf.EnableReadConcern {
+	if cfg.EnableReadConcern {
 		var rc *readconcern.ReadConcern
-		switch p.conf.ReadConcernLevel {
+		switch cfg.ReadConcernLevel {
 		case "local":
 			rc = readconcern.Local()
 		case "majority":
@@ -219,11 +390,11 @@ func (p *PlugMongoDB) createClientContext(parentCtx context.Context) error {
 	}
 
 	// Set write concern
-	if p.conf.EnableWriteConcern {
-		writeConcernTimeout := p.conf.WriteConcernTimeout.AsDuration()
+	if cfg.EnableWriteConcern {
+		writeConcernTimeout := cfg.WriteConcernTimeout.AsDuration()
 
 		wc := writeconcern.New(
-			writeconcern.W(int(p.conf.WriteConcernW)),
+			writeconcern.W(int(cfg.WriteConcernW)),
 			writeconcern.WTimeout(writeConcernTimeout),
 		)
 		clientOptions.SetWriteConcern(wc)
@@ -234,15 +405,19 @@ func (p *PlugMongoDB) createClientContext(parentCtx context.Context) error {
 	defer cancel()
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	p.client = client
-
-	// Get database instance
-	p.database = client.Database(p.conf.Database)
-
-	return nil
+	// The client is published together with its database handle and workload pools
+	state := newClientState(client, cfg.Database)
+	state.seeds = seeds
+	state.election = election
+	state.monitor = monitor
+	if err := p.connectWorkloads(ctx, cfg, clientOptions, state); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+	return state, nil
 }
 
 // testConnection tests the connection
@@ -254,8 +429,12 @@ func (p *PlugMongoDB) testConnectionContext(parentCtx context.Context) error {
 	ctx, cancel := p.createTimeoutContext(parentCtx, 10*time.Second)
 	defer cancel()
 
+	client := p.GetClient()
+	if client == nil {
+		return errClientNotInitialized
+	}
 	// Send ping request
-	if err := p.client.Ping(ctx, nil); err != nil {
+	if err := client.Ping(ctx, nil); err != nil {
 		return err
 	}
 
@@ -266,8 +445,8 @@ func (p *PlugMongoDB) testConnectionContext(parentCtx context.Context) error {
 func (p *PlugMongoDB) startMetricsCollection() {
 	// Use health check interval for metrics collection or default to 30 seconds
 	var interval time.Duration
-	if p.conf.HealthCheckInterval != nil {
-		interval = p.conf.HealthCheckInterval.AsDuration()
+	if p.config().HealthCheckInterval != nil {
+		interval = p.config().HealthCheckInterval.AsDuration()
 	} else {
 		interval = 30 * time.Second
 	}
@@ -318,26 +497,30 @@ func (p *PlugMongoDB) collectMetricsContext(parentCtx context.Context) {
 
 	// Update config-based metrics (connection pool max, etc.)
 	if p.prometheusMetrics != nil {
-		p.prometheusMetrics.UpdateConfigMetrics(p.conf)
+		p.prometheusMetrics.UpdateConfigMetrics(p.config())
 	}
 
 	// Get database statistics (validates connection, supports future extended metrics)
 	var dbStatsResult bson.M
-	if p.database == nil {
+	db := p.GetDatabase()
+	if db == nil {
 		return
 	}
-	if err := p.database.RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&dbStatsResult); err != nil {
+	if err := db.RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&dbStatsResult); err != nil {
 		log.Errorf("failed to get database stats: %v", err)
 		return
 	}
 	_ = dbStatsResult // reserved for future storage-size etc. metrics
 
+	p.collectServerStatus(ctx)
+	p.collectOplogWindow(ctx)
+
 	log.Debug("mongodb metrics collected")
 }
 
 // startHealthCheck starts health check
 func (p *PlugMongoDB) startHealthCheck() {
-	interval := p.conf.HealthCheckInterval.AsDuration()
+	interval := p.config().HealthCheckInterval.AsDuration()
 
 	// Ensure quit channel exists
 	p.ensureStatsQuit()
@@ -393,13 +576,26 @@ func (p *PlugMongoDB) checkHealthContext(parentCtx context.Context) error {
 	ctx, cancel := p.createTimeoutContext(parentCtx, 5*time.Second)
 	defer cancel()
 
-	if p.client == nil {
+	client := p.GetClient()
+	if client == nil {
 		return fmt.Errorf("mongodb client is nil")
 	}
-	err := p.client.Ping(ctx, nil)
+	start := time.Now()
+	err := client.Ping(ctx, p.healthReadPref())
+	latency := time.Since(start)
+	if err == nil {
+		nodes := p.NodeHealth()
+		err = p.checkTargetMembers(nodes)
+		// A successful primary ping proves the primary reachable
+		primary := p.healthMembers() != HealthMembersSecondaries || primaryReachable(nodes)
+		if reasons := p.degradation(latency, primary); err == nil && len(reasons) > 0 {
+			err = fmt.Errorf("mongodb degraded: %s", strings.Join(reasons, "; "))
+		}
+	}
 	if p.prometheusMetrics != nil {
-		p.prometheusMetrics.RecordHealthCheck(err == nil, p.conf)
+		p.prometheusMetrics.RecordHealthCheck(err == nil, p.config())
 	}
+	p.observeHealth(err)
 	if err != nil {
 		return err
 	}
@@ -419,6 +615,7 @@ func (p *PlugMongoDB) stopBackgroundTasksContext(parentCtx context.Context) erro
 		p.healthCancel()
 		p.healthCancel = nil
 	}
+	p.stopPeriodicTasks()
 	if p.statsQuit != nil {
 		p.closeStatsQuitOnce()
 	}
@@ -447,20 +644,23 @@ func (p *PlugMongoDB) stopBackgroundTasksContext(parentCtx context.Context) erro
 
 // GetClient gets the MongoDB client
 func (p *PlugMongoDB) GetClient() *mongo.Client {
-	return p.client
+	client, _ := p.ClientPair()
+	return client
 }
 
 // GetDatabase gets the MongoDB database instance
 func (p *PlugMongoDB) GetDatabase() *mongo.Database {
-	return p.database
+	_, db := p.ClientPair()
+	return db
 }
 
 // GetCollection gets the collection instance
 func (p *PlugMongoDB) GetCollection(collectionName string) *mongo.Collection {
-	if p.database == nil {
+	db := p.GetDatabase()
+	if db == nil {
 		return nil
 	}
-	return p.database.Collection(collectionName)
+	return db.Collection(collectionName)
 }
 
 // MetricsGatherer returns the Prometheus Gatherer for this plugin (implements metricsGathererProvider interface).
@@ -469,24 +669,34 @@ func (p *PlugMongoDB) MetricsGatherer() prometheus.Gatherer {
 	if p.prometheusMetrics == nil {
 		return nil
 	}
-	return p.prometheusMetrics.GetGatherer()
+	return withMetricAliases(p.prometheusMetrics.GetGatherer(), p.config().GetMetricAliases())
 }
 
 // GetConnectionStats gets connection statistics
 func (p *PlugMongoDB) GetConnectionStats() map[string]any {
 	stats := make(map[string]any)
 
-	if p.client != nil {
+	if p.GetClient() != nil {
 		// Get client statistics
 		stats["client_initialized"] = true
-		stats["database"] = p.conf.Database
-		stats["max_pool_size"] = p.conf.MaxPoolSize
-		stats["min_pool_size"] = p.conf.MinPoolSize
-		stats["compression_enabled"] = p.conf.EnableCompression
-		stats["tls_enabled"] = p.conf.EnableTls
+		stats["database"] = p.config().Database
+		stats["max_pool_size"] = p.config().MaxPoolSize
+		stats["min_pool_size"] = p.config().MinPoolSize
+		stats["compression_enabled"] = p.config().EnableCompression
+		stats["tls_enabled"] = p.config().EnableTls
+		if inventory := p.SchemaInventory(); len(inventory) > 0 {
+			stats["schemas"] = inventory
+		}
 	} else {
 		stats["client_initialized"] = false
 	}
+	if pending := p.PendingDDL(); len(pending) > 0 {
+		stats["pending_ddl"] = pending
+	}
+	if active, since, inFlight := p.maintenance.status(); active {
+		stats["maintenance_since"] = since
+		stats["in_flight"] = inFlight
+	}
 
 	return stats
 }
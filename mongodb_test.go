@@ -2,11 +2,14 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/go-lynx/lynx-mongodb/conf"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
@@ -18,7 +21,7 @@ func TestNewMongoDBClient(t *testing.T) {
 	if client.Name() != pluginName {
 		t.Errorf("expected name %q, got %q", pluginName, client.Name())
 	}
-	if client.conf != nil {
+	if client.config() != nil {
 		t.Error("expected conf to be nil before Initialize")
 	}
 }
@@ -44,30 +47,30 @@ func TestOptionFunctions(t *testing.T) {
 	// Options require conf to be set; we need to run parseConfig first or have options init conf
 	// Test that options don't panic when applied to fresh client
 	WithURI("mongodb://localhost:27017")(client)
-	if client.conf == nil {
+	if client.config() == nil {
 		t.Error("WithURI should initialize conf")
 	}
-	if client.conf.Uri != "mongodb://localhost:27017" {
-		t.Errorf("expected uri mongodb://localhost:27017, got %q", client.conf.Uri)
+	if client.config().Uri != "mongodb://localhost:27017" {
+		t.Errorf("expected uri mongodb://localhost:27017, got %q", client.config().Uri)
 	}
 
 	WithDatabase("testdb")(client)
-	if client.conf.Database != "testdb" {
-		t.Errorf("expected database testdb, got %q", client.conf.Database)
+	if client.config().Database != "testdb" {
+		t.Errorf("expected database testdb, got %q", client.config().Database)
 	}
 
 	WithPoolSize(50, 10)(client)
-	if client.conf.MaxPoolSize != 50 || client.conf.MinPoolSize != 10 {
-		t.Errorf("expected pool 50/10, got %d/%d", client.conf.MaxPoolSize, client.conf.MinPoolSize)
+	if client.config().MaxPoolSize != 50 || client.config().MinPoolSize != 10 {
+		t.Errorf("expected pool 50/10, got %d/%d", client.config().MaxPoolSize, client.config().MinPoolSize)
 	}
 
 	WithMetrics(true)(client)
-	if !client.conf.EnableMetrics {
+	if !client.config().EnableMetrics {
 		t.Error("expected EnableMetrics true")
 	}
 
 	WithHealthCheck(true, 15*time.Second)(client)
-	if !client.conf.EnableHealthCheck {
+	if !client.config().EnableHealthCheck {
 		t.Error("expected EnableHealthCheck true")
 	}
 }
@@ -124,6 +127,17 @@ func TestExtractDocumentsFromReply(t *testing.T) {
 		t.Errorf("expected firstBatch len=2, got %d", n)
 	}
 
+	// Reply with int32 counter and cursor nextBatch
+	reply4, _ := bson.Marshal(bson.D{{Key: "n", Value: int32(0)}, {Key: "cursor", Value: bson.M{
+		"nextBatch": bson.A{1, 2, 3},
+	}}})
+	if n := extractDocumentsFromReply(reply4, "getMore"); n != 3 {
+		t.Errorf("expected nextBatch len=3, got %d", n)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { extractDocumentsFromReply(reply3, "find") }); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+
 	// Empty reply
 	if n := extractDocumentsFromReply(nil, "find"); n != 0 {
 		t.Errorf("expected 0 for nil reply, got %d", n)
@@ -151,8 +165,8 @@ func TestPrometheusMetrics(t *testing.T) {
 	}
 
 	// CreatePoolMonitor
-	var active int64
-	poolMon := pm.CreatePoolMonitor(cfg, &active)
+	var active, open int64
+	poolMon := pm.CreatePoolMonitor(cfg, &active, &open)
 	if poolMon == nil {
 		t.Error("CreatePoolMonitor returned nil")
 	}
@@ -169,28 +183,123 @@ func TestParseConfigDefaults(t *testing.T) {
 	// Use a minimal config that Scan can populate
 	// The kratos config.Scan typically works with a struct - we need a mock
 	// For now, test that defaults are applied when we set empty conf
-	p.conf = &conf.MongoDB{}
+	p.conf.Store(&conf.MongoDB{})
 	// Simulate what parseConfig does for defaults
-	if p.conf.Uri == "" {
-		p.conf.Uri = "mongodb://localhost:27017"
+	if p.config().Uri == "" {
+		p.config().Uri = "mongodb://localhost:27017"
+	}
+	if p.config().Database == "" {
+		p.config().Database = "test"
+	}
+	if p.config().MaxPoolSize == 0 {
+		p.config().MaxPoolSize = 100
 	}
-	if p.conf.Database == "" {
-		p.conf.Database = "test"
+	if p.config().ConnectTimeout == nil {
+		p.config().ConnectTimeout = durationpb.New(30 * time.Second)
 	}
-	if p.conf.MaxPoolSize == 0 {
-		p.conf.MaxPoolSize = 100
+
+	if p.config().Uri != "mongodb://localhost:27017" {
+		t.Errorf("default uri: got %q", p.config().Uri)
+	}
+	if p.config().Database != "test" {
+		t.Errorf("default database: got %q", p.config().Database)
 	}
-	if p.conf.ConnectTimeout == nil {
-		p.conf.ConnectTimeout = durationpb.New(30 * time.Second)
+	if p.config().MaxPoolSize != 100 {
+		t.Errorf("default maxPoolSize: got %d", p.config().MaxPoolSize)
 	}
+}
+
+func TestCommandName(t *testing.T) {
+	tests := []struct {
+		cmd      any
+		expected string
+	}{
+		{bson.D{{Key: "ping", Value: 1}}, "ping"},
+		{bson.M{"buildInfo": 1}, "buildInfo"},
+		{bson.M{"a": 1, "b": 2}, "runCommand"},
+		{bson.D{}, "runCommand"},
+		{"invalid", "runCommand"},
+	}
+	for _, tt := range tests {
+		if got := commandName(tt.cmd); got != tt.expected {
+			t.Errorf("commandName(%v) = %q, want %q", tt.cmd, got, tt.expected)
+		}
+	}
+	raw, _ := bson.Marshal(bson.D{{Key: "serverStatus", Value: 1}})
+	if got := commandName(bson.Raw(raw)); got != "serverStatus" {
+		t.Errorf("commandName(raw) = %q, want serverStatus", got)
+	}
+}
+
+func TestRunCommandWithoutClient(t *testing.T) {
+	p := NewMongoDBClient()
+	WithDatabase("testdb")(p)
+	if _, err := p.RunCommand(context.Background(), "", bson.D{{Key: "ping", Value: 1}}); err == nil {
+		t.Fatal("expected error when client is not initialized")
+	}
+}
+
+func TestMissingIndexes(t *testing.T) {
+	idx := func(name string, key bson.D) bson.Raw {
+		raw, _ := bson.Marshal(bson.D{{Key: "v", Value: 2}, {Key: "key", Value: key}, {Key: "name", Value: name}})
+		return raw
+	}
+	before := []bson.Raw{
+		idx("_id_", bson.D{{Key: "_id", Value: 1}}),
+		idx("email_1", bson.D{{Key: "email", Value: 1}}),
+		idx("created_at_-1", bson.D{{Key: "created_at", Value: -1}}),
+	}
+	after := []bson.Raw{
+		idx("_id_", bson.D{{Key: "_id", Value: 1}}),
+		idx("email_1", bson.D{{Key: "email", Value: -1}}),
+	}
+	missing := missingIndexes(before, after)
+	if len(missing) != 2 || missing[0] != "created_at_-1" || missing[1] != "email_1" {
+		t.Errorf("unexpected missing indexes %v", missing)
+	}
+	if names := indexNames(before); len(names) != 3 || names[0] != "_id_" {
+		t.Errorf("unexpected index names %v", names)
+	}
+}
+
+func TestTextIndexSpec(t *testing.T) {
+	spec := TextIndex("articles", map[string]int32{"title": 10, "body": 0}, "english")
+	if len(spec.Keys) != 2 || spec.Keys[0].Key != "body" || spec.Keys[1].Key != "title" || spec.Keys[0].Value != "text" {
+		t.Errorf("unexpected text index keys %v", spec.Keys)
+	}
+	if len(spec.Weights) != 1 || spec.Weights[0].Key != "title" {
+		t.Errorf("unexpected weights %v", spec.Weights)
+	}
+	model := spec.Model()
+	if model.Options == nil || model.Options.DefaultLanguage == nil || *model.Options.DefaultLanguage != "english" {
+		t.Error("expected default language in index options")
+	}
+}
+
+func TestCleanupReleasesStateWhenDisconnectFails(t *testing.T) {
+	main, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workload, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A client disconnected twice fails the second time
+	_ = main.Disconnect(context.Background())
+
+	p := NewMongoDBClient()
+	state := newClientState(main, "app")
+	state.addWorkload(&conf.WorkloadPool{Name: "reports"}, workload, "app")
+	p.swapState(state)
 
-	if p.conf.Uri != "mongodb://localhost:27017" {
-		t.Errorf("default uri: got %q", p.conf.Uri)
+	if err := p.CleanupTasksContext(context.Background()); err == nil {
+		t.Fatal("expected the disconnect error")
 	}
-	if p.conf.Database != "test" {
-		t.Errorf("default database: got %q", p.conf.Database)
+	if p.loadState() != nil {
+		t.Error("expected the client state to be cleared")
 	}
-	if p.conf.MaxPoolSize != 100 {
-		t.Errorf("default maxPoolSize: got %d", p.conf.MaxPoolSize)
+	if err := workload.Disconnect(context.Background()); !errors.Is(err, mongo.ErrClientDisconnected) {
+		t.Errorf("expected the workload pool to be disconnected, got %v", err)
 	}
 }
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// buildCommandMonitor assembles the CommandMonitor of a client built from cfg from the Prometheus and
+// tracing monitors and the optional command inspection hooks; it returns nil when nothing needs command events
+func (p *PlugMongoDB) buildCommandMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
+	var monitors []*event.CommandMonitor
+	if p.prometheusMetrics != nil {
+		monitors = append(monitors, p.prometheusMetrics.CreateCommandMonitor(cfg))
+	}
+	monitors = append(monitors, p.createTracingMonitor(cfg), p.createSLOMonitor(cfg), p.createTxnConflictMonitor(),
+		p.createHotDocumentMonitor(), p.createLoadCommandMonitor())
+	if cfg.GetEnableRegexGuard() {
+		monitors = append(monitors, p.createRegexGuardMonitor())
+	}
+	monitors = append(monitors, p.createOpLabelMonitor(cfg), p.createDebugMonitor())
+	if mode := cfg.GetQueryScanMode(); mode != "" && mode != QueryScanOff {
+		monitors = append(monitors, p.createQueryScanMonitor())
+	}
+	return composeCommandMonitors(monitors...)
+}
+
+// composeCommandMonitors fans command events out to every non-nil monitor, in order
+func composeCommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	var active []*event.CommandMonitor
+	for _, m := range monitors {
+		if m != nil {
+			active = append(active, m)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			for _, m := range active {
+				if m.Started != nil {
+					m.Started(ctx, evt)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			for _, m := range active {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, evt)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			for _, m := range active {
+				if m.Failed != nil {
+					m.Failed(ctx, evt)
+				}
+			}
+		},
+	}
+}
+
+// commandCollection returns the collection a command targets: the string value of its first
+// element (find, insert, update, delete, aggregate, count, ...), or "" for database-level commands
+func commandCollection(cmd bson.Raw) string {
+	elem, err := cmd.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+	coll, ok := elem.Value().StringValueOK()
+	if !ok {
+		return ""
+	}
+	return coll
+}
+
+// commandCancelled reports whether a command failed because the caller cancelled its context,
+// rather than because of the server or the network. Deadlines are not cancellations: a command
+// running past its timeout is a latency failure.
+func commandCancelled(ctx context.Context, evt *event.CommandFailedEvent) bool {
+	if ctx != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return true
+	}
+	return strings.Contains(evt.Failure, context.Canceled.Error())
+}
@@ -0,0 +1,95 @@
+package mongodb
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+// redactedCollection replaces the collection label of namespaces filtered out in redact_only mode
+const redactedCollection = "_other"
+
+// namespaceFilter decides which command namespaces metrics are recorded for (metrics_namespaces)
+type namespaceFilter struct {
+	include []string
+	exclude []string
+	redact  bool
+}
+
+// newNamespaceFilter returns nil when cfg filters nothing, so every namespace is measured
+func newNamespaceFilter(cfg *conf.NamespaceFilter) *namespaceFilter {
+	if len(cfg.GetInclude()) == 0 && len(cfg.GetExclude()) == 0 {
+		return nil
+	}
+	return &namespaceFilter{include: cfg.GetInclude(), exclude: cfg.GetExclude(), redact: cfg.GetRedactOnly()}
+}
+
+// validateNamespaceFilter checks the metrics_namespaces patterns
+func validateNamespaceFilter(cfg *conf.NamespaceFilter) error {
+	for _, pattern := range append(cfg.GetInclude(), cfg.GetExclude()...) {
+		if pattern == "" {
+			return fmt.Errorf("namespace pattern cannot be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// allowed reports whether commands on database.collection are measured
+func (f *namespaceFilter) allowed(database, collection string) bool {
+	if f == nil {
+		return true
+	}
+	if matchNamespace(f.exclude, database, collection) {
+		return false
+	}
+	return len(f.include) == 0 || matchNamespace(f.include, database, collection)
+}
+
+// resolve returns the collection label for a command on database.collection and whether to
+// record it at all; in redact_only mode filtered namespaces are recorded under "_other"
+func (f *namespaceFilter) resolve(database, collection string) (string, bool) {
+	if f.allowed(database, collection) {
+		return collection, true
+	}
+	if f.redact {
+		return redactedCollection, true
+	}
+	return "", false
+}
+
+// matchNamespace reports whether any pattern matches the database or the full namespace
+func matchNamespace(patterns []string, database, collection string) bool {
+	ns := database
+	if collection != "" {
+		ns = database + "." + collection
+	}
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, ".") {
+			if ok, _ := path.Match(pattern, database); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsCollection applies metrics_namespaces to a command-derived collection label
+func (p *PlugMongoDB) metricsCollection(database, collection string) (string, bool) {
+	return p.metricsFilter().resolve(database, collection)
+}
+
+func (p *PlugMongoDB) metricsFilter() *namespaceFilter {
+	if p.config() == nil {
+		return nil
+	}
+	return newNamespaceFilter(p.config().GetMetricsNamespaces())
+}
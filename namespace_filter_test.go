@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestNamespaceFilter(t *testing.T) {
+	f := newNamespaceFilter(&conf.NamespaceFilter{
+		Include: []string{"myapp", "shared.orders_*"},
+		Exclude: []string{"myapp.system.*"},
+	})
+	tests := []struct {
+		database, collection string
+		want                 bool
+	}{
+		{"myapp", "users", true},
+		{"myapp", "", true},
+		{"myapp", "system.profile", false},
+		{"shared", "orders_eu", true},
+		{"shared", "invoices", false},
+		{"tenant_b", "users", false},
+	}
+	for _, tt := range tests {
+		if got := f.allowed(tt.database, tt.collection); got != tt.want {
+			t.Errorf("%s.%s: got %v", tt.database, tt.collection, got)
+		}
+	}
+
+	f.redact = true
+	if label, ok := f.resolve("tenant_b", "users"); !ok || label != redactedCollection {
+		t.Errorf("expected redacted label, got %q %v", label, ok)
+	}
+	if newNamespaceFilter(&conf.NamespaceFilter{RedactOnly: true}) != nil {
+		t.Error("a filter without patterns must measure everything")
+	}
+	if err := validateNamespaceFilter(&conf.NamespaceFilter{Include: []string{"db.[x"}}); err == nil {
+		t.Error("expected a pattern error")
+	}
+}
+
+func TestCommandMonitorSkipsFilteredNamespaces(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "myapp", MetricsNamespaces: &conf.NamespaceFilter{Exclude: []string{"tenant_b"}}}
+	mon := m.CreateCommandMonitor(cfg)
+
+	run := func(id int64, db string) {
+		cmd, _ := bson.Marshal(bson.D{{Key: "find", Value: "users"}})
+		mon.Started(context.Background(), &event.CommandStartedEvent{Command: cmd, DatabaseName: db, CommandName: "find", RequestID: id})
+		mon.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+			CommandName: "find", RequestID: id}})
+	}
+	run(1, "myapp")
+	run(2, "tenant_b")
+
+	if got := testutil.ToFloat64(m.operationsTotal.WithLabelValues("myapp", "find")); got != 1 {
+		t.Errorf("expected 1 measured command, got %v", got)
+	}
+}
@@ -0,0 +1,252 @@
+package mongodb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Health check member targets (health_check_members)
+const (
+	HealthMembersPrimary     = "primary"
+	HealthMembersSecondaries = "secondaries"
+	HealthMembersAll         = "all"
+)
+
+// Member roles reported in NodeHealth
+const (
+	RolePrimary    = "primary"
+	RoleSecondary  = "secondary"
+	RoleArbiter    = "arbiter"
+	RoleStandalone = "standalone"
+	RoleMongos     = "mongos"
+	RoleUnknown    = "unknown"
+)
+
+// NodeHealth is the state of one deployment member as seen by the driver's server monitoring
+type NodeHealth struct {
+	Address string `json:"address"`
+	Role    string `json:"role"`
+	Healthy bool   `json:"healthy"`
+	// RTTMs is the average heartbeat round trip in milliseconds
+	RTTMs float64 `json:"rtt_ms"`
+	// LagMs is the estimated replication lag of a secondary in milliseconds
+	LagMs float64 `json:"lag_ms,omitempty"`
+	Error string  `json:"error,omitempty"`
+	// LastUpdate is the time of the last heartbeat result
+	LastUpdate time.Time `json:"last_update"`
+}
+
+// nodeHealthTracker keeps the latest per-member view from topology description changes
+type nodeHealthTracker struct {
+	mu    sync.RWMutex
+	nodes []NodeHealth
+}
+
+// update replaces the member view with the servers of topology and returns it
+func (t *nodeHealthTracker) update(topology description.Topology) []NodeHealth {
+	nodes := make([]NodeHealth, 0, len(topology.Servers))
+	for _, s := range topology.Servers {
+		n := NodeHealth{
+			Address:    s.Addr.String(),
+			Role:       serverRole(s.Kind),
+			Healthy:    s.Kind != description.Unknown && s.LastError == nil,
+			RTTMs:      float64(s.AverageRTT.Microseconds()) / 1000,
+			LastUpdate: s.LastUpdateTime,
+		}
+		if s.LastError != nil {
+			n.Error = s.LastError.Error()
+		}
+		if s.Kind == description.RSSecondary {
+			n.LagMs = float64(replicationLag(topology, s).Microseconds()) / 1000
+		}
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Address < nodes[j].Address })
+
+	t.mu.Lock()
+	t.nodes = nodes
+	t.mu.Unlock()
+	return nodes
+}
+
+// set replaces the member view with nodes
+func (t *nodeHealthTracker) set(nodes []NodeHealth) {
+	t.mu.Lock()
+	t.nodes = nodes
+	t.mu.Unlock()
+}
+
+func (t *nodeHealthTracker) snapshot() []NodeHealth {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]NodeHealth(nil), t.nodes...)
+}
+
+// replicationLag estimates how far secondary is behind, from the lastWrite dates reported in
+// heartbeats: relative to the primary when one is known (correcting for the heartbeat times),
+// otherwise relative to the most recent secondary
+func replicationLag(topology description.Topology, secondary description.Server) time.Duration {
+	var lag time.Duration
+	var primary *description.Server
+	var freshest time.Time
+	for i, s := range topology.Servers {
+		switch s.Kind {
+		case description.RSPrimary:
+			primary = &topology.Servers[i]
+		case description.RSSecondary:
+			if s.LastWriteTime.After(freshest) {
+				freshest = s.LastWriteTime
+			}
+		}
+	}
+	if secondary.LastWriteTime.IsZero() {
+		return 0
+	}
+	if primary != nil && !primary.LastWriteTime.IsZero() {
+		lag = secondary.LastUpdateTime.Sub(secondary.LastWriteTime) - primary.LastUpdateTime.Sub(primary.LastWriteTime)
+	} else {
+		lag = freshest.Sub(secondary.LastWriteTime)
+	}
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+func serverRole(kind description.ServerKind) string {
+	switch kind {
+	case description.RSPrimary:
+		return RolePrimary
+	case description.RSSecondary:
+		return RoleSecondary
+	case description.RSArbiter:
+		return RoleArbiter
+	case description.Standalone:
+		return RoleStandalone
+	case description.Mongos:
+		return RoleMongos
+	}
+	return RoleUnknown
+}
+
+// NodeHealth returns the per-member health as last reported by the driver's server monitoring
+func (p *PlugMongoDB) NodeHealth() []NodeHealth {
+	return p.nodes.snapshot()
+}
+
+// healthMembers returns the configured health check target
+func (p *PlugMongoDB) healthMembers() string {
+	if m := p.config().GetHealthCheckMembers(); m != "" {
+		return m
+	}
+	return HealthMembersPrimary
+}
+
+// healthReadPref is the read preference the health check ping selects a server with
+func (p *PlugMongoDB) healthReadPref() *readpref.ReadPref {
+	if p.healthMembers() == HealthMembersSecondaries {
+		return readpref.Secondary()
+	}
+	return readpref.Primary()
+}
+
+// checkTargetMembers reports the first unhealthy member targeted by health_check_members.
+// Members the driver has never reached are unhealthy; arbiters are not data-bearing and are skipped.
+func (p *PlugMongoDB) checkTargetMembers(nodes []NodeHealth) error {
+	members := p.healthMembers()
+	if members == HealthMembersPrimary {
+		return nil
+	}
+	var unhealthy []string
+	secondaries := 0
+	for _, n := range nodes {
+		if n.Role == RoleArbiter {
+			continue
+		}
+		if members == HealthMembersSecondaries && n.Role != RoleSecondary && n.Healthy {
+			continue
+		}
+		if n.Role == RoleSecondary {
+			secondaries++
+		}
+		if !n.Healthy {
+			detail := n.Error
+			if detail == "" {
+				detail = "not reachable"
+			}
+			unhealthy = append(unhealthy, n.Address+" ("+detail+")")
+		}
+	}
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("unhealthy mongodb members: %s", strings.Join(unhealthy, ", "))
+	}
+	if members == HealthMembersSecondaries && secondaries == 0 {
+		return fmt.Errorf("no mongodb secondaries available")
+	}
+	return nil
+}
+
+// observeMembers drops the metric series of members no longer in the topology and emits
+// EventTopologyChanged when a discovered replica set gains or loses members (replSetReconfig).
+// The initial discovery, which replaces the seed list with the set's hosts, is not a reconfiguration.
+func (p *PlugMongoDB) observeMembers(previous, current description.Topology) {
+	added, removed := memberChanges(previous, current)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	for _, addr := range removed {
+		p.prometheusMetrics.DeleteNodeHealth(p.config(), addr)
+	}
+	if !isReplicaSet(previous.Kind) || !isReplicaSet(current.Kind) {
+		return
+	}
+	members := make([]string, 0, len(current.Servers))
+	for _, s := range current.Servers {
+		members = append(members, s.Addr.String())
+	}
+	sort.Strings(members)
+	log.Infow("key", "mongodb", "event", "topology_changed", "set", current.SetName,
+		"added", added, "removed", removed)
+	p.emitTyped(EventTopologyChanged, plugins.PriorityNormal, TopologyChangedEvent{
+		SetName: current.SetName,
+		Added:   added,
+		Removed: removed,
+		Members: members,
+	})
+}
+
+// memberChanges returns the sorted member addresses added and removed between two topologies
+func memberChanges(previous, current description.Topology) (added, removed []string) {
+	before := make(map[string]bool, len(previous.Servers))
+	for _, s := range previous.Servers {
+		before[s.Addr.String()] = true
+	}
+	after := make(map[string]bool, len(current.Servers))
+	for _, s := range current.Servers {
+		addr := s.Addr.String()
+		after[addr] = true
+		if !before[addr] {
+			added = append(added, addr)
+		}
+	}
+	for addr := range before {
+		if !after[addr] {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func isReplicaSet(kind description.TopologyKind) bool {
+	return kind == description.ReplicaSetWithPrimary || kind == description.ReplicaSetNoPrimary
+}
@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+func threeNodeTopology(secondaryErr error) description.Topology {
+	dead := description.Server{Addr: address.Address("db-2:27017"), Kind: description.Unknown, LastError: secondaryErr}
+	if secondaryErr == nil {
+		dead.Kind = description.RSSecondary
+	}
+	return description.Topology{Servers: []description.Server{
+		{Addr: address.Address("db-0:27017"), Kind: description.RSPrimary},
+		{Addr: address.Address("db-1:27017"), Kind: description.RSSecondary},
+		dead,
+	}}
+}
+
+// publishingMonitor returns the monitoring state of a client serving traffic
+func publishingMonitor() *clientMonitor {
+	m := &clientMonitor{}
+	m.publishing.Store(true)
+	return m
+}
+
+func TestNodeHealthFromServerMonitor(t *testing.T) {
+	p := NewMongoDBClient()
+	mon := p.createEventServerMonitor(nil, nil, publishingMonitor())
+	mon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{
+		NewDescription: threeNodeTopology(errors.New("connection refused")),
+	})
+
+	nodes := p.NodeHealth()
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %+v", nodes)
+	}
+	if nodes[0].Role != RolePrimary || !nodes[0].Healthy {
+		t.Errorf("unexpected primary %+v", nodes[0])
+	}
+	if nodes[2].Healthy || nodes[2].Error != "connection refused" {
+		t.Errorf("unexpected dead secondary %+v", nodes[2])
+	}
+}
+
+func TestCheckTargetMembers(t *testing.T) {
+	tests := []struct {
+		members   string
+		deadErr   error
+		wantError string
+	}{
+		{HealthMembersPrimary, errors.New("connection refused"), ""},
+		{HealthMembersAll, nil, ""},
+		{HealthMembersAll, errors.New("connection refused"), "db-2:27017 (connection refused)"},
+		{HealthMembersSecondaries, errors.New("connection refused"), "db-2:27017"},
+		{HealthMembersSecondaries, nil, ""},
+	}
+	for _, tt := range tests {
+		p := NewMongoDBClient()
+		WithHealthCheckMembers(tt.members)(p)
+		err := p.checkTargetMembers(p.nodes.update(threeNodeTopology(tt.deadErr)))
+		switch {
+		case tt.wantError == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.members, err)
+		case tt.wantError != "" && (err == nil || !strings.Contains(err.Error(), tt.wantError)):
+			t.Errorf("%s: expected error containing %q, got %v", tt.members, tt.wantError, err)
+		}
+	}
+
+	p := NewMongoDBClient()
+	WithHealthCheckMembers(HealthMembersSecondaries)(p)
+	standalone := description.Topology{Servers: []description.Server{{Addr: address.Address("db-0:27017"), Kind: description.Standalone}}}
+	if err := p.checkTargetMembers(p.nodes.update(standalone)); err == nil {
+		t.Error("expected an error without secondaries")
+	}
+}
+
+func TestObserveMembersDeletesRemovedSeries(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	mon := p.createEventServerMonitor(nil, nil, publishingMonitor())
+
+	before := threeNodeTopology(nil)
+	before.Kind = description.ReplicaSetWithPrimary
+	after := before
+	after.Servers = []description.Server{before.Servers[0], before.Servers[1],
+		{Addr: address.Address("db-3:27017"), Kind: description.RSSecondary}}
+	mon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{NewDescription: before})
+	mon.TopologyDescriptionChanged(&event.TopologyDescriptionChangedEvent{PreviousDescription: before, NewDescription: after})
+
+	added, removed := memberChanges(before, after)
+	if strings.Join(added, ",") != "db-3:27017" || strings.Join(removed, ",") != "db-2:27017" {
+		t.Errorf("unexpected changes added=%v removed=%v", added, removed)
+	}
+	families, err := p.prometheusMetrics.GetGatherer().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, mf := range families {
+		if !strings.HasSuffix(mf.GetName(), "node_up") {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "address" {
+					addresses = append(addresses, l.GetValue())
+				}
+			}
+		}
+	}
+	if strings.Join(addresses, ",") != "db-0:27017,db-1:27017,db-3:27017" {
+		t.Errorf("unexpected node_up series %v", addresses)
+	}
+}
@@ -0,0 +1,180 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Metric label values for operations without a configured owner label
+const (
+	// opLabelUnlabeled is used for operations issued without WithOpLabel
+	opLabelUnlabeled = "unlabeled"
+	// opLabelOther is used for labels missing from op_labels, keeping metric cardinality bounded
+	opLabelOther = "other"
+)
+
+type opLabelKey struct{}
+
+// WithOpLabel tags all operations issued with the returned context with an owner or feature label.
+// The label is sent as the command comment by plugin helpers (visible in the profiler, currentOp and
+// server logs), used as a metric label when listed in op_labels, and included in slow-query logs.
+func WithOpLabel(ctx context.Context, label string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, opLabelKey{}, label)
+}
+
+// OpLabel returns the label set with WithOpLabel, or "". Pass it to SetComment when using
+// the driver collection directly.
+func OpLabel(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	label, _ := ctx.Value(opLabelKey{}).(string)
+	return label
+}
+
+// withCommentLabel adds the context label as the command comment unless cmd already sets one
+func withCommentLabel(ctx context.Context, cmd any) any {
+	label := OpLabel(ctx)
+	d, ok := cmd.(bson.D)
+	if label == "" || !ok {
+		return cmd
+	}
+	for _, e := range d {
+		if e.Key == "comment" {
+			return cmd
+		}
+	}
+	out := make(bson.D, 0, len(d)+1)
+	out = append(out, d...)
+	return append(out, bson.E{Key: "comment", Value: label})
+}
+
+// commentFindOptions sets the context label as the find comment; nil options are ignored by the driver
+func commentFindOptions(ctx context.Context) *options.FindOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.Find().SetComment(label)
+	}
+	return nil
+}
+
+// commentFindOneOptions sets the context label as the findOne comment
+func commentFindOneOptions(ctx context.Context) *options.FindOneOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.FindOne().SetComment(label)
+	}
+	return nil
+}
+
+// commentUpdateOptions sets the context label as the update comment
+func commentUpdateOptions(ctx context.Context) *options.UpdateOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.Update().SetComment(label)
+	}
+	return nil
+}
+
+// commentDeleteOptions sets the context label as the delete comment
+func commentDeleteOptions(ctx context.Context) *options.DeleteOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.Delete().SetComment(label)
+	}
+	return nil
+}
+
+// commentInsertOneOptions sets the context label as the insert comment
+func commentInsertOneOptions(ctx context.Context) *options.InsertOneOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.InsertOne().SetComment(label)
+	}
+	return nil
+}
+
+// commentBulkWriteOptions sets the context label as the bulk write comment
+func commentBulkWriteOptions(ctx context.Context) *options.BulkWriteOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.BulkWrite().SetComment(label)
+	}
+	return nil
+}
+
+// commentCountOptions sets the context label as the count comment
+func commentCountOptions(ctx context.Context) *options.CountOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.Count().SetComment(label)
+	}
+	return nil
+}
+
+// commentAggregateOptions sets the context label as the aggregate comment
+func commentAggregateOptions(ctx context.Context) *options.AggregateOptions {
+	if label := OpLabel(ctx); label != "" {
+		return options.Aggregate().SetComment(label)
+	}
+	return nil
+}
+
+// opLabelSet returns the configured metric labels
+func (p *PlugMongoDB) opLabelSet() map[string]bool {
+	return metricOpLabels(p.config())
+}
+
+// metricOpLabels returns the metric labels configured in cfg
+func metricOpLabels(cfg *conf.MongoDB) map[string]bool {
+	if len(cfg.GetOpLabels()) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(cfg.GetOpLabels()))
+	for _, label := range cfg.GetOpLabels() {
+		if label != "" {
+			set[label] = true
+		}
+	}
+	return set
+}
+
+// metricOpLabel maps a context label onto the bounded metric label set
+func metricOpLabel(label string, allowed map[string]bool) string {
+	switch {
+	case label == "":
+		return opLabelUnlabeled
+	case allowed[label]:
+		return label
+	default:
+		return opLabelOther
+	}
+}
+
+// createOpLabelMonitor records per-label metrics and feeds owner label latency budgets.
+// It returns nil when neither op_labels of cfg (with metrics) nor op_budgets is configured.
+// Slow commands are logged with their owner label by the debug monitor.
+func (p *PlugMongoDB) createOpLabelMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
+	allowed := metricOpLabels(cfg)
+	metrics := p.prometheusMetrics
+	if (len(allowed) == 0 || metrics == nil) && len(p.budgets) == 0 {
+		return nil
+	}
+
+	finished := func(ctx context.Context, evt event.CommandFinishedEvent, failed bool) {
+		label := OpLabel(ctx)
+		p.observeBudgetLatency(label, evt.Duration)
+		if len(allowed) > 0 && metrics != nil {
+			metrics.RecordLabeledOperation(evt.DatabaseName, metricOpLabel(label, allowed), mapCommandNameToOperation(evt.CommandName), evt.Duration, failed)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			finished(ctx, evt.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			finished(ctx, evt.CommandFinishedEvent, true)
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package mongodb
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOpLabel(t *testing.T) {
+	ctx := WithOpLabel(context.Background(), "billing")
+	if got := OpLabel(ctx); got != "billing" {
+		t.Errorf("expected billing, got %q", got)
+	}
+	if got := OpLabel(context.Background()); got != "" {
+		t.Errorf("expected empty label, got %q", got)
+	}
+
+	allowed := map[string]bool{"billing": true}
+	for label, want := range map[string]string{"billing": "billing", "search": opLabelOther, "": opLabelUnlabeled} {
+		if got := metricOpLabel(label, allowed); got != want {
+			t.Errorf("metricOpLabel(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestWithCommentLabel(t *testing.T) {
+	cmd := bson.D{{Key: "ping", Value: 1}}
+	ctx := WithOpLabel(context.Background(), "billing")
+
+	got, ok := withCommentLabel(ctx, cmd).(bson.D)
+	if !ok || len(got) != 2 || got[1].Key != "comment" || got[1].Value != "billing" {
+		t.Fatalf("expected comment to be appended, got %v", got)
+	}
+	if len(cmd) != 1 {
+		t.Error("original command must not be modified")
+	}
+
+	withComment := bson.D{{Key: "ping", Value: 1}, {Key: "comment", Value: "mine"}}
+	if got := withCommentLabel(ctx, withComment).(bson.D); len(got) != 2 || got[1].Value != "mine" {
+		t.Errorf("existing comment must be kept, got %v", got)
+	}
+	if got := withCommentLabel(context.Background(), cmd).(bson.D); len(got) != 1 {
+		t.Errorf("unlabeled context must not add a comment, got %v", got)
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	p := NewMongoDBClient()
+	WithPprofLabels(true)(p)
+
+	ctx := WithOpLabel(context.Background(), "billing")
+	op := operation{name: "find", database: "shop", collection: "orders"}
+	var called bool
+	p.withProfilerLabels(ctx, op, func(ctx context.Context) {
+		called = true
+		for key, want := range map[string]string{
+			pprofLabelOperation:  "find",
+			pprofLabelDatabase:   "shop",
+			pprofLabelCollection: "orders",
+			pprofLabelOwner:      "billing",
+		} {
+			if got, _ := pprof.Label(ctx, key); got != want {
+				t.Errorf("label %s = %q, want %q", key, got, want)
+			}
+		}
+	})
+	if !called {
+		t.Fatal("fn was not called")
+	}
+}
@@ -0,0 +1,144 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultOperationTimeout is used when the plugin config does not set operation_timeout
+const defaultOperationTimeout = 30 * time.Second
+
+// operation describes a unit of work executed through the plugin helpers
+type operation struct {
+	// Logical operation name (find, runCommand, aggregate, ...)
+	name string
+	// Target database name
+	database string
+	// Target collection name, empty for database-level commands
+	collection string
+	// Timeout overriding the configured operation timeout (zero keeps the default)
+	timeout time.Duration
+	// Filter, pipeline or command checked by the query security scanner in block mode
+	query any
+}
+
+// runOperation executes fn through the managed client with the shared helper behavior:
+// context validation, the query security scanner, maintenance mode, the circuit breaker, load shedding, owner label budgets, the batch client
+// rate limit, the configured (or batch) operation timeout (never extending a sooner caller deadline),
+// the primary election write buffer, priority concurrency slots, profiler labels, transient error and
+// throttle retries. Errors are *OperationError values classified by error kind.
+func (p *PlugMongoDB) runOperation(ctx context.Context, op operation, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return op.fail(err)
+	}
+	if p.GetClient() == nil {
+		return &OperationError{Operation: op.name, Namespace: op.namespace(), Kind: ErrUnavailable, Err: errClientNotInitialized}
+	}
+	if err := p.checkQuery(op); err != nil {
+		return &OperationError{Operation: op.name, Namespace: op.namespace(), Kind: ErrBadQuery, Err: err}
+	}
+	done, err := p.maintenance.admit(op.name, PriorityFrom(ctx))
+	if err != nil {
+		p.prometheusMetrics.RecordMaintenanceRejection(p.config(), PriorityFrom(ctx).String())
+		return op.fail(err)
+	}
+	defer done()
+	probe, err := p.breaker.allow(time.Now())
+	if err != nil {
+		p.prometheusMetrics.RecordCircuitRejection(p.config(), op.name)
+		return op.fail(err)
+	}
+	outcome := circuitSkipped
+	defer func() { p.breaker.record(time.Now(), probe, outcome) }()
+	if err := p.shedLoad(ctx, op.name); err != nil {
+		return op.fail(err)
+	}
+	if err := p.enforceBudget(ctx); err != nil {
+		return op.fail(err)
+	}
+	batch := p.batchFor(ctx)
+	if batch != nil {
+		if err := batch.Wait(ctx); err != nil {
+			return op.fail(err)
+		}
+	}
+
+	timeout := op.timeout
+	if timeout <= 0 && batch != nil {
+		timeout = batch.timeout
+	}
+	if timeout <= 0 {
+		timeout = p.operationTimeout()
+	}
+	opCtx, cancel := p.createTimeoutContext(ctx, timeout)
+	defer cancel()
+	if err := p.awaitPrimary(opCtx, op.name); err != nil {
+		return op.fail(err)
+	}
+	release, err := p.acquirePrioritySlot(opCtx)
+	if err != nil {
+		return op.fail(err)
+	}
+	defer release()
+	p.withProfilerLabels(opCtx, op, func(ctx context.Context) {
+		err = p.retryTransient(ctx, op.name, func(ctx context.Context) error {
+			return p.retryThrottled(ctx, op.name, fn)
+		})
+	})
+	outcome = circuitOutcomeOf(err)
+	if err != nil {
+		return op.fail(err)
+	}
+	return nil
+}
+
+// operationTimeout returns the configured helper timeout
+func (p *PlugMongoDB) operationTimeout() time.Duration {
+	if timeout := p.config().GetOperationTimeout().AsDuration(); timeout > 0 {
+		return timeout
+	}
+	return defaultOperationTimeout
+}
+
+// databaseHandle resolves a database by name on the workload pool selected by ctx,
+// falling back to the configured database
+func (p *PlugMongoDB) databaseHandle(ctx context.Context, name string) (*mongo.Database, error) {
+	s := p.stateFor(ctx)
+	if s == nil {
+		return nil, errClientNotInitialized
+	}
+	if name == "" || (p.config() != nil && name == p.config().Database) {
+		return s.database, nil
+	}
+	return s.client.Database(name), nil
+}
+
+// collectionHandle resolves a collection of the configured database on the workload pool selected by ctx,
+// with the read preference of WithSmartRead and WithMaxStaleness calls
+func (p *PlugMongoDB) collectionHandle(ctx context.Context, name string) (*mongo.Collection, error) {
+	db, err := p.databaseHandle(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return p.readCollection(ctx, db.Collection(name))
+}
+
+// databaseName returns name or the configured database when name is empty
+func (p *PlugMongoDB) databaseName(name string) string {
+	if name == "" && p.config() != nil {
+		return p.config().Database
+	}
+	return name
+}
+
+func (op operation) namespace() string {
+	if op.collection == "" {
+		return op.database
+	}
+	return op.database + "." + op.collection
+}
@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// OplogWindow is the time span covered by the oplog of the primary
+type OplogWindow struct {
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+	// Window is Last-First: how long a member can be offline, or a backup run, and still catch up
+	// from the oplog
+	Window time.Duration `json:"window"`
+}
+
+// oplogEntry is the timestamp of an oplog entry
+type oplogEntry struct {
+	TS primitive.Timestamp `bson:"ts"`
+}
+
+// OplogWindow reads the first and last entries of the primary's oplog (local.oplog.rs). It fails on
+// standalone servers and through mongos, and requires read access to the local database.
+func (p *PlugMongoDB) OplogWindow(ctx context.Context) (OplogWindow, error) {
+	var first, last oplogEntry
+	op := operation{name: "find", database: "local", collection: "oplog.rs"}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "local")
+		if err != nil {
+			return err
+		}
+		oplog := db.Collection("oplog.rs", options.Collection().SetReadPreference(readpref.Primary()))
+		projection := bson.D{{Key: "ts", Value: 1}, {Key: "_id", Value: 0}}
+		if err := oplog.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "$natural", Value: 1}}).SetProjection(projection)).Decode(&first); err != nil {
+			return err
+		}
+		return oplog.FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "$natural", Value: -1}}).SetProjection(projection)).Decode(&last)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return OplogWindow{}, fmt.Errorf("mongodb oplog not found: the server is not a replica set member")
+	}
+	if err != nil {
+		return OplogWindow{}, err
+	}
+	return oplogWindow(first.TS, last.TS), nil
+}
+
+func oplogWindow(first, last primitive.Timestamp) OplogWindow {
+	w := OplogWindow{
+		First: time.Unix(int64(first.T), 0).UTC(),
+		Last:  time.Unix(int64(last.T), 0).UTC(),
+	}
+	w.Window = w.Last.Sub(w.First)
+	return w
+}
+
+// collectOplogWindow exports the oplog window. Without read access to the local database the
+// read is only retried every deniedRetryAfter; deployments without an oplog are skipped.
+func (p *PlugMongoDB) collectOplogWindow(ctx context.Context) {
+	m := p.prometheusMetrics
+	if m == nil || !p.oplogGate.allowed(time.Now()) {
+		return
+	}
+	w, err := p.OplogWindow(ctx)
+	if errorCode(err) == codeUnauthorized {
+		p.oplogGate.deny(time.Now())
+		log.Warnw("key", "mongodb", "event", "oplog_window_denied", "error", err,
+			"hint", "grant read on the local database to export the oplog window")
+		return
+	}
+	if err != nil {
+		log.Debugf("mongodb oplog window not collected: %v", err)
+		return
+	}
+	m.RecordOplogWindow(p.config(), w)
+}
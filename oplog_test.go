@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestOplogWindowMetrics(t *testing.T) {
+	w := oplogWindow(primitive.Timestamp{T: 1_700_000_000, I: 3}, primitive.Timestamp{T: 1_700_086_400, I: 1})
+	if w.Window != 24*time.Hour || w.First.Unix() != 1_700_000_000 {
+		t.Fatalf("unexpected oplog window %+v", w)
+	}
+
+	m := NewPrometheusMetrics(nil)
+	m.RecordOplogWindow(&conf.MongoDB{Database: "test"}, w)
+	if got := testutil.ToFloat64(m.oplogWindow.WithLabelValues("test")); got != 86400 {
+		t.Errorf("oplog_window_seconds = %v, want 86400", got)
+	}
+	if got := testutil.ToFloat64(m.oplogLastTime.WithLabelValues("test")); got != 1_700_086_400 {
+		t.Errorf("oplog_last_timestamp_seconds = %v, want 1700086400", got)
+	}
+}
+
+func TestOplogWindowUnreachable(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond)})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	if _, err := p.OplogWindow(t.Context()); err == nil {
+		t.Error("expected an error from an unreachable server")
+	}
+	p.collectOplogWindow(t.Context())
+	if n := testutil.CollectAndCount(p.prometheusMetrics.oplogWindow); n != 0 {
+		t.Errorf("expected no oplog window series after a failed read, got %d", n)
+	}
+	if !p.oplogGate.allowed(time.Now()) {
+		t.Error("a connection error should not disable the oplog window")
+	}
+}
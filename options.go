@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
@@ -13,142 +15,744 @@ type Option func(*PlugMongoDB)
 // WithURI sets the connection string
 func WithURI(uri string) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.Uri = uri
+		p.config().Uri = uri
 	}
 }
 
 // WithDatabase sets the database name
 func WithDatabase(database string) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.Database = database
+		p.config().Database = database
 	}
 }
 
 // WithCredentials sets authentication information
 func WithCredentials(username, password, authSource string) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.Username = username
-		p.conf.Password = password
-		p.conf.AuthSource = authSource
+		p.config().Username = username
+		p.config().Password = password
+		p.config().AuthSource = authSource
+	}
+}
+
+// WithAuth sets the authentication mechanism and credentials, taking precedence over WithCredentials
+func WithAuth(auth *conf.Auth) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().Auth = auth
 	}
 }
 
 // WithPoolSize sets connection pool size
 func WithPoolSize(maxPoolSize, minPoolSize uint64) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.MaxPoolSize = maxPoolSize
-		p.conf.MinPoolSize = minPoolSize
+		p.config().MaxPoolSize = maxPoolSize
+		p.config().MinPoolSize = minPoolSize
 	}
 }
 
 // WithTimeouts sets timeout configuration
 func WithTimeouts(connectTimeout, serverSelectionTimeout, socketTimeout time.Duration) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.ConnectTimeout = durationpb.New(connectTimeout)
-		p.conf.ServerSelectionTimeout = durationpb.New(serverSelectionTimeout)
-		p.conf.SocketTimeout = durationpb.New(socketTimeout)
+		p.config().ConnectTimeout = durationpb.New(connectTimeout)
+		p.config().ServerSelectionTimeout = durationpb.New(serverSelectionTimeout)
+		p.config().SocketTimeout = durationpb.New(socketTimeout)
 	}
 }
 
 // WithHeartbeatInterval sets heartbeat interval
 func WithHeartbeatInterval(interval time.Duration) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.HeartbeatInterval = durationpb.New(interval)
+		p.config().HeartbeatInterval = durationpb.New(interval)
 	}
 }
 
 // WithMetrics sets metrics enablement
 func WithMetrics(enable bool) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableMetrics = enable
+		p.config().EnableMetrics = enable
 	}
 }
 
 // WithHealthCheck sets health check configuration
 func WithHealthCheck(enable bool, interval time.Duration) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableHealthCheck = enable
-		p.conf.HealthCheckInterval = durationpb.New(interval)
+		p.config().EnableHealthCheck = enable
+		p.config().HealthCheckInterval = durationpb.New(interval)
 	}
 }
 
 // WithTLS sets TLS configuration
 func WithTLS(enable bool, certFile, keyFile, caFile string) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableTls = enable
-		p.conf.TlsCertFile = certFile
-		p.conf.TlsKeyFile = keyFile
-		p.conf.TlsCaFile = caFile
+		p.config().EnableTls = enable
+		p.config().TlsCertFile = certFile
+		p.config().TlsKeyFile = keyFile
+		p.config().TlsCaFile = caFile
+	}
+}
+
+// WithTLSServerName sets the server name (SNI) used and verified in the TLS handshake
+func WithTLSServerName(name string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().TlsServerName = name
+	}
+}
+
+// WithTLSInsecureSkipVerify disables server certificate verification; only use it for testing
+func WithTLSInsecureSkipVerify(skip bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().TlsInsecureSkipVerify = skip
 	}
 }
 
 // WithCompression sets compression configuration
 func WithCompression(enable bool, level int) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableCompression = enable
-		p.conf.CompressionLevel = int32(level)
+		p.config().EnableCompression = enable
+		p.config().CompressionLevel = int32(level)
 	}
 }
 
 // WithRetryWrites sets retry writes configuration
 func WithRetryWrites(enable bool) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableRetryWrites = enable
+		p.config().EnableRetryWrites = enable
 	}
 }
 
 // WithReadConcern sets read concern configuration
 func WithReadConcern(enable bool, level string) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableReadConcern = enable
-		p.conf.ReadConcernLevel = level
+		p.config().EnableReadConcern = enable
+		p.config().ReadConcernLevel = level
 	}
 }
 
 // WithWriteConcern sets write concern configuration
 func WithWriteConcern(enable bool, w int, timeout time.Duration) Option {
 	return func(p *PlugMongoDB) {
-		if p.conf == nil {
-			p.conf = &conf.MongoDB{}
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().EnableWriteConcern = enable
+		p.config().WriteConcernW = int32(w)
+		p.config().WriteConcernTimeout = durationpb.New(timeout)
+	}
+}
+
+// WithTimeHandling sets time.Time codec configuration
+func WithTimeHandling(forceUTC, truncateToMillis, warnOnLocalTime bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().TimeHandling = &conf.TimeHandling{
+			Enabled:          true,
+			ForceUtc:         forceUTC,
+			TruncateToMillis: truncateToMillis,
+			WarnOnLocalTime:  warnOnLocalTime,
+		}
+	}
+}
+
+// WithOperationTimeout sets the timeout applied by plugin helpers
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().OperationTimeout = durationpb.New(timeout)
+	}
+}
+
+// WithRegexGuard enables counting of unanchored regex patterns in command filters
+func WithRegexGuard(enabled bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().EnableRegexGuard = enabled
+	}
+}
+
+// WithQueryScanMode sets the query security scanner mode (QueryScanOff, QueryScanWarn or QueryScanBlock)
+func WithQueryScanMode(mode string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().QueryScanMode = mode
+	}
+}
+
+// WithOpLabels sets the owner labels (see WithOpLabel) reported as metric labels
+func WithOpLabels(labels ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().OpLabels = labels
+	}
+}
+
+// WithSlowQueryThreshold logs commands taking at least threshold with their owner label
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().SlowQueryThreshold = durationpb.New(threshold)
+	}
+}
+
+// WithOpBudget adds a budget for an owner label; zero values disable the corresponding limit
+func WithOpBudget(label string, maxOpsPerSecond float64, maxP99Latency time.Duration, mode string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		budget := &conf.OpBudget{Label: label, MaxOpsPerSecond: maxOpsPerSecond, Mode: mode}
+		if maxP99Latency > 0 {
+			budget.MaxP99Latency = durationpb.New(maxP99Latency)
+		}
+		p.config().OpBudgets = append(p.config().OpBudgets, budget)
+	}
+}
+
+// WithPprofLabels enables runtime/pprof labels around plugin helper operations
+func WithPprofLabels(enabled bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().EnablePprofLabels = enabled
+	}
+}
+
+// WithWarmUp enables the startup warm-up phase with the given priming queries
+func WithWarmUp(timeout time.Duration, failOnError bool, queries ...*conf.PrimingQuery) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().WarmUp = &conf.WarmUp{
+			Enabled:     true,
+			Queries:     queries,
+			Timeout:     durationpb.New(timeout),
+			FailOnError: failOnError,
+		}
+	}
+}
+
+// WithWorkloadPool adds a dedicated connection pool for a workload
+func WithWorkloadPool(pool *conf.WorkloadPool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().WorkloadPools = append(p.config().WorkloadPools, pool)
+	}
+}
+
+// WithBatchClient enables the batch client with the given pool size and rate limit; zero values keep the defaults
+func WithBatchClient(maxPoolSize uint64, maxOpsPerSecond float64) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().BatchClient = &conf.BatchClient{
+			Enabled:         true,
+			MaxPoolSize:     maxPoolSize,
+			MaxOpsPerSecond: maxOpsPerSecond,
+		}
+	}
+}
+
+// WithQualityCheck enables the periodic data quality checker on the given collections
+// (all registered schemas when none are given); zero values keep the defaults
+func WithQualityCheck(interval time.Duration, sampleSize int32, collections ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().QualityCheck = &conf.QualityCheck{
+			Enabled:     true,
+			Interval:    durationpb.New(interval),
+			SampleSize:  sampleSize,
+			Collections: collections,
+		}
+	}
+}
+
+// WithQuarantineCollection copies documents that helpers fail to decode into collection
+func WithQuarantineCollection(collection string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().QuarantineCollection = collection
+	}
+}
+
+// WithMetricAlias additionally exposes metric under legacyName, renaming labels per the
+// labels mapping (plugin label -> legacy label)
+func WithMetricAlias(metric, legacyName string, labels map[string]string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().MetricAliases = append(p.config().MetricAliases, &conf.MetricAlias{
+			Metric:     metric,
+			LegacyName: legacyName,
+			Labels:     labels,
+		})
+	}
+}
+
+// WithHealthCheckMembers selects the members health checks require:
+// HealthMembersPrimary, HealthMembersSecondaries or HealthMembersAll
+func WithHealthCheckMembers(members string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().HealthCheckMembers = members
+	}
+}
+
+// WithMetricsNamespaces restricts command metrics to the include patterns minus the exclude patterns.
+// With redactOnly, filtered-out namespaces are still measured under the collection label "_other".
+func WithMetricsNamespaces(include, exclude []string, redactOnly bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().MetricsNamespaces = &conf.NamespaceFilter{Include: include, Exclude: exclude, RedactOnly: redactOnly}
+	}
+}
+
+// WithHistogramSampleRate observes only the given fraction of commands in duration histograms,
+// keeping counters exact, to cut metric overhead on high-throughput services
+func WithHistogramSampleRate(rate float64) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().HistogramSampleRate = rate
+	}
+}
+
+// WithSmartReadMaxLag sets the replication lag beyond which WithSmartRead reads fall back to the primary
+func WithSmartReadMaxLag(maxLag time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().SmartReadMaxLag = durationpb.New(maxLag)
+	}
+}
+
+// WithDeadLetterCollection sets the collection recording writes that failed permanently
+func WithDeadLetterCollection(collection string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().DeadLetterCollection = collection
+	}
+}
+
+// WithSchemaProvisioning sets how registered collections are handled at startup: off, check or apply
+func WithSchemaProvisioning(mode string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().SchemaProvisioning = mode
+	}
+}
+
+// WithWriteGuard adds a write guard rule: UpdateMany/DeleteMany filters on collections matching
+// pattern must hold requiredFields, and may only be empty when allowEmpty is set
+func WithWriteGuard(pattern string, requiredFields []string, allowEmpty bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().WriteGuards = append(p.config().WriteGuards, &conf.WriteGuard{
+			Collection:     pattern,
+			RequiredFields: requiredFields,
+			AllowEmpty:     allowEmpty,
+		})
+	}
+}
+
+// WithDDLWindow restricts index builds, collMod and migrations to maintenance windows opened by the
+// cron schedules for duration each (zero uses one hour), evaluated in UTC
+func WithDDLWindow(duration time.Duration, schedules ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		window := &conf.DDLWindow{Schedules: schedules}
+		if duration > 0 {
+			window.Duration = durationpb.New(duration)
+		}
+		p.config().DdlWindow = window
+	}
+}
+
+// WithIndexBuildPollInterval sets how often $currentOp is polled for index build progress
+func WithIndexBuildPollInterval(d time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().IndexBuildPollInterval = durationpb.New(d)
+	}
+}
+
+// WithIndexCoordinationCollection sets the collection holding the state of rolling index builds
+func WithIndexCoordinationCollection(collection string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().IndexCoordinationCollection = collection
+	}
+}
+
+// WithCollectionStats sets the refresh interval of the collection statistics cache and the
+// collections kept cached even while unused
+func WithCollectionStats(refresh time.Duration, collections ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().CollectionStats = &conf.CollectionStats{RefreshInterval: durationpb.New(refresh), Collections: collections}
+	}
+}
+
+// WithPlanCacheMetrics exports the query plan cache of the given collections every interval
+// (zero uses one minute)
+func WithPlanCacheMetrics(interval time.Duration, collections ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		cfg := &conf.PlanCacheMetrics{Collections: collections}
+		if interval > 0 {
+			cfg.Interval = durationpb.New(interval)
+		}
+		p.config().PlanCacheMetrics = cfg
+	}
+}
+
+// WithBackupMonitor checks the marker documents backup tooling writes to collection and reports
+// backups older than maxAge as stale
+func WithBackupMonitor(collection string, maxAge time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().BackupMonitor = &conf.BackupMonitor{Collection: collection, MaxAge: durationpb.New(maxAge)}
+	}
+}
+
+// WithTracing enables a span per command, created by tp (nil uses the global OpenTelemetry
+// tracer provider)
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().EnableTracing = true
+		p.tracerProvider = tp
+	}
+}
+
+// WithLatencySLO adds a latency SLO: objective percent of the given operations (all when none is
+// named) finish within target
+func WithLatencySLO(name string, target time.Duration, objective float64, operations ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().LatencySlos = append(p.config().LatencySlos, &conf.LatencySLO{
+			Name:          name,
+			Operations:    operations,
+			TargetLatency: durationpb.New(target),
+			Objective:     objective,
+		})
+	}
+}
+
+// WithHotDocuments enables hot document detection reporting the topK most accessed document keys
+// (0 uses the default of 20); keyFields default to _id
+func WithHotDocuments(topK int, keyFields ...string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().HotDocuments = &conf.HotDocuments{
+			Enabled:   true,
+			KeyFields: keyFields,
+			TopK:      int32(topK),
+		}
+	}
+}
+
+// WithThrottleRetry retries helper operations rejected by server throttling up to maxRetries times,
+// honoring retry-after hints up to maxBackoff (zero values use the defaults)
+func WithThrottleRetry(maxRetries int, backoff, maxBackoff time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().ThrottleRetry = &conf.ThrottleRetry{
+			Enabled:    true,
+			MaxRetries: int32(maxRetries),
+			Backoff:    durationpb.New(backoff),
+			MaxBackoff: durationpb.New(maxBackoff),
+		}
+	}
+}
+
+// WithRetry retries helper operations failing with transient errors up to maxAttempts attempts,
+// with a jittered exponential backoff from backoff up to maxBackoff (zero values use the defaults)
+func WithRetry(maxAttempts int, backoff, maxBackoff time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().Retry = &conf.Retry{
+			Enabled:     true,
+			MaxAttempts: int32(maxAttempts),
+			Backoff:     durationpb.New(backoff),
+			MaxBackoff:  durationpb.New(maxBackoff),
+		}
+	}
+}
+
+// WithHealthThresholds marks a reachable deployment degraded (not ready) above maxPingLatency or
+// maxPoolUtilization percent of the pool (zero disables either), or without a reachable primary
+// when requirePrimary is set
+func WithHealthThresholds(maxPingLatency time.Duration, maxPoolUtilization float64, requirePrimary bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		if p.config().HealthThresholds == nil {
+			p.config().HealthThresholds = &conf.HealthThresholds{}
+		}
+		if maxPingLatency > 0 {
+			p.config().HealthThresholds.MaxPingLatency = durationpb.New(maxPingLatency)
+		}
+		p.config().HealthThresholds.MaxPoolUtilization = maxPoolUtilization
+		p.config().HealthThresholds.RequirePrimary = requirePrimary
+	}
+}
+
+// WithLivenessFailures fails liveness after n consecutive failed health checks (0 never does)
+func WithLivenessFailures(n int) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
 		}
-		p.conf.EnableWriteConcern = enable
-		p.conf.WriteConcernW = int32(w)
-		p.conf.WriteConcernTimeout = durationpb.New(timeout)
+		if p.config().HealthThresholds == nil {
+			p.config().HealthThresholds = &conf.HealthThresholds{}
+		}
+		p.config().HealthThresholds.LivenessFailures = int32(n)
+	}
+}
+
+// WithLoadShedding enables the threshold load shedding policy: operations up to shedPriority are
+// rejected while the average connection checkout wait exceeds maxPoolWait or the failed command
+// percentage exceeds maxErrorRate (zero disables a bound)
+func WithLoadShedding(maxPoolWait time.Duration, maxErrorRate float64, shedPriority Priority) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().LoadShedding = &conf.LoadShedding{
+			MaxPoolWait:  durationpb.New(maxPoolWait),
+			MaxErrorRate: maxErrorRate,
+			ShedPriority: shedPriority.String(),
+		}
+	}
+}
+
+// WithPriorityConcurrency bounds concurrent helper operations: high operations start while fewer
+// than maxInFlight are in flight, normal and low ones while fewer than normalLimit and lowLimit
+// (zero uses max_in_flight and half of it)
+func WithPriorityConcurrency(maxInFlight, normalLimit, lowLimit int32) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().PriorityConcurrency = &conf.PriorityConcurrency{
+			MaxInFlight: maxInFlight,
+			NormalLimit: normalLimit,
+			LowLimit:    lowLimit,
+		}
+	}
+}
+
+// WithCircuitBreaker enables the circuit breaker: helper operations fail fast with ErrCircuitOpen
+// for openDuration once errorRate percent of them fail with unavailability or timeout errors, then
+// halfOpenProbes successful probes close it again (zero uses the defaults)
+func WithCircuitBreaker(errorRate float64, openDuration time.Duration, halfOpenProbes int32) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().CircuitBreaker = &conf.CircuitBreaker{
+			ErrorRate:      errorRate,
+			OpenDuration:   durationpb.New(openDuration),
+			HalfOpenProbes: halfOpenProbes,
+		}
+	}
+}
+
+// WithWriteBuffer holds helper writes issued while the replica set elects a new primary, up to
+// maxWrites at once for at most maxWait each, and runs them once a primary is elected (zero uses
+// the defaults)
+func WithWriteBuffer(maxWrites int32, maxWait time.Duration) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().WriteBuffer = &conf.WriteBuffer{
+			Enabled:   true,
+			MaxWrites: maxWrites,
+			MaxWait:   durationpb.New(maxWait),
+		}
+	}
+}
+
+// WithMigrations applies the pending schema migrations at startup: the ones registered with
+// RegisterMigrations and the JSON command scripts of dir (empty for none)
+func WithMigrations(dir string) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().Migrations = &conf.Migrations{Enabled: true, Dir: dir}
+	}
+}
+
+// WithSeed loads the fixture files of dir at startup; with onlyIfEmpty, collections already
+// holding documents are skipped
+func WithSeed(dir string, onlyIfEmpty bool) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().Seed = &conf.Seed{Enabled: true, Dir: dir, OnlyIfEmpty: onlyIfEmpty}
+	}
+}
+
+// WithFailover keeps a warm standby client connected to the cluster of uri and switches to it
+// once the active cluster fails failureThreshold consecutive checks, run every checkInterval (zero
+// uses the defaults)
+func WithFailover(uri string, checkInterval time.Duration, failureThreshold int32) Option {
+	return func(p *PlugMongoDB) {
+		if p.config() == nil {
+			p.conf.Store(&conf.MongoDB{})
+		}
+		p.config().Failover = &conf.Failover{
+			Uri:              uri,
+			CheckInterval:    durationpb.New(checkInterval),
+			FailureThreshold: failureThreshold,
+		}
+	}
+}
+
+// WithHostResolver sets the resolver of the seed list, replacing the hosts of the uri; the client
+// is rebuilt when the resolved hosts change (see discovery.refresh_interval)
+func WithHostResolver(r HostResolver) Option {
+	return func(p *PlugMongoDB) {
+		p.hostResolver = r
+	}
+}
+
+// WithDialer sets the dialer of connections, for instance one tunneling through SSH; it replaces the
+// tcp_keep_alive and dial_timeout settings, and proxy_url connections to the proxy go through it
+func WithDialer(d options.ContextDialer) Option {
+	return func(p *PlugMongoDB) {
+		p.dialer = d
+	}
+}
+
+// WithRetryPolicy sets a custom retry policy of helper operations, used instead of retry
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *PlugMongoDB) {
+		p.customRetryPolicy = policy
+	}
+}
+
+// WithOutboxPublisher registers the publisher of outbox entries and starts the outbox relay
+func WithOutboxPublisher(publisher OutboxPublisher) Option {
+	return func(p *PlugMongoDB) {
+		p.outboxPublisher = publisher
+	}
+}
+
+// WithShedPolicy sets a custom load shedding policy, used instead of load_shedding
+func WithShedPolicy(policy ShedPolicy) Option {
+	return func(p *PlugMongoDB) {
+		p.shedPolicy = policy
+	}
+}
+
+// WithAuditHook sets a receiver for audit events of operational changes
+func WithAuditHook(hook AuditHook) Option {
+	return func(p *PlugMongoDB) {
+		p.auditHook = hook
 	}
 }
@@ -0,0 +1,392 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox defaults
+const (
+	defaultOutboxCollection   = "outbox"
+	defaultOutboxInterval     = time.Second
+	defaultOutboxBatchSize    = 100
+	defaultOutboxLease        = 30 * time.Second
+	defaultOutboxBackoff      = time.Second
+	maxOutboxBackoff          = 5 * time.Minute
+	outboxPendingIndexName    = "outbox_pending"
+	outboxRetentionIndexName  = "outbox_retention"
+	codeChangeStreamsDisabled = 40573
+)
+
+// OutboxMessage is an event written to the outbox with EnqueueOutbox or WithOutbox
+type OutboxMessage struct {
+	// Topic routes the message, e.g. a broker topic or an event type
+	Topic string
+	// Key is an optional partitioning or deduplication key
+	Key string
+	// Payload is encoded as a BSON document
+	Payload any
+	// Headers are optional metadata passed to the publisher
+	Headers map[string]string
+}
+
+// OutboxEntry is a stored outbox message
+type OutboxEntry struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	Topic   string             `bson:"topic"`
+	Key     string             `bson:"key,omitempty"`
+	Payload bson.Raw           `bson:"payload"`
+	Headers map[string]string  `bson:"headers,omitempty"`
+	// CreatedAt is the enqueue time
+	CreatedAt time.Time `bson:"created_at"`
+	// AvailableAt is the time the entry may be claimed: after a claim the end of its lease, after
+	// a failed publish the next retry
+	AvailableAt time.Time `bson:"available_at"`
+	// Attempts counts the claims, the current one included
+	Attempts    int        `bson:"attempts"`
+	PublishedAt *time.Time `bson:"published_at,omitempty"`
+	// Error is the last publish failure
+	Error string `bson:"error,omitempty"`
+}
+
+// OutboxPublisher publishes outbox entries, e.g. to a message broker. An entry is published at
+// least once: it is handed over again when Publish fails or the relay stops before recording its
+// publication, so consumers should deduplicate on the entry ID.
+type OutboxPublisher interface {
+	Publish(ctx context.Context, entry OutboxEntry) error
+}
+
+// OutboxPublisherFunc adapts a function to OutboxPublisher
+type OutboxPublisherFunc func(ctx context.Context, entry OutboxEntry) error
+
+// Publish calls f
+func (f OutboxPublisherFunc) Publish(ctx context.Context, entry OutboxEntry) error {
+	return f(ctx, entry)
+}
+
+// outboxSettings is the resolved outbox configuration
+type outboxSettings struct {
+	collection string
+	interval   time.Duration
+	batchSize  int
+	lease      time.Duration
+	backoff    time.Duration
+	watch      bool
+	retention  time.Duration
+}
+
+func outboxSettingsOf(cfg *conf.Outbox) outboxSettings {
+	s := outboxSettings{
+		collection: cfg.GetCollection(),
+		interval:   cfg.GetPollInterval().AsDuration(),
+		batchSize:  int(cfg.GetBatchSize()),
+		lease:      cfg.GetLease().AsDuration(),
+		backoff:    cfg.GetRetryBackoff().AsDuration(),
+		watch:      cfg.GetWatch(),
+		retention:  cfg.GetRetention().AsDuration(),
+	}
+	if s.collection == "" {
+		s.collection = defaultOutboxCollection
+	}
+	if s.interval <= 0 {
+		s.interval = defaultOutboxInterval
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultOutboxBatchSize
+	}
+	if s.lease <= 0 {
+		s.lease = defaultOutboxLease
+	}
+	if s.backoff <= 0 {
+		s.backoff = defaultOutboxBackoff
+	}
+	return s
+}
+
+// retryAfter returns the wait before retrying an entry claimed attempts times
+func (s outboxSettings) retryAfter(attempts int) time.Duration {
+	d := s.backoff
+	for i := 1; i < attempts && d < maxOutboxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxOutboxBackoff)
+}
+
+// outboxIndexes are the indexes of the outbox collection, ensured with the managed indexes when
+// outbox is configured: pending entries in insertion order, and the retention TTL
+func outboxIndexes(cfg *conf.MongoDB) []IndexSpec {
+	if cfg.GetOutbox() == nil {
+		return nil
+	}
+	s := outboxSettingsOf(cfg.GetOutbox())
+	specs := []IndexSpec{{
+		Collection: s.collection,
+		Name:       outboxPendingIndexName,
+		Keys:       bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}},
+	}}
+	if s.retention > 0 {
+		specs = append(specs, IndexSpec{
+			Collection: s.collection,
+			Name:       outboxRetentionIndexName,
+			Keys:       bson.D{{Key: "published_at", Value: 1}},
+			TTL:        s.retention,
+		})
+	}
+	return specs
+}
+
+// EnqueueOutbox writes messages to the outbox collection within the transaction of ctx, so they
+// are stored only if the transaction commits. It fails outside a transaction.
+func (p *PlugMongoDB) EnqueueOutbox(ctx context.Context, messages ...OutboxMessage) error {
+	if ctx == nil || !inTransaction(ctx) {
+		return fmt.Errorf("outbox messages must be enqueued within a transaction")
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	s := outboxSettingsOf(p.config().GetOutbox())
+	now := time.Now().UTC()
+	docs := make([]any, len(messages))
+	for i, msg := range messages {
+		if msg.Topic == "" {
+			return fmt.Errorf("outbox message %d: topic cannot be empty", i)
+		}
+		if msg.Payload == nil {
+			return fmt.Errorf("outbox message %d: %w", i, mongo.ErrNilDocument)
+		}
+		payload, err := p.marshal(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("outbox message %d: failed to encode payload: %w", i, err)
+		}
+		docs[i] = OutboxEntry{
+			Topic:       msg.Topic,
+			Key:         msg.Key,
+			Payload:     payload,
+			Headers:     msg.Headers,
+			CreatedAt:   now,
+			AvailableAt: now,
+		}
+	}
+	op := operation{name: "insert", database: p.databaseName(""), collection: s.collection}
+	return p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, s.collection)
+		if err != nil {
+			return err
+		}
+		_, err = coll.InsertMany(ctx, docs)
+		return err
+	})
+}
+
+// WithOutbox runs fn in a transaction, like WithTransaction, and writes the messages it returns to
+// the outbox in the same transaction: the domain writes of fn and their events commit together.
+func (p *PlugMongoDB) WithOutbox(ctx context.Context, fn func(sessCtx mongo.SessionContext) ([]OutboxMessage, error), opts ...TxnOption) error {
+	if fn == nil {
+		return fmt.Errorf("transaction function cannot be nil")
+	}
+	return p.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		messages, err := fn(sessCtx)
+		if err != nil {
+			return err
+		}
+		return p.EnqueueOutbox(sessCtx, messages...)
+	}, opts...)
+}
+
+// startOutboxRelay starts relaying outbox entries to the publisher of WithOutboxPublisher: a pass
+// every poll_interval, and with watch a pass on every insert into the outbox collection
+func (p *PlugMongoDB) startOutboxRelay() {
+	if p.outboxPublisher == nil {
+		return
+	}
+	s := outboxSettingsOf(p.config().GetOutbox())
+	p.startPeriodicTask("outbox_relay", s.interval, p.runOutboxRelay)
+	if s.watch {
+		p.startBackgroundTask("outbox_watch", p.watchOutbox)
+	}
+}
+
+// runOutboxRelay runs a relay pass, logging failures
+func (p *PlugMongoDB) runOutboxRelay(ctx context.Context) {
+	if _, err := p.RelayOutbox(ctx); err != nil && ctx.Err() == nil {
+		log.Warnw("key", "mongodb", "event", "outbox_relay_failed", "error", err)
+	}
+}
+
+// RelayOutbox hands up to batch_size due outbox entries to the publisher, oldest first, and
+// returns the number published. Each entry is claimed for the lease before it is published, so
+// relays of several instances share the outbox; an entry whose publish fails is retried after a
+// backoff without holding back later entries. It fails without a publisher.
+func (p *PlugMongoDB) RelayOutbox(ctx context.Context) (int, error) {
+	publisher := p.outboxPublisher
+	if publisher == nil {
+		return 0, fmt.Errorf("no outbox publisher is registered")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.outboxMu.Lock()
+	defer p.outboxMu.Unlock()
+
+	s := outboxSettingsOf(p.config().GetOutbox())
+	published := 0
+	for range s.batchSize {
+		entry, err := p.claimOutboxEntry(ctx, s)
+		if err != nil || entry == nil {
+			return published, err
+		}
+		pubCtx, cancel := context.WithTimeout(ctx, s.lease)
+		err = publisher.Publish(pubCtx, *entry)
+		cancel()
+		if err != nil {
+			log.Warnw("key", "mongodb", "event", "outbox_publish_failed", "id", entry.ID.Hex(), "topic", entry.Topic,
+				"attempts", entry.Attempts, "error", err)
+			p.prometheusMetrics.RecordOutboxFailed(p.config())
+			if err := p.markOutboxFailed(ctx, s, entry, err); err != nil && !errors.Is(err, errOutboxLeaseLost) {
+				return published, err
+			}
+			continue
+		}
+		if err := p.markOutboxPublished(ctx, s, entry); errors.Is(err, errOutboxLeaseLost) {
+			// Another relay claimed the entry after the lease expired and publishes it again
+			continue
+		} else if err != nil {
+			return published, err
+		}
+		p.prometheusMetrics.RecordOutboxPublished(p.config(), time.Since(entry.CreatedAt))
+		published++
+	}
+	return published, nil
+}
+
+// claimOutboxEntry claims the oldest due entry for the lease, nil when none is due
+func (p *PlugMongoDB) claimOutboxEntry(ctx context.Context, s outboxSettings) (*OutboxEntry, error) {
+	now := time.Now().UTC()
+	filter := bson.D{{Key: "published_at", Value: nil}, {Key: "available_at", Value: bson.D{{Key: "$lte", Value: now}}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "available_at", Value: now.Add(s.lease)}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	var entry OutboxEntry
+	op := operation{name: "findAndModify", database: p.databaseName(""), collection: s.collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, s.collection)
+		if err != nil {
+			return err
+		}
+		opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After)
+		return coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// errOutboxLeaseLost reports that an entry was claimed again, by this or another relay, after the
+// lease of the relay recording its outcome expired; the new claim records the outcome instead
+var errOutboxLeaseLost = errors.New("outbox entry lease lost")
+
+// markOutboxPublished records the publication of entry
+func (p *PlugMongoDB) markOutboxPublished(ctx context.Context, s outboxSettings, entry *OutboxEntry) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "published_at", Value: time.Now().UTC()}}},
+		{Key: "$unset", Value: bson.D{{Key: "error", Value: ""}}},
+	}
+	return p.updateOutboxEntry(ctx, s, entry, update)
+}
+
+// markOutboxFailed records the publish failure of entry and schedules its retry
+func (p *PlugMongoDB) markOutboxFailed(ctx context.Context, s outboxSettings, entry *OutboxEntry, cause error) error {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "error", Value: cause.Error()},
+		{Key: "available_at", Value: time.Now().UTC().Add(s.retryAfter(entry.Attempts))},
+	}}}
+	return p.updateOutboxEntry(ctx, s, entry, update)
+}
+
+// updateOutboxEntry applies update to entry while the relay still holds its claim: every claim
+// increments attempts, so a changed count means the lease was lost and errOutboxLeaseLost is returned
+func (p *PlugMongoDB) updateOutboxEntry(ctx context.Context, s outboxSettings, entry *OutboxEntry, update bson.D) error {
+	filter := bson.D{{Key: "_id", Value: entry.ID}, {Key: "attempts", Value: entry.Attempts}}
+	var matched int64
+	op := operation{name: "update", database: p.databaseName(""), collection: s.collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, s.collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		matched = res.MatchedCount
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update outbox entry %s: %w", entry.ID.Hex(), err)
+	}
+	if matched == 0 {
+		log.Warnw("key", "mongodb", "event", "outbox_lease_lost", "id", entry.ID.Hex(), "topic", entry.Topic,
+			"attempts", entry.Attempts)
+		return errOutboxLeaseLost
+	}
+	return nil
+}
+
+// watchOutbox runs a relay pass on every insert into the outbox collection, reopening the change
+// stream after errors. It gives up, leaving polling alone, on deployments without change streams.
+func (p *PlugMongoDB) watchOutbox(ctx context.Context) {
+	s := outboxSettingsOf(p.config().GetOutbox())
+	for ctx.Err() == nil {
+		err := p.watchOutboxOnce(ctx, s)
+		if ctx.Err() != nil {
+			return
+		}
+		if hasServerErrorCode(err, codeChangeStreamsDisabled) {
+			log.Warnw("key", "mongodb", "event", "outbox_watch_unsupported", "error", err)
+			return
+		}
+		log.Warnw("key", "mongodb", "event", "outbox_watch_failed", "error", err)
+		if sleepContext(ctx, s.interval) != nil {
+			return
+		}
+	}
+}
+
+// watchOutboxOnce tails inserts into the outbox collection until the change stream fails
+func (p *PlugMongoDB) watchOutboxOnce(ctx context.Context, s outboxSettings) error {
+	coll, err := p.collectionHandle(ctx, s.collection)
+	if err != nil {
+		return err
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}
+	stream, err := coll.Watch(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer p.TrackChangeStream(stream)()
+	defer func() { _ = stream.Close(context.WithoutCancel(ctx)) }()
+	for stream.Next(ctx) {
+		// Inserts of one transaction arrive together; drain them before relaying
+		for stream.RemainingBatchLength() > 0 {
+			if !stream.Next(ctx) {
+				break
+			}
+		}
+		p.runOutboxRelay(ctx)
+	}
+	return stream.Err()
+}
@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestOutboxSettings(t *testing.T) {
+	s := outboxSettingsOf(nil)
+	if s.collection != defaultOutboxCollection || s.interval != defaultOutboxInterval || s.batchSize != defaultOutboxBatchSize ||
+		s.lease != defaultOutboxLease || s.backoff != defaultOutboxBackoff || s.watch {
+		t.Errorf("defaults = %+v", s)
+	}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 20: maxOutboxBackoff} {
+		if got := s.retryAfter(attempts); got != want {
+			t.Errorf("retryAfter(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	if specs := outboxIndexes(&conf.MongoDB{}); len(specs) != 0 {
+		t.Errorf("indexes without outbox: %+v", specs)
+	}
+	specs := outboxIndexes(&conf.MongoDB{Outbox: &conf.Outbox{Collection: "events_outbox", Retention: durationpb.New(24 * time.Hour)}})
+	if len(specs) != 2 || specs[0].Collection != "events_outbox" || specs[0].Name != outboxPendingIndexName ||
+		specs[1].Name != outboxRetentionIndexName || specs[1].TTL != 24*time.Hour {
+		t.Errorf("outbox indexes = %+v", specs)
+	}
+}
+
+func TestOutboxRequiresTransaction(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	if err := p.EnqueueOutbox(t.Context(), OutboxMessage{Topic: "orders", Payload: bson.M{"id": 1}}); err == nil {
+		t.Error("enqueued outside a transaction")
+	}
+	if _, err := p.RelayOutbox(t.Context()); err == nil {
+		t.Error("relayed without a publisher")
+	}
+}
+
+func TestRelayOutboxUnavailable(t *testing.T) {
+	published := 0
+	p := NewMongoDBClient()
+	WithOutboxPublisher(OutboxPublisherFunc(func(context.Context, OutboxEntry) error {
+		published++
+		return nil
+	}))(p)
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond)})
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	if n, err := p.RelayOutbox(t.Context()); err == nil || n != 0 || published != 0 {
+		t.Errorf("RelayOutbox = %d, %v with %d published, want a claim failure", n, err, published)
+	}
+}
+
+func TestStartBackgroundTask(t *testing.T) {
+	p := NewMongoDBClient()
+	started, stopped := make(chan struct{}), make(chan struct{})
+	p.startBackgroundTask("watch", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+	})
+	p.startBackgroundTask("watch", func(context.Context) { t.Error("started a task twice") })
+	<-started
+	p.stopPeriodicTasks()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("task not cancelled")
+	}
+	p.statsWG.Wait()
+}
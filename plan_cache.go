@@ -0,0 +1,138 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultPlanCacheInterval is the poll interval when plan_cache_metrics.interval is unset
+const defaultPlanCacheInterval = time.Minute
+
+// PlanCacheSummary summarizes the query plan cache of a collection
+type PlanCacheSummary struct {
+	Collection string `json:"collection"`
+	Entries    int    `json:"entries"`
+	// Inactive counts entries whose plan is not trusted yet; many of them point at replanning
+	Inactive  int   `json:"inactive"`
+	SizeBytes int64 `json:"size_bytes"`
+	// Keys are the plan cache keys, used to detect entries coming and going between polls
+	Keys []string `json:"-"`
+}
+
+// planCacheState keeps the plan cache keys of the previous poll of each collection
+type planCacheState struct {
+	mu   sync.Mutex
+	keys map[string]map[string]bool
+}
+
+type planCacheEntry struct {
+	PlanCacheKey       string `bson:"planCacheKey"`
+	IsActive           bool   `bson:"isActive"`
+	EstimatedSizeBytes int64  `bson:"estimatedSizeBytes"`
+}
+
+// PlanCacheStats summarizes the plan cache of collection with $planCacheStats (on a sharded
+// cluster, the entries of every shard). It requires the planCacheRead privilege.
+func (p *PlugMongoDB) PlanCacheStats(ctx context.Context, collection string) (PlanCacheSummary, error) {
+	summary := PlanCacheSummary{Collection: collection}
+	op := operation{name: "planCacheStats", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		pipeline := mongo.Pipeline{
+			{{Key: "$planCacheStats", Value: bson.D{}}},
+			{{Key: "$project", Value: bson.D{{Key: "planCacheKey", Value: 1}, {Key: "isActive", Value: 1}, {Key: "estimatedSizeBytes", Value: 1}}}},
+		}
+		cursor, err := coll.Aggregate(ctx, pipeline, commentAggregateOptions(ctx))
+		if err != nil {
+			return err
+		}
+		var entries []planCacheEntry
+		if err := cursor.All(ctx, &entries); err != nil {
+			return err
+		}
+		summary = summarizePlanCache(collection, entries)
+		return nil
+	})
+	return summary, err
+}
+
+func summarizePlanCache(collection string, entries []planCacheEntry) PlanCacheSummary {
+	summary := PlanCacheSummary{Collection: collection, Entries: len(entries)}
+	for _, e := range entries {
+		if !e.IsActive {
+			summary.Inactive++
+		}
+		summary.SizeBytes += e.EstimatedSizeBytes
+		summary.Keys = append(summary.Keys, e.PlanCacheKey)
+	}
+	return summary
+}
+
+// startPlanCacheMetrics starts polling the plan cache of the configured collections
+func (p *PlugMongoDB) startPlanCacheMetrics() {
+	cfg := p.config().GetPlanCacheMetrics()
+	if len(cfg.GetCollections()) == 0 || !p.config().GetEnableMetrics() {
+		return
+	}
+	interval := cfg.GetInterval().AsDuration()
+	if interval <= 0 {
+		interval = defaultPlanCacheInterval
+	}
+	p.startPeriodicTask("plan_cache_metrics", interval, p.collectPlanCache)
+}
+
+// collectPlanCache exports the plan cache of the configured collections
+func (p *PlugMongoDB) collectPlanCache(ctx context.Context) {
+	for _, collection := range p.config().GetPlanCacheMetrics().GetCollections() {
+		if ctx.Err() != nil {
+			return
+		}
+		summary, err := p.PlanCacheStats(ctx, collection)
+		if err != nil {
+			log.Warnw("key", "mongodb", "event", "plan_cache_stats_failed", "collection", collection, "error", err)
+			continue
+		}
+		inserted, evicted := p.planCache.diff(collection, summary.Keys)
+		if name, ok := p.metricsCollection(p.databaseName(""), collection); ok {
+			p.prometheusMetrics.RecordPlanCache(p.config(), name, summary, inserted, evicted)
+		}
+	}
+}
+
+// diff stores keys as the plan cache of collection and counts the keys that appeared and
+// disappeared since the previous poll. The first poll only sets the baseline.
+func (s *planCacheState) diff(collection string, keys []string) (inserted, evicted int) {
+	current := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		current[k] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]map[string]bool)
+	}
+	previous, polled := s.keys[collection]
+	s.keys[collection] = current
+	if !polled {
+		return 0, 0
+	}
+	for k := range current {
+		if !previous[k] {
+			inserted++
+		}
+	}
+	for k := range previous {
+		if !current[k] {
+			evicted++
+		}
+	}
+	return inserted, evicted
+}
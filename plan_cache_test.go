@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSummarizePlanCache(t *testing.T) {
+	summary := summarizePlanCache("orders", []planCacheEntry{
+		{PlanCacheKey: "a", IsActive: true, EstimatedSizeBytes: 1000},
+		{PlanCacheKey: "b", EstimatedSizeBytes: 500},
+	})
+	if summary.Entries != 2 || summary.Inactive != 1 || summary.SizeBytes != 1500 || len(summary.Keys) != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestPlanCacheDiff(t *testing.T) {
+	var s planCacheState
+	if in, out := s.diff("orders", []string{"a", "b"}); in != 0 || out != 0 {
+		t.Errorf("the first poll sets the baseline, got %d inserted %d evicted", in, out)
+	}
+	if in, out := s.diff("orders", []string{"b", "c", "d"}); in != 2 || out != 1 {
+		t.Errorf("got %d inserted %d evicted, want 2 and 1", in, out)
+	}
+	if in, out := s.diff("users", []string{"a"}); in != 0 || out != 0 {
+		t.Error("collections have their own baseline")
+	}
+}
+
+func TestRecordPlanCache(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "test"}
+	m.RecordPlanCache(cfg, "orders", PlanCacheSummary{Entries: 4, Inactive: 1, SizeBytes: 2048}, 2, 3)
+	if got := testutil.ToFloat64(m.planCacheEntries.WithLabelValues("test", "orders")); got != 4 {
+		t.Errorf("plan_cache_entries = %v, want 4", got)
+	}
+	if got := testutil.ToFloat64(m.planCacheEvicted.WithLabelValues("test", "orders")); got != 3 {
+		t.Errorf("plan_cache_evicted_total = %v, want 3", got)
+	}
+	var nilMetrics *PrometheusMetrics
+	nilMetrics.RecordPlanCache(cfg, "orders", PlanCacheSummary{}, 0, 0)
+}
@@ -2,6 +2,9 @@ package mongodb
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 
 	"github.com/go-lynx/lynx"
 	"github.com/go-lynx/lynx/pkg/factory"
@@ -68,6 +71,16 @@ func GetMongoDBDatabase() *mongo.Database {
 	return database
 }
 
+// GetMongoDBDatabaseForReads gets the database instance of reads that tolerate replication lag
+// (see PlugMongoDB.GetDatabaseForReads)
+func GetMongoDBDatabaseForReads() *mongo.Database {
+	plugin := GetMongoDBPlugin()
+	if plugin == nil {
+		return nil
+	}
+	return plugin.GetDatabaseForReads()
+}
+
 // GetMongoDBCollection gets the MongoDB collection instance
 func GetMongoDBCollection(collectionName string) *mongo.Collection {
 	collection, err := GetProvider().Collection(context.Background(), collectionName)
@@ -86,3 +99,42 @@ func GetMetricsGatherer() prometheus.Gatherer {
 	}
 	return plugin.MetricsGatherer()
 }
+
+// HealthHandler returns the HTTP health handler of the mongodb plugin (see PlugMongoDB.HealthHandler).
+// The plugin is resolved per request, so the handler can be mounted before the plugin loads.
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plugin := GetMongoDBPlugin()
+		if plugin == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(HealthReport{Status: HealthDown, Error: "mongodb plugin is not loaded"})
+			return
+		}
+		plugin.HealthHandler().ServeHTTP(w, r)
+	})
+}
+
+// ReadinessHandler returns the readiness probe handler of the mongodb plugin (see
+// PlugMongoDB.ReadinessHandler), resolving the plugin per request
+func ReadinessHandler() http.Handler {
+	return probeHandler(func(r *http.Request) error {
+		plugin := GetMongoDBPlugin()
+		if plugin == nil {
+			return fmt.Errorf("mongodb plugin is not loaded")
+		}
+		return plugin.Readiness(r.Context())
+	})
+}
+
+// LivenessHandler returns the liveness probe handler of the mongodb plugin (see
+// PlugMongoDB.LivenessHandler), resolving the plugin per request
+func LivenessHandler() http.Handler {
+	return probeHandler(func(*http.Request) error {
+		plugin := GetMongoDBPlugin()
+		if plugin == nil {
+			return fmt.Errorf("mongodb plugin is not loaded")
+		}
+		return plugin.Liveness()
+	})
+}
@@ -0,0 +1,37 @@
+package mongodb
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Profiler label keys attached around helper operations
+const (
+	pprofLabelOperation  = "mongodb.operation"
+	pprofLabelDatabase   = "mongodb.database"
+	pprofLabelCollection = "mongodb.collection"
+	pprofLabelOwner      = "mongodb.label"
+)
+
+// withProfilerLabels runs fn with runtime/pprof labels describing op when enable_pprof_labels is set,
+// so CPU and goroutine profiles can be sliced by the database work in progress. Goroutines started
+// by fn inherit the labels.
+func (p *PlugMongoDB) withProfilerLabels(ctx context.Context, op operation, fn func(ctx context.Context)) {
+	if p.config() == nil || !p.config().EnablePprofLabels {
+		fn(ctx)
+		return
+	}
+	pprof.Do(ctx, profilerLabels(ctx, op), fn)
+}
+
+// profilerLabels builds the label set for op, including the owner label when present
+func profilerLabels(ctx context.Context, op operation) pprof.LabelSet {
+	kv := []string{pprofLabelOperation, op.name, pprofLabelDatabase, op.database}
+	if op.collection != "" {
+		kv = append(kv, pprofLabelCollection, op.collection)
+	}
+	if label := OpLabel(ctx); label != "" {
+		kv = append(kv, pprofLabelOwner, label)
+	}
+	return pprof.Labels(kv...)
+}
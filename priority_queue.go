@@ -0,0 +1,136 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+// priorityWaiter is an operation queued for a priority slot
+type priorityWaiter struct {
+	priority Priority
+	ready    chan struct{}
+}
+
+// priorityLimiter bounds in-flight helper operations: an operation starts while fewer operations
+// than the limit of its priority are in flight, and released slots go to the highest-priority
+// waiter first (in arrival order within a priority). Critical operations never wait.
+type priorityLimiter struct {
+	highLimit   int
+	normalLimit int
+	lowLimit    int
+
+	mu       sync.Mutex
+	inFlight int
+	waiters  []*priorityWaiter
+}
+
+// newPriorityLimiter returns the limiter of priority_concurrency, or nil when max_in_flight is unset
+func newPriorityLimiter(cfg *conf.PriorityConcurrency) (*priorityLimiter, error) {
+	if cfg.GetMaxInFlight() <= 0 {
+		return nil, nil
+	}
+	l := &priorityLimiter{
+		highLimit:   int(cfg.GetMaxInFlight()),
+		normalLimit: int(cfg.GetNormalLimit()),
+		lowLimit:    int(cfg.GetLowLimit()),
+	}
+	if l.normalLimit <= 0 {
+		l.normalLimit = l.highLimit
+	}
+	if l.lowLimit <= 0 {
+		l.lowLimit = max(l.highLimit/2, 1)
+	}
+	if l.normalLimit > l.highLimit || l.lowLimit > l.normalLimit {
+		return nil, fmt.Errorf("limits must satisfy low_limit <= normal_limit <= max_in_flight, got %d, %d, %d",
+			l.lowLimit, l.normalLimit, l.highLimit)
+	}
+	return l, nil
+}
+
+func (l *priorityLimiter) limit(priority Priority) int {
+	switch {
+	case priority >= PriorityHigh:
+		return l.highLimit
+	case priority == PriorityNormal:
+		return l.normalLimit
+	}
+	return l.lowLimit
+}
+
+// acquire takes a slot for an operation of priority, waiting while the in-flight count is at its
+// limit; queued reports whether it waited
+func (l *priorityLimiter) acquire(ctx context.Context, priority Priority) (queued bool, err error) {
+	l.mu.Lock()
+	if priority >= PriorityCritical || l.inFlight < l.limit(priority) {
+		l.inFlight++
+		l.mu.Unlock()
+		return false, nil
+	}
+	w := &priorityWaiter{priority: priority, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true, nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	if i := slices.Index(l.waiters, w); i >= 0 {
+		l.waiters = slices.Delete(l.waiters, i, i+1)
+		l.mu.Unlock()
+		return true, ctx.Err()
+	}
+	l.mu.Unlock()
+	// The slot was granted while the context ended: hand it on
+	l.release()
+	return true, ctx.Err()
+}
+
+// release frees a slot and grants slots to the waiters now admitted
+func (l *priorityLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	for len(l.waiters) > 0 {
+		next := 0
+		for i, w := range l.waiters {
+			if w.priority > l.waiters[next].priority {
+				next = i
+			}
+		}
+		w := l.waiters[next]
+		// Limits grow with priority: when the first waiter of the highest priority cannot start,
+		// no other waiter can
+		if l.inFlight >= l.limit(w.priority) {
+			return
+		}
+		l.waiters = slices.Delete(l.waiters, next, next+1)
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+// acquirePrioritySlot waits for a priority_concurrency slot for the context priority within ctx;
+// the returned function releases it
+func (p *PlugMongoDB) acquirePrioritySlot(ctx context.Context) (func(), error) {
+	l := p.priorities
+	if l == nil {
+		return func() {}, nil
+	}
+	priority := PriorityFrom(ctx)
+	start := time.Now()
+	queued, err := l.acquire(ctx, priority)
+	if queued {
+		p.prometheusMetrics.RecordPriorityWait(p.config(), priority.String(), time.Since(start))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a %s priority slot: %w", priority, err)
+	}
+	return l.release, nil
+}
@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+func TestNewPriorityLimiter(t *testing.T) {
+	if l, err := newPriorityLimiter(nil); l != nil || err != nil {
+		t.Errorf("expected no limiter without configuration, got %v, %v", l, err)
+	}
+	l, err := newPriorityLimiter(&conf.PriorityConcurrency{MaxInFlight: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.limit(PriorityHigh) != 8 || l.limit(PriorityNormal) != 8 || l.limit(PriorityLow) != 4 {
+		t.Errorf("unexpected default limits: %+v", l)
+	}
+	if _, err := newPriorityLimiter(&conf.PriorityConcurrency{MaxInFlight: 4, NormalLimit: 2, LowLimit: 3}); err == nil {
+		t.Error("expected an error for low_limit above normal_limit")
+	}
+}
+
+func TestPriorityLimiterOrder(t *testing.T) {
+	l, err := newPriorityLimiter(&conf.PriorityConcurrency{MaxInFlight: 2, LowLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for range 2 {
+		if queued, err := l.acquire(ctx, PriorityNormal); queued || err != nil {
+			t.Fatalf("acquire = %v, %v", queued, err)
+		}
+	}
+	if queued, err := l.acquire(ctx, PriorityCritical); queued || err != nil {
+		t.Fatalf("critical acquire = %v, %v", queued, err)
+	}
+
+	started := make(chan Priority, 2)
+	wait := func(priority Priority) {
+		if _, err := l.acquire(ctx, priority); err == nil {
+			started <- priority
+		}
+	}
+	waitQueued := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			l.mu.Lock()
+			queued := len(l.waiters)
+			l.mu.Unlock()
+			if queued == n {
+				return
+			}
+		}
+		t.Fatalf("expected %d queued operations", n)
+	}
+	go wait(PriorityLow)
+	waitQueued(1)
+	go wait(PriorityHigh)
+	waitQueued(2)
+
+	l.release() // the critical operation: 2 in flight, nobody admitted
+	l.release()
+	if got := <-started; got != PriorityHigh {
+		t.Fatalf("first admitted priority = %v, want high", got)
+	}
+	l.release()
+	select {
+	case <-started:
+		t.Fatal("low operation started with one operation in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.release()
+	if got := <-started; got != PriorityLow {
+		t.Fatalf("admitted priority = %v, want low", got)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if queued, err := l.acquire(timeout, PriorityLow); !queued || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire = %v, %v, want a deadline error", queued, err)
+	}
+	if len(l.waiters) != 0 || l.inFlight != 1 {
+		t.Errorf("expected the timed out operation to leave the queue: %d waiters, %d in flight", len(l.waiters), l.inFlight)
+	}
+}
@@ -0,0 +1,153 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var projectionCache sync.Map // [2]reflect.Type{doc, proj} -> bson.D
+
+// ProjectionFor derives the projection document selecting the fields of TProj from documents
+// shaped like TDoc. Every BSON field of TProj must be a field of TDoc (unless TDoc collects
+// unknown fields in an inline map); _id is excluded unless TProj declares it.
+func ProjectionFor[TDoc, TProj any]() (bson.D, error) {
+	doc := indirectType(reflect.TypeOf((*TDoc)(nil)).Elem())
+	proj := indirectType(reflect.TypeOf((*TProj)(nil)).Elem())
+	key := [2]reflect.Type{doc, proj}
+	if cached, ok := projectionCache.Load(key); ok {
+		return cached.(bson.D), nil
+	}
+	projection, err := buildProjection(doc, proj)
+	if err != nil {
+		return nil, err
+	}
+	projectionCache.Store(key, projection)
+	return projection, nil
+}
+
+func buildProjection(doc, proj reflect.Type) (bson.D, error) {
+	if doc.Kind() != reflect.Struct || proj.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("projections need struct types, got %s and %s", doc, proj)
+	}
+	docFields := make(map[string]bool)
+	for _, f := range structBSONFields(doc) {
+		docFields[f.name] = true
+	}
+	openDoc := hasInlineMap(doc)
+
+	var projection bson.D
+	hasID := false
+	for _, f := range structBSONFields(proj) {
+		if f.name == "_id" {
+			hasID = true
+		}
+		if !docFields[f.name] && !openDoc {
+			return nil, fmt.Errorf("projection field %q of %s is not a field of %s", f.name, proj, doc)
+		}
+		projection = append(projection, bson.E{Key: f.name, Value: 1})
+	}
+	if len(projection) == 0 {
+		return nil, fmt.Errorf("%s has no fields to project", proj)
+	}
+	if !hasID {
+		projection = append(projection, bson.E{Key: "_id", Value: 0})
+	}
+	return projection, nil
+}
+
+// FindProjected runs a find on collection fetching only the fields of TProj (see ProjectionFor)
+// and decodes the results into TProj. A projection set in opts is replaced.
+func FindProjected[TDoc, TProj any](ctx context.Context, p *PlugMongoDB, collection string, filter any, opts ...*options.FindOptions) ([]TProj, error) {
+	if p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	projection, err := ProjectionFor[TDoc, TProj]()
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	if filter, err = ScopeFilter(ctx, collection, filter); err != nil {
+		return nil, err
+	}
+	findOpts := append([]*options.FindOptions{callFindOptions(ctx)}, opts...)
+	findOpts = append(findOpts, options.Find().SetProjection(projection), commentFindOptions(ctx))
+
+	var results []TProj
+	var size resultSize
+	op := operation{name: "find", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Find(ctx, filter, findOpts...)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		results, size = nil, resultSize{}
+		for cursor.Next(ctx) {
+			size.add(cursor.Current)
+			var item TProj
+			if err := p.decodeDocument(ctx, collection, cursor.Current, &item); err != nil {
+				return err
+			}
+			results = append(results, item)
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.recordResultSize(collection, size)
+	return results, nil
+}
+
+// FindOneProjected reads the first document matching filter into TProj, fetching only its fields.
+// It returns mongo.ErrNoDocuments (wrapped) when nothing matches.
+func FindOneProjected[TDoc, TProj any](ctx context.Context, p *PlugMongoDB, collection string, filter any, opts ...*options.FindOneOptions) (*TProj, error) {
+	if p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	projection, err := ProjectionFor[TDoc, TProj]()
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	if filter, err = ScopeFilter(ctx, collection, filter); err != nil {
+		return nil, err
+	}
+	findOpts := append([]*options.FindOneOptions{callFindOneOptions(ctx)}, opts...)
+	findOpts = append(findOpts, options.FindOne().SetProjection(projection), commentFindOneOptions(ctx))
+
+	var result TProj
+	op := operation{name: "find", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		raw, err := coll.FindOne(ctx, filter, findOpts...).Raw()
+		if err != nil {
+			return err
+		}
+		size := resultSize{}
+		size.add(raw)
+		p.recordResultSize(collection, size)
+		return p.decodeDocument(ctx, collection, raw, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
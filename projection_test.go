@@ -0,0 +1,67 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type projectionUser struct {
+	ID      string `bson:"_id"`
+	Name    string `bson:"name"`
+	Email   string `bson:"email"`
+	Profile struct {
+		Bio string `bson:"bio"`
+	} `bson:"profile"`
+}
+
+type projectionUserName struct {
+	Name  string `bson:"name"`
+	Email string `bson:"email"`
+}
+
+type projectionUserRef struct {
+	ID string `bson:"_id"`
+}
+
+type projectionUnknown struct {
+	Phone string `bson:"phone"`
+}
+
+func TestProjectionFor(t *testing.T) {
+	got, err := ProjectionFor[projectionUser, projectionUserName]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{Key: "name", Value: 1}, {Key: "email", Value: 1}, {Key: "_id", Value: 0}}
+	if !equalD(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got, err = ProjectionFor[*projectionUser, projectionUserRef]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalD(got, bson.D{{Key: "_id", Value: 1}}) {
+		t.Errorf("unexpected projection %v", got)
+	}
+
+	if _, err := ProjectionFor[projectionUser, projectionUnknown](); err == nil {
+		t.Error("expected an error for a field missing from the document type")
+	}
+	if _, err := ProjectionFor[schemaFlexible, projectionUnknown](); err != nil {
+		t.Errorf("inline maps should accept any field: %v", err)
+	}
+}
+
+func equalD(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
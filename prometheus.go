@@ -2,34 +2,219 @@ package mongodb
 
 import (
 	"context"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-lynx/lynx-mongodb/conf"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 )
 
 // PrometheusMetrics holds all Prometheus metrics for MongoDB
 type PrometheusMetrics struct {
 	registry *prometheus.Registry
 
+	// Fraction of commands observed in duration histograms (1 observes all)
+	sampleRate float64
+
 	// Connection pool metrics (from PoolMonitor + config)
 	connectionPoolActive *prometheus.GaugeVec
 	connectionPoolMax    *prometheus.GaugeVec
 	activeConnections    *prometheus.GaugeVec // alias for Grafana "lynx_mongodb_active_connections"
+	connectionPoolIdle   *prometheus.GaugeVec
+	connectionPoolWait   *prometheus.GaugeVec
+	checkoutDuration     *prometheus.HistogramVec
+	checkoutFailures     *prometheus.CounterVec
+	connectionsCreated   *prometheus.CounterVec
+	connectionsClosed    *prometheus.CounterVec
+	connectDuration      *prometheus.HistogramVec
+	connectFailures      *prometheus.CounterVec
 
 	// Operation metrics (from CommandMonitor)
 	operationsTotal    *prometheus.CounterVec
 	queryDuration      *prometheus.HistogramVec
 	errorsTotal        *prometheus.CounterVec
+	cancelledTotal     *prometheus.CounterVec
 	documentsProcessed *prometheus.CounterVec
 
 	// Health check metrics
 	healthCheckTotal   *prometheus.CounterVec
 	healthCheckSuccess *prometheus.CounterVec
 	healthCheckFailure *prometheus.CounterVec
+
+	// Codec metrics
+	localTimeWritesTotal *prometheus.CounterVec
+
+	// Query guard metrics
+	unanchoredRegexTotal *prometheus.CounterVec
+	queryViolationsTotal *prometheus.CounterVec
+
+	// Owner label metrics
+	labeledOperationsTotal *prometheus.CounterVec
+	labeledQueryDuration   *prometheus.HistogramVec
+	budgetBurnTotal        *prometheus.CounterVec
+	budgetThrottleSeconds  *prometheus.CounterVec
+
+	// Read cache metrics
+	cacheReadsTotal *prometheus.CounterVec
+	cacheTTL        *prometheus.GaugeVec
+
+	// Helper read result sizes
+	resultDocuments *prometheus.HistogramVec
+	resultBytes     *prometheus.HistogramVec
+
+	// Anonymized copy metrics
+	anonymizedCopyDocuments *prometheus.CounterVec
+
+	// Data quality metrics
+	qualitySampledTotal    *prometheus.CounterVec
+	qualityInvalidTotal    *prometheus.CounterVec
+	qualityViolationsTotal *prometheus.CounterVec
+
+	// Decode error metrics
+	decodeErrorsTotal *prometheus.CounterVec
+
+	// Per-member health
+	nodeUp *prometheus.GaugeVec
+
+	// Smart read fallbacks to the primary
+	readFallbacksTotal *prometheus.CounterVec
+	// Reads whose staleness bound was exceeded
+	staleReadsTotal *prometheus.CounterVec
+
+	// Ingestion pipeline metrics
+	ingestBatchDuration *prometheus.HistogramVec
+	ingestDocuments     *prometheus.CounterVec
+	ingestRetriesTotal  *prometheus.CounterVec
+
+	// Bulk helper metrics
+	bulkBatchDuration *prometheus.HistogramVec
+	bulkDocuments     *prometheus.CounterVec
+	deadLettersTotal  *prometheus.CounterVec
+
+	// Outbox relay metrics
+	outboxEntries      *prometheus.CounterVec
+	outboxPublishDelay *prometheus.HistogramVec
+
+	// Write guard metrics
+	writeGuardRejections *prometheus.CounterVec
+
+	// DDL window metrics
+	ddlPending    *prometheus.GaugeVec
+	ddlOperations *prometheus.CounterVec
+
+	// Index build metrics
+	indexBuildProgress *prometheus.GaugeVec
+	indexBuildsTotal   *prometheus.CounterVec
+	managedIndexes     *prometheus.CounterVec
+
+	// Configuration reload metrics
+	configReloads *prometheus.CounterVec
+
+	// Query plan cache metrics
+	planCacheEntries  *prometheus.GaugeVec
+	planCacheInactive *prometheus.GaugeVec
+	planCacheBytes    *prometheus.GaugeVec
+	planCacheInserted *prometheus.CounterVec
+	planCacheEvicted  *prometheus.CounterVec
+
+	// WiredTiger cache metrics (from serverStatus)
+	wtCacheBytes        *prometheus.GaugeVec
+	wtCacheMaxBytes     *prometheus.GaugeVec
+	wtCacheDirtyBytes   *prometheus.GaugeVec
+	wtCacheReadBytes    *prometheus.CounterVec
+	wtCacheWrittenBytes *prometheus.CounterVec
+	wtCacheEvicted      *prometheus.CounterVec
+	wtCacheAppEvicted   *prometheus.CounterVec
+
+	// Lock queue and ticket metrics (from serverStatus)
+	lockQueueReaders  *prometheus.GaugeVec
+	lockQueueWriters  *prometheus.GaugeVec
+	lockActiveReaders *prometheus.GaugeVec
+	lockActiveWriters *prometheus.GaugeVec
+	ticketsAvailable  *prometheus.GaugeVec
+	ticketsInUse      *prometheus.GaugeVec
+	ticketsCapacity   *prometheus.GaugeVec
+
+	// Oplog window metrics
+	oplogWindow    *prometheus.GaugeVec
+	oplogFirstTime *prometheus.GaugeVec
+	oplogLastTime  *prometheus.GaugeVec
+
+	// Backup freshness metrics
+	backupAge      *prometheus.GaugeVec
+	backupLastTime *prometheus.GaugeVec
+	backupMaxAge   *prometheus.GaugeVec
+	backupStale    *prometheus.GaugeVec
+
+	// Transaction metrics (from WithTransaction)
+	transactionsTotal *prometheus.CounterVec
+	txnRetriesTotal   *prometheus.CounterVec
+	txnConflicts      *prometheus.CounterVec
+	txnConflictRatio  *prometheus.GaugeVec
+
+	// Throttled operation metrics (from the throttle retry policy)
+	throttledTotal *prometheus.CounterVec
+
+	// Retry metrics (from the transient error retry policy)
+	retriesTotal *prometheus.CounterVec
+
+	// Load shedding metrics
+	shedTotal *prometheus.CounterVec
+
+	// Priority queue metrics
+	priorityWait *prometheus.HistogramVec
+
+	// Circuit breaker metrics
+	circuitState    *prometheus.GaugeVec
+	circuitRejected *prometheus.CounterVec
+
+	// Failover metrics
+	failoverActive      *prometheus.GaugeVec
+	failoverUp          *prometheus.GaugeVec
+	failoverSwitchovers *prometheus.CounterVec
+
+	// SRV monitoring metrics
+	srvHosts    *prometheus.GaugeVec
+	srvFailures *prometheus.CounterVec
+	srvChanges  *prometheus.CounterVec
+
+	// Service discovery metrics
+	discoveryHosts     *prometheus.GaugeVec
+	discoveryRefreshes *prometheus.CounterVec
+
+	// Leader election metrics
+	leader            *prometheus.GaugeVec
+	leaderTransitions *prometheus.CounterVec
+
+	// Write buffer metrics
+	bufferedWrites      *prometheus.GaugeVec
+	bufferedWritesTotal *prometheus.CounterVec
+
+	// Schema migration metrics
+	migrations        *prometheus.CounterVec
+	migrationsPending *prometheus.GaugeVec
+
+	// Unit of work metrics
+	unitsOfWork *prometheus.CounterVec
+	identityMap *prometheus.CounterVec
+
+	// Seed metrics
+	seededDocuments *prometheus.CounterVec
+
+	// Maintenance mode metrics
+	maintenance           *prometheus.GaugeVec
+	maintenanceRejections *prometheus.CounterVec
+
+	// Latency SLO metrics
+	sloEvents    *prometheus.CounterVec
+	sloBurnRate  *prometheus.GaugeVec
+	sloObjective *prometheus.GaugeVec
+	sloTarget    *prometheus.GaugeVec
 }
 
 // PrometheusConfig configuration for Prometheus metrics
@@ -37,6 +222,9 @@ type PrometheusConfig struct {
 	Namespace string
 	Subsystem string
 	Labels    map[string]string
+	// HistogramSampleRate is the fraction (0-1] of commands observed in duration histograms;
+	// 0 observes every command
+	HistogramSampleRate float64
 }
 
 var (
@@ -59,7 +247,8 @@ func NewPrometheusMetrics(config *PrometheusConfig) *PrometheusMetrics {
 	registry := prometheus.NewRegistry()
 
 	m := &PrometheusMetrics{
-		registry: registry,
+		registry:   registry,
+		sampleRate: 1,
 
 		connectionPoolActive: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -88,6 +277,80 @@ func NewPrometheusMetrics(config *PrometheusConfig) *PrometheusMetrics {
 			},
 			labelNames,
 		),
+		connectionPoolIdle: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_idle",
+				Help:      "Number of open connections waiting in the pool",
+			},
+			labelNames,
+		),
+		connectionPoolWait: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_waiting",
+				Help:      "Number of operations waiting to check out a connection",
+			},
+			labelNames,
+		),
+		checkoutDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_checkout_duration_seconds",
+				Help:      "Time operations waited to check out a connection, including failed checkouts",
+				Buckets:   []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30},
+			},
+			labelNames,
+		),
+		checkoutFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_checkout_failures_total",
+				Help:      "Failed connection checkouts by reason (timeout, connectionError, poolClosed)",
+			},
+			append(labelNames, "reason"),
+		),
+		connectionsCreated: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_created_total",
+				Help:      "Connections opened by the pool",
+			},
+			labelNames,
+		),
+		connectionsClosed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_pool_closed_total",
+				Help:      "Connections closed by the pool by reason (idle, stale, error, connectionError, poolClosed)",
+			},
+			append(labelNames, "reason"),
+		),
+		connectDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_establishment_duration_seconds",
+				Help:      "Time to establish a pool connection (dial, TLS, handshake and authentication), by host",
+				Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			append(labelNames, "host"),
+		),
+		connectFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "connection_establishment_failures_total",
+				Help:      "Pool connections that failed to be established, by host",
+			},
+			append(labelNames, "host"),
+		),
 		operationsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: config.Namespace,
@@ -112,10 +375,19 @@ func NewPrometheusMetrics(config *PrometheusConfig) *PrometheusMetrics {
 				Namespace: config.Namespace,
 				Subsystem: config.Subsystem,
 				Name:      "errors_total",
-				Help:      "Total number of MongoDB operation errors",
+				Help:      "Total number of MongoDB operation errors, excluding caller cancellations",
 			},
 			labelNames,
 		),
+		cancelledTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "cancelled_total",
+				Help:      "Total number of MongoDB commands abandoned because the caller cancelled its context",
+			},
+			append(labelNames, "operation"),
+		),
 		documentsProcessed: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: config.Namespace,
@@ -152,193 +424,2046 @@ func NewPrometheusMetrics(config *PrometheusConfig) *PrometheusMetrics {
 			},
 			labelNames,
 		),
-	}
-
-	registry.MustRegister(
-		m.connectionPoolActive,
-		m.connectionPoolMax,
-		m.activeConnections,
-		m.operationsTotal,
-		m.queryDuration,
-		m.errorsTotal,
-		m.documentsProcessed,
-		m.healthCheckTotal,
-		m.healthCheckSuccess,
-		m.healthCheckFailure,
-	)
-
-	return m
-}
-
-// CreateCommandMonitor creates a CommandMonitor that records metrics
-func (m *PrometheusMetrics) CreateCommandMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
-	if m == nil || cfg == nil {
-		return nil
-	}
-	labels := m.buildLabels(cfg)
-	startedCmds := &sync.Map{} // requestID -> evt, for cleanup
-
-	return &event.CommandMonitor{
-		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
-			startedCmds.Store(evt.RequestID, struct{}{})
-		},
-		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
-			op := mapCommandNameToOperation(evt.CommandName)
-			l := cloneLabels(labels)
-			l["operation"] = op
-
-			m.operationsTotal.With(l).Inc()
-			m.queryDuration.With(l).Observe(evt.Duration.Seconds())
-
-			// Extract documents processed from reply
-			if n := extractDocumentsFromReply(evt.Reply, evt.CommandName); n > 0 {
-				m.documentsProcessed.With(labels).Add(float64(n))
-			}
-
-			startedCmds.Delete(evt.RequestID)
-		},
-		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
-			op := mapCommandNameToOperation(evt.CommandName)
-			l := cloneLabels(labels)
-			l["operation"] = op
-
-			m.operationsTotal.With(l).Inc()
-			m.queryDuration.With(l).Observe(evt.Duration.Seconds())
-			m.errorsTotal.With(labels).Inc()
-
-			startedCmds.Delete(evt.RequestID)
-		},
-	}
-}
-
-// CreatePoolMonitor creates a PoolMonitor that updates connection pool metrics
-func (m *PrometheusMetrics) CreatePoolMonitor(cfg *conf.MongoDB, activeCount *int64) *event.PoolMonitor {
-	if m == nil || cfg == nil || activeCount == nil {
-		return nil
-	}
-	labels := m.buildLabels(cfg)
-
-	return &event.PoolMonitor{
-		Event: func(evt *event.PoolEvent) {
-			switch evt.Type {
-			case event.GetSucceeded:
-				atomic.AddInt64(activeCount, 1)
-				n := float64(atomic.LoadInt64(activeCount))
-				m.connectionPoolActive.With(labels).Set(n)
-				m.activeConnections.With(labels).Set(n)
-			case event.ConnectionReturned:
-				atomic.AddInt64(activeCount, -1)
-				n := float64(atomic.LoadInt64(activeCount))
-				m.connectionPoolActive.With(labels).Set(n)
-				m.activeConnections.With(labels).Set(n)
-			}
-		},
-	}
-}
-
-// UpdateConfigMetrics updates connection pool max from config (called periodically)
-func (m *PrometheusMetrics) UpdateConfigMetrics(cfg *conf.MongoDB) {
-	if m == nil || cfg == nil {
-		return
-	}
-	labels := m.buildLabels(cfg)
-	m.connectionPoolMax.With(labels).Set(float64(cfg.MaxPoolSize))
-}
-
-// RecordHealthCheck records health check result
-func (m *PrometheusMetrics) RecordHealthCheck(success bool, cfg *conf.MongoDB) {
-	if m == nil || cfg == nil {
-		return
-	}
-	labels := m.buildLabels(cfg)
-	m.healthCheckTotal.With(labels).Inc()
-	if success {
-		m.healthCheckSuccess.With(labels).Inc()
-	} else {
-		m.healthCheckFailure.With(labels).Inc()
-	}
-}
-
-// GetGatherer returns the Prometheus gatherer
-func (m *PrometheusMetrics) GetGatherer() prometheus.Gatherer {
-	if m == nil || m.registry == nil {
-		return nil
-	}
-	return m.registry
-}
-
-func (m *PrometheusMetrics) buildLabels(cfg *conf.MongoDB) prometheus.Labels {
-	db := "test"
-	if cfg != nil && cfg.Database != "" {
-		db = cfg.Database
-	}
-	return prometheus.Labels{"database": db}
-}
-
-func cloneLabels(in prometheus.Labels) prometheus.Labels {
-	out := prometheus.Labels{}
-	for k, v := range in {
-		out[k] = v
-	}
-	return out
-}
-
-// mapCommandNameToOperation maps MongoDB command names to Grafana-friendly operation names
-func mapCommandNameToOperation(cmdName string) string {
-	switch cmdName {
-	case "find", "findOne":
-		return "find"
-	case "insert", "insertOne", "insertMany":
-		return "insert"
-	case "update", "updateOne", "updateMany":
-		return "update"
-	case "delete", "deleteOne", "deleteMany", "remove":
-		return "delete"
-	case "aggregate":
-		return "aggregate"
-	default:
-		return cmdName
-	}
-}
-
-// extractDocumentsFromReply extracts document count from command reply
-func extractDocumentsFromReply(reply bson.Raw, cmdName string) int64 {
-	if len(reply) == 0 {
-		return 0
-	}
-	var doc struct {
-		N         int64 `bson:"n"`
-		NModified int64 `bson:"nModified"`
-		NInserted int64 `bson:"nInserted"`
-		NRemoved  int64 `bson:"nRemoved"`
-		NDropped  int64 `bson:"nDropped"`
-		Cursor    *struct {
-			FirstBatch []interface{} `bson:"firstBatch"`
-			NextBatch  []interface{} `bson:"nextBatch"`
-		} `bson:"cursor"`
-	}
-	if err := bson.Unmarshal(reply, &doc); err != nil {
-		return 0
-	}
-	if doc.N != 0 {
-		return doc.N
-	}
-	if doc.NModified != 0 {
-		return doc.NModified
-	}
-	if doc.NInserted != 0 {
-		return doc.NInserted
-	}
-	if doc.NRemoved != 0 {
-		return doc.NRemoved
-	}
-	if doc.Cursor != nil {
-		if len(doc.Cursor.FirstBatch) > 0 {
-			return int64(len(doc.Cursor.FirstBatch))
-		}
-		if len(doc.Cursor.NextBatch) > 0 {
-			return int64(len(doc.Cursor.NextBatch))
+		localTimeWritesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "local_time_writes_total",
+				Help:      "Total number of non-UTC time.Time values written",
+			},
+			labelNames,
+		),
+		unanchoredRegexTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "unanchored_regex_total",
+				Help:      "Total number of unanchored regex patterns seen in command queries",
+			},
+			append(labelNames, "collection"),
+		),
+		queryViolationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "query_violations_total",
+				Help:      "Total number of query security violations found by the query scanner",
+			},
+			append(labelNames, "collection", "rule"),
+		),
+		labeledOperationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "labeled_operations_total",
+				Help:      "Total number of MongoDB commands by owner label",
+			},
+			append(labelNames, "label", "operation", "status"),
+		),
+		labeledQueryDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "labeled_query_duration_seconds",
+				Help:      "MongoDB command duration in seconds by owner label",
+				Buckets:   []float64{0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 3, 5},
+			},
+			append(labelNames, "label"),
+		),
+		budgetBurnTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "budget_burn_total",
+				Help:      "Total number of operations exceeding an owner label budget",
+			},
+			append(labelNames, "label", "budget"),
+		),
+		budgetThrottleSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "budget_throttle_seconds_total",
+				Help:      "Total time operations were delayed by owner label budgets",
+			},
+			append(labelNames, "label"),
+		),
+		resultDocuments: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "result_documents",
+				Help:      "Number of documents fetched by helper reads, by collection",
+				Buckets:   []float64{0, 1, 10, 100, 1000, 10000, 100000},
+			},
+			append(labelNames, "collection"),
+		),
+		resultBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "result_bytes",
+				Help:      "BSON size of the documents fetched by helper reads, by collection",
+				Buckets:   []float64{1 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20},
+			},
+			append(labelNames, "collection"),
+		),
+		cacheReadsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "cache_reads_total",
+				Help:      "Total number of cached reads by result (hit, miss, stale)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		cacheTTL: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "cache_ttl_seconds",
+				Help:      "Lag-aware TTL of the last document cached by staleness-bounded cached readers, by collection",
+			},
+			append(labelNames, "collection"),
+		),
+		anonymizedCopyDocuments: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "anonymized_copy_documents_total",
+				Help:      "Total number of documents copied by anonymized copies, by source collection",
+			},
+			append(labelNames, "collection"),
+		),
+		qualitySampledTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "quality_documents_sampled_total",
+				Help:      "Total number of documents sampled by the data quality checker",
+			},
+			append(labelNames, "collection"),
+		),
+		qualityInvalidTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "quality_documents_invalid_total",
+				Help:      "Total number of sampled documents violating their registered schema",
+			},
+			append(labelNames, "collection"),
+		),
+		qualityViolationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "quality_violations_total",
+				Help:      "Total number of schema violations found by the data quality checker",
+			},
+			append(labelNames, "collection", "field", "reason"),
+		),
+		decodeErrorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "decode_errors_total",
+				Help:      "Total number of documents that failed to decode, by offending field",
+			},
+			append(labelNames, "collection", "field", "reason"),
+		),
+		nodeUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "node_up",
+				Help:      "Whether a deployment member is reachable (1) or not (0), as seen by server monitoring",
+			},
+			append(labelNames, "address", "role"),
+		),
+		readFallbacksTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "read_fallbacks_total",
+				Help:      "Total number of smart reads routed to the primary, by reason",
+			},
+			append(labelNames, "reason"),
+		),
+		staleReadsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "stale_reads_total",
+				Help:      "Total number of reads whose staleness bound was exceeded, by action taken",
+			},
+			append(labelNames, "action"),
+		),
+		ingestBatchDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "ingest_batch_duration_seconds",
+				Help:      "Duration of ingestion bulk upsert batches, retries included",
+				Buckets:   []float64{0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10},
+			},
+			append(labelNames, "collection"),
+		),
+		ingestDocuments: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "ingest_documents_total",
+				Help:      "Total number of documents handled by ingestion pipelines, by result (written, failed)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		ingestRetriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "ingest_retries_total",
+				Help:      "Total number of ingestion upserts retried after a duplicate key error",
+			},
+			append(labelNames, "collection"),
+		),
+		bulkBatchDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "bulk_batch_duration_seconds",
+				Help:      "Duration of bulk helper batches",
+				Buckets:   []float64{0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10},
+			},
+			append(labelNames, "collection"),
+		),
+		bulkDocuments: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "bulk_documents_total",
+				Help:      "Total number of documents handled by bulk helper batches, by result (written, failed)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		outboxEntries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "outbox_entries_total",
+				Help:      "Total number of outbox entries handed to the publisher, by result (published, failed)",
+			},
+			append(labelNames, "result"),
+		),
+		outboxPublishDelay: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "outbox_publish_delay_seconds",
+				Help:      "Delay between the creation of outbox entries and their publication",
+				Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+			},
+			labelNames,
+		),
+		deadLettersTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "dead_letters_total",
+				Help:      "Total number of failed writes recorded in a dead-letter sink",
+			},
+			append(labelNames, "collection"),
+		),
+		writeGuardRejections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "write_guard_rejections_total",
+				Help:      "Total number of UpdateMany/DeleteMany calls rejected by the write guard",
+			},
+			append(labelNames, "collection", "operation"),
+		),
+		ddlPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "ddl_pending",
+				Help:      "Number of DDL operations queued until the next maintenance window",
+			},
+			labelNames,
+		),
+		ddlOperations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "ddl_operations_total",
+				Help:      "Total number of DDL operations under a maintenance window, by result (applied, failed, deferred)",
+			},
+			append(labelNames, "kind", "result"),
+		),
+		indexBuildProgress: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "index_build_progress",
+				Help:      "Progress (0-1) of the current phase of running index builds",
+			},
+			append(labelNames, "collection", "index"),
+		),
+		indexBuildsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "index_builds_total",
+				Help:      "Total number of completed index builds started by the plugin, by result",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		managedIndexes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "managed_indexes_total",
+				Help:      "Managed indexes ensured, by collection and result (created, exists, recreated, skipped, failed, deferred)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		configReloads: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "config_reloads_total",
+				Help:      "Configuration reload attempts, by result (rebuilt, applied, unchanged, restart_required, failed)",
+			},
+			append(labelNames, "result"),
+		),
+		planCacheEntries: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "plan_cache_entries",
+				Help:      "Number of query plan cache entries of a collection",
+			},
+			append(labelNames, "collection"),
+		),
+		planCacheInactive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "plan_cache_inactive_entries",
+				Help:      "Number of inactive query plan cache entries of a collection (plans not yet trusted)",
+			},
+			append(labelNames, "collection"),
+		),
+		planCacheBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "plan_cache_size_bytes",
+				Help:      "Estimated size in bytes of the query plan cache entries of a collection",
+			},
+			append(labelNames, "collection"),
+		),
+		planCacheInserted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "plan_cache_inserted_total",
+				Help:      "Total number of plan cache entries that appeared between two polls",
+			},
+			append(labelNames, "collection"),
+		),
+		planCacheEvicted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "plan_cache_evicted_total",
+				Help:      "Total number of plan cache entries that disappeared between two polls (evicted, replanned or cleared)",
+			},
+			append(labelNames, "collection"),
+		),
+		wtCacheBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_bytes",
+				Help:      "Bytes currently in the WiredTiger cache",
+			},
+			labelNames,
+		),
+		wtCacheMaxBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_max_bytes",
+				Help:      "Configured size of the WiredTiger cache in bytes",
+			},
+			labelNames,
+		),
+		wtCacheDirtyBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_dirty_bytes",
+				Help:      "Tracked dirty bytes in the WiredTiger cache",
+			},
+			labelNames,
+		),
+		wtCacheReadBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_read_bytes_total",
+				Help:      "Total number of bytes read into the WiredTiger cache",
+			},
+			labelNames,
+		),
+		wtCacheWrittenBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_written_bytes_total",
+				Help:      "Total number of bytes written from the WiredTiger cache",
+			},
+			labelNames,
+		),
+		wtCacheEvicted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_evicted_pages_total",
+				Help:      "Total number of pages evicted from the WiredTiger cache, by kind (modified, unmodified)",
+			},
+			append(labelNames, "kind"),
+		),
+		wtCacheAppEvicted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "wiredtiger_cache_application_evictions_total",
+				Help:      "Total number of pages evicted by application threads, which stalls their operations",
+			},
+			labelNames,
+		),
+		lockQueueReaders: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "global_lock_queue_readers",
+				Help:      "Operations queued waiting for a read lock (globalLock.currentQueue.readers)",
+			},
+			labelNames,
+		),
+		lockQueueWriters: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "global_lock_queue_writers",
+				Help:      "Operations queued waiting for a write lock (globalLock.currentQueue.writers)",
+			},
+			labelNames,
+		),
+		lockActiveReaders: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "global_lock_active_readers",
+				Help:      "Clients performing read operations (globalLock.activeClients.readers)",
+			},
+			labelNames,
+		),
+		lockActiveWriters: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "global_lock_active_writers",
+				Help:      "Clients performing write operations (globalLock.activeClients.writers)",
+			},
+			labelNames,
+		),
+		ticketsAvailable: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "tickets_available",
+				Help:      "Storage engine tickets available, by operation (read, write); operations wait at zero",
+			},
+			append(labelNames, "operation"),
+		),
+		ticketsInUse: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "tickets_in_use",
+				Help:      "Storage engine tickets in use, by operation (read, write)",
+			},
+			append(labelNames, "operation"),
+		),
+		ticketsCapacity: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "tickets_capacity",
+				Help:      "Storage engine tickets in total, by operation (read, write)",
+			},
+			append(labelNames, "operation"),
+		),
+		oplogWindow: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "oplog_window_seconds",
+				Help:      "Time between the first and the last entry of the primary's oplog",
+			},
+			labelNames,
+		),
+		oplogFirstTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "oplog_first_timestamp_seconds",
+				Help:      "Unix time of the first (oldest) entry of the primary's oplog",
+			},
+			labelNames,
+		),
+		oplogLastTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "oplog_last_timestamp_seconds",
+				Help:      "Unix time of the last (newest) entry of the primary's oplog",
+			},
+			labelNames,
+		),
+		backupAge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "backup_age_seconds",
+				Help:      "Age of the last backup according to the backup marker",
+			},
+			labelNames,
+		),
+		backupLastTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "backup_last_success_timestamp_seconds",
+				Help:      "Unix time the last backup completed according to the backup marker",
+			},
+			labelNames,
+		),
+		backupMaxAge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "backup_max_age_seconds",
+				Help:      "Configured backup freshness threshold (backup_monitor.max_age)",
+			},
+			labelNames,
+		),
+		backupStale: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "backup_stale",
+				Help:      "1 when the last backup is older than the freshness threshold or no backup marker exists",
+			},
+			labelNames,
+		),
+		transactionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "transactions_total",
+				Help:      "Total number of transaction attempts run by WithTransaction, by result (committed, aborted)",
+			},
+			append(labelNames, "result"),
+		),
+		txnRetriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "transaction_retries_total",
+				Help:      "Total number of transaction retries, by reason (transient, unknown_commit_result)",
+			},
+			append(labelNames, "reason"),
+		),
+		txnConflicts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "transaction_write_conflicts_total",
+				Help:      "Total number of transaction attempts failed by a WriteConflict, by transaction label",
+			},
+			append(labelNames, "label"),
+		),
+		txnConflictRatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "transaction_conflict_ratio",
+				Help:      "Fraction of the last 100 transaction attempts failed by a WriteConflict, by transaction label",
+			},
+			append(labelNames, "label"),
+		),
+		throttledTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "throttled_operations_total",
+				Help:      "Total number of operations rejected by server throttling, by operation and result (retried, failed)",
+			},
+			append(labelNames, "operation", "result"),
+		),
+		retriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "retries_total",
+				Help:      "Total number of helper operation retries, by operation, reason (network, not_primary, write_conflict, other) and idempotency class",
+			},
+			append(labelNames, "operation", "reason", "idempotency"),
+		),
+		shedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "shed_operations_total",
+				Help:      "Total number of operations rejected by the load shedding policy, by priority",
+			},
+			append(labelNames, "priority"),
+		),
+		priorityWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "priority_queue_wait_seconds",
+				Help:      "Time operations queued for a priority concurrency slot, by priority",
+				Buckets:   []float64{0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5},
+			},
+			append(labelNames, "priority"),
+		),
+		circuitState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "circuit_breaker_state",
+				Help:      "Circuit breaker state (0 closed, 1 half-open, 2 open)",
+			},
+			labelNames,
+		),
+		circuitRejected: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "circuit_breaker_rejections_total",
+				Help:      "Total number of operations failed fast by the open circuit breaker, by operation",
+			},
+			append(labelNames, "operation"),
+		),
+		failoverActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "failover_active_cluster",
+				Help:      "1 for the failover cluster serving traffic, by cluster (primary, standby)",
+			},
+			append(labelNames, "cluster"),
+		),
+		failoverUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "failover_cluster_up",
+				Help:      "Whether the last failover health check of the cluster succeeded, by cluster",
+			},
+			append(labelNames, "cluster"),
+		),
+		failoverSwitchovers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "failover_switchovers_total",
+				Help:      "Total number of failover switchovers, by cluster switched to",
+			},
+			append(labelNames, "cluster"),
+		),
+		srvHosts: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "srv_hosts",
+				Help:      "Number of hosts the SRV records of the mongodb+srv uri resolved to",
+			},
+			labelNames,
+		),
+		srvFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "srv_resolution_failures_total",
+				Help:      "Total number of failed SRV monitor resolutions, by record (srv, txt)",
+			},
+			append(labelNames, "record"),
+		),
+		srvChanges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "srv_changes_total",
+				Help:      "Total number of SRV seed list and TXT option changes, by record (srv, txt)",
+			},
+			append(labelNames, "record"),
+		),
+		discoveryHosts: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "discovery_hosts",
+				Help:      "Number of hosts resolved by service discovery",
+			},
+			labelNames,
+		),
+		discoveryRefreshes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "discovery_refreshes_total",
+				Help:      "Total number of service discovery refreshes, by result (unchanged, changed, failed)",
+			},
+			append(labelNames, "result"),
+		),
+		leader: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "leader",
+				Help:      "Whether this instance leads the election (1) or not (0), by election",
+			},
+			append(labelNames, "election"),
+		),
+		leaderTransitions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "leader_transitions_total",
+				Help:      "Total number of leadership transitions of this instance, by election and transition (gained, lost, resigned)",
+			},
+			append(labelNames, "election", "transition"),
+		),
+		bufferedWrites: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "buffered_writes",
+				Help:      "Number of helper writes held by the write buffer during a primary election",
+			},
+			labelNames,
+		),
+		bufferedWritesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "buffered_writes_total",
+				Help:      "Total number of helper writes held during a primary election, by result (replayed, expired, rejected) and idempotency class",
+			},
+			append(labelNames, "result", "idempotency"),
+		),
+		migrations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "migrations_total",
+				Help:      "Total number of schema migrations run, by direction (up, down) and result (succeeded, failed)",
+			},
+			append(labelNames, "direction", "result"),
+		),
+		migrationsPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "migrations_pending",
+				Help:      "Number of schema migrations not applied yet, as of the last run",
+			},
+			labelNames,
+		),
+		unitsOfWork: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "units_of_work_total",
+				Help:      "Total number of closed units of work, by result (committed, discarded, failed)",
+			},
+			append(labelNames, "result"),
+		),
+		identityMap: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "identity_map_total",
+				Help:      "Total number of identity map events of units of work, by collection and result (hit, miss, flushed, clean)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		seededDocuments: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "seeded_documents_total",
+				Help:      "Total number of fixture documents loaded by the seed, by collection and result (inserted, existing, skipped)",
+			},
+			append(labelNames, "collection", "result"),
+		),
+		maintenance: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "maintenance",
+				Help:      "Whether the plugin is in maintenance mode (1) or not (0)",
+			},
+			labelNames,
+		),
+		maintenanceRejections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "maintenance_rejections_total",
+				Help:      "Total number of operations rejected in maintenance mode, by priority",
+			},
+			append(labelNames, "priority"),
+		),
+		sloEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "slo_events_total",
+				Help:      "Total number of operations covered by a latency SLO, by result (good, bad)",
+			},
+			append(labelNames, "slo", "result"),
+		),
+		sloBurnRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "slo_burn_rate",
+				Help:      "Error budget burn rate of a latency SLO over a window (1 spends the budget exactly)",
+			},
+			append(labelNames, "slo", "window"),
+		),
+		sloObjective: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "slo_objective_ratio",
+				Help:      "Objective of a latency SLO as the fraction of good operations",
+			},
+			append(labelNames, "slo"),
+		),
+		sloTarget: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Namespace,
+				Subsystem: config.Subsystem,
+				Name:      "slo_target_latency_seconds",
+				Help:      "Latency a good operation of a latency SLO stays within",
+			},
+			append(labelNames, "slo"),
+		),
+	}
+
+	if config.HistogramSampleRate > 0 && config.HistogramSampleRate < 1 {
+		m.sampleRate = config.HistogramSampleRate
+	}
+
+	registry.MustRegister(m.collectors()...)
+
+	return m
+}
+
+// collectors returns every metric of the plugin, as registered by NewPrometheusMetrics
+func (m *PrometheusMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.connectionPoolActive,
+		m.connectionPoolMax,
+		m.activeConnections,
+		m.connectionPoolIdle,
+		m.connectionPoolWait,
+		m.checkoutDuration,
+		m.checkoutFailures,
+		m.connectionsCreated,
+		m.connectionsClosed,
+		m.connectDuration,
+		m.connectFailures,
+		m.operationsTotal,
+		m.queryDuration,
+		m.errorsTotal,
+		m.cancelledTotal,
+		m.documentsProcessed,
+		m.healthCheckTotal,
+		m.healthCheckSuccess,
+		m.healthCheckFailure,
+		m.localTimeWritesTotal,
+		m.unanchoredRegexTotal,
+		m.queryViolationsTotal,
+		m.labeledOperationsTotal,
+		m.labeledQueryDuration,
+		m.budgetBurnTotal,
+		m.budgetThrottleSeconds,
+		m.resultDocuments,
+		m.resultBytes,
+		m.cacheReadsTotal,
+		m.cacheTTL,
+		m.anonymizedCopyDocuments,
+		m.qualitySampledTotal,
+		m.qualityInvalidTotal,
+		m.qualityViolationsTotal,
+		m.decodeErrorsTotal,
+		m.nodeUp,
+		m.readFallbacksTotal,
+		m.staleReadsTotal,
+		m.ingestBatchDuration,
+		m.ingestDocuments,
+		m.ingestRetriesTotal,
+		m.bulkBatchDuration,
+		m.bulkDocuments,
+		m.deadLettersTotal,
+		m.outboxEntries,
+		m.outboxPublishDelay,
+		m.writeGuardRejections,
+		m.ddlPending,
+		m.ddlOperations,
+		m.indexBuildProgress,
+		m.indexBuildsTotal,
+		m.managedIndexes,
+		m.configReloads,
+		m.planCacheEntries,
+		m.planCacheInactive,
+		m.planCacheBytes,
+		m.planCacheInserted,
+		m.planCacheEvicted,
+		m.wtCacheBytes,
+		m.wtCacheMaxBytes,
+		m.wtCacheDirtyBytes,
+		m.wtCacheReadBytes,
+		m.wtCacheWrittenBytes,
+		m.wtCacheEvicted,
+		m.wtCacheAppEvicted,
+		m.lockQueueReaders,
+		m.lockQueueWriters,
+		m.lockActiveReaders,
+		m.lockActiveWriters,
+		m.ticketsAvailable,
+		m.ticketsInUse,
+		m.ticketsCapacity,
+		m.oplogWindow,
+		m.oplogFirstTime,
+		m.oplogLastTime,
+		m.backupAge,
+		m.backupLastTime,
+		m.backupMaxAge,
+		m.backupStale,
+		m.transactionsTotal,
+		m.txnRetriesTotal,
+		m.txnConflicts,
+		m.txnConflictRatio,
+		m.throttledTotal,
+		m.retriesTotal,
+		m.shedTotal,
+		m.priorityWait,
+		m.circuitState,
+		m.circuitRejected,
+		m.failoverActive,
+		m.failoverUp,
+		m.failoverSwitchovers,
+		m.srvHosts,
+		m.srvFailures,
+		m.srvChanges,
+		m.discoveryHosts,
+		m.discoveryRefreshes,
+		m.leader,
+		m.leaderTransitions,
+		m.bufferedWrites,
+		m.bufferedWritesTotal,
+		m.migrations,
+		m.migrationsPending,
+		m.unitsOfWork,
+		m.identityMap,
+		m.seededDocuments,
+		m.maintenance,
+		m.maintenanceRejections,
+		m.sloEvents,
+		m.sloBurnRate,
+		m.sloObjective,
+		m.sloTarget,
+	}
+}
+
+// CreateCommandMonitor creates a CommandMonitor that records metrics for the namespaces
+// selected by metrics_namespaces. Commands are labeled with the database they target ($db), so
+// cross-database commands of helpers and raw clients are not attributed to the configured
+// database. Child metrics are resolved once per database and operation, so the hot path neither
+// builds label maps nor hashes label values.
+func (m *PrometheusMetrics) CreateCommandMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
+	if m == nil || cfg == nil {
+		return nil
+	}
+	database := m.buildLabels(cfg)["database"]
+	children := newCommandMetricSet(m, database)
+
+	filter := newNamespaceFilter(cfg.GetMetricsNamespaces())
+	// requestID -> measured; only tracked when a namespace filter is configured, since
+	// finished events do not carry the command
+	var startedCmds sync.Map
+	measured := func(requestID int64) bool {
+		if filter == nil {
+			return true
+		}
+		v, ok := startedCmds.LoadAndDelete(requestID)
+		return ok && v.(bool)
+	}
+
+	finished := func(evt *event.CommandFinishedEvent) *commandMetrics {
+		c := children.get(evt.DatabaseName, mapCommandNameToOperation(evt.CommandName))
+		c.operations.Inc()
+		if m.sampled() {
+			c.duration.Observe(evt.Duration.Seconds())
+		}
+		return c
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if filter == nil {
+				return
+			}
+			_, ok := filter.resolve(evt.DatabaseName, commandCollection(evt.Command))
+			startedCmds.Store(evt.RequestID, ok)
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			if !measured(evt.RequestID) {
+				return
+			}
+			c := finished(&evt.CommandFinishedEvent)
+			if n := extractDocumentsFromReply(evt.Reply, evt.CommandName); n > 0 {
+				c.documents.Add(float64(n))
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			if !measured(evt.RequestID) {
+				return
+			}
+			c := finished(&evt.CommandFinishedEvent)
+			if commandCancelled(ctx, evt) {
+				c.cancelled.Inc()
+				return
+			}
+			c.errors.Inc()
+		},
+	}
+}
+
+// commandMetrics are the child metrics of one operation on one database
+type commandMetrics struct {
+	operations prometheus.Counter
+	duration   prometheus.Observer
+	errors     prometheus.Counter
+	cancelled  prometheus.Counter
+	documents  prometheus.Counter
+}
+
+// commandKey identifies the commandMetrics of an operation on a database
+type commandKey struct {
+	database  string
+	operation string
+}
+
+// commandMetricSet caches commandMetrics per database and operation. Reads are lock-free; the
+// map is copied on the rare insert of a pair not seen before.
+type commandMetricSet struct {
+	metrics *PrometheusMetrics
+	// database labels commands whose event carries no database name
+	database string
+	mu       sync.Mutex
+	ops      atomic.Pointer[map[commandKey]*commandMetrics]
+}
+
+func newCommandMetricSet(m *PrometheusMetrics, database string) *commandMetricSet {
+	s := &commandMetricSet{metrics: m, database: database}
+	ops := make(map[commandKey]*commandMetrics)
+	s.ops.Store(&ops)
+	return s
+}
+
+func (s *commandMetricSet) get(database, op string) *commandMetrics {
+	if database == "" {
+		database = s.database
+	}
+	key := commandKey{database: database, operation: op}
+	if c, ok := (*s.ops.Load())[key]; ok {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := *s.ops.Load()
+	if c, ok := current[key]; ok {
+		return c
+	}
+	next := make(map[commandKey]*commandMetrics, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	c := s.resolve(key)
+	next[key] = c
+	s.ops.Store(&next)
+	return c
+}
+
+func (s *commandMetricSet) resolve(key commandKey) *commandMetrics {
+	m := s.metrics
+	return &commandMetrics{
+		operations: m.operationsTotal.WithLabelValues(key.database, key.operation),
+		duration:   m.queryDuration.WithLabelValues(key.database, key.operation),
+		errors:     m.errorsTotal.WithLabelValues(key.database),
+		cancelled:  m.cancelledTotal.WithLabelValues(key.database, key.operation),
+		documents:  m.documentsProcessed.WithLabelValues(key.database),
+	}
+}
+
+// CreatePoolMonitor creates a PoolMonitor that updates connection pool metrics: checked out,
+// idle and waiting connections, checkout wait times and failures, opened and closed connections,
+// and the time to establish connections per host. activeCount and openCount hold the checked out and
+// open connections of the monitored client.
+func (m *PrometheusMetrics) CreatePoolMonitor(cfg *conf.MongoDB, activeCount, openCount *int64) *event.PoolMonitor {
+	monitor, _ := m.createPoolMonitor(cfg, activeCount, openCount, nil)
+	return monitor
+}
+
+// createPoolMonitor is CreatePoolMonitor for a client that only reports while publishing returns
+// true (nil always reports): the counts are kept either way, and the returned resync sets the gauges
+// from them once the client starts reporting
+func (m *PrometheusMetrics) createPoolMonitor(cfg *conf.MongoDB, activeCount, openCount *int64, publishing func() bool) (*event.PoolMonitor, func()) {
+	if m == nil || cfg == nil || activeCount == nil || openCount == nil {
+		return nil, nil
+	}
+	if publishing == nil {
+		publishing = func() bool { return true }
+	}
+	labels := m.buildLabels(cfg)
+	poolActive := m.connectionPoolActive.With(labels)
+	activeConnections := m.activeConnections.With(labels)
+	idle := m.connectionPoolIdle.With(labels)
+	waiting := m.connectionPoolWait.With(labels)
+	checkoutDuration := m.checkoutDuration.With(labels)
+	created := m.connectionsCreated.With(labels)
+
+	// Checkouts in progress
+	var waitCount int64
+
+	// set updates the gauges derived from the counts
+	set := func() {
+		active := atomic.LoadInt64(activeCount)
+		poolActive.Set(float64(active))
+		activeConnections.Set(float64(active))
+		idle.Set(float64(max(atomic.LoadInt64(openCount)-active, 0)))
+		waiting.Set(float64(atomic.LoadInt64(&waitCount)))
+	}
+	with := func(name, value string) prometheus.Labels {
+		l := cloneLabels(labels)
+		l[name] = value
+		return l
+	}
+
+	monitor := &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			switch evt.Type {
+			case event.GetStarted:
+				atomic.AddInt64(&waitCount, 1)
+			case event.GetSucceeded:
+				atomic.AddInt64(&waitCount, -1)
+				atomic.AddInt64(activeCount, 1)
+			case event.GetFailed:
+				atomic.AddInt64(&waitCount, -1)
+			case event.ConnectionReturned:
+				atomic.AddInt64(activeCount, -1)
+			case event.ConnectionCreated:
+				atomic.AddInt64(openCount, 1)
+			case event.ConnectionClosed:
+				atomic.AddInt64(openCount, -1)
+			}
+			if !publishing() {
+				return
+			}
+			switch evt.Type {
+			case event.GetSucceeded:
+				if m.sampled() {
+					checkoutDuration.Observe(evt.Duration.Seconds())
+				}
+			case event.GetFailed:
+				checkoutDuration.Observe(evt.Duration.Seconds())
+				m.checkoutFailures.With(with("reason", evt.Reason)).Inc()
+			case event.ConnectionCreated:
+				created.Inc()
+			case event.ConnectionReady:
+				m.connectDuration.With(with("host", evt.Address)).Observe(evt.Duration.Seconds())
+			case event.ConnectionClosed:
+				m.connectionsClosed.With(with("reason", evt.Reason)).Inc()
+				// Connections failing their handshake are closed with the error reason
+				if evt.Reason == event.ReasonError {
+					m.connectFailures.With(with("host", evt.Address)).Inc()
+				}
+			}
+			set()
+		},
+	}
+	return monitor, set
+}
+
+// UpdateConfigMetrics updates connection pool max from config (called periodically)
+func (m *PrometheusMetrics) UpdateConfigMetrics(cfg *conf.MongoDB) {
+	if m == nil || cfg == nil {
+		return
+	}
+	labels := m.buildLabels(cfg)
+	m.connectionPoolMax.With(labels).Set(float64(cfg.MaxPoolSize))
+}
+
+// RecordHealthCheck records health check result
+func (m *PrometheusMetrics) RecordHealthCheck(success bool, cfg *conf.MongoDB) {
+	if m == nil || cfg == nil {
+		return
+	}
+	labels := m.buildLabels(cfg)
+	m.healthCheckTotal.With(labels).Inc()
+	if success {
+		m.healthCheckSuccess.With(labels).Inc()
+	} else {
+		m.healthCheckFailure.With(labels).Inc()
+	}
+}
+
+// RecordLocalTimeWrite records a non-UTC time.Time value written through the time codec
+func (m *PrometheusMetrics) RecordLocalTimeWrite(cfg *conf.MongoDB) {
+	if m == nil || cfg == nil {
+		return
+	}
+	m.localTimeWritesTotal.With(m.buildLabels(cfg)).Inc()
+}
+
+// RecordUnanchoredRegex records unanchored regex patterns seen in a command
+func (m *PrometheusMetrics) RecordUnanchoredRegex(database, collection string, n int) {
+	if m == nil {
+		return
+	}
+	m.unanchoredRegexTotal.WithLabelValues(database, collection).Add(float64(n))
+}
+
+// RecordQueryViolation records a query security violation
+func (m *PrometheusMetrics) RecordQueryViolation(database, collection, rule string) {
+	if m == nil {
+		return
+	}
+	m.queryViolationsTotal.WithLabelValues(database, collection, rule).Inc()
+}
+
+// RecordLabeledOperation records a command attributed to an owner label
+func (m *PrometheusMetrics) RecordLabeledOperation(database, label, operation string, duration time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	status := "success"
+	if failed {
+		status = "error"
+	}
+	m.labeledOperationsTotal.WithLabelValues(database, label, operation, status).Inc()
+	if m.sampled() {
+		m.labeledQueryDuration.WithLabelValues(database, label).Observe(duration.Seconds())
+	}
+}
+
+// sampled reports whether the current command is observed in duration histograms
+func (m *PrometheusMetrics) sampled() bool {
+	return m.sampleRate >= 1 || rand.Float64() < m.sampleRate
+}
+
+// RecordBudgetBurn records an operation exceeding an owner label budget
+func (m *PrometheusMetrics) RecordBudgetBurn(cfg *conf.MongoDB, label, budget string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["label"] = label
+	l["budget"] = budget
+	m.budgetBurnTotal.With(l).Inc()
+}
+
+// RecordBudgetThrottle records time an operation was delayed by an owner label budget
+func (m *PrometheusMetrics) RecordBudgetThrottle(cfg *conf.MongoDB, label string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["label"] = label
+	m.budgetThrottleSeconds.With(l).Add(wait.Seconds())
+}
+
+// RecordResultSize records the document count and BSON size of a helper read
+func (m *PrometheusMetrics) RecordResultSize(cfg *conf.MongoDB, collection string, documents, bytes int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.resultDocuments.With(l).Observe(float64(documents))
+	m.resultBytes.With(l).Observe(float64(bytes))
+}
+
+// RecordCacheRead records a cached read result (hit, miss or stale)
+func (m *PrometheusMetrics) RecordCacheRead(cfg *conf.MongoDB, collection, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["result"] = result
+	m.cacheReadsTotal.With(l).Inc()
+}
+
+// RecordCacheTTL records the lag-aware TTL of a document just cached for collection
+func (m *PrometheusMetrics) RecordCacheTTL(cfg *conf.MongoDB, collection string, ttl time.Duration) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.cacheTTL.With(l).Set(ttl.Seconds())
+}
+
+// RecordAnonymizedCopy records documents written by an anonymized copy
+func (m *PrometheusMetrics) RecordAnonymizedCopy(cfg *conf.MongoDB, collection string, n int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.anonymizedCopyDocuments.With(l).Add(float64(n))
+}
+
+// RecordQualitySample records the sampled and invalid document counts of a quality check
+func (m *PrometheusMetrics) RecordQualitySample(cfg *conf.MongoDB, collection string, sampled, invalid int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.qualitySampledTotal.With(l).Add(float64(sampled))
+	m.qualityInvalidTotal.With(l).Add(float64(invalid))
+}
+
+// RecordQualityViolations records schema violations of one field and reason
+func (m *PrometheusMetrics) RecordQualityViolations(cfg *conf.MongoDB, collection, field, reason string, n int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["field"] = field
+	l["reason"] = reason
+	m.qualityViolationsTotal.With(l).Add(float64(n))
+}
+
+// RecordDecodeError records a document decode failure attributed to field
+func (m *PrometheusMetrics) RecordDecodeError(cfg *conf.MongoDB, collection, field, reason string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["field"] = field
+	l["reason"] = reason
+	m.decodeErrorsTotal.With(l).Inc()
+}
+
+// RecordNodeHealth sets the member reachability gauge, dropping the series of a previous role
+func (m *PrometheusMetrics) RecordNodeHealth(cfg *conf.MongoDB, node NodeHealth) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["address"] = node.Address
+	m.nodeUp.DeletePartialMatch(cloneLabels(l))
+	l["role"] = node.Role
+	up := 0.0
+	if node.Healthy {
+		up = 1
+	}
+	m.nodeUp.With(l).Set(up)
+}
+
+// RecordReadFallback records a smart read routed to the primary
+func (m *PrometheusMetrics) RecordReadFallback(cfg *conf.MongoDB, reason string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["reason"] = reason
+	m.readFallbacksTotal.With(l).Inc()
+}
+
+// RecordStaleRead records a read whose staleness bound was exceeded
+func (m *PrometheusMetrics) RecordStaleRead(cfg *conf.MongoDB, action string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["action"] = action
+	m.staleReadsTotal.With(l).Inc()
+}
+
+// RecordIngestBatch records one ingestion batch: its duration and document outcomes
+func (m *PrometheusMetrics) RecordIngestBatch(cfg *conf.MongoDB, collection string, d time.Duration, written, retried, failed int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.ingestBatchDuration.With(l).Observe(d.Seconds())
+	if retried > 0 {
+		m.ingestRetriesTotal.With(l).Add(float64(retried))
+	}
+	l["result"] = "written"
+	m.ingestDocuments.With(l).Add(float64(written))
+	l["result"] = "failed"
+	m.ingestDocuments.With(l).Add(float64(failed))
+}
+
+// RecordBulkBatch records a bulk helper batch with its written and failed documents
+func (m *PrometheusMetrics) RecordBulkBatch(cfg *conf.MongoDB, collection string, d time.Duration, written int64, failed int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.bulkBatchDuration.With(l).Observe(d.Seconds())
+	l["result"] = "written"
+	m.bulkDocuments.With(l).Add(float64(written))
+	l["result"] = "failed"
+	m.bulkDocuments.With(l).Add(float64(failed))
+}
+
+// RecordOutboxPublished records an outbox entry published delay after its creation
+func (m *PrometheusMetrics) RecordOutboxPublished(cfg *conf.MongoDB, delay time.Duration) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	m.outboxPublishDelay.With(l).Observe(delay.Seconds())
+	l["result"] = "published"
+	m.outboxEntries.With(l).Inc()
+}
+
+// RecordOutboxFailed records an outbox entry the publisher failed to publish
+func (m *PrometheusMetrics) RecordOutboxFailed(cfg *conf.MongoDB) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["result"] = "failed"
+	m.outboxEntries.With(l).Inc()
+}
+
+// RecordDeadLetters records failed writes recorded in a dead-letter sink
+func (m *PrometheusMetrics) RecordDeadLetters(cfg *conf.MongoDB, collection string, n int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.deadLettersTotal.With(l).Add(float64(n))
+}
+
+// RecordWriteGuardRejection records a multi-document write rejected by the write guard
+func (m *PrometheusMetrics) RecordWriteGuardRejection(cfg *conf.MongoDB, collection, operation string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["operation"] = operation
+	m.writeGuardRejections.With(l).Inc()
+}
+
+// RecordDDL records a DDL operation run or deferred under the maintenance window
+func (m *PrometheusMetrics) RecordDDL(cfg *conf.MongoDB, kind, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["kind"] = kind
+	l["result"] = result
+	m.ddlOperations.With(l).Inc()
+}
+
+// SetDDLPending sets the number of DDL operations waiting for the maintenance window
+func (m *PrometheusMetrics) SetDDLPending(cfg *conf.MongoDB, n int) {
+	if m == nil {
+		return
+	}
+	m.ddlPending.With(m.buildLabels(cfg)).Set(float64(n))
+}
+
+// RecordIndexBuildProgress sets the progress of a running index build
+func (m *PrometheusMetrics) RecordIndexBuildProgress(cfg *conf.MongoDB, collection, index string, progress float64) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["index"] = index
+	m.indexBuildProgress.With(l).Set(progress)
+}
+
+// DeleteIndexBuildProgress removes the progress series of a finished index build
+func (m *PrometheusMetrics) DeleteIndexBuildProgress(cfg *conf.MongoDB, collection, index string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["index"] = index
+	m.indexBuildProgress.Delete(l)
+}
+
+// RecordIndexBuild records a completed index build (result "ready" or "failed")
+func (m *PrometheusMetrics) RecordIndexBuild(cfg *conf.MongoDB, collection, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["result"] = result
+	m.indexBuildsTotal.With(l).Inc()
+}
+
+// RecordManagedIndex records the result of ensuring a managed index
+func (m *PrometheusMetrics) RecordManagedIndex(cfg *conf.MongoDB, collection, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["result"] = result
+	m.managedIndexes.With(l).Inc()
+}
+
+// RecordConfigReload records the result of a configuration reload
+func (m *PrometheusMetrics) RecordConfigReload(cfg *conf.MongoDB, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["result"] = result
+	m.configReloads.With(l).Inc()
+}
+
+// RecordPlanCache records a plan cache poll of a collection: its entries and the entries that
+// appeared and disappeared since the previous poll
+func (m *PrometheusMetrics) RecordPlanCache(cfg *conf.MongoDB, collection string, summary PlanCacheSummary, inserted, evicted int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	m.planCacheEntries.With(l).Set(float64(summary.Entries))
+	m.planCacheInactive.With(l).Set(float64(summary.Inactive))
+	m.planCacheBytes.With(l).Set(float64(summary.SizeBytes))
+	m.planCacheInserted.With(l).Add(float64(inserted))
+	m.planCacheEvicted.With(l).Add(float64(evicted))
+}
+
+// RecordWiredTigerCache records the WiredTiger cache sizes of a serverStatus and the increase of its
+// cumulative counters since the previous one
+func (m *PrometheusMetrics) RecordWiredTigerCache(cfg *conf.MongoDB, cache wiredTigerCache, increase map[string]float64) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	m.wtCacheBytes.With(l).Set(cache.Bytes)
+	m.wtCacheMaxBytes.With(l).Set(cache.MaxBytes)
+	m.wtCacheDirtyBytes.With(l).Set(cache.DirtyBytes)
+	m.wtCacheReadBytes.With(l).Add(increase["read"])
+	m.wtCacheWrittenBytes.With(l).Add(increase["written"])
+	m.wtCacheAppEvicted.With(l).Add(increase["application"])
+	for _, kind := range []string{"modified", "unmodified"} {
+		kl := cloneLabels(l)
+		kl["kind"] = kind
+		m.wtCacheEvicted.With(kl).Add(increase[kind])
+	}
+}
+
+// RecordLockQueues records the global lock queues and active clients of a serverStatus, and its
+// tickets when the server reports them
+func (m *PrometheusMetrics) RecordLockQueues(cfg *conf.MongoDB, lock globalLockStatus, ts *ticketStatus) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	m.lockQueueReaders.With(l).Set(lock.CurrentQueue.Readers)
+	m.lockQueueWriters.With(l).Set(lock.CurrentQueue.Writers)
+	m.lockActiveReaders.With(l).Set(lock.ActiveClients.Readers)
+	m.lockActiveWriters.With(l).Set(lock.ActiveClients.Writers)
+	if ts == nil {
+		return
+	}
+	for operation, t := range map[string]tickets{"read": ts.Read, "write": ts.Write} {
+		ol := cloneLabels(l)
+		ol["operation"] = operation
+		m.ticketsAvailable.With(ol).Set(t.Available)
+		m.ticketsInUse.With(ol).Set(t.Out)
+		m.ticketsCapacity.With(ol).Set(t.TotalTickets)
+	}
+}
+
+// RecordOplogWindow records the oplog window of the primary
+func (m *PrometheusMetrics) RecordOplogWindow(cfg *conf.MongoDB, w OplogWindow) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	m.oplogWindow.With(l).Set(w.Window.Seconds())
+	m.oplogFirstTime.With(l).Set(float64(w.First.Unix()))
+	m.oplogLastTime.With(l).Set(float64(w.Last.Unix()))
+}
+
+// RecordBackup records a backup freshness check; without a backup marker only the threshold and
+// the stale flag are exported
+func (m *PrometheusMetrics) RecordBackup(cfg *conf.MongoDB, status BackupStatus) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	m.backupMaxAge.With(l).Set(status.MaxAge.Seconds())
+	stale := 0.0
+	if status.Stale {
+		stale = 1
+	}
+	m.backupStale.With(l).Set(stale)
+	if status.LastBackup.IsZero() {
+		m.backupAge.Delete(l)
+		m.backupLastTime.Delete(l)
+		return
+	}
+	m.backupAge.With(l).Set(status.Age.Seconds())
+	m.backupLastTime.With(l).Set(float64(status.LastBackup.Unix()))
+}
+
+// RecordTransaction records a transaction attempt (result "committed" or "aborted")
+func (m *PrometheusMetrics) RecordTransaction(cfg *conf.MongoDB, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["result"] = result
+	m.transactionsTotal.With(l).Inc()
+}
+
+// RecordTransactionRetry records a transaction or commit retry
+func (m *PrometheusMetrics) RecordTransactionRetry(cfg *conf.MongoDB, reason string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["reason"] = reason
+	m.txnRetriesTotal.With(l).Inc()
+}
+
+// RecordTxnConflict records a transaction attempt failed by a WriteConflict
+func (m *PrometheusMetrics) RecordTxnConflict(cfg *conf.MongoDB, label string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["label"] = label
+	m.txnConflicts.With(l).Inc()
+}
+
+// RecordTxnConflictRatio records the recent write conflict ratio of a transaction label
+func (m *PrometheusMetrics) RecordTxnConflictRatio(cfg *conf.MongoDB, label string, ratio float64) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["label"] = label
+	m.txnConflictRatio.With(l).Set(ratio)
+}
+
+// RecordThrottled records an operation rejected by server throttling (result "retried" or "failed")
+func (m *PrometheusMetrics) RecordThrottled(cfg *conf.MongoDB, operation, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["operation"] = operation
+	l["result"] = result
+	m.throttledTotal.With(l).Inc()
+}
+
+// RecordRetry records a retry of a failed helper operation
+func (m *PrometheusMetrics) RecordRetry(cfg *conf.MongoDB, operation, reason, idempotency string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["operation"] = operation
+	l["reason"] = reason
+	l["idempotency"] = idempotency
+	m.retriesTotal.With(l).Inc()
+}
+
+// RecordShed records an operation rejected by the load shedding policy
+func (m *PrometheusMetrics) RecordShed(cfg *conf.MongoDB, priority string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["priority"] = priority
+	m.shedTotal.With(l).Inc()
+}
+
+// RecordPriorityWait records the wait of an operation queued for a priority concurrency slot
+func (m *PrometheusMetrics) RecordPriorityWait(cfg *conf.MongoDB, priority string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["priority"] = priority
+	m.priorityWait.With(l).Observe(wait.Seconds())
+}
+
+// RecordCircuitState records the state of the circuit breaker
+func (m *PrometheusMetrics) RecordCircuitState(cfg *conf.MongoDB, state CircuitState) {
+	if m == nil {
+		return
+	}
+	m.circuitState.With(m.buildLabels(cfg)).Set(float64(state))
+}
+
+// RecordCircuitRejection records an operation failed fast by the open circuit breaker
+func (m *PrometheusMetrics) RecordCircuitRejection(cfg *conf.MongoDB, operation string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["operation"] = operation
+	m.circuitRejected.With(l).Inc()
+}
+
+// RecordActiveCluster records the failover cluster serving traffic
+func (m *PrometheusMetrics) RecordActiveCluster(cfg *conf.MongoDB, active string) {
+	if m == nil {
+		return
+	}
+	for _, cluster := range []string{ClusterPrimary, ClusterStandby} {
+		l := m.buildLabels(cfg)
+		l["cluster"] = cluster
+		v := 0.0
+		if cluster == active {
+			v = 1
+		}
+		m.failoverActive.With(l).Set(v)
+	}
+}
+
+// RecordClusterUp records a failover health check of a cluster
+func (m *PrometheusMetrics) RecordClusterUp(cfg *conf.MongoDB, cluster string, up bool) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["cluster"] = cluster
+	v := 0.0
+	if up {
+		v = 1
+	}
+	m.failoverUp.With(l).Set(v)
+}
+
+// RecordSwitchover records a failover switchover to cluster
+func (m *PrometheusMetrics) RecordSwitchover(cfg *conf.MongoDB, cluster string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["cluster"] = cluster
+	m.failoverSwitchovers.With(l).Inc()
+}
+
+// RecordSRVHosts records the number of hosts the SRV records resolved to
+func (m *PrometheusMetrics) RecordSRVHosts(cfg *conf.MongoDB, hosts int) {
+	if m == nil {
+		return
+	}
+	m.srvHosts.With(m.buildLabels(cfg)).Set(float64(hosts))
+}
+
+// RecordSRVFailure records a failed resolution of record
+func (m *PrometheusMetrics) RecordSRVFailure(cfg *conf.MongoDB, record string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["record"] = record
+	m.srvFailures.With(l).Inc()
+}
+
+// RecordSRVChange records a change of the resolved record
+func (m *PrometheusMetrics) RecordSRVChange(cfg *conf.MongoDB, record string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["record"] = record
+	m.srvChanges.With(l).Inc()
+}
+
+// RecordDiscovery records a service discovery refresh and, unless it failed, the resolved hosts
+func (m *PrometheusMetrics) RecordDiscovery(cfg *conf.MongoDB, result string, hosts int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	if result != "failed" {
+		m.discoveryHosts.With(l).Set(float64(hosts))
+	}
+	l["result"] = result
+	m.discoveryRefreshes.With(l).Inc()
+}
+
+// RecordLeaderTransition records a leadership transition of election
+func (m *PrometheusMetrics) RecordLeaderTransition(cfg *conf.MongoDB, election, transition string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["election"] = election
+	leading := 0.0
+	if transition == LeaderGained {
+		leading = 1
+	}
+	m.leader.With(l).Set(leading)
+	l["transition"] = transition
+	m.leaderTransitions.With(l).Inc()
+}
+
+// SetBufferedWrites sets the number of writes held by the write buffer
+func (m *PrometheusMetrics) SetBufferedWrites(cfg *conf.MongoDB, n int) {
+	if m == nil {
+		return
+	}
+	m.bufferedWrites.With(m.buildLabels(cfg)).Set(float64(n))
+}
+
+// RecordBufferedWrite records the result of a write held during a primary election
+func (m *PrometheusMetrics) RecordBufferedWrite(cfg *conf.MongoDB, result, idempotency string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["result"] = result
+	l["idempotency"] = idempotency
+	m.bufferedWritesTotal.With(l).Inc()
+}
+
+// RecordMigration records a schema migration run in direction
+func (m *PrometheusMetrics) RecordMigration(cfg *conf.MongoDB, direction, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["direction"] = direction
+	l["result"] = result
+	m.migrations.With(l).Inc()
+}
+
+// SetMigrationsPending records the number of schema migrations not applied yet
+func (m *PrometheusMetrics) SetMigrationsPending(cfg *conf.MongoDB, n int) {
+	if m == nil {
+		return
+	}
+	m.migrationsPending.With(m.buildLabels(cfg)).Set(float64(n))
+}
+
+// RecordUnitOfWork records a unit of work closed with result
+func (m *PrometheusMetrics) RecordUnitOfWork(cfg *conf.MongoDB, result string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["result"] = result
+	m.unitsOfWork.With(l).Inc()
+}
+
+// RecordIdentityMap records n identity map events of collection with result
+func (m *PrometheusMetrics) RecordIdentityMap(cfg *conf.MongoDB, collection, result string, n int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["result"] = result
+	m.identityMap.With(l).Add(float64(n))
+}
+
+// RecordSeededDocuments records n fixture documents of collection loaded with result
+func (m *PrometheusMetrics) RecordSeededDocuments(cfg *conf.MongoDB, collection, result string, n int) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["collection"] = collection
+	l["result"] = result
+	m.seededDocuments.With(l).Add(float64(n))
+}
+
+// RecordMaintenance records whether the plugin is in maintenance mode
+func (m *PrometheusMetrics) RecordMaintenance(cfg *conf.MongoDB, active bool) {
+	if m == nil {
+		return
+	}
+	value := 0.0
+	if active {
+		value = 1
+	}
+	m.maintenance.With(m.buildLabels(cfg)).Set(value)
+}
+
+// RecordMaintenanceRejection records an operation rejected in maintenance mode
+func (m *PrometheusMetrics) RecordMaintenanceRejection(cfg *conf.MongoDB, priority string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["priority"] = priority
+	m.maintenanceRejections.With(l).Inc()
+}
+
+// sloCounters are the resolved good and bad event counters of one SLO
+type sloCounters struct {
+	good, bad prometheus.Counter
+}
+
+// sloEventCounters resolves the event counters of an SLO once, for the command monitor hot path
+func (m *PrometheusMetrics) sloEventCounters(cfg *conf.MongoDB, slo string) sloCounters {
+	database := m.buildLabels(cfg)["database"]
+	return sloCounters{
+		good: m.sloEvents.WithLabelValues(database, slo, "good"),
+		bad:  m.sloEvents.WithLabelValues(database, slo, "bad"),
+	}
+}
+
+// RecordSLOStatus records the objective, target and burn rates of a latency SLO
+func (m *PrometheusMetrics) RecordSLOStatus(cfg *conf.MongoDB, s SLOStatus) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["slo"] = s.Name
+	m.sloObjective.With(l).Set(s.Objective)
+	m.sloTarget.With(l).Set(s.Target.Seconds())
+	for window, rate := range s.BurnRates {
+		wl := cloneLabels(l)
+		wl["window"] = window
+		m.sloBurnRate.With(wl).Set(rate)
+	}
+}
+
+// DeleteNodeHealth removes the reachability series of a member that left the topology
+func (m *PrometheusMetrics) DeleteNodeHealth(cfg *conf.MongoDB, address string) {
+	if m == nil {
+		return
+	}
+	l := m.buildLabels(cfg)
+	l["address"] = address
+	m.nodeUp.DeletePartialMatch(l)
+}
+
+// GetGatherer returns the Prometheus gatherer
+func (m *PrometheusMetrics) GetGatherer() prometheus.Gatherer {
+	if m == nil || m.registry == nil {
+		return nil
+	}
+	return m.registry
+}
+
+func (m *PrometheusMetrics) buildLabels(cfg *conf.MongoDB) prometheus.Labels {
+	db := "test"
+	if cfg != nil && cfg.Database != "" {
+		db = cfg.Database
+	}
+	return prometheus.Labels{"database": db}
+}
+
+func cloneLabels(in prometheus.Labels) prometheus.Labels {
+	out := prometheus.Labels{}
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// mapCommandNameToOperation maps MongoDB command names to Grafana-friendly operation names
+func mapCommandNameToOperation(cmdName string) string {
+	switch cmdName {
+	case "find", "findOne":
+		return "find"
+	case "insert", "insertOne", "insertMany":
+		return "insert"
+	case "update", "updateOne", "updateMany":
+		return "update"
+	case "delete", "deleteOne", "deleteMany", "remove":
+		return "delete"
+	case "aggregate":
+		return "aggregate"
+	default:
+		return cmdName
+	}
+}
+
+// replyCountFields are the reply counters checked, in order, by extractDocumentsFromReply
+var replyCountFields = []string{"n", "nModified", "nInserted", "nRemoved"}
+
+// extractDocumentsFromReply extracts document count from command reply. It looks up the counters
+// and cursor batches in place instead of decoding the reply, so large batches are never copied.
+func extractDocumentsFromReply(reply bson.Raw, cmdName string) int64 {
+	if len(reply) == 0 {
+		return 0
+	}
+	for _, field := range replyCountFields {
+		if n, ok := reply.Lookup(field).AsInt64OK(); ok && n != 0 {
+			return n
+		}
+	}
+	cursor, ok := reply.Lookup("cursor").DocumentOK()
+	if !ok {
+		return 0
+	}
+	if n := countArrayValues(cursor.Lookup("firstBatch")); n > 0 {
+		return n
+	}
+	return countArrayValues(cursor.Lookup("nextBatch"))
+}
+
+// countArrayValues counts the elements of a BSON array without decoding them
+func countArrayValues(v bson.RawValue) int64 {
+	arr, ok := v.ArrayOK()
+	if !ok || len(arr) < 5 {
+		return 0
+	}
+	var n int64
+	rest := bsoncore.Document(arr)[4 : len(arr)-1]
+	for len(rest) > 0 {
+		if _, rest, ok = bsoncore.ReadElement(rest); !ok {
+			return 0
 		}
+		n++
 	}
-	return 0
+	return n
 }
@@ -0,0 +1,186 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestHistogramSampling(t *testing.T) {
+	m := NewPrometheusMetrics(&PrometheusConfig{Namespace: "lynx", HistogramSampleRate: 0.1})
+	mon := m.CreateCommandMonitor(&conf.MongoDB{Database: "app"})
+
+	const commands = 2000
+	for i := int64(0); i < commands; i++ {
+		mon.Started(context.Background(), &event.CommandStartedEvent{CommandName: "find", RequestID: i})
+		mon.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+			CommandName: "find", RequestID: i, Duration: time.Millisecond}})
+	}
+
+	if got := testutil.ToFloat64(m.operationsTotal.WithLabelValues("app", "find")); got != commands {
+		t.Errorf("counters must stay exact, got %v", got)
+	}
+	observed := testutil.CollectAndCount(m.queryDuration)
+	if observed != 1 {
+		t.Fatalf("expected one histogram series, got %d", observed)
+	}
+	families, err := m.GetGatherer().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "lynx_mongodb_query_duration_seconds" {
+			continue
+		}
+		count := mf.GetMetric()[0].GetHistogram().GetSampleCount()
+		if count == 0 || count > commands/2 {
+			t.Errorf("expected roughly a tenth of commands observed, got %d", count)
+		}
+	}
+}
+
+func TestCommandMonitorHotPathDoesNotAllocate(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	mon := m.CreateCommandMonitor(&conf.MongoDB{Database: "app"})
+	ctx := context.Background()
+	started := &event.CommandStartedEvent{CommandName: "find", RequestID: 1}
+	succeeded := &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: "find", RequestID: 1, Duration: time.Millisecond}}
+	mon.Started(ctx, started)
+	mon.Succeeded(ctx, succeeded)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		mon.Started(ctx, started)
+		mon.Succeeded(ctx, succeeded)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations per command, got %v", allocs)
+	}
+	if got := testutil.ToFloat64(m.operationsTotal.WithLabelValues("app", "find")); got != 102 {
+		t.Errorf("got %v commands", got)
+	}
+}
+
+func TestCancelledCommandsAreNotErrors(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	mon := m.CreateCommandMonitor(&conf.MongoDB{Database: "app"})
+	failed := func(id int64, failure string) *event.CommandFailedEvent {
+		return &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+			CommandName: "find", RequestID: id, Duration: time.Millisecond}, Failure: failure}
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	mon.Failed(cancelled, failed(1, "connection(localhost:27017) incomplete read of message header"))
+	mon.Failed(context.Background(), failed(2, "context canceled"))
+	timedOut, cancelTimeout := context.WithTimeout(context.Background(), 0)
+	defer cancelTimeout()
+	mon.Failed(timedOut, failed(3, "context deadline exceeded"))
+	mon.Failed(context.Background(), failed(4, "(NotWritablePrimary) not primary"))
+
+	if got := testutil.ToFloat64(m.cancelledTotal.WithLabelValues("app", "find")); got != 2 {
+		t.Errorf("cancelled = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.errorsTotal.WithLabelValues("app")); got != 2 {
+		t.Errorf("errors = %v, want 2", got)
+	}
+}
+
+func TestCommandMetricsUseTargetDatabase(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	mon := m.CreateCommandMonitor(&conf.MongoDB{Database: "app"})
+	ctx := context.Background()
+	finished := func(id int64, database string) event.CommandFinishedEvent {
+		return event.CommandFinishedEvent{CommandName: "find", DatabaseName: database, RequestID: id, Duration: time.Millisecond}
+	}
+	mon.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished(1, "reporting")})
+	mon.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: finished(2, "reporting"), Failure: "(Unauthorized) not authorized"})
+	mon.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished(3, "")})
+
+	if got := testutil.ToFloat64(m.operationsTotal.WithLabelValues("reporting", "find")); got != 2 {
+		t.Errorf("reporting commands = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.errorsTotal.WithLabelValues("reporting")); got != 1 {
+		t.Errorf("reporting errors = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.operationsTotal.WithLabelValues("app", "find")); got != 1 {
+		t.Errorf("commands without a database must use the configured one, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.errorsTotal.WithLabelValues("app")); got != 0 {
+		t.Errorf("app errors = %v, want 0", got)
+	}
+}
+
+func TestPoolMonitorTracksCheckouts(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "app"}
+	var active, open int64
+	mon := m.CreatePoolMonitor(cfg, &active, &open)
+	labels := m.buildLabels(cfg)
+	pool := func(typ string, reason string, wait time.Duration) {
+		mon.Event(&event.PoolEvent{Type: typ, Reason: reason, Duration: wait})
+	}
+
+	pool(event.ConnectionCreated, "", 0)
+	pool(event.ConnectionCreated, "", 0)
+	pool(event.GetStarted, "", 0)
+	pool(event.GetStarted, "", 0)
+	pool(event.GetStarted, "", 0)
+	if got := testutil.ToFloat64(m.connectionPoolWait.With(labels)); got != 3 {
+		t.Errorf("waiting = %v, want 3", got)
+	}
+	pool(event.GetSucceeded, "", time.Millisecond)
+	pool(event.GetFailed, event.ReasonTimedOut, 2*time.Second)
+	if got := testutil.ToFloat64(m.connectionPoolWait.With(labels)); got != 1 {
+		t.Errorf("waiting = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.connectionPoolActive.With(labels)); got != 1 {
+		t.Errorf("active = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.connectionPoolIdle.With(labels)); got != 1 {
+		t.Errorf("idle = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.checkoutFailures.WithLabelValues("app", event.ReasonTimedOut)); got != 1 {
+		t.Errorf("checkout timeouts = %v, want 1", got)
+	}
+
+	pool(event.ConnectionReturned, "", 0)
+	pool(event.ConnectionClosed, event.ReasonIdle, 0)
+	if got := testutil.ToFloat64(m.connectionPoolIdle.With(labels)); got != 1 {
+		t.Errorf("idle = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.connectionsCreated.With(labels)); got != 2 {
+		t.Errorf("created = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.connectionsClosed.WithLabelValues("app", event.ReasonIdle)); got != 1 {
+		t.Errorf("closed = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.checkoutDuration); got != 1 {
+		t.Errorf("expected one checkout histogram series, got %d", got)
+	}
+}
+
+func TestPoolMonitorRecordsConnectionEstablishment(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	var active, open int64
+	mon := m.CreatePoolMonitor(&conf.MongoDB{Database: "app"}, &active, &open)
+
+	mon.Event(&event.PoolEvent{Type: event.ConnectionCreated, Address: "db-0:27017"})
+	mon.Event(&event.PoolEvent{Type: event.ConnectionReady, Address: "db-0:27017", Duration: 40 * time.Millisecond})
+	mon.Event(&event.PoolEvent{Type: event.ConnectionCreated, Address: "db-1:27017"})
+	mon.Event(&event.PoolEvent{Type: event.ConnectionClosed, Address: "db-1:27017", Reason: event.ReasonError})
+	mon.Event(&event.PoolEvent{Type: event.ConnectionClosed, Address: "db-0:27017", Reason: event.ReasonIdle})
+
+	if got := testutil.CollectAndCount(m.connectDuration); got != 1 {
+		t.Errorf("expected one establishment histogram series, got %d", got)
+	}
+	if got := testutil.ToFloat64(m.connectFailures.WithLabelValues("app", "db-1:27017")); got != 1 {
+		t.Errorf("db-1 failures = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.connectFailures); got != 1 {
+		t.Errorf("idle closes must not count as establishment failures, got %d series", got)
+	}
+}
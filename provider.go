@@ -101,10 +101,10 @@ func (p provider) Collection(ctx context.Context, name string) (*mongo.Collectio
 
 func (provider) DatabaseName() string {
 	plugin, err := getPlugin()
-	if err != nil || plugin.conf == nil {
+	if err != nil || plugin.config() == nil {
 		return ""
 	}
-	return plugin.conf.Database
+	return plugin.config().Database
 }
 
 func (p *PlugMongoDB) publishResourceContract() {
@@ -121,18 +121,19 @@ func (p *PlugMongoDB) publishResourceContract() {
 	if err := p.rt.RegisterPrivateResource("provider", mongoProvider); err != nil {
 		log.Warnf("failed to register mongodb private provider resource: %v", err)
 	}
-	if p.client != nil {
-		if err := p.rt.RegisterPrivateResource(privateClientResourceName, p.client); err != nil {
+	client, database := p.ClientPair()
+	if client != nil {
+		if err := p.rt.RegisterPrivateResource(privateClientResourceName, client); err != nil {
 			log.Warnf("failed to register mongodb private client resource: %v", err)
 		}
 	}
-	if p.database != nil {
-		if err := p.rt.RegisterPrivateResource(privateDatabaseResource, p.database); err != nil {
+	if database != nil {
+		if err := p.rt.RegisterPrivateResource(privateDatabaseResource, database); err != nil {
 			log.Warnf("failed to register mongodb private database resource: %v", err)
 		}
 	}
-	if p.conf != nil {
-		if err := p.rt.RegisterPrivateResource(privateConfigResource, p.conf); err != nil {
+	if p.config() != nil {
+		if err := p.rt.RegisterPrivateResource(privateConfigResource, p.config()); err != nil {
 			log.Warnf("failed to register mongodb private config resource: %v", err)
 		}
 	}
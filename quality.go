@@ -0,0 +1,124 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Data quality check defaults
+const (
+	defaultQualityInterval   = 10 * time.Minute
+	defaultQualitySampleSize = 100
+)
+
+// QualityReport is the result of checking a sample of one collection
+type QualityReport struct {
+	Collection string
+	// Sampled is the number of documents checked
+	Sampled int
+	// Invalid is the number of sampled documents with at least one violation
+	Invalid int
+	// Violations counts violations by field and reason
+	Violations map[FieldViolation]int
+}
+
+// startQualityChecks starts the periodic data quality checker when quality_check is enabled
+func (p *PlugMongoDB) startQualityChecks() {
+	cfg := p.config().GetQualityCheck()
+	if !cfg.GetEnabled() {
+		return
+	}
+	interval := cfg.GetInterval().AsDuration()
+	if interval <= 0 {
+		interval = defaultQualityInterval
+	}
+	p.startPeriodicTask("quality_check", interval, func(ctx context.Context) {
+		if _, err := p.RunQualityCheck(ctx); err != nil {
+			log.Warnf("mongodb data quality check failed: %v", err)
+		}
+	})
+}
+
+// RunQualityCheck samples the configured collections (all registered schemas when none are
+// configured), validates the documents against their schemas and exports violation counters.
+func (p *PlugMongoDB) RunQualityCheck(ctx context.Context) ([]QualityReport, error) {
+	cfg := p.config().GetQualityCheck()
+	size := int(cfg.GetSampleSize())
+	if size <= 0 {
+		size = defaultQualitySampleSize
+	}
+
+	var targets []*collectionSchema
+	if names := cfg.GetCollections(); len(names) > 0 {
+		for _, name := range names {
+			schema := lookupSchema(name)
+			if schema == nil {
+				log.Warnf("mongodb data quality check: no schema registered for %s, skipping", name)
+				continue
+			}
+			targets = append(targets, schema)
+		}
+	} else {
+		targets = registeredSchemas()
+	}
+
+	reports := make([]QualityReport, 0, len(targets))
+	for _, schema := range targets {
+		report, err := p.checkCollectionQuality(ctx, schema, size)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// checkCollectionQuality validates a $sample of size documents of schema's collection
+func (p *PlugMongoDB) checkCollectionQuality(ctx context.Context, schema *collectionSchema, size int) (*QualityReport, error) {
+	report := &QualityReport{Collection: schema.collection, Violations: make(map[FieldViolation]int)}
+	op := operation{name: "aggregate", database: p.databaseName(""), collection: schema.collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, schema.collection)
+		if err != nil {
+			return err
+		}
+		sample := mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: size}}}}}
+		cursor, err := coll.Aggregate(ctx, sample, commentAggregateOptions(ctx))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			report.Sampled++
+			violations := p.validateAgainst(schema, cursor.Current)
+			if len(violations) > 0 {
+				report.Invalid++
+			}
+			for _, v := range violations {
+				// Details vary per document; count by field and reason only
+				report.Violations[FieldViolation{Field: v.Field, Reason: v.Reason}]++
+			}
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("quality check of %s failed: %w", schema.collection, err)
+	}
+
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordQualitySample(p.config(), schema.collection, report.Sampled, report.Invalid)
+		for v, n := range report.Violations {
+			p.prometheusMetrics.RecordQualityViolations(p.config(), schema.collection, violationMetricField(schema.model, v.Field), v.Reason, n)
+		}
+	}
+	if report.Invalid > 0 {
+		log.Warnf("mongodb data quality: %d of %d sampled %s documents violate the registered schema", report.Invalid, report.Sampled, schema.collection)
+	}
+	return report, nil
+}
@@ -0,0 +1,240 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Query scan modes (query_scan_mode)
+const (
+	// QueryScanOff disables the query security scanner
+	QueryScanOff = "off"
+	// QueryScanWarn logs and counts violations without rejecting commands
+	QueryScanWarn = "warn"
+	// QueryScanBlock additionally rejects violating queries issued through plugin helpers
+	QueryScanBlock = "block"
+)
+
+// Query violation rules
+const (
+	// ViolationWhere flags $where, which evaluates JavaScript per document
+	ViolationWhere = "where"
+	// ViolationJavaScript flags other server-side JavaScript ($function, $accumulator, mapReduce)
+	ViolationJavaScript = "javascript"
+	// ViolationOperatorInjection flags $-prefixed keys inside stored values, typically a
+	// request body decoded straight into a document
+	ViolationOperatorInjection = "operator_injection"
+)
+
+// maxQueryScanDepth bounds recursion into deeply nested documents
+const maxQueryScanDepth = 64
+
+// Kinds of BSON values walked by scanQueryDocument
+const (
+	// scanDocument is a document value, such as a filter or a classic update document
+	scanDocument = iota
+	// scanArray is an array, such as a pipeline or the documents of an insert
+	scanArray
+	// scanArrayItem is a document inside an array, such as a pipeline stage, where $set is an
+	// aggregation stage whose values are expressions rather than stored data
+	scanArrayItem
+)
+
+// QueryViolation is a dangerous construct found in a query, pipeline or command
+type QueryViolation struct {
+	// Rule is one of the Violation* constants
+	Rule string
+	// Path is the dotted key path of the construct
+	Path string
+}
+
+func (v QueryViolation) String() string {
+	return v.Rule + " at " + v.Path
+}
+
+// ScanQuery inspects a filter, update, pipeline or command for server-side JavaScript and
+// operator injection patterns. It never reports values, only rules and key paths.
+func ScanQuery(query any) ([]QueryViolation, error) {
+	if query == nil {
+		return nil, nil
+	}
+	raw, err := bson.Marshal(bson.D{{Key: "q", Value: query}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query for inspection: %w", err)
+	}
+	var violations []QueryViolation
+	switch value := bson.Raw(raw).Lookup("q"); value.Type {
+	case bson.TypeEmbeddedDocument:
+		scanQueryDocument(value.Document(), "", scanDocument, false, 0, &violations)
+	case bson.TypeArray:
+		scanQueryDocument(value.Array(), "", scanArray, false, 0, &violations)
+	}
+	return violations, nil
+}
+
+// ValidateUserInput rejects request data (decoded JSON, maps, documents) containing $-prefixed
+// or dotted keys before it is embedded into a filter or stored as a document
+func ValidateUserInput(input any) error {
+	if input == nil {
+		return nil
+	}
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: input}})
+	if err != nil {
+		return fmt.Errorf("failed to encode input for validation: %w", err)
+	}
+	value := bson.Raw(raw).Lookup("v")
+	var doc bson.Raw
+	switch value.Type {
+	case bson.TypeEmbeddedDocument:
+		doc = value.Document()
+	case bson.TypeArray:
+		doc = value.Array()
+	default:
+		return nil
+	}
+	return validateInputKeys(doc, "", value.Type == bson.TypeArray, 0)
+}
+
+func validateInputKeys(doc bson.Raw, path string, array bool, depth int) error {
+	if depth > maxQueryScanDepth {
+		return fmt.Errorf("input nesting exceeds %d levels", maxQueryScanDepth)
+	}
+	elems, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		key := elem.Key()
+		if !array && (strings.HasPrefix(key, "$") || strings.Contains(key, ".")) {
+			return fmt.Errorf("input key %q at %q is not allowed", key, path)
+		}
+		value := elem.Value()
+		switch value.Type {
+		case bson.TypeEmbeddedDocument:
+			if err := validateInputKeys(value.Document(), joinPath(path, key), false, depth+1); err != nil {
+				return err
+			}
+		case bson.TypeArray:
+			if err := validateInputKeys(value.Array(), joinPath(path, key), true, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scanQueryDocument walks doc, of the given scan kind, collecting violations; stored marks
+// documents that are written as data (inserted documents, $set values of classic update documents)
+// where $-prefixed keys indicate injection
+func scanQueryDocument(doc bson.Raw, path string, kind int, stored bool, depth int, out *[]QueryViolation) {
+	if depth > maxQueryScanDepth {
+		return
+	}
+	elems, err := doc.Elements()
+	if err != nil {
+		return
+	}
+	for _, elem := range elems {
+		key := elem.Key()
+		keyPath := joinPath(path, key)
+		switch {
+		case stored && strings.HasPrefix(key, "$"):
+			*out = append(*out, QueryViolation{Rule: ViolationOperatorInjection, Path: keyPath})
+		case key == "$where":
+			*out = append(*out, QueryViolation{Rule: ViolationWhere, Path: keyPath})
+		case key == "$function" || key == "$accumulator":
+			*out = append(*out, QueryViolation{Rule: ViolationJavaScript, Path: keyPath})
+		case depth == 0 && strings.EqualFold(key, "mapReduce"):
+			*out = append(*out, QueryViolation{Rule: ViolationJavaScript, Path: keyPath})
+		}
+
+		value := elem.Value()
+		child := scanDocument
+		if kind == scanArray {
+			child = scanArrayItem
+		}
+		switch {
+		case key == "documents" && value.Type == bson.TypeArray:
+			scanQueryDocument(value.Array(), keyPath, scanArray, true, depth+1, out)
+		case (key == "$set" || key == "$setOnInsert") && kind == scanDocument && value.Type == bson.TypeEmbeddedDocument:
+			// Update pipelines and aggregation stages are array items: their $set holds expressions
+			scanStoredValues(value.Document(), keyPath, depth+1, out)
+		case value.Type == bson.TypeEmbeddedDocument:
+			scanQueryDocument(value.Document(), keyPath, child, stored, depth+1, out)
+		case value.Type == bson.TypeArray:
+			scanQueryDocument(value.Array(), keyPath, scanArray, stored, depth+1, out)
+		}
+	}
+}
+
+// scanStoredValues scans the values of an update operator document ({field: value}) as stored data
+func scanStoredValues(doc bson.Raw, path string, depth int, out *[]QueryViolation) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return
+	}
+	for _, elem := range elems {
+		value := elem.Value()
+		switch value.Type {
+		case bson.TypeEmbeddedDocument:
+			scanQueryDocument(value.Document(), joinPath(path, elem.Key()), scanDocument, true, depth+1, out)
+		case bson.TypeArray:
+			scanQueryDocument(value.Array(), joinPath(path, elem.Key()), scanArray, true, depth+1, out)
+		}
+	}
+}
+
+// queryScanMode returns the configured scan mode
+func (p *PlugMongoDB) queryScanMode() string {
+	if p.config() == nil || p.config().QueryScanMode == "" {
+		return QueryScanOff
+	}
+	return p.config().QueryScanMode
+}
+
+// checkQuery enforces block mode for a query issued through a plugin helper. In warn mode the
+// command monitor reports violations once the command is sent, so nothing is done here.
+func (p *PlugMongoDB) checkQuery(op operation) error {
+	if op.query == nil || p.queryScanMode() != QueryScanBlock {
+		return nil
+	}
+	violations, err := ScanQuery(op.query)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	p.reportQueryViolations(op.name, op.database, op.collection, violations)
+	return fmt.Errorf("query rejected by security scanner: %s", violations[0])
+}
+
+// reportQueryViolations logs and counts violations
+func (p *PlugMongoDB) reportQueryViolations(command, database, collection string, violations []QueryViolation) {
+	label, measured := p.metricsCollection(database, collection)
+	for _, v := range violations {
+		if measured && p.prometheusMetrics != nil {
+			p.prometheusMetrics.RecordQueryViolation(database, label, v.Rule)
+		}
+		log.Warnf("mongodb %s on %s.%s: query security violation %s", command, database, collection, v)
+	}
+}
+
+// createQueryScanMonitor reports violations in every command sent by the client. Monitors cannot
+// abort commands, so this is the warn layer; block mode is enforced by the plugin helpers.
+func (p *PlugMongoDB) createQueryScanMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			var violations []QueryViolation
+			scanQueryDocument(evt.Command, "", scanDocument, false, 0, &violations)
+			if len(violations) > 0 {
+				p.reportQueryViolations(evt.CommandName, evt.DatabaseName, commandCollection(evt.Command), violations)
+			}
+		},
+	}
+}
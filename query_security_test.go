@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestScanQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query any
+		want  []QueryViolation
+	}{
+		{
+			name:  "plain filter",
+			query: bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}},
+		},
+		{
+			name:  "where",
+			query: bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "$where", Value: "this.a > 1"}}}}},
+			want:  []QueryViolation{{Rule: ViolationWhere, Path: "$or.0.$where"}},
+		},
+		{
+			name: "function in pipeline",
+			query: mongo.Pipeline{
+				{{Key: "$addFields", Value: bson.D{{Key: "x", Value: bson.D{{Key: "$function", Value: bson.D{}}}}}}},
+			},
+			want: []QueryViolation{{Rule: ViolationJavaScript, Path: "0.$addFields.x.$function"}},
+		},
+		{
+			name:  "injected set value",
+			query: bson.D{{Key: "$set", Value: bson.D{{Key: "profile", Value: bson.M{"$gt": ""}}}}},
+			want:  []QueryViolation{{Rule: ViolationOperatorInjection, Path: "$set.profile.$gt"}},
+		},
+		{
+			name: "injected insert document",
+			query: bson.D{
+				{Key: "insert", Value: "users"},
+				{Key: "documents", Value: bson.A{bson.D{{Key: "name", Value: bson.D{{Key: "$ne", Value: nil}}}}}},
+			},
+			want: []QueryViolation{{Rule: ViolationOperatorInjection, Path: "documents.0.name.$ne"}},
+		},
+		{
+			name: "set stage expressions",
+			query: mongo.Pipeline{
+				{{Key: "$set", Value: bson.D{
+					{Key: "total", Value: bson.D{{Key: "$add", Value: bson.A{"$price", "$tax"}}}},
+					{Key: "label", Value: bson.D{{Key: "$concat", Value: bson.A{"$first", " ", "$last"}}}},
+					{Key: "tier", Value: bson.D{{Key: "$cond", Value: bson.A{bson.D{{Key: "$gt", Value: bson.A{"$total", 100}}}, "gold", "basic"}}}},
+				}}},
+			},
+		},
+		{
+			name: "update statement with a pipeline",
+			query: bson.D{
+				{Key: "update", Value: "orders"},
+				{Key: "updates", Value: bson.A{bson.D{
+					{Key: "q", Value: bson.D{{Key: "_id", Value: 1}}},
+					{Key: "u", Value: bson.A{bson.D{{Key: "$set", Value: bson.D{{Key: "n", Value: bson.D{{Key: "$add", Value: bson.A{"$n", 1}}}}}}}}},
+				}}},
+			},
+		},
+		{
+			name: "update statement with an injected set value",
+			query: bson.D{
+				{Key: "update", Value: "orders"},
+				{Key: "updates", Value: bson.A{bson.D{
+					{Key: "q", Value: bson.D{{Key: "_id", Value: 1}}},
+					{Key: "u", Value: bson.D{{Key: "$set", Value: bson.D{{Key: "note", Value: bson.D{{Key: "$gt", Value: ""}}}}}}},
+				}}},
+			},
+			want: []QueryViolation{{Rule: ViolationOperatorInjection, Path: "updates.0.u.$set.note.$gt"}},
+		},
+		{
+			name: "lease update",
+			query: bson.D{
+				{Key: "findAndModify", Value: defaultLeaseCollection},
+				{Key: "query", Value: bson.D{{Key: "_id", Value: "migrations:_lynx_migrations"}}},
+				{Key: "update", Value: leaseUpdate("host:1", time.Minute)},
+				{Key: "upsert", Value: true},
+			},
+		},
+		{
+			name:  "mapReduce command",
+			query: bson.D{{Key: "mapReduce", Value: "orders"}},
+			want:  []QueryViolation{{Rule: ViolationJavaScript, Path: "mapReduce"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ScanQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("violation %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUserInput(t *testing.T) {
+	if err := ValidateUserInput(map[string]any{"name": "alice", "tags": []any{"a", map[string]any{"k": 1}}}); err != nil {
+		t.Errorf("unexpected error for clean input: %v", err)
+	}
+	if err := ValidateUserInput(map[string]any{"password": map[string]any{"$ne": nil}}); err == nil {
+		t.Error("expected operator key to be rejected")
+	}
+	if err := ValidateUserInput(bson.M{"items": bson.A{bson.M{"a.b": 1}}}); err == nil {
+		t.Error("expected dotted key to be rejected")
+	}
+}
+
+func TestCheckQueryBlockMode(t *testing.T) {
+	p := NewMongoDBClient()
+	WithQueryScanMode(QueryScanBlock)(p)
+	op := operation{name: "find", database: "db", collection: "users", query: bson.D{{Key: "$where", Value: "1"}}}
+	if err := p.checkQuery(op); err == nil {
+		t.Error("expected block mode to reject $where")
+	}
+	WithQueryScanMode(QueryScanWarn)(p)
+	if err := p.checkQuery(op); err != nil {
+		t.Errorf("warn mode must not reject queries: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadFunc runs fn in a causally consistent session that has observed a preceding write:
+// reads issued with the ctx passed to fn see that write, even on secondaries
+type ReadFunc func(ctx context.Context, fn func(ctx context.Context) error) error
+
+// WriteThenRead runs write in a causally consistent session on the pool selected by ctx and
+// returns a ReadFunc bound to the write's cluster and operation time. It serves the "create then
+// immediately fetch" pattern without threading a session through the code, which otherwise
+// yields stale reads with secondaryPreferred. Operations inside write and the read function must
+// use the ctx they are given.
+func (p *PlugMongoDB) WriteThenRead(ctx context.Context, write func(ctx context.Context) error) (ReadFunc, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := p.stateFor(ctx)
+	if s == nil {
+		return nil, errClientNotInitialized
+	}
+	client := s.client
+	causal := options.Session().SetCausalConsistency(true)
+
+	sess, err := client.StartSession(causal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer p.TrackSession(sess)()
+	defer sess.EndSession(ctx)
+	if err := write(mongo.NewSessionContext(ctx, sess)); err != nil {
+		return nil, err
+	}
+	clusterTime, operationTime := sess.ClusterTime(), sess.OperationTime()
+
+	return func(ctx context.Context, fn func(ctx context.Context) error) error {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		readSess, err := client.StartSession(causal)
+		if err != nil {
+			return fmt.Errorf("failed to start session: %w", err)
+		}
+		defer p.TrackSession(readSess)()
+		defer readSess.EndSession(ctx)
+		if clusterTime != nil {
+			if err := readSess.AdvanceClusterTime(clusterTime); err != nil {
+				return err
+			}
+		}
+		if operationTime != nil {
+			if err := readSess.AdvanceOperationTime(operationTime); err != nil {
+				return err
+			}
+		}
+		return fn(mongo.NewSessionContext(ctx, readSess))
+	}, nil
+}
+
+// InsertThenFetch inserts doc into collection and reads it back by _id, with the read guaranteed
+// to observe the insert (see WriteThenRead). Server-side defaults and codecs are reflected in the result.
+func InsertThenFetch[T any](ctx context.Context, p *PlugMongoDB, collection string, doc any) (T, error) {
+	var result T
+	if p == nil {
+		return result, fmt.Errorf("mongodb plugin is nil")
+	}
+	if doc == nil {
+		return result, fmt.Errorf("document cannot be nil")
+	}
+	database := p.databaseName("")
+
+	var id any
+	read, err := p.WriteThenRead(ctx, func(ctx context.Context) error {
+		op := operation{name: "insert", database: database, collection: collection}
+		return p.runOperation(ctx, op, func(ctx context.Context) error {
+			coll, err := p.collectionHandle(ctx, collection)
+			if err != nil {
+				return err
+			}
+			res, err := coll.InsertOne(ctx, doc)
+			if err != nil {
+				return err
+			}
+			id = res.InsertedID
+			return nil
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	err = read(ctx, func(ctx context.Context) error {
+		op := operation{name: "find", database: database, collection: collection, query: filter}
+		return p.runOperation(ctx, op, func(ctx context.Context) error {
+			coll, err := p.collectionHandle(ctx, collection)
+			if err != nil {
+				return err
+			}
+			raw, err := coll.FindOne(ctx, filter, commentFindOneOptions(ctx)).Raw()
+			if err != nil {
+				return err
+			}
+			size := resultSize{}
+			size.add(raw)
+			p.recordResultSize(collection, size)
+			return p.decodeDocument(ctx, collection, raw, &result)
+		})
+	})
+	return result, err
+}
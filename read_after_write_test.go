@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWriteThenReadSession(t *testing.T) {
+	p := NewMongoDBClient()
+	if _, err := p.WriteThenRead(context.Background(), func(context.Context) error { return nil }); err == nil {
+		t.Error("expected an error without a client")
+	}
+
+	// Connect does not contact the server until the first operation
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+
+	clusterTime, err := bson.Marshal(bson.D{{Key: "$clusterTime", Value: bson.D{
+		{Key: "clusterTime", Value: primitive.Timestamp{T: 1700000000, I: 1}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := p.WriteThenRead(context.Background(), func(ctx context.Context) error {
+		sess := mongo.SessionFromContext(ctx)
+		if sess == nil {
+			t.Fatal("expected the write to run in a session")
+		}
+		// Simulate the cluster time gossiped by the write reply
+		return sess.AdvanceClusterTime(clusterTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = read(context.Background(), func(ctx context.Context) error {
+		sess := mongo.SessionFromContext(ctx)
+		if sess == nil || !bytes.Equal(sess.ClusterTime(), clusterTime) {
+			t.Errorf("expected the read session to carry the write cluster time, got %v", sess.ClusterTime())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,317 @@
+package mongodb
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Cache read results reported in cache metrics
+const (
+	cacheResultHit   = "hit"
+	cacheResultMiss  = "miss"
+	cacheResultStale = "stale"
+)
+
+// defaultCacheEntries bounds the in-memory cache created when CacheOptions.Cache is nil
+const defaultCacheEntries = 10000
+
+// CacheEntry is a cached raw document and the time it was read from the server
+type CacheEntry struct {
+	Raw      bson.Raw
+	StoredAt time.Time
+	// Lag is the estimated replication lag of the document when it was read, zero for primary reads
+	Lag time.Duration
+}
+
+// ReadCache stores documents for CachedReader. Entries must be kept past the reader TTL
+// (up to MaxStale) for stale reads to work. Implementations must be safe for concurrent use.
+type ReadCache interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry)
+	Delete(key string)
+}
+
+// MemoryCache is a bounded in-process LRU ReadCache
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+// NewMemoryCache creates an LRU cache holding at most maxEntries documents
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+	return &MemoryCache{maxEntries: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the entry for key and marks it as recently used
+func (c *MemoryCache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*memoryCacheItem).entry, true
+}
+
+// Set stores entry under key, evicting the least recently used entry when full
+func (c *MemoryCache) Set(key string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).entry = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete removes key
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// CacheOptions configures a CachedReader
+type CacheOptions struct {
+	// TTL during which cached documents are served without querying the server
+	TTL time.Duration
+	// ServeStale returns expired cached documents, flagged as stale, when the server is
+	// unavailable instead of failing the read
+	ServeStale bool
+	// MaxStale bounds the age of documents served stale (zero means no bound)
+	MaxStale time.Duration
+	// Cache stores the documents (defaults to a MemoryCache)
+	Cache ReadCache
+	// Strict rejects documents with unknown fields or lossy coercions (see WithStrictDecoding)
+	Strict bool
+	// SecondaryReads reads misses with the read preference of read_split (secondaryPreferred by
+	// default), like GetDatabaseForReads
+	SecondaryReads bool
+	// MaxStaleness bounds the staleness of served documents, counting the replication lag of the
+	// secondaries when they were read: entries expire after MaxStaleness minus that lag, capped by
+	// TTL when set, so TTLs shrink as secondaries fall behind and extend as they catch up. Reads
+	// go to the primary while secondaries lag beyond MaxStaleness.
+	MaxStaleness time.Duration
+}
+
+// CachedResult is a document read through a CachedReader
+type CachedResult[T any] struct {
+	Document T
+	// Stale is set when the document was served from cache because the server was unavailable
+	Stale bool
+	// Age of the cached copy; zero when read from the server
+	Age time.Duration
+}
+
+// CachedReader serves FindByID and FindOne reads of one collection through a read cache,
+// optionally degrading to stale cached documents while MongoDB is unavailable
+type CachedReader[T any] struct {
+	p          *PlugMongoDB
+	collection string
+	opts       CacheOptions
+}
+
+// NewCachedReader creates a cached reader for collection
+func NewCachedReader[T any](p *PlugMongoDB, collection string, opts CacheOptions) *CachedReader[T] {
+	if opts.Cache == nil {
+		opts.Cache = NewMemoryCache(defaultCacheEntries)
+	}
+	return &CachedReader[T]{p: p, collection: collection, opts: opts}
+}
+
+// FindByID reads the document with the given _id
+func (r *CachedReader[T]) FindByID(ctx context.Context, id any) (*CachedResult[T], error) {
+	return r.FindOne(ctx, bson.D{{Key: "_id", Value: id}})
+}
+
+// FindOne reads the first document matching filter. Missing documents are not cached.
+func (r *CachedReader[T]) FindOne(ctx context.Context, filter any) (*CachedResult[T], error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	key, err := r.cacheKey(filter)
+	if err != nil {
+		return nil, err
+	}
+	// Entries are keyed by the caller filter so Invalidate needs no scope; an entry read under
+	// another scope is treated as missing
+	predicate, err := scopePredicate(ctx, r.collection)
+	if err != nil {
+		return nil, err
+	}
+	scoped, _ := ScopeFilter(ctx, r.collection, filter)
+
+	now := time.Now()
+	entry, cached := r.opts.Cache.Get(key)
+	cached = cached && scopeMatches(entry.Raw, predicate)
+	if cached && now.Sub(entry.StoredAt) < r.ttl(entry.Lag) {
+		r.record(cacheResultHit)
+		return r.decode(ctx, entry.Raw, false, now.Sub(entry.StoredAt))
+	}
+
+	var raw bson.Raw
+	var lag time.Duration
+	op := operation{name: "find", database: r.p.databaseName(""), collection: r.collection, query: scoped}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, readLag, err := r.readCollection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := coll.FindOne(ctx, scoped, callFindOneOptions(ctx), commentFindOneOptions(ctx)).Raw()
+		if err != nil {
+			return err
+		}
+		raw, lag = res, readLag
+		return nil
+	})
+	if err != nil {
+		if cached && r.opts.ServeStale && r.p.isUnavailable(err) {
+			age := now.Sub(entry.StoredAt)
+			if r.opts.MaxStale <= 0 || age <= r.opts.MaxStale {
+				r.record(cacheResultStale)
+				return r.decode(ctx, entry.Raw, true, age)
+			}
+		}
+		return nil, err
+	}
+
+	r.record(cacheResultMiss)
+	size := resultSize{}
+	size.add(raw)
+	r.p.recordResultSize(r.collection, size)
+	r.opts.Cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now(), Lag: lag})
+	if r.opts.MaxStaleness > 0 && r.p.prometheusMetrics != nil {
+		r.p.prometheusMetrics.RecordCacheTTL(r.p.config(), r.collection, r.ttl(lag))
+	}
+	return r.decode(ctx, raw, false, 0)
+}
+
+// readCollection returns the collection handle of a miss and the replication lag of the data it
+// reads: the staleness of the stalest reachable secondary unless it reads from the primary
+func (r *CachedReader[T]) readCollection(ctx context.Context) (*mongo.Collection, time.Duration, error) {
+	db, err := r.p.databaseHandle(ctx, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	var rp *readpref.ReadPref
+	if r.opts.SecondaryReads {
+		rp = r.p.readSplitPreference()
+	} else if rp, err = r.p.readPreferenceFor(ctx); err != nil {
+		return nil, 0, err
+	}
+	if rp == nil {
+		rp = db.ReadPreference()
+	}
+	var lag time.Duration
+	if rp != nil && rp.Mode() != readpref.PrimaryMode {
+		lag = r.p.secondaryStaleness()
+		if r.opts.MaxStaleness > 0 && lag >= r.opts.MaxStaleness {
+			// Secondary data would already be staler than the bound
+			rp, lag = readpref.Primary(), 0
+		}
+	}
+	if rp == nil {
+		return db.Collection(r.collection), 0, nil
+	}
+	return db.Collection(r.collection, options.Collection().SetReadPreference(rp)), lag, nil
+}
+
+// ttl returns how long an entry read with replication lag is served: TTL, or with MaxStaleness,
+// what remains of the staleness bound after the lag, capped by TTL when set
+func (r *CachedReader[T]) ttl(lag time.Duration) time.Duration {
+	if r.opts.MaxStaleness <= 0 {
+		return r.opts.TTL
+	}
+	ttl := max(r.opts.MaxStaleness-lag, 0)
+	if r.opts.TTL > 0 {
+		ttl = min(ttl, r.opts.TTL)
+	}
+	return ttl
+}
+
+// Invalidate drops the cached document for id, typically after writing it
+func (r *CachedReader[T]) Invalidate(id any) {
+	r.InvalidateFilter(bson.D{{Key: "_id", Value: id}})
+}
+
+// InvalidateFilter drops the cached result of a FindOne filter
+func (r *CachedReader[T]) InvalidateFilter(filter any) {
+	if key, err := r.cacheKey(filter); err == nil {
+		r.opts.Cache.Delete(key)
+	}
+}
+
+// cacheKey derives a stable key from the collection and the canonical extended JSON of filter
+func (r *CachedReader[T]) cacheKey(filter any) (string, error) {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "f", Value: filter}}, true, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	return r.collection + ":" + string(data), nil
+}
+
+func (r *CachedReader[T]) decode(ctx context.Context, raw bson.Raw, stale bool, age time.Duration) (*CachedResult[T], error) {
+	if r.opts.Strict {
+		ctx = WithStrictDecoding(ctx)
+	}
+	result := &CachedResult[T]{Stale: stale, Age: age}
+	if err := r.p.decodeDocument(ctx, r.collection, raw, &result.Document); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *CachedReader[T]) record(result string) {
+	if r.p.prometheusMetrics != nil {
+		r.p.prometheusMetrics.RecordCacheRead(r.p.config(), r.collection, result)
+	}
+}
+
+// isUnavailable reports whether err means MongoDB could not serve the operation
+// (no client, server selection failure, network error or timeout), as opposed to a query error
+func (p *PlugMongoDB) isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if p.GetClient() == nil || errors.Is(err, mongo.ErrClientDisconnected) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var selection topology.ServerSelectionError
+	if errors.As(err, &selection) {
+		return true
+	}
+	return mongo.IsNetworkError(err) || mongo.IsTimeout(err)
+}
@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", CacheEntry{})
+	c.Set("b", CacheEntry{})
+	c.Get("a")
+	c.Set("c", CacheEntry{})
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected deleted entry to be gone")
+	}
+}
+
+func TestCachedReaderServesStale(t *testing.T) {
+	type user struct {
+		ID   string `bson:"_id"`
+		Name string `bson:"name"`
+	}
+	raw, err := bson.Marshal(user{ID: "u1", Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The plugin has no client, so every server read fails as unavailable
+	p := NewMongoDBClient()
+	cache := NewMemoryCache(10)
+	reader := NewCachedReader[user](p, "users", CacheOptions{TTL: time.Minute, Cache: cache})
+	key, err := reader.cacheKey(bson.D{{Key: "_id", Value: "u1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now()})
+	res, err := reader.FindByID(context.Background(), "u1")
+	if err != nil || res.Stale || res.Document.Name != "alice" {
+		t.Fatalf("expected fresh cache hit, got %+v, %v", res, err)
+	}
+
+	cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now().Add(-time.Hour)})
+	if _, err := reader.FindByID(context.Background(), "u1"); err == nil {
+		t.Fatal("expected expired entry to fail without ServeStale")
+	}
+
+	reader.opts.ServeStale = true
+	res, err = reader.FindByID(context.Background(), "u1")
+	if err != nil || !res.Stale || res.Document.Name != "alice" {
+		t.Fatalf("expected stale result, got %+v, %v", res, err)
+	}
+
+	reader.opts.MaxStale = time.Minute
+	if _, err := reader.FindByID(context.Background(), "u1"); err == nil {
+		t.Error("expected entries older than MaxStale to be rejected")
+	}
+}
+
+func TestCachedReaderLagAwareTTL(t *testing.T) {
+	p := NewMongoDBClient()
+	reader := NewCachedReader[bson.M](p, "users", CacheOptions{TTL: time.Minute, MaxStaleness: 30 * time.Second})
+	for lag, want := range map[time.Duration]time.Duration{
+		0:                30 * time.Second,
+		10 * time.Second: 20 * time.Second,
+		time.Minute:      0,
+	} {
+		if got := reader.ttl(lag); got != want {
+			t.Errorf("ttl(%v) = %v, want %v", lag, got, want)
+		}
+	}
+	capped := NewCachedReader[bson.M](p, "users", CacheOptions{TTL: 5 * time.Second, MaxStaleness: 30 * time.Second})
+	if got := capped.ttl(10 * time.Second); got != 5*time.Second {
+		t.Errorf("TTL should cap the lag-aware TTL, got %v", got)
+	}
+	if got := NewCachedReader[bson.M](p, "users", CacheOptions{TTL: time.Minute}).ttl(time.Hour); got != time.Minute {
+		t.Errorf("without MaxStaleness the TTL should not depend on lag, got %v", got)
+	}
+
+	// An entry read 15s behind the primary expires after the 15s left of its bound
+	raw, _ := bson.Marshal(bson.M{"_id": "u1"})
+	key, _ := reader.cacheKey(bson.D{{Key: "_id", Value: "u1"}})
+	reader.opts.Cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now().Add(-10 * time.Second), Lag: 15 * time.Second})
+	if _, err := reader.FindByID(t.Context(), "u1"); err != nil {
+		t.Errorf("entry within its lag-aware TTL = %v", err)
+	}
+	reader.opts.Cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now().Add(-20 * time.Second), Lag: 15 * time.Second})
+	if _, err := reader.FindByID(t.Context(), "u1"); err == nil {
+		t.Error("entry past its lag-aware TTL should be read again")
+	}
+}
+
+func TestCachedReaderSecondaryReads(t *testing.T) {
+	p := NewMongoDBClient()
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	p.nodes.nodes = []NodeHealth{
+		{Role: RolePrimary, Healthy: true},
+		{Role: RoleSecondary, Healthy: true, LagMs: 20000},
+	}
+
+	primary := NewCachedReader[bson.M](p, "users", CacheOptions{MaxStaleness: time.Minute})
+	if _, lag, err := primary.readCollection(t.Context()); err != nil || lag != 0 {
+		t.Errorf("primary reads = %v, %v", lag, err)
+	}
+	reader := NewCachedReader[bson.M](p, "users", CacheOptions{SecondaryReads: true, MaxStaleness: time.Minute})
+	if _, lag, err := reader.readCollection(t.Context()); err != nil || lag != 20*time.Second {
+		t.Errorf("secondary reads = %v, %v", lag, err)
+	}
+	// Secondaries already beyond the bound: read from the primary
+	p.nodes.nodes[1].LagMs = 90000
+	if _, lag, err := reader.readCollection(t.Context()); err != nil || lag != 0 {
+		t.Errorf("reads with lagging secondaries = %v, %v", lag, err)
+	}
+}
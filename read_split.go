@@ -0,0 +1,74 @@
+package mongodb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	defaultReadSplitPreference = "secondaryPreferred"
+	// minMaxStaleness is the smallest maxStalenessSeconds servers accept
+	minMaxStaleness = 90 * time.Second
+)
+
+// parseReadSplit returns the read preference of read_split
+func parseReadSplit(c *conf.ReadSplit) (*readpref.ReadPref, error) {
+	name := c.GetReadPreference()
+	if name == "" {
+		name = defaultReadSplitPreference
+	}
+	mode, err := readpref.ModeFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	var opts []readpref.Option
+	switch staleness := c.GetMaxStaleness().AsDuration(); {
+	case staleness < 0:
+		return nil, fmt.Errorf("max_staleness cannot be negative")
+	case staleness == 0:
+	case mode == readpref.PrimaryMode:
+		return nil, fmt.Errorf("max_staleness cannot be used with the primary read preference")
+	case staleness < minMaxStaleness:
+		return nil, fmt.Errorf("max_staleness %v must be at least %v", staleness, minMaxStaleness)
+	default:
+		opts = append(opts, readpref.WithMaxStaleness(staleness))
+	}
+	return readpref.New(mode, opts...)
+}
+
+// GetDatabaseForReads returns the database handle of reads that tolerate replication lag, such as
+// reporting queries: it reads with read_split.read_preference (secondaryPreferred by default),
+// while GetDatabase keeps the read preference of the client, the primary unless the uri sets
+// another. Writes through it go to the primary as usual. Like GetDatabase, it follows failover and
+// hot reloads, so resolve it per use rather than caching it. nil before the client is created.
+func (p *PlugMongoDB) GetDatabaseForReads() *mongo.Database {
+	db := p.GetDatabase()
+	if db == nil {
+		return nil
+	}
+	return db.Client().Database(db.Name(), options.Database().SetReadPreference(p.readSplitPreference()))
+}
+
+// readSplitPreference returns the read preference of read_split
+func (p *PlugMongoDB) readSplitPreference() *readpref.ReadPref {
+	rp, err := parseReadSplit(p.config().GetReadSplit())
+	if err != nil {
+		// Validated with the configuration
+		return readpref.SecondaryPreferred()
+	}
+	return rp
+}
+
+// GetCollectionForReads returns a collection of GetDatabaseForReads
+func (p *PlugMongoDB) GetCollectionForReads(collectionName string) *mongo.Collection {
+	db := p.GetDatabaseForReads()
+	if db == nil {
+		return nil
+	}
+	return db.Collection(collectionName)
+}
@@ -0,0 +1,62 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestParseReadSplit(t *testing.T) {
+	rp, err := parseReadSplit(nil)
+	if err != nil || rp.Mode() != readpref.SecondaryPreferredMode {
+		t.Fatalf("default = %v, %v", rp, err)
+	}
+	rp, err = parseReadSplit(&conf.ReadSplit{ReadPreference: "nearest", MaxStaleness: durationpb.New(2 * time.Minute)})
+	if staleness, ok := rp.MaxStaleness(); err != nil || rp.Mode() != readpref.NearestMode || !ok || staleness != 2*time.Minute {
+		t.Errorf("nearest = %v, %v", rp, err)
+	}
+	for _, c := range []*conf.ReadSplit{
+		{ReadPreference: "secondaryOnly"},
+		{MaxStaleness: durationpb.New(time.Second)},
+		{MaxStaleness: durationpb.New(-time.Minute)},
+		{ReadPreference: "primary", MaxStaleness: durationpb.New(2 * time.Minute)},
+	} {
+		if _, err := parseReadSplit(c); err == nil {
+			t.Errorf("parseReadSplit(%v) should fail", c)
+		}
+	}
+}
+
+func TestGetDatabaseForReads(t *testing.T) {
+	p := NewMongoDBClient()
+	if p.GetDatabaseForReads() != nil || p.GetCollectionForReads("orders") != nil {
+		t.Error("no read handle should be returned before the client is created")
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+
+	if rp := p.GetDatabase().ReadPreference(); rp.Mode() != readpref.PrimaryMode {
+		t.Errorf("GetDatabase read preference = %v", rp)
+	}
+	reads := p.GetDatabaseForReads()
+	if reads.Name() != "app" || reads.ReadPreference().Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("reads = %s, %v", reads.Name(), reads.ReadPreference())
+	}
+	p.conf.Store(&conf.MongoDB{ReadSplit: &conf.ReadSplit{ReadPreference: "secondary"}})
+	if rp := p.GetDatabaseForReads().ReadPreference(); rp.Mode() != readpref.SecondaryMode {
+		t.Errorf("configured read preference = %v", rp)
+	}
+	if coll := p.GetCollectionForReads("orders"); coll == nil || coll.Database().ReadPreference().Mode() != readpref.SecondaryMode {
+		t.Error("GetCollectionForReads should use the read database")
+	}
+}
@@ -0,0 +1,150 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// defaultRegexMaxLength bounds user input embedded into regex queries
+const defaultRegexMaxLength = 64
+
+// RegexMode selects how user input is anchored in a regex query
+type RegexMode int
+
+const (
+	// RegexPrefix matches values starting with the input ("^input"); it can use an index
+	// when the match is case sensitive
+	RegexPrefix RegexMode = iota
+	// RegexExact matches values equal to the input ("^input$")
+	RegexExact
+	// RegexContains matches values containing the input anywhere; this scans every value
+	RegexContains
+)
+
+// RegexOptions configures SafeRegex
+type RegexOptions struct {
+	// Anchoring mode (default RegexPrefix)
+	Mode RegexMode
+	// MaxLength rejects longer input (default 64 characters)
+	MaxLength int
+	// CaseInsensitive adds the "i" flag; note that case-insensitive regexes cannot use indexes efficiently
+	CaseInsensitive bool
+}
+
+// EscapeRegex escapes all regex metacharacters in s so it matches literally
+func EscapeRegex(s string) string {
+	return regexp.QuoteMeta(s)
+}
+
+// SafeRegex builds a regex that matches user input literally, anchored according to opts
+// and bounded in length, so request data cannot inject expensive patterns
+func SafeRegex(input string, opts RegexOptions) (primitive.Regex, error) {
+	maxLength := opts.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultRegexMaxLength
+	}
+	if input == "" {
+		return primitive.Regex{}, fmt.Errorf("regex input cannot be empty")
+	}
+	if len([]rune(input)) > maxLength {
+		return primitive.Regex{}, fmt.Errorf("regex input exceeds %d characters", maxLength)
+	}
+
+	pattern := EscapeRegex(input)
+	switch opts.Mode {
+	case RegexPrefix:
+		pattern = "^" + pattern
+	case RegexExact:
+		pattern = "^" + pattern + "$"
+	case RegexContains:
+	default:
+		return primitive.Regex{}, fmt.Errorf("unknown regex mode %d", opts.Mode)
+	}
+	flags := ""
+	if opts.CaseInsensitive {
+		flags = "i"
+	}
+	return primitive.Regex{Pattern: pattern, Options: flags}, nil
+}
+
+// RegexFilter builds {field: SafeRegex(input)}
+func RegexFilter(field, input string, opts RegexOptions) (bson.D, error) {
+	if field == "" {
+		return nil, fmt.Errorf("field name cannot be empty")
+	}
+	re, err := SafeRegex(input, opts)
+	if err != nil {
+		return nil, err
+	}
+	return bson.D{{Key: field, Value: re}}, nil
+}
+
+// createRegexGuardMonitor counts commands whose queries contain unanchored regexes,
+// which force full index or collection scans
+func (p *PlugMongoDB) createRegexGuardMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			n := countUnanchoredRegex(evt.Command, 0)
+			if n == 0 {
+				return
+			}
+			collection := commandCollection(evt.Command)
+			if label, ok := p.metricsCollection(evt.DatabaseName, collection); ok && p.prometheusMetrics != nil {
+				p.prometheusMetrics.RecordUnanchoredRegex(evt.DatabaseName, label, n)
+			}
+			log.Debugf("mongodb %s on %s.%s uses %d unanchored regex pattern(s)", evt.CommandName, evt.DatabaseName, collection, n)
+		},
+	}
+}
+
+// maxRegexScanDepth bounds recursion into deeply nested command documents
+const maxRegexScanDepth = 32
+
+// countUnanchoredRegex counts regex values not anchored at the start in a command document,
+// skipping inserted documents and update modifications, which store rather than match values
+func countUnanchoredRegex(doc bson.Raw, depth int) int {
+	if depth > maxRegexScanDepth {
+		return 0
+	}
+	elems, err := doc.Elements()
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, elem := range elems {
+		key := elem.Key()
+		if depth == 0 && (key == "documents" || key == "update") {
+			continue
+		}
+		if key == "u" {
+			continue
+		}
+		value := elem.Value()
+		switch value.Type {
+		case bson.TypeRegex:
+			if pattern, _, ok := value.RegexOK(); ok && !regexAnchored(pattern) {
+				count++
+			}
+		case bson.TypeString:
+			if key == "$regex" && !regexAnchored(value.StringValue()) {
+				count++
+			}
+		case bson.TypeEmbeddedDocument:
+			count += countUnanchoredRegex(value.Document(), depth+1)
+		case bson.TypeArray:
+			count += countUnanchoredRegex(value.Array(), depth+1)
+		}
+	}
+	return count
+}
+
+func regexAnchored(pattern string) bool {
+	return strings.HasPrefix(pattern, "^") || strings.HasPrefix(pattern, `\A`)
+}
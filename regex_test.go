@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSafeRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		opts    RegexOptions
+		want    primitive.Regex
+		wantErr bool
+	}{
+		{name: "prefix default", input: "a.b*", want: primitive.Regex{Pattern: `^a\.b\*`}},
+		{name: "exact", input: "(x)", opts: RegexOptions{Mode: RegexExact}, want: primitive.Regex{Pattern: `^\(x\)$`}},
+		{name: "contains case insensitive", input: "x|y", opts: RegexOptions{Mode: RegexContains, CaseInsensitive: true}, want: primitive.Regex{Pattern: `x\|y`, Options: "i"}},
+		{name: "empty", input: "", wantErr: true},
+		{name: "too long", input: strings.Repeat("a", 65), wantErr: true},
+		{name: "custom limit", input: "abcd", opts: RegexOptions{MaxLength: 3}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SafeRegex(tt.input, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountUnanchoredRegex(t *testing.T) {
+	cmd, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{
+			{Key: "name", Value: primitive.Regex{Pattern: "smith"}},
+			{Key: "email", Value: primitive.Regex{Pattern: "^john"}},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "city", Value: bson.D{{Key: "$regex", Value: ".*berlin"}}}},
+				bson.D{{Key: "zip", Value: bson.D{{Key: "$regex", Value: `\A10`}}}},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countUnanchoredRegex(cmd, 0); got != 2 {
+		t.Errorf("expected 2 unanchored patterns, got %d", got)
+	}
+	if got := commandCollection(cmd); got != "users" {
+		t.Errorf("expected collection users, got %q", got)
+	}
+
+	// Inserted documents store regex values instead of matching with them
+	insert, err := bson.Marshal(bson.D{
+		{Key: "insert", Value: "rules"},
+		{Key: "documents", Value: bson.A{bson.D{{Key: "pattern", Value: primitive.Regex{Pattern: "x"}}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countUnanchoredRegex(insert, 0); got != 0 {
+		t.Errorf("expected inserted regex values to be ignored, got %d", got)
+	}
+}
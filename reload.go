@@ -0,0 +1,199 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Config reload results reported in reload metrics
+const (
+	reloadRebuilt         = "rebuilt"
+	reloadApplied         = "applied"
+	reloadUnchanged       = "unchanged"
+	reloadRestartRequired = "restart_required"
+	reloadFailed          = "failed"
+)
+
+// clientFields are the connection settings: changing one rebuilds the client
+var clientFields = []protoreflect.Name{
+	"uri", "database", "username", "password", "auth_source", "auth",
+	"max_pool_size", "min_pool_size",
+	"connect_timeout", "server_selection_timeout", "socket_timeout", "heartbeat_interval",
+	"enable_tls", "tls_cert_file", "tls_key_file", "tls_ca_file", "tls_insecure_skip_verify", "tls_server_name",
+	"enable_compression", "enable_retry_writes",
+	"enable_read_concern", "read_concern_level",
+	"enable_write_concern", "write_concern_w", "write_concern_timeout",
+	"workload_pools",
+	"tcp_keep_alive", "dial_timeout", "proxy_url", "unix_socket", "discovery",
+}
+
+// stateFields build plugin state when the client is created (budgets, SLOs, hot documents, load
+// shedding, priorities, circuit breaker, failover, write buffer, codecs). They are not copied by a
+// reload, even along with a rebuild, so that state keeps matching the configuration: changing them
+// requires a restart.
+var stateFields = []protoreflect.Name{
+	"op_budgets", "latency_slos", "hot_documents", "load_shedding", "priority_concurrency",
+	"circuit_breaker", "failover", "write_buffer", "time_handling",
+}
+
+// liveFields are read on every call (or applied by their own watcher) and need no rebuild
+var liveFields = []protoreflect.Name{"operation_timeout", "debug", "slow_query_threshold"}
+
+// watchReloadConfig reloads the plugin when the config source pushes an updated lynx.mongodb block
+func (p *PlugMongoDB) watchReloadConfig(cfg config.Config) {
+	if err := cfg.Watch(confPrefix, func(_ string, v config.Value) {
+		var next conf.MongoDB
+		if err := v.Scan(&next); err != nil {
+			log.Warnf("ignoring invalid %s update: %v", confPrefix, err)
+			return
+		}
+		_ = p.Reload(context.Background(), &next)
+	}); err != nil {
+		log.Debugf("not watching %s: %v", confPrefix, err)
+	}
+}
+
+// Reload applies an updated plugin configuration. Changed connection settings (URI, credentials,
+// pool sizes, timeouts, TLS, read and write concerns, workload pools) rebuild the client: the new
+// client is connected and pinged, then swapped in behind GetClient, and the previous one is
+// disconnected once operation_timeout has passed so operations already running on it finish; the
+// circuit breaker is reset and the server capabilities are reloaded. operation_timeout and the debug
+// settings apply at once. Other settings keep their current value
+// until a restart and are logged. A failed reload leaves the current client and configuration in place.
+func (p *PlugMongoDB) Reload(ctx context.Context, next *conf.MongoDB) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result, err := p.reload(ctx, next)
+	if m := p.prometheusMetrics; m != nil {
+		m.RecordConfigReload(p.config(), result)
+	}
+	if err != nil {
+		log.Errorw("key", "mongodb", "event", "config_reload_failed", "error", err)
+		return fmt.Errorf("mongodb config reload failed: %w", err)
+	}
+	return nil
+}
+
+func (p *PlugMongoDB) reload(ctx context.Context, next *conf.MongoDB) (string, error) {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	current := p.config()
+	if current == nil || p.loadState() == nil {
+		return reloadFailed, errClientNotInitialized
+	}
+	if next == nil {
+		return reloadFailed, fmt.Errorf("configuration cannot be nil")
+	}
+	next = proto.Clone(next).(*conf.MongoDB)
+	if err := normalizeConf(next); err != nil {
+		return reloadFailed, err
+	}
+
+	merged := proto.Clone(current).(*conf.MongoDB)
+	rebuild := copyConfFields(merged, next, clientFields)
+	live := copyConfFields(merged, next, liveFields)
+	restart := changedConfFields(merged, next)
+	if len(restart) > 0 {
+		log.Warnw("key", "mongodb", "event", "config_reload_restart_required", "fields", strings.Join(restart, ", "))
+	}
+	switch {
+	case rebuild:
+	case live:
+		p.conf.Store(merged)
+		log.Infow("key", "mongodb", "event", "config_reloaded", "rebuilt", false)
+		return reloadApplied, nil
+	case len(restart) > 0:
+		return reloadRestartRequired, nil
+	default:
+		return reloadUnchanged, nil
+	}
+
+	if p.ActiveCluster() != ClusterPrimary {
+		return reloadFailed, fmt.Errorf("cannot rebuild the client while switched over to the failover standby")
+	}
+	if err := p.rebuildClient(ctx, merged); err != nil {
+		return reloadFailed, err
+	}
+	log.Infow("key", "mongodb", "event", "config_reloaded", "rebuilt", true)
+	return reloadRebuilt, nil
+}
+
+// rebuildClient connects a client with cfg and, once it answers a ping, publishes it with cfg in
+// place of the current one, which is retired after the operation timeout. reloadMu must be held.
+func (p *PlugMongoDB) rebuildClient(ctx context.Context, cfg *conf.MongoDB) error {
+	state, err := p.connectClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	pingCtx, cancel := p.createTimeoutContext(ctx, cfg.GetConnectTimeout().AsDuration())
+	defer cancel()
+	if err := state.client.Ping(pingCtx, nil); err != nil {
+		p.retireState(state, 0)
+		return fmt.Errorf("new client is unreachable: %w", err)
+	}
+
+	// Operations that loaded the previous client run for at most the previous operation timeout
+	grace := p.operationTimeout()
+	p.conf.Store(cfg)
+	prev := p.swapState(state)
+	p.handOverMonitor(prev, state)
+	p.retireState(prev, grace)
+	// Failures and capabilities of the previous client say nothing about the new one
+	p.breaker.reset()
+	p.refreshServerInfo(ctx)
+	return nil
+}
+
+// copyConfFields copies the named fields from src to dst and reports whether any differed
+func copyConfFields(dst, src *conf.MongoDB, names []protoreflect.Name) bool {
+	d, s := dst.ProtoReflect(), src.ProtoReflect()
+	fields := d.Descriptor().Fields()
+	changed := false
+	for _, name := range names {
+		fd := fields.ByName(name)
+		if fd == nil || confFieldEqual(d, s, fd) {
+			continue
+		}
+		if s.Has(fd) {
+			d.Set(fd, s.Get(fd))
+		} else {
+			d.Clear(fd)
+		}
+		changed = true
+	}
+	return changed
+}
+
+// changedConfFields returns the names of the fields differing between a and b
+func changedConfFields(a, b *conf.MongoDB) []string {
+	x, y := a.ProtoReflect(), b.ProtoReflect()
+	fields := x.Descriptor().Fields()
+	var changed []string
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); !confFieldEqual(x, y, fd) {
+			changed = append(changed, string(fd.Name()))
+		}
+	}
+	return changed
+}
+
+// confFieldEqual reports whether field fd holds the same value in a and b
+func confFieldEqual(a, b protoreflect.Message, fd protoreflect.FieldDescriptor) bool {
+	x, y := &conf.MongoDB{}, &conf.MongoDB{}
+	if a.Has(fd) {
+		x.ProtoReflect().Set(fd, a.Get(fd))
+	}
+	if b.Has(fd) {
+		y.ProtoReflect().Set(fd, b.Get(fd))
+	}
+	return proto.Equal(x, y)
+}
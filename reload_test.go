@@ -0,0 +1,132 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func reloadTestPlugin(t *testing.T) (*PlugMongoDB, *mongo.Client) {
+	t.Helper()
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Uri: "mongodb://localhost:1", Database: "app"})
+	if err := p.normalizeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	// Connect does not contact the server until the first operation
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(p.config().Uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	p.swapState(newClientState(client, "app"))
+	return p, client
+}
+
+func TestReloadLiveAndRestartFields(t *testing.T) {
+	p, client := reloadTestPlugin(t)
+	next := proto.Clone(p.config()).(*conf.MongoDB)
+
+	if result, err := p.reload(context.Background(), next); err != nil || result != reloadUnchanged {
+		t.Errorf("identical config: %s, %v", result, err)
+	}
+
+	next.OperationTimeout = durationpb.New(5 * time.Second)
+	next.EnableMetrics = true
+	if result, err := p.reload(context.Background(), next); err != nil || result != reloadApplied {
+		t.Fatalf("live change: %s, %v", result, err)
+	}
+	if p.operationTimeout() != 5*time.Second || p.config().EnableMetrics || p.GetClient() != client {
+		t.Errorf("expected only operation_timeout applied, without a rebuild")
+	}
+
+	if result, err := p.reload(context.Background(), next); err != nil || result != reloadRestartRequired {
+		t.Errorf("restart-only change: %s, %v", result, err)
+	}
+}
+
+func TestReloadFailureKeepsClient(t *testing.T) {
+	p, client := reloadTestPlugin(t)
+	current := p.config()
+
+	next := proto.Clone(current).(*conf.MongoDB)
+	next.QueryScanMode = "strict"
+	if err := p.Reload(context.Background(), next); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+
+	next = proto.Clone(current).(*conf.MongoDB)
+	next.Uri = "mongodb://localhost:2"
+	next.ConnectTimeout = durationpb.New(50 * time.Millisecond)
+	next.ServerSelectionTimeout = durationpb.New(50 * time.Millisecond)
+	if err := p.Reload(context.Background(), next); err == nil {
+		t.Error("expected an unreachable server to fail the reload")
+	}
+	if p.GetClient() != client || p.config() != current {
+		t.Error("a failed reload must keep the current client and config")
+	}
+}
+
+func TestChangedConfFields(t *testing.T) {
+	a := &conf.MongoDB{Uri: "mongodb://a", WorkloadPools: []*conf.WorkloadPool{{Name: "reports"}}}
+	b := &conf.MongoDB{Uri: "mongodb://a", WorkloadPools: []*conf.WorkloadPool{{Name: "batch"}}, EnableTracing: true}
+	got := changedConfFields(a, b)
+	if len(got) != 2 || got[0] != "workload_pools" || got[1] != "enable_tracing" {
+		t.Errorf("changedConfFields = %v", got)
+	}
+	if !copyConfFields(a, b, clientFields) || len(changedConfFields(a, b)) != 1 {
+		t.Errorf("expected the client fields to be copied, left %v", changedConfFields(a, b))
+	}
+}
+
+func TestReloadKeepsStateFields(t *testing.T) {
+	fields := (&conf.MongoDB{}).ProtoReflect().Descriptor().Fields()
+	for _, name := range stateFields {
+		if fields.ByName(name) == nil {
+			t.Errorf("unknown state field %s", name)
+		}
+		for _, copied := range append(append([]protoreflect.Name(nil), clientFields...), liveFields...) {
+			if copied == name {
+				t.Errorf("state field %s must not be applied by a reload", name)
+			}
+		}
+	}
+
+	p, _ := reloadTestPlugin(t)
+	next := proto.Clone(p.config()).(*conf.MongoDB)
+	next.WriteBuffer = &conf.WriteBuffer{Enabled: true}
+	if result, err := p.reload(context.Background(), next); err != nil || result != reloadRestartRequired {
+		t.Errorf("state change: %s, %v", result, err)
+	}
+	if p.config().GetWriteBuffer() != nil {
+		t.Error("a state field must keep its value until a restart")
+	}
+}
+
+func TestReloadConcurrentReads(t *testing.T) {
+	p, _ := reloadTestPlugin(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			next := proto.Clone(p.config()).(*conf.MongoDB)
+			next.OperationTimeout = durationpb.New(time.Duration(i+1) * time.Second)
+			_ = p.Reload(context.Background(), next)
+		}
+	}()
+	for range 200 {
+		_ = p.operationTimeout()
+		_ = p.retryPolicy()
+	}
+	<-done
+	if p.operationTimeout() != 50*time.Second {
+		t.Errorf("operation timeout = %v", p.operationTimeout())
+	}
+}
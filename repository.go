@@ -0,0 +1,452 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultPageLimit is the page size used when PageRequest.Limit is not set
+const defaultPageLimit = 20
+
+// Repository is a typed view of one collection: documents are decoded into T with the strict
+// decoding and decode error handling of the helpers, and every call runs with the helper behavior
+// (context scope, call options, comment label, operation timeout, metrics).
+type Repository[T any] struct {
+	p          *PlugMongoDB
+	collection string
+}
+
+// NewRepository creates a repository of T documents stored in collection
+func NewRepository[T any](p *PlugMongoDB, collection string) *Repository[T] {
+	return &Repository[T]{p: p, collection: collection}
+}
+
+// Collection returns the name of the repository collection
+func (r *Repository[T]) Collection() string {
+	return r.collection
+}
+
+// FindByID reads the document with the given _id. It returns mongo.ErrNoDocuments (wrapped)
+// when it does not exist. With a unit of work in ctx, the document is tracked by its identity map:
+// later calls of the request return the same instance, and its changes are written on Commit.
+func (r *Repository[T]) FindByID(ctx context.Context, id any) (*T, error) {
+	return findTracked(ctx, r, id)
+}
+
+// FindOne reads the first document matching filter. It returns mongo.ErrNoDocuments (wrapped)
+// when nothing matches.
+func (r *Repository[T]) FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) (*T, error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	filter, err := ScopeFilter(ctx, r.collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	findOpts := append([]*options.FindOneOptions{callFindOneOptions(ctx)}, opts...)
+	findOpts = append(findOpts, commentFindOneOptions(ctx))
+
+	var result T
+	op := operation{name: "find", database: r.p.databaseName(""), collection: r.collection, query: filter}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		raw, err := coll.FindOne(ctx, filter, findOpts...).Raw()
+		if err != nil {
+			return err
+		}
+		size := resultSize{}
+		size.add(raw)
+		r.p.recordResultSize(r.collection, size)
+		return r.p.decodeDocument(ctx, r.collection, raw, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Find reads every document matching filter
+func (r *Repository[T]) Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+	items, _, err := r.find(ctx, filter, opts)
+	return items, err
+}
+
+// find runs a find and decodes the results, returning the raw documents alongside for paging
+func (r *Repository[T]) find(ctx context.Context, filter any, opts []*options.FindOptions) ([]T, []bson.Raw, error) {
+	if r.p == nil {
+		return nil, nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	filter, err := ScopeFilter(ctx, r.collection, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	findOpts := append([]*options.FindOptions{callFindOptions(ctx)}, opts...)
+	findOpts = append(findOpts, commentFindOptions(ctx))
+
+	var items []T
+	var raws []bson.Raw
+	var size resultSize
+	op := operation{name: "find", database: r.p.databaseName(""), collection: r.collection, query: filter}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Find(ctx, filter, findOpts...)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		items, raws, size = nil, nil, resultSize{}
+		for cursor.Next(ctx) {
+			size.add(cursor.Current)
+			var item T
+			if err := r.p.decodeDocument(ctx, r.collection, cursor.Current, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			raws = append(raws, append(bson.Raw(nil), cursor.Current...))
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	r.p.recordResultSize(r.collection, size)
+	return items, raws, nil
+}
+
+// InsertOne inserts doc. On a scoped collection the document must hold the scope field values of
+// the context, so records are never written under another scope.
+func (r *Repository[T]) InsertOne(ctx context.Context, doc *T, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("document cannot be nil")
+	}
+	raw, err := r.p.marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document for %s: %w", r.collection, err)
+	}
+	if err := checkDocumentScope(ctx, r.collection, raw); err != nil {
+		return nil, err
+	}
+	insertOpts := append(append([]*options.InsertOneOptions(nil), opts...), commentInsertOneOptions(ctx))
+
+	var result *mongo.InsertOneResult
+	op := operation{name: "insert", database: r.p.databaseName(""), collection: r.collection}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.InsertOne(ctx, raw, insertOpts...)
+		if err != nil {
+			return err
+		}
+		r.p.InvalidateStats(r.collection)
+		result = res
+		return nil
+	})
+	return result, err
+}
+
+// UpdateByID applies update to the document with the given _id, within the context scope
+func (r *Repository[T]) UpdateByID(ctx context.Context, id, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	filter, err := ScopeFilter(ctx, r.collection, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+	updateOpts := append([]*options.UpdateOptions{callUpdateOptions(ctx)}, opts...)
+	updateOpts = append(updateOpts, commentUpdateOptions(ctx))
+
+	var result *mongo.UpdateResult
+	op := operation{name: "update", database: r.p.databaseName(""), collection: r.collection, query: filter}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.UpdateOne(ctx, filter, update, updateOpts...)
+		if err != nil {
+			return err
+		}
+		result = res
+		return nil
+	})
+	return result, err
+}
+
+// Save writes the changes from before to after, the same document (by _id) as read and as modified,
+// as one $set/$unset update of the changed fields (see DiffDocuments), within the context scope.
+// Nothing is written when nothing changed. The change set is recorded as an audit event. It returns
+// the diff written, and mongo.ErrNoDocuments (wrapped) when the document does not exist in scope.
+func (r *Repository[T]) Save(ctx context.Context, before, after *T, opts ...DiffOption) (*DocumentDiff, error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	if before == nil || after == nil {
+		return nil, fmt.Errorf("document cannot be nil")
+	}
+	prev, err := r.p.marshal(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document for %s: %w", r.collection, err)
+	}
+	next, err := r.p.marshal(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document for %s: %w", r.collection, err)
+	}
+	id, err := next.LookupErr("_id")
+	if err != nil {
+		return nil, fmt.Errorf("document for %s has no _id", r.collection)
+	}
+	if prevID, err := prev.LookupErr("_id"); err != nil || !prevID.Equal(id) {
+		return nil, fmt.Errorf("saved document of %s does not have the _id of the previous one", r.collection)
+	}
+	if err := checkDocumentScope(ctx, r.collection, next); err != nil {
+		return nil, err
+	}
+	diff, err := DiffDocuments(prev, next, opts...)
+	if err != nil || diff.IsEmpty() {
+		return diff, err
+	}
+
+	result, err := r.UpdateByID(ctx, id, diff.Update())
+	if err == nil && result.MatchedCount == 0 {
+		err = fmt.Errorf("failed to save %s document %v: %w", r.collection, id, mongo.ErrNoDocuments)
+	}
+	r.p.audit(ctx, AuditEvent{
+		Action:    "save",
+		Namespace: r.p.databaseName("") + "." + r.collection,
+		Details:   changeSetDetails(id, diff),
+		Err:       err,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// changeSetDetails returns the audit details of a saved diff: the document _id and the fields set and unset
+func changeSetDetails(id bson.RawValue, diff *DocumentDiff) map[string]any {
+	set := make([]string, len(diff.Set))
+	for i, e := range diff.Set {
+		set[i] = e.Key
+	}
+	return map[string]any{"_id": id.String(), "set": set, "unset": diff.Unset}
+}
+
+// DeleteByID deletes the document with the given _id, within the context scope
+func (r *Repository[T]) DeleteByID(ctx context.Context, id any) (*mongo.DeleteResult, error) {
+	if r.p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	filter, err := ScopeFilter(ctx, r.collection, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	var result *mongo.DeleteResult
+	op := operation{name: "delete", database: r.p.databaseName(""), collection: r.collection, query: filter}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.DeleteOne(ctx, filter, commentDeleteOptions(ctx))
+		if err != nil {
+			return err
+		}
+		r.p.InvalidateStats(r.collection)
+		result = res
+		return nil
+	})
+	if u, ok := UnitOfWorkFrom(ctx); ok && err == nil {
+		u.detachID(r.collection, id)
+	}
+	return result, err
+}
+
+// Count returns the number of documents matching filter, within the context scope
+func (r *Repository[T]) Count(ctx context.Context, filter any) (int64, error) {
+	if r.p == nil {
+		return 0, fmt.Errorf("mongodb plugin is nil")
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	filter, err := ScopeFilter(ctx, r.collection, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	op := operation{name: "count", database: r.p.databaseName(""), collection: r.collection, query: filter}
+	err = r.p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := r.p.collectionHandle(ctx, r.collection)
+		if err != nil {
+			return err
+		}
+		count, err = coll.CountDocuments(ctx, filter, commentCountOptions(ctx))
+		return err
+	})
+	return count, err
+}
+
+// PageRequest selects one page of FindPage results
+type PageRequest struct {
+	// Limit is the page size, 20 when not set
+	Limit int64
+	// After is the NextCursor of the previous page; empty for the first page
+	After string
+	// SortField orders the pages, _id when empty. Ties are broken by _id, and documents
+	// without the field are not paged reliably.
+	SortField string
+	// Descending reverses the order
+	Descending bool
+}
+
+// Page is one page of FindPage results
+type Page[T any] struct {
+	Items []T
+	// NextCursor is passed as PageRequest.After to read the next page; empty on the last page
+	NextCursor string
+}
+
+// pageCursor is the decoded form of a page cursor: the sort of the page and the position of its
+// last document
+type pageCursor struct {
+	Field string        `bson:"f"`
+	Dir   int32         `bson:"d"`
+	Value bson.RawValue `bson:"v,omitempty"`
+	ID    bson.RawValue `bson:"id"`
+}
+
+// FindPage reads one page of the documents matching filter, in the order of req. Pages use keyset
+// pagination: each page continues after the last document of the previous one, so the cost does
+// not grow with the page number and concurrent inserts do not shift pages. A cursor is only valid
+// with the sort it was issued for.
+func (r *Repository[T]) FindPage(ctx context.Context, filter any, req PageRequest) (*Page[T], error) {
+	field, dir := pageSort(req)
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if req.After != "" {
+		after, err := decodePageCursor(req.After)
+		if err != nil {
+			return nil, err
+		}
+		if after.Field != field || after.Dir != dir {
+			return nil, fmt.Errorf("%w: page cursor was issued for another sort", ErrBadQuery)
+		}
+		keyset := after.filter()
+		if isEmptyFilter(filter) {
+			filter = keyset
+		} else {
+			filter = bson.D{{Key: "$and", Value: bson.A{filter, keyset}}}
+		}
+	}
+	sort := bson.D{{Key: field, Value: dir}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: dir})
+	}
+
+	items, raws, err := r.find(ctx, filter, []*options.FindOptions{options.Find().SetSort(sort).SetLimit(limit + 1)})
+	if err != nil {
+		return nil, err
+	}
+	page := &Page[T]{Items: items}
+	if int64(len(items)) > limit {
+		page.Items = items[:limit]
+		next, err := encodePageCursor(field, dir, raws[limit-1])
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = next
+	}
+	return page, nil
+}
+
+// pageSort returns the sort field and direction of req
+func pageSort(req PageRequest) (string, int32) {
+	field := req.SortField
+	if field == "" {
+		field = "_id"
+	}
+	if req.Descending {
+		return field, -1
+	}
+	return field, 1
+}
+
+// filter returns the predicate matching the documents after the cursor position
+func (c *pageCursor) filter() bson.D {
+	cmp := "$gt"
+	if c.Dir < 0 {
+		cmp = "$lt"
+	}
+	afterID := bson.D{{Key: "_id", Value: bson.D{{Key: cmp, Value: c.ID}}}}
+	if c.Field == "_id" {
+		return afterID
+	}
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: c.Field, Value: bson.D{{Key: cmp, Value: c.Value}}}},
+		bson.D{{Key: c.Field, Value: c.Value}, afterID[0]},
+	}}}
+}
+
+// encodePageCursor builds the cursor continuing after doc
+func encodePageCursor(field string, dir int32, doc bson.Raw) (string, error) {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return "", fmt.Errorf("page document has no _id")
+	}
+	c := pageCursor{Field: field, Dir: dir, ID: id}
+	if field != "_id" {
+		if c.Value, err = doc.LookupErr(strings.Split(field, ".")...); err != nil {
+			return "", fmt.Errorf("page document has no %s field", field)
+		}
+	}
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageCursor parses a cursor returned in Page.NextCursor
+func decodePageCursor(s string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid page cursor: %w", ErrBadQuery, err)
+	}
+	var c pageCursor
+	if err := bson.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: invalid page cursor: %w", ErrBadQuery, err)
+	}
+	if c.Field == "" || c.ID.Type == 0 {
+		return nil, fmt.Errorf("%w: invalid page cursor", ErrBadQuery)
+	}
+	return &c, nil
+}
@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{{Key: "_id", Value: "a7"}, {Key: "meta", Value: bson.D{{Key: "rank", Value: int32(3)}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := encodePageCursor("meta.rank", -1, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := decodePageCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Field != "meta.rank" || c.Dir != -1 || c.Value.Int32() != 3 || c.ID.StringValue() != "a7" {
+		t.Errorf("unexpected cursor: %+v", c)
+	}
+
+	got, err := bson.MarshalExtJSON(c.filter(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$or":[{"meta.rank":{"$lt":3}},{"meta.rank":3,"_id":{"$lt":"a7"}}]}`
+	if string(got) != want {
+		t.Errorf("filter = %s, want %s", got, want)
+	}
+
+	if _, err := encodePageCursor("rank", 1, doc); err == nil {
+		t.Error("expected an error for a document without the sort field")
+	}
+	for _, bad := range []string{"!", "e30"} {
+		if _, err := decodePageCursor(bad); err == nil {
+			t.Errorf("expected an error for cursor %q", bad)
+		}
+	}
+}
+
+func TestFindPageRejectsForeignCursor(t *testing.T) {
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: 1}})
+	token, err := encodePageCursor("_id", 1, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	repo := NewRepository[scopeTestOrder](p, "orders")
+	if _, err := repo.FindPage(context.Background(), nil, PageRequest{After: token, Descending: true}); err == nil {
+		t.Error("expected an error for a cursor issued for another sort")
+	}
+}
+
+func TestRepositoryInsertScope(t *testing.T) {
+	registerScopedOrders(t)
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	repo := NewRepository[scopeTestOrder](p, "scope_test_orders")
+	ctx := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+
+	if _, err := repo.InsertOne(ctx, &scopeTestOrder{ID: "o1", TenantID: "t2"}); err == nil {
+		t.Error("expected an error inserting a document of another scope")
+	}
+	if _, err := repo.InsertOne(context.Background(), &scopeTestOrder{ID: "o1", TenantID: "t1"}); err == nil {
+		t.Error("expected a scope error without a context scope")
+	}
+}
+
+func TestRepositorySaveChecks(t *testing.T) {
+	registerScopedOrders(t)
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	repo := NewRepository[scopeTestOrder](p, "scope_test_orders")
+	ctx := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+
+	// Nothing changed: no write, so no client is needed
+	order := &scopeTestOrder{ID: "o1", TenantID: "t1"}
+	diff, err := repo.Save(ctx, order, &scopeTestOrder{ID: "o1", TenantID: "t1"})
+	if err != nil || !diff.IsEmpty() {
+		t.Errorf("expected an empty diff, got %+v, %v", diff, err)
+	}
+	if _, err := repo.Save(ctx, order, &scopeTestOrder{ID: "o2", TenantID: "t1"}); err == nil {
+		t.Error("expected an error when the _id changes")
+	}
+	if _, err := repo.Save(ctx, order, &scopeTestOrder{ID: "o1", TenantID: "t2"}); err == nil {
+		t.Error("expected an error when the document leaves the context scope")
+	}
+}
+
+func TestChangeSetDetails(t *testing.T) {
+	diff, err := DiffDocuments(bson.D{{Key: "name", Value: "a"}, {Key: "note", Value: "x"}}, bson.D{{Key: "name", Value: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: "o1"}})
+	details := changeSetDetails(bson.Raw(doc).Lookup("_id"), diff)
+	set, unset := details["set"].([]string), details["unset"].([]string)
+	if len(set) != 1 || set[0] != "name" || len(unset) != 1 || unset[0] != "note" || details["_id"] != `"o1"` {
+		t.Errorf("unexpected change set details: %v", details)
+	}
+}
@@ -0,0 +1,367 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RenameOptions configures RenameCollection
+type RenameOptions struct {
+	// Database holding the source collection; empty uses the configured database
+	Database string
+	// TargetDatabase for cross-database renames; empty keeps the source database
+	TargetDatabase string
+	// DropTarget replaces an existing target collection instead of failing the preflight
+	DropTarget bool
+}
+
+// CappedOptions configures ConvertToCapped
+type CappedOptions struct {
+	// Database holding the collection; empty uses the configured database
+	Database string
+	// RecreateIndexes rebuilds secondary indexes the conversion does not carry over
+	RecreateIndexes bool
+}
+
+// RestructureReport summarizes a restructure and its index carryover verification
+type RestructureReport struct {
+	// Namespace before the change
+	Source string
+	// Namespace after the change
+	Target string
+	// Index names present before the change
+	IndexesBefore []string
+	// Index names present after the change
+	IndexesAfter []string
+	// Indexes that were present before but are missing afterwards
+	MissingIndexes []string
+	// Indexes recreated after the change (ConvertToCapped with RecreateIndexes)
+	RecreatedIndexes []string
+}
+
+// RenameCollection renames a collection after verifying the source exists and the target does not
+// (unless DropTarget is set), then checks that all indexes were carried over.
+func (p *PlugMongoDB) RenameCollection(ctx context.Context, from, to string, opts *RenameOptions) (*RestructureReport, error) {
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("source and target collections cannot be empty")
+	}
+	if opts == nil {
+		opts = &RenameOptions{}
+	}
+	targetDB := opts.TargetDatabase
+	if targetDB == "" {
+		targetDB = p.databaseName(opts.Database)
+	}
+	report := &RestructureReport{
+		Source: p.databaseName(opts.Database) + "." + from,
+		Target: targetDB + "." + to,
+	}
+
+	op := operation{name: "renameCollection", database: p.databaseName(opts.Database), collection: from}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		src, err := p.databaseHandle(ctx, opts.Database)
+		if err != nil {
+			return err
+		}
+		dst, err := p.databaseHandle(ctx, targetDB)
+		if err != nil {
+			return err
+		}
+		if exists, err := collectionExists(ctx, src, from); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("source collection %s does not exist", report.Source)
+		}
+		if exists, err := collectionExists(ctx, dst, to); err != nil {
+			return err
+		} else if exists && !opts.DropTarget {
+			return fmt.Errorf("target collection %s already exists", report.Target)
+		}
+
+		before, err := listIndexDocuments(ctx, src.Collection(from))
+		if err != nil {
+			return err
+		}
+		report.IndexesBefore = indexNames(before)
+
+		cmd := bson.D{
+			{Key: "renameCollection", Value: report.Source},
+			{Key: "to", Value: report.Target},
+			{Key: "dropTarget", Value: opts.DropTarget},
+		}
+		if err := src.Client().Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+			return err
+		}
+
+		after, err := listIndexDocuments(ctx, dst.Collection(to))
+		if err != nil {
+			return err
+		}
+		report.IndexesAfter = indexNames(after)
+		report.MissingIndexes = missingIndexes(before, after)
+		return nil
+	})
+
+	p.audit(ctx, AuditEvent{
+		Action:    "renameCollection",
+		Namespace: report.Source,
+		Details:   map[string]any{"to": report.Target, "drop_target": opts.DropTarget, "missing_indexes": report.MissingIndexes},
+		Err:       err,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.InvalidateStats(from, to)
+	if len(report.MissingIndexes) > 0 {
+		return report, fmt.Errorf("indexes not carried over to %s: %v", report.Target, report.MissingIndexes)
+	}
+	return report, nil
+}
+
+// ConvertToCapped converts a collection to a capped collection of sizeBytes. The server does not carry
+// secondary indexes over; they are reported as missing, or rebuilt when RecreateIndexes is set.
+func (p *PlugMongoDB) ConvertToCapped(ctx context.Context, collection string, sizeBytes int64, opts *CappedOptions) (*RestructureReport, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	if sizeBytes <= 0 {
+		return nil, fmt.Errorf("capped size must be positive")
+	}
+	if opts == nil {
+		opts = &CappedOptions{}
+	}
+	ns := p.databaseName(opts.Database) + "." + collection
+	report := &RestructureReport{Source: ns, Target: ns}
+
+	op := operation{name: "convertToCapped", database: p.databaseName(opts.Database), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, opts.Database)
+		if err != nil {
+			return err
+		}
+		if exists, err := collectionExists(ctx, db, collection); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("collection %s does not exist", ns)
+		}
+
+		before, err := listIndexDocuments(ctx, db.Collection(collection))
+		if err != nil {
+			return err
+		}
+		report.IndexesBefore = indexNames(before)
+
+		cmd := bson.D{{Key: "convertToCapped", Value: collection}, {Key: "size", Value: sizeBytes}}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			return err
+		}
+
+		after, err := listIndexDocuments(ctx, db.Collection(collection))
+		if err != nil {
+			return err
+		}
+		missing := missingIndexes(before, after)
+		if opts.RecreateIndexes && len(missing) > 0 {
+			if err := recreateIndexes(ctx, db, collection, before, missing); err != nil {
+				return err
+			}
+			report.RecreatedIndexes = missing
+			if after, err = listIndexDocuments(ctx, db.Collection(collection)); err != nil {
+				return err
+			}
+			missing = missingIndexes(before, after)
+		}
+		report.IndexesAfter = indexNames(after)
+		report.MissingIndexes = missing
+		return nil
+	})
+
+	p.audit(ctx, AuditEvent{
+		Action:    "convertToCapped",
+		Namespace: ns,
+		Details: map[string]any{
+			"size":              sizeBytes,
+			"missing_indexes":   report.MissingIndexes,
+			"recreated_indexes": report.RecreatedIndexes,
+		},
+		Err: err,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.InvalidateStats(collection)
+	return report, nil
+}
+
+// CollMod applies collMod changes (validator, TTL changes, changeStreamPreAndPostImages, ...) to an
+// existing collection and audits the collection options before and after the change. Outside the
+// DDL window the change is queued and a *DDLDeferredError is returned.
+func (p *PlugMongoDB) CollMod(ctx context.Context, collection string, changes bson.D, database string) (bson.Raw, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("collMod changes cannot be empty")
+	}
+	ns := p.databaseName(database) + "." + collection
+
+	var reply bson.Raw
+	err := p.RunDDL(ctx, DDLCollMod, ns, func(ctx context.Context) error {
+		var before, after bson.Raw
+		op := operation{name: "collMod", database: p.databaseName(database), collection: collection}
+		err := p.runOperation(ctx, op, func(ctx context.Context) error {
+			db, err := p.databaseHandle(ctx, database)
+			if err != nil {
+				return err
+			}
+			if before, err = collectionOptions(ctx, db, collection); err != nil {
+				return err
+			}
+			if before == nil {
+				return fmt.Errorf("collection %s does not exist", ns)
+			}
+
+			cmd := append(bson.D{{Key: "collMod", Value: collection}}, changes...)
+			if reply, err = db.RunCommand(ctx, cmd).Raw(); err != nil {
+				return err
+			}
+			after, _ = collectionOptions(ctx, db, collection)
+			return nil
+		})
+
+		details := map[string]any{"changes": changeKeys(changes)}
+		if before != nil {
+			details["options_before"] = before.String()
+		}
+		if after != nil {
+			details["options_after"] = after.String()
+		}
+		p.audit(ctx, AuditEvent{Action: "collMod", Namespace: ns, Details: details, Err: err})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// collectionExists reports whether a collection (or view) named name exists in db
+func collectionExists(ctx context.Context, db *mongo.Database, name string) (bool, error) {
+	names, err := db.ListCollectionNames(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return false, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return len(names) > 0, nil
+}
+
+// collectionOptions returns the listCollections options document, or nil if the collection does not exist
+func collectionOptions(ctx context.Context, db *mongo.Database, name string) (bson.Raw, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	if specs[0].Options == nil {
+		return bson.Raw{}, nil
+	}
+	return specs[0].Options, nil
+}
+
+// listIndexDocuments returns the raw index definitions of a collection
+func listIndexDocuments(ctx context.Context, coll *mongo.Collection) ([]bson.Raw, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes of %s: %w", coll.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var indexes []bson.Raw
+	for cursor.Next(ctx) {
+		indexes = append(indexes, append(bson.Raw(nil), cursor.Current...))
+	}
+	return indexes, cursor.Err()
+}
+
+func indexNames(indexes []bson.Raw) []string {
+	names := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		if name, ok := idx.Lookup("name").StringValueOK(); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// missingIndexes returns indexes from before whose name and key pattern are absent from after
+func missingIndexes(before, after []bson.Raw) []string {
+	present := make(map[string]string, len(after))
+	for _, idx := range after {
+		if name, ok := idx.Lookup("name").StringValueOK(); ok {
+			present[name] = idx.Lookup("key").String()
+		}
+	}
+	var missing []string
+	for _, idx := range before {
+		name, ok := idx.Lookup("name").StringValueOK()
+		if !ok {
+			continue
+		}
+		if key, found := present[name]; !found || key != idx.Lookup("key").String() {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// recreateIndexes rebuilds the named indexes from their captured definitions
+func recreateIndexes(ctx context.Context, db *mongo.Database, collection string, definitions []bson.Raw, names []string) error {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var specs bson.A
+	for _, idx := range definitions {
+		name, _ := idx.Lookup("name").StringValueOK()
+		if !wanted[name] {
+			continue
+		}
+		elems, err := idx.Elements()
+		if err != nil {
+			return err
+		}
+		spec := bson.D{}
+		for _, elem := range elems {
+			switch elem.Key() {
+			case "v", "ns":
+				// Server-managed fields are not accepted by createIndexes
+			default:
+				spec = append(spec, bson.E{Key: elem.Key(), Value: elem.Value()})
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	cmd := bson.D{{Key: "createIndexes", Value: collection}, {Key: "indexes", Value: specs}}
+	if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("failed to recreate indexes %v on %s: %w", names, collection, err)
+	}
+	return nil
+}
+
+func changeKeys(changes bson.D) []string {
+	keys := make([]string, 0, len(changes))
+	for _, e := range changes {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
@@ -0,0 +1,20 @@
+package mongodb
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// resultSize accumulates the documents a helper read fetched and their BSON size, an
+// approximation of the decoded payload
+type resultSize struct {
+	documents int
+	bytes     int
+}
+
+func (s *resultSize) add(raw bson.Raw) {
+	s.documents++
+	s.bytes += len(raw)
+}
+
+// recordResultSize exports the size of a completed helper read of collection
+func (p *PlugMongoDB) recordResultSize(collection string, s resultSize) {
+	p.prometheusMetrics.RecordResultSize(p.config(), collection, s.documents, s.bytes)
+}
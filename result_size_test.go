@@ -0,0 +1,49 @@
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRecordResultSize(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+
+	var size resultSize
+	for i := range 3 {
+		raw, err := bson.Marshal(bson.D{{Key: "_id", Value: i}, {Key: "payload", Value: string(make([]byte, 2000))}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		size.add(raw)
+	}
+	p.recordResultSize("orders", size)
+	p.recordResultSize("orders", resultSize{})
+
+	families, err := p.prometheusMetrics.GetGatherer().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "lynx_mongodb_result_documents":
+			found++
+			h := mf.GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 2 || h.GetSampleSum() != 3 {
+				t.Errorf("result_documents: count %d, sum %v", h.GetSampleCount(), h.GetSampleSum())
+			}
+		case "lynx_mongodb_result_bytes":
+			found++
+			if sum := mf.GetMetric()[0].GetHistogram().GetSampleSum(); sum < 6000 || sum > 6200 {
+				t.Errorf("result_bytes sum = %v, want about 6000", sum)
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %d result size histograms, want 2", found)
+	}
+}
@@ -0,0 +1,205 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+
+	// labelNoWritesPerformed marks failed writes the server did not apply
+	labelNoWritesPerformed = "NoWritesPerformed"
+)
+
+// Transient error classes of RetryAttempt.Reason, as reported in the retries metric
+const (
+	RetryNetwork       = "network"
+	RetryNotPrimary    = "not_primary"
+	RetryWriteConflict = "write_conflict"
+)
+
+// notPrimaryCodes are returned by a node that is not, or no longer, the primary
+var notPrimaryCodes = []int{
+	10107, // NotWritablePrimary
+	13435, // NotPrimaryNoSecondaryOk
+	10058, // LegacyNotPrimary
+	11602, // InterruptedDueToReplStateChange
+	189,   // PrimarySteppedDown
+}
+
+// readOperations are the helper operations that never write, safe to retry after a network error
+var readOperations = map[string]bool{
+	"find": true, "count": true, "listCollections": true, "listIndexes": true,
+	"collStats": true, "planCacheStats": true, "currentOp": true,
+}
+
+// singleWriteOperations write at most one document, so a write conflict means nothing was written
+var singleWriteOperations = map[string]bool{"findAndModify": true, "replace": true}
+
+// RetryAttempt describes a failed attempt of a helper operation
+type RetryAttempt struct {
+	Operation string
+	// Attempt is the number of attempts made, starting at 1
+	Attempt int
+	Err     error
+	// Reason is the transient error class of Err (RetryNetwork, RetryNotPrimary or
+	// RetryWriteConflict), empty when Err is not known to be safe to retry
+	Reason string
+	// Idempotency is the class of the operation (see WithIdempotency)
+	Idempotency Idempotency
+}
+
+// RetryPolicy decides whether a failed helper operation is retried and the wait before the retry
+type RetryPolicy interface {
+	Retry(attempt RetryAttempt) (time.Duration, bool)
+}
+
+// RetryPolicyFunc adapts a function to RetryPolicy
+type RetryPolicyFunc func(attempt RetryAttempt) (time.Duration, bool)
+
+// Retry calls f
+func (f RetryPolicyFunc) Retry(attempt RetryAttempt) (time.Duration, bool) {
+	return f(attempt)
+}
+
+// backoffRetryPolicy is the retry policy: transient errors are retried up to maxAttempts with a
+// jittered exponential backoff
+type backoffRetryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+func (b backoffRetryPolicy) Retry(a RetryAttempt) (time.Duration, bool) {
+	if a.Reason == "" || a.Attempt >= b.maxAttempts {
+		return 0, false
+	}
+	d := b.backoff
+	for i := 1; i < a.Attempt && d < b.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, b.maxBackoff)
+	return d/2 + rand.N(d/2+1), true
+}
+
+// retryPolicy returns the WithRetryPolicy policy, the retry policy when enabled, or nil
+func (p *PlugMongoDB) retryPolicy() RetryPolicy {
+	if p.customRetryPolicy != nil {
+		return p.customRetryPolicy
+	}
+	cfg := p.config().GetRetry()
+	if !cfg.GetEnabled() {
+		return nil
+	}
+	b := backoffRetryPolicy{
+		maxAttempts: int(cfg.GetMaxAttempts()),
+		backoff:     cfg.GetBackoff().AsDuration(),
+		maxBackoff:  cfg.GetMaxBackoff().AsDuration(),
+	}
+	if b.maxAttempts <= 0 {
+		b.maxAttempts = defaultRetryAttempts
+	}
+	if b.backoff <= 0 {
+		b.backoff = defaultRetryBackoff
+	}
+	if b.maxBackoff <= 0 {
+		b.maxBackoff = defaultRetryMaxBackoff
+	}
+	return b
+}
+
+// transientReason returns the transient error class of err when retrying operation cannot apply
+// a write twice: network errors of reads or of writes the server did not apply, not primary
+// rejections of whole commands, and write conflicts of whole commands or single-document writes.
+// Idempotent operations are also retried after network errors and write conflicts of any write,
+// NonIdempotent ones never.
+func transientReason(operation string, class Idempotency, err error) string {
+	if err == nil || class == NonIdempotent {
+		return ""
+	}
+	if mongo.IsNetworkError(err) {
+		if readOperations[operation] || class == Idempotent || hasErrorLabel(err, labelNoWritesPerformed) {
+			return RetryNetwork
+		}
+		return ""
+	}
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		switch {
+		case hasServerErrorCode(err, notPrimaryCodes...) || strings.Contains(ce.Message, "not master"):
+			return RetryNotPrimary
+		case ce.HasErrorCode(writeConflictCode):
+			return RetryWriteConflict
+		}
+		return ""
+	}
+	var we mongo.WriteException
+	if errors.As(err, &we) && we.WriteConcernError == nil && len(we.WriteErrors) > 0 &&
+		(class == Idempotent || singleWriteOperations[operation] && len(we.WriteErrors) == 1) {
+		for _, e := range we.WriteErrors {
+			if e.Code != writeConflictCode {
+				return ""
+			}
+		}
+		return RetryWriteConflict
+	}
+	return ""
+}
+
+// inTransaction reports whether ctx runs inside a transaction, which retries as a whole
+func inTransaction(ctx context.Context) bool {
+	xs, ok := mongo.SessionFromContext(ctx).(mongo.XSession)
+	return ok && xs.ClientSession().TransactionRunning()
+}
+
+// retryTransient runs fn, retrying it while the retry policy allows. Operations inside a
+// transaction and NonIdempotent ones are not retried, and waits that would outlast the context
+// deadline are not attempted. Writes failing during a primary election wait for it with the write
+// buffer instead of the backoff, within the same attempts; without a retry policy, the write buffer
+// replays them once (see replayAfterElection).
+func (p *PlugMongoDB) retryTransient(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	policy := p.retryPolicy()
+	class := IdempotencyFrom(ctx)
+	if policy == nil || class == NonIdempotent || inTransaction(ctx) {
+		return p.replayAfterElection(ctx, name, fn)
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		reason := transientReason(name, class, err)
+		wait, ok := policy.Retry(RetryAttempt{Operation: name, Attempt: attempt, Err: err, Reason: reason, Idempotency: class})
+		if !ok {
+			return err
+		}
+		if p.awaitsElection(ctx, name, reason) {
+			p.prometheusMetrics.RecordRetry(p.config(), name, reason, class.String())
+			log.Debugf("mongodb %s failed (%s), retrying after the primary election: %v", name, reason, err)
+			if err := p.awaitPrimary(ctx, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		if reason == "" {
+			reason = "other"
+		}
+		p.prometheusMetrics.RecordRetry(p.config(), name, reason, class.String())
+		log.Debugf("mongodb %s failed (%s), retrying in %v: %v", name, reason, wait, err)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransientReason(t *testing.T) {
+	network := mongo.CommandError{Labels: []string{"NetworkError"}}
+	unapplied := mongo.CommandError{Labels: []string{"NetworkError", labelNoWritesPerformed}}
+	conflict := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: writeConflictCode}}}
+	cases := []struct {
+		operation string
+		class     Idempotency
+		err       error
+		want      string
+	}{
+		{"find", IdempotencyUnknown, nil, ""},
+		{"find", IdempotencyUnknown, network, RetryNetwork},
+		{"update", IdempotencyUnknown, network, ""},
+		{"update", IdempotencyUnknown, unapplied, RetryNetwork},
+		{"insert", IdempotencyUnknown, mongo.CommandError{Code: 10107}, RetryNotPrimary},
+		{"insert", IdempotencyUnknown, mongo.CommandError{Message: "not master"}, RetryNotPrimary},
+		{"update", IdempotencyUnknown, mongo.CommandError{Code: writeConflictCode}, RetryWriteConflict},
+		{"findAndModify", IdempotencyUnknown, conflict, RetryWriteConflict},
+		{"update", IdempotencyUnknown, conflict, ""},
+		{"bulkWrite", IdempotencyUnknown, mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: writeConflictCode}}}}, ""},
+		{"insert", IdempotencyUnknown, mongo.CommandError{Code: 11000}, ""},
+		{"find", IdempotencyUnknown, errors.New("boom"), ""},
+	}
+	for _, c := range cases {
+		if got := transientReason(c.operation, c.class, c.err); got != c.want {
+			t.Errorf("transientReason(%s, %s, %v) = %q, want %q", c.operation, c.class, c.err, got, c.want)
+		}
+	}
+}
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	b := backoffRetryPolicy{maxAttempts: 4, backoff: 100 * time.Millisecond, maxBackoff: 300 * time.Millisecond}
+	for attempt, limit := range []time.Duration{100, 200, 300} {
+		limit *= time.Millisecond
+		wait, ok := b.Retry(RetryAttempt{Attempt: attempt + 1, Reason: RetryNetwork})
+		if !ok || wait < limit/2 || wait > limit {
+			t.Errorf("attempt %d: wait %v, %v, want within [%v, %v]", attempt+1, wait, ok, limit/2, limit)
+		}
+	}
+	if _, ok := b.Retry(RetryAttempt{Attempt: 4, Reason: RetryNetwork}); ok {
+		t.Error("retried beyond max_attempts")
+	}
+	if _, ok := b.Retry(RetryAttempt{Attempt: 1}); ok {
+		t.Error("retried an error without transient reason")
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	notPrimary := mongo.CommandError{Code: 10107}
+
+	calls := 0
+	fn := func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return notPrimary
+		}
+		return nil
+	}
+	if err := p.retryTransient(t.Context(), "insert", fn); err == nil || calls != 1 {
+		t.Errorf("expected no retry while retry is disabled, got %d calls: %v", calls, err)
+	}
+
+	WithRetry(3, time.Millisecond, 5*time.Millisecond)(p)
+	calls = 0
+	if err := p.retryTransient(t.Context(), "insert", fn); err != nil || calls != 3 {
+		t.Errorf("expected success on the third call, got %d calls: %v", calls, err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.retriesTotal.WithLabelValues("test", "insert", RetryNotPrimary, "unknown")); got != 2 {
+		t.Errorf("retries_total{reason=not_primary} = %v, want 2", got)
+	}
+	calls = 0
+	if err := p.retryTransient(t.Context(), "insert", func(context.Context) error { calls++; return notPrimary }); err == nil || calls != 3 {
+		t.Errorf("expected max_attempts calls, got %d", calls)
+	}
+	calls = 0
+	ctx := WithIdempotency(t.Context(), NonIdempotent)
+	if err := p.retryTransient(ctx, "insert", func(context.Context) error { calls++; return notPrimary }); err == nil || calls != 1 {
+		t.Errorf("non-idempotent writes should fail fast, got %d calls", calls)
+	}
+
+	// A custom policy decides alone, whatever the error
+	var seen []RetryAttempt
+	WithRetryPolicy(RetryPolicyFunc(func(a RetryAttempt) (time.Duration, bool) {
+		seen = append(seen, a)
+		return 0, a.Attempt < 2
+	}))(p)
+	calls = 0
+	boom := errors.New("boom")
+	if err := p.retryTransient(t.Context(), "find", func(context.Context) error { calls++; return boom }); !errors.Is(err, boom) || calls != 2 {
+		t.Errorf("custom policy: %d calls, %v", calls, err)
+	}
+	if len(seen) != 2 || seen[0].Operation != "find" || seen[0].Reason != "" || seen[1].Attempt != 2 {
+		t.Errorf("custom policy saw %+v", seen)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.retriesTotal.WithLabelValues("test", "find", "other", "unknown")); got != 1 {
+		t.Errorf("retries_total{reason=other} = %v, want 1", got)
+	}
+}
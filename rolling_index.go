@@ -0,0 +1,544 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// States of a rolling index build and of its members
+const (
+	RollingPending  = "pending"
+	RollingBuilding = "building"
+	RollingDone     = "done"
+	RollingFailed   = "failed"
+)
+
+const (
+	defaultIndexCoordinationCollection = "_lynx_index_builds"
+	defaultRollingRejoinTimeout        = 30 * time.Minute
+	defaultRollingMaxLag               = 10 * time.Second
+	// rollingLease is how long a claimed build stays reserved to its owner without renewal
+	rollingLease = 2 * time.Minute
+	// rollingStepDownSeconds is the replSetStepDown period during which the old primary stays ineligible
+	rollingStepDownSeconds = 120
+)
+
+// RollingMember is a replica set member of a rolling index build
+type RollingMember struct {
+	Host string `bson:"host" json:"host"`
+	// Primary marks the member that was primary when the build was planned; it is built last
+	Primary    bool      `bson:"primary" json:"primary"`
+	State      string    `bson:"state" json:"state"`
+	StartedAt  time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// RollingIndexBuild is the state of a rolling index build, stored in the coordination collection
+type RollingIndexBuild struct {
+	// ID identifies the namespace and index set, so every instance resumes the same build
+	ID        string          `bson:"_id" json:"id"`
+	Namespace string          `bson:"namespace" json:"namespace"`
+	Indexes   []string        `bson:"indexes" json:"indexes"`
+	State     string          `bson:"state" json:"state"`
+	Members   []RollingMember `bson:"members" json:"members"`
+	// Owner is the instance running the build while LeaseUntil is in the future
+	Owner      string    `bson:"owner" json:"owner,omitempty"`
+	LeaseUntil time.Time `bson:"lease_until" json:"lease_until"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// MemberIndexBuilder builds indexes on one replica set member taken out of the set, the way the
+// rolling procedure requires: operator tooling restarts the member as a standalone, builds the
+// indexes and restarts it as a member. It returns once the member was restarted.
+type MemberIndexBuilder interface {
+	BuildMemberIndexes(ctx context.Context, member RollingMember, namespace string, specs []IndexSpec) error
+}
+
+// MemberIndexBuilderFunc adapts a function to MemberIndexBuilder
+type MemberIndexBuilderFunc func(ctx context.Context, member RollingMember, namespace string, specs []IndexSpec) error
+
+// BuildMemberIndexes calls f
+func (f MemberIndexBuilderFunc) BuildMemberIndexes(ctx context.Context, member RollingMember, namespace string, specs []IndexSpec) error {
+	return f(ctx, member, namespace, specs)
+}
+
+// RollingIndexOptions configures a rolling index build
+type RollingIndexOptions struct {
+	// Builder builds the indexes on each member (required)
+	Builder MemberIndexBuilder
+	// StepDown lets the plugin step the primary down (replSetStepDown) before building on it. Without
+	// it the build stops with the primary pending; running it again after a failover finishes it.
+	StepDown bool
+	// RejoinTimeout bounds the wait for a built member to return as a healthy secondary (default 30m)
+	RejoinTimeout time.Duration
+	// MaxLag is the replication lag a built member must catch up to before the next one is taken out (default 10s)
+	MaxLag time.Duration
+}
+
+// RollingBuildClaimedError is returned when another instance runs the rolling build
+type RollingBuildClaimedError struct {
+	ID         string
+	Owner      string
+	LeaseUntil time.Time
+}
+
+func (e *RollingBuildClaimedError) Error() string {
+	return fmt.Sprintf("rolling index build %s is run by %s until %s", e.ID, e.Owner, e.LeaseUntil.Format(time.RFC3339))
+}
+
+// replSetStatus is the part of the replSetGetStatus reply a rolling build looks at
+type replSetStatus struct {
+	Members []replSetMember `bson:"members"`
+}
+
+type replSetMember struct {
+	Name       string    `bson:"name"`
+	Health     float64   `bson:"health"`
+	StateStr   string    `bson:"stateStr"`
+	OptimeDate time.Time `bson:"optimeDate"`
+}
+
+var (
+	rollingOwnerOnce sync.Once
+	rollingOwnerID   string
+)
+
+// rollingOwner identifies this process in the coordination collection
+func rollingOwner() string {
+	rollingOwnerOnce.Do(func() {
+		host, _ := os.Hostname()
+		rollingOwnerID = fmt.Sprintf("%s:%d", host, os.Getpid())
+	})
+	return rollingOwnerID
+}
+
+// RollingIndexBuild builds specs, all on one collection, member by member instead of on the primary:
+// secondaries first, one at a time, then the primary after a step-down. Before a member is taken out
+// every other member must be healthy, and the next member waits until the previous one is back as a
+// secondary within MaxLag. State lives in index_coordination_collection, so exactly one instance runs
+// a build at a time and a failed or interrupted build resumes with the members not done yet. The
+// build is DDL and follows the DDL window. Reading the replica set status and stepping down require
+// the clusterMonitor and clusterManager roles.
+func (p *PlugMongoDB) RollingIndexBuild(ctx context.Context, opts RollingIndexOptions, specs ...IndexSpec) (*RollingIndexBuild, error) {
+	if opts.Builder == nil {
+		return nil, fmt.Errorf("rolling index build requires a member index builder")
+	}
+	collection, names, err := rollingSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+	var build *RollingIndexBuild
+	ns := p.ddlNamespace(collection)
+	err = p.RunDDL(ctx, DDLCreateIndexes, ns, func(ctx context.Context) error {
+		var err error
+		build, err = p.runRollingBuild(ctx, opts, ns, names, specs)
+		return err
+	})
+	return build, err
+}
+
+// RollingIndexBuilds returns the rolling builds recorded in the coordination collection
+func (p *PlugMongoDB) RollingIndexBuilds(ctx context.Context) ([]RollingIndexBuild, error) {
+	var builds []RollingIndexBuild
+	op := operation{name: "find", database: p.databaseName(""), collection: p.indexCoordinationCollection()}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			return err
+		}
+		builds = builds[:0]
+		return cursor.All(ctx, &builds)
+	})
+	return builds, err
+}
+
+func (p *PlugMongoDB) runRollingBuild(ctx context.Context, opts RollingIndexOptions, ns string, names []string, specs []IndexSpec) (*RollingIndexBuild, error) {
+	build, err := p.claimRollingBuild(ctx, ns, names)
+	if err != nil {
+		return nil, err
+	}
+	if build.State == RollingDone {
+		return build, p.releaseRollingBuild(ctx, build)
+	}
+	stop := p.keepRollingLease(ctx, build.ID)
+	defer stop()
+
+	build.State = RollingBuilding
+	for i := range build.Members {
+		if build.Members[i].State == RollingDone {
+			continue
+		}
+		if err := p.buildRollingMember(ctx, opts, build, i, specs); err != nil {
+			build.State = RollingFailed
+			if saveErr := p.releaseRollingBuild(ctx, build); saveErr != nil {
+				log.WarnwCtx(ctx, "key", "mongodb", "event", "rolling_index_save_failed", "build", build.ID, "error", saveErr)
+			}
+			return build, err
+		}
+	}
+	build.State = RollingDone
+	return build, p.releaseRollingBuild(ctx, build)
+}
+
+// buildRollingMember takes member i out through the builder and waits for it to rejoin
+func (p *PlugMongoDB) buildRollingMember(ctx context.Context, opts RollingIndexOptions, build *RollingIndexBuild, i int, specs []IndexSpec) error {
+	member := &build.Members[i]
+	status, err := p.replSetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if err := status.othersHealthy(member.Host); err != nil {
+		return err
+	}
+	if state, _ := status.member(member.Host); state.StateStr == "PRIMARY" {
+		if !opts.StepDown {
+			return fmt.Errorf("member %s is primary: step it down or enable StepDown to build it", member.Host)
+		}
+		if err := p.stepDownPrimary(ctx, member.Host, opts); err != nil {
+			return err
+		}
+	}
+
+	member.State, member.StartedAt, member.FinishedAt, member.Error = RollingBuilding, time.Now().UTC(), time.Time{}, ""
+	if err := p.saveRollingBuild(ctx, build); err != nil {
+		return err
+	}
+	log.InfowCtx(ctx, "key", "mongodb", "event", "rolling_index_member_started", "build", build.ID, "member", member.Host, "namespace", build.Namespace)
+
+	err = opts.Builder.BuildMemberIndexes(ctx, *member, build.Namespace, specs)
+	if err == nil {
+		err = p.waitMemberRejoined(ctx, member.Host, opts)
+	}
+	member.FinishedAt = time.Now().UTC()
+	if err != nil {
+		member.State, member.Error = RollingFailed, err.Error()
+	} else {
+		member.State = RollingDone
+	}
+	p.audit(ctx, AuditEvent{
+		Action:    "rollingIndexBuild",
+		Namespace: build.Namespace,
+		Details:   map[string]any{"member": member.Host, "indexes": build.Indexes, "duration": member.FinishedAt.Sub(member.StartedAt).String()},
+		Err:       err,
+	})
+	if err != nil {
+		return fmt.Errorf("rolling index build on %s failed: %w", member.Host, err)
+	}
+	log.InfowCtx(ctx, "key", "mongodb", "event", "rolling_index_member_done", "build", build.ID, "member", member.Host,
+		"duration", member.FinishedAt.Sub(member.StartedAt))
+	return p.saveRollingBuild(ctx, build)
+}
+
+// stepDownPrimary steps host down and waits until another member is primary
+func (p *PlugMongoDB) stepDownPrimary(ctx context.Context, host string, opts RollingIndexOptions) error {
+	_, err := p.RunCommand(ctx, "admin", bson.D{{Key: "replSetStepDown", Value: rollingStepDownSeconds}})
+	if err != nil && !mongo.IsNetworkError(err) {
+		return fmt.Errorf("failed to step down primary %s: %w", host, err)
+	}
+	return p.pollReplSet(ctx, opts.rejoinTimeout(), func(status *replSetStatus) bool {
+		state, _ := status.member(host)
+		return state.StateStr != "PRIMARY" && status.primary() != nil
+	})
+}
+
+// waitMemberRejoined waits until host is a healthy secondary within MaxLag of the primary
+func (p *PlugMongoDB) waitMemberRejoined(ctx context.Context, host string, opts RollingIndexOptions) error {
+	maxLag := opts.MaxLag
+	if maxLag <= 0 {
+		maxLag = defaultRollingMaxLag
+	}
+	return p.pollReplSet(ctx, opts.rejoinTimeout(), func(status *replSetStatus) bool {
+		return status.caughtUp(host, maxLag)
+	})
+}
+
+// pollReplSet polls the replica set status every index_build_poll_interval until done reports true
+func (p *PlugMongoDB) pollReplSet(ctx context.Context, timeout time.Duration, done func(*replSetStatus) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(p.indexBuildPollInterval())
+	defer ticker.Stop()
+	for {
+		// The member may be unreachable or the set electing a primary: errors only mean "not yet"
+		if status, err := p.replSetStatus(ctx); err == nil && done(status) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *PlugMongoDB) replSetStatus(ctx context.Context) (*replSetStatus, error) {
+	status, err := RunCommandTyped[replSetStatus](ctx, p, "admin", bson.D{{Key: "replSetGetStatus", Value: 1}})
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (o RollingIndexOptions) rejoinTimeout() time.Duration {
+	if o.RejoinTimeout > 0 {
+		return o.RejoinTimeout
+	}
+	return defaultRollingRejoinTimeout
+}
+
+// claimRollingBuild loads or plans the build of names on ns and reserves it to this instance
+func (p *PlugMongoDB) claimRollingBuild(ctx context.Context, ns string, names []string) (*RollingIndexBuild, error) {
+	id := rollingBuildID(ns, names)
+	owner := rollingOwner()
+	var build *RollingIndexBuild
+	op := operation{name: "findAndModify", database: p.databaseName(""), collection: p.indexCoordinationCollection()}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		filter := bson.D{
+			{Key: "_id", Value: id},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "owner", Value: ""}},
+				bson.D{{Key: "owner", Value: owner}},
+				bson.D{{Key: "lease_until", Value: bson.D{{Key: "$lt", Value: now}}}},
+			}},
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "owner", Value: owner},
+			{Key: "lease_until", Value: now.Add(rollingLease)},
+			{Key: "updated_at", Value: now},
+		}}}
+		var claimed RollingIndexBuild
+		err = coll.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&claimed)
+		if err == nil {
+			build = &claimed
+			return nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+
+		// Unknown build (or one held by another instance): plan it from the current members
+		status, err := p.replSetStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("rolling index builds require a replica set: %w", err)
+		}
+		planned := &RollingIndexBuild{
+			ID: id, Namespace: ns, Indexes: names, State: RollingPending, Members: status.plan(),
+			Owner: owner, LeaseUntil: now.Add(rollingLease), CreatedAt: now, UpdatedAt: now,
+		}
+		if _, err = coll.InsertOne(ctx, planned); err == nil {
+			build = planned
+			return nil
+		}
+		if !isDuplicateKeyCode(errorCode(err)) {
+			return err
+		}
+		var held RollingIndexBuild
+		if err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&held); err != nil {
+			return err
+		}
+		if held.Owner == owner {
+			// Our own insert, retried after a transient error
+			build = &held
+			return nil
+		}
+		return &RollingBuildClaimedError{ID: id, Owner: held.Owner, LeaseUntil: held.LeaseUntil}
+	})
+	return build, err
+}
+
+// saveRollingBuild stores build, failing when this instance lost its lease
+func (p *PlugMongoDB) saveRollingBuild(ctx context.Context, build *RollingIndexBuild) error {
+	now := time.Now().UTC()
+	build.UpdatedAt = now
+	if build.Owner != "" {
+		build.LeaseUntil = now.Add(rollingLease)
+	}
+	op := operation{name: "replace", database: p.databaseName(""), collection: p.indexCoordinationCollection()}
+	return p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		res, err := coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: build.ID}, {Key: "owner", Value: rollingOwner()}}, build)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return fmt.Errorf("rolling index build %s: lease lost to another instance", build.ID)
+		}
+		return nil
+	})
+}
+
+// releaseRollingBuild stores the final state of build and gives up the lease
+func (p *PlugMongoDB) releaseRollingBuild(ctx context.Context, build *RollingIndexBuild) error {
+	build.Owner, build.LeaseUntil = "", time.Time{}
+	op := operation{name: "replace", database: p.databaseName(""), collection: p.indexCoordinationCollection()}
+	build.UpdatedAt = time.Now().UTC()
+	return p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, op.collection)
+		if err != nil {
+			return err
+		}
+		_, err = coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: build.ID}, {Key: "owner", Value: rollingOwner()}}, build)
+		return err
+	})
+}
+
+// keepRollingLease renews the lease of build id while the build runs
+func (p *PlugMongoDB) keepRollingLease(ctx context.Context, id string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(rollingLease / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			op := operation{name: "update", database: p.databaseName(""), collection: p.indexCoordinationCollection()}
+			err := p.runOperation(ctx, op, func(ctx context.Context) error {
+				coll, err := p.collectionHandle(ctx, op.collection)
+				if err != nil {
+					return err
+				}
+				_, err = coll.UpdateOne(ctx,
+					bson.D{{Key: "_id", Value: id}, {Key: "owner", Value: rollingOwner()}},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "lease_until", Value: time.Now().UTC().Add(rollingLease)}}}})
+				return err
+			})
+			if err != nil && ctx.Err() == nil {
+				log.WarnwCtx(ctx, "key", "mongodb", "event", "rolling_index_lease_renewal_failed", "build", id, "error", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (p *PlugMongoDB) indexCoordinationCollection() string {
+	if name := p.config().GetIndexCoordinationCollection(); name != "" {
+		return name
+	}
+	return defaultIndexCoordinationCollection
+}
+
+// rollingSpecs checks that specs target one collection and returns it with the index names
+func rollingSpecs(specs []IndexSpec) (string, []string, error) {
+	if len(specs) == 0 {
+		return "", nil, fmt.Errorf("rolling index build requires index specs")
+	}
+	collection := specs[0].Collection
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Collection == "" || len(spec.Keys) == 0 {
+			return "", nil, fmt.Errorf("index spec needs a collection and keys")
+		}
+		if spec.Collection != collection {
+			return "", nil, fmt.Errorf("rolling index build covers one collection, got %s and %s", collection, spec.Collection)
+		}
+		names = append(names, spec.displayName())
+	}
+	sort.Strings(names)
+	return collection, names, nil
+}
+
+// rollingBuildID derives the build id from the namespace and index names
+func rollingBuildID(ns string, names []string) string {
+	sum := sha256.Sum256([]byte(ns + "\x00" + strings.Join(names, "\x00")))
+	return ns + ":" + hex.EncodeToString(sum[:6])
+}
+
+// plan orders the data-bearing members: secondaries by name, then the primary
+func (s *replSetStatus) plan() []RollingMember {
+	var members []RollingMember
+	var primary *RollingMember
+	for _, m := range s.Members {
+		switch m.StateStr {
+		case "ARBITER":
+			continue
+		case "PRIMARY":
+			primary = &RollingMember{Host: m.Name, Primary: true, State: RollingPending}
+			continue
+		}
+		members = append(members, RollingMember{Host: m.Name, State: RollingPending})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Host < members[j].Host })
+	if primary != nil {
+		members = append(members, *primary)
+	}
+	return members
+}
+
+func (s *replSetStatus) member(host string) (replSetMember, bool) {
+	for _, m := range s.Members {
+		if m.Name == host {
+			return m, true
+		}
+	}
+	return replSetMember{}, false
+}
+
+func (s *replSetStatus) primary() *replSetMember {
+	for i := range s.Members {
+		if s.Members[i].StateStr == "PRIMARY" {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// othersHealthy refuses to take host out while another data-bearing member is down or recovering
+func (s *replSetStatus) othersHealthy(host string) error {
+	if _, ok := s.member(host); !ok {
+		return fmt.Errorf("member %s is not part of the replica set", host)
+	}
+	for _, m := range s.Members {
+		if m.Name == host || m.StateStr == "ARBITER" {
+			continue
+		}
+		if m.Health != 1 || (m.StateStr != "PRIMARY" && m.StateStr != "SECONDARY") {
+			return fmt.Errorf("not taking %s out: member %s is %s", host, m.Name, strings.ToLower(m.StateStr))
+		}
+	}
+	return nil
+}
+
+// caughtUp reports whether host is a healthy secondary at most maxLag behind the primary
+func (s *replSetStatus) caughtUp(host string, maxLag time.Duration) bool {
+	m, ok := s.member(host)
+	if !ok || m.Health != 1 || m.StateStr != "SECONDARY" {
+		return false
+	}
+	primary := s.primary()
+	return primary != nil && primary.OptimeDate.Sub(m.OptimeDate) <= maxLag
+}
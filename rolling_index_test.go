@@ -0,0 +1,123 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func testReplSetStatus() *replSetStatus {
+	now := time.Now()
+	return &replSetStatus{Members: []replSetMember{
+		{Name: "db-1:27017", Health: 1, StateStr: "PRIMARY", OptimeDate: now},
+		{Name: "db-3:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now.Add(-2 * time.Second)},
+		{Name: "db-2:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now.Add(-time.Minute)},
+		{Name: "arb:27017", Health: 1, StateStr: "ARBITER"},
+	}}
+}
+
+func TestRollingPlan(t *testing.T) {
+	plan := testReplSetStatus().plan()
+	want := []string{"db-2:27017", "db-3:27017", "db-1:27017"}
+	if len(plan) != len(want) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	for i, host := range want {
+		if plan[i].Host != host || plan[i].State != RollingPending {
+			t.Errorf("plan[%d] = %+v, want %s", i, plan[i], host)
+		}
+	}
+	if !plan[2].Primary || plan[0].Primary {
+		t.Error("the primary must be built last")
+	}
+}
+
+func TestRollingMemberHealth(t *testing.T) {
+	status := testReplSetStatus()
+	if err := status.othersHealthy("db-2:27017"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := status.othersHealthy("db-9:27017"); err == nil {
+		t.Error("expected an error for an unknown member")
+	}
+	status.Members[1].StateStr = "RECOVERING"
+	if err := status.othersHealthy("db-2:27017"); err == nil {
+		t.Error("a member must not be taken out while another one is recovering")
+	}
+
+	status = testReplSetStatus()
+	if !status.caughtUp("db-3:27017", 10*time.Second) {
+		t.Error("expected db-3 to be caught up")
+	}
+	if status.caughtUp("db-2:27017", 10*time.Second) {
+		t.Error("db-2 lags a minute behind")
+	}
+	if status.caughtUp("db-1:27017", time.Minute) {
+		t.Error("the primary is not a rejoined secondary")
+	}
+}
+
+func TestRollingSpecs(t *testing.T) {
+	a := IndexSpec{Collection: "orders", Name: "sku_1", Keys: bson.D{{Key: "sku", Value: 1}}}
+	b := IndexSpec{Collection: "orders", Keys: bson.D{{Key: "created_at", Value: -1}}}
+	coll, names, err := rollingSpecs([]IndexSpec{a, b})
+	if err != nil || coll != "orders" || len(names) != 2 {
+		t.Fatalf("unexpected result %s %v %v", coll, names, err)
+	}
+	_, reversed, _ := rollingSpecs([]IndexSpec{b, a})
+	if rollingBuildID("test.orders", names) != rollingBuildID("test.orders", reversed) {
+		t.Error("the build id must not depend on the spec order")
+	}
+	if rollingBuildID("test.orders", names) == rollingBuildID("test.users", names) {
+		t.Error("builds on different namespaces must have different ids")
+	}
+	for _, specs := range [][]IndexSpec{nil, {a, {Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}}}, {{Collection: "orders"}}} {
+		if _, _, err := rollingSpecs(specs); err == nil {
+			t.Errorf("expected an error for %+v", specs)
+		}
+	}
+}
+
+func TestRollingIndexBuildErrors(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OperationTimeout: durationpb.New(100 * time.Millisecond)})
+	spec := IndexSpec{Collection: "orders", Keys: bson.D{{Key: "sku", Value: 1}}}
+	if _, err := p.RollingIndexBuild(t.Context(), RollingIndexOptions{}, spec); err == nil {
+		t.Error("expected an error without builder")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	called := false
+	builder := MemberIndexBuilderFunc(func(context.Context, RollingMember, string, []IndexSpec) error {
+		called = true
+		return nil
+	})
+	if _, err := p.RollingIndexBuild(t.Context(), RollingIndexOptions{Builder: builder}, spec); err == nil {
+		t.Error("expected an error from an unreachable server")
+	}
+	if called {
+		t.Error("no member may be built without a claimed build")
+	}
+
+	p.config().DdlWindow = closedWindow()
+	var deferred *DDLDeferredError
+	if _, err := p.RollingIndexBuild(t.Context(), RollingIndexOptions{Builder: builder}, spec); !errors.As(err, &deferred) {
+		t.Errorf("expected the build to wait for the DDL window, got %v", err)
+	}
+	if p.indexCoordinationCollection() != defaultIndexCoordinationCollection {
+		t.Errorf("unexpected coordination collection %s", p.indexCoordinationCollection())
+	}
+}
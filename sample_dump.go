@@ -0,0 +1,171 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sampleDumpFormat identifies sample dumps in their header document
+const sampleDumpFormat = "lynx-mongodb-sample/v1"
+
+// DumpOptions configures DumpCollectionSample
+type DumpOptions struct {
+	// Database defaults to the configured database
+	Database string
+	// Anonymize transforms sensitive fields before they are written
+	Anonymize Anonymizer
+	// Timeout overrides the operation timeout
+	Timeout time.Duration
+}
+
+// SampleHeader is the first document of a sample dump
+type SampleHeader struct {
+	Format     string     `bson:"format"`
+	Namespace  string     `bson:"namespace"`
+	Requested  int64      `bson:"requested"`
+	CreatedAt  time.Time  `bson:"createdAt"`
+	Anonymized []string   `bson:"anonymized,omitempty"`
+	Indexes    []bson.Raw `bson:"indexes"`
+}
+
+// SampleDump is a decoded sample dump
+type SampleDump struct {
+	Header    SampleHeader
+	Documents []bson.Raw
+}
+
+// DumpCollectionSample writes a zstd-compressed sample of up to n random documents of collection,
+// preceded by a header with the index definitions, to w. The stream is a sequence of BSON documents
+// (header first) that ReadCollectionSample decodes; it is meant for bug reports that need
+// reproducible data shapes, not for backups. It returns the number of documents written.
+func (p *PlugMongoDB) DumpCollectionSample(ctx context.Context, collection string, n int64, w io.Writer, opts *DumpOptions) (int64, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("collection name cannot be empty")
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("sample size must be positive")
+	}
+	if w == nil {
+		return 0, fmt.Errorf("writer cannot be nil")
+	}
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+
+	var written int64
+	// A retry would write a second header and zstd frame to w
+	ctx = WithIdempotency(ctx, NonIdempotent)
+	op := operation{name: "aggregate", database: p.databaseName(opts.Database), collection: collection, timeout: opts.Timeout}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, opts.Database)
+		if err != nil {
+			return err
+		}
+		coll := db.Collection(collection)
+		indexes, err := listIndexDocuments(ctx, coll)
+		if err != nil {
+			return err
+		}
+		header := SampleHeader{
+			Format:    sampleDumpFormat,
+			Namespace: op.namespace(),
+			Requested: n,
+			CreatedAt: time.Now().UTC(),
+			Indexes:   indexes,
+		}
+		for path := range opts.Anonymize {
+			header.Anonymized = append(header.Anonymized, path)
+		}
+		sort.Strings(header.Anonymized)
+
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		written, err = writeSample(ctx, enc, coll, header, opts.Anonymize)
+		if err != nil {
+			enc.Close()
+			return err
+		}
+		return enc.Close()
+	})
+	return written, err
+}
+
+// ReadCollectionSample decodes a dump written by DumpCollectionSample
+func ReadCollectionSample(r io.Reader) (*SampleDump, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	dump := &SampleDump{}
+	first := true
+	for {
+		doc, err := bson.ReadDocument(dec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sample document: %w", err)
+		}
+		if first {
+			if err := bson.Unmarshal(doc, &dump.Header); err != nil {
+				return nil, fmt.Errorf("failed to decode sample header: %w", err)
+			}
+			if dump.Header.Format != sampleDumpFormat {
+				return nil, fmt.Errorf("unsupported sample format %q", dump.Header.Format)
+			}
+			first = false
+			continue
+		}
+		dump.Documents = append(dump.Documents, doc)
+	}
+	if first {
+		return nil, fmt.Errorf("sample dump is empty")
+	}
+	return dump, nil
+}
+
+// writeSample writes the header and the sampled documents to enc
+func writeSample(ctx context.Context, enc io.Writer, coll *mongo.Collection, header SampleHeader, anonymize Anonymizer) (int64, error) {
+	if err := writeBSON(enc, header); err != nil {
+		return 0, err
+	}
+	sample := mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: header.Requested}}}}}
+	cursor, err := coll.Aggregate(ctx, sample, commentAggregateOptions(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var written int64
+	for cursor.Next(ctx) {
+		doc, err := anonymize.Apply(cursor.Current)
+		if err != nil {
+			return written, err
+		}
+		if _, err := enc.Write(doc); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, cursor.Err()
+}
+
+func writeBSON(w io.Writer, v any) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
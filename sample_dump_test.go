@@ -0,0 +1,44 @@
+package mongodb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReadCollectionSample(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := SampleHeader{Format: sampleDumpFormat, Namespace: "app.users", Requested: 2}
+	if err := writeBSON(enc, header); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := writeBSON(enc, bson.D{{Key: "name", Value: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := ReadCollectionSample(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dump.Header.Namespace != "app.users" || len(dump.Documents) != 2 {
+		t.Fatalf("unexpected dump: %+v", dump)
+	}
+	if dump.Documents[1].Lookup("name").StringValue() != "b" {
+		t.Errorf("unexpected document %s", dump.Documents[1])
+	}
+
+	if _, err := ReadCollectionSample(bytes.NewReader(nil)); err == nil {
+		t.Error("expected empty dump to be rejected")
+	}
+}
@@ -0,0 +1,221 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Field violation reasons
+const (
+	// ViolationUnknownField is a document field without a model field
+	ViolationUnknownField = "unknown_field"
+	// ViolationTypeMismatch is a field whose value does not decode into the model field type
+	ViolationTypeMismatch = "type_mismatch"
+	// ViolationMissingField is a required field absent from the document
+	ViolationMissingField = "missing_field"
+	// ViolationInvalidValue is a field rejected by a validator
+	ViolationInvalidValue = "invalid_value"
+)
+
+// FieldViolation describes a document field that does not match its registered schema
+type FieldViolation struct {
+	// Field is the top-level (or validator-reported dotted) field name
+	Field string
+	// Reason is one of the Violation* field reasons
+	Reason string
+	// Detail explains the violation, without the field value
+	Detail string
+}
+
+func (v FieldViolation) String() string {
+	if v.Detail == "" {
+		return v.Field + ": " + v.Reason
+	}
+	return v.Field + ": " + v.Reason + " (" + v.Detail + ")"
+}
+
+// Validator checks a raw document beyond its structural match with the model
+type Validator func(doc bson.Raw) []FieldViolation
+
+// RequiredFields reports fields (dotted paths allowed) missing from the document or null
+func RequiredFields(fields ...string) Validator {
+	return func(doc bson.Raw) []FieldViolation {
+		var violations []FieldViolation
+		for _, field := range fields {
+			v, err := doc.LookupErr(strings.Split(field, ".")...)
+			if err != nil || v.Type == bson.TypeNull {
+				violations = append(violations, FieldViolation{Field: field, Reason: ViolationMissingField})
+			}
+		}
+		return violations
+	}
+}
+
+// ValidateField runs check on a field when present (dotted paths allowed)
+func ValidateField(field string, check func(bson.RawValue) error) Validator {
+	return func(doc bson.Raw) []FieldViolation {
+		v, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			return nil
+		}
+		if err := check(v); err != nil {
+			return []FieldViolation{{Field: field, Reason: ViolationInvalidValue, Detail: err.Error()}}
+		}
+		return nil
+	}
+}
+
+// collectionSchema is the registered model and validators of a collection
+type collectionSchema struct {
+	collection string
+	model      reflect.Type
+	validators []Validator
+	// Registry metadata set by RegisterCollection
+	owner       string
+	contact     string
+	description string
+	tags        []string
+	sensitivity string
+	fields      map[string]FieldMeta
+	scopeFields []string
+	indexes     []IndexSpec
+	jsonSchema  bson.M
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[string]*collectionSchema{}
+)
+
+// RegisterSchema registers T as the model of collection, with optional validators. Registered
+// schemas are used by the data quality checker and ValidateDocument. Registering a collection
+// again replaces its schema.
+func RegisterSchema[T any](collection string, validators ...Validator) {
+	model := indirectType(reflect.TypeOf((*T)(nil)).Elem())
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[collection] = &collectionSchema{collection: collection, model: model, validators: validators}
+}
+
+// lookupSchema returns the schema registered for collection, or nil
+func lookupSchema(collection string) *collectionSchema {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	return schemas[collection]
+}
+
+// registeredSchemas returns all registered schemas ordered by collection
+func registeredSchemas() []*collectionSchema {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	out := make([]*collectionSchema, 0, len(schemas))
+	for _, s := range schemas {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].collection < out[j].collection })
+	return out
+}
+
+// ValidateDocument checks doc against the schema registered for collection
+func (p *PlugMongoDB) ValidateDocument(collection string, doc bson.Raw) ([]FieldViolation, error) {
+	schema := lookupSchema(collection)
+	if schema == nil {
+		return nil, fmt.Errorf("no schema registered for collection %s", collection)
+	}
+	return p.validateAgainst(schema, doc), nil
+}
+
+// validateAgainst runs the structural check and the validators of schema on doc
+func (p *PlugMongoDB) validateAgainst(schema *collectionSchema, doc bson.Raw) []FieldViolation {
+	violations := p.checkDocument(schema.model, doc)
+	for _, validate := range schema.validators {
+		violations = append(violations, validate(doc)...)
+	}
+	return violations
+}
+
+// checkDocument reports top-level fields of doc that the model struct does not declare, or whose
+// values do not decode into the declared field type with the client registry
+func (p *PlugMongoDB) checkDocument(model reflect.Type, doc bson.Raw) []FieldViolation {
+	model = indirectType(model)
+	if model.Kind() != reflect.Struct {
+		return nil
+	}
+	byName := make(map[string]bsonField)
+	for _, f := range structBSONFields(model) {
+		byName[f.name] = f
+	}
+	allowUnknown := hasInlineMap(model)
+
+	elems, err := doc.Elements()
+	if err != nil {
+		return []FieldViolation{{Field: "", Reason: ViolationTypeMismatch, Detail: err.Error()}}
+	}
+	var violations []FieldViolation
+	for _, elem := range elems {
+		key := elem.Key()
+		f, ok := byName[key]
+		if !ok {
+			if !allowUnknown && key != "_id" {
+				violations = append(violations, FieldViolation{Field: key, Reason: ViolationUnknownField})
+			}
+			continue
+		}
+		target := reflect.New(f.typ)
+		if err := p.decodeValue(elem.Value(), target.Interface()); err != nil {
+			violations = append(violations, FieldViolation{
+				Field:  key,
+				Reason: ViolationTypeMismatch,
+				Detail: fmt.Sprintf("%s into %s", elem.Value().Type, f.typ),
+			})
+		}
+	}
+	return violations
+}
+
+// violationFieldOther is the metric label of violations of fields the model does not declare
+const violationFieldOther = "other"
+
+// violationMetricField returns the metric label of a violation of field on model: the field when
+// model declares it (its first segment, for dotted validator paths), violationFieldOther otherwise,
+// so document contents cannot grow the label set. Whole-document violations keep the empty field.
+func violationMetricField(model reflect.Type, field string) string {
+	if field == "" {
+		return ""
+	}
+	model = indirectType(model)
+	if model.Kind() == reflect.Struct {
+		top, _, _ := strings.Cut(field, ".")
+		for _, f := range structBSONFields(model) {
+			if f.name == top {
+				return field
+			}
+		}
+	}
+	return violationFieldOther
+}
+
+// decodeValue decodes a single value with the client registry
+func (p *PlugMongoDB) decodeValue(v bson.RawValue, out any) error {
+	if p.registry != nil {
+		return v.UnmarshalWithRegistry(p.registry, out)
+	}
+	return v.Unmarshal(out)
+}
+
+// hasInlineMap reports whether struct t collects unknown fields in an inline map
+func hasInlineMap(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		_, flags, _ := strings.Cut(sf.Tag.Get("bson"), ",")
+		if strings.Contains(","+flags+",", ",inline,") && indirectType(sf.Type).Kind() == reflect.Map {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,454 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Schema provisioning modes
+const (
+	// SchemaProvisionOff leaves registered collections untouched at startup
+	SchemaProvisionOff = "off"
+	// SchemaProvisionCheck reports drift between the registry and the server at startup
+	SchemaProvisionCheck = "check"
+	// SchemaProvisionApply creates missing collections, validators and indexes, then reports drift
+	SchemaProvisionApply = "apply"
+)
+
+// Schema drift kinds
+const (
+	// DriftMissingCollection is a registered collection absent from the server
+	DriftMissingCollection = "missing_collection"
+	// DriftMissingIndex is a registered index absent from the collection
+	DriftMissingIndex = "missing_index"
+	// DriftIndexOptions is an index whose unique, sparse or TTL options differ from its registration
+	DriftIndexOptions = "index_options"
+	// DriftUnexpectedIndex is an index of the collection that is not registered
+	DriftUnexpectedIndex = "unexpected_index"
+	// DriftValidator is a server-side validator that differs from its registration
+	DriftValidator = "validator"
+)
+
+// CollectionDef declares a collection in the schema registry
+type CollectionDef struct {
+	// Owner names the registering package or team, documented in the inventory
+	Owner string
+	// Contact is how to reach the owner (channel, email), documented in the catalog
+	Contact string
+	// Description documents the purpose of the collection
+	Description string
+	// Tags classify the collection in the catalog (e.g. "billing", "gdpr")
+	Tags []string
+	// Sensitivity is the default level of fields without annotation (default internal)
+	Sensitivity string
+	// Fields annotates fields by BSON path (dotted for nested fields), see ExportCatalog
+	Fields map[string]FieldMeta
+	// ScopeFields are merged into every helper filter on the collection from the context scope
+	// (see WithScope); calls without those scope values fail unless the context is Unscoped
+	ScopeFields []string
+	// Indexes of the collection; their Collection field may be left empty
+	Indexes []IndexSpec
+	// Validators check documents client-side (data quality checker, ValidateDocument)
+	Validators []Validator
+	// JSONSchema is the server-side $jsonSchema validator set when provisioning
+	JSONSchema bson.M
+}
+
+// SchemaDrift is a difference between a registered collection and the server
+type SchemaDrift struct {
+	Collection string `json:"collection"`
+	// Kind is one of the Drift* kinds
+	Kind string `json:"kind"`
+	// Index is the index name or key pattern for index drift
+	Index  string `json:"index,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (d SchemaDrift) String() string {
+	s := d.Collection + ": " + d.Kind
+	if d.Index != "" {
+		s += " " + d.Index
+	}
+	if d.Detail != "" {
+		s += " (" + d.Detail + ")"
+	}
+	return s
+}
+
+// CollectionInventory documents a registered collection
+type CollectionInventory struct {
+	Collection  string `json:"collection"`
+	Model       string `json:"model"`
+	Owner       string `json:"owner,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Indexes lists the registered index names (key patterns for unnamed indexes)
+	Indexes    []string `json:"indexes,omitempty"`
+	Validators int      `json:"validators"`
+	// ServerValidator reports a registered $jsonSchema validator
+	ServerValidator bool `json:"server_validator"`
+	// Drift is the result of the last drift check, when one ran
+	Drift []SchemaDrift `json:"drift,omitempty"`
+}
+
+// schemaDriftState keeps the last drift check result per collection
+type schemaDriftState struct {
+	mu     sync.Mutex
+	byColl map[string][]SchemaDrift
+}
+
+// RegisterCollection registers T as the model of collection together with its indexes and
+// validators. Application packages register their collections from init functions; the plugin
+// provisions them at startup (schema_provisioning), detects drift and lists them in
+// SchemaInventory. Registering a collection again replaces its definition.
+func RegisterCollection[T any](collection string, def CollectionDef) {
+	model := indirectType(reflect.TypeOf((*T)(nil)).Elem())
+	indexes := make([]IndexSpec, len(def.Indexes))
+	for i, spec := range def.Indexes {
+		spec.Collection = collection
+		indexes[i] = spec
+	}
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[collection] = &collectionSchema{
+		collection:  collection,
+		model:       model,
+		validators:  def.Validators,
+		owner:       def.Owner,
+		contact:     def.Contact,
+		description: def.Description,
+		tags:        def.Tags,
+		sensitivity: def.Sensitivity,
+		fields:      def.Fields,
+		scopeFields: def.ScopeFields,
+		indexes:     indexes,
+		jsonSchema:  def.JSONSchema,
+	}
+}
+
+// SchemaInventory lists the registered collections ordered by name, with the result of the last
+// drift check. It does not contact the server.
+func (p *PlugMongoDB) SchemaInventory() []CollectionInventory {
+	p.schemaDrift.mu.Lock()
+	defer p.schemaDrift.mu.Unlock()
+	registered := registeredSchemas()
+	out := make([]CollectionInventory, 0, len(registered))
+	for _, s := range registered {
+		inv := CollectionInventory{
+			Collection:      s.collection,
+			Model:           s.model.String(),
+			Owner:           s.owner,
+			Description:     s.description,
+			Validators:      len(s.validators),
+			ServerValidator: s.jsonSchema != nil,
+			Drift:           p.schemaDrift.byColl[s.collection],
+		}
+		for _, spec := range s.indexes {
+			inv.Indexes = append(inv.Indexes, spec.displayName())
+		}
+		out = append(out, inv)
+	}
+	return out
+}
+
+// ProvisionSchemas creates the registered collections that do not exist (with their $jsonSchema
+// validator), updates validators of existing ones and ensures the registered indexes. Existing
+// indexes are never dropped. Index builds and validator changes outside the DDL window are queued
+// (see PendingDDL) rather than failing provisioning.
+func (p *PlugMongoDB) ProvisionSchemas(ctx context.Context) error {
+	var deferred *DDLDeferredError
+	for _, s := range registeredSchemas() {
+		// createIndexes creates missing collections, so only validators and bare collections need a lookup
+		if s.jsonSchema != nil || len(s.indexes) == 0 {
+			if err := p.provisionCollection(ctx, s); err != nil && !errors.As(err, &deferred) {
+				return err
+			}
+		}
+		if len(s.indexes) > 0 {
+			if _, err := p.EnsureIndexes(ctx, s.indexes...); err != nil && !errors.As(err, &deferred) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// provisionCollection creates the collection with its validator, or sets the validator with collMod
+// when the stored one differs
+func (p *PlugMongoDB) provisionCollection(ctx context.Context, s *collectionSchema) error {
+	var opts bson.Raw
+	op := operation{name: "listCollections", database: p.databaseName(""), collection: s.collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		opts, err = collectionOptions(ctx, db, s.collection)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		return p.createRegisteredCollection(ctx, s)
+	}
+	if s.jsonSchema == nil || validatorMatches(s.jsonSchema, opts) {
+		return nil
+	}
+	return p.RunDDL(ctx, DDLCollMod, op.namespace(), func(ctx context.Context) error {
+		cmd := bson.D{{Key: "collMod", Value: s.collection}, {Key: "validator", Value: bson.M{"$jsonSchema": s.jsonSchema}}}
+		_, err := p.RunCommand(ctx, "", cmd)
+		p.audit(ctx, AuditEvent{Action: "collMod", Namespace: op.namespace(), Details: map[string]any{"validator": "$jsonSchema", "source": "schema_registry"}, Err: err})
+		return err
+	})
+}
+
+func (p *PlugMongoDB) createRegisteredCollection(ctx context.Context, s *collectionSchema) error {
+	createOpts := options.CreateCollection()
+	if s.jsonSchema != nil {
+		createOpts.SetValidator(bson.M{"$jsonSchema": s.jsonSchema})
+	}
+	op := operation{name: "create", database: p.databaseName(""), collection: s.collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		return db.CreateCollection(ctx, s.collection, createOpts)
+	})
+	p.audit(ctx, AuditEvent{Action: "create", Namespace: op.namespace(), Details: map[string]any{"source": "schema_registry"}, Err: err})
+	return err
+}
+
+// SchemaDrift compares the registered collections with the server: missing collections, missing,
+// modified or unregistered indexes (for collections registering indexes) and differing validators.
+// The result is kept for SchemaInventory.
+func (p *PlugMongoDB) SchemaDrift(ctx context.Context) ([]SchemaDrift, error) {
+	var drift []SchemaDrift
+	byColl := make(map[string][]SchemaDrift)
+	op := operation{name: "listCollections", database: p.databaseName("")}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, "")
+		if err != nil {
+			return err
+		}
+		for _, s := range registeredSchemas() {
+			opts, err := collectionOptions(ctx, db, s.collection)
+			if err != nil {
+				return err
+			}
+			var found []SchemaDrift
+			if opts == nil {
+				found = []SchemaDrift{{Collection: s.collection, Kind: DriftMissingCollection}}
+			} else {
+				if s.jsonSchema != nil && !validatorMatches(s.jsonSchema, opts) {
+					found = append(found, SchemaDrift{Collection: s.collection, Kind: DriftValidator, Detail: "$jsonSchema differs from the registered one"})
+				}
+				if len(s.indexes) > 0 {
+					existing, err := listIndexDocuments(ctx, db.Collection(s.collection))
+					if err != nil {
+						return err
+					}
+					found = append(found, indexDrift(s.collection, s.indexes, existing)...)
+				}
+			}
+			if len(found) > 0 {
+				byColl[s.collection] = found
+				drift = append(drift, found...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.schemaDrift.mu.Lock()
+	p.schemaDrift.byColl = byColl
+	p.schemaDrift.mu.Unlock()
+	return drift, nil
+}
+
+// provisionSchemas runs the configured schema_provisioning mode at startup. Failures and drift are
+// logged; they do not prevent the plugin from starting.
+func (p *PlugMongoDB) provisionSchemas(ctx context.Context) {
+	mode := p.config().GetSchemaProvisioning()
+	if mode == "" || mode == SchemaProvisionOff || len(registeredSchemas()) == 0 {
+		return
+	}
+	start := time.Now()
+	if mode == SchemaProvisionApply {
+		if err := p.ProvisionSchemas(ctx); err != nil {
+			log.WarnwCtx(ctx, "key", "mongodb", "event", "schema_provisioning_failed", "error", err)
+		}
+	}
+	drift, err := p.SchemaDrift(ctx)
+	if err != nil {
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "schema_drift_check_failed", "error", err)
+		return
+	}
+	for _, d := range drift {
+		log.WarnwCtx(ctx, "key", "mongodb", "event", "schema_drift", "collection", d.Collection, "kind", d.Kind, "index", d.Index, "detail", d.Detail)
+	}
+	log.InfowCtx(ctx, "key", "mongodb", "event", "schemas_checked", "mode", mode,
+		"collections", len(registeredSchemas()), "drift", len(drift), "duration", time.Since(start))
+}
+
+// indexDrift compares the registered indexes of a collection with its index definitions.
+// Indexes are matched by key pattern, so renamed indexes are not reported.
+func indexDrift(collection string, specs []IndexSpec, existing []bson.Raw) []SchemaDrift {
+	byPattern := make(map[string]bson.Raw, len(existing))
+	for _, idx := range existing {
+		byPattern[keyPattern(idx.Lookup("key").Document())] = idx
+	}
+	var drift []SchemaDrift
+	registered := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		pattern := spec.keyPattern()
+		registered[pattern] = true
+		idx, ok := byPattern[pattern]
+		if !ok {
+			drift = append(drift, SchemaDrift{Collection: collection, Kind: DriftMissingIndex, Index: spec.displayName()})
+			continue
+		}
+		if detail := indexOptionsDiff(spec, idx); detail != "" {
+			drift = append(drift, SchemaDrift{Collection: collection, Kind: DriftIndexOptions, Index: spec.displayName(), Detail: detail})
+		}
+	}
+	for _, idx := range existing {
+		name, _ := idx.Lookup("name").StringValueOK()
+		if name == "_id_" || registered[keyPattern(idx.Lookup("key").Document())] {
+			continue
+		}
+		drift = append(drift, SchemaDrift{Collection: collection, Kind: DriftUnexpectedIndex, Index: name})
+	}
+	return drift
+}
+
+// indexOptionsDiff describes the unique, sparse and TTL differences between spec and idx
+func indexOptionsDiff(spec IndexSpec, idx bson.Raw) string {
+	var diffs []string
+	unique, _ := idx.Lookup("unique").BooleanOK()
+	if unique != spec.Unique {
+		diffs = append(diffs, fmt.Sprintf("unique %v, registered %v", unique, spec.Unique))
+	}
+	sparse, _ := idx.Lookup("sparse").BooleanOK()
+	if sparse != spec.Sparse {
+		diffs = append(diffs, fmt.Sprintf("sparse %v, registered %v", sparse, spec.Sparse))
+	}
+	ttl, _ := idx.Lookup("expireAfterSeconds").AsInt64OK()
+	if want := int64(spec.TTL / time.Second); ttl != want {
+		diffs = append(diffs, fmt.Sprintf("expireAfterSeconds %d, registered %d", ttl, want))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// keyPattern renders an index key document like the server derives index names ("a_1_b_-1")
+func keyPattern(keys bson.Raw) string {
+	elems, _ := keys.Elements()
+	parts := make([]string, 0, 2*len(elems))
+	for _, e := range elems {
+		parts = append(parts, e.Key(), keyValue(e.Value()))
+	}
+	return strings.Join(parts, "_")
+}
+
+func keyValue(v bson.RawValue) string {
+	if s, ok := v.StringValueOK(); ok {
+		return s
+	}
+	if f, ok := v.DoubleOK(); ok && f == math.Trunc(f) {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	if i, ok := v.AsInt64OK(); ok {
+		return strconv.FormatInt(i, 10)
+	}
+	return v.String()
+}
+
+// keyPattern renders the spec keys as the server stores them: text fields are replaced by the
+// _fts/_ftsx pair at the position of the first text field
+func (s IndexSpec) keyPattern() string {
+	keys := bson.D{}
+	text := false
+	for _, e := range s.Keys {
+		if v, ok := e.Value.(string); ok && v == "text" {
+			if !text {
+				keys = append(keys, bson.E{Key: "_fts", Value: "text"}, bson.E{Key: "_ftsx", Value: 1})
+				text = true
+			}
+			continue
+		}
+		keys = append(keys, e)
+	}
+	raw, err := bson.Marshal(keys)
+	if err != nil {
+		return fmt.Sprint(s.Keys)
+	}
+	return keyPattern(raw)
+}
+
+// displayName returns the index name, or its key pattern when unnamed
+func (s IndexSpec) displayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.keyPattern()
+}
+
+// validatorMatches reports whether the listCollections options carry jsonSchema as validator.
+// Both sides are compared after a BSON round trip, so numeric types and key order do not matter.
+func validatorMatches(jsonSchema bson.M, opts bson.Raw) bool {
+	stored, err := opts.LookupErr("validator", "$jsonSchema")
+	if err != nil {
+		return false
+	}
+	var have bson.M
+	if err := stored.Unmarshal(&have); err != nil {
+		return false
+	}
+	raw, err := bson.Marshal(jsonSchema)
+	if err != nil {
+		return false
+	}
+	var want bson.M
+	if err := bson.Unmarshal(raw, &want); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeNumbers(want), normalizeNumbers(have))
+}
+
+// normalizeNumbers converts integral numbers to int64, since the server may store
+// an int32 bound as a double or int64
+func normalizeNumbers(v any) any {
+	switch t := v.(type) {
+	case bson.M:
+		out := make(bson.M, len(t))
+		for k, e := range t {
+			out[k] = normalizeNumbers(e)
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(t))
+		for i, e := range t {
+			out[i] = normalizeNumbers(e)
+		}
+		return out
+	case int32:
+		return int64(t)
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return int64(t)
+		}
+	}
+	return v
+}
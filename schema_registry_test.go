@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func indexDoc(t *testing.T, d bson.D) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestIndexDrift(t *testing.T) {
+	specs := []IndexSpec{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		{Name: "by_created", Keys: bson.D{{Key: "created_at", Value: -1}}, TTL: time.Hour},
+		{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}},
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "status", Value: 1}}},
+	}
+	existing := []bson.Raw{
+		indexDoc(t, bson.D{{Key: "name", Value: "_id_"}, {Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}}}),
+		indexDoc(t, bson.D{{Key: "name", Value: "email_1"}, {Key: "key", Value: bson.D{{Key: "email", Value: int32(1)}}}}),
+		indexDoc(t, bson.D{{Key: "name", Value: "created_at_-1"}, {Key: "key", Value: bson.D{{Key: "created_at", Value: -1.0}}}, {Key: "expireAfterSeconds", Value: int32(3600)}}),
+		indexDoc(t, bson.D{{Key: "name", Value: "title_text_body_text"}, {Key: "key", Value: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}}}),
+		indexDoc(t, bson.D{{Key: "name", Value: "legacy_1"}, {Key: "key", Value: bson.D{{Key: "legacy", Value: int32(1)}}}}),
+	}
+
+	drift := indexDrift("users", specs, existing)
+	want := []SchemaDrift{
+		{Collection: "users", Kind: DriftIndexOptions, Index: "email_1", Detail: "unique false, registered true"},
+		{Collection: "users", Kind: DriftMissingIndex, Index: "tenant_1_status_1"},
+		{Collection: "users", Kind: DriftUnexpectedIndex, Index: "legacy_1"},
+	}
+	if len(drift) != len(want) {
+		t.Fatalf("got drift %v, want %v", drift, want)
+	}
+	for i := range want {
+		if drift[i] != want[i] {
+			t.Errorf("drift %d: got %v, want %v", i, drift[i], want[i])
+		}
+	}
+}
+
+func TestValidatorMatches(t *testing.T) {
+	schema := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"email"},
+		"properties": bson.M{
+			"age": bson.M{"bsonType": "int", "minimum": 0},
+		},
+	}
+	stored := indexDoc(t, bson.D{{Key: "validator", Value: bson.D{{Key: "$jsonSchema", Value: bson.D{
+		{Key: "properties", Value: bson.D{{Key: "age", Value: bson.D{{Key: "minimum", Value: 0.0}, {Key: "bsonType", Value: "int"}}}}},
+		{Key: "required", Value: bson.A{"email"}},
+		{Key: "bsonType", Value: "object"},
+	}}}}})
+	if !validatorMatches(schema, stored) {
+		t.Error("expected validators to match regardless of key order and number types")
+	}
+	schema["required"] = bson.A{"email", "name"}
+	if validatorMatches(schema, stored) {
+		t.Error("expected a changed validator to differ")
+	}
+	if validatorMatches(schema, indexDoc(t, bson.D{})) {
+		t.Error("expected a missing validator to differ")
+	}
+}
+
+type registryTestUser struct {
+	Email string `bson:"email"`
+}
+
+func TestSchemaInventory(t *testing.T) {
+	RegisterCollection[registryTestUser]("schema_registry_test_users", CollectionDef{
+		Owner:       "accounts",
+		Description: "registered users",
+		Indexes:     []IndexSpec{{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true}},
+		Validators:  []Validator{RequiredFields("email")},
+		JSONSchema:  bson.M{"required": bson.A{"email"}},
+	})
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, "schema_registry_test_users")
+		schemasMu.Unlock()
+	}()
+
+	p := NewMongoDBClient()
+	p.schemaDrift.byColl = map[string][]SchemaDrift{
+		"schema_registry_test_users": {{Collection: "schema_registry_test_users", Kind: DriftMissingCollection}},
+	}
+	var inv *CollectionInventory
+	for _, c := range p.SchemaInventory() {
+		if c.Collection == "schema_registry_test_users" {
+			inv = &c
+		}
+	}
+	if inv == nil {
+		t.Fatal("registered collection missing from the inventory")
+	}
+	if inv.Model != "mongodb.registryTestUser" || inv.Owner != "accounts" || inv.Validators != 1 || !inv.ServerValidator {
+		t.Errorf("unexpected inventory %+v", inv)
+	}
+	if len(inv.Indexes) != 1 || inv.Indexes[0] != "email_1" || len(inv.Drift) != 1 {
+		t.Errorf("unexpected inventory %+v", inv)
+	}
+	if lookupSchema("schema_registry_test_users").indexes[0].Collection != "schema_registry_test_users" {
+		t.Error("registered indexes must target the collection")
+	}
+}
+
+func TestSchemaProvisioningConfig(t *testing.T) {
+	p := NewMongoDBClient()
+	WithURI("mongodb://localhost:27017")(p)
+	WithDatabase("test")(p)
+	WithSchemaProvisioning("sometimes")(p)
+	if err := p.normalizeConfig(); err == nil {
+		t.Error("expected an invalid schema_provisioning error")
+	}
+	WithSchemaProvisioning("")(p)
+	if err := p.normalizeConfig(); err != nil || p.config().SchemaProvisioning != SchemaProvisionOff {
+		t.Errorf("got %q %v, want off", p.config().SchemaProvisioning, err)
+	}
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type schemaOrder struct {
+	Customer string  `bson:"customer"`
+	Total    float64 `bson:"total"`
+	Status   string  `bson:"status,omitempty"`
+}
+
+type schemaFlexible struct {
+	Name  string         `bson:"name"`
+	Extra map[string]any `bson:",inline"`
+}
+
+func TestCheckDocument(t *testing.T) {
+	p := NewMongoDBClient()
+	doc, _ := bson.Marshal(bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "customer", Value: "c1"},
+		{Key: "total", Value: "12.50"},
+		{Key: "legacy", Value: true},
+	})
+
+	got := p.checkDocument(reflect.TypeOf(schemaOrder{}), doc)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 violations, got %v", got)
+	}
+	if got[0].Field != "total" || got[0].Reason != ViolationTypeMismatch {
+		t.Errorf("unexpected violation %v", got[0])
+	}
+	if got[1].Field != "legacy" || got[1].Reason != ViolationUnknownField {
+		t.Errorf("unexpected violation %v", got[1])
+	}
+
+	if got := p.checkDocument(reflect.TypeOf(&schemaFlexible{}), doc); len(got) != 0 {
+		t.Errorf("inline map should accept unknown fields, got %v", got)
+	}
+}
+
+func TestValidateDocument(t *testing.T) {
+	RegisterSchema[schemaOrder]("schema_test_orders",
+		RequiredFields("customer", "total"),
+		ValidateField("status", func(v bson.RawValue) error {
+			if v.StringValue() != "open" && v.StringValue() != "closed" {
+				return errors.New("unknown status")
+			}
+			return nil
+		}),
+	)
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, "schema_test_orders")
+		schemasMu.Unlock()
+	}()
+
+	p := NewMongoDBClient()
+	doc, _ := bson.Marshal(bson.D{{Key: "customer", Value: "c1"}, {Key: "status", Value: "lost"}})
+	got, err := p.ValidateDocument("schema_test_orders", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldViolation{
+		{Field: "total", Reason: ViolationMissingField},
+		{Field: "status", Reason: ViolationInvalidValue, Detail: "unknown status"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := p.ValidateDocument("unregistered", doc); err == nil {
+		t.Error("expected an error for a collection without schema")
+	}
+}
+
+func TestViolationMetricField(t *testing.T) {
+	model := reflect.TypeOf(schemaOrder{})
+	tests := map[string]string{
+		"total":           "total",
+		"customer.region": "customer.region",
+		"ssn_4411":        violationFieldOther,
+		"":                "",
+	}
+	for field, want := range tests {
+		if got := violationMetricField(model, field); got != want {
+			t.Errorf("violationMetricField(%q) = %q, want %q", field, got, want)
+		}
+	}
+	if got := violationMetricField(reflect.TypeOf(bson.M{}), "total"); got != violationFieldOther {
+		t.Errorf("fields of a model without declared fields should be folded, got %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type (
+	scopeKey    struct{}
+	unscopedKey struct{}
+)
+
+// ScopeError is returned when a helper targets a scoped collection and the context carries
+// neither the scope fields of the collection nor Unscoped
+type ScopeError struct {
+	Collection string
+	// Missing lists the scope fields absent from the context scope
+	Missing []string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("collection %s is scoped by %s but the context has no value for it; use WithScope or Unscoped",
+		e.Collection, strings.Join(e.Missing, ", "))
+}
+
+// WithScope returns a context whose helper filters on scoped collections are restricted to the
+// given field values, e.g. WithScope(ctx, bson.D{{Key: "tenant_id", Value: tenantID}}), usually
+// set once by request middleware. Scopes add up: fields set again replace their outer value.
+func WithScope(ctx context.Context, fields bson.D) context.Context {
+	scope := append(bson.D(nil), scopeFrom(ctx)...)
+	for _, e := range fields {
+		replaced := false
+		for i := range scope {
+			if scope[i].Key == e.Key {
+				scope[i].Value = e.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			scope = append(scope, e)
+		}
+	}
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// Unscoped returns a context whose helper calls skip scoping, for deliberate cross-scope access
+// such as admin tooling and migrations. It must be requested explicitly on every such call path.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// ScopeFrom returns the scope fields carried by ctx
+func ScopeFrom(ctx context.Context) bson.D {
+	return append(bson.D(nil), scopeFrom(ctx)...)
+}
+
+func scopeFrom(ctx context.Context) bson.D {
+	if ctx == nil {
+		return nil
+	}
+	scope, _ := ctx.Value(scopeKey{}).(bson.D)
+	return scope
+}
+
+func isUnscoped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(unscopedKey{}).(bool)
+	return on
+}
+
+// ScopeFilter merges the scope predicate of ctx into filter for a collection registered with
+// ScopeFields: the result matches filter and the scope field values. Collections without scope
+// fields and Unscoped contexts get filter unchanged. Application code building its own queries
+// uses it the way plugin helpers do.
+func ScopeFilter(ctx context.Context, collection string, filter any) (any, error) {
+	predicate, err := scopePredicate(ctx, collection)
+	if err != nil || predicate == nil {
+		return filter, err
+	}
+	if isEmptyFilter(filter) {
+		return predicate, nil
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, predicate}}}, nil
+}
+
+// scopePredicate returns the equality predicate on the scope fields of collection, nil when the
+// collection is not scoped or ctx is Unscoped
+func scopePredicate(ctx context.Context, collection string) (bson.D, error) {
+	schema := lookupSchema(collection)
+	if schema == nil || len(schema.scopeFields) == 0 || isUnscoped(ctx) {
+		return nil, nil
+	}
+	scope := scopeFrom(ctx)
+	predicate := make(bson.D, 0, len(schema.scopeFields))
+	var missing []string
+	for _, field := range schema.scopeFields {
+		found := false
+		for _, e := range scope {
+			if e.Key == field {
+				predicate = append(predicate, e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &ScopeError{Collection: collection, Missing: missing}
+	}
+	return predicate, nil
+}
+
+// checkDocumentScope rejects a document written to collection that does not hold the scope values
+// of ctx, so records are never written under another scope
+func checkDocumentScope(ctx context.Context, collection string, doc bson.Raw) error {
+	predicate, err := scopePredicate(ctx, collection)
+	if err != nil || predicate == nil || scopeMatches(doc, predicate) {
+		return err
+	}
+	fields := make([]string, len(predicate))
+	for i, e := range predicate {
+		fields[i] = e.Key
+	}
+	return fmt.Errorf("document for %s does not hold the context scope values of %s", collection, strings.Join(fields, ", "))
+}
+
+// scopeMatches reports whether doc holds the values of predicate, so cached documents read under
+// another scope are never served
+func scopeMatches(doc bson.Raw, predicate bson.D) bool {
+	for _, e := range predicate {
+		got, err := doc.LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			return false
+		}
+		typ, data, err := bson.MarshalValue(e.Value)
+		if err != nil || got.Type != typ || !bytes.Equal(got.Value, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyFilter reports whether filter matches every document
+func isEmptyFilter(filter any) bool {
+	switch f := filter.(type) {
+	case nil:
+		return true
+	case bson.D:
+		return len(f) == 0
+	case bson.M:
+		return len(f) == 0
+	case bson.Raw:
+		return len(f) <= 5
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type scopeTestOrder struct {
+	ID       string `bson:"_id"`
+	TenantID string `bson:"tenant_id"`
+}
+
+func registerScopedOrders(t *testing.T) {
+	t.Helper()
+	RegisterCollection[scopeTestOrder]("scope_test_orders", CollectionDef{ScopeFields: []string{"tenant_id"}})
+	t.Cleanup(func() {
+		schemasMu.Lock()
+		delete(schemas, "scope_test_orders")
+		schemasMu.Unlock()
+	})
+}
+
+func TestScopeFilter(t *testing.T) {
+	registerScopedOrders(t)
+	ctx := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}, {Key: "org_id", Value: "o1"}})
+
+	got, err := ScopeFilter(ctx, "scope_test_orders", bson.D{{Key: "status", Value: "open"}})
+	want := bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "status", Value: "open"}}, bson.D{{Key: "tenant_id", Value: "t1"}}}}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v %v, want %v", got, err, want)
+	}
+	got, err = ScopeFilter(ctx, "scope_test_orders", nil)
+	if err != nil || !reflect.DeepEqual(got, bson.D{{Key: "tenant_id", Value: "t1"}}) {
+		t.Errorf("empty filter: got %v %v", got, err)
+	}
+
+	// Collections without scope fields are left alone
+	filter := bson.D{{Key: "code", Value: "FR"}}
+	if got, err := ScopeFilter(ctx, "countries", filter); err != nil || !reflect.DeepEqual(got, filter) {
+		t.Errorf("unscoped collection: got %v %v", got, err)
+	}
+
+	_, err = ScopeFilter(context.Background(), "scope_test_orders", filter)
+	var scopeErr *ScopeError
+	if !errors.As(err, &scopeErr) || scopeErr.Missing[0] != "tenant_id" {
+		t.Errorf("expected a scope error, got %v", err)
+	}
+	if got, err := ScopeFilter(Unscoped(context.Background()), "scope_test_orders", filter); err != nil || !reflect.DeepEqual(got, filter) {
+		t.Errorf("unscoped context: got %v %v", got, err)
+	}
+}
+
+func TestWithScopeReplaces(t *testing.T) {
+	ctx := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+	ctx = WithScope(ctx, bson.D{{Key: "tenant_id", Value: "t2"}, {Key: "org_id", Value: "o1"}})
+	want := bson.D{{Key: "tenant_id", Value: "t2"}, {Key: "org_id", Value: "o1"}}
+	if got := ScopeFrom(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCachedReaderScope(t *testing.T) {
+	registerScopedOrders(t)
+	raw, err := bson.Marshal(scopeTestOrder{ID: "o1", TenantID: "t1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMongoDBClient()
+	cache := NewMemoryCache(10)
+	reader := NewCachedReader[scopeTestOrder](p, "scope_test_orders", CacheOptions{TTL: time.Minute, Cache: cache})
+	key, err := reader.cacheKey(bson.D{{Key: "_id", Value: "o1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set(key, CacheEntry{Raw: raw, StoredAt: time.Now()})
+
+	own := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+	if res, err := reader.FindByID(own, "o1"); err != nil || res.Document.TenantID != "t1" {
+		t.Fatalf("expected a cache hit in the owning scope, got %+v %v", res, err)
+	}
+	// The plugin has no client, so a miss fails instead of serving the other tenant's document
+	other := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t2"}})
+	if res, err := reader.FindByID(other, "o1"); err == nil {
+		t.Fatalf("cached document of another scope was served: %+v", res)
+	}
+	if _, err := reader.FindByID(context.Background(), "o1"); err == nil {
+		t.Fatal("expected a scope error without scope")
+	}
+}
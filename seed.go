@@ -0,0 +1,226 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outcomes of fixture documents, as reported in the seed metric
+const (
+	seedInserted = "inserted"
+	seedExisting = "existing"
+	seedSkipped  = "skipped"
+)
+
+// SeedResult is the outcome of loading a fixture file
+type SeedResult struct {
+	Collection string `json:"collection"`
+	File       string `json:"file"`
+	// Documents is the number of documents of the file
+	Documents int   `json:"documents"`
+	Inserted  int64 `json:"inserted"`
+	// Existing counts documents not inserted because one with the same _id or unique key exists
+	Existing int `json:"existing"`
+	// Skipped is set when only_if_empty skipped the collection because it held documents
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Seed loads the fixture files of seed.dir into the collections they are named after, in file
+// name order. Documents already present (a duplicate _id or unique key) are counted as existing,
+// so seeding again only adds the missing ones; with seed.only_if_empty, collections holding
+// documents are skipped. Fixtures are inserted unscoped. The error reports an invalid file or the
+// first write failing for another reason than a duplicate key.
+func (p *PlugMongoDB) Seed(ctx context.Context) ([]SeedResult, error) {
+	cfg := p.config().GetSeed()
+	if cfg.GetDir() == "" {
+		return nil, fmt.Errorf("seed dir is not configured")
+	}
+	entries, err := os.ReadDir(cfg.GetDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed dir: %w", err)
+	}
+	var results []SeedResult
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".bson") {
+			continue
+		}
+		res, err := p.seedFile(ctx, filepath.Join(cfg.GetDir(), entry.Name()), cfg.GetOnlyIfEmpty())
+		if res.Collection != "" {
+			results = append(results, res)
+		}
+		if err != nil {
+			return results, fmt.Errorf("seed %s: %w", entry.Name(), err)
+		}
+	}
+	return results, nil
+}
+
+// seedFile loads the fixture file path into the collection named after it
+func (p *PlugMongoDB) seedFile(ctx context.Context, path string, onlyIfEmpty bool) (SeedResult, error) {
+	name := filepath.Base(path)
+	res := SeedResult{Collection: strings.TrimSuffix(name, filepath.Ext(name)), File: name}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	var docs []any
+	if filepath.Ext(name) == ".bson" {
+		docs, err = parseBSONFixture(data)
+	} else {
+		docs, err = parseJSONFixture(data)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.Documents = len(docs)
+	if len(docs) == 0 {
+		return res, nil
+	}
+
+	if onlyIfEmpty {
+		empty, err := p.collectionEmpty(ctx, res.Collection)
+		if err != nil {
+			return res, err
+		}
+		if !empty {
+			res.Skipped = true
+			p.recordSeed(res.Collection, seedSkipped, len(docs))
+			log.InfowCtx(ctx, "key", "mongodb", "event", "seed_skipped", "collection", res.Collection, "file", name)
+			return res, nil
+		}
+	}
+
+	bulk, err := p.BulkInsert(Unscoped(ctx), res.Collection, docs, BulkOptions{})
+	if bulk != nil {
+		res.Inserted = bulk.InsertedCount
+		var failure error
+		for _, f := range bulk.Failures {
+			if f.Code == 11000 || f.Code == 11001 {
+				res.Existing++
+			} else if failure == nil {
+				failure = f.Err
+			}
+		}
+		err = failure
+	}
+	p.recordSeed(res.Collection, seedInserted, int(res.Inserted))
+	p.recordSeed(res.Collection, seedExisting, res.Existing)
+	log.InfowCtx(ctx, "key", "mongodb", "event", "seed_loaded", "collection", res.Collection, "file", name,
+		"documents", res.Documents, "inserted", res.Inserted, "existing", res.Existing)
+	return res, err
+}
+
+// collectionEmpty reports whether collection holds no document
+func (p *PlugMongoDB) collectionEmpty(ctx context.Context, collection string) (bool, error) {
+	var n int64
+	op := operation{name: "count", database: p.databaseName(""), collection: collection}
+	err := p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		n, err = coll.CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+		return err
+	})
+	return n == 0, err
+}
+
+func (p *PlugMongoDB) recordSeed(collection, result string, n int) {
+	if n == 0 {
+		return
+	}
+	if name, ok := p.metricsCollection(p.databaseName(""), collection); ok {
+		p.prometheusMetrics.RecordSeededDocuments(p.config(), name, result, n)
+	}
+}
+
+// parseJSONFixture parses an Extended JSON array of documents, or one document per line as written
+// by mongoexport
+func parseJSONFixture(data []byte) ([]any, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	var docs []any
+	if trimmed[0] == '[' {
+		var fixture struct {
+			Documents []bson.D `bson:"documents"`
+		}
+		wrapped := append(append([]byte(`{"documents":`), trimmed...), '}')
+		if err := bson.UnmarshalExtJSON(wrapped, false, &fixture); err != nil {
+			return nil, fmt.Errorf("invalid JSON fixture: %w", err)
+		}
+		for _, doc := range fixture.Documents {
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+	for i, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(line, false, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON fixture line %d: %w", i+1, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// parseBSONFixture splits concatenated BSON documents
+func parseBSONFixture(data []byte) ([]any, error) {
+	var docs []any
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 5 {
+			return nil, fmt.Errorf("truncated BSON document at byte %d", offset)
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset:]))
+		if size < 5 || size > len(data)-offset {
+			return nil, fmt.Errorf("invalid BSON document length %d at byte %d", size, offset)
+		}
+		doc := bson.Raw(data[offset : offset+size])
+		if err := doc.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid BSON document at byte %d: %w", offset, err)
+		}
+		docs = append(docs, doc)
+		offset += size
+	}
+	return docs, nil
+}
+
+// seedAtStartup loads the fixtures when seed.enabled is set
+func (p *PlugMongoDB) seedAtStartup(ctx context.Context) error {
+	if !p.config().GetSeed().GetEnabled() {
+		return nil
+	}
+	start := time.Now()
+	results, err := p.Seed(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed: %w", err)
+	}
+	var inserted int64
+	var existing, skipped int
+	for _, res := range results {
+		inserted += res.Inserted
+		existing += res.Existing
+		if res.Skipped {
+			skipped++
+		}
+	}
+	log.InfowCtx(ctx, "key", "mongodb", "event", "seed_completed", "files", len(results), "inserted", inserted,
+		"existing", existing, "skipped_collections", skipped, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,87 @@
+package mongodb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseJSONFixture(t *testing.T) {
+	array, err := parseJSONFixture([]byte(`[{"_id": 1, "name": "a"}, {"_id": {"$oid": "665f1c2e8f1b2c3d4e5f6a7b"}}]`))
+	if err != nil || len(array) != 2 {
+		t.Fatalf("array fixture = %v, %v", array, err)
+	}
+	lines, err := parseJSONFixture([]byte("{\"_id\": 1}\n\n{\"_id\": 2, \"at\": {\"$date\": \"2024-06-11T12:00:00Z\"}}\n"))
+	if err != nil || len(lines) != 2 {
+		t.Fatalf("line fixture = %v, %v", lines, err)
+	}
+	if docs, err := parseJSONFixture([]byte("  \n")); err != nil || len(docs) != 0 {
+		t.Errorf("empty fixture = %v, %v", docs, err)
+	}
+	for _, bad := range []string{`[{"_id": 1}`, "{\"_id\": 1}\nnot json", `[1, 2]`} {
+		if _, err := parseJSONFixture([]byte(bad)); err == nil {
+			t.Errorf("fixture %q should fail", bad)
+		}
+	}
+}
+
+func TestParseBSONFixture(t *testing.T) {
+	var data []byte
+	for i := range 3 {
+		doc, err := bson.Marshal(bson.D{{Key: "_id", Value: i}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, doc...)
+	}
+	docs, err := parseBSONFixture(data)
+	if err != nil || len(docs) != 3 {
+		t.Fatalf("BSON fixture = %v, %v", docs, err)
+	}
+	if _, err := parseBSONFixture(data[:len(data)-2]); err == nil {
+		t.Error("a truncated fixture should fail")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	if _, err := p.Seed(t.Context()); err == nil {
+		t.Error("seeding without dir should fail")
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a_empty.json": "",
+		"b_users.json": `[{"_id": 1}]`,
+		"notes.txt":    "ignored",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	WithSeed(dir, true)(p)
+	results, err := p.Seed(t.Context())
+	if !errors.Is(err, errClientNotInitialized) {
+		t.Fatalf("Seed without client = %v", err)
+	}
+	if len(results) != 2 || results[0].Collection != "a_empty" || results[0].Documents != 0 ||
+		results[1].Collection != "b_users" || results[1].Documents != 1 {
+		t.Errorf("results = %+v", results)
+	}
+
+	p.recordSeed("users", seedInserted, 3)
+	p.recordSeed("users", seedExisting, 0)
+	if got := testutil.ToFloat64(p.prometheusMetrics.seededDocuments.WithLabelValues("test", "users", seedInserted)); got != 3 {
+		t.Errorf("seeded documents = %v", got)
+	}
+
+	if err := normalizeConf(&conf.MongoDB{Seed: &conf.Seed{Enabled: true}}); err == nil {
+		t.Error("an enabled seed without dir should be rejected")
+	}
+}
@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// codeUnauthorized is returned for commands the connected user lacks the privilege for
+	codeUnauthorized = 13
+	// deniedRetryAfter is how long a monitoring command is skipped after the server refused it
+	deniedRetryAfter = 10 * time.Minute
+)
+
+// serverStatusReply is the part of serverStatus exported as metrics
+type serverStatusReply struct {
+	Host       string           `bson:"host"`
+	GlobalLock globalLockStatus `bson:"globalLock"`
+	// WiredTiger is nil on other storage engines
+	WiredTiger *struct {
+		Cache wiredTigerCache `bson:"cache"`
+		// ConcurrentTransactions holds the tickets before MongoDB 7.0
+		ConcurrentTransactions *ticketStatus `bson:"concurrentTransactions"`
+	} `bson:"wiredTiger"`
+	Queues struct {
+		// Execution holds the tickets from MongoDB 7.0
+		Execution *ticketStatus `bson:"execution"`
+	} `bson:"queues"`
+}
+
+// globalLockStatus holds the operations queued for and holding locks
+type globalLockStatus struct {
+	CurrentQueue  readersWriters `bson:"currentQueue"`
+	ActiveClients readersWriters `bson:"activeClients"`
+}
+
+type readersWriters struct {
+	Readers float64 `bson:"readers"`
+	Writers float64 `bson:"writers"`
+}
+
+// ticketStatus holds the storage engine read and write tickets; operations beyond the available
+// tickets wait for one
+type ticketStatus struct {
+	Read  tickets `bson:"read"`
+	Write tickets `bson:"write"`
+}
+
+type tickets struct {
+	Out          float64 `bson:"out"`
+	Available    float64 `bson:"available"`
+	TotalTickets float64 `bson:"totalTickets"`
+}
+
+// tickets returns the read and write tickets of the server, nil when it reports none
+func (s *serverStatusReply) tickets() *ticketStatus {
+	if s.Queues.Execution != nil {
+		return s.Queues.Execution
+	}
+	if s.WiredTiger != nil {
+		return s.WiredTiger.ConcurrentTransactions
+	}
+	return nil
+}
+
+// wiredTigerCache holds the wiredTiger.cache statistics of serverStatus. Byte and page counts
+// other than the current sizes are cumulative since the server started.
+type wiredTigerCache struct {
+	Bytes              float64 `bson:"bytes currently in the cache"`
+	MaxBytes           float64 `bson:"maximum bytes configured"`
+	DirtyBytes         float64 `bson:"tracked dirty bytes in the cache"`
+	BytesRead          float64 `bson:"bytes read into cache"`
+	BytesWritten       float64 `bson:"bytes written from cache"`
+	ModifiedEvicted    float64 `bson:"modified pages evicted"`
+	UnmodifiedEvicted  float64 `bson:"unmodified pages evicted"`
+	ApplicationEvicted float64 `bson:"pages evicted by application threads"`
+}
+
+// serverStatusState keeps the cumulative counters of the previous serverStatus, to export
+// their increase, and whether the server refused the command
+type serverStatusState struct {
+	mu   sync.Mutex
+	host string
+	last map[string]float64
+	gate privilegeGate
+}
+
+// privilegeGate skips a monitoring command for deniedRetryAfter once the server refused it for
+// lack of privileges
+type privilegeGate struct {
+	mu          sync.Mutex
+	deniedUntil time.Time
+}
+
+// collectServerStatus runs serverStatus and exports lock queues, tickets and the storage engine
+// statistics. Users without the serverStatus privilege (clusterMonitor role) get a single warning
+// and the command is only retried every deniedRetryAfter.
+func (p *PlugMongoDB) collectServerStatus(ctx context.Context) {
+	m := p.prometheusMetrics
+	if m == nil || !p.serverStatus.gate.allowed(time.Now()) {
+		return
+	}
+	cmd := bson.D{{Key: "serverStatus", Value: 1}, {Key: "metrics", Value: 0}, {Key: "locks", Value: 0}}
+	status, err := RunCommandTyped[serverStatusReply](ctx, p, "admin", cmd)
+	if errorCode(err) == codeUnauthorized {
+		p.serverStatus.gate.deny(time.Now())
+		log.Warnw("key", "mongodb", "event", "server_status_denied", "error", err,
+			"hint", "grant the clusterMonitor role to export storage engine metrics")
+		return
+	}
+	if err != nil {
+		log.Debugf("mongodb serverStatus not collected: %v", err)
+		return
+	}
+	m.RecordLockQueues(p.config(), status.GlobalLock, status.tickets())
+	if status.WiredTiger == nil {
+		return
+	}
+	cache := status.WiredTiger.Cache
+	increase := p.serverStatus.increase(status.Host, map[string]float64{
+		"read":        cache.BytesRead,
+		"written":     cache.BytesWritten,
+		"modified":    cache.ModifiedEvicted,
+		"unmodified":  cache.UnmodifiedEvicted,
+		"application": cache.ApplicationEvicted,
+	})
+	m.RecordWiredTigerCache(p.config(), cache, increase)
+}
+
+func (g *privilegeGate) allowed(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return now.After(g.deniedUntil)
+}
+
+func (g *privilegeGate) deny(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deniedUntil = now.Add(deniedRetryAfter)
+}
+
+// increase stores counters as the cumulative values reported by host and returns how much each
+// grew since the previous call. The first values of a host (after startup or a failover) only set
+// the baseline; a counter that went down restarted with the server and counts from zero.
+func (s *serverStatusState) increase(host string, counters map[string]float64) map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, sameHost := s.last, s.host == host && s.last != nil
+	s.host, s.last = host, counters
+	out := make(map[string]float64, len(counters))
+	if !sameHost {
+		return out
+	}
+	for name, v := range counters {
+		if d := v - previous[name]; d >= 0 {
+			out[name] = d
+		} else {
+			out[name] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestServerStatusDecode(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "host", Value: "db-0:27017"},
+		{Key: "wiredTiger", Value: bson.D{{Key: "cache", Value: bson.D{
+			{Key: "bytes currently in the cache", Value: int64(600)},
+			{Key: "maximum bytes configured", Value: float64(1000)},
+			{Key: "tracked dirty bytes in the cache", Value: int32(50)},
+			{Key: "pages evicted by application threads", Value: int64(7)},
+		}}}},
+	})
+	var status serverStatusReply
+	if err := bson.Unmarshal(raw, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.WiredTiger == nil {
+		t.Fatal("expected the wiredTiger section")
+	}
+	c := status.WiredTiger.Cache
+	if status.Host != "db-0:27017" || c.Bytes != 600 || c.MaxBytes != 1000 || c.DirtyBytes != 50 || c.ApplicationEvicted != 7 {
+		t.Errorf("unexpected serverStatus %+v", c)
+	}
+
+	raw, _ = bson.Marshal(bson.D{{Key: "host", Value: "db-0:27017"}})
+	status = serverStatusReply{}
+	if err := bson.Unmarshal(raw, &status); err != nil || status.WiredTiger != nil {
+		t.Errorf("expected no wiredTiger section, got %+v (%v)", status.WiredTiger, err)
+	}
+}
+
+func TestServerStatusIncrease(t *testing.T) {
+	var s serverStatusState
+	if got := s.increase("db-0", map[string]float64{"read": 100}); len(got) != 0 {
+		t.Errorf("first sample should only set the baseline, got %v", got)
+	}
+	if got := s.increase("db-0", map[string]float64{"read": 150}); got["read"] != 50 {
+		t.Errorf("expected an increase of 50, got %v", got)
+	}
+	// Restarted server: counters start over
+	if got := s.increase("db-0", map[string]float64{"read": 20}); got["read"] != 20 {
+		t.Errorf("expected a reset counter to count from zero, got %v", got)
+	}
+	// Failover: counters of another host are a new baseline
+	if got := s.increase("db-1", map[string]float64{"read": 5000}); len(got) != 0 {
+		t.Errorf("expected a new baseline after a host change, got %v", got)
+	}
+
+	now := time.Now()
+	if !s.gate.allowed(now) {
+		t.Error("serverStatus should be allowed initially")
+	}
+	s.gate.deny(now)
+	if s.gate.allowed(now.Add(time.Minute)) || !s.gate.allowed(now.Add(deniedRetryAfter+time.Second)) {
+		t.Error("expected serverStatus to be retried only after deniedRetryAfter")
+	}
+}
+
+func TestRecordWiredTigerCache(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "test"}
+	cache := wiredTigerCache{Bytes: 600, MaxBytes: 1000, DirtyBytes: 50}
+	m.RecordWiredTigerCache(cfg, cache, map[string]float64{"read": 10, "modified": 3, "application": 2})
+	m.RecordWiredTigerCache(cfg, cache, map[string]float64{"read": 5, "modified": 1})
+
+	if got := testutil.ToFloat64(m.wtCacheDirtyBytes.WithLabelValues("test")); got != 50 {
+		t.Errorf("wiredtiger_cache_dirty_bytes = %v, want 50", got)
+	}
+	if got := testutil.ToFloat64(m.wtCacheReadBytes.WithLabelValues("test")); got != 15 {
+		t.Errorf("wiredtiger_cache_read_bytes_total = %v, want 15", got)
+	}
+	if got := testutil.ToFloat64(m.wtCacheEvicted.WithLabelValues("test", "modified")); got != 4 {
+		t.Errorf("wiredtiger_cache_evicted_pages_total{kind=modified} = %v, want 4", got)
+	}
+	if got := testutil.ToFloat64(m.wtCacheAppEvicted.WithLabelValues("test")); got != 2 {
+		t.Errorf("wiredtiger_cache_application_evictions_total = %v, want 2", got)
+	}
+}
+
+func TestServerStatusTickets(t *testing.T) {
+	tickets := bson.D{
+		{Key: "read", Value: bson.D{{Key: "out", Value: int32(3)}, {Key: "available", Value: int32(125)}, {Key: "totalTickets", Value: int32(128)}}},
+		{Key: "write", Value: bson.D{{Key: "out", Value: int32(128)}, {Key: "available", Value: int32(0)}, {Key: "totalTickets", Value: int32(128)}}},
+	}
+	for name, doc := range map[string]bson.D{
+		"6.0": {{Key: "wiredTiger", Value: bson.D{{Key: "concurrentTransactions", Value: tickets}}}},
+		"7.0": {{Key: "wiredTiger", Value: bson.D{}}, {Key: "queues", Value: bson.D{{Key: "execution", Value: tickets}}}},
+	} {
+		raw, _ := bson.Marshal(doc)
+		var status serverStatusReply
+		if err := bson.Unmarshal(raw, &status); err != nil {
+			t.Fatal(err)
+		}
+		ts := status.tickets()
+		if ts == nil || ts.Read.Available != 125 || ts.Write.Out != 128 || ts.Write.TotalTickets != 128 {
+			t.Errorf("%s: unexpected tickets %+v", name, ts)
+		}
+	}
+	if (&serverStatusReply{}).tickets() != nil {
+		t.Error("expected no tickets without a storage engine section")
+	}
+}
+
+func TestRecordLockQueues(t *testing.T) {
+	m := NewPrometheusMetrics(nil)
+	cfg := &conf.MongoDB{Database: "test"}
+	lock := globalLockStatus{CurrentQueue: readersWriters{Readers: 2, Writers: 9}, ActiveClients: readersWriters{Readers: 4, Writers: 1}}
+
+	m.RecordLockQueues(cfg, lock, nil)
+	if got := testutil.ToFloat64(m.lockQueueWriters.WithLabelValues("test")); got != 9 {
+		t.Errorf("global_lock_queue_writers = %v, want 9", got)
+	}
+	if n := testutil.CollectAndCount(m.ticketsAvailable); n != 0 {
+		t.Errorf("expected no ticket series without tickets, got %d", n)
+	}
+
+	m.RecordLockQueues(cfg, lock, &ticketStatus{Write: tickets{Out: 128, TotalTickets: 128}})
+	if got := testutil.ToFloat64(m.ticketsAvailable.WithLabelValues("test", "write")); got != 0 {
+		t.Errorf("tickets_available{operation=write} = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.ticketsInUse.WithLabelValues("test", "write")); got != 128 {
+		t.Errorf("tickets_in_use{operation=write} = %v, want 128", got)
+	}
+}
@@ -0,0 +1,314 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	// loadWindowSeconds is the length of the sliding window of load signals, in one-second buckets
+	loadWindowSeconds = 10
+	// minShedErrorSamples is the number of commands in the window below which the error rate is
+	// not trusted by the threshold policy
+	minShedErrorSamples = 20
+)
+
+// Priority ranks operations for load shedding; the zero value is PriorityNormal
+type Priority int
+
+// Operation priorities, from first to never shed
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+	// PriorityCritical operations are never shed
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// parsePriority parses a load_shedding.shed_priority value; "" is PriorityLow
+func parsePriority(s string) (Priority, error) {
+	switch strings.ToLower(s) {
+	case "", "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return 0, fmt.Errorf("invalid shed_priority %q: must be low, normal or high", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority sets the load shedding priority of operations issued with the returned context.
+// Operations without a priority are PriorityNormal.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFrom returns the priority set with WithPriority, or PriorityNormal
+func PriorityFrom(ctx context.Context) Priority {
+	if ctx == nil {
+		return PriorityNormal
+	}
+	priority, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok {
+		return PriorityNormal
+	}
+	return priority
+}
+
+// LoadSignals summarizes the load of the last ten seconds
+type LoadSignals struct {
+	// PoolWait is the average connection checkout wait
+	PoolWait time.Duration
+	// ErrorRate is the percentage of failed commands
+	ErrorRate float64
+	// Commands is the number of completed commands
+	Commands uint64
+	// PoolUtilization is the checked-out percentage of max_pool_size; zero unless enable_metrics
+	// is set and max_pool_size is configured
+	PoolUtilization float64
+}
+
+// ShedPolicy decides whether an operation of the given priority is rejected under the current load
+type ShedPolicy interface {
+	Shed(priority Priority, signals LoadSignals) bool
+}
+
+// ShedPolicyFunc adapts a function to ShedPolicy
+type ShedPolicyFunc func(priority Priority, signals LoadSignals) bool
+
+// Shed calls f
+func (f ShedPolicyFunc) Shed(priority Priority, signals LoadSignals) bool {
+	return f(priority, signals)
+}
+
+// thresholdShedPolicy is the load_shedding policy: operations up to shedPriority are shed while the
+// average pool wait or the error rate exceeds its bound
+type thresholdShedPolicy struct {
+	maxPoolWait  time.Duration
+	maxErrorRate float64
+	shedPriority Priority
+}
+
+func (t thresholdShedPolicy) Shed(priority Priority, s LoadSignals) bool {
+	if priority > t.shedPriority {
+		return false
+	}
+	if t.maxPoolWait > 0 && s.PoolWait > t.maxPoolWait {
+		return true
+	}
+	return t.maxErrorRate > 0 && s.Commands >= minShedErrorSamples && s.ErrorRate > t.maxErrorRate
+}
+
+// LoadShedError is returned for an operation rejected by the load shedding policy before it
+// checked out a connection
+type LoadShedError struct {
+	Operation string
+	Priority  Priority
+	Signals   LoadSignals
+}
+
+func (e *LoadShedError) Error() string {
+	return fmt.Sprintf("%s shed under load (priority %s, pool wait %v, error rate %.1f%%)",
+		e.Operation, e.Priority, e.Signals.PoolWait.Round(time.Microsecond), e.Signals.ErrorRate)
+}
+
+// loadBucket holds the load signals of one second
+type loadBucket struct {
+	second    int64
+	commands  uint64
+	failures  uint64
+	waitSum   time.Duration
+	waitCount uint64
+}
+
+// loadTracker keeps the command outcomes and pool waits of the last loadWindowSeconds
+type loadTracker struct {
+	mu      sync.Mutex
+	buckets [loadWindowSeconds]loadBucket
+}
+
+// bucket returns the bucket of now, resetting it when it holds an older second; mu must be held
+func (t *loadTracker) bucket(now time.Time) *loadBucket {
+	sec := now.Unix()
+	b := &t.buckets[sec%loadWindowSeconds]
+	if b.second != sec {
+		*b = loadBucket{second: sec}
+	}
+	return b
+}
+
+func (t *loadTracker) observeCommand(now time.Time, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(now)
+	b.commands++
+	if failed {
+		b.failures++
+	}
+}
+
+// reset forgets every observation
+func (t *loadTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buckets = [loadWindowSeconds]loadBucket{}
+}
+
+func (t *loadTracker) observeWait(now time.Time, wait time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(now)
+	b.waitSum += wait
+	b.waitCount++
+}
+
+// signals sums the buckets of the window ending at now
+func (t *loadTracker) signals(now time.Time) LoadSignals {
+	sec := now.Unix()
+	var total loadBucket
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.second > sec-loadWindowSeconds && b.second <= sec {
+			total.commands += b.commands
+			total.failures += b.failures
+			total.waitSum += b.waitSum
+			total.waitCount += b.waitCount
+		}
+	}
+	t.mu.Unlock()
+	var s LoadSignals
+	s.Commands = total.commands
+	if total.commands > 0 {
+		s.ErrorRate = float64(total.failures) / float64(total.commands) * 100
+	}
+	if total.waitCount > 0 {
+		s.PoolWait = total.waitSum / time.Duration(total.waitCount)
+	}
+	return s
+}
+
+// loadShedder applies the shed policy to the tracked load
+type loadShedder struct {
+	policy ShedPolicy
+	load   loadTracker
+}
+
+// newLoadShedder returns the load shedder of a custom policy (preferred) or of load_shedding, or
+// nil when neither is set
+func newLoadShedder(cfg *conf.LoadShedding, policy ShedPolicy) (*loadShedder, error) {
+	if policy != nil {
+		return &loadShedder{policy: policy}, nil
+	}
+	if cfg == nil {
+		return nil, nil
+	}
+	shedPriority, err := parsePriority(cfg.GetShedPriority())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.GetMaxErrorRate() < 0 || cfg.GetMaxErrorRate() > 100 {
+		return nil, fmt.Errorf("max_error_rate %v must be between 0 and 100", cfg.GetMaxErrorRate())
+	}
+	t := thresholdShedPolicy{
+		maxPoolWait:  cfg.GetMaxPoolWait().AsDuration(),
+		maxErrorRate: cfg.GetMaxErrorRate(),
+		shedPriority: shedPriority,
+	}
+	if t.maxPoolWait <= 0 && t.maxErrorRate == 0 {
+		return nil, fmt.Errorf("neither max_pool_wait nor max_error_rate is set")
+	}
+	return &loadShedder{policy: t}, nil
+}
+
+// loadSignals returns the current load signals with the pool utilization
+func (p *PlugMongoDB) loadSignals(s *loadShedder) LoadSignals {
+	signals := s.load.signals(time.Now())
+	if util, ok := p.poolUtilization(); ok {
+		signals.PoolUtilization = util
+	}
+	return signals
+}
+
+// shedLoad returns a *LoadShedError when the shed policy rejects an operation of the context
+// priority; critical operations are never shed
+func (p *PlugMongoDB) shedLoad(ctx context.Context, name string) error {
+	s := p.shed
+	priority := PriorityFrom(ctx)
+	if s == nil || priority >= PriorityCritical {
+		return nil
+	}
+	signals := p.loadSignals(s)
+	if !s.policy.Shed(priority, signals) {
+		return nil
+	}
+	p.prometheusMetrics.RecordShed(p.config(), priority.String())
+	return &LoadShedError{Operation: name, Priority: priority, Signals: signals}
+}
+
+// ShedLoad applies the load shedding policy to an operation issued on the raw driver handles: it
+// returns a *LoadShedError when the operation should not be sent
+func (p *PlugMongoDB) ShedLoad(ctx context.Context) error {
+	return p.shedLoad(ctx, "custom")
+}
+
+// createLoadCommandMonitor returns a CommandMonitor feeding command outcomes to the load shedder;
+// it returns nil when load shedding is not configured
+func (p *PlugMongoDB) createLoadCommandMonitor() *event.CommandMonitor {
+	s := p.shed
+	if s == nil {
+		return nil
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) {
+			s.load.observeCommand(time.Now(), false)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			// Caller cancellations say nothing about server load
+			if !commandCancelled(ctx, evt) {
+				s.load.observeCommand(time.Now(), true)
+			}
+		},
+	}
+}
+
+// createLoadPoolMonitor returns a PoolMonitor feeding connection checkout waits to the load
+// shedder while m publishes; it returns nil when load shedding is not configured
+func (p *PlugMongoDB) createLoadPoolMonitor(m *clientMonitor) *event.PoolMonitor {
+	s := p.shed
+	if s == nil {
+		return nil
+	}
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			if (evt.Type == event.GetSucceeded || evt.Type == event.GetFailed) && m.publishes() {
+				s.load.observeWait(time.Now(), evt.Duration)
+			}
+		},
+	}
+}
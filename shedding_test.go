@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPriorityContext(t *testing.T) {
+	if got := PriorityFrom(context.Background()); got != PriorityNormal {
+		t.Errorf("default priority = %v, want normal", got)
+	}
+	if got := PriorityFrom(WithPriority(context.Background(), PriorityLow)); got != PriorityLow {
+		t.Errorf("priority = %v, want low", got)
+	}
+}
+
+func TestLoadTrackerWindow(t *testing.T) {
+	var l loadTracker
+	start := time.Unix(1000, 0)
+	for i := range 10 {
+		l.observeCommand(start, i < 3)
+	}
+	l.observeWait(start, 10*time.Millisecond)
+	l.observeWait(start.Add(time.Second), 30*time.Millisecond)
+
+	s := l.signals(start.Add(time.Second))
+	if s.Commands != 10 || s.ErrorRate != 30 || s.PoolWait != 20*time.Millisecond {
+		t.Errorf("unexpected signals: %+v", s)
+	}
+	s = l.signals(start.Add(loadWindowSeconds * time.Second))
+	if s.Commands != 0 || s.PoolWait != 30*time.Millisecond {
+		t.Errorf("expected the first second to leave the window, got %+v", s)
+	}
+}
+
+func TestNewLoadShedder(t *testing.T) {
+	if s, err := newLoadShedder(nil, nil); s != nil || err != nil {
+		t.Errorf("expected no shedder without configuration, got %v, %v", s, err)
+	}
+	for _, cfg := range []*conf.LoadShedding{
+		{},
+		{MaxErrorRate: 120},
+		{MaxErrorRate: 10, ShedPriority: "critical"},
+	} {
+		if _, err := newLoadShedder(cfg, nil); err == nil {
+			t.Errorf("expected an error for %v", cfg)
+		}
+	}
+	s, err := newLoadShedder(&conf.LoadShedding{MaxPoolWait: durationpb.New(50 * time.Millisecond), MaxErrorRate: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := s.policy
+	for _, tc := range []struct {
+		priority Priority
+		signals  LoadSignals
+		want     bool
+	}{
+		{PriorityLow, LoadSignals{PoolWait: 80 * time.Millisecond}, true},
+		{PriorityNormal, LoadSignals{PoolWait: 80 * time.Millisecond}, false},
+		{PriorityLow, LoadSignals{PoolWait: 20 * time.Millisecond}, false},
+		{PriorityLow, LoadSignals{ErrorRate: 50, Commands: 100}, true},
+		{PriorityLow, LoadSignals{ErrorRate: 50, Commands: 5}, false},
+	} {
+		if got := policy.Shed(tc.priority, tc.signals); got != tc.want {
+			t.Errorf("Shed(%v, %+v) = %v, want %v", tc.priority, tc.signals, got, tc.want)
+		}
+	}
+}
+
+func TestShedLoad(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	WithShedPolicy(ShedPolicyFunc(func(priority Priority, s LoadSignals) bool {
+		return s.ErrorRate > 50
+	}))(p)
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	shed, err := newLoadShedder(nil, p.shedPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.shed = shed
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	m := p.createLoadCommandMonitor()
+	for range 10 {
+		m.Failed(context.Background(), &event.CommandFailedEvent{})
+	}
+	p.createLoadPoolMonitor(publishingMonitor()).Event(&event.PoolEvent{Type: event.GetSucceeded, Duration: time.Millisecond})
+
+	low := WithPriority(context.Background(), PriorityLow)
+	_, err = p.RunCommand(low, "", bson.D{{Key: "ping", Value: 1}})
+	var shedErr *LoadShedError
+	if !errors.As(err, &shedErr) || shedErr.Priority != PriorityLow || shedErr.Signals.PoolWait != time.Millisecond {
+		t.Fatalf("expected a load shed error, got %v", err)
+	}
+	critical := WithPriority(context.Background(), PriorityCritical)
+	if err := p.ShedLoad(critical); err != nil {
+		t.Errorf("critical operation shed: %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.shedTotal.WithLabelValues("test", "low")); got != 1 {
+		t.Errorf("shed_operations_total{priority=low} = %v, want 1", got)
+	}
+}
@@ -0,0 +1,225 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	// sloBuckets is the number of one-minute buckets kept per SLO, covering the longest window
+	sloBuckets = 3 * 24 * 60
+	// sloRefreshInterval is how often burn rates are recomputed
+	sloRefreshInterval = 30 * time.Second
+)
+
+// sloWindow is a burn rate window
+type sloWindow struct {
+	name    string
+	minutes int64
+}
+
+// sloWindows are the burn rate windows of the multi-window, multi-burn-rate alerting scheme:
+// 5m/1h and 30m/6h pair up for paging, 6h/1d and 1d/3d for tickets
+var sloWindows = []sloWindow{
+	{"5m", 5},
+	{"30m", 30},
+	{"1h", 60},
+	{"6h", 6 * 60},
+	{"1d", 24 * 60},
+	{"3d", 3 * 24 * 60},
+}
+
+// SLOStatus is the state of a latency SLO
+type SLOStatus struct {
+	Name       string        `json:"name"`
+	Operations []string      `json:"operations,omitempty"`
+	Target     time.Duration `json:"target"`
+	// Objective is the fraction of good operations (0-1)
+	Objective float64 `json:"objective"`
+	// Good and Bad count the operations of the longest window
+	Good uint64 `json:"good"`
+	Bad  uint64 `json:"bad"`
+	// BurnRates by window: the error budget consumption rate, 1 spending it exactly over the SLO period
+	BurnRates map[string]float64 `json:"burn_rates"`
+}
+
+// sloTracker counts good and bad operations of one SLO in one-minute buckets
+type sloTracker struct {
+	name       string
+	operations []string
+	target     time.Duration
+	objective  float64
+
+	mu      sync.Mutex
+	buckets [sloBuckets]sloBucket
+}
+
+type sloBucket struct {
+	minute    int64
+	good, bad uint64
+}
+
+// newSLOTrackers validates the configured SLOs
+func newSLOTrackers(cfgs []*conf.LatencySLO) ([]*sloTracker, error) {
+	var trackers []*sloTracker
+	seen := make(map[string]bool)
+	for _, cfg := range cfgs {
+		t := &sloTracker{
+			name:       cfg.GetName(),
+			operations: cfg.GetOperations(),
+			target:     cfg.GetTargetLatency().AsDuration(),
+			objective:  cfg.GetObjective() / 100,
+		}
+		if t.name == "" {
+			t.name = "all"
+			if len(t.operations) > 0 {
+				t.name = strings.Join(t.operations, "_")
+			}
+		}
+		if seen[t.name] {
+			return nil, fmt.Errorf("duplicate latency SLO %q", t.name)
+		}
+		seen[t.name] = true
+		if t.target <= 0 {
+			return nil, fmt.Errorf("latency SLO %q: target_latency must be positive", t.name)
+		}
+		if t.objective <= 0 || t.objective >= 1 {
+			return nil, fmt.Errorf("latency SLO %q: objective must be between 0 and 100 (exclusive), got %v", t.name, cfg.GetObjective())
+		}
+		trackers = append(trackers, t)
+	}
+	return trackers, nil
+}
+
+// covers reports whether the SLO applies to operation
+func (t *sloTracker) covers(operation string) bool {
+	return len(t.operations) == 0 || slices.Contains(t.operations, operation)
+}
+
+// observe counts an operation finished at now
+func (t *sloTracker) observe(now time.Time, good bool) {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	b := &t.buckets[minute%sloBuckets]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+	if good {
+		b.good++
+	} else {
+		b.bad++
+	}
+	t.mu.Unlock()
+}
+
+// status sums the buckets of every window ending at now
+func (t *sloTracker) status(now time.Time) SLOStatus {
+	s := SLOStatus{
+		Name:       t.name,
+		Operations: t.operations,
+		Target:     t.target,
+		Objective:  t.objective,
+		BurnRates:  make(map[string]float64, len(sloWindows)),
+	}
+	minute := now.Unix() / 60
+	good := make([]uint64, len(sloWindows))
+	bad := make([]uint64, len(sloWindows))
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		age := minute - b.minute
+		if age < 0 || age >= sloBuckets {
+			continue
+		}
+		for i, w := range sloWindows {
+			if age < w.minutes {
+				good[i] += b.good
+				bad[i] += b.bad
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for i, w := range sloWindows {
+		s.BurnRates[w.name] = burnRate(good[i], bad[i], t.objective)
+	}
+	s.Good, s.Bad = good[len(sloWindows)-1], bad[len(sloWindows)-1]
+	return s
+}
+
+// burnRate is the bad event ratio relative to the error budget (1 - objective)
+func burnRate(good, bad uint64, objective float64) float64 {
+	total := good + bad
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - objective)
+}
+
+// SLOStatus returns the state of the configured latency SLOs
+func (p *PlugMongoDB) SLOStatus() []SLOStatus {
+	now := time.Now()
+	out := make([]SLOStatus, 0, len(p.slos))
+	for _, t := range p.slos {
+		out = append(out, t.status(now))
+	}
+	return out
+}
+
+// createSLOMonitor returns a CommandMonitor classifying finished commands as good or bad events
+// of the SLOs covering them, on counters labelled from cfg; failed commands are bad, cancelled ones are ignored
+func (p *PlugMongoDB) createSLOMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
+	metrics := p.prometheusMetrics
+	if len(p.slos) == 0 || metrics == nil {
+		return nil
+	}
+	counters := make([]sloCounters, len(p.slos))
+	for i, t := range p.slos {
+		counters[i] = metrics.sloEventCounters(cfg, t.name)
+	}
+	finished := func(evt *event.CommandFinishedEvent, failed bool) {
+		operation := mapCommandNameToOperation(evt.CommandName)
+		now := time.Now()
+		for i, t := range p.slos {
+			if !t.covers(operation) {
+				continue
+			}
+			good := !failed && evt.Duration <= t.target
+			t.observe(now, good)
+			if good {
+				counters[i].good.Inc()
+			} else {
+				counters[i].bad.Inc()
+			}
+		}
+	}
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finished(&evt.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			// Commands abandoned by their caller are neither good nor bad events
+			if !commandCancelled(ctx, evt) {
+				finished(&evt.CommandFinishedEvent, true)
+			}
+		},
+	}
+}
+
+// startSLOBurnRates starts recomputing the burn rate gauges
+func (p *PlugMongoDB) startSLOBurnRates() {
+	if len(p.slos) == 0 || p.prometheusMetrics == nil {
+		return
+	}
+	p.startPeriodicTask("slo_burn_rates", sloRefreshInterval, func(context.Context) {
+		for _, s := range p.SLOStatus() {
+			p.prometheusMetrics.RecordSLOStatus(p.config(), s)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/event"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestNewSLOTrackers(t *testing.T) {
+	valid := &conf.LatencySLO{Operations: []string{"find", "aggregate"}, TargetLatency: durationpb.New(50 * time.Millisecond), Objective: 99.9}
+	trackers, err := newSLOTrackers([]*conf.LatencySLO{valid})
+	if err != nil || len(trackers) != 1 || trackers[0].name != "find_aggregate" || math.Abs(trackers[0].objective-0.999) > 1e-9 {
+		t.Fatalf("unexpected trackers %v, %v", trackers, err)
+	}
+	for name, cfgs := range map[string][]*conf.LatencySLO{
+		"duplicate":      {valid, valid},
+		"no target":      {{Name: "reads", Objective: 99}},
+		"objective 100":  {{Name: "reads", TargetLatency: durationpb.New(time.Millisecond), Objective: 100}},
+		"zero objective": {{Name: "reads", TargetLatency: durationpb.New(time.Millisecond)}},
+	} {
+		if _, err := newSLOTrackers(cfgs); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSLOBurnRates(t *testing.T) {
+	tr := &sloTracker{name: "reads", target: 10 * time.Millisecond, objective: 0.99}
+	now := time.Date(2026, 5, 1, 12, 0, 30, 0, time.UTC)
+	// Two hours ago: 100 good operations
+	for range 100 {
+		tr.observe(now.Add(-2*time.Hour), true)
+	}
+	// Last minute: 98 good, 2 bad
+	for i := range 100 {
+		tr.observe(now, i >= 2)
+	}
+
+	s := tr.status(now)
+	if s.Good != 198 || s.Bad != 2 {
+		t.Errorf("unexpected counts good=%d bad=%d", s.Good, s.Bad)
+	}
+	// 2% bad against a 1% budget burns twice as fast in the short windows
+	if got := s.BurnRates["5m"]; math.Abs(got-2) > 1e-9 {
+		t.Errorf("5m burn rate = %v, want 2", got)
+	}
+	if got := s.BurnRates["6h"]; math.Abs(got-1) > 1e-9 {
+		t.Errorf("6h burn rate = %v, want 1", got)
+	}
+	// Four days later everything left the windows
+	if got := tr.status(now.Add(96 * time.Hour)); got.Good != 0 || got.BurnRates["3d"] != 0 {
+		t.Errorf("expected expired buckets to be ignored, got %+v", got)
+	}
+}
+
+func TestSLOMonitor(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	WithLatencySLO("reads", 10*time.Millisecond, 99, "find")(p)
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	slos, err := newSLOTrackers(p.config().GetLatencySlos())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.slos = slos
+
+	mon := p.createSLOMonitor(p.config())
+	finished := func(cmd string, d time.Duration) event.CommandFinishedEvent {
+		return event.CommandFinishedEvent{CommandName: cmd, Duration: d}
+	}
+	mon.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: finished("find", time.Millisecond)})
+	mon.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: finished("find", 20*time.Millisecond)})
+	mon.Failed(context.Background(), &event.CommandFailedEvent{CommandFinishedEvent: finished("find", time.Millisecond)})
+	mon.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: finished("insert", time.Second)})
+
+	if got := testutil.ToFloat64(p.prometheusMetrics.sloEvents.WithLabelValues("test", "reads", "good")); got != 1 {
+		t.Errorf("slo_events_total{result=good} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.sloEvents.WithLabelValues("test", "reads", "bad")); got != 2 {
+		t.Errorf("slo_events_total{result=bad} = %v, want 2 (slow and failed)", got)
+	}
+
+	status := p.SLOStatus()
+	p.prometheusMetrics.RecordSLOStatus(p.config(), status[0])
+	if got := testutil.ToFloat64(p.prometheusMetrics.sloBurnRate.WithLabelValues("test", "reads", "1h")); math.Abs(got-200.0/3) > 1e-9 {
+		t.Errorf("slo_burn_rate{window=1h} = %v, want %v", got, 200.0/3)
+	}
+}
@@ -0,0 +1,123 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// defaultSmartReadMaxLag is used when the plugin config does not set smart_read_max_lag
+const defaultSmartReadMaxLag = 10 * time.Second
+
+// Reasons smart reads fall back to the primary, as reported in the read_fallbacks_total metric
+const (
+	FallbackNoSecondary = "no_secondary"
+	FallbackLagging     = "lagging"
+)
+
+type smartReadKey struct{}
+
+// WithSmartRead returns a context whose helper reads prefer secondaries, falling back to the
+// primary while no secondary is reachable or any reachable secondary lags beyond smart_read_max_lag.
+// The fallback ends on its own once heartbeats report the secondaries healthy and caught up again.
+func WithSmartRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, smartReadKey{}, true)
+}
+
+func smartRead(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(smartReadKey{}).(bool)
+	return on
+}
+
+// smartReadState remembers the last fallback reason to log transitions
+type smartReadState struct {
+	mu     sync.Mutex
+	reason string
+}
+
+// SmartReadPreference returns the read preference smart reads currently use: secondaryPreferred
+// while every reachable secondary is within smart_read_max_lag, primary otherwise
+func (p *PlugMongoDB) SmartReadPreference() *readpref.ReadPref {
+	rp, _ := p.smartReadDecision()
+	return rp
+}
+
+// smartReadDecision evaluates the member view and returns the read preference and the fallback
+// reason (empty when reading from secondaries)
+func (p *PlugMongoDB) smartReadDecision() (*readpref.ReadPref, string) {
+	maxLagMs := float64(p.smartReadMaxLag().Microseconds()) / 1000
+	secondaries := 0
+	reason := ""
+	for _, n := range p.NodeHealth() {
+		if n.Role != RoleSecondary || !n.Healthy {
+			continue
+		}
+		secondaries++
+		if n.LagMs > maxLagMs {
+			reason = FallbackLagging
+		}
+	}
+	if secondaries == 0 {
+		reason = FallbackNoSecondary
+	}
+	p.observeSmartRead(reason)
+	if reason != "" {
+		return readpref.Primary(), reason
+	}
+	return readpref.SecondaryPreferred(), ""
+}
+
+// observeSmartRead logs fallback transitions
+func (p *PlugMongoDB) observeSmartRead(reason string) {
+	s := &p.smartReads
+	s.mu.Lock()
+	changed := s.reason != reason
+	s.reason = reason
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+	if reason == "" {
+		log.Infow("key", "mongodb", "event", "smart_read_recovered")
+		return
+	}
+	log.Warnw("key", "mongodb", "event", "smart_read_fallback", "reason", reason, "max_lag", p.smartReadMaxLag())
+}
+
+// readCollection applies the read preference of WithSmartRead and WithMaxStaleness calls to coll
+func (p *PlugMongoDB) readCollection(ctx context.Context, coll *mongo.Collection) (*mongo.Collection, error) {
+	rp, err := p.readPreferenceFor(ctx)
+	if err != nil || rp == nil {
+		return coll, err
+	}
+	return coll.Database().Collection(coll.Name(), options.Collection().SetReadPreference(rp)), nil
+}
+
+// smartReadPreferenceFor returns the smart read preference for calls marked with WithSmartRead
+// (nil otherwise) and records fallbacks
+func (p *PlugMongoDB) smartReadPreferenceFor(ctx context.Context) *readpref.ReadPref {
+	if !smartRead(ctx) {
+		return nil
+	}
+	rp, reason := p.smartReadDecision()
+	if reason != "" && p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordReadFallback(p.config(), reason)
+	}
+	return rp
+}
+
+// smartReadMaxLag returns the configured replication lag bound of smart reads
+func (p *PlugMongoDB) smartReadMaxLag() time.Duration {
+	if lag := p.config().GetSmartReadMaxLag().AsDuration(); lag > 0 {
+		return lag
+	}
+	return defaultSmartReadMaxLag
+}
@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func laggingTopology(lag time.Duration) description.Topology {
+	now := time.Now()
+	return description.Topology{Kind: description.ReplicaSetWithPrimary, Servers: []description.Server{
+		{Addr: address.Address("db-0:27017"), Kind: description.RSPrimary, LastUpdateTime: now, LastWriteTime: now},
+		{Addr: address.Address("db-1:27017"), Kind: description.RSSecondary, LastUpdateTime: now, LastWriteTime: now.Add(-time.Second)},
+		{Addr: address.Address("db-2:27017"), Kind: description.RSSecondary, LastUpdateTime: now, LastWriteTime: now.Add(-lag)},
+	}}
+}
+
+func TestReplicationLag(t *testing.T) {
+	topo := laggingTopology(30 * time.Second)
+	if lag := replicationLag(topo, topo.Servers[2]); lag != 30*time.Second {
+		t.Errorf("lag against primary = %s", lag)
+	}
+	topo.Servers = topo.Servers[1:]
+	if lag := replicationLag(topo, topo.Servers[1]); lag != 29*time.Second {
+		t.Errorf("lag against freshest secondary = %s", lag)
+	}
+}
+
+func TestSmartReadFallback(t *testing.T) {
+	p := NewMongoDBClient()
+	WithSmartReadMaxLag(5 * time.Second)(p)
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+
+	p.nodes.update(laggingTopology(2 * time.Second))
+	if rp, reason := p.smartReadDecision(); rp.Mode() != readpref.SecondaryPreferredMode || reason != "" {
+		t.Errorf("expected secondary reads, got %v %q", rp.Mode(), reason)
+	}
+
+	p.nodes.update(laggingTopology(time.Minute))
+	if rp, reason := p.smartReadDecision(); rp.Mode() != readpref.PrimaryMode || reason != FallbackLagging {
+		t.Errorf("expected a lagging fallback, got %v %q", rp.Mode(), reason)
+	}
+
+	topo := laggingTopology(0)
+	topo.Servers[1].Kind, topo.Servers[2].Kind = description.Unknown, description.Unknown
+	p.nodes.update(topo)
+	if _, reason := p.smartReadDecision(); reason != FallbackNoSecondary {
+		t.Errorf("expected a no secondary fallback, got %q", reason)
+	}
+
+	if p.smartReadPreferenceFor(context.Background()) != nil {
+		t.Error("unmarked calls keep the client read preference")
+	}
+	if rp := p.smartReadPreferenceFor(WithSmartRead(context.Background())); rp == nil || rp.Mode() != readpref.PrimaryMode {
+		t.Errorf("unexpected read preference %v", rp)
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	coll, err := p.collectionHandle(WithSmartRead(context.Background()), "orders")
+	if err != nil || coll.Name() != "orders" || coll.Database().Name() != "app" {
+		t.Fatalf("unexpected collection %v %v", coll, err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.readFallbacksTotal.WithLabelValues("test", FallbackNoSecondary)); got != 2 {
+		t.Errorf("expected two recorded fallbacks, got %v", got)
+	}
+}
@@ -0,0 +1,177 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"github.com/go-lynx/lynx/plugins"
+)
+
+// defaultSRVCheckInterval is the SRV resolution interval when srv_check_interval is unset
+const defaultSRVCheckInterval = time.Minute
+
+// DNS records resolved for mongodb+srv URIs, as reported in SRV metrics
+const (
+	srvRecordSRV = "srv"
+	srvRecordTXT = "txt"
+)
+
+// srvResolver resolves the DNS records of mongodb+srv URIs; net.Resolver implements it
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// srvState remembers the last resolved seed list and TXT options
+type srvState struct {
+	mu sync.Mutex
+	// resolver overrides net.DefaultResolver in tests
+	resolver srvResolver
+	resolved bool
+	seeds    []string
+	txt      string
+}
+
+// srvTarget returns the host and SRV service name of a mongodb+srv uri, ok false for other URIs
+func srvTarget(uri string) (host, service string, ok bool) {
+	if !strings.HasPrefix(uri, "mongodb+srv://") {
+		return "", "", false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return "", "", false
+	}
+	service = u.Query().Get("srvServiceName")
+	if service == "" {
+		service = "mongodb"
+	}
+	return u.Hostname(), service, true
+}
+
+// startSRVMonitor periodically resolves the SRV and TXT records of a mongodb+srv uri; the first
+// resolution sets the baseline later ones are compared with
+func (p *PlugMongoDB) startSRVMonitor() {
+	if _, _, ok := srvTarget(p.config().GetUri()); !ok {
+		return
+	}
+	interval := defaultSRVCheckInterval
+	if d := p.config().GetSrvCheckInterval(); d != nil {
+		if d.AsDuration() < 0 {
+			return
+		}
+		if d.AsDuration() > 0 {
+			interval = d.AsDuration()
+		}
+	}
+	p.startPeriodicTask("srv_monitor", interval, p.checkSRV)
+}
+
+// checkSRV resolves the records of the uri, exports the resolved hosts and reports seed list and
+// TXT option changes. Failed resolutions keep the previous records.
+func (p *PlugMongoDB) checkSRV(ctx context.Context) {
+	host, service, ok := srvTarget(p.config().GetUri())
+	if !ok {
+		return
+	}
+	s := &p.srv
+	s.mu.Lock()
+	resolver := s.resolver
+	s.mu.Unlock()
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	seeds, err := resolveSeeds(ctx, resolver, service, host)
+	if err != nil {
+		log.Warnw("key", "mongodb", "event", "srv_resolution_failed", "host", host, "record", srvRecordSRV, "error", err)
+		p.prometheusMetrics.RecordSRVFailure(p.config(), srvRecordSRV)
+		return
+	}
+	txt, txtErr := resolver.LookupTXT(ctx, host)
+	if isNotFound(txtErr) {
+		txt, txtErr = nil, nil
+	}
+	if txtErr != nil {
+		log.Warnw("key", "mongodb", "event", "srv_resolution_failed", "host", host, "record", srvRecordTXT, "error", txtErr)
+		p.prometheusMetrics.RecordSRVFailure(p.config(), srvRecordTXT)
+	}
+	p.prometheusMetrics.RecordSRVHosts(p.config(), len(seeds))
+
+	s.mu.Lock()
+	first := !s.resolved
+	previous, previousTXT := s.seeds, s.txt
+	s.resolved, s.seeds = true, seeds
+	options := strings.Join(txt, "")
+	txtChanged := txtErr == nil && !first && options != previousTXT
+	if txtErr == nil {
+		s.txt = options
+	}
+	s.mu.Unlock()
+	if first {
+		return
+	}
+
+	if txtChanged {
+		log.Warnw("key", "mongodb", "event", "srv_txt_changed", "host", host, "previous", previousTXT, "options", options)
+		p.prometheusMetrics.RecordSRVChange(p.config(), srvRecordTXT)
+	}
+	added, removed := diffSeeds(previous, seeds)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	log.Warnw("key", "mongodb", "event", "seed_list_changed", "host", host,
+		"added", strings.Join(added, ","), "removed", strings.Join(removed, ","))
+	p.prometheusMetrics.RecordSRVChange(p.config(), srvRecordSRV)
+	p.emitTyped(EventSeedListChanged, plugins.PriorityNormal, SeedListChangedEvent{
+		Host: host, Added: added, Removed: removed, Seeds: seeds,
+	})
+}
+
+// resolveSeeds returns the sorted host:port addresses of the SRV records of host
+func resolveSeeds(ctx context.Context, resolver srvResolver, service, host string) ([]string, error) {
+	_, records, err := resolver.LookupSRV(ctx, service, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no SRV records for %s", host)
+	}
+	seeds := make([]string, 0, len(records))
+	for _, r := range records {
+		seeds = append(seeds, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+	}
+	slices.Sort(seeds)
+	return slices.Compact(seeds), nil
+}
+
+// diffSeeds returns the seeds of next missing from prev and those of prev missing from next
+func diffSeeds(prev, next []string) (added, removed []string) {
+	for _, s := range next {
+		if !slices.Contains(prev, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range prev {
+		if !slices.Contains(next, s) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// isNotFound reports whether err is a DNS answer without records, which TXT lookups may return
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
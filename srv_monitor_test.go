@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeSRVResolver struct {
+	records []*net.SRV
+	txt     []string
+	err     error
+}
+
+func (r *fakeSRVResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "mongodb" || proto != "tcp" || name != "cluster0.example.net" {
+		return "", nil, &net.DNSError{Err: "unexpected lookup", Name: name, IsNotFound: true}
+	}
+	return "", r.records, r.err
+}
+
+func (r *fakeSRVResolver) LookupTXT(context.Context, string) ([]string, error) {
+	if r.txt == nil {
+		return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+	}
+	return r.txt, nil
+}
+
+func TestSRVTarget(t *testing.T) {
+	host, service, ok := srvTarget("mongodb+srv://user:pw@cluster0.example.net/app?srvServiceName=mdb")
+	if !ok || host != "cluster0.example.net" || service != "mdb" {
+		t.Errorf("got %q %q %v", host, service, ok)
+	}
+	if _, _, ok := srvTarget("mongodb://db-0:27017"); ok {
+		t.Error("expected no SRV target for a mongodb:// uri")
+	}
+}
+
+func TestCheckSRVReportsSeedListChanges(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Uri: "mongodb+srv://cluster0.example.net/app", Database: "app"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	m := p.prometheusMetrics
+	resolver := &fakeSRVResolver{records: []*net.SRV{
+		{Target: "shard-00-01.example.net.", Port: 27017},
+		{Target: "shard-00-00.example.net.", Port: 27017},
+	}}
+	p.srv.resolver = resolver
+	ctx := context.Background()
+
+	p.checkSRV(ctx)
+	if want := []string{"shard-00-00.example.net:27017", "shard-00-01.example.net:27017"}; !reflect.DeepEqual(p.srv.seeds, want) {
+		t.Errorf("seeds = %v", p.srv.seeds)
+	}
+	if got := testutil.ToFloat64(m.srvHosts.WithLabelValues("app")); got != 2 {
+		t.Errorf("hosts = %v", got)
+	}
+	if got := testutil.CollectAndCount(m.srvChanges); got != 0 {
+		t.Error("the first resolution must only set the baseline")
+	}
+
+	resolver.err = errors.New("i/o timeout")
+	p.checkSRV(ctx)
+	if got := testutil.ToFloat64(m.srvFailures.WithLabelValues("app", srvRecordSRV)); got != 1 {
+		t.Errorf("failures = %v", got)
+	}
+	if len(p.srv.seeds) != 2 {
+		t.Error("a failed resolution must keep the previous seeds")
+	}
+
+	resolver.err = nil
+	resolver.records = []*net.SRV{{Target: "shard-00-00.example.net.", Port: 27017}, {Target: "shard-00-02.example.net.", Port: 27017}}
+	resolver.txt = []string{"authSource=admin&replicaSet=atlas-abc"}
+	p.checkSRV(ctx)
+	if got := testutil.ToFloat64(m.srvChanges.WithLabelValues("app", srvRecordSRV)); got != 1 {
+		t.Errorf("seed list changes = %v", got)
+	}
+	if got := testutil.ToFloat64(m.srvChanges.WithLabelValues("app", srvRecordTXT)); got != 1 {
+		t.Errorf("txt changes = %v", got)
+	}
+	added, removed := diffSeeds([]string{"a:1", "b:1"}, []string{"b:1", "c:1"})
+	if !reflect.DeepEqual(added, []string{"c:1"}) || !reflect.DeepEqual(removed, []string{"a:1"}) {
+		t.Errorf("diff = %v %v", added, removed)
+	}
+}
@@ -0,0 +1,93 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// What a freshness-bounded read does when secondaries are staler than its bound
+const (
+	// StaleReroute reads from the primary instead
+	StaleReroute = "reroute"
+	// StaleReject fails the read with a *StaleReadError
+	StaleReject = "reject"
+)
+
+// freshness is the per-call staleness bound set by WithMaxStaleness
+type freshness struct {
+	bound  time.Duration
+	action string
+}
+
+type freshnessKey struct{}
+
+// WithMaxStaleness returns a context whose helper reads may use secondaries only while their
+// estimated staleness, from the lastWrite dates in heartbeats, is within bound. Beyond it the read
+// is rerouted to the primary (StaleReroute) or rejected with a *StaleReadError (StaleReject).
+// CollectionFor cannot return an error and always reroutes.
+func WithMaxStaleness(ctx context.Context, bound time.Duration, action string) context.Context {
+	if action != StaleReject {
+		action = StaleReroute
+	}
+	return context.WithValue(ctx, freshnessKey{}, freshness{bound: bound, action: action})
+}
+
+func freshnessBound(ctx context.Context) (freshness, bool) {
+	if ctx == nil {
+		return freshness{}, false
+	}
+	f, ok := ctx.Value(freshnessKey{}).(freshness)
+	return f, ok
+}
+
+// StaleReadError reports a read rejected because secondaries were staler than its bound
+type StaleReadError struct {
+	// Staleness is the estimated lag of the stalest reachable secondary
+	Staleness time.Duration
+	Bound     time.Duration
+}
+
+func (e *StaleReadError) Error() string {
+	return fmt.Sprintf("secondary staleness %s exceeds the read bound %s", e.Staleness, e.Bound)
+}
+
+// readPreferenceFor returns the read preference of a helper call: the smart read choice for
+// WithSmartRead calls, bounded by WithMaxStaleness; nil keeps the client's read preference
+func (p *PlugMongoDB) readPreferenceFor(ctx context.Context) (*readpref.ReadPref, error) {
+	rp := p.smartReadPreferenceFor(ctx)
+	f, bounded := freshnessBound(ctx)
+	if !bounded {
+		return rp, nil
+	}
+	if rp == nil {
+		rp = readpref.SecondaryPreferred()
+	}
+	if rp.Mode() == readpref.PrimaryMode {
+		return rp, nil
+	}
+	staleness := p.secondaryStaleness()
+	if staleness <= f.bound {
+		return rp, nil
+	}
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordStaleRead(p.config(), f.action)
+	}
+	if f.action == StaleReject {
+		return nil, &StaleReadError{Staleness: staleness, Bound: f.bound}
+	}
+	return readpref.Primary(), nil
+}
+
+// secondaryStaleness estimates the staleness of the stalest reachable secondary
+func (p *PlugMongoDB) secondaryStaleness() time.Duration {
+	var worst float64
+	for _, n := range p.NodeHealth() {
+		if n.Role == RoleSecondary && n.Healthy && n.LagMs > worst {
+			worst = n.LagMs
+		}
+	}
+	return time.Duration(worst * float64(time.Millisecond))
+}
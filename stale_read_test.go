@@ -0,0 +1,56 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestMaxStaleness(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	p.nodes.update(laggingTopology(20 * time.Second))
+	ctx := context.Background()
+
+	if rp, err := p.readPreferenceFor(ctx); rp != nil || err != nil {
+		t.Errorf("unbounded calls keep the client read preference, got %v %v", rp, err)
+	}
+	rp, err := p.readPreferenceFor(WithMaxStaleness(ctx, time.Minute, StaleReject))
+	if err != nil || rp.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("expected secondary reads within the bound, got %v %v", rp, err)
+	}
+	rp, err = p.readPreferenceFor(WithMaxStaleness(ctx, 5*time.Second, StaleReroute))
+	if err != nil || rp.Mode() != readpref.PrimaryMode {
+		t.Errorf("expected a reroute to the primary, got %v %v", rp, err)
+	}
+	_, err = p.readPreferenceFor(WithMaxStaleness(ctx, 5*time.Second, StaleReject))
+	var stale *StaleReadError
+	if !errors.As(err, &stale) || stale.Staleness != 20*time.Second || stale.Bound != 5*time.Second {
+		t.Errorf("expected a stale read error, got %v", err)
+	}
+	for action, want := range map[string]float64{StaleReroute: 1, StaleReject: 1} {
+		if got := testutil.ToFloat64(p.prometheusMetrics.staleReadsTotal.WithLabelValues("test", action)); got != want {
+			t.Errorf("%s: got %v violations", action, got)
+		}
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "app"))
+	strict := WithMaxStaleness(ctx, 5*time.Second, StaleReject)
+	if _, err := p.collectionHandle(strict, "orders"); !errors.As(err, &stale) {
+		t.Errorf("helpers must reject stale reads, got %v", err)
+	}
+	if coll := p.CollectionFor(strict, "orders"); coll == nil {
+		t.Error("CollectionFor must reroute instead of rejecting")
+	}
+}
@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stream formats (StreamOptions.Format)
+const (
+	// StreamJSONArray writes the documents as one JSON array
+	StreamJSONArray = "json"
+	// StreamNDJSON writes one JSON document per line
+	StreamNDJSON = "ndjson"
+)
+
+// defaultStreamFlushEvery is the flush period in documents when StreamOptions.FlushEvery is unset
+const defaultStreamFlushEvery = 100
+
+// StreamOptions configures StreamCursor and StreamFind
+type StreamOptions struct {
+	// Format is StreamJSONArray (default) or StreamNDJSON
+	Format string
+	// FlushEvery flushes the response after this many documents (default 100; 1 flushes every document)
+	FlushEvery int
+	// Canonical writes canonical extended JSON instead of relaxed extended JSON
+	Canonical bool
+}
+
+// StreamCursor writes the documents of cursor to w as extended JSON without buffering the result
+// set, flushing every FlushEvery documents, and returns the number of documents written. It stops
+// when ctx is cancelled (e.g. the client went away). Nothing is written before the first document,
+// so on an error with zero documents the caller can still reply with an error status; a later
+// error leaves a JSON array unterminated so clients notice the truncation. The cursor is not closed.
+func StreamCursor(ctx context.Context, w http.ResponseWriter, cursor *mongo.Cursor, opts StreamOptions) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	n, _, err := streamCursor(ctx, w, cursor, opts)
+	return n, err
+}
+
+func streamCursor(ctx context.Context, w http.ResponseWriter, cursor *mongo.Cursor, opts StreamOptions) (int, resultSize, error) {
+	var size resultSize
+	array := true
+	switch opts.Format {
+	case "", StreamJSONArray:
+	case StreamNDJSON:
+		array = false
+	default:
+		return 0, size, fmt.Errorf("invalid stream format %q: must be %s or %s", opts.Format, StreamJSONArray, StreamNDJSON)
+	}
+	flushEvery := opts.FlushEvery
+	if flushEvery <= 0 {
+		flushEvery = defaultStreamFlushEvery
+	}
+	rc := http.NewResponseController(w)
+	flush := func() error {
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	started := false
+	start := func() error {
+		started = true
+		if array {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte{'['})
+			return err
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return nil
+	}
+
+	var buf []byte
+	for cursor.Next(ctx) {
+		// Batches already fetched do not observe ctx
+		if err := ctx.Err(); err != nil {
+			return size.documents, size, err
+		}
+		if !started {
+			if err := start(); err != nil {
+				return size.documents, size, err
+			}
+		}
+		buf = buf[:0]
+		if array && size.documents > 0 {
+			buf = append(buf, ',')
+		}
+		doc, err := bson.MarshalExtJSON(cursor.Current, opts.Canonical, false)
+		if err != nil {
+			return size.documents, size, fmt.Errorf("failed to encode document: %w", err)
+		}
+		buf = append(buf, doc...)
+		if !array {
+			buf = append(buf, '\n')
+		}
+		if _, err := w.Write(buf); err != nil {
+			return size.documents, size, err
+		}
+		size.add(cursor.Current)
+		if size.documents%flushEvery == 0 {
+			if err := flush(); err != nil {
+				return size.documents, size, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return size.documents, size, err
+	}
+	if err := ctx.Err(); err != nil {
+		return size.documents, size, err
+	}
+	if !started {
+		if err := start(); err != nil {
+			return 0, size, err
+		}
+	}
+	if array {
+		if _, err := w.Write([]byte{']'}); err != nil {
+			return size.documents, size, err
+		}
+	}
+	return size.documents, size, flush()
+}
+
+// StreamFind runs a find on collection and streams the results to w with StreamCursor. The find
+// itself runs with the helper behavior (scope, comment label, operation timeout); streaming is
+// bounded by ctx only, so long exports are not cut by operation_timeout.
+func (p *PlugMongoDB) StreamFind(ctx context.Context, w http.ResponseWriter, collection string, filter any, opts StreamOptions, findOpts ...*options.FindOptions) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cursor, err := p.openFind(ctx, collection, filter, findOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = cursor.Close(context.WithoutCancel(ctx)) }()
+
+	n, size, err := streamCursor(ctx, w, cursor, opts)
+	if err != nil {
+		return n, fmt.Errorf("mongodb stream of %s.%s failed after %d documents: %w", p.databaseName(""), collection, n, err)
+	}
+	p.recordResultSize(collection, size)
+	return n, nil
+}
+
+// openFind opens a find cursor on collection with the helper behavior (scope, comment label,
+// operation timeout); the caller iterates and closes it
+func (p *PlugMongoDB) openFind(ctx context.Context, collection string, filter any, findOpts []*options.FindOptions) (*mongo.Cursor, error) {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	filter, err := ScopeFilter(ctx, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	findOpts = append([]*options.FindOptions{callFindOptions(ctx)}, findOpts...)
+	findOpts = append(findOpts, commentFindOptions(ctx))
+
+	var cursor *mongo.Cursor
+	op := operation{name: "find", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		cursor, err = coll.Find(ctx, filter, findOpts...)
+		return err
+	})
+	return cursor, err
+}
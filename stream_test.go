@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func testCursor(t *testing.T, n int) *mongo.Cursor {
+	t.Helper()
+	docs := make([]any, n)
+	for i := range docs {
+		docs[i] = bson.D{{Key: "_id", Value: i}, {Key: "name", Value: "doc"}}
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+func TestStreamCursorJSONArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+	n, err := StreamCursor(context.Background(), rec, testCursor(t, 3), StreamOptions{FlushEvery: 2})
+	if err != nil || n != 3 {
+		t.Fatalf("StreamCursor = %d, %v", n, err)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var docs []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &docs); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(docs) != 3 || docs[2]["_id"] != float64(2) {
+		t.Errorf("unexpected documents: %v", docs)
+	}
+	if !rec.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+
+	rec = httptest.NewRecorder()
+	if n, err := StreamCursor(context.Background(), rec, testCursor(t, 0), StreamOptions{}); err != nil || n != 0 || rec.Body.String() != "[]" {
+		t.Errorf("empty stream = %d, %v, %q", n, err, rec.Body.String())
+	}
+}
+
+func TestStreamCursorNDJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	n, err := StreamCursor(context.Background(), rec, testCursor(t, 2), StreamOptions{Format: StreamNDJSON, Canonical: true})
+	if err != nil || n != 2 {
+		t.Fatalf("StreamCursor = %d, %v", n, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[1] != `{"_id":{"$numberInt":"1"},"name":"doc"}` {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestStreamCursorErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, err := StreamCursor(context.Background(), rec, testCursor(t, 1), StreamOptions{Format: "csv"}); err == nil || rec.Body.Len() != 0 {
+		t.Errorf("invalid format: %v, body %q", err, rec.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	n, err := StreamCursor(ctx, rec, testCursor(t, 3), StreamOptions{})
+	if !errors.Is(err, context.Canceled) || n != 0 || rec.Body.Len() != 0 {
+		t.Errorf("cancelled stream = %d, %v, body %q", n, err, rec.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// ViolationLossyCoercion is a field value the permissive decoder converts into a different
+// kind, such as a double into an int field or an ObjectID into a string field
+const ViolationLossyCoercion = "lossy_coercion"
+
+type strictDecodingKey struct{}
+
+// WithStrictDecoding makes helpers called with the returned context reject documents with fields
+// the model does not declare or values that only decode through lossy coercions. Use it in tests
+// and staging to catch model drift; decoding stays permissive by default.
+func WithStrictDecoding(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strictDecodingKey{}, true)
+}
+
+// strictDecoding reports whether ctx requests strict decoding
+func strictDecoding(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictDecodingKey{}).(bool)
+	return strict
+}
+
+// strictViolations reports the unknown fields and lossy coercions of raw against model
+func (p *PlugMongoDB) strictViolations(model reflect.Type, raw bson.Raw) []FieldViolation {
+	model = indirectType(model)
+	if model.Kind() != reflect.Struct {
+		return nil
+	}
+	violations := p.checkDocument(model, raw)
+	for _, f := range structBSONFields(model) {
+		v, err := raw.LookupErr(f.name)
+		if err != nil {
+			continue
+		}
+		if lossyCoercion(v.Type, f.typ) {
+			violations = append(violations, FieldViolation{
+				Field:  f.name,
+				Reason: ViolationLossyCoercion,
+				Detail: fmt.Sprintf("%s into %s", v.Type, f.typ),
+			})
+		}
+	}
+	return violations
+}
+
+var (
+	unmarshalerType      = reflect.TypeOf((*bson.Unmarshaler)(nil)).Elem()
+	valueUnmarshalerType = reflect.TypeOf((*bson.ValueUnmarshaler)(nil)).Elem()
+)
+
+// lossyCoercion reports whether the default decoder converts a value of BSON type t into a target
+// of a different kind. Types with their own decoding (unmarshalers, registered codecs) are trusted.
+func lossyCoercion(t bsontype.Type, target reflect.Type) bool {
+	target = indirectType(target)
+	if t == bsontype.Null || reflect.PointerTo(target).Implements(unmarshalerType) ||
+		reflect.PointerTo(target).Implements(valueUnmarshalerType) || hasCustomDecoder(target) {
+		return false
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return t != bsontype.Int32 && t != bsontype.Int64
+	case reflect.Float32, reflect.Float64:
+		// int64 values beyond 2^53 lose precision as floats
+		return t != bsontype.Double && t != bsontype.Int32
+	case reflect.String:
+		return t != bsontype.String
+	case reflect.Bool:
+		return t != bsontype.Boolean
+	}
+	return false
+}
+
+// hasCustomDecoder reports whether target decodes through a plugin codec
+func hasCustomDecoder(target reflect.Type) bool {
+	decimalCodecsMu.RLock()
+	defer decimalCodecsMu.RUnlock()
+	_, ok := decimalCodecs[target]
+	return ok
+}
+
+// withoutField returns a copy of raw without the top-level field key
+func withoutField(raw bson.Raw, key string) bson.Raw {
+	elems, err := raw.Elements()
+	if err != nil {
+		return raw
+	}
+	idx, out := bsoncore.AppendDocumentStart(nil)
+	for _, elem := range elems {
+		if elem.Key() != key {
+			out = append(out, elem...)
+		}
+	}
+	out, err = bsoncore.AppendDocumentEnd(out, idx)
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// textScoreField is the projected field carrying the $text relevance score
+const textScoreField = "_textScore"
+
+// TextSearchOptions configures TextSearch
+type TextSearchOptions struct {
+	// Additional filter combined with the $text query
+	Filter bson.D
+	// Language for stop words and stemming; empty uses the index default
+	Language string
+	// CaseSensitive enables case sensitive matching
+	CaseSensitive bool
+	// DiacriticSensitive enables diacritic sensitive matching
+	DiacriticSensitive bool
+	// MinScore drops results scoring below this value (applied client-side)
+	MinScore float64
+	// Limit caps the number of results (zero means no limit)
+	Limit int64
+}
+
+// TextResult is a decoded search hit with its relevance score
+type TextResult[T any] struct {
+	Document T
+	Score    float64
+}
+
+// TextSearch runs a $text query against collection (which needs a text index, see TextIndex)
+// and returns hits sorted by relevance score
+func TextSearch[T any](ctx context.Context, p *PlugMongoDB, collection, query string, opts *TextSearchOptions) ([]TextResult[T], error) {
+	if p == nil {
+		return nil, fmt.Errorf("mongodb plugin is nil")
+	}
+	if query == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	if opts == nil {
+		opts = &TextSearchOptions{}
+	}
+
+	text := bson.D{{Key: "$search", Value: query}}
+	if opts.Language != "" {
+		text = append(text, bson.E{Key: "$language", Value: opts.Language})
+	}
+	if opts.CaseSensitive {
+		text = append(text, bson.E{Key: "$caseSensitive", Value: true})
+	}
+	if opts.DiacriticSensitive {
+		text = append(text, bson.E{Key: "$diacriticSensitive", Value: true})
+	}
+	filter, err := ScopeFilter(ctx, collection, append(bson.D{{Key: "$text", Value: text}}, opts.Filter...))
+	if err != nil {
+		return nil, err
+	}
+
+	score := bson.D{{Key: "$meta", Value: "textScore"}}
+	findOpts := options.Find().
+		SetProjection(bson.D{{Key: textScoreField, Value: score}}).
+		SetSort(bson.D{{Key: textScoreField, Value: score}})
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+
+	var results []TextResult[T]
+	var size resultSize
+	op := operation{name: "find", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		cursor, err := coll.Find(ctx, filter, callFindOptions(ctx), findOpts, commentFindOptions(ctx))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		results, size = nil, resultSize{}
+		for cursor.Next(ctx) {
+			size.add(cursor.Current)
+			hit := TextResult[T]{}
+			if s, ok := cursor.Current.Lookup(textScoreField).DoubleOK(); ok {
+				hit.Score = s
+			}
+			if hit.Score < opts.MinScore {
+				continue
+			}
+			doc := cursor.Current
+			if strictDecoding(ctx) {
+				// The projected score is not part of the model
+				doc = withoutField(doc, textScoreField)
+			}
+			if err := p.decodeDocument(ctx, collection, doc, &hit.Document); err != nil {
+				return err
+			}
+			results = append(results, hit)
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.recordResultSize(collection, size)
+	return results, nil
+}
@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// codeRequestRateTooLarge is returned by CosmosDB when the provisioned throughput is exhausted
+	codeRequestRateTooLarge = 16500
+	// codeIngressRateLimitExceeded is returned when the server ingress rate limiter rejects a request
+	codeIngressRateLimitExceeded = 462
+	// labelSystemOverloaded marks operations rejected by an overloaded server before running
+	labelSystemOverloaded = "SystemOverloadedError"
+
+	defaultThrottleRetries    = 3
+	defaultThrottleBackoff    = 100 * time.Millisecond
+	defaultThrottleMaxBackoff = 5 * time.Second
+)
+
+// retryAfterPattern matches the retry-after hint CosmosDB puts in the error message
+var retryAfterPattern = regexp.MustCompile(`(?i)RetryAfterMs=(\d+)`)
+
+// ThrottleInfo describes a throttling rejection
+type ThrottleInfo struct {
+	Code int
+	// RetryAfter is the server-provided wait hint; zero when the server gave none
+	RetryAfter time.Duration
+}
+
+// Throttled reports whether err is a throttling rejection (CosmosDB 16500, ingress rate limit 462,
+// or an error labelled SystemOverloadedError) and returns its retry-after hint
+func Throttled(err error) (ThrottleInfo, bool) {
+	return throttled(err, nil)
+}
+
+func throttled(err error, extraCodes []int32) (ThrottleInfo, bool) {
+	var se mongo.ServerError
+	if err == nil || !errors.As(err, &se) {
+		return ThrottleInfo{}, false
+	}
+	for _, code := range append([]int32{codeRequestRateTooLarge, codeIngressRateLimitExceeded}, extraCodes...) {
+		if se.HasErrorCode(int(code)) {
+			return ThrottleInfo{Code: int(code), RetryAfter: retryAfterHint(err)}, true
+		}
+	}
+	if se.HasErrorLabel(labelSystemOverloaded) {
+		return ThrottleInfo{Code: errorCode(err), RetryAfter: retryAfterHint(err)}, true
+	}
+	return ThrottleInfo{}, false
+}
+
+// retryAfterHint reads the retry-after hint of a throttling error: a retryAfterMs field of the
+// server reply, or RetryAfterMs=N in the message (CosmosDB)
+func retryAfterHint(err error) time.Duration {
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Raw != nil {
+		for _, field := range []string{"retryAfterMs", "RetryAfterMs"} {
+			if v, err := ce.Raw.LookupErr(field); err == nil {
+				if ms, ok := v.AsInt64OK(); ok && ms > 0 {
+					return time.Duration(ms) * time.Millisecond
+				}
+			}
+		}
+	}
+	if m := retryAfterPattern.FindStringSubmatch(err.Error()); m != nil {
+		if ms, err := strconv.ParseInt(m[1], 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// throttleRetry is the resolved throttle_retry configuration
+type throttleRetry struct {
+	enabled    bool
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	codes      []int32
+}
+
+func (p *PlugMongoDB) throttleRetry() throttleRetry {
+	cfg := p.config().GetThrottleRetry()
+	t := throttleRetry{
+		enabled:    cfg.GetEnabled(),
+		retries:    int(cfg.GetMaxRetries()),
+		backoff:    cfg.GetBackoff().AsDuration(),
+		maxBackoff: cfg.GetMaxBackoff().AsDuration(),
+		codes:      cfg.GetCodes(),
+	}
+	if t.retries <= 0 {
+		t.retries = defaultThrottleRetries
+	}
+	if t.backoff <= 0 {
+		t.backoff = defaultThrottleBackoff
+	}
+	if t.maxBackoff <= 0 {
+		t.maxBackoff = defaultThrottleMaxBackoff
+	}
+	return t
+}
+
+// wait returns the wait before retry attempt+1: the server hint plus up to 20% jitter, or a
+// jittered exponential backoff without hint, bounded by maxBackoff
+func (t throttleRetry) wait(attempt int, hint time.Duration) time.Duration {
+	if hint > 0 {
+		return min(hint+rand.N(hint/5+1), t.maxBackoff)
+	}
+	d := t.backoff
+	for i := 0; i < attempt && d < t.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, t.maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryThrottled runs fn, retrying it while the server throttles it and throttle_retry allows.
+// Only commands rejected as a whole are retried: a throttled write of a bulk write may follow
+// writes that were applied. NonIdempotent operations and operations inside a transaction, which
+// retries as a whole, are not retried, and waits that would outlast the context deadline are not
+// attempted.
+func (p *PlugMongoDB) retryThrottled(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	t := p.throttleRetry()
+	if IdempotencyFrom(ctx) == NonIdempotent || inTransaction(ctx) {
+		t.enabled = false
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		info, ok := throttled(err, t.codes)
+		if !ok {
+			return err
+		}
+		var rejected mongo.CommandError
+		if !t.enabled || attempt >= t.retries || !errors.As(err, &rejected) {
+			p.prometheusMetrics.RecordThrottled(p.config(), name, "failed")
+			return err
+		}
+		wait := t.wait(attempt, info.RetryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			p.prometheusMetrics.RecordThrottled(p.config(), name, "failed")
+			return err
+		}
+		p.prometheusMetrics.RecordThrottled(p.config(), name, "retried")
+		log.Debugf("mongodb %s throttled (code %d), retrying in %v", name, info.Code, wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// RetryThrottled runs fn with the throttle_retry policy of the plugin helpers, for operations
+// issued on the raw driver handles
+func (p *PlugMongoDB) RetryThrottled(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.retryThrottled(ctx, "custom", fn)
+}
@@ -0,0 +1,128 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestThrottled(t *testing.T) {
+	cosmos := mongo.CommandError{Code: codeRequestRateTooLarge, Message: "Error=16500, RetryAfterMs=12, Details='Response status code does not indicate success: TooManyRequests (429)'"}
+	if info, ok := Throttled(cosmos); !ok || info.Code != codeRequestRateTooLarge || info.RetryAfter != 12*time.Millisecond {
+		t.Errorf("Throttled(cosmos) = %+v, %v", info, ok)
+	}
+	raw, _ := bson.Marshal(bson.D{{Key: "ok", Value: 0}, {Key: "retryAfterMs", Value: int64(250)}})
+	ingress := mongo.CommandError{Code: codeIngressRateLimitExceeded, Raw: raw}
+	if info, ok := Throttled(ingress); !ok || info.RetryAfter != 250*time.Millisecond {
+		t.Errorf("Throttled(ingress) = %+v, %v", info, ok)
+	}
+	if info, ok := Throttled(mongo.CommandError{Code: 91, Labels: []string{labelSystemOverloaded}}); !ok || info.RetryAfter != 0 {
+		t.Errorf("Throttled(overloaded) = %+v, %v", info, ok)
+	}
+	if _, ok := Throttled(mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: codeRequestRateTooLarge}}}); !ok {
+		t.Error("expected a throttled bulk write to be detected")
+	}
+	if _, ok := Throttled(mongo.CommandError{Code: 11600}); ok {
+		t.Error("unexpected throttling")
+	}
+	if _, ok := throttled(mongo.CommandError{Code: 11600}, []int32{11600}); !ok {
+		t.Error("expected configured codes to be throttling")
+	}
+	if _, ok := Throttled(errors.New("RetryAfterMs=5")); ok {
+		t.Error("expected plain errors not to be throttling")
+	}
+}
+
+func TestThrottleWait(t *testing.T) {
+	r := throttleRetry{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for attempt, limit := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		limit *= time.Millisecond
+		if got := r.wait(attempt, 0); got < limit/2 || got > limit {
+			t.Errorf("wait(%d) = %v, want within [%v, %v]", attempt, got, limit/2, limit)
+		}
+	}
+	if got := r.wait(0, 500*time.Millisecond); got < 500*time.Millisecond || got > 600*time.Millisecond {
+		t.Errorf("wait with hint = %v, want within [500ms, 600ms]", got)
+	}
+	if got := r.wait(0, time.Minute); got != time.Second {
+		t.Errorf("wait with long hint = %v, want max_backoff", got)
+	}
+}
+
+func TestRetryThrottled(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	throttledErr := mongo.CommandError{Code: codeRequestRateTooLarge, Message: "RetryAfterMs=1"}
+
+	calls := 0
+	fn := func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return throttledErr
+		}
+		return nil
+	}
+	if err := p.RetryThrottled(t.Context(), fn); err == nil || calls != 1 {
+		t.Errorf("expected no retry while throttle_retry is disabled, got %d calls: %v", calls, err)
+	}
+
+	WithThrottleRetry(2, time.Millisecond, 10*time.Millisecond)(p)
+	calls = 0
+	if err := p.RetryThrottled(t.Context(), fn); err != nil || calls != 3 {
+		t.Errorf("expected success on the third call, got %d calls: %v", calls, err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.throttledTotal.WithLabelValues("test", "custom", "retried")); got != 2 {
+		t.Errorf("throttled_operations_total{result=retried} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.throttledTotal.WithLabelValues("test", "custom", "failed")); got != 1 {
+		t.Errorf("throttled_operations_total{result=failed} = %v, want 1", got)
+	}
+
+	calls = 0
+	bulk := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: codeRequestRateTooLarge}}}
+	if err := p.RetryThrottled(t.Context(), func(context.Context) error { calls++; return bulk }); err == nil || calls != 1 {
+		t.Errorf("expected partially applied bulk writes not to be retried, got %d calls", calls)
+	}
+
+	calls = 0
+	nonIdempotent := WithIdempotency(t.Context(), NonIdempotent)
+	if err := p.RetryThrottled(nonIdempotent, func(context.Context) error { calls++; return throttledErr }); err == nil || calls != 1 {
+		t.Errorf("expected non-idempotent operations not to be retried, got %d calls", calls)
+	}
+
+	// Transactions retry as a whole; starting one does not contact the server
+	client, err := mongo.Connect(t.Context(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	sess, err := client.StartSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.EndSession(context.Background())
+	if err := sess.StartTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	txCtx := mongo.NewSessionContext(t.Context(), sess)
+	if err := p.RetryThrottled(txCtx, func(context.Context) error { calls++; return throttledErr }); err == nil || calls != 1 {
+		t.Errorf("expected operations inside a transaction not to be retried, got %d calls", calls)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond)
+	defer cancel()
+	calls = 0
+	slow := mongo.CommandError{Code: codeRequestRateTooLarge, Message: "RetryAfterMs=5000"}
+	if err := p.RetryThrottled(ctx, func(context.Context) error { calls++; return slow }); err == nil || calls != 1 {
+		t.Errorf("expected no retry beyond the deadline, got %d calls", calls)
+	}
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+// localTimeWarnInterval bounds how often local-time writes are logged
+const localTimeWarnInterval = time.Minute
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// NormalizeTime converts t to UTC and truncates it to millisecond precision, which is
+// exactly what survives a BSON round trip. Normalize values before comparing them with
+// values read back from MongoDB.
+func NormalizeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// timeCodec wraps the driver's default time.Time codec with the configured TimeHandling rules
+type timeCodec struct {
+	forceUTC        bool
+	truncate        bool
+	warnOnLocalTime bool
+	onLocalWrite    func()
+	decoder         bsoncodec.ValueDecoder
+}
+
+func newTimeCodec(cfg *conf.TimeHandling, onLocalWrite func()) *timeCodec {
+	return &timeCodec{
+		forceUTC:        cfg.GetForceUtc(),
+		truncate:        cfg.GetTruncateToMillis(),
+		warnOnLocalTime: cfg.GetWarnOnLocalTime(),
+		onLocalWrite:    onLocalWrite,
+	}
+}
+
+// register installs the codec on the registry, keeping the default decoder as fallback
+func (tc *timeCodec) register(registry *bsoncodec.Registry) error {
+	decoder, err := bson.NewRegistry().LookupDecoder(timeType)
+	if err != nil {
+		return fmt.Errorf("failed to lookup default time decoder: %w", err)
+	}
+	tc.decoder = decoder
+	registry.RegisterTypeEncoder(timeType, bsoncodec.ValueEncoderFunc(tc.EncodeValue))
+	registry.RegisterTypeDecoder(timeType, bsoncodec.ValueDecoderFunc(tc.DecodeValue))
+	return nil
+}
+
+// EncodeValue writes time.Time as a BSON datetime
+func (tc *timeCodec) EncodeValue(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != timeType {
+		return bsoncodec.ValueEncoderError{Name: "TimeEncodeValue", Types: []reflect.Type{timeType}, Received: val}
+	}
+	t := val.Interface().(time.Time)
+	if tc.warnOnLocalTime && t.Location() != time.UTC && tc.onLocalWrite != nil {
+		tc.onLocalWrite()
+	}
+	return vw.WriteDateTime(t.Unix()*1000 + int64(t.Nanosecond()/1e6))
+}
+
+// DecodeValue reads a time.Time using the default decoder and applies UTC/truncation rules
+func (tc *timeCodec) DecodeValue(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if err := tc.decoder.DecodeValue(dc, vr, val); err != nil {
+		return err
+	}
+	t := val.Interface().(time.Time)
+	if tc.forceUTC {
+		t = t.UTC()
+	}
+	if tc.truncate {
+		t = t.Truncate(time.Millisecond)
+	}
+	val.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// onLocalTimeWrite counts writes of non-UTC time values and logs a rate-limited warning
+func (p *PlugMongoDB) onLocalTimeWrite() {
+	if p.prometheusMetrics != nil {
+		p.prometheusMetrics.RecordLocalTimeWrite(p.config())
+	}
+	count := atomic.AddInt64(&p.localTimeWrites, 1)
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&p.localTimeWarnAt)
+	if now-last < int64(localTimeWarnInterval) || !atomic.CompareAndSwapInt64(&p.localTimeWarnAt, last, now) {
+		return
+	}
+	log.Warnf("mongodb: non-UTC time.Time value written (%d total); use time.UTC or mongodb.NormalizeTime to avoid comparison drift", count)
+}
@@ -0,0 +1,72 @@
+package mongodb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+func TestTimeCodecRoundTrip(t *testing.T) {
+	p := NewMongoDBClient()
+	WithTimeHandling(true, true, true)(p)
+	registry, err := p.buildRegistry()
+	if err != nil || registry == nil {
+		t.Fatalf("buildRegistry: registry=%v err=%v", registry, err)
+	}
+
+	type doc struct {
+		At time.Time `bson:"at"`
+	}
+	loc := time.FixedZone("UTC+8", 8*3600)
+	in := doc{At: time.Date(2024, 5, 1, 12, 0, 0, 123456789, loc)}
+
+	buf := new(bytes.Buffer)
+	vw, err := bsonrw.NewBSONValueWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := bson.NewEncoder(vw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.SetRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(in); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if p.localTimeWrites != 1 {
+		t.Errorf("expected 1 local time write, got %d", p.localTimeWrites)
+	}
+
+	dec, err := bson.NewDecoder(bsonrw.NewBSONDocumentReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.SetRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	var out doc
+	if err := dec.Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.At.Location() != time.UTC {
+		t.Errorf("expected UTC location, got %v", out.At.Location())
+	}
+	if !out.At.Equal(NormalizeTime(in.At)) || out.At != NormalizeTime(in.At) {
+		t.Errorf("expected %v, got %v", NormalizeTime(in.At), out.At)
+	}
+}
+
+func TestBuildRegistryDisabled(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{})
+	registry, err := p.buildRegistry()
+	if err != nil || registry != nil {
+		t.Fatalf("expected nil registry without hooks, got %v, %v", registry, err)
+	}
+}
@@ -0,0 +1,51 @@
+package mongodb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+// buildTLSConfig builds the client TLS configuration from the tls_* fields; it returns nil when
+// enable_tls is unset. A client certificate without tls_key_file is read as a combined PEM file.
+func buildTLSConfig(cfg *conf.MongoDB) (*tls.Config, error) {
+	if !cfg.GetEnableTls() {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.GetTlsServerName(),
+		InsecureSkipVerify: cfg.GetTlsInsecureSkipVerify(),
+	}
+
+	if caFile := cfg.GetTlsCaFile(); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca_file %s contains no PEM certificate", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := cfg.GetTlsCertFile(), cfg.GetTlsKeyFile()
+	switch {
+	case certFile == "" && keyFile != "":
+		return nil, fmt.Errorf("tls_key_file requires tls_cert_file")
+	case certFile != "":
+		if keyFile == "" {
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
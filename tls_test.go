@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+// writeTestCert writes a self-signed certificate and its key as PEM files
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mongo.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	if cfg, err := buildTLSConfig(&conf.MongoDB{TlsCaFile: "/missing"}); cfg != nil || err != nil {
+		t.Errorf("expected no TLS config without enable_tls, got %v, %v", cfg, err)
+	}
+	cfg, err := buildTLSConfig(&conf.MongoDB{EnableTls: true, TlsServerName: "mongo.internal", TlsInsecureSkipVerify: true})
+	if err != nil || cfg == nil {
+		t.Fatalf("expected a TLS config without files, got %v", err)
+	}
+	if cfg.ServerName != "mongo.internal" || !cfg.InsecureSkipVerify || cfg.RootCAs != nil {
+		t.Errorf("unexpected TLS config: %+v", cfg)
+	}
+
+	certFile, keyFile := writeTestCert(t)
+	cfg, err = buildTLSConfig(&conf.MongoDB{EnableTls: true, TlsCaFile: certFile, TlsCertFile: certFile, TlsKeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RootCAs == nil || len(cfg.Certificates) != 1 {
+		t.Errorf("expected the CA pool and client certificate to be loaded: %+v", cfg)
+	}
+
+	combined := filepath.Join(t.TempDir(), "client.pem")
+	certPEM, _ := os.ReadFile(certFile)
+	keyPEM, _ := os.ReadFile(keyFile)
+	if err := os.WriteFile(combined, append(certPEM, keyPEM...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := buildTLSConfig(&conf.MongoDB{EnableTls: true, TlsCertFile: combined}); err != nil || len(cfg.Certificates) != 1 {
+		t.Errorf("expected a combined certificate file to be loaded, got %v", err)
+	}
+
+	for name, c := range map[string]*conf.MongoDB{
+		"missing CA":       {EnableTls: true, TlsCaFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA without certs": {EnableTls: true, TlsCaFile: keyFile},
+		"key without cert": {EnableTls: true, TlsKeyFile: keyFile},
+		"cert without key": {EnableTls: true, TlsCertFile: certFile},
+	} {
+		if _, err := buildTLSConfig(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
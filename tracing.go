@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of command spans
+const tracerName = "github.com/go-lynx/lynx-mongodb"
+
+// createTracingMonitor returns a CommandMonitor creating a client span per command when
+// enable_tracing is set in cfg. Spans start from the operation context, so they nest under the caller's
+// span, and carry the database, collection, operation, server and duration.
+func (p *PlugMongoDB) createTracingMonitor(cfg *conf.MongoDB) *event.CommandMonitor {
+	if !cfg.GetEnableTracing() {
+		return nil
+	}
+	tp := p.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+
+	// requestID -> span of the running command
+	var spans sync.Map
+
+	finished := func(evt *event.CommandFinishedEvent, failure string) {
+		v, ok := spans.LoadAndDelete(evt.RequestID)
+		if !ok {
+			return
+		}
+		s := v.(commandSpan)
+		s.span.SetAttributes(attribute.Float64("db.mongodb.duration_ms", float64(evt.Duration)/float64(time.Millisecond)))
+		if failure != "" {
+			s.span.RecordError(errors.New(failure))
+			s.span.SetStatus(codes.Error, failure)
+		}
+		s.span.End(trace.WithTimestamp(s.start.Add(evt.Duration)))
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			operation := mapCommandNameToOperation(evt.CommandName)
+			collection := commandCollection(evt.Command)
+			name := operation
+			if collection != "" {
+				name += " " + collection
+			}
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemNameMongoDB,
+				semconv.DBNamespace(evt.DatabaseName),
+				semconv.DBOperationName(evt.CommandName),
+			}
+			if collection != "" {
+				attrs = append(attrs, semconv.DBCollectionName(collection))
+			}
+			attrs = append(attrs, serverAttributes(evt.ConnectionID)...)
+			start := time.Now()
+			_, span := tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithTimestamp(start),
+				trace.WithAttributes(attrs...),
+			)
+			spans.Store(evt.RequestID, commandSpan{span: span, start: start})
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finished(&evt.CommandFinishedEvent, "")
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finished(&evt.CommandFinishedEvent, evt.Failure)
+		},
+	}
+}
+
+type commandSpan struct {
+	span  trace.Span
+	start time.Time
+}
+
+// serverAttributes returns the server address and port of a driver connection ID ("host:port[-7]")
+func serverAttributes(connectionID string) []attribute.KeyValue {
+	addr, _, _ := strings.Cut(connectionID, "[")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		if addr == "" {
+			return nil
+		}
+		return []attribute.KeyValue{semconv.ServerAddress(addr)}
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if n, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(n))
+	}
+	return attrs
+}
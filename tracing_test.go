@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMonitor(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	if p.createTracingMonitor(p.config()) != nil {
+		t.Fatal("expected no tracing monitor unless enable_tracing is set")
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	WithTracing(tp)(p)
+	mon := p.createTracingMonitor(p.config())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "handler")
+	cmd, _ := bson.Marshal(bson.D{{Key: "find", Value: "orders"}})
+	mon.Started(ctx, &event.CommandStartedEvent{
+		Command: cmd, DatabaseName: "test", CommandName: "find", RequestID: 1, ConnectionID: "db-0:27017[-3]",
+	})
+	mon.Succeeded(ctx, &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, Duration: 2 * time.Millisecond},
+	})
+	cmd, _ = bson.Marshal(bson.D{{Key: "insert", Value: "orders"}})
+	mon.Started(ctx, &event.CommandStartedEvent{Command: cmd, DatabaseName: "test", CommandName: "insert", RequestID: 2})
+	mon.Failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", RequestID: 2},
+		Failure:              "E11000 duplicate key error",
+	})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected two command spans and the parent, got %d", len(spans))
+	}
+	find := spans[0]
+	if find.Name() != "find orders" || find.SpanKind() != trace.SpanKindClient {
+		t.Errorf("unexpected span %q (%v)", find.Name(), find.SpanKind())
+	}
+	if find.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the command span to be a child of the operation context")
+	}
+	if d := find.EndTime().Sub(find.StartTime()); d != 2*time.Millisecond {
+		t.Errorf("expected the span to last the command duration, got %v", d)
+	}
+	attrs := make(map[string]string)
+	for _, kv := range find.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	for key, want := range map[string]string{
+		"db.system.name":     "mongodb",
+		"db.namespace":       "test",
+		"db.collection.name": "orders",
+		"db.operation.name":  "find",
+		"server.address":     "db-0",
+		"server.port":        "27017",
+	} {
+		if attrs[key] != want {
+			t.Errorf("attribute %s = %q, want %q", key, attrs[key], want)
+		}
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "E11000 duplicate key error" {
+		t.Errorf("expected the failed command span to carry the error, got %+v", spans[1].Status())
+	}
+}
@@ -0,0 +1,216 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	// defaultTxnRetries is the number of retries of a transaction failing with a transient error
+	defaultTxnRetries = 3
+	// defaultTxnBackoff is the wait before the first retry; it doubles per retry up to defaultTxnMaxBackoff
+	defaultTxnBackoff    = 10 * time.Millisecond
+	defaultTxnMaxBackoff = time.Second
+
+	// Server error labels of retryable transaction failures
+	labelTransientTransaction = "TransientTransactionError"
+	labelUnknownCommitResult  = "UnknownTransactionCommitResult"
+)
+
+// TxnOption configures WithTransaction
+type TxnOption func(*txnOptions)
+
+type txnOptions struct {
+	readConcern  *readconcern.ReadConcern
+	writeConcern *writeconcern.WriteConcern
+	readPref     *readpref.ReadPref
+	maxCommit    time.Duration
+	retries      int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	jitter       bool
+	label        string
+}
+
+// WithTxnReadConcern sets the read concern of the transaction (defaults to the client's)
+func WithTxnReadConcern(rc *readconcern.ReadConcern) TxnOption {
+	return func(o *txnOptions) {
+		o.readConcern = rc
+	}
+}
+
+// WithTxnWriteConcern sets the write concern of the commit (defaults to the client's)
+func WithTxnWriteConcern(wc *writeconcern.WriteConcern) TxnOption {
+	return func(o *txnOptions) {
+		o.writeConcern = wc
+	}
+}
+
+// WithTxnReadPreference sets the read preference of the transaction; transactions read from the primary by default
+func WithTxnReadPreference(rp *readpref.ReadPref) TxnOption {
+	return func(o *txnOptions) {
+		o.readPref = rp
+	}
+}
+
+// WithTxnMaxCommitTime bounds the time the server spends on the commit
+func WithTxnMaxCommitTime(d time.Duration) TxnOption {
+	return func(o *txnOptions) {
+		o.maxCommit = d
+	}
+}
+
+// WithTxnRetries sets how often a transaction failing with a transient error (or a commit with an
+// unknown result) is retried (defaults to 3; 0 disables retries)
+func WithTxnRetries(n int) TxnOption {
+	return func(o *txnOptions) {
+		o.retries = max(n, 0)
+	}
+}
+
+// WithTxnBackoff sets the wait before the first retry, doubled per retry up to maxBackoff
+func WithTxnBackoff(backoff, maxBackoff time.Duration) TxnOption {
+	return func(o *txnOptions) {
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithTxnJitter randomizes the wait between retries (between zero and the backoff), so
+// transactions conflicting on the same documents do not retry in lockstep
+func WithTxnJitter(enabled bool) TxnOption {
+	return func(o *txnOptions) {
+		o.jitter = enabled
+	}
+}
+
+// WithTxnLabel sets the label write conflicts are counted under; it defaults to the operation
+// label of the context (see WithOpLabel), bounded by op_labels
+func WithTxnLabel(label string) TxnOption {
+	return func(o *txnOptions) {
+		o.label = label
+	}
+}
+
+// WithTransaction runs fn in a transaction and commits it. A transaction failing with a
+// TransientTransactionError (write conflicts, elections) is aborted and run again, and a commit
+// with an UnknownTransactionCommitResult is retried, waiting with exponential backoff in between;
+// fn must therefore be safe to run more than once. Operations inside fn must use sessCtx.
+// Commits, aborts and retries are counted in the transaction metrics; write conflicts are counted
+// per transaction label and logged with the conflicting collections when they pile up.
+func (p *PlugMongoDB) WithTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error, opts ...TxnOption) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if fn == nil {
+		return fmt.Errorf("transaction function cannot be nil")
+	}
+	o := txnOptions{retries: defaultTxnRetries, backoff: defaultTxnBackoff, maxBackoff: defaultTxnMaxBackoff}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.label == "" {
+		o.label = metricOpLabel(OpLabel(ctx), p.opLabelSet())
+	}
+	s := p.stateFor(ctx)
+	if s == nil {
+		return errClientNotInitialized
+	}
+
+	sess, err := s.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer p.TrackSession(sess)()
+	defer sess.EndSession(context.WithoutCancel(ctx))
+	tracker := &txnTracker{}
+	sessCtx := mongo.NewSessionContext(context.WithValue(ctx, txnTrackerKey{}, tracker), sess)
+
+	conflicts := 0
+	for attempt := 0; ; attempt++ {
+		err := p.runTransaction(sessCtx, sess, fn, o)
+		conflict := isWriteConflict(err)
+		p.prometheusMetrics.RecordTxnConflictRatio(p.config(), o.label, p.txnConflicts.observe(o.label, conflict))
+		if err == nil {
+			p.prometheusMetrics.RecordTransaction(p.config(), "committed")
+			return nil
+		}
+		p.prometheusMetrics.RecordTransaction(p.config(), "aborted")
+		retry := hasErrorLabel(err, labelTransientTransaction) && attempt < o.retries
+		if conflict {
+			conflicts++
+			p.onTxnConflict(ctx, o.label, tracker, conflicts, !retry, err)
+		}
+		if !retry {
+			return err
+		}
+		p.prometheusMetrics.RecordTransactionRetry(p.config(), "transient")
+		if err := sleepContext(ctx, o.backoffFor(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// runTransaction runs one attempt of fn and commits it, retrying a commit whose result is unknown
+func (p *PlugMongoDB) runTransaction(sessCtx mongo.SessionContext, sess mongo.Session, fn func(mongo.SessionContext) error, o txnOptions) error {
+	txnOpts := options.Transaction()
+	if o.readConcern != nil {
+		txnOpts.SetReadConcern(o.readConcern)
+	}
+	if o.writeConcern != nil {
+		txnOpts.SetWriteConcern(o.writeConcern)
+	}
+	if o.readPref != nil {
+		txnOpts.SetReadPreference(o.readPref)
+	}
+	if o.maxCommit > 0 {
+		txnOpts.SetMaxCommitTime(&o.maxCommit)
+	}
+	if err := sess.StartTransaction(txnOpts); err != nil {
+		return err
+	}
+	if err := fn(sessCtx); err != nil {
+		_ = sess.AbortTransaction(context.WithoutCancel(sessCtx))
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err := sess.CommitTransaction(sessCtx)
+		if err == nil || !hasErrorLabel(err, labelUnknownCommitResult) || attempt >= o.retries {
+			return err
+		}
+		p.prometheusMetrics.RecordTransactionRetry(p.config(), "unknown_commit_result")
+		if err := sleepContext(sessCtx, o.backoffFor(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// backoffFor returns the wait before retry attempt+1
+func (o txnOptions) backoffFor(attempt int) time.Duration {
+	d := o.backoff
+	for i := 0; i < attempt && d < o.maxBackoff; i++ {
+		d *= 2
+	}
+	if o.maxBackoff > 0 {
+		d = min(d, o.maxBackoff)
+	}
+	if o.jitter && d > 0 {
+		d = rand.N(d + 1)
+	}
+	return d
+}
+
+// hasErrorLabel reports whether err carries the server error label
+func hasErrorLabel(err error, label string) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(label)
+}
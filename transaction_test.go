@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTxnBackoff(t *testing.T) {
+	o := txnOptions{backoff: 10 * time.Millisecond, maxBackoff: 50 * time.Millisecond}
+	for attempt, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := o.backoffFor(attempt); got != want*time.Millisecond {
+			t.Errorf("backoffFor(%d) = %v, want %v", attempt, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestHasErrorLabel(t *testing.T) {
+	err := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{labelTransientTransaction}}
+	if !hasErrorLabel(err, labelTransientTransaction) || !hasErrorLabel(errors.Join(errors.New("update"), err), labelTransientTransaction) {
+		t.Error("expected the transient transaction label to be found")
+	}
+	if hasErrorLabel(err, labelUnknownCommitResult) || hasErrorLabel(errors.New("plain"), labelTransientTransaction) {
+		t.Error("unexpected label")
+	}
+}
+
+func TestWithTransactionRetries(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test"})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	if err := p.WithTransaction(t.Context(), func(mongo.SessionContext) error { return nil }); err == nil {
+		t.Error("expected an error without client")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+	if err := p.WithTransaction(t.Context(), nil); err == nil {
+		t.Error("expected an error without transaction function")
+	}
+
+	calls := 0
+	conflict := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{labelTransientTransaction}}
+	err = p.WithTransaction(t.Context(), func(sessCtx mongo.SessionContext) error {
+		calls++
+		if mongo.SessionFromContext(sessCtx) == nil {
+			t.Error("expected a session in the transaction context")
+		}
+		return conflict
+	}, WithTxnRetries(2), WithTxnBackoff(time.Millisecond, time.Millisecond))
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) || ce.Code != 112 || calls != 3 {
+		t.Errorf("expected three attempts ending with the conflict, got %d: %v", calls, err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.transactionsTotal.WithLabelValues("test", "aborted")); got != 3 {
+		t.Errorf("transactions_total{result=aborted} = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.txnRetriesTotal.WithLabelValues("test", "transient")); got != 2 {
+		t.Errorf("transaction_retries_total{reason=transient} = %v, want 2", got)
+	}
+
+	calls = 0
+	failure := errors.New("validation failed")
+	err = p.WithTransaction(t.Context(), func(mongo.SessionContext) error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) || calls != 1 {
+		t.Errorf("expected a non-transient error not to be retried, got %d calls: %v", calls, err)
+	}
+}
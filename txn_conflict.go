@@ -0,0 +1,152 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// codeWriteConflict is returned when a transaction writes a document another one modified
+	codeWriteConflict = 112
+	// txnConflictWindow is the number of recent attempts per label the conflict ratio covers
+	txnConflictWindow = 100
+	// txnConflictStorm is the number of write conflicts within one WithTransaction call reported as a retry storm
+	txnConflictStorm = 3
+	// txnConflictWarnInterval rate-limits retry storm logs per label
+	txnConflictWarnInterval = time.Minute
+)
+
+// txnConflictState keeps the recent attempt outcomes of each transaction label
+type txnConflictState struct {
+	mu     sync.Mutex
+	labels map[string]*txnConflictWindowState
+}
+
+type txnConflictWindowState struct {
+	outcomes  [txnConflictWindow]bool
+	next      int
+	seen      int
+	conflicts int
+	warnAt    time.Time
+}
+
+// txnTracker follows the commands of one WithTransaction call, so write conflicts can be
+// attributed to collections; the command monitor finds it in the operation context
+type txnTracker struct {
+	mu sync.Mutex
+	// requestID -> collection of running commands
+	running     map[int64]string
+	conflicting []string
+}
+
+type txnTrackerKey struct{}
+
+// isWriteConflict reports whether err is a WriteConflict
+func isWriteConflict(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorCode(codeWriteConflict)
+}
+
+// observe records an attempt of label and returns the conflict ratio of its recent attempts
+func (s *txnConflictState) observe(label string, conflict bool) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.labels == nil {
+		s.labels = make(map[string]*txnConflictWindowState)
+	}
+	w := s.labels[label]
+	if w == nil {
+		w = &txnConflictWindowState{}
+		s.labels[label] = w
+	}
+	if w.seen >= txnConflictWindow && w.outcomes[w.next] {
+		w.conflicts--
+	}
+	w.outcomes[w.next] = conflict
+	if conflict {
+		w.conflicts++
+	}
+	w.next = (w.next + 1) % txnConflictWindow
+	w.seen++
+	return float64(w.conflicts) / float64(min(w.seen, txnConflictWindow))
+}
+
+// shouldWarn rate-limits retry storm warnings of label
+func (s *txnConflictState) shouldWarn(label string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.labels[label]
+	if w == nil || now.Sub(w.warnAt) < txnConflictWarnInterval {
+		return false
+	}
+	w.warnAt = now
+	return true
+}
+
+// onTxnConflict counts a write conflict of a transaction attempt. A call conflicting repeatedly, or
+// giving up after a conflict, is logged as a retry storm with the collections the conflicts happened on.
+func (p *PlugMongoDB) onTxnConflict(ctx context.Context, label string, tracker *txnTracker, conflicts int, gaveUp bool, err error) {
+	collections := tracker.conflictCollections()
+	p.prometheusMetrics.RecordTxnConflict(p.config(), label)
+	log.Debugf("mongodb transaction %q write conflict %d on %s: %v", label, conflicts, strings.Join(collections, ","), err)
+	if (conflicts < txnConflictStorm && !gaveUp) || !p.txnConflicts.shouldWarn(label, time.Now()) {
+		return
+	}
+	log.WarnwCtx(ctx, "key", "mongodb", "event", "transaction_conflict_storm", "label", label,
+		"conflicts", conflicts, "gave_up", gaveUp, "collections", collections, "error", err)
+}
+
+func (t *txnTracker) started(requestID int64, collection string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running == nil {
+		t.running = make(map[int64]string)
+	}
+	t.running[requestID] = collection
+}
+
+func (t *txnTracker) finished(requestID int64, conflict bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	collection, ok := t.running[requestID]
+	delete(t.running, requestID)
+	if ok && conflict && collection != "" && !slices.Contains(t.conflicting, collection) {
+		t.conflicting = append(t.conflicting, collection)
+	}
+}
+
+func (t *txnTracker) conflictCollections() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.conflicting)
+}
+
+// createTxnConflictMonitor returns a CommandMonitor attributing write conflicts of WithTransaction
+// calls to the collections of the failing commands
+func (p *PlugMongoDB) createTxnConflictMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			if t, ok := ctx.Value(txnTrackerKey{}).(*txnTracker); ok {
+				t.started(evt.RequestID, commandCollection(evt.Command))
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			if t, ok := ctx.Value(txnTrackerKey{}).(*txnTracker); ok {
+				t.finished(evt.RequestID, false)
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			if t, ok := ctx.Value(txnTrackerKey{}).(*txnTracker); ok {
+				t.finished(evt.RequestID, strings.Contains(evt.Failure, "WriteConflict"))
+			}
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIsWriteConflict(t *testing.T) {
+	conflict := mongo.CommandError{Code: codeWriteConflict, Name: "WriteConflict"}
+	if !isWriteConflict(conflict) || !isWriteConflict(errors.Join(errors.New("update"), conflict)) {
+		t.Error("expected a write conflict")
+	}
+	if isWriteConflict(mongo.CommandError{Code: 11000}) || isWriteConflict(errors.New("plain")) || isWriteConflict(nil) {
+		t.Error("unexpected write conflict")
+	}
+}
+
+func TestTxnConflictRatio(t *testing.T) {
+	var s txnConflictState
+	if got := s.observe("orders", true); got != 1 {
+		t.Errorf("ratio = %v, want 1", got)
+	}
+	if got := s.observe("orders", false); got != 0.5 {
+		t.Errorf("ratio = %v, want 0.5", got)
+	}
+	for range txnConflictWindow {
+		s.observe("orders", false)
+	}
+	if got := s.observe("orders", true); got != 0.01 {
+		t.Errorf("ratio after the window rolled over = %v, want 0.01", got)
+	}
+	if got := s.observe("carts", false); got != 0 {
+		t.Errorf("labels should be tracked separately, got %v", got)
+	}
+
+	now := time.Now()
+	if !s.shouldWarn("orders", now) || s.shouldWarn("orders", now.Add(time.Second)) {
+		t.Error("expected one warning per interval")
+	}
+	if !s.shouldWarn("orders", now.Add(txnConflictWarnInterval)) {
+		t.Error("expected a warning after the interval")
+	}
+}
+
+func TestTxnJitter(t *testing.T) {
+	o := txnOptions{backoff: 10 * time.Millisecond, maxBackoff: 40 * time.Millisecond, jitter: true}
+	for attempt := range 5 {
+		if got := o.backoffFor(attempt); got < 0 || got > 40*time.Millisecond {
+			t.Errorf("backoffFor(%d) = %v, want within [0, 40ms]", attempt, got)
+		}
+	}
+}
+
+func TestTxnConflictMonitor(t *testing.T) {
+	p := NewMongoDBClient()
+	m := p.createTxnConflictMonitor()
+	tracker := &txnTracker{}
+	ctx := context.WithValue(t.Context(), txnTrackerKey{}, tracker)
+
+	m.Started(ctx, &event.CommandStartedEvent{Command: txnCommand(t, "update", "orders"), RequestID: 1})
+	m.Started(ctx, &event.CommandStartedEvent{Command: txnCommand(t, "find", "carts"), RequestID: 2})
+	m.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1}, Failure: "(WriteConflict) Write conflict during plan execution"})
+	m.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 2}})
+	// commands outside WithTransaction are ignored
+	m.Started(t.Context(), &event.CommandStartedEvent{Command: txnCommand(t, "update", "users"), RequestID: 3})
+
+	if got := tracker.conflictCollections(); len(got) != 1 || got[0] != "orders" {
+		t.Errorf("conflicting collections = %v, want [orders]", got)
+	}
+	if len(tracker.running) != 0 {
+		t.Errorf("expected finished commands to be forgotten, got %v", tracker.running)
+	}
+}
+
+func txnCommand(t *testing.T, name, collection string) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(bson.D{{Key: name, Value: collection}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestWithTransactionConflicts(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{Database: "test", OpLabels: []string{"checkout"}})
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1/?serverSelectionTimeoutMS=50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	p.swapState(newClientState(client, "test"))
+
+	conflict := mongo.CommandError{Code: codeWriteConflict, Name: "WriteConflict", Labels: []string{labelTransientTransaction}}
+	calls := 0
+	err = p.WithTransaction(WithOpLabel(t.Context(), "checkout"), func(sessCtx mongo.SessionContext) error {
+		calls++
+		if calls < 3 {
+			return conflict
+		}
+		return nil
+	}, WithTxnJitter(true), WithTxnBackoff(time.Millisecond, time.Millisecond))
+	if err != nil || calls != 3 {
+		t.Fatalf("expected the third attempt to commit, got %d calls: %v", calls, err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.txnConflicts.WithLabelValues("test", "checkout")); got != 2 {
+		t.Errorf("transaction_write_conflicts_total{label=checkout} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.txnConflictRatio.WithLabelValues("test", "checkout")); got < 0.66 || got > 0.67 {
+		t.Errorf("transaction_conflict_ratio{label=checkout} = %v, want 2/3", got)
+	}
+
+	err = p.WithTransaction(t.Context(), func(mongo.SessionContext) error { return conflict },
+		WithTxnLabel("inventory"), WithTxnRetries(0))
+	if !isWriteConflict(err) {
+		t.Errorf("expected the conflict to be returned, got %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.txnConflictRatio.WithLabelValues("test", "inventory")); got != 1 {
+		t.Errorf("transaction_conflict_ratio{label=inventory} = %v, want 1", got)
+	}
+}
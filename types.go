@@ -3,28 +3,68 @@ package mongodb
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-lynx/lynx-mongodb/conf"
 	"github.com/go-lynx/lynx/plugins"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PlugMongoDB represents a MongoDB plugin instance
 type PlugMongoDB struct {
 	// Inherits from base plugin
 	*plugins.BasePlugin
-	// MongoDB configuration
-	conf *conf.MongoDB
-	// MongoDB client instance
-	client *mongo.Client
-	// MongoDB database instance
-	database *mongo.Database
+	// MongoDB configuration, replaced as a whole by Reload (see config)
+	conf atomic.Pointer[conf.MongoDB]
+	// Serializes configuration reloads
+	reloadMu sync.Mutex
+	// MongoDB client and database handle, swapped atomically (see clientState)
+	state atomic.Pointer[clientState]
+	// Custom BSON registry (nil when the driver default is used)
+	registry *bsoncodec.Registry
+	// Owner label budgets, read-only once the client is created
+	budgets map[string]*opBudget
+	// Latency SLOs, read-only once the client is created
+	slos []*sloTracker
+	// Hot document tracker (nil unless hot_documents is enabled), set when the client is created
+	hotDocs *hotDocuments
+	// Load shedder (nil unless load_shedding or a shed policy is set), set when the client is created
+	shed *loadShedder
+	// Custom load shedding policy set with WithShedPolicy
+	shedPolicy ShedPolicy
+	// Custom retry policy set with WithRetryPolicy
+	customRetryPolicy RetryPolicy
+	// Publisher of outbox entries set with WithOutboxPublisher; the relay runs when it is set
+	outboxPublisher OutboxPublisher
+	// Serializes outbox relay passes
+	outboxMu sync.Mutex
+	// Priority concurrency limiter (nil unless priority_concurrency is set), set when the client is created
+	priorities *priorityLimiter
+	// Circuit breaker (nil unless circuit_breaker is set), set when the client is created
+	breaker *circuitBreaker
+	// Write buffer of primary elections (nil unless write_buffer is enabled), set when the client is created
+	writeBuffer *writeBuffer
+	// Standby client and switchover state (nil unless failover is set), set when the client is created
+	failover *failover
+	// Recent write conflict ratios of WithTransaction, by transaction label
+	txnConflicts txnConflictState
+	// Optional receiver for audit events
+	auditHook AuditHook
+	// Resolver of the seed list set with WithHostResolver
+	hostResolver HostResolver
+	// Dialer of connections set with WithDialer (nil builds one from the dialer settings)
+	dialer options.ContextDialer
+	// Tracer provider of command spans (nil uses the global provider)
+	tracerProvider trace.TracerProvider
 	// Runtime with plugin context for publishing private/shared resources
 	rt plugins.Runtime
 	// Prometheus metrics (nil if EnableMetrics is false)
 	prometheusMetrics *PrometheusMetrics
-	// Pool monitor: number of checked-out connections (for Prometheus)
-	poolActiveConns int64
+	// Time codec: number of non-UTC writes and last warning timestamp (unix nanos)
+	localTimeWrites int64
+	localTimeWarnAt int64
 	// Metrics collection
 	statsQuit     chan struct{}
 	statsWG       sync.WaitGroup
@@ -32,6 +72,38 @@ type PlugMongoDB struct {
 	statsMu       sync.Mutex
 	metricsCancel func()
 	healthCancel  func()
-	lifecycleCtx  context.Context
-	lifecycleStop context.CancelFunc
+	// Resources released on Stop before the client disconnects
+	cleanup cleanupRegistry
+	// Runtime debug toggles (command logging, slow-query threshold, driver log level)
+	debug debugState
+	// Per-member health from server monitoring
+	nodes nodeHealthTracker
+	// Smart read fallback state
+	smartReads smartReadState
+	// Server version and deployment, for FeatureSupported
+	serverInfo serverInfo
+	// Last schema registry drift check, for SchemaInventory
+	schemaDrift schemaDriftState
+	// Maintenance window and DDL queued until it opens
+	ddl ddlState
+	// Collection statistics behind Stats
+	stats statsCache
+	// Plan cache keys of the previous poll, by collection
+	planCache planCacheState
+	// Previous serverStatus counters and privilege state, for storage engine metrics
+	serverStatus serverStatusState
+	// Whether the server refused reading the oplog window
+	oplogGate privilegeGate
+	// Last backup freshness result, for EventBackupStale
+	backup backupState
+	// Last resolved SRV seed list and TXT options, for EventSeedListChanged
+	srv srvState
+	// Last health check result, for health events
+	health healthTracker
+	// Maintenance mode and helper operations in flight
+	maintenance maintenanceGate
+	// Periodic background tasks by name (see startPeriodicTask)
+	periodicCancels map[string]context.CancelFunc
+	lifecycleCtx    context.Context
+	lifecycleStop   context.CancelFunc
 }
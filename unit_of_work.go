@@ -0,0 +1,290 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Unit of work outcomes, as reported in the unit of work metric
+const (
+	unitCommitted = "committed"
+	unitDiscarded = "discarded"
+	unitFailed    = "failed"
+)
+
+// ErrUnitOfWorkClosed is returned when writes are staged to, or a commit is requested from, a unit
+// of work already committed or discarded
+var ErrUnitOfWorkClosed = errors.New("unit of work is already committed or discarded")
+
+// Savepoint marks the writes staged so far in a unit of work (see RollbackTo)
+type Savepoint int
+
+// stagedWrite is a write of a unit of work
+type stagedWrite struct {
+	collection string
+	model      mongo.WriteModel
+}
+
+// UnitOfWork stages writes issued by the code paths of a request and applies them together in one
+// transaction on Commit, or drops them on Discard. Staged writes are not visible to reads before
+// the commit. Documents read with Repository.FindByID are tracked by an identity map, and their
+// changes are written on Commit. A UnitOfWork is safe for concurrent use.
+type UnitOfWork struct {
+	p *PlugMongoDB
+
+	mu     sync.Mutex
+	writes []stagedWrite
+	closed bool
+	// tracked is the identity map, by collection and _id; trackOrder keeps the loading order
+	tracked    map[string]*trackedDocument
+	trackOrder []*trackedDocument
+}
+
+type unitOfWorkKey struct{}
+
+// NewUnitOfWork returns an empty unit of work
+func (p *PlugMongoDB) NewUnitOfWork() *UnitOfWork {
+	return &UnitOfWork{p: p}
+}
+
+// WithUnitOfWork returns a context carrying u, retrieved with UnitOfWorkFrom by the code paths of
+// the request
+func WithUnitOfWork(ctx context.Context, u *UnitOfWork) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, unitOfWorkKey{}, u)
+}
+
+// UnitOfWorkFrom returns the unit of work of ctx
+func UnitOfWorkFrom(ctx context.Context) (*UnitOfWork, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	u, ok := ctx.Value(unitOfWorkKey{}).(*UnitOfWork)
+	return u, ok && u != nil
+}
+
+// Stage appends write models on collection, applied in staging order on Commit. Filters and
+// documents are checked against the scope and write guards of the commit context.
+func (u *UnitOfWork) Stage(collection string, models ...mongo.WriteModel) error {
+	if collection == "" {
+		return fmt.Errorf("collection name cannot be empty")
+	}
+	for i, model := range models {
+		if model == nil {
+			return fmt.Errorf("staged write %d on %s is nil", i, collection)
+		}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return ErrUnitOfWorkClosed
+	}
+	for _, model := range models {
+		u.writes = append(u.writes, stagedWrite{collection: collection, model: model})
+	}
+	return nil
+}
+
+// Insert stages inserting doc into collection
+func (u *UnitOfWork) Insert(collection string, doc any) error {
+	return u.Stage(collection, mongo.NewInsertOneModel().SetDocument(doc))
+}
+
+// UpdateOne stages updating the first document of collection matching filter
+func (u *UnitOfWork) UpdateOne(collection string, filter, update any) error {
+	return u.Stage(collection, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+}
+
+// UpdateMany stages updating the documents of collection matching filter
+func (u *UnitOfWork) UpdateMany(collection string, filter, update any) error {
+	return u.Stage(collection, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update))
+}
+
+// Upsert stages updating the first document of collection matching filter, inserting one when none
+// matches
+func (u *UnitOfWork) Upsert(collection string, filter, update any) error {
+	return u.Stage(collection, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+}
+
+// ReplaceOne stages replacing the first document of collection matching filter
+func (u *UnitOfWork) ReplaceOne(collection string, filter, replacement any) error {
+	return u.Stage(collection, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement))
+}
+
+// DeleteOne stages deleting the first document of collection matching filter
+func (u *UnitOfWork) DeleteOne(collection string, filter any) error {
+	return u.Stage(collection, mongo.NewDeleteOneModel().SetFilter(filter))
+}
+
+// DeleteMany stages deleting the documents of collection matching filter
+func (u *UnitOfWork) DeleteMany(collection string, filter any) error {
+	return u.Stage(collection, mongo.NewDeleteManyModel().SetFilter(filter))
+}
+
+// Len returns the number of staged writes
+func (u *UnitOfWork) Len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.writes)
+}
+
+// Savepoint marks the writes staged so far, so a failing step can drop its own writes with
+// RollbackTo and let the rest of the request commit
+func (u *UnitOfWork) Savepoint() Savepoint {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return Savepoint(len(u.writes))
+}
+
+// RollbackTo drops the writes staged after sp. Savepoints taken after sp become invalid.
+func (u *UnitOfWork) RollbackTo(sp Savepoint) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return ErrUnitOfWorkClosed
+	}
+	if sp < 0 || int(sp) > len(u.writes) {
+		return fmt.Errorf("savepoint %d is past the %d staged writes", sp, len(u.writes))
+	}
+	clear(u.writes[sp:])
+	u.writes = u.writes[:sp]
+	return nil
+}
+
+// Discard drops the staged writes and closes the unit of work. Discarding a closed unit of work is
+// a no-op.
+func (u *UnitOfWork) Discard() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return
+	}
+	u.closed, u.writes = true, nil
+	u.tracked, u.trackOrder = nil, nil
+	u.p.prometheusMetrics.RecordUnitOfWork(u.p.config(), unitDiscarded)
+}
+
+// Commit applies the staged writes in one transaction (see WithTransaction) and closes the unit of
+// work. The changed fields of tracked documents are written after the staged writes, one $set and
+// $unset update per changed document; unchanged documents are not written. Consecutive writes on a
+// collection are sent as one ordered bulk write. Any failed write
+// aborts the transaction, and the error is the first failure. Inside a running transaction, the
+// writes join it instead. A unit of work without writes commits without a transaction. Commit
+// closes the unit of work even when it fails: the writes are not kept for another attempt.
+func (u *UnitOfWork) Commit(ctx context.Context, opts ...TxnOption) (*BulkResult, error) {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return nil, ErrUnitOfWorkClosed
+	}
+	dirty, clean, err := u.dirtyWrites()
+	writes := append(u.writes, dirty...)
+	u.closed, u.writes = true, nil
+	u.tracked, u.trackOrder = nil, nil
+	u.mu.Unlock()
+	if err != nil {
+		u.p.prometheusMetrics.RecordUnitOfWork(u.p.config(), unitFailed)
+		return nil, err
+	}
+
+	result := &BulkResult{}
+	if len(writes) == 0 {
+		u.recordCommitted(dirty, clean)
+		u.p.prometheusMetrics.RecordUnitOfWork(u.p.config(), unitCommitted)
+		return result, nil
+	}
+	apply := func(ctx context.Context) error {
+		// The transaction may run again after a transient error: count only the last attempt
+		*result = BulkResult{}
+		return u.apply(ctx, writes, result)
+	}
+	if inTransaction(ctx) {
+		err = apply(ctx)
+	} else {
+		err = u.p.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error { return apply(sessCtx) }, opts...)
+	}
+	if err != nil {
+		u.p.prometheusMetrics.RecordUnitOfWork(u.p.config(), unitFailed)
+		return result, fmt.Errorf("unit of work of %d writes failed: %w", len(writes), err)
+	}
+	u.recordCommitted(dirty, clean)
+	u.p.prometheusMetrics.RecordUnitOfWork(u.p.config(), unitCommitted)
+	return result, nil
+}
+
+// apply runs writes in order, one bulk write per run of writes on the same collection, and merges
+// their results into result by position in writes
+func (u *UnitOfWork) apply(ctx context.Context, writes []stagedWrite, result *BulkResult) error {
+	for start := 0; start < len(writes); {
+		end := start + 1
+		for end < len(writes) && writes[end].collection == writes[start].collection {
+			end++
+		}
+		models := make([]mongo.WriteModel, end-start)
+		for i, w := range writes[start:end] {
+			models[i] = w.model
+		}
+		res, err := u.p.BulkWrite(ctx, writes[start].collection, models, BulkOptions{Ordered: true})
+		result.merge(start, res)
+		if err != nil {
+			result.Skipped += len(writes) - end
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// merge adds the result of the bulk write of the writes at offset
+func (r *BulkResult) merge(offset int, res *BulkResult) {
+	if res == nil {
+		return
+	}
+	r.InsertedCount += res.InsertedCount
+	r.MatchedCount += res.MatchedCount
+	r.ModifiedCount += res.ModifiedCount
+	r.DeletedCount += res.DeletedCount
+	r.UpsertedCount += res.UpsertedCount
+	r.Batches += res.Batches
+	r.Skipped += res.Skipped
+	for i, id := range res.UpsertedIDs {
+		if r.UpsertedIDs == nil {
+			r.UpsertedIDs = make(map[int]any)
+		}
+		r.UpsertedIDs[offset+i] = id
+	}
+	for _, f := range res.Failures {
+		f.Index += offset
+		r.Failures = append(r.Failures, f)
+	}
+}
+
+// UnitOfWorkMiddleware is a Kratos middleware giving every request a unit of work, retrieved by
+// handlers with UnitOfWorkFrom. The writes staged by the handler are committed in one transaction
+// when it returns without error and discarded otherwise; a failed commit becomes the error of the
+// request, so place KratosErrors outside of it to convert it.
+//
+//	http.Middleware(mongodb.KratosErrors(), plugin.UnitOfWorkMiddleware())
+func (p *PlugMongoDB) UnitOfWorkMiddleware(opts ...TxnOption) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			u := p.NewUnitOfWork()
+			reply, err := next(WithUnitOfWork(ctx, u), req)
+			if err != nil {
+				u.Discard()
+				return reply, err
+			}
+			if _, err := u.Commit(ctx, opts...); err != nil && !errors.Is(err, ErrUnitOfWorkClosed) {
+				return nil, err
+			}
+			return reply, nil
+		}
+	}
+}
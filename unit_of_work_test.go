@@ -0,0 +1,116 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUnitOfWorkStaging(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	u := p.NewUnitOfWork()
+	if err := u.Insert("orders", bson.M{"_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	sp := u.Savepoint()
+	_ = u.UpdateOne("stock", bson.M{"sku": "a"}, bson.M{"$inc": bson.M{"qty": -1}})
+	_ = u.DeleteMany("carts", bson.M{"user": 7})
+	if u.Len() != 3 {
+		t.Fatalf("staged %d writes", u.Len())
+	}
+	if err := u.RollbackTo(sp); err != nil || u.Len() != 1 {
+		t.Fatalf("RollbackTo = %v, %d writes left", err, u.Len())
+	}
+	if err := u.RollbackTo(Savepoint(5)); err == nil {
+		t.Error("rolling back to a dropped savepoint should fail")
+	}
+	if err := u.Stage("", mongo.NewDeleteOneModel().SetFilter(bson.M{})); err == nil {
+		t.Error("staging without collection should fail")
+	}
+	if err := u.Stage("orders", nil); err == nil {
+		t.Error("staging a nil model should fail")
+	}
+
+	u.Discard()
+	u.Discard()
+	if err := u.Insert("orders", bson.M{"_id": 2}); !errors.Is(err, ErrUnitOfWorkClosed) {
+		t.Errorf("staging after Discard = %v", err)
+	}
+	if _, err := u.Commit(t.Context()); !errors.Is(err, ErrUnitOfWorkClosed) {
+		t.Errorf("Commit after Discard = %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.unitsOfWork.WithLabelValues("test", unitDiscarded)); got != 1 {
+		t.Errorf("discarded units = %v", got)
+	}
+}
+
+func TestUnitOfWorkCommit(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	if _, err := p.NewUnitOfWork().Commit(t.Context()); err != nil {
+		t.Errorf("an empty unit of work should commit without a client: %v", err)
+	}
+
+	u := p.NewUnitOfWork()
+	_ = u.Insert("orders", bson.M{"_id": 1})
+	if _, err := u.Commit(t.Context()); !errors.Is(err, errClientNotInitialized) {
+		t.Errorf("Commit without client = %v", err)
+	}
+	if u.Len() != 0 {
+		t.Error("a failed commit should drop the writes")
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.unitsOfWork.WithLabelValues("test", unitFailed)); got != 1 {
+		t.Errorf("failed units = %v", got)
+	}
+}
+
+func TestBulkResultMerge(t *testing.T) {
+	r := &BulkResult{}
+	r.merge(0, &BulkResult{InsertedCount: 2, Batches: 1})
+	r.merge(2, &BulkResult{UpsertedCount: 1, UpsertedIDs: map[int]any{1: "x"}, Failures: []BulkFailure{{Index: 0}}, Batches: 1})
+	if r.InsertedCount != 2 || r.UpsertedIDs[3] != "x" || r.Failures[0].Index != 2 || r.Batches != 2 {
+		t.Errorf("merged = %+v", r)
+	}
+}
+
+func TestUnitOfWorkMiddleware(t *testing.T) {
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	appErr := errors.New("validation failed")
+	var staged *UnitOfWork
+	handler := p.UnitOfWorkMiddleware()(func(ctx context.Context, req any) (any, error) {
+		u, ok := UnitOfWorkFrom(ctx)
+		if !ok {
+			t.Fatal("no unit of work in the handler context")
+		}
+		staged = u
+		_ = u.Insert("orders", bson.M{"_id": 1})
+		err, _ := req.(error)
+		return "reply", err
+	})
+	if _, err := handler(t.Context(), appErr); err != appErr {
+		t.Fatalf("handler error = %v", err)
+	}
+	if staged.Len() != 0 || !errors.Is(staged.Insert("orders", nil), ErrUnitOfWorkClosed) {
+		t.Error("the writes of a failed request should be discarded")
+	}
+
+	// The commit fails without a client and becomes the error of the request
+	reply, err := handler(t.Context(), nil)
+	if !errors.Is(err, errClientNotInitialized) || reply != nil {
+		t.Errorf("failed commit = %v, %v", reply, err)
+	}
+
+	empty := p.UnitOfWorkMiddleware()(func(context.Context, any) (any, error) { return "reply", nil })
+	if reply, err := empty(t.Context(), nil); err != nil || reply != "reply" {
+		t.Errorf("request without writes = %v, %v", reply, err)
+	}
+	if _, ok := UnitOfWorkFrom(t.Context()); ok {
+		t.Error("a context without unit of work should report none")
+	}
+}
@@ -0,0 +1,205 @@
+package mongodb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// arrayFilterIdentifier matches identifiers accepted in $[<identifier>] positional operators
+var arrayFilterIdentifier = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// UpdateBuilder builds update documents with array operators and their arrayFilters.
+// Errors (invalid identifiers, conflicting paths) are collected and reported by Build.
+type UpdateBuilder struct {
+	operators []string
+	fields    map[string]bson.D
+	filters   []any
+	idents    map[string]string
+	paths     map[string]string
+	err       error
+}
+
+// NewUpdate returns an empty UpdateBuilder
+func NewUpdate() *UpdateBuilder {
+	return &UpdateBuilder{
+		fields: map[string]bson.D{},
+		idents: map[string]string{},
+		paths:  map[string]string{},
+	}
+}
+
+// Set adds {$set: {field: value}}
+func (b *UpdateBuilder) Set(field string, value any) *UpdateBuilder {
+	return b.add("$set", field, value)
+}
+
+// Unset adds {$unset: {field: ""}}
+func (b *UpdateBuilder) Unset(field string) *UpdateBuilder {
+	return b.add("$unset", field, "")
+}
+
+// Push appends values to an array: {$push: {field: {$each: values}}}
+func (b *UpdateBuilder) Push(field string, values ...any) *UpdateBuilder {
+	return b.add("$push", field, bson.D{{Key: "$each", Value: bson.A(values)}})
+}
+
+// PushCapped appends values and keeps the array bounded: a positive limit keeps the first
+// elements, a negative limit keeps the last ones (e.g. -50 for "latest 50"). A non-nil sort
+// ({"ts": -1} or 1/-1 for scalars) is applied before slicing.
+func (b *UpdateBuilder) PushCapped(field string, limit int, sort any, values ...any) *UpdateBuilder {
+	spec := bson.D{{Key: "$each", Value: bson.A(values)}}
+	if sort != nil {
+		spec = append(spec, bson.E{Key: "$sort", Value: sort})
+	}
+	spec = append(spec, bson.E{Key: "$slice", Value: limit})
+	return b.add("$push", field, spec)
+}
+
+// AddToSet adds values that are not already present: {$addToSet: {field: {$each: values}}}
+func (b *UpdateBuilder) AddToSet(field string, values ...any) *UpdateBuilder {
+	return b.add("$addToSet", field, bson.D{{Key: "$each", Value: bson.A(values)}})
+}
+
+// Pull removes elements matching predicate: a value, an operator document ({"$lt": 5}) or,
+// for arrays of documents, a condition on element fields ({"status": "expired"})
+func (b *UpdateBuilder) Pull(field string, predicate any) *UpdateBuilder {
+	return b.add("$pull", field, predicate)
+}
+
+// PullAll removes all listed values: {$pullAll: {field: values}}
+func (b *UpdateBuilder) PullAll(field string, values ...any) *UpdateBuilder {
+	return b.add("$pullAll", field, bson.A(values))
+}
+
+// SetPositional sets subPath of the first array element matched by the query filter ("field.$.subPath").
+// The filter passed to UpdateOne/UpdateMany must match on the array field.
+func (b *UpdateBuilder) SetPositional(field, subPath string, value any) *UpdateBuilder {
+	return b.Set(elementPath(field, "$", subPath), value)
+}
+
+// SetAll sets subPath of every element of the array ("field.$[].subPath")
+func (b *UpdateBuilder) SetAll(field, subPath string, value any) *UpdateBuilder {
+	return b.Set(elementPath(field, "$[]", subPath), value)
+}
+
+// SetFiltered sets subPath of the array elements matching condition ("field.$[identifier].subPath")
+// and registers the matching arrayFilter. Condition keys are relative to the element
+// ({"qty": {"$lt": 5}}); use an empty key to match scalar elements ({"": {"$gte": 100}}).
+func (b *UpdateBuilder) SetFiltered(field, identifier string, condition bson.D, subPath string, value any) *UpdateBuilder {
+	if !b.addFilter(identifier, condition) {
+		return b
+	}
+	return b.Set(elementPath(field, "$["+identifier+"]", subPath), value)
+}
+
+// IncFiltered increments subPath of the array elements matching condition, like SetFiltered
+func (b *UpdateBuilder) IncFiltered(field, identifier string, condition bson.D, subPath string, delta any) *UpdateBuilder {
+	if !b.addFilter(identifier, condition) {
+		return b
+	}
+	return b.add("$inc", elementPath(field, "$["+identifier+"]", subPath), delta)
+}
+
+// Build returns the update document
+func (b *UpdateBuilder) Build() (bson.D, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.operators) == 0 {
+		return nil, fmt.Errorf("update is empty")
+	}
+	update := make(bson.D, 0, len(b.operators))
+	for _, op := range b.operators {
+		update = append(update, bson.E{Key: op, Value: b.fields[op]})
+	}
+	return update, nil
+}
+
+// ArrayFilters returns the arrayFilters registered by SetFiltered/IncFiltered
+func (b *UpdateBuilder) ArrayFilters() []any {
+	return b.filters
+}
+
+// UpdateOptions returns update options carrying the registered arrayFilters
+func (b *UpdateBuilder) UpdateOptions() *options.UpdateOptions {
+	opts := options.Update()
+	if len(b.filters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: b.filters})
+	}
+	return opts
+}
+
+func (b *UpdateBuilder) add(operator, field string, value any) *UpdateBuilder {
+	if b.err != nil {
+		return b
+	}
+	if field == "" {
+		b.err = fmt.Errorf("%s: field name cannot be empty", operator)
+		return b
+	}
+	if prev, ok := b.paths[field]; ok {
+		b.err = fmt.Errorf("field %q is updated by both %s and %s", field, prev, operator)
+		return b
+	}
+	for path, prev := range b.paths {
+		if strings.HasPrefix(field, path+".") || strings.HasPrefix(path, field+".") {
+			b.err = fmt.Errorf("paths %q (%s) and %q (%s) conflict", path, prev, field, operator)
+			return b
+		}
+	}
+	b.paths[field] = operator
+	if _, ok := b.fields[operator]; !ok {
+		b.operators = append(b.operators, operator)
+	}
+	b.fields[operator] = append(b.fields[operator], bson.E{Key: field, Value: value})
+	return b
+}
+
+// addFilter registers an arrayFilter for identifier, rejecting invalid or inconsistent identifiers
+func (b *UpdateBuilder) addFilter(identifier string, condition bson.D) bool {
+	if b.err != nil {
+		return false
+	}
+	if !arrayFilterIdentifier.MatchString(identifier) {
+		b.err = fmt.Errorf("invalid array filter identifier %q: must start with a lowercase letter and contain only letters and digits", identifier)
+		return false
+	}
+	if len(condition) == 0 {
+		b.err = fmt.Errorf("array filter %q: condition cannot be empty", identifier)
+		return false
+	}
+	filter := make(bson.D, 0, len(condition))
+	for _, e := range condition {
+		key := identifier
+		if e.Key != "" {
+			key = identifier + "." + e.Key
+		}
+		filter = append(filter, bson.E{Key: key, Value: e.Value})
+	}
+	encoded, err := bson.MarshalExtJSON(filter, true, false)
+	if err != nil {
+		b.err = fmt.Errorf("array filter %q: %w", identifier, err)
+		return false
+	}
+	if prev, ok := b.idents[identifier]; ok {
+		if prev != string(encoded) {
+			b.err = fmt.Errorf("array filter identifier %q is used with different conditions", identifier)
+			return false
+		}
+		return true
+	}
+	b.idents[identifier] = string(encoded)
+	b.filters = append(b.filters, filter)
+	return true
+}
+
+func elementPath(field, positional, subPath string) string {
+	if subPath == "" {
+		return field + "." + positional
+	}
+	return field + "." + positional + "." + subPath
+}
@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+	b := NewUpdate().
+		PushCapped("events", -50, bson.D{{Key: "ts", Value: -1}}, bson.M{"ts": 1}).
+		AddToSet("tags", "a", "b").
+		Pull("sessions", bson.D{{Key: "expired", Value: true}}).
+		SetFiltered("items", "low", bson.D{{Key: "qty", Value: bson.D{{Key: "$lt", Value: 5}}}}, "reorder", true).
+		IncFiltered("items", "low", bson.D{{Key: "qty", Value: bson.D{{Key: "$lt", Value: 5}}}}, "alerts", 1)
+
+	update, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	got, _ := bson.MarshalExtJSON(update, false, false)
+	want := `{"$push":{"events":{"$each":[{"ts":1}],"$sort":{"ts":-1},"$slice":-50}},"$addToSet":{"tags":{"$each":["a","b"]}},"$pull":{"sessions":{"expired":true}},"$set":{"items.$[low].reorder":true},"$inc":{"items.$[low].alerts":1}}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if filters := b.ArrayFilters(); len(filters) != 1 {
+		t.Fatalf("expected 1 array filter, got %d", len(filters))
+	}
+	filter, _ := bson.MarshalExtJSON(b.ArrayFilters()[0], false, false)
+	if string(filter) != `{"low.qty":{"$lt":5}}` {
+		t.Errorf("unexpected array filter %s", filter)
+	}
+	if opts := b.UpdateOptions(); opts.ArrayFilters == nil {
+		t.Error("expected array filters in update options")
+	}
+}
+
+func TestUpdateBuilderErrors(t *testing.T) {
+	cases := map[string]*UpdateBuilder{
+		"empty":              NewUpdate(),
+		"bad identifier":     NewUpdate().SetFiltered("items", "Low", bson.D{{Key: "qty", Value: 1}}, "x", 1),
+		"conflicting filter": NewUpdate().SetFiltered("a", "e", bson.D{{Key: "x", Value: 1}}, "y", 1).SetFiltered("b", "e", bson.D{{Key: "x", Value: 2}}, "y", 1),
+		"same field":         NewUpdate().Set("a", 1).Push("a", 2),
+		"parent path":        NewUpdate().Set("a", 1).Set("a.b", 2),
+	}
+	for name, b := range cases {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// Scalar element filters use the bare identifier
+	b := NewUpdate().SetFiltered("scores", "high", bson.D{{Key: "", Value: bson.D{{Key: "$gte", Value: 100}}}}, "", 100)
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	filter, _ := bson.MarshalExtJSON(b.ArrayFilters()[0], false, false)
+	if string(filter) != `{"high":{"$gte":100}}` {
+		t.Errorf("unexpected scalar array filter %s", filter)
+	}
+}
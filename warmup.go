@@ -0,0 +1,118 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultWarmUpTimeout bounds the warm-up phase when warm_up.timeout is not set
+const defaultWarmUpTimeout = 30 * time.Second
+
+// warmUp runs the configured warm-up phase: it opens min_pool_size connections eagerly and runs
+// the priming queries so the first requests after a deploy do not pay connection setup and cold
+// caches. Failures are logged and only returned when warm_up.fail_on_error is set.
+func (p *PlugMongoDB) warmUp(parentCtx context.Context) error {
+	cfg := p.config().GetWarmUp()
+	if !cfg.GetEnabled() {
+		return nil
+	}
+	timeout := cfg.GetTimeout().AsDuration()
+	if timeout <= 0 {
+		timeout = defaultWarmUpTimeout
+	}
+	ctx, cancel := p.createTimeoutContext(parentCtx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.warmPool(ctx, int(p.config().GetMinPoolSize()))
+	for _, q := range cfg.GetQueries() {
+		if err != nil {
+			break
+		}
+		err = p.runPrimingQuery(ctx, q)
+	}
+	if err != nil {
+		if cfg.GetFailOnError() {
+			return fmt.Errorf("mongodb warm-up failed: %w", err)
+		}
+		log.Warnf("mongodb warm-up incomplete after %s: %v", time.Since(start), err)
+		return nil
+	}
+	log.Infof("mongodb warm-up completed in %s (%d connections, %d priming queries)", time.Since(start), p.config().GetMinPoolSize(), len(cfg.GetQueries()))
+	return nil
+}
+
+// warmPool issues n concurrent pings, forcing the pool to establish n connections
+func (p *PlugMongoDB) warmPool(ctx context.Context, n int) error {
+	client := p.GetClient()
+	if client == nil {
+		return errClientNotInitialized
+	}
+	if n <= 0 {
+		return nil
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("failed to open %d pool connections: %w", n, firstErr)
+	}
+	return nil
+}
+
+// runPrimingQuery reads the documents matched by q to completion, loading the query plan and data
+// pages into the server caches
+func (p *PlugMongoDB) runPrimingQuery(ctx context.Context, q *conf.PrimingQuery) error {
+	if q.GetCollection() == "" {
+		return fmt.Errorf("priming query collection cannot be empty")
+	}
+	filter := bson.D{}
+	if q.GetFilter() != "" {
+		if err := bson.UnmarshalExtJSON([]byte(q.GetFilter()), false, &filter); err != nil {
+			return fmt.Errorf("invalid priming query filter for %s: %w", q.GetCollection(), err)
+		}
+	}
+	findOpts := options.Find()
+	if q.GetLimit() > 0 {
+		findOpts.SetLimit(q.GetLimit())
+	}
+
+	op := operation{name: "find", database: p.databaseName(q.GetDatabase()), collection: q.GetCollection()}
+	return p.runOperation(ctx, op, func(ctx context.Context) error {
+		db, err := p.databaseHandle(ctx, q.GetDatabase())
+		if err != nil {
+			return err
+		}
+		cursor, err := db.Collection(q.GetCollection()).Find(ctx, filter, findOpts)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+		}
+		return cursor.Err()
+	})
+}
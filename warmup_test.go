@@ -0,0 +1,37 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+)
+
+func TestWarmUp(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{MinPoolSize: 2})
+	if err := p.warmUp(context.Background()); err != nil {
+		t.Fatalf("disabled warm-up must be a no-op: %v", err)
+	}
+
+	// Without a client the warm-up fails; the failure is only returned with fail_on_error
+	WithWarmUp(time.Second, false)(p)
+	if err := p.warmUp(context.Background()); err != nil {
+		t.Errorf("expected warm-up failure to be logged only, got %v", err)
+	}
+	WithWarmUp(time.Second, true)(p)
+	if err := p.warmUp(context.Background()); err == nil {
+		t.Error("expected warm-up failure with fail_on_error")
+	}
+}
+
+func TestPrimingQueryValidation(t *testing.T) {
+	p := NewMongoDBClient()
+	if err := p.runPrimingQuery(context.Background(), &conf.PrimingQuery{}); err == nil {
+		t.Error("expected empty collection to be rejected")
+	}
+	if err := p.runPrimingQuery(context.Background(), &conf.PrimingQuery{Collection: "c", Filter: "{bad"}); err == nil {
+		t.Error("expected invalid filter to be rejected")
+	}
+}
@@ -0,0 +1,153 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type workloadKey struct{}
+
+// WithWorkload routes operations issued with the returned context to the named workload pool
+// (see workload_pools). Unknown names fall back to the default pool.
+func WithWorkload(ctx context.Context, name string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, workloadKey{}, name)
+}
+
+// Workload returns the workload pool name set with WithWorkload, or ""
+func Workload(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(workloadKey{}).(string)
+	return name
+}
+
+// connectWorkloads creates one client per configured workload pool from the base client options,
+// so pools share the connection settings but not their connections. Workload clients do not
+// report to the pool monitor, whose gauges describe the default pool.
+func (p *PlugMongoDB) connectWorkloads(ctx context.Context, cfg *conf.MongoDB, base *options.ClientOptions, state *clientState) error {
+	pools := cfg.GetWorkloadPools()
+	batch, batchPool := p.newBatchClient(cfg)
+	if batchPool != nil {
+		for _, pool := range pools {
+			if pool.GetName() == BatchWorkload {
+				return fmt.Errorf("workload pool name %q is reserved for batch_client", BatchWorkload)
+			}
+		}
+		pools = append(append([]*conf.WorkloadPool{}, pools...), batchPool)
+	}
+	state.batch = batch
+
+	for _, pool := range pools {
+		client, err := connectWorkload(ctx, base, pool)
+		if err != nil {
+			disconnectWorkloads(state)
+			return err
+		}
+		state.addWorkload(pool, client, cfg.Database)
+	}
+	return nil
+}
+
+func connectWorkload(ctx context.Context, base *options.ClientOptions, cfg *conf.WorkloadPool) (*mongo.Client, error) {
+	if cfg.GetName() == "" {
+		return nil, fmt.Errorf("workload pool name cannot be empty")
+	}
+	opts := *base
+	// Pool metrics and topology events describe the main pool
+	opts.PoolMonitor = nil
+	opts.ServerMonitor = nil
+	if cfg.GetMaxPoolSize() > 0 {
+		opts.SetMaxPoolSize(cfg.GetMaxPoolSize())
+	}
+	opts.SetMinPoolSize(cfg.GetMinPoolSize())
+	if cfg.GetSocketTimeout() != nil {
+		opts.SetSocketTimeout(cfg.GetSocketTimeout().AsDuration())
+	}
+	if cfg.GetReadPreference() != "" {
+		mode, err := readpref.ModeFromString(cfg.GetReadPreference())
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference for workload pool %q: %w", cfg.GetName(), err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference for workload pool %q: %w", cfg.GetName(), err)
+		}
+		opts.SetReadPreference(rp)
+	}
+	client, err := mongo.Connect(ctx, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workload pool %q: %w", cfg.GetName(), err)
+	}
+	return client, nil
+}
+
+// disconnectWorkloads disconnects the workload clients of state, logging failures
+func disconnectWorkloads(state *clientState) {
+	if state == nil {
+		return
+	}
+	for name, w := range state.workloads {
+		ctx, cancel := context.WithTimeout(context.Background(), workloadDisconnectTimeout)
+		if err := w.client.Disconnect(ctx); err != nil {
+			log.Warnf("failed to disconnect mongodb workload pool %s: %v", name, err)
+		}
+		cancel()
+	}
+}
+
+// stateFor returns the client state serving ctx: the pool named by WithWorkload, else the pool
+// mapped to the context owner label, else the default pool
+func (p *PlugMongoDB) stateFor(ctx context.Context) *clientState {
+	s := p.loadState()
+	if s == nil || len(s.workloads) == 0 || ctx == nil {
+		return s
+	}
+	name := Workload(ctx)
+	if name == "" {
+		name = s.labelWorkloads[OpLabel(ctx)]
+	}
+	if w, ok := s.workloads[name]; ok {
+		return w
+	}
+	return s
+}
+
+// ClientFor returns the client of the workload pool selected by ctx
+func (p *PlugMongoDB) ClientFor(ctx context.Context) *mongo.Client {
+	if s := p.stateFor(ctx); s != nil {
+		return s.client
+	}
+	return nil
+}
+
+// DatabaseFor returns the configured database on the workload pool selected by ctx
+func (p *PlugMongoDB) DatabaseFor(ctx context.Context) *mongo.Database {
+	if s := p.stateFor(ctx); s != nil {
+		return s.database
+	}
+	return nil
+}
+
+// CollectionFor returns a collection on the workload pool selected by ctx, with the read preference
+// of WithSmartRead and WithMaxStaleness calls (stale reads are rerouted, never rejected)
+func (p *PlugMongoDB) CollectionFor(ctx context.Context, name string) *mongo.Collection {
+	db := p.DatabaseFor(ctx)
+	if db == nil {
+		return nil
+	}
+	if f, ok := freshnessBound(ctx); ok && f.action == StaleReject {
+		ctx = WithMaxStaleness(ctx, f.bound, StaleReroute)
+	}
+	coll, _ := p.readCollection(ctx, db.Collection(name))
+	return coll
+}
@@ -0,0 +1,92 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestWorkloadSelection(t *testing.T) {
+	// Connect does not contact the server until the first operation
+	main, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = main.Disconnect(context.Background())
+		_ = batch.Disconnect(context.Background())
+	}()
+
+	p := NewMongoDBClient()
+	state := newClientState(main, "app")
+	state.addWorkload(&conf.WorkloadPool{Name: "batch", OpLabels: []string{"export"}}, batch, "app")
+	p.swapState(state)
+
+	ctx := context.Background()
+	if p.ClientFor(ctx) != main {
+		t.Error("expected the default pool without a workload")
+	}
+	if p.ClientFor(WithWorkload(ctx, "batch")) != batch {
+		t.Error("expected the batch pool for WithWorkload")
+	}
+	if p.ClientFor(WithOpLabel(ctx, "export")) != batch {
+		t.Error("expected the batch pool for a mapped owner label")
+	}
+	if p.ClientFor(WithWorkload(ctx, "unknown")) != main {
+		t.Error("expected unknown workloads to use the default pool")
+	}
+	db, err := p.databaseHandle(WithWorkload(ctx, "batch"), "")
+	if err != nil || db.Client() != batch || db.Name() != "app" {
+		t.Errorf("expected batch database handle, got %v, %v", db, err)
+	}
+	if p.GetClient() != main {
+		t.Error("GetClient must keep returning the default pool")
+	}
+}
+
+func TestBatchClientDefaults(t *testing.T) {
+	p := NewMongoDBClient()
+	p.conf.Store(&conf.MongoDB{})
+	if batch, pool := p.newBatchClient(p.config()); batch != nil || pool != nil {
+		t.Fatal("expected no batch client when disabled")
+	}
+	// A reload builds the client before storing its configuration
+	next := &conf.MongoDB{BatchClient: &conf.BatchClient{Enabled: true}}
+	if batch, _ := p.newBatchClient(next); batch == nil {
+		t.Error("expected the batch client of the configuration being built")
+	}
+
+	WithBatchClient(0, 0)(p)
+	batch, pool := p.newBatchClient(p.config())
+	if batch == nil || pool == nil {
+		t.Fatal("expected batch client")
+	}
+	if pool.Name != BatchWorkload || pool.MaxPoolSize != defaultBatchMaxPoolSize || pool.ReadPreference != defaultBatchReadPreference {
+		t.Errorf("unexpected batch pool defaults: %+v", pool)
+	}
+	if batch.timeout != defaultBatchOperationTimeout {
+		t.Errorf("expected default batch timeout, got %s", batch.timeout)
+	}
+
+	p.swapState(&clientState{batch: batch})
+	// A client built but not published (a standby or a rebuild) keeps its own limiter
+	if standby, _ := p.newBatchClient(p.config()); standby == batch || p.BatchClient() != batch {
+		t.Error("expected the published state's batch client")
+	}
+	if p.batchFor(context.Background()) != nil {
+		t.Error("expected no batch limits outside the batch workload")
+	}
+	if p.batchFor(batch.Context(context.Background())) != batch {
+		t.Error("expected batch limits for the batch workload")
+	}
+	if err := batch.Wait(context.Background()); err != nil {
+		t.Errorf("first operation should pass the rate limit: %v", err)
+	}
+}
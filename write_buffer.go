@@ -0,0 +1,217 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+)
+
+const (
+	defaultWriteBufferSize = 1000
+	defaultWriteBufferWait = 10 * time.Second
+)
+
+// Outcomes of buffered writes, as reported in the write buffer metric
+const (
+	bufferReplayed = "replayed"
+	bufferExpired  = "expired"
+	bufferRejected = "rejected"
+)
+
+// writeOperations are the helper operations held by the write buffer
+var writeOperations = map[string]bool{
+	"insert": true, "update": true, "delete": true, "replace": true, "findAndModify": true, "bulkWrite": true,
+}
+
+// primaryElection tracks whether the replica set of a client is electing a primary
+type primaryElection struct {
+	mu sync.Mutex
+	// seen is set once a primary was discovered; losing it starts an election
+	seen bool
+	// since is when the primary was lost, zero while one is known
+	since time.Time
+	// elected is closed when a primary is elected, nil while one is known
+	elected chan struct{}
+}
+
+// observe records the primary of a topology description, empty when it has none
+func (e *primaryElection) observe(primary string, now time.Time) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case primary != "":
+		e.seen = true
+		if e.elected != nil {
+			close(e.elected)
+			e.elected = nil
+		}
+		e.since = time.Time{}
+	case e.seen && e.elected == nil:
+		e.since = now
+		e.elected = make(chan struct{})
+	}
+}
+
+// pending returns a channel closed once a primary is elected and when the primary was lost; ok is
+// false while a primary is known
+func (e *primaryElection) pending() (elected <-chan struct{}, since time.Time, ok bool) {
+	if e == nil {
+		return nil, time.Time{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.elected == nil {
+		return nil, time.Time{}, false
+	}
+	return e.elected, e.since, true
+}
+
+// PrimaryElectionError is returned for a helper write the write buffer could not hold until a new
+// primary was elected
+type PrimaryElectionError struct {
+	Operation string
+	// Since is when the replica set lost its primary
+	Since time.Time
+	// Full is set when the buffer already held max_writes writes; otherwise max_wait passed
+	Full bool
+}
+
+func (e *PrimaryElectionError) Error() string {
+	if e.Full {
+		return fmt.Sprintf("%s failed: no primary since %s and the write buffer is full", e.Operation, e.Since.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s failed: no primary elected since %s", e.Operation, e.Since.Format(time.RFC3339))
+}
+
+// Is classifies writes failed during a primary election as unavailable
+func (e *PrimaryElectionError) Is(target error) bool { return target == ErrUnavailable }
+
+// writeBuffer bounds the writes held during primary elections
+type writeBuffer struct {
+	maxWrites int
+	maxWait   time.Duration
+
+	mu   sync.Mutex
+	held int
+}
+
+// newWriteBuffer returns the write buffer of write_buffer, or nil when it is not enabled
+func newWriteBuffer(c *conf.WriteBuffer) (*writeBuffer, error) {
+	if !c.GetEnabled() {
+		return nil, nil
+	}
+	if c.GetMaxWrites() < 0 {
+		return nil, fmt.Errorf("max_writes %d cannot be negative", c.GetMaxWrites())
+	}
+	if c.GetMaxWait().AsDuration() < 0 {
+		return nil, fmt.Errorf("max_wait cannot be negative")
+	}
+	b := &writeBuffer{maxWrites: int(c.GetMaxWrites()), maxWait: c.GetMaxWait().AsDuration()}
+	if b.maxWrites == 0 {
+		b.maxWrites = defaultWriteBufferSize
+	}
+	if b.maxWait == 0 {
+		b.maxWait = defaultWriteBufferWait
+	}
+	return b, nil
+}
+
+// hold reserves a place for a write and returns the writes held; ok is false when the buffer is full
+func (b *writeBuffer) hold() (held int, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.held >= b.maxWrites {
+		return b.held, false
+	}
+	b.held++
+	return b.held, true
+}
+
+// release frees the place of a held write and returns the writes still held
+func (b *writeBuffer) release() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.held--
+	return b.held
+}
+
+// bufferable reports whether the write buffer holds the helper operation name issued with ctx;
+// writes of a transaction retry with the transaction instead, and NonIdempotent writes fail fast
+func (p *PlugMongoDB) bufferable(ctx context.Context, name string) bool {
+	return p.writeBuffer != nil && writeOperations[name] && IdempotencyFrom(ctx) != NonIdempotent && !inTransaction(ctx)
+}
+
+// awaitPrimary holds a helper write while the replica set elects a primary and returns once one is
+// elected; it returns a *PrimaryElectionError when the buffer is full or max_wait passes first
+func (p *PlugMongoDB) awaitPrimary(ctx context.Context, name string) error {
+	if !p.bufferable(ctx, name) {
+		return nil
+	}
+	state := p.loadState()
+	if state == nil {
+		return nil
+	}
+	elected, since, ok := state.election.pending()
+	if !ok {
+		return nil
+	}
+	b := p.writeBuffer
+	class := IdempotencyFrom(ctx).String()
+	held, ok := b.hold()
+	if !ok {
+		p.prometheusMetrics.RecordBufferedWrite(p.config(), bufferRejected, class)
+		return &PrimaryElectionError{Operation: name, Since: since, Full: true}
+	}
+	p.prometheusMetrics.SetBufferedWrites(p.config(), held)
+	defer func() { p.prometheusMetrics.SetBufferedWrites(p.config(), b.release()) }()
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case <-elected:
+		p.prometheusMetrics.RecordBufferedWrite(p.config(), bufferReplayed, class)
+		log.Debugf("mongodb %s held %v for the primary election", name, time.Since(since))
+		return nil
+	case <-timer.C:
+		p.prometheusMetrics.RecordBufferedWrite(p.config(), bufferExpired, class)
+		return &PrimaryElectionError{Operation: name, Since: since}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// awaitsElection reports whether a helper write that failed for the transient reason, on a primary
+// that stepped down before applying it (or possibly applied it, for Idempotent writes; see
+// transientReason), is held until the replica set elects a new primary
+func (p *PlugMongoDB) awaitsElection(ctx context.Context, name, reason string) bool {
+	if reason != RetryNotPrimary && reason != RetryNetwork || !p.bufferable(ctx, name) {
+		return false
+	}
+	state := p.loadState()
+	if state == nil {
+		return false
+	}
+	_, _, ok := state.election.pending()
+	return ok
+}
+
+// replayAfterElection runs a helper write and, when it failed during a primary election (see
+// awaitsElection), holds it until the election and runs it once more. It replays writes that
+// retryTransient does not retry; retried writes wait for elections within their retry attempts.
+func (p *PlugMongoDB) replayAfterElection(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if !p.awaitsElection(ctx, name, transientReason(name, IdempotencyFrom(ctx), err)) {
+		return err
+	}
+	if err := p.awaitPrimary(ctx, name); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
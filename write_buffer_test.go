@@ -0,0 +1,172 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPrimaryElection(t *testing.T) {
+	var e primaryElection
+	e.observe("", time.Now())
+	if _, _, ok := e.pending(); ok {
+		t.Fatal("the initial discovery of the primary is not an election")
+	}
+	e.observe("db-0:27017", time.Now())
+	lost := time.Now()
+	e.observe("", lost)
+	elected, since, ok := e.pending()
+	if !ok || !since.Equal(lost) {
+		t.Fatalf("pending() = %v, %v after losing the primary", since, ok)
+	}
+	e.observe("", time.Now())
+	if _, again, _ := e.pending(); !again.Equal(lost) {
+		t.Error("a topology change without primary should not restart the election")
+	}
+	e.observe("db-1:27017", time.Now())
+	select {
+	case <-elected:
+	default:
+		t.Fatal("electing a primary should release the waiting writes")
+	}
+	if _, _, ok := e.pending(); ok {
+		t.Error("no election should be pending once a primary is elected")
+	}
+}
+
+func TestNewWriteBuffer(t *testing.T) {
+	if b, err := newWriteBuffer(&conf.WriteBuffer{}); b != nil || err != nil {
+		t.Errorf("disabled buffer = %v, %v", b, err)
+	}
+	b, err := newWriteBuffer(&conf.WriteBuffer{Enabled: true})
+	if err != nil || b.maxWrites != defaultWriteBufferSize || b.maxWait != defaultWriteBufferWait {
+		t.Errorf("defaults = %+v, %v", b, err)
+	}
+	if _, err := newWriteBuffer(&conf.WriteBuffer{Enabled: true, MaxWait: durationpb.New(-time.Second)}); err == nil {
+		t.Error("a negative max_wait should fail")
+	}
+}
+
+// electingPlugin returns a plugin with the write buffer whose replica set lost its primary
+func electingPlugin(t *testing.T, maxWrites int32, maxWait time.Duration) (*PlugMongoDB, *primaryElection) {
+	t.Helper()
+	p := NewMongoDBClient()
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+	WithWriteBuffer(maxWrites, maxWait)(p)
+	b, err := newWriteBuffer(p.config().GetWriteBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.writeBuffer = b
+	election := &primaryElection{}
+	election.observe("db-0:27017", time.Now())
+	election.observe("", time.Now())
+	p.swapState(&clientState{election: election})
+	return p, election
+}
+
+func TestAwaitPrimary(t *testing.T) {
+	p, election := electingPlugin(t, 1, time.Second)
+	if err := p.awaitPrimary(t.Context(), "find"); err != nil {
+		t.Fatalf("reads should not be held: %v", err)
+	}
+
+	held := make(chan error)
+	go func() { held <- p.awaitPrimary(t.Context(), "insert") }()
+	for testutil.ToFloat64(p.prometheusMetrics.bufferedWrites.WithLabelValues("test")) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	var full *PrimaryElectionError
+	if err := p.awaitPrimary(t.Context(), "update"); !errors.As(err, &full) || !full.Full || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("write beyond max_writes = %v", err)
+	}
+	election.observe("db-1:27017", time.Now())
+	if err := <-held; err != nil {
+		t.Fatalf("held write = %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.bufferedWritesTotal.WithLabelValues("test", bufferReplayed, "unknown")); got != 1 {
+		t.Errorf("replayed writes = %v", got)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.bufferedWrites.WithLabelValues("test")); got != 0 {
+		t.Errorf("held writes = %v", got)
+	}
+
+	if err := p.awaitPrimary(WithIdempotency(t.Context(), NonIdempotent), "update"); err != nil {
+		t.Fatalf("non-idempotent writes should not be held: %v", err)
+	}
+
+	p, _ = electingPlugin(t, 0, 10*time.Millisecond)
+	var expired *PrimaryElectionError
+	if err := p.awaitPrimary(t.Context(), "insert"); !errors.As(err, &expired) || expired.Full {
+		t.Fatalf("write held past max_wait = %v", err)
+	}
+}
+
+func TestReplayAfterElection(t *testing.T) {
+	p, election := electingPlugin(t, 0, time.Second)
+	calls := 0
+	err := p.replayAfterElection(t.Context(), "insert", func(context.Context) error {
+		calls++
+		if calls == 1 {
+			go election.observe("db-1:27017", time.Now())
+			return mongo.CommandError{Code: 10107, Message: "not primary"}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("replay = %v after %d calls", err, calls)
+	}
+
+	p, _ = electingPlugin(t, 0, time.Second)
+	calls = 0
+	err = p.replayAfterElection(t.Context(), "update", func(context.Context) error {
+		calls++
+		return mongo.CommandError{Code: writeConflictCode}
+	})
+	if !hasServerErrorCode(err, writeConflictCode) || calls != 1 {
+		t.Errorf("write conflicts should not be replayed: %v after %d calls", err, calls)
+	}
+
+	// Idempotent writes are replayed after network errors that may have applied them
+	p, election = electingPlugin(t, 0, time.Second)
+	calls = 0
+	network := mongo.CommandError{Labels: []string{"NetworkError"}}
+	err = p.replayAfterElection(WithIdempotency(t.Context(), Idempotent), "update", func(context.Context) error {
+		calls++
+		if calls == 1 {
+			go election.observe("db-1:27017", time.Now())
+			return network
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("idempotent replay = %v after %d calls", err, calls)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.bufferedWritesTotal.WithLabelValues("test", bufferReplayed, "idempotent")); got != 1 {
+		t.Errorf("replayed idempotent writes = %v", got)
+	}
+}
+
+func TestRetriesShareElectionAttempts(t *testing.T) {
+	p, election := electingPlugin(t, 0, time.Second)
+	WithRetryPolicy(RetryPolicyFunc(func(a RetryAttempt) (time.Duration, bool) {
+		return 0, a.Attempt < 2
+	}))(p)
+	calls := 0
+	err := p.retryTransient(t.Context(), "insert", func(context.Context) error {
+		calls++
+		// Every attempt fails during a new election
+		election.observe("", time.Now())
+		go election.observe("db-1:27017", time.Now())
+		return mongo.CommandError{Code: 10107, Message: "not primary"}
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("retries = %v after %d calls, want the 2 attempts of the policy", err, calls)
+	}
+}
@@ -0,0 +1,213 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-lynx/lynx-mongodb/conf"
+	"github.com/go-lynx/lynx/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type unguardedWriteKey struct{}
+
+// WriteGuardError is returned when an UpdateMany or DeleteMany filter is empty or lacks the
+// fields its collection requires
+type WriteGuardError struct {
+	Operation  string
+	Collection string
+	// Empty is set when the filter matches every document
+	Empty bool
+	// Missing lists the required fields absent from the filter
+	Missing []string
+}
+
+func (e *WriteGuardError) Error() string {
+	if e.Empty {
+		return fmt.Sprintf("%s on %s rejected: empty filter would touch every document", e.Operation, e.Collection)
+	}
+	return fmt.Sprintf("%s on %s rejected: filter lacks required fields %s", e.Operation, e.Collection, strings.Join(e.Missing, ", "))
+}
+
+// AllowUnguardedWrite returns a context whose UpdateMany and DeleteMany calls skip the write
+// guard, for deliberate collection-wide changes such as backfills
+func AllowUnguardedWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unguardedWriteKey{}, true)
+}
+
+func unguardedWrite(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(unguardedWriteKey{}).(bool)
+	return on
+}
+
+// UpdateMany updates the documents of collection matching filter, within the context scope.
+// The write guard rejects empty filters and filters without the required fields of the collection.
+func (p *PlugMongoDB) UpdateMany(ctx context.Context, collection string, filter, update any, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	filter, err := p.guardedFilter(ctx, "updateMany", collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	var result *mongo.UpdateResult
+	op := operation{name: "update", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		updateOpts := append([]*options.UpdateOptions{callUpdateOptions(ctx)}, opts...)
+		res, err := coll.UpdateMany(ctx, filter, update, append(updateOpts, commentUpdateOptions(ctx))...)
+		if err != nil {
+			return err
+		}
+		result = res
+		return nil
+	})
+	return result, err
+}
+
+// DeleteMany deletes the documents of collection matching filter, within the context scope.
+// The write guard rejects empty filters and filters without the required fields of the collection.
+func (p *PlugMongoDB) DeleteMany(ctx context.Context, collection string, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	filter, err := p.guardedFilter(ctx, "deleteMany", collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	var result *mongo.DeleteResult
+	op := operation{name: "delete", database: p.databaseName(""), collection: collection, query: filter}
+	err = p.runOperation(ctx, op, func(ctx context.Context) error {
+		coll, err := p.collectionHandle(ctx, collection)
+		if err != nil {
+			return err
+		}
+		deleteOpts := append(append([]*options.DeleteOptions(nil), opts...), commentDeleteOptions(ctx))
+		res, err := coll.DeleteMany(ctx, filter, deleteOpts...)
+		if err != nil {
+			return err
+		}
+		p.InvalidateStats(collection)
+		result = res
+		return nil
+	})
+	return result, err
+}
+
+// guardedFilter checks filter against the write guard of collection, then scopes it. The guard sees
+// the caller's filter: the scope predicate would otherwise turn an empty filter into one matching
+// the whole tenant, and always hold the scope fields.
+func (p *PlugMongoDB) guardedFilter(ctx context.Context, operation, collection string, filter any) (any, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection name cannot be empty")
+	}
+	if unguardedWrite(ctx) {
+		return ScopeFilter(ctx, collection, filter)
+	}
+	if err := p.checkWriteGuard(operation, collection, filter); err != nil {
+		log.Warnw("key", "mongodb", "event", "write_guard_rejected", "operation", operation, "collection", collection, "error", err)
+		if m := p.prometheusMetrics; m != nil {
+			if name, ok := p.metricsCollection(p.databaseName(""), collection); ok {
+				m.RecordWriteGuardRejection(p.config(), name, operation)
+			}
+		}
+		return nil, err
+	}
+	return ScopeFilter(ctx, collection, filter)
+}
+
+// checkWriteGuard requires a non-empty filter (unless a matching rule allows empty ones) holding
+// the scope fields of the collection and the required fields of every matching rule
+func (p *PlugMongoDB) checkWriteGuard(operation, collection string, filter any) error {
+	allowEmpty := false
+	var required []string
+	if schema := lookupSchema(collection); schema != nil {
+		required = append(required, schema.scopeFields...)
+	}
+	for _, rule := range p.config().GetWriteGuards() {
+		if !writeGuardMatches(rule, collection) {
+			continue
+		}
+		allowEmpty = allowEmpty || rule.GetAllowEmpty()
+		required = append(required, rule.GetRequiredFields()...)
+	}
+
+	fields, err := filterFields(filter)
+	if err != nil {
+		return fmt.Errorf("%s on %s rejected: %w", operation, collection, err)
+	}
+	if len(fields) == 0 && !allowEmpty {
+		return &WriteGuardError{Operation: operation, Collection: collection, Empty: true}
+	}
+	var missing []string
+	for _, field := range required {
+		if !fields[field] && !slices.Contains(missing, field) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return &WriteGuardError{Operation: operation, Collection: collection, Missing: missing}
+	}
+	return nil
+}
+
+func writeGuardMatches(rule *conf.WriteGuard, collection string) bool {
+	ok, _ := path.Match(rule.GetCollection(), collection)
+	return ok
+}
+
+// filterFields returns the fields constrained by filter at the top level or in top-level $and clauses
+func filterFields(filter any) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	if filter == nil {
+		return fields, nil
+	}
+	raw, ok := filter.(bson.Raw)
+	if !ok {
+		data, err := bson.Marshal(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		raw = data
+	}
+	var collect func(doc bson.Raw)
+	collect = func(doc bson.Raw) {
+		elems, _ := doc.Elements()
+		for _, e := range elems {
+			if e.Key() != "$and" {
+				fields[e.Key()] = true
+				continue
+			}
+			clauses, ok := e.Value().ArrayOK()
+			if !ok {
+				continue
+			}
+			values, _ := clauses.Values()
+			for _, v := range values {
+				if clause, ok := v.DocumentOK(); ok {
+					collect(clause)
+				}
+			}
+		}
+	}
+	collect(raw)
+	return fields, nil
+}
+
+// validateWriteGuards checks the collection patterns of the write guard rules
+func validateWriteGuards(rules []*conf.WriteGuard) error {
+	for _, rule := range rules {
+		if rule.GetCollection() == "" {
+			return fmt.Errorf("write guard collection cannot be empty")
+		}
+		if _, err := path.Match(rule.GetCollection(), ""); err != nil {
+			return fmt.Errorf("invalid write guard pattern %q: %w", rule.GetCollection(), err)
+		}
+	}
+	return nil
+}
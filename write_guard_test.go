@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestWriteGuard(t *testing.T) {
+	registerScopedOrders(t)
+	p := NewMongoDBClient()
+	WithWriteGuard("audit_*", []string{"created_at"}, false)(p)
+	WithWriteGuard("sessions", nil, true)(p)
+	p.prometheusMetrics = NewPrometheusMetrics(nil)
+
+	var guardErr *WriteGuardError
+	if _, err := p.DeleteMany(context.Background(), "users", bson.D{}); !errors.As(err, &guardErr) || !guardErr.Empty {
+		t.Errorf("expected an empty filter rejection, got %v", err)
+	}
+	if _, err := p.UpdateMany(context.Background(), "audit_2024", bson.M{"actor": "a1"}, bson.M{"$set": bson.M{"x": 1}}); !errors.As(err, &guardErr) || !reflect.DeepEqual(guardErr.Missing, []string{"created_at"}) {
+		t.Errorf("expected a missing field rejection, got %v", err)
+	}
+	// Unscoped calls on scoped collections must still filter on the scope fields
+	if _, err := p.DeleteMany(Unscoped(context.Background()), "scope_test_orders", bson.M{"status": "void"}); !errors.As(err, &guardErr) || guardErr.Missing[0] != "tenant_id" {
+		t.Errorf("expected a missing scope field rejection, got %v", err)
+	}
+	if got := testutil.ToFloat64(p.prometheusMetrics.writeGuardRejections.WithLabelValues("test", "users", "deleteMany")); got != 1 {
+		t.Errorf("got %v rejections, want 1", got)
+	}
+
+	// Accepted calls reach the client, which is not initialized here
+	notGuarded := func(err error) bool { return err != nil && !errors.As(err, &guardErr) }
+	if _, err := p.DeleteMany(context.Background(), "sessions", nil); !notGuarded(err) {
+		t.Errorf("allow_empty rule: got %v", err)
+	}
+	scoped := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+	if _, err := p.DeleteMany(scoped, "scope_test_orders", bson.M{"tenant_id": "t1", "status": "void"}); !notGuarded(err) {
+		t.Errorf("scoped filter: got %v", err)
+	}
+	if _, err := p.DeleteMany(AllowUnguardedWrite(context.Background()), "users", nil); !notGuarded(err) {
+		t.Errorf("unguarded write: got %v", err)
+	}
+}
+
+func TestWriteGuardChecksCallerFilter(t *testing.T) {
+	registerScopedOrders(t)
+	p := NewMongoDBClient()
+	scoped := WithScope(context.Background(), bson.D{{Key: "tenant_id", Value: "t1"}})
+
+	// The scope predicate must not turn an empty filter into a tenant-wide one
+	var guardErr *WriteGuardError
+	if _, err := p.DeleteMany(scoped, "scope_test_orders", bson.D{}); !errors.As(err, &guardErr) || !guardErr.Empty {
+		t.Errorf("scoped empty DeleteMany: got %v", err)
+	}
+	if _, err := p.UpdateMany(scoped, "scope_test_orders", nil, bson.M{"$set": bson.M{"x": 1}}); !errors.As(err, &guardErr) || !guardErr.Empty {
+		t.Errorf("scoped empty UpdateMany: got %v", err)
+	}
+	// nor supply the scope fields
+	if _, err := p.DeleteMany(scoped, "scope_test_orders", bson.M{"status": "void"}); !errors.As(err, &guardErr) || guardErr.Missing[0] != "tenant_id" {
+		t.Errorf("scoped filter without scope fields: got %v", err)
+	}
+
+	models := []mongo.WriteModel{mongo.NewDeleteManyModel().SetFilter(bson.D{})}
+	if _, err := p.BulkWrite(scoped, "scope_test_orders", models, BulkOptions{}); !errors.As(err, &guardErr) || !guardErr.Empty {
+		t.Errorf("scoped empty DeleteManyModel: got %v", err)
+	}
+	models = []mongo.WriteModel{mongo.NewUpdateManyModel().SetFilter(bson.M{"status": "void"}).SetUpdate(bson.M{"$set": bson.M{"x": 1}})}
+	if _, err := p.BulkWrite(scoped, "scope_test_orders", models, BulkOptions{}); !errors.As(err, &guardErr) || guardErr.Missing[0] != "tenant_id" {
+		t.Errorf("scoped UpdateManyModel without scope fields: got %v", err)
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	filter := bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "status", Value: "open"}}, bson.M{"tenant_id": "t1"}}}}
+	fields, err := filterFields(filter)
+	if err != nil || !fields["status"] || !fields["tenant_id"] || fields["$and"] {
+		t.Errorf("unexpected fields %v %v", fields, err)
+	}
+	fields, _ = filterFields(bson.M{"$or": bson.A{bson.M{"tenant_id": "t1"}, bson.M{"tenant_id": "t2"}}})
+	if fields["tenant_id"] {
+		t.Error("fields under $or must not count as required fields")
+	}
+}
+
+func TestValidateWriteGuards(t *testing.T) {
+	p := NewMongoDBClient()
+	WithURI("mongodb://localhost:27017")(p)
+	WithDatabase("test")(p)
+	WithWriteGuard("audit_[", nil, false)(p)
+	if err := p.normalizeConfig(); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}